@@ -6,7 +6,6 @@ import (
 	"fmt"
 	"github.com/pkg/errors"
 	"github.com/pterodactyl/wings/config"
-	"go.uber.org/zap"
 	"io/ioutil"
 	"net/http"
 	"strings"
@@ -26,7 +25,7 @@ type PanelRequest struct {
 
 // Builds the base request instance that can be used with the HTTP client.
 func (r *PanelRequest) GetClient() *http.Client {
-	return &http.Client{Timeout: time.Second * 30}
+	return &http.Client{Timeout: time.Second * time.Duration(config.Get().PanelClient.Timeout)}
 }
 
 func (r *PanelRequest) SetHeaders(req *http.Request) *http.Request {
@@ -46,33 +45,11 @@ func (r *PanelRequest) GetEndpoint(endpoint string) string {
 }
 
 func (r *PanelRequest) Get(url string) (*http.Response, error) {
-	c := r.GetClient()
-
-	req, err := http.NewRequest(http.MethodGet, r.GetEndpoint(url), nil)
-	req = r.SetHeaders(req)
-
-	if err != nil {
-		return nil, err
-	}
-
-	zap.S().Debugw("GET request to endpoint", zap.String("endpoint", r.GetEndpoint(url)), zap.Any("headers", req.Header))
-
-	return c.Do(req)
+	return r.do(http.MethodGet, url, nil)
 }
 
 func (r *PanelRequest) Post(url string, data []byte) (*http.Response, error) {
-	c := r.GetClient()
-
-	req, err := http.NewRequest(http.MethodPost, r.GetEndpoint(url), bytes.NewBuffer(data))
-	req = r.SetHeaders(req)
-
-	if err != nil {
-		return nil, err
-	}
-
-	zap.S().Debugw("POST request to endpoint", zap.String("endpoint", r.GetEndpoint(url)), zap.Any("headers", req.Header))
-
-	return c.Do(req)
+	return r.do(http.MethodPost, url, data)
 }
 
 // Determines if the API call encountered an error. If no request has been made
@@ -0,0 +1,371 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"github.com/pkg/errors"
+	"github.com/pterodactyl/wings/config"
+	"github.com/pterodactyl/wings/store"
+	"go.uber.org/zap"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"net"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+)
+
+// Returned when a request is not sent because too many requests to the Panel have failed
+// recently, and the cooldown before trying again has not passed yet.
+type panelUnavailable struct{}
+
+func (e *panelUnavailable) Error() string {
+	return "panel is unavailable, requests are paused until the cooldown has passed"
+}
+
+func IsPanelUnavailableError(err error) bool {
+	_, ok := errors.Cause(err).(*panelUnavailable)
+
+	return ok
+}
+
+// Stops requests from being made to the Panel after enough of them in a row have failed, so
+// that every operation does not have to wait for its own requests to time out while the
+// Panel is down. Once the cooldown has passed requests are attempted again, and the first
+// one to fail opens the breaker again.
+type circuitBreaker struct {
+	mu        sync.Mutex
+	failures  int
+	openUntil time.Time
+}
+
+var breaker circuitBreaker
+
+// Determines if a request can be made to the Panel.
+func (b *circuitBreaker) allow() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return !time.Now().Before(b.openUntil)
+}
+
+// Records the outcome of a request made to the Panel.
+func (b *circuitBreaker) record(ok bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	cfg := config.Get().PanelClient
+	if ok {
+		if cfg.BreakerThreshold > 0 && b.failures >= cfg.BreakerThreshold {
+			zap.S().Infow("panel can be reached again, resuming requests")
+		}
+
+		b.failures = 0
+		b.openUntil = time.Time{}
+
+		return
+	}
+
+	b.failures++
+	if cfg.BreakerThreshold > 0 && b.failures >= cfg.BreakerThreshold {
+		if b.failures == cfg.BreakerThreshold {
+			zap.S().Warnw("too many requests to the panel have failed, pausing requests", zap.Int("failures", b.failures), zap.Int("cooldown", cfg.BreakerCooldown))
+		}
+
+		b.openUntil = time.Now().Add(time.Second * time.Duration(cfg.BreakerCooldown))
+	}
+}
+
+// Returns the time to wait before retrying a request that has already been attempted the
+// given number of times, not counting the first attempt.
+func backoff(retry int) time.Duration {
+	cfg := config.Get().PanelClient
+
+	max := time.Millisecond * time.Duration(cfg.BackoffMax)
+	d := time.Millisecond * time.Duration(cfg.BackoffInitial)
+	for i := 0; i < retry && d < max; i++ {
+		d *= 2
+	}
+
+	if d > max {
+		d = max
+	}
+
+	if d <= 0 {
+		return 0
+	}
+
+	return time.Duration(rand.Int63n(int64(d) + 1))
+}
+
+// Determines if a request can be sent more than once without the Panel carrying it out more
+// than once.
+func isIdempotent(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodPut, http.MethodDelete:
+		return true
+	}
+
+	return false
+}
+
+// Determines if a request failed because a connection to the Panel could not be made, in
+// which case the Panel never received it.
+func notSent(err error) bool {
+	if uerr, ok := err.(*url.Error); ok {
+		err = uerr.Err
+	}
+
+	operr, ok := err.(*net.OpError)
+
+	return ok && operr.Op == "dial"
+}
+
+// Determines if a request should be retried, which is only the case when the Panel could
+// not be reached or was unable to handle the request. Requests that are not idempotent are
+// only retried if they never reached the Panel, or the Panel rate limited them before
+// handling them.
+func shouldRetry(method string, resp *http.Response, err error) bool {
+	if err == nil && resp.StatusCode == http.StatusTooManyRequests {
+		return true
+	}
+
+	if !isIdempotent(method) {
+		return notSent(err)
+	}
+
+	return err != nil || resp.StatusCode >= 500
+}
+
+// Makes a request to the Panel, retrying it with an exponential backoff if it fails. The
+// response of the last attempt is returned once the request succeeds, all of the retries
+// have been used, or another attempt would exceed the time budget for the request.
+func (r *PanelRequest) do(method string, url string, data []byte) (*http.Response, error) {
+	cfg := config.Get().PanelClient
+	deadline := time.Now().Add(time.Second * time.Duration(cfg.Budget))
+
+	for retry := 0; ; retry++ {
+		if !breaker.allow() {
+			return nil, errors.WithStack(&panelUnavailable{})
+		}
+
+		var body io.Reader
+		if data != nil {
+			body = bytes.NewReader(data)
+		}
+
+		req, err := http.NewRequest(method, r.GetEndpoint(url), body)
+		if err != nil {
+			return nil, err
+		}
+		req = r.SetHeaders(req)
+
+		zap.S().Debugw(method+" request to endpoint", zap.String("endpoint", r.GetEndpoint(url)), zap.Any("headers", req.Header))
+
+		resp, err := r.GetClient().Do(req)
+
+		// Requests that are rate limited reached the Panel, so they do not count towards
+		// the failures needed to stop sending requests.
+		breaker.record(err == nil && resp.StatusCode < 500)
+
+		if !shouldRetry(method, resp, err) || retry >= cfg.Retries {
+			return resp, err
+		}
+
+		wait := backoff(retry)
+		if cfg.Budget > 0 && time.Now().Add(wait).After(deadline) {
+			return resp, err
+		}
+
+		if resp != nil {
+			io.Copy(ioutil.Discard, resp.Body)
+			resp.Body.Close()
+		}
+
+		zap.S().Debugw("retrying failed request to panel", zap.String("endpoint", r.GetEndpoint(url)), zap.Int("retry", retry+1), zap.Duration("wait", wait), zap.Error(err))
+
+		time.Sleep(wait)
+	}
+}
+
+// A report that could not be sent to the Panel, which is sent again once it can be reached.
+type queuedReport struct {
+	Method string `json:"method"`
+	Url    string `json:"url"`
+	Body   []byte `json:"body"`
+}
+
+// The key that the queued reports are saved under in the state database.
+const reportsKey = "queue"
+
+var reportStore = store.NewRepository(store.PanelReports)
+
+var (
+	reportsMu       sync.Mutex
+	reports         []*queuedReport
+	flushingReports bool
+
+	// Stops the queued reports from being sent once it is canceled, which is done when the
+	// daemon is stopped. The reports are kept in the state database until the next start.
+	reportsCtx = context.Background()
+)
+
+// Loads the reports that were still queued when the daemon was last stopped and starts
+// sending them to the Panel, until the context is canceled.
+func StartReports(ctx context.Context) {
+	reportsMu.Lock()
+	defer reportsMu.Unlock()
+
+	reportsCtx = ctx
+
+	var saved []*queuedReport
+	if _, err := reportStore.Get(reportsKey, &saved); err != nil {
+		zap.S().Warnw("failed to load queued reports for the panel", zap.Error(err))
+	}
+
+	if len(saved) == 0 {
+		return
+	}
+
+	zap.S().Infow("sending reports queued before the daemon was stopped to the panel", zap.Int("reports", len(saved)))
+
+	reports = append(saved, reports...)
+	saveReports()
+
+	if !flushingReports {
+		flushingReports = true
+		go flushReports(ctx)
+	}
+}
+
+// Saves the queued reports to the state database. This must be called while holding the
+// lock on the queue.
+func saveReports() {
+	if err := reportStore.Put(reportsKey, reports); err != nil {
+		zap.S().Warnw("failed to save queued reports for the panel", zap.Error(err))
+	}
+}
+
+// Returns the number of reports waiting to be sent to the Panel.
+func QueuedReports() int {
+	reportsMu.Lock()
+	defer reportsMu.Unlock()
+
+	return len(reports)
+}
+
+// Adds a report to the queue, dropping the oldest report if the queue is full, and starts
+// sending the queue to the Panel if that is not already happening.
+func queueReport(q *queuedReport) {
+	reportsMu.Lock()
+	defer reportsMu.Unlock()
+
+	if size := config.Get().PanelClient.QueueSize; size > 0 && len(reports) >= size {
+		zap.S().Warnw("too many reports are waiting to be sent to the panel, dropping the oldest", zap.String("endpoint", reports[0].Url))
+		reports = reports[1:]
+	}
+
+	reports = append(reports, q)
+	saveReports()
+
+	if !flushingReports && reportsCtx.Err() == nil {
+		flushingReports = true
+		go flushReports(reportsCtx)
+	}
+}
+
+// Sends a queued report to the Panel, returning false if it could not be reached and the
+// report should be sent again later.
+func sendQueuedReport(q *queuedReport) bool {
+	resp, err := NewRequester().do(q.Method, q.Url, q.Body)
+	if err != nil || resp.StatusCode >= 500 {
+		if resp != nil {
+			resp.Body.Close()
+		}
+
+		return false
+	}
+	defer resp.Body.Close()
+
+	r := &PanelRequest{Response: resp}
+	if r.HasError() {
+		zap.S().Warnw("panel rejected a queued report, it will not be sent again", zap.String("endpoint", q.Url), zap.String("error", r.Error().String()))
+	}
+
+	return true
+}
+
+// Sends the queued reports to the Panel in the order they were queued, waiting until the
+// Panel can be reached whenever it cannot. Reports only record the outcome of something
+// that has already happened, so sending one again after a failed attempt is harmless.
+func flushReports(ctx context.Context) {
+	// Always wait a little between attempts, even if backoff has been disabled, so that
+	// this does not spin while the Panel is down.
+	wait := time.Millisecond * time.Duration(config.Get().PanelClient.BackoffMax)
+	if wait < time.Second {
+		wait = time.Second
+	}
+
+	ticker := time.NewTicker(wait)
+	defer ticker.Stop()
+
+	for {
+		reportsMu.Lock()
+		if len(reports) == 0 || ctx.Err() != nil {
+			flushingReports = false
+			reportsMu.Unlock()
+			return
+		}
+		q := reports[0]
+		reportsMu.Unlock()
+
+		if !sendQueuedReport(q) {
+			select {
+			case <-ctx.Done():
+			case <-ticker.C:
+			}
+			continue
+		}
+
+		reportsMu.Lock()
+		if len(reports) > 0 && reports[0] == q {
+			reports = reports[1:]
+			saveReports()
+		}
+		reportsMu.Unlock()
+	}
+}
+
+// Sends a report to the Panel, such as the result of an installation or a backup. If the
+// Panel cannot be reached the report is queued and sent once it can be, rather than the
+// operation it is reporting on failing. Reports are always sent in the order they are made,
+// so once any are queued every report after them is queued as well.
+func (r *PanelRequest) report(method string, url string, data []byte) (*RequestError, error) {
+	q := &queuedReport{Method: method, Url: url, Body: data}
+	if QueuedReports() > 0 {
+		queueReport(q)
+		return nil, nil
+	}
+
+	resp, err := r.do(method, url, data)
+	if err != nil || resp.StatusCode >= 500 {
+		if resp != nil {
+			resp.Body.Close()
+		}
+
+		zap.S().Warnw("failed to send report to panel, it will be sent once the panel can be reached", zap.String("endpoint", url), zap.Error(err))
+		queueReport(q)
+
+		return nil, nil
+	}
+	defer resp.Body.Close()
+
+	r.Response = resp
+	if r.HasError() {
+		return r.Error(), nil
+	}
+
+	return nil, nil
+}
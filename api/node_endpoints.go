@@ -0,0 +1,45 @@
+package api
+
+import (
+	"encoding/json"
+	"github.com/pkg/errors"
+)
+
+// The information sent to the Panel on every heartbeat, allowing it to determine which
+// nodes are reachable and how heavily they are being used.
+type Heartbeat struct {
+	Version     string `json:"version"`
+	Maintenance bool   `json:"maintenance"`
+
+	Servers struct {
+		Total   int `json:"total"`
+		Running int `json:"running"`
+	} `json:"servers"`
+
+	Utilization struct {
+		MemoryBytes uint64  `json:"memory_bytes"`
+		CpuAbsolute float64 `json:"cpu_absolute"`
+		DiskBytes   int64   `json:"disk_bytes"`
+	} `json:"utilization"`
+}
+
+// Sends a heartbeat for this node to the Panel.
+func (r *PanelRequest) SendHeartbeat(h *Heartbeat) (*RequestError, error) {
+	b, err := json.Marshal(h)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	resp, err := r.Post("/heartbeat", b)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	defer resp.Body.Close()
+
+	r.Response = resp
+	if r.HasError() {
+		return r.Error(), nil
+	}
+
+	return nil, nil
+}
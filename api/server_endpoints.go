@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"github.com/pkg/errors"
 	"github.com/pterodactyl/wings/parser"
+	"net/http"
 )
 
 const (
@@ -136,18 +137,7 @@ func (r *PanelRequest) SendInstallationStatus(uuid string, successful bool) (*Re
 		return nil, errors.WithStack(err)
 	}
 
-	resp, err := r.Post(fmt.Sprintf("/servers/%s/install", uuid), b)
-	if err != nil {
-		return nil, errors.WithStack(err)
-	}
-	defer resp.Body.Close()
-
-	r.Response = resp
-	if r.HasError() {
-		return r.Error(), nil
-	}
-
-	return nil, nil
+	return r.report(http.MethodPost, fmt.Sprintf("/servers/%s/install", uuid), b)
 }
 
 type archiveRequest struct {
@@ -160,54 +150,23 @@ func (r *PanelRequest) SendArchiveStatus(uuid string, successful bool) (*Request
 		return nil, errors.WithStack(err)
 	}
 
-	resp, err := r.Post(fmt.Sprintf("/servers/%s/archive", uuid), b)
-	if err != nil {
-		return nil, errors.WithStack(err)
-	}
-	defer resp.Body.Close()
-
-	r.Response = resp
-	if r.HasError() {
-		return r.Error(), nil
-	}
-
-	return nil, nil
+	return r.report(http.MethodPost, fmt.Sprintf("/servers/%s/archive", uuid), b)
 }
 
 func (r *PanelRequest) SendTransferFailure(uuid string) (*RequestError, error) {
-	resp, err := r.Get(fmt.Sprintf("/servers/%s/transfer/failure", uuid))
-	if err != nil {
-		return nil, errors.WithStack(err)
-	}
-	defer resp.Body.Close()
-
-	r.Response = resp
-	if r.HasError() {
-		return r.Error(), nil
-	}
-
-	return nil, nil
+	return r.report(http.MethodGet, fmt.Sprintf("/servers/%s/transfer/failure", uuid), nil)
 }
 
 func (r *PanelRequest) SendTransferSuccess(uuid string) (*RequestError, error) {
-	resp, err := r.Get(fmt.Sprintf("/servers/%s/transfer/success", uuid))
-	if err != nil {
-		return nil, errors.WithStack(err)
-	}
-	defer resp.Body.Close()
-
-	r.Response = resp
-	if r.HasError() {
-		return r.Error(), nil
-	}
-
-	return nil, nil
+	return r.report(http.MethodGet, fmt.Sprintf("/servers/%s/transfer/success", uuid), nil)
 }
 
 type BackupRequest struct {
 	Successful bool `json:"successful"`
 	Sha256Hash string `json:"sha256_hash"`
 	FileSize int64 `json:"file_size"`
+	// The fingerprint of the key the backup was encrypted with, if it was encrypted.
+	KeyFingerprint string `json:"key_fingerprint,omitempty"`
 }
 
 func (r *PanelRequest) SendBackupStatus(uuid string, backup string, data BackupRequest) (*RequestError, error) {
@@ -216,16 +175,5 @@ func (r *PanelRequest) SendBackupStatus(uuid string, backup string, data BackupR
 		return nil, errors.WithStack(err)
 	}
 
-	resp, err := r.Post(fmt.Sprintf("/servers/%s/backup/%s", uuid, backup), b)
-	if err != nil {
-		return nil, errors.WithStack(err)
-	}
-	defer resp.Body.Close()
-
-	r.Response = resp
-	if r.HasError() {
-		return r.Error(), nil
-	}
-
-	return nil, nil
+	return r.report(http.MethodPost, fmt.Sprintf("/servers/%s/backup/%s", uuid, backup), b)
 }
@@ -0,0 +1,81 @@
+package clamav
+
+import (
+	"bufio"
+	"encoding/binary"
+	"github.com/pkg/errors"
+	"io"
+	"net"
+	"strings"
+	"time"
+)
+
+// The size of each chunk of data streamed to clamd.
+const chunkSize = 64 * 1024
+
+// Streams the contents of the reader to clamd using the INSTREAM command and returns the
+// name of the signature that was matched. An empty signature means the data is clean.
+//
+// The address can either be the path to a unix socket, or a host and port pair for clamd
+// instances listening over TCP.
+//
+// @see https://linux.die.net/man/8/clamd
+func Scan(address string, r io.Reader, timeout time.Duration) (string, error) {
+	network := "tcp"
+	if strings.HasPrefix(address, "/") {
+		network = "unix"
+	}
+
+	conn, err := net.DialTimeout(network, address, timeout)
+	if err != nil {
+		return "", errors.WithStack(err)
+	}
+	defer conn.Close()
+
+	conn.SetDeadline(time.Now().Add(timeout))
+
+	if _, err := conn.Write([]byte("zINSTREAM\x00")); err != nil {
+		return "", errors.WithStack(err)
+	}
+
+	buf := make([]byte, chunkSize+4)
+	for {
+		n, err := r.Read(buf[4:])
+		if n > 0 {
+			binary.BigEndian.PutUint32(buf[0:4], uint32(n))
+			if _, err := conn.Write(buf[:n+4]); err != nil {
+				return "", errors.WithStack(err)
+			}
+		}
+
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return "", errors.WithStack(err)
+		}
+	}
+
+	// A chunk with a length of zero marks the end of the stream.
+	if _, err := conn.Write([]byte{0, 0, 0, 0}); err != nil {
+		return "", errors.WithStack(err)
+	}
+
+	resp, err := bufio.NewReader(conn).ReadString(0)
+	if err != nil && err != io.EOF {
+		return "", errors.WithStack(err)
+	}
+
+	// Responses are in the format of "stream: OK" for clean data, or
+	// "stream: Signature-Name FOUND" when something is detected.
+	resp = strings.TrimSpace(strings.TrimRight(resp, "\x00"))
+	resp = strings.TrimPrefix(resp, "stream: ")
+
+	switch {
+	case resp == "OK":
+		return "", nil
+	case strings.HasSuffix(resp, " FOUND"):
+		return strings.TrimSuffix(resp, " FOUND"), nil
+	default:
+		return "", errors.New("clamav: unexpected response from clamd: " + resp)
+	}
+}
@@ -0,0 +1,101 @@
+package cmd
+
+import (
+	"fmt"
+	"github.com/pterodactyl/wings/config"
+	"github.com/pterodactyl/wings/encryption"
+	"github.com/spf13/cobra"
+	"io"
+	"os"
+	"strings"
+)
+
+var (
+	decryptBackupArgs struct {
+		Key string
+	}
+)
+
+var decryptBackupCmd = &cobra.Command{
+	Use:   "decrypt-backup <file> [output]",
+	Short: "Decrypt an encrypted backup archive",
+	Long: "Decrypts a backup archive that was encrypted by wings. The key configured for the node is used unless " +
+		"a key is provided. If no output file is given the archive is written next to the encrypted file without " +
+		"the .enc extension.",
+	Args: cobra.RangeArgs(1, 2),
+	Run:  decryptBackupCmdRun,
+}
+
+func init() {
+	decryptBackupCmd.Flags().StringVarP(&decryptBackupArgs.Key, "key", "k", "", "The key to decrypt the backup with, encoded as base64 or hex")
+
+	root.AddCommand(decryptBackupCmd)
+}
+
+func decryptBackupCmdRun(_ *cobra.Command, args []string) {
+	key, err := decryptBackupKey()
+	if err != nil {
+		fmt.Println("Failed to load the backup encryption key:", err)
+		os.Exit(1)
+	}
+
+	output := strings.TrimSuffix(args[0], ".enc")
+	if len(args) > 1 {
+		output = args[1]
+	}
+
+	if output == args[0] {
+		fmt.Println("The output file must be different from the encrypted backup.")
+		os.Exit(1)
+	}
+
+	if err := decryptBackup(args[0], output, key); err != nil {
+		fmt.Println("Failed to decrypt the backup:", err)
+		os.Exit(1)
+	}
+
+	fmt.Println("The backup has been decrypted to", output)
+}
+
+func decryptBackupKey() ([]byte, error) {
+	if decryptBackupArgs.Key != "" {
+		return encryption.ParseKey(decryptBackupArgs.Key)
+	}
+
+	c, err := config.ReadConfiguration(configPath)
+	if err != nil {
+		return nil, err
+	}
+
+	return encryption.ReadKeyFile(c.System.Backups.Encryption.KeyFile)
+}
+
+func decryptBackup(input string, output string, key []byte) error {
+	in, err := os.Open(input)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	r, err := encryption.NewReader(in, key)
+	if err != nil {
+		return err
+	}
+
+	out, err := os.OpenFile(output, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+
+	if _, err := io.Copy(out, r); err != nil {
+		// Never leave a partially decrypted archive behind, since the part that was written
+		// has not been verified to be complete.
+		out.Close()
+		os.Remove(output)
+
+		return err
+	}
+
+	return out.Close()
+}
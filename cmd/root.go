@@ -1,22 +1,37 @@
 package cmd
 
 import (
+	"context"
 	"crypto/tls"
+	"crypto/x509"
 	"fmt"
+	"net"
 	"net/http"
 	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
 
 	"github.com/pkg/errors"
 	"github.com/pkg/profile"
+	"github.com/pterodactyl/wings/api"
 	"github.com/pterodactyl/wings/config"
 	"github.com/pterodactyl/wings/environment"
+	"github.com/pterodactyl/wings/ftp"
+	"github.com/pterodactyl/wings/proxyproto"
 	"github.com/pterodactyl/wings/router"
+	"github.com/pterodactyl/wings/rpc"
 	"github.com/pterodactyl/wings/server"
 	"github.com/pterodactyl/wings/sftp"
+	"github.com/pterodactyl/wings/store"
 	"github.com/pterodactyl/wings/system"
+	"github.com/pterodactyl/wings/webdav"
 	"github.com/remeh/sizedwaitgroup"
+	"github.com/soheilhy/cmux"
 	"github.com/spf13/cobra"
 	"go.uber.org/zap"
+	"golang.org/x/net/http2"
 )
 
 var configPath = "config.yml"
@@ -71,6 +86,26 @@ func rootCmdRun(*cobra.Command, []string) {
 	config.Set(c)
 	config.SetDebugViaFlag(debug)
 
+	if err := server.StartLogShipping(); err != nil {
+		zap.S().Errorw("failed to configure log shipping", zap.Error(err))
+	}
+
+	if err := store.Open(c.System.StateDatabase); err != nil {
+		zap.S().Fatalw("failed to open state database", zap.String("path", c.System.StateDatabase), zap.Error(err))
+		return
+	}
+	defer store.Close()
+
+	// Rootless Docker has to be detected before the system user is set up, since files
+	// written by its containers belong to the user running Docker.
+	if c.System.Environment == "" || c.System.Environment == "docker" {
+		if err := environment.DetectRootless(&c.Docker); err != nil {
+			zap.S().Warnw("failed to determine if docker is running rootless", zap.Error(err))
+		} else if c.Docker.Rootless.Active {
+			zap.S().Infow("docker is running rootless, adjusting daemon to match")
+		}
+	}
+
 	zap.S().Infof("checking for pterodactyl system user \"%s\"", c.System.Username)
 	if su, err := c.EnsurePterodactylUser(); err != nil {
 		zap.S().Panicw("failed to create pterodactyl system user", zap.Error(err))
@@ -86,14 +121,26 @@ func rootCmdRun(*cobra.Command, []string) {
 		zap.S().Infow("finished ensuring file permissions")
 	}
 
+	// Plugins need to be registered as environments before any servers are loaded, otherwise
+	// servers configured to use them will fail to find their environment driver.
+	server.RegisterPluginEnvironments(c.System.Plugins)
+
 	if err := server.LoadDirectory(); err != nil {
 		zap.S().Fatalw("failed to load server configurations", zap.Error(errors.WithStack(err)))
 		return
 	}
 
-	if err := environment.ConfigureDocker(&c.Docker); err != nil {
-		zap.S().Fatalw("failed to configure docker environment", zap.Error(errors.WithStack(err)))
-		os.Exit(1)
+	go server.CloseStaleFirewallRules()
+
+	// Only configure the Docker networking stack if we're actually going to be running
+	// servers inside of Docker containers on this node.
+	if c.System.Environment == "" || c.System.Environment == "docker" {
+		if err := environment.ConfigureDocker(&c.Docker); err != nil {
+			zap.S().Fatalw("failed to configure docker environment", zap.Error(errors.WithStack(err)))
+			os.Exit(1)
+		}
+
+		server.CheckRootlessCompatibility()
 	}
 
 	if err := c.WriteToDisk(); err != nil {
@@ -105,10 +152,39 @@ func rootCmdRun(*cobra.Command, []string) {
 		zap.S().Infow("loaded configuration for server", zap.String("server", s.Uuid))
 	}
 
-	// Create a new WaitGroup that limits us to 4 servers being bootstrapped at a time
+	server.StartHeartbeat()
+	server.StartSyncLoop()
+	server.StartEventSink()
+	server.StartStatsHistory()
+
+	// Reports queued for the Panel stay in the state database once the daemon is stopped,
+	// so sending them is stopped before the database is closed.
+	reportsCtx, stopReports := context.WithCancel(context.Background())
+	defer stopReports()
+	api.StartReports(reportsCtx)
+
+	// Let the Panel know about anything that finished while it could not be reached, or
+	// that was interrupted by the daemon being stopped.
+	go func() {
+		server.SyncPendingInstallStates()
+		router.FailInterruptedTransfers()
+	}()
+
+	// Create a new WaitGroup that limits the number of servers being bootstrapped at a time
 	// on Wings. This allows us to ensure the environment exists, write configurations,
 	// and reboot processes without causing a slow-down due to sequential booting.
-	wg := sizedwaitgroup.New(4)
+	concurrency := c.System.Boot.Concurrency
+	if concurrency < 1 {
+		concurrency = 1
+	}
+
+	wg := sizedwaitgroup.New(concurrency)
+
+	// Tracks when the last server process was started so that starts can be spaced out
+	// using the configured delay, rather than having every process start at the same time.
+	var startMu sync.Mutex
+	var lastStart time.Time
+	startDelay := time.Duration(c.System.Boot.StartDelay) * time.Millisecond
 
 	for _, serv := range server.GetServers().All() {
 		wg.Add()
@@ -136,6 +212,18 @@ func rootCmdRun(*cobra.Command, []string) {
 			// is that it was running, but we see that the container process is not currently running.
 			if r || (!r && s.IsRunning()) {
 				zap.S().Infow("detected server is running, re-attaching to process", zap.String("server", s.Uuid))
+
+				// Only space out servers whose process actually needs to be started, re-attaching
+				// to a process that is already running is cheap.
+				if !r {
+					startMu.Lock()
+					if wait := time.Until(lastStart.Add(startDelay)); wait > 0 {
+						time.Sleep(wait)
+					}
+					lastStart = time.Now()
+					startMu.Unlock()
+				}
+
 				if err := s.Environment.Start(); err != nil {
 					zap.S().Warnw(
 						"failed to properly start server detected as already running",
@@ -156,11 +244,27 @@ func rootCmdRun(*cobra.Command, []string) {
 	// Wait until all of the servers are ready to go before we fire up the HTTP server.
 	wg.Wait()
 
+	// Begin running any schedules defined for servers now that they have all been booted.
+	server.StartScheduler()
+
+	// Periodically clear out old items from the trash of every server.
+	if c.System.Trash.Enabled {
+		server.StartTrashJanitor(c.System.Trash.MaxAge)
+	}
+
 	// If the SFTP subsystem should be started, do so now.
 	if c.System.Sftp.UseInternalSystem {
 		sftp.Initialize(c)
 	}
 
+	if c.System.Webdav.Enabled {
+		webdav.Initialize(c)
+	}
+
+	if c.System.Ftp.Enabled {
+		ftp.Initialize(c)
+	}
+
 	// Ensure the archive directory exists.
 	if err := os.MkdirAll(c.System.ArchiveDirectory, 0755); err != nil {
 		zap.S().Errorw("failed to create archive directory", zap.Error(err))
@@ -176,16 +280,135 @@ func rootCmdRun(*cobra.Command, []string) {
 	r := router.Configure()
 	addr := fmt.Sprintf("%s:%d", c.Api.Host, c.Api.Port)
 
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		zap.S().Fatalw("failed to bind webserver to address", zap.String("address", addr), zap.Error(err))
+	}
+
+	// Wrap the listener so that the real client address is used for requests that come in
+	// through a load balancer sending PROXY protocol headers.
+	if c.Api.ProxyProtocol {
+		if len(c.TrustedProxies) == 0 {
+			zap.S().Warnw("proxy protocol is enabled for the webserver but no trusted proxies are configured, headers will be ignored")
+		}
+
+		pl, err := proxyproto.NewListener(l, c.TrustedProxies)
+		if err != nil {
+			zap.S().Fatalw("failed to configure proxy protocol for webserver", zap.Error(err))
+		}
+
+		l = pl
+	}
+
+	t := c.Api.Timeouts
+	s := &http.Server{
+		Handler:           r,
+		TLSConfig:         &tls.Config{},
+		ReadHeaderTimeout: time.Duration(t.ReadHeader) * time.Second,
+		ReadTimeout:       time.Duration(t.Read) * time.Second,
+		WriteTimeout:      time.Duration(t.Write) * time.Second,
+		IdleTimeout:       time.Duration(t.Idle) * time.Second,
+	}
+	s.RegisterOnShutdown(router.Shutdown)
+
+	// Stop accepting new connections when the daemon is asked to stop, and give requests
+	// that are in progress, such as uploads, a chance to finish before exiting.
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+
+		sig := make(chan os.Signal, 1)
+		signal.Notify(sig, os.Interrupt, syscall.SIGTERM)
+		<-sig
+
+		zap.S().Infow("stopping webserver, waiting for requests to finish", zap.Int("timeout", c.Api.ShutdownTimeout))
+
+		ctx, cancel := context.WithTimeout(context.Background(), time.Duration(c.Api.ShutdownTimeout)*time.Second)
+		defer cancel()
+
+		if err := s.Shutdown(ctx); err != nil {
+			zap.S().Warnw("webserver did not stop cleanly, closing remaining connections", zap.Error(err))
+			s.Close()
+		}
+	}()
+
+	// The certificate and key are loaded here, rather than by the server itself, since they
+	// may have been loaded from a secret store instead of being files on the disk.
+	if c.Api.Ssl.Enabled {
+		cert, err := config.ReadPEM(c.Api.Ssl.CertificateFile)
+		if err != nil {
+			zap.S().Fatalw("failed to read HTTPS certificate", zap.Error(err))
+		}
+
+		key, err := config.ReadPEM(c.Api.Ssl.KeyFile)
+		if err != nil {
+			zap.S().Fatalw("failed to read HTTPS certificate key", zap.Error(err))
+		}
+
+		pair, err := tls.X509KeyPair(cert, key)
+		if err != nil {
+			zap.S().Fatalw("failed to load HTTPS certificate", zap.Error(err))
+		}
+
+		s.TLSConfig.Certificates = []tls.Certificate{pair}
+	}
+
+	// Verify client certificates against the configured authorities. Certificates are only
+	// requested here, rather than required, since public routes are accessed directly by
+	// browsers. Authenticated routes enforce that a verified certificate was provided.
+	if c.Api.Ssl.Enabled && c.Api.Ssl.ClientCaFile != "" {
+		b, err := config.ReadPEM(c.Api.Ssl.ClientCaFile)
+		if err != nil {
+			zap.S().Fatalw("failed to read client certificate authorities", zap.Error(err))
+		}
+
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(b) {
+			zap.S().Fatalw("no valid certificates found in client certificate authority bundle")
+		}
+
+		s.TLSConfig.ClientCAs = pool
+		s.TLSConfig.ClientAuth = tls.VerifyClientCertIfGiven
+	}
+
+	// When serving over TLS the webserver negotiates HTTP/2 itself, so gRPC calls are passed
+	// to the gRPC server by the handler. Without TLS the connections are split up by
+	// protocol before they reach the webserver, since gRPC requires HTTP/2.
+	if c.Api.Grpc {
+		g := rpc.NewServer()
+		s.RegisterOnShutdown(g.GracefulStop)
+
+		if c.Api.Ssl.Enabled {
+			s.Handler = rpc.Handler(g, s.Handler)
+		} else {
+			m := cmux.New(l)
+			gl := m.MatchWithWriters(cmux.HTTP2MatchHeaderFieldSendSettings("content-type", "application/grpc"))
+			l = m.Match(cmux.Any())
+
+			go g.Serve(gl)
+			go m.Serve()
+		}
+
+		zap.S().Infow("serving gRPC api alongside webserver")
+	}
+
 	if c.Api.Ssl.Enabled {
-		if err := r.RunTLS(addr, c.Api.Ssl.CertificateFile, c.Api.Ssl.KeyFile); err != nil {
+		if err := configureHttp2(s, c.Api.Http2); err != nil {
+			zap.S().Fatalw("failed to configure HTTP/2 support", zap.Error(err))
+		}
+
+		if err := s.ServeTLS(l, "", ""); err != nil && err != http.ErrServerClosed {
 			zap.S().Fatalw("failed to configure HTTPS server", zap.Error(err))
 		}
 	} else {
-		if err := r.Run(addr); err != nil {
+		if err := s.Serve(l); err != nil && err != http.ErrServerClosed {
 			zap.S().Fatalw("failed to configure HTTP server", zap.Error(err))
 		}
 	}
 
+	<-stopped
+	zap.S().Infow("webserver stopped")
+
 	// r := &Router{
 	// 	token: c.AuthenticationToken,
 	// 	upgrader: websocket.Upgrader{
@@ -198,6 +421,23 @@ func rootCmdRun(*cobra.Command, []string) {
 	// }
 }
 
+// Enables HTTP/2 on the webserver using the configured flow control settings, or disables
+// it entirely. The standard library would otherwise enable it with the default settings.
+func configureHttp2(s *http.Server, c config.Http2Configuration) error {
+	if !c.Enabled {
+		s.TLSNextProto = make(map[string]func(*http.Server, *tls.Conn, http.Handler))
+
+		return nil
+	}
+
+	return http2.ConfigureServer(s, &http2.Server{
+		MaxConcurrentStreams:         c.MaxConcurrentStreams,
+		MaxUploadBufferPerConnection: c.MaxUploadBufferPerConnection,
+		MaxUploadBufferPerStream:     c.MaxUploadBufferPerStream,
+		IdleTimeout:                  s.IdleTimeout,
+	})
+}
+
 // Execute calls cobra to handle cli commands
 func Execute() error {
 	return root.Execute()
@@ -0,0 +1,144 @@
+package cmd
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"github.com/pterodactyl/wings/config"
+	"github.com/spf13/cobra"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"time"
+)
+
+var (
+	rotateTokenArgs struct {
+		Key         string
+		TokenId     string
+		Token       string
+		GracePeriod int
+	}
+)
+
+var rotateTokenCmd = &cobra.Command{
+	Use:   "rotate-token",
+	Short: "Replace the daemon token, or a named API key, with a new token",
+	Long: "Replaces the daemon token, or the token of a named API key, with a new token. The previous token " +
+		"continues to be accepted for the grace period. If wings is running the token is rotated through its " +
+		"API, otherwise the configuration file is updated directly.",
+	Run: rotateTokenCmdRun,
+}
+
+func init() {
+	rotateTokenCmd.Flags().StringVarP(&rotateTokenArgs.Key, "key", "k", "", "The name of the API key to rotate instead of the daemon token")
+	rotateTokenCmd.Flags().StringVar(&rotateTokenArgs.TokenId, "token-id", "", "The new token ID to send to the Panel along with the daemon token")
+	rotateTokenCmd.Flags().StringVarP(&rotateTokenArgs.Token, "token", "t", "", "The new token to use, a random token is generated if not provided")
+	rotateTokenCmd.Flags().IntVarP(&rotateTokenArgs.GracePeriod, "grace-period", "g", -1, "The number of seconds the previous token remains valid for, defaults to the configured value")
+
+	root.AddCommand(rotateTokenCmd)
+}
+
+func rotateTokenCmdRun(*cobra.Command, []string) {
+	c, err := config.ReadConfiguration(configPath)
+	if err != nil {
+		fmt.Println("Failed to read the configuration file:", err)
+		os.Exit(1)
+	}
+
+	if rotateTokenArgs.Token == "" {
+		b := make([]byte, 32)
+		if _, err := rand.Read(b); err != nil {
+			panic(err)
+		}
+
+		rotateTokenArgs.Token = hex.EncodeToString(b)
+	}
+
+	grace := rotateTokenArgs.GracePeriod
+	if grace < 0 {
+		grace = c.Api.TokenGracePeriod
+	}
+
+	err = rotateTokenUsingDaemon(c, grace)
+	if err != nil {
+		// If the daemon is not running the configuration file can be updated safely, otherwise
+		// the running daemon would overwrite the change the next time it saves its configuration.
+		if operr, ok := err.(*net.OpError); !ok || operr.Op != "dial" {
+			fmt.Println("Failed to rotate the token using the running daemon:", err)
+			os.Exit(1)
+		}
+
+		config.Set(c)
+		err = config.RotateToken(rotateTokenArgs.Key, rotateTokenArgs.TokenId, rotateTokenArgs.Token, time.Duration(grace)*time.Second)
+	}
+
+	if err != nil {
+		fmt.Println("Failed to rotate the token:", err)
+		os.Exit(1)
+	}
+
+	fmt.Println("The token has been rotated, the previous token will remain valid for", grace, "seconds.")
+	fmt.Println("New token:", rotateTokenArgs.Token)
+}
+
+// Sends the rotation request to the daemon running on this machine so that it starts using
+// the new token immediately.
+func rotateTokenUsingDaemon(c *config.Configuration, grace int) error {
+	b, err := json.Marshal(map[string]interface{}{
+		"key":          rotateTokenArgs.Key,
+		"token_id":     rotateTokenArgs.TokenId,
+		"token":        rotateTokenArgs.Token,
+		"grace_period": grace,
+	})
+	if err != nil {
+		return err
+	}
+
+	scheme := "http"
+	if c.Api.Ssl.Enabled {
+		scheme = "https"
+	}
+
+	// The daemon is always contacted over the loopback interface, so the certificate will
+	// not be valid for the address being used.
+	client := &http.Client{
+		Timeout: time.Second * 10,
+		Transport: &http.Transport{
+			TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
+		},
+	}
+
+	endpoint := fmt.Sprintf("%s://127.0.0.1:%s/api/token/rotate", scheme, strconv.Itoa(c.Api.Port))
+	req, err := http.NewRequest(http.MethodPost, endpoint, bytes.NewReader(b))
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+c.AuthenticationToken)
+
+	res, err := client.Do(req)
+	if err != nil {
+		if uerr, ok := err.(*url.Error); ok {
+			return uerr.Err
+		}
+
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		body, _ := ioutil.ReadAll(res.Body)
+
+		return fmt.Errorf("received unexpected response code %d: %s", res.StatusCode, string(body))
+	}
+
+	return nil
+}
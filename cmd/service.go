@@ -0,0 +1,269 @@
+package cmd
+
+import (
+	"fmt"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+var (
+	serviceArgs struct {
+		Name            string
+		User            string
+		UnitDirectory   string
+		EnvironmentFile string
+		Start           bool
+	}
+)
+
+var serviceCmd = &cobra.Command{
+	Use:   "service",
+	Short: "Manage the systemd service that runs wings",
+}
+
+var serviceInstallCmd = &cobra.Command{
+	Use:   "install",
+	Short: "Install and enable a systemd service for wings",
+	Long: "Writes a systemd unit that runs this wings binary with the configuration file being used, reloads " +
+		"systemd and enables the service so that it starts on boot. Running this again replaces the unit with " +
+		"one generated from the current options.",
+	Args: cobra.NoArgs,
+	Run:  serviceInstallCmdRun,
+}
+
+var serviceUninstallCmd = &cobra.Command{
+	Use:   "uninstall",
+	Short: "Stop, disable and remove the systemd service for wings",
+	Long: "Stops and disables the service, then removes the unit and reloads systemd. The environment file is " +
+		"left in place since it may contain settings that should be kept.",
+	Args: cobra.NoArgs,
+	Run:  serviceUninstallCmdRun,
+}
+
+func init() {
+	serviceCmd.PersistentFlags().StringVarP(&serviceArgs.Name, "name", "n", "wings", "The name of the systemd service")
+	serviceCmd.PersistentFlags().StringVar(&serviceArgs.UnitDirectory, "unit-directory", "/etc/systemd/system", "The directory the systemd unit is written to")
+
+	serviceInstallCmd.Flags().StringVarP(&serviceArgs.User, "user", "u", "root", "The user the service runs as, which must be able to use Docker")
+	serviceInstallCmd.Flags().StringVarP(&serviceArgs.EnvironmentFile, "environment-file", "e", "/etc/pterodactyl/wings.env", "The file environment variables for the service are loaded from, created if it does not exist")
+	serviceInstallCmd.Flags().BoolVar(&serviceArgs.Start, "now", false, "Start the service, or restart it if it is already running")
+
+	serviceCmd.AddCommand(serviceInstallCmd, serviceUninstallCmd)
+	root.AddCommand(serviceCmd)
+}
+
+func serviceInstallCmdRun(*cobra.Command, []string) {
+	if err := checkServiceSupported(); err != nil {
+		fmt.Println("Cannot manage the wings service:", err)
+		os.Exit(1)
+	}
+
+	binary, err := os.Executable()
+	if err == nil {
+		binary, err = filepath.EvalSymlinks(binary)
+	}
+	if err != nil {
+		fmt.Println("Failed to determine the location of the wings binary:", err)
+		os.Exit(1)
+	}
+
+	cfg, err := filepath.Abs(configPath)
+	if err != nil {
+		fmt.Println("Failed to determine the location of the configuration file:", err)
+		os.Exit(1)
+	}
+
+	if _, err := os.Stat(cfg); err != nil {
+		fmt.Println("The configuration file could not be found, configure wings before installing the service:", err)
+		os.Exit(1)
+	}
+
+	if err := writeEnvironmentFile(serviceArgs.EnvironmentFile); err != nil {
+		fmt.Println("Failed to create the environment file:", err)
+		os.Exit(1)
+	}
+
+	unit := serviceUnitPath()
+	if err := ioutil.WriteFile(unit, []byte(generateServiceUnit(binary, cfg)), 0644); err != nil {
+		fmt.Println("Failed to write the systemd unit:", err)
+		os.Exit(1)
+	}
+
+	fmt.Println("Wrote the systemd unit to", unit)
+
+	if err := systemctl("daemon-reload"); err != nil {
+		fmt.Println("Failed to reload systemd:", err)
+		os.Exit(1)
+	}
+
+	if err := systemctl("enable", serviceArgs.Name); err != nil {
+		fmt.Println("Failed to enable the service:", err)
+		os.Exit(1)
+	}
+
+	if !serviceArgs.Start {
+		fmt.Printf("The service has been enabled, start it with: systemctl start %s\n", serviceArgs.Name)
+		return
+	}
+
+	// Restarting applies the new unit if the service was already running, and starts it
+	// if it was not.
+	if err := systemctl("restart", serviceArgs.Name); err != nil {
+		fmt.Println("Failed to start the service:", err)
+		os.Exit(1)
+	}
+
+	fmt.Println("The service has been enabled and started.")
+}
+
+func serviceUninstallCmdRun(*cobra.Command, []string) {
+	if err := checkServiceSupported(); err != nil {
+		fmt.Println("Cannot manage the wings service:", err)
+		os.Exit(1)
+	}
+
+	unit := serviceUnitPath()
+	if _, err := os.Stat(unit); os.IsNotExist(err) {
+		fmt.Println("The service is not installed, no unit exists at", unit)
+		os.Exit(1)
+	}
+
+	if err := systemctl("disable", "--now", serviceArgs.Name); err != nil {
+		fmt.Println("Failed to stop and disable the service:", err)
+		os.Exit(1)
+	}
+
+	if err := os.Remove(unit); err != nil {
+		fmt.Println("Failed to remove the systemd unit:", err)
+		os.Exit(1)
+	}
+
+	if err := systemctl("daemon-reload"); err != nil {
+		fmt.Println("Failed to reload systemd:", err)
+		os.Exit(1)
+	}
+
+	fmt.Println("The service has been stopped, disabled and removed.")
+}
+
+// Checks that the service can be managed on this machine, which requires systemd and root.
+func checkServiceSupported() error {
+	if runtime.GOOS != "linux" {
+		return errors.New("services are only supported on Linux")
+	}
+
+	if os.Geteuid() != 0 {
+		return errors.New("this command must be run as root")
+	}
+
+	if _, err := exec.LookPath("systemctl"); err != nil {
+		return errors.New("systemctl could not be found, systemd is required")
+	}
+
+	if strings.ContainsAny(serviceArgs.Name, "/ ") || serviceArgs.Name == "" {
+		return errors.New("the service name cannot be empty or contain slashes or spaces")
+	}
+
+	return nil
+}
+
+func serviceUnitPath() string {
+	return filepath.Join(serviceArgs.UnitDirectory, serviceArgs.Name+".service")
+}
+
+// Generates the systemd unit for the service. The daemon writes its configuration file to
+// the directory it is running in, so the unit runs it in the directory of the configuration
+// file. The service is sandboxed where that does not get in the way of the daemon managing
+// Docker containers, server files and the system user.
+func generateServiceUnit(binary string, cfg string) string {
+	lines := []string{
+		"# Generated by \"wings service install\". Changes are overwritten when it is run again,",
+		"# use \"systemctl edit " + serviceArgs.Name + "\" to override settings instead.",
+		"",
+		"[Unit]",
+		"Description=Pterodactyl Wings Daemon",
+		"After=docker.service network-online.target",
+		"Wants=network-online.target",
+		"Requires=docker.service",
+		"PartOf=docker.service",
+		"StartLimitIntervalSec=180",
+		"StartLimitBurst=30",
+		"",
+		"[Service]",
+		"User=" + serviceArgs.User,
+		"WorkingDirectory=" + escapeSpecifiers(filepath.Dir(cfg)),
+		"EnvironmentFile=-" + escapeSpecifiers(serviceArgs.EnvironmentFile),
+		"ExecStart=" + quoteArgument(binary) + " --config " + quoteArgument(cfg),
+		"Restart=on-failure",
+		"RestartSec=5s",
+		"LimitNOFILE=1048576",
+		"LimitNPROC=infinity",
+		"TasksMax=infinity",
+		"NoNewPrivileges=true",
+		"ProtectKernelModules=true",
+		"ProtectKernelTunables=true",
+		"ProtectControlGroups=true",
+		"RestrictSUIDSGID=true",
+		"RestrictRealtime=true",
+		"LockPersonality=true",
+		"",
+		"[Install]",
+		"WantedBy=multi-user.target",
+	}
+
+	return strings.Join(lines, "\n") + "\n"
+}
+
+// Escapes the specifiers systemd expands in the settings of a unit, such as %h.
+func escapeSpecifiers(s string) string {
+	return strings.Replace(s, "%", "%%", -1)
+}
+
+// Escapes an argument for use on the command line of a systemd unit, quoting it if it
+// contains spaces and escaping the characters systemd would otherwise expand.
+func quoteArgument(s string) string {
+	s = strings.Replace(s, "\\", "\\\\", -1)
+	s = escapeSpecifiers(s)
+	s = strings.Replace(s, "$", "$$", -1)
+
+	if strings.ContainsAny(s, " \t\"'") {
+		return "\"" + strings.Replace(s, "\"", "\\\"", -1) + "\""
+	}
+
+	return s
+}
+
+// Runs systemctl, including its output in the error returned if it fails.
+func systemctl(args ...string) error {
+	out, err := exec.Command("systemctl", args...).CombinedOutput()
+	if err != nil {
+		return errors.Errorf("%s: %s", err, strings.TrimSpace(string(out)))
+	}
+
+	return nil
+}
+
+// Creates the environment file for the service if it does not already exist, so that it is
+// obvious where environment variables for the daemon should be set.
+func writeEnvironmentFile(p string) error {
+	if _, err := os.Stat(p); err == nil {
+		return nil
+	} else if !os.IsNotExist(err) {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+		return err
+	}
+
+	b := []byte("# Environment variables for the wings service, one KEY=value per line. This file is\n" +
+		"# only read when the service starts, restart it after making changes.\n")
+
+	return ioutil.WriteFile(p, b, 0600)
+}
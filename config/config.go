@@ -4,17 +4,20 @@ import (
 	"fmt"
 	"github.com/creasty/defaults"
 	"github.com/gbrlsnchs/jwt/v3"
+	"github.com/pkg/errors"
 	"go.uber.org/zap"
 	"gopkg.in/yaml.v2"
 	"io/ioutil"
 	"os"
 	"os/exec"
 	"os/user"
-	"path"
+	"path/filepath"
 	"regexp"
+	"runtime"
 	"strconv"
 	"strings"
 	"sync"
+	"time"
 )
 
 type Configuration struct {
@@ -24,6 +27,10 @@ type Configuration struct {
 	// in areas that might already be locked so we don't want to crash the process.
 	writeLock sync.Mutex
 
+	// The references that secrets in the configuration were loaded from, keyed by the
+	// path to the field they were loaded into.
+	secrets map[string]secretReference
+
 	// Determines if wings should be running in debug mode. This value is ignored
 	// if the debug flag is passed through the command line arguments.
 	Debug bool
@@ -37,12 +44,33 @@ type Configuration struct {
 
 	// The token used when performing operations. Requests to this instance must
 	// validate against it.
-	AuthenticationToken string `json:"token" yaml:"token"`
+	AuthenticationToken string `json:"token" yaml:"token" secret:"true"`
+
+	// The token that was in use before the token above was rotated. It continues to be
+	// accepted until the expiry time so that the Panel can switch to the new token without
+	// any requests failing in the meantime.
+	PreviousAuthenticationToken       string    `json:"-" yaml:"previous_token,omitempty"`
+	PreviousAuthenticationTokenExpiry time.Time `json:"-" yaml:"previous_token_expiry,omitempty"`
+
+	// Additional named keys that can be used to make requests to this instance. Each key
+	// is limited to the scopes assigned to it, allowing tools such as monitoring systems
+	// to access the API without being given the token above.
+	ApiKeys []ApiKey `json:"api_keys" yaml:"api_keys"`
 
 	Api    ApiConfiguration
 	System SystemConfiguration
 	Docker DockerConfiguration
 
+	// Defines where secrets can be loaded from. Any value in this file that is marked as
+	// a secret, such as the token above, can reference a secret stored elsewhere instead
+	// of containing it directly.
+	Secrets SecretsConfiguration `json:"-" yaml:"secrets"`
+
+	// The addresses or CIDR ranges that are allowed to send PROXY protocol headers to the
+	// webserver and SFTP server when support is enabled for them. If empty, headers are
+	// not accepted from any source, since anyone could otherwise spoof their address.
+	TrustedProxies []string `json:"trusted_proxies" yaml:"trusted_proxies"`
+
 	// The amount of time in seconds that should elapse between disk usage checks
 	// run by the daemon. Setting a higher number can result in better IO performance
 	// at an increased risk of a malicious user creating a process that goes over
@@ -73,6 +101,74 @@ type Configuration struct {
 	// The location where the panel is running that this daemon should connect to
 	// to collect data and send events.
 	PanelLocation string `json:"remote" yaml:"remote"`
+
+	// Controls how requests to the Panel are retried when it cannot be reached.
+	PanelClient PanelClientConfiguration `json:"panel_client" yaml:"panel_client"`
+}
+
+// Defines how requests made to the Panel are retried. Requests that fail because the Panel
+// could not be reached, or because it responded with a server error, are retried with an
+// exponential backoff. Once enough requests in a row have failed no more are attempted
+// until the cooldown has passed, and reports sent in the meantime are queued instead.
+type PanelClientConfiguration struct {
+	// The number of seconds a single attempt at a request can take.
+	Timeout int `default:"30" json:"timeout" yaml:"timeout"`
+
+	// The total number of seconds that a request can take across all of its attempts. No
+	// further attempts are made once the next one would start after this has passed.
+	Budget int `default:"60" json:"budget" yaml:"budget"`
+
+	// The number of times a failed request is retried. Requests that change something on
+	// the Panel are only retried when they could not be sent at all, since otherwise the
+	// Panel may have already carried them out.
+	Retries int `default:"3" json:"retries" yaml:"retries"`
+
+	// The delay before the first retry in milliseconds, which doubles with each retry up to
+	// the maximum. A random amount of up to the delay is used so that nodes do not all
+	// retry at the same time.
+	BackoffInitial int `default:"500" json:"backoff_initial" yaml:"backoff_initial"`
+	BackoffMax     int `default:"10000" json:"backoff_max" yaml:"backoff_max"`
+
+	// The number of requests in a row that must fail before requests to the Panel are
+	// stopped, and the number of seconds to wait before trying again.
+	BreakerThreshold int `default:"5" json:"breaker_threshold" yaml:"breaker_threshold"`
+	BreakerCooldown  int `default:"30" json:"breaker_cooldown" yaml:"breaker_cooldown"`
+
+	// The maximum number of reports, such as the result of an installation or backup, that
+	// are kept to be sent once the Panel can be reached again. The oldest reports are
+	// dropped once this is reached. Reports are saved in the state database, so they are
+	// still sent if the daemon is restarted before the Panel can be reached.
+	QueueSize int `default:"100" json:"queue_size" yaml:"queue_size"`
+}
+
+// Defines a named key that can be used to authenticate requests to the API. The scopes
+// determine which routes the key can be used for and can be any of "read", "power",
+// "files", or "admin", which grants access to every route.
+type ApiKey struct {
+	Name   string   `json:"name" yaml:"name"`
+	Token  string   `json:"token" yaml:"token" secret:"true"`
+	Scopes []string `json:"scopes" yaml:"scopes"`
+
+	// The token that was in use before the key was rotated, which is accepted until the
+	// expiry time.
+	PreviousToken       string    `json:"-" yaml:"previous_token,omitempty"`
+	PreviousTokenExpiry time.Time `json:"-" yaml:"previous_token_expiry,omitempty"`
+}
+
+// Determines if the previous token for the key is still within its grace period.
+func (k *ApiKey) PreviousTokenActive() bool {
+	return k.PreviousToken != "" && time.Now().Before(k.PreviousTokenExpiry)
+}
+
+// Determines if the key has been granted the given scope.
+func (k *ApiKey) HasScope(scope string) bool {
+	for _, s := range k.Scopes {
+		if s == scope || s == "admin" {
+			return true
+		}
+	}
+
+	return false
 }
 
 // Defines basic system configuration settings.
@@ -86,6 +182,51 @@ type SystemConfiguration struct {
 	// Directory where local backups will be stored on the machine.
 	BackupDirectory string `default:"/srv/daemon-data/.backups" yaml:"backup_directory"`
 
+	// Controls how backup archives are created.
+	Backups BackupConfiguration `yaml:"backups"`
+
+	// Limits the resources used when creating archives of servers, such as for backups,
+	// downloads, and transfers.
+	Archives ArchiveConfiguration `yaml:"archives"`
+
+	// Controls how servers being transferred to this node are received.
+	Transfers TransferConfiguration `yaml:"transfers"`
+
+	// Guards against more memory and disk space being allocated to servers than the node
+	// has available.
+	Capacity CapacityConfiguration `yaml:"capacity"`
+
+	// Opens the ports assigned to servers in the firewall of the host.
+	Firewall FirewallConfiguration `yaml:"firewall"`
+
+	// The timezone that server processes run in, such as "Europe/London". When this is not
+	// set the timezone of the host is used.
+	Timezone string `json:"timezone" yaml:"timezone"`
+
+	// The locale that server processes run with, such as "en_US.UTF-8", which is set as
+	// the LANG and LC_ALL environment variables. Nothing is set when this is empty, leaving
+	// the default of the image in place.
+	Locale string `json:"locale" yaml:"locale"`
+
+	// Directory where the configuration of each server is persisted, allowing servers to
+	// be loaded when the daemon boots even if the Panel cannot be reached.
+	ServerConfigDirectory string `default:"/etc/pterodactyl/servers" yaml:"server_config_directory"`
+
+	// The database used to store daemon state that needs to survive a restart, such as
+	// one time tokens that have already been used and in-progress server transfers.
+	StateDatabase string `default:"/var/lib/pterodactyl/wings.db" yaml:"state_database"`
+
+	// Directory where files that are being kept during a reinstall are moved to while the
+	// install script runs. This should be on the same filesystem as the server data.
+	ReinstallDirectory string `default:"/srv/daemon-data/.reinstall" yaml:"reinstall_directory"`
+
+	// Directory where previous versions of files edited through the API are stored.
+	VersionDirectory string `default:"/srv/daemon-data/.versions" yaml:"version_directory"`
+
+	// Directory where the output of the last installation process run for each server is
+	// stored, so that it can be read after the installation has completed.
+	InstallLogDirectory string `default:"/var/log/pterodactyl/install" yaml:"install_log_directory"`
+
 	// The user that should own all of the server files, and be used for containers.
 	Username string `default:"pterodactyl" yaml:"username"`
 
@@ -114,7 +255,447 @@ type SystemConfiguration struct {
 	// the user did not press the stop button, but the process stopped cleanly.
 	DetectCleanExitAsCrash bool `default:"true" yaml:"detect_clean_exit_as_crash"`
 
+	// The number of seconds a server can spend starting before it is killed, if it has not
+	// printed its startup marker or passed its healthcheck by then. Servers can set their
+	// own timeout which is used instead of this one. A value of 0 means there is no limit.
+	StartupTimeout int `default:"0" json:"startup_timeout" yaml:"startup_timeout"`
+
+	// Controls how servers are brought back online when the daemon boots.
+	Boot BootConfiguration `yaml:"boot"`
+
+	// Controls the heartbeat that is sent to the Panel so that it can tell when the node
+	// is unreachable.
+	Heartbeat HeartbeatConfiguration `yaml:"heartbeat"`
+
+	// Controls how often server configurations are fetched from the Panel in the
+	// background.
+	Sync SyncConfiguration `yaml:"sync"`
+
+	// Publishes events from the daemon to an external NATS or Redis server.
+	EventSink EventSinkConfiguration `yaml:"event_sink"`
+
+	// Ships server console output and daemon logs to a remote syslog server or Loki.
+	LogShipping LogShippingConfiguration `yaml:"log_shipping"`
+
+	// While the node is in maintenance mode no new servers can be started, installed, or
+	// transferred, but servers that are already running continue to run.
+	Maintenance MaintenanceConfiguration `yaml:"maintenance"`
+
+	// The environment driver that should be used to run server processes on this
+	// node. Docker is available everywhere, other drivers are only registered on the
+	// platforms that support them (e.g. "jail" on FreeBSD).
+	Environment string `default:"docker" yaml:"environment"`
+
+	// Configuration for the FreeBSD jail environment driver. This is ignored unless
+	// the environment is set to "jail".
+	Jail JailConfiguration `yaml:"jail"`
+
+	// Environment drivers that are provided by external plugin binaries. The key is the
+	// name of the driver, which can then be used as the environment value above to run
+	// servers using that plugin.
+	Plugins map[string]PluginConfiguration `yaml:"plugins"`
+
+	// Controls the recycle bin that files deleted through the API can be moved into.
+	Trash TrashConfiguration `yaml:"trash"`
+
+	// Controls how the disk space used by each server is determined.
+	DiskUsage DiskUsageConfiguration `yaml:"disk_usage"`
+
+	// Limits how many power actions requested through the API are processed at once.
+	PowerQueue PowerQueueConfiguration `yaml:"power_queue"`
+
+	// Controls how many previous versions are kept of files edited through the API.
+	FileVersions FileVersionConfiguration `yaml:"file_versions"`
+
+	// Configuration for scanning uploaded and extracted files for malware using ClamAV.
+	ClamAV ClamAVConfiguration `yaml:"clamav"`
+
+	// Limits on files uploaded to servers through the API or SFTP.
+	Uploads UploadConfiguration `yaml:"uploads"`
+
+	// Limits on files and backups downloaded from servers.
+	Downloads DownloadConfiguration `yaml:"downloads"`
+
 	Sftp *SftpConfiguration `yaml:"sftp"`
+
+	// Allows the files of servers to be mounted as a network drive over WebDAV.
+	Webdav WebdavConfiguration `yaml:"webdav"`
+
+	// Allows the files of servers to be accessed using FTP clients.
+	Ftp FtpConfiguration `yaml:"ftp"`
+}
+
+// Defines how servers are booted when the daemon starts. On nodes with many servers
+// starting them all at once can overwhelm the host, so these values allow the boot
+// process to be spread out.
+type BootConfiguration struct {
+	// The maximum number of servers that will be booted at the same time.
+	Concurrency int `default:"4" yaml:"concurrency"`
+
+	// The number of milliseconds to wait between starting each server process. This only
+	// applies to servers that are actually being started, not to servers that are simply
+	// having their environment checked.
+	StartDelay int `default:"0" yaml:"start_delay"`
+}
+
+// Defines how often the daemon sends a heartbeat to the Panel.
+type HeartbeatConfiguration struct {
+	// The number of seconds between each heartbeat. Every heartbeat is sent up to 10%
+	// sooner or later than this so that nodes do not all contact the Panel at the same
+	// time. Setting this to 0 disables the heartbeat.
+	Interval int `default:"60" yaml:"interval"`
+}
+
+// Defines how the configuration of servers is kept in sync with the Panel. Servers are
+// always synced when they are started, this allows changes to be applied while a server
+// is running as well.
+type SyncConfiguration struct {
+	// The number of seconds between fetching the configuration of every server from the
+	// Panel. Setting this to 0 disables the background sync.
+	Interval int `default:"0" yaml:"interval"`
+}
+
+// Defines where events from the daemon are published so that other systems, such as
+// billing or alerting, can react to them.
+type EventSinkConfiguration struct {
+	// The pub/sub server to publish events to, either "nats" or "redis". Leaving this
+	// empty disables publishing events.
+	Driver string `yaml:"driver"`
+
+	// The address of the server, in host:port form.
+	Address string `yaml:"address"`
+
+	Username string `yaml:"username"`
+	Password string `yaml:"password" secret:"true"`
+
+	// The channel, or subject for NATS, that each event is published to. The "{event}"
+	// placeholder is replaced with the name of the event, with spaces replaced by
+	// underscores, and "{server}" is replaced with the UUID of the server.
+	Channel string `default:"wings.{event}" yaml:"channel"`
+
+	// The events that are published. Leaving this empty publishes every event, including
+	// the stats for every running server which are sent every few seconds.
+	Events []string `yaml:"events"`
+}
+
+// Defines where logs are shipped to so that they can be searched in one place across many
+// nodes. Logs are sent in batches and are dropped, rather than slowing down the daemon, if
+// the endpoint cannot keep up.
+type LogShippingConfiguration struct {
+	// Either "syslog" or "loki". Leaving this empty disables log shipping.
+	Driver string `yaml:"driver"`
+
+	// For syslog this is in the form "udp://host:514" or "tcp://host:514", for Loki this
+	// is the base URL of the server, such as "http://loki:3100".
+	Address string `yaml:"address"`
+
+	// Credentials for HTTP basic authentication, only used by Loki.
+	Username string `yaml:"username"`
+	Password string `yaml:"password" secret:"true"`
+
+	// Labels added to every line that is shipped. A "host" label is always included, and
+	// console output also has a "server" label with the UUID of the server.
+	Labels map[string]string `yaml:"labels"`
+
+	// Determines if the console output of every server is shipped.
+	Console bool `default:"true" yaml:"console"`
+
+	// Determines if the logs of the daemon itself are shipped.
+	Daemon bool `default:"true" yaml:"daemon"`
+
+	// The maximum number of lines sent in a single batch.
+	BatchSize int `default:"500" yaml:"batch_size"`
+
+	// The number of seconds lines can wait before being sent when a batch is not full.
+	FlushInterval int `default:"5" yaml:"flush_interval"`
+
+	// The maximum number of lines that can be waiting to be sent before new lines are
+	// dropped.
+	BufferSize int `default:"10000" yaml:"buffer_size"`
+}
+
+// Defines the maintenance mode state for the node. This is normally changed through the
+// API rather than by editing the configuration file directly.
+type MaintenanceConfiguration struct {
+	Enabled bool `default:"false" json:"enabled" yaml:"enabled"`
+
+	// A message explaining why the node is in maintenance mode, which is included in the
+	// error returned for any action that is refused.
+	Message string `json:"message" yaml:"message"`
+}
+
+// Defines the configuration used when running server processes inside of FreeBSD
+// jails rather than Docker containers.
+type JailConfiguration struct {
+	// The directory that contains the root filesystem for each server jail. Every
+	// server gets its own directory within this location, named using the server UUID.
+	Directory string `default:"/usr/local/jails/pterodactyl" yaml:"directory"`
+
+	// A directory containing an extracted FreeBSD base system that is mounted read-only
+	// into every jail as its root filesystem.
+	BaseDirectory string `default:"/usr/local/jails/base" yaml:"base_directory"`
+
+	// The network interface that jail IP addresses should be aliased onto. If left
+	// empty the jails will inherit the networking stack of the host.
+	Interface string `yaml:"interface"`
+}
+
+// Defines how many threads are used to create an archive of a server. Archives of large servers
+// are created much faster using multiple threads, but using every CPU on the node can starve
+// the servers that are running on it.
+type ArchiveConfiguration struct {
+	// The maximum number of threads used to compress a single archive. A value of 0 uses
+	// half of the CPUs on the node.
+	CompressionThreads int `default:"0" yaml:"compression_threads"`
+
+	// The number of files read at the same time while an archive is created, allowing
+	// reading to continue while earlier files are being compressed.
+	ReadThreads int `default:"4" yaml:"read_threads"`
+}
+
+// The ways that a server can be transferred to this node.
+const (
+	// Downloads a single archive of the server from the node it is on.
+	TransferModeArchive = "archive"
+	// Copies the files that changed over a number of passes while the server keeps running,
+	// only stopping it for a short final pass.
+	TransferModeSync = "sync"
+)
+
+type TransferConfiguration struct {
+	// The mode used for transfers that the Panel does not request a mode for, either
+	// "archive" or "sync". Syncing greatly reduces the time a large server is offline for,
+	// but requires the node the server is on to support it.
+	Mode string `default:"archive" yaml:"mode"`
+
+	// The maximum number of passes made while the server is still running before it is
+	// stopped for the final pass.
+	SyncPasses int `default:"5" yaml:"sync_passes"`
+
+	// Once a pass copies less than this many megabytes, the server is stopped for the final
+	// pass without making any more passes.
+	SyncThreshold int64 `default:"256" yaml:"sync_threshold"`
+}
+
+// What happens when a server is created or has its limits raised beyond the capacity of
+// the node.
+const (
+	// The capacity of the node is not checked.
+	CapacityModeOff = "off"
+	// A warning is logged, but the request is still carried out.
+	CapacityModeWarn = "warn"
+	// The request is refused.
+	CapacityModeRefuse = "refuse"
+)
+
+type CapacityConfiguration struct {
+	// Either "off", "warn" or "refuse".
+	Mode string `default:"warn" yaml:"mode"`
+
+	// The amount of memory and disk space that can be allocated to servers, as a ratio of
+	// the physical capacity of the node. A ratio of 1.5 allows servers to be given half as
+	// much again as the node actually has. Servers without a limit can use everything the
+	// node has, so they are counted as being allocated its entire physical capacity.
+	MemoryOvercommit float64 `default:"1.0" yaml:"memory_overcommit"`
+	DiskOvercommit   float64 `default:"1.0" yaml:"disk_overcommit"`
+}
+
+// The firewalls that the ports assigned to servers can be opened in.
+const (
+	FirewallFirewalld = "firewalld"
+	FirewallNftables  = "nftables"
+)
+
+type FirewallConfiguration struct {
+	// If true, the ports assigned to a server are opened in the firewall of the host when
+	// the server is created or its allocations change, and closed once it is removed.
+	Enabled bool `default:"false" yaml:"enabled"`
+
+	// Either "firewalld" or "nftables". Changes to firewalld are made using firewall-cmd
+	// and are made permanent, while rules added using nft only last until the ruleset is
+	// next reloaded, and are added back when the daemon boots.
+	Backend string `default:"firewalld" yaml:"backend"`
+
+	// The firewalld zone that ports are opened in.
+	Zone string `default:"public" yaml:"zone"`
+
+	// The nftables table, given as the family followed by the name, and the chain within
+	// it that rules accepting traffic for the ports are added to.
+	Table string `default:"inet filter" yaml:"table"`
+	Chain string `default:"input" yaml:"chain"`
+}
+
+// Returns the number of threads that should be used to compress a single archive.
+func (c ArchiveConfiguration) CompressionThreadLimit() int {
+	if c.CompressionThreads > 0 {
+		return c.CompressionThreads
+	}
+
+	if n := runtime.NumCPU() / 2; n > 1 {
+		return n
+	}
+
+	return 1
+}
+
+// Defines how backup archives are compressed. Compressing with zstd is much faster than
+// gzip for large servers, and compression can be disabled entirely for servers whose files
+// are already compressed, such as most game worlds.
+type BackupConfiguration struct {
+	// The compression used for backup archives, one of "gzip", "zstd", or "none".
+	Compression string `default:"gzip" yaml:"compression"`
+
+	// The compression level to use, from 1 to 9 for gzip and 1 to 22 for zstd. A value of
+	// 0 uses the default level for the format.
+	Level int `default:"0" yaml:"level"`
+
+	// Controls encrypting backup archives before they are written to the disk.
+	Encryption BackupEncryptionConfiguration `yaml:"encryption"`
+}
+
+// Defines the key used to encrypt backups created on the node. Servers that have their own
+// backup encryption key always have their backups encrypted using that key instead, even if
+// encryption is not enabled for the node.
+type BackupEncryptionConfiguration struct {
+	// If set to true, backups are encrypted using AES-256-GCM with the key from the key file.
+	Enabled bool `default:"false" yaml:"enabled"`
+
+	// The file containing the 32 byte key used to encrypt backups, encoded as base64 or hex.
+	// The fingerprint of the key is recorded with every backup encrypted using it, so keys
+	// that are rotated should be kept until the backups using them have been removed.
+	KeyFile string `default:"/etc/pterodactyl/backup.key" yaml:"key_file"`
+}
+
+// Defines how files deleted through the API are handled. When enabled, deleted files are
+// moved into a hidden directory within the server rather than being removed right away,
+// allowing them to be restored if they were deleted by mistake.
+type TrashConfiguration struct {
+	// If set to true, deleted files and folders are moved into the ".trash" directory
+	// in the root of the server instead of being permanently removed.
+	Enabled bool `default:"false" yaml:"enabled"`
+
+	// The number of hours an item is kept in the trash before it is permanently removed.
+	// Items may be removed sooner than this if the server runs out of disk space.
+	MaxAge int `default:"168" yaml:"max_age"`
+}
+
+// Defines how the disk space used by servers is tracked. Walking the entire directory of a
+// server with millions of files is very expensive, so by default the usage is kept up to date
+// using filesystem notifications, and only the directories that change are read again.
+type DiskUsageConfiguration struct {
+	// If set to false the disk usage of a server is determined by walking its entire
+	// directory whenever the cached value has expired.
+	Incremental bool `default:"true" yaml:"incremental"`
+
+	// The number of minutes between full walks of a server directory that correct any
+	// drift in the tracked usage, such as from notifications that were dropped.
+	ReconcileInterval int `default:"60" yaml:"reconcile_interval"`
+}
+
+// Defines the pool of workers that processes power actions requested through the API. Actions
+// are queued and processed by a fixed number of workers, so that restarting every server on
+// the node at once does not start hundreds of Docker operations at the same time.
+type PowerQueueConfiguration struct {
+	// The number of power actions that are processed at once.
+	Workers int `default:"8" yaml:"workers"`
+
+	// The number of power actions that can be waiting for a worker. Once the queue is full,
+	// actions wait in the queue of operations for their server until there is room.
+	Size int `default:"1000" yaml:"size"`
+
+	// The number of seconds each type of power action is allowed to run for before it is
+	// cancelled by killing the server process. A value of 0 means no limit.
+	Timeouts PowerActionTimeouts `yaml:"timeouts"`
+}
+
+// The number of seconds each type of power action is allowed to run for. The worker waits
+// for a cancelled action to return before moving on, so that the actions for a server are
+// always run one at a time and in order.
+type PowerActionTimeouts struct {
+	Start   int `default:"300" yaml:"start"`
+	Stop    int `default:"600" yaml:"stop"`
+	Restart int `default:"900" yaml:"restart"`
+	Kill    int `default:"60" yaml:"kill"`
+}
+
+// Defines how previous versions of files are kept when they are edited through the API,
+// allowing a bad change to a configuration file to be rolled back.
+type FileVersionConfiguration struct {
+	// The number of previous versions to keep for each file. Setting this to 0 disables
+	// file versioning entirely.
+	Limit int `default:"5" yaml:"limit"`
+
+	// The maximum size of a file, in kilobytes, that versions will be kept for. Files
+	// larger than this are overwritten without a copy being made.
+	MaxFileSize int64 `default:"1024" yaml:"max_file_size"`
+}
+
+// Defines how files written to servers are scanned using a clamd daemon. Files written
+// through the API or SFTP, and files extracted from archives, are scanned when enabled.
+type ClamAVConfiguration struct {
+	Enabled bool `default:"false" yaml:"enabled"`
+
+	// The address of the clamd daemon. This is either the path to a unix socket, or a
+	// host and port pair if clamd is listening over TCP.
+	Address string `default:"/var/run/clamav/clamd.ctl" yaml:"address"`
+
+	// The action to take when an infected file is found. Setting this to "quarantine"
+	// moves the file into the quarantine directory, while "delete" removes it entirely.
+	Action string `default:"quarantine" yaml:"action"`
+
+	// The directory that quarantined files are moved into.
+	QuarantineDirectory string `default:"/srv/daemon-data/.quarantine" yaml:"quarantine_directory"`
+
+	// The number of seconds to wait for clamd to finish scanning a single file.
+	Timeout int `default:"30" yaml:"timeout"`
+}
+
+// Defines limits on the number of concurrent uploads and the rate at which uploaded data
+// is accepted, both for each server and for the node as a whole. This prevents a single
+// large upload from saturating the disk and network of the node. A value of 0 for any of
+// these removes that limit.
+type UploadConfiguration struct {
+	// The maximum number of uploads that can be in progress for a single server.
+	ServerConcurrency int `default:"0" yaml:"server_concurrency"`
+
+	// The maximum number of uploads that can be in progress across all servers.
+	NodeConcurrency int `default:"0" yaml:"node_concurrency"`
+
+	// The maximum rate, in kilobytes per second, that data is accepted for all of the
+	// uploads to a single server combined.
+	ServerBandwidth int64 `default:"0" yaml:"server_bandwidth"`
+
+	// The maximum rate, in kilobytes per second, that data is accepted for all of the
+	// uploads across the node combined.
+	NodeBandwidth int64 `default:"0" yaml:"node_bandwidth"`
+}
+
+// Defines limits on downloads of server files, archives, and backups. A value of 0 for any
+// of these removes that limit.
+type DownloadConfiguration struct {
+	// The maximum number of downloads that can be in progress for a single server.
+	ServerConcurrency int `default:"0" yaml:"server_concurrency"`
+
+	// The maximum number of downloads that can be in progress across all servers.
+	NodeConcurrency int `default:"0" yaml:"node_concurrency"`
+
+	// The maximum rate, in kilobytes per second, that data is sent for all of the
+	// downloads started by a single user combined. Downloads from tokens that do not
+	// identify a user are grouped by the address they were requested from instead.
+	UserBandwidth int64 `default:"0" yaml:"user_bandwidth"`
+
+	// The maximum rate, in kilobytes per second, that data is sent for all of the
+	// downloads from a single server combined.
+	ServerBandwidth int64 `default:"0" yaml:"server_bandwidth"`
+}
+
+// Defines an external plugin binary that provides an environment driver.
+type PluginConfiguration struct {
+	// The path to the plugin executable on the host system.
+	Path string `yaml:"path"`
+
+	// Any additional arguments to pass to the plugin when it is launched.
+	Args []string `yaml:"args"`
 }
 
 // Defines the configuration of the internal SFTP server.
@@ -131,6 +712,58 @@ type SftpConfiguration struct {
 	Port int `default:"2022" json:"bind_port" yaml:"bind_port"`
 	// If set to true, no write actions will be allowed on the SFTP server.
 	ReadOnly bool `default:"false" yaml:"read_only"`
+	// If set to true, connections to the SFTP server may begin with a PROXY protocol
+	// header which will be used to determine the real address of the client.
+	ProxyProtocol bool `default:"false" yaml:"proxy_protocol"`
+	// If set to true, users with the open-shell permission can open a shell inside of the
+	// server container over SSH, or use ssh to run commands in it. Processes are started
+	// as the same user as the server process, and only while the server is running.
+	AllowShell bool `default:"false" json:"allow_shell" yaml:"allow_shell"`
+	// The shell started for users, which must exist in the images used by servers.
+	Shell string `default:"/bin/sh" json:"shell" yaml:"shell"`
+}
+
+// Defines the configuration of the WebDAV server. Users log in with the same credentials
+// they use for SFTP, and are given access to the files of the server those credentials are
+// for. The certificate configured for the API is used when SSL is enabled for it.
+type WebdavConfiguration struct {
+	// If set to true the WebDAV server is started along with the daemon.
+	Enabled bool `default:"false" json:"enabled" yaml:"enabled"`
+	// The bind address of the WebDAV server.
+	Address string `default:"0.0.0.0" json:"bind_address" yaml:"bind_address"`
+	// The bind port of the WebDAV server.
+	Port int `default:"2023" json:"bind_port" yaml:"bind_port"`
+	// If set to true, no write actions will be allowed on the WebDAV server.
+	ReadOnly bool `default:"false" yaml:"read_only"`
+	// The number of seconds that credentials validated by the Panel are remembered for.
+	// Clients send the credentials with every request, so without this the Panel would be
+	// asked to validate them many times a second while a drive is being browsed.
+	CredentialCache int `default:"60" json:"credential_cache" yaml:"credential_cache"`
+}
+
+// Defines the configuration of the FTP server. Users log in with the same credentials they
+// use for SFTP. Connections are secured using explicit TLS with the certificate configured
+// for the API, and only passive mode is supported.
+type FtpConfiguration struct {
+	// If set to true the FTP server is started along with the daemon.
+	Enabled bool `default:"false" json:"enabled" yaml:"enabled"`
+	// The bind address of the FTP server.
+	Address string `default:"0.0.0.0" json:"bind_address" yaml:"bind_address"`
+	// The bind port of the FTP server.
+	Port int `default:"2121" json:"bind_port" yaml:"bind_port"`
+	// The range of ports used for passive data connections, which must be reachable by
+	// clients as well.
+	PassivePortMin int `default:"50000" json:"passive_port_min" yaml:"passive_port_min"`
+	PassivePortMax int `default:"50100" json:"passive_port_max" yaml:"passive_port_max"`
+	// The IPv4 address that clients are told to connect to for passive data connections.
+	// When empty, the address the client connected to is used, which is not reachable if
+	// the node is behind NAT.
+	PublicIp string `json:"public_ip" yaml:"public_ip"`
+	// If set to true, clients must secure both the control and data connections using TLS
+	// before they can log in or transfer files. This requires SSL to be enabled for the API.
+	RequireTls bool `default:"true" json:"require_tls" yaml:"require_tls"`
+	// If set to true, no write actions will be allowed on the FTP server.
+	ReadOnly bool `default:"false" yaml:"read_only"`
 }
 
 type dockerNetworkInterfaces struct {
@@ -176,9 +809,79 @@ type DockerConfiguration struct {
 	// The location of the Docker socket.
 	Socket string `default:"/var/run/docker.sock"`
 
-	// Defines the location of the timezone file on the host system that should
-	// be mounted into the created containers so that they all use the same time.
+	// The platform that images are pulled for, such as "linux/amd64". When this is not set
+	// the platform is detected from the Docker daemon. Servers can set their own platform
+	// to run images built for another architecture under emulation.
+	Platform string `json:"platform" yaml:"platform"`
+
+	// Defines the location of the file on the host system naming its timezone, which is
+	// used to determine the timezone of the host when one is not configured.
 	TimezonePath string `default:"/etc/timezone" json:"timezone_path" yaml:"timezone_path"`
+
+	// If set to true the timezone data for the timezone servers run in is mounted from the
+	// host into containers at /etc/localtime, for images that do not read the TZ variable
+	// or do not include timezone data of their own.
+	MountTimezone bool `default:"true" json:"mount_timezone" yaml:"mount_timezone"`
+
+	// Additional labels applied to every container created by the daemon. These cannot
+	// replace the labels the daemon applies itself, which describe the server the container
+	// is for.
+	Labels map[string]string `json:"labels" yaml:"labels"`
+
+	// Adjusts how the daemon behaves when Docker is running rootless.
+	Rootless DockerRootlessConfiguration `json:"rootless" yaml:"rootless"`
+
+	// The options that servers are allowed to add to their containers using their Docker
+	// overrides. Nothing is allowed by default.
+	Overrides DockerOverridesConfiguration `json:"overrides" yaml:"overrides"`
+}
+
+// Defines which of the Docker overrides set for a server are applied to its container. Any
+// override that is not allowed here is ignored, so that the Panel cannot give a server more
+// access to the host than the administrator of the node intended.
+type DockerOverridesConfiguration struct {
+	// The Linux capabilities that can be added to containers, such as "net_admin".
+	Capabilities []string `json:"capabilities" yaml:"capabilities"`
+
+	// The devices on the host that can be passed through to containers, such as
+	// "/dev/net/tun".
+	Devices []string `json:"devices" yaml:"devices"`
+
+	// The resource limits that can be changed for containers, such as "nofile".
+	Ulimits []string `json:"ulimits" yaml:"ulimits"`
+
+	// The security options that can be set on containers, such as "apparmor=unconfined".
+	SecurityOpts []string `json:"security_opts" yaml:"security_opts"`
+
+	// The largest size of /dev/shm, in megabytes, that containers can be given. When this
+	// is 0 the size cannot be changed from the default used by Docker.
+	MaxShmSize int64 `default:"0" json:"max_shm_size" yaml:"max_shm_size"`
+}
+
+// Defines how the daemon adjusts itself when Docker is running rootless, where the Docker
+// daemon and every container it runs belong to an unprivileged user on the host.
+type DockerRootlessConfiguration struct {
+	// Always run in rootless mode, even if Docker does not report that it is rootless.
+	// Versions of Docker older than 20.10 do not report this.
+	Enabled bool `default:"false" json:"enabled" yaml:"enabled"`
+
+	// Determines if Docker is asked whether it is running rootless when the daemon boots.
+	Detect bool `default:"true" json:"detect" yaml:"detect"`
+
+	// The user that server processes run as inside of their containers. The root user of
+	// a container is mapped to the user running Docker, so files written by a process
+	// running as root are owned by that user on the host. Any other user is mapped to a
+	// subordinate ID, and the daemon cannot manage the files it writes.
+	ContainerUid int `default:"0" json:"container_uid" yaml:"container_uid"`
+
+	// If true, allocations using a port that unprivileged users cannot bind to are left
+	// out of the container rather than causing the server to fail to start. The lowest
+	// port that can be bound is set by the net.ipv4.ip_unprivileged_port_start sysctl.
+	SkipPrivilegedPorts bool `default:"false" json:"skip_privileged_ports" yaml:"skip_privileged_ports"`
+
+	// Set when the daemon boots if it is running in rootless mode, either because it was
+	// enabled or because Docker reported that it is rootless.
+	Active bool `json:"-" yaml:"-"`
 }
 
 // Defines the configuration for the internal API that is exposed by the
@@ -193,12 +896,182 @@ type ApiConfiguration struct {
 	// SSL configuration for the daemon.
 	Ssl struct {
 		Enabled         bool   `default:"false"`
-		CertificateFile string `json:"cert" yaml:"cert"`
-		KeyFile         string `json:"key" yaml:"key"`
+		CertificateFile string `json:"cert" yaml:"cert" secret:"true"`
+		KeyFile         string `json:"key" yaml:"key" secret:"true"`
+
+		// The path to a bundle of CA certificates used to verify client certificates. When
+		// set, every authenticated API request must present a certificate signed by one of
+		// these authorities. Public routes that are authorized using signed tokens, such as
+		// downloads and the websocket, do not require a client certificate.
+		ClientCaFile string `json:"client_ca" yaml:"client_ca" secret:"true"`
 	}
 
 	// The maximum size for files uploaded through the Panel in bytes.
 	UploadLimit int `default:"100" json:"upload_limit" yaml:"upload_limit"`
+
+	// The maximum size, in megabytes, of a file that can be opened or saved through the
+	// file editor. Larger files can still be downloaded. Setting this to 0 removes the limit.
+	MaxEditableSize int64 `default:"4" json:"max_editable_size" yaml:"max_editable_size"`
+
+	// Configuration for requiring requests to the API to be signed.
+	RequestSigning RequestSigningConfiguration `json:"request_signing" yaml:"request_signing"`
+
+	// The number of seconds that a token continues to be accepted for after it has been
+	// rotated.
+	TokenGracePeriod int `default:"300" json:"token_grace_period" yaml:"token_grace_period"`
+
+	// If set to true, connections to the webserver may begin with a PROXY protocol header
+	// which will be used to determine the real address of the client. This should only be
+	// enabled when the daemon is behind a load balancer that sends the header.
+	ProxyProtocol bool `default:"false" json:"proxy_protocol" yaml:"proxy_protocol"`
+
+	// Controls the temporary banning of addresses that repeatedly fail to authenticate.
+	AuthBans AuthBanConfiguration `json:"auth_bans" yaml:"auth_bans"`
+
+	// The number of seconds to wait for requests to finish when the daemon is stopped before
+	// the remaining connections are closed.
+	ShutdownTimeout int `default:"30" json:"shutdown_timeout" yaml:"shutdown_timeout"`
+
+	// Timeouts for connections to the webserver, in seconds.
+	Timeouts ApiTimeoutConfiguration `json:"timeouts" yaml:"timeouts"`
+
+	// Controls HTTP/2 support, which is only available when SSL is enabled.
+	Http2 Http2Configuration `json:"http2" yaml:"http2"`
+
+	// If set to true a gRPC API is served on the same port as the REST API. The service is
+	// defined in rpc/wings.proto and uses the same tokens and API keys for authentication.
+	Grpc bool `default:"false" json:"grpc" yaml:"grpc"`
+
+	// If set to true a read-only GraphQL endpoint is served at /api/graphql, allowing the
+	// servers on the node and their stats, backups and allocations to be queried at once.
+	Graphql bool `default:"false" json:"graphql" yaml:"graphql"`
+
+	// Controls the compression of responses sent by the API.
+	Compression CompressionConfiguration `json:"compression" yaml:"compression"`
+
+	// Limits how quickly commands can be sent to a server over the websocket.
+	ConsoleRateLimit ConsoleRateLimitConfiguration `json:"console_rate_limit" yaml:"console_rate_limit"`
+
+	// If set to true the routes of the legacy Node.js daemon are served alongside the
+	// current API, so that older Panel versions and tools written against the old daemon
+	// keep working while they are migrated. This should be disabled once nothing uses them.
+	LegacyRoutes bool `default:"false" json:"legacy_routes" yaml:"legacy_routes"`
+}
+
+// Defines the timeouts for connections to the webserver. The read and write timeouts cover
+// an entire request or response, including large uploads and downloads, so they are
+// disabled by default. A value of 0 disables a timeout.
+type ApiTimeoutConfiguration struct {
+	// The time allowed to read the headers of a request.
+	ReadHeader int `default:"10" json:"read_header" yaml:"read_header"`
+
+	// The time allowed to read an entire request, including the body.
+	Read int `default:"0" json:"read" yaml:"read"`
+
+	// The time allowed to write an entire response.
+	Write int `default:"0" json:"write" yaml:"write"`
+
+	// How long a keep-alive connection can be idle before it is closed.
+	Idle int `default:"120" json:"idle" yaml:"idle"`
+
+	// The time allowed for a long-running operation started by a request, such as copying
+	// a file, pulling an image or cloning a repository, before it is cancelled. Operations
+	// are always cancelled when the client disconnects. Downloads are not limited by this.
+	Operation int `default:"600" json:"operation" yaml:"operation"`
+}
+
+// Defines the HTTP/2 settings for the webserver. HTTP/2 allows many requests to share one
+// connection, which helps on connections with high latency. Websockets always use HTTP/1.1.
+type Http2Configuration struct {
+	Enabled bool `default:"true" json:"enabled" yaml:"enabled"`
+
+	// The number of requests that a client can have in progress at once on a connection.
+	MaxConcurrentStreams uint32 `default:"250" json:"max_concurrent_streams" yaml:"max_concurrent_streams"`
+
+	// The flow control windows, in bytes, for data received across a whole connection and
+	// for a single request. Larger windows allow uploads to use more of the available
+	// bandwidth on high latency links, at the cost of more memory for each connection.
+	MaxUploadBufferPerConnection int32 `default:"16777216" json:"max_upload_buffer_per_connection" yaml:"max_upload_buffer_per_connection"`
+	MaxUploadBufferPerStream     int32 `default:"4194304" json:"max_upload_buffer_per_stream" yaml:"max_upload_buffer_per_stream"`
+}
+
+// Defines how responses from the API are compressed. Responses are only compressed when
+// the client sends an Accept-Encoding header that allows it.
+type CompressionConfiguration struct {
+	Enabled bool `default:"true" json:"enabled" yaml:"enabled"`
+
+	// Responses smaller than this number of bytes are not compressed, since the saving
+	// is not worth the extra work.
+	MinSize int `default:"1024" json:"min_size" yaml:"min_size"`
+
+	// The gzip compression level, from 1 for the fastest compression to 9 for the
+	// smallest responses.
+	Level int `default:"5" json:"level" yaml:"level"`
+
+	// Allows responses to be compressed using zstd, which is preferred over gzip for
+	// clients that support both.
+	Zstd bool `default:"true" json:"zstd" yaml:"zstd"`
+}
+
+// Defines how many commands can be sent to servers over the websocket. Each connection and
+// each user has a bucket that holds up to the burst number of commands and is refilled at
+// the rate given, so a user cannot get around the limit by opening more connections.
+type ConsoleRateLimitConfiguration struct {
+	Enabled bool `default:"true" json:"enabled" yaml:"enabled"`
+
+	// The number of commands that can be sent at once on a single connection, and the number
+	// of commands per second that the connection is allowed once that has been used.
+	Burst int     `default:"10" json:"burst" yaml:"burst"`
+	Rate  float64 `default:"2" json:"rate" yaml:"rate"`
+
+	// The same limits applied across every connection opened by a user.
+	UserBurst int     `default:"20" json:"user_burst" yaml:"user_burst"`
+	UserRate  float64 `default:"4" json:"user_rate" yaml:"user_rate"`
+
+	// If set to true, commands over the limit are held until they are allowed rather than
+	// being dropped. Commands that would be held for more than 5 seconds are still dropped.
+	Delay bool `default:"false" json:"delay" yaml:"delay"`
+}
+
+// Defines when an address is banned from the API or the SFTP server for failing to
+// authenticate. Failures are counted for invalid bearer tokens and invalid signed URLs on
+// the API, and for invalid credentials on the SFTP server, with each of them banning
+// addresses separately. Each time an address is banned again the length of the ban is
+// doubled, up to the maximum duration.
+type AuthBanConfiguration struct {
+	Enabled bool `default:"true" json:"enabled" yaml:"enabled"`
+
+	// The number of failures within the window that result in the address being banned.
+	MaxFailures int `default:"10" json:"max_failures" yaml:"max_failures"`
+
+	// The number of seconds that failures are counted over.
+	Window int `default:"300" json:"window" yaml:"window"`
+
+	// The number of seconds that an address is banned for the first time it is banned.
+	Duration int `default:"300" json:"duration" yaml:"duration"`
+
+	// The longest that an address can be banned for, in seconds.
+	MaxDuration int `default:"86400" json:"max_duration" yaml:"max_duration"`
+
+	// Addresses or CIDR ranges that are never banned, such as the address of the Panel or
+	// of a proxy in front of the daemon.
+	Exempt []string `json:"exempt" yaml:"exempt"`
+}
+
+// Defines how requests to the API are signed when signing is required. Signed requests
+// include a timestamp and an HMAC-SHA256 signature of the request method, path, body, and
+// timestamp, which protects requests from being modified or replayed even if TLS is being
+// terminated before the request reaches the daemon.
+type RequestSigningConfiguration struct {
+	// If set to true, every authenticated request to the API must be signed.
+	Enabled bool `default:"false" json:"enabled" yaml:"enabled"`
+
+	// The secret shared with the Panel that requests are signed with.
+	Secret string `json:"-" yaml:"secret" secret:"true"`
+
+	// The number of seconds that the timestamp of a request is allowed to differ from the
+	// time on this system. Requests outside of this window are rejected.
+	MaxSkew int `default:"300" json:"max_skew" yaml:"max_skew"`
 }
 
 // Reads the configuration from the provided file and returns the configuration
@@ -225,6 +1098,10 @@ func ReadConfiguration(path string) (*Configuration, error) {
 		return nil, err
 	}
 
+	if err := c.resolveSecrets(); err != nil {
+		return nil, err
+	}
+
 	return c, nil
 }
 
@@ -232,6 +1109,7 @@ var Mutex sync.RWMutex
 
 var _config *Configuration
 var _jwtAlgo *jwt.HMACSHA
+var _previousJwtAlgo *jwt.HMACSHA
 var _debugViaFlag bool
 
 // Set the global configuration instance. This is a blocking operation such that
@@ -244,6 +1122,11 @@ func Set(c *Configuration) {
 		_jwtAlgo = jwt.NewHS256([]byte(c.AuthenticationToken))
 	}
 
+	_previousJwtAlgo = nil
+	if c.PreviousAuthenticationToken != "" {
+		_previousJwtAlgo = jwt.NewHS256([]byte(c.PreviousAuthenticationToken))
+	}
+
 	_config = c
 	Mutex.Unlock()
 }
@@ -269,12 +1152,93 @@ func GetJwtAlgorithm() *jwt.HMACSHA {
 	return _jwtAlgo
 }
 
+// Returns the JWT algorithm for the previous daemon token if it is still within its grace
+// period after being rotated, otherwise nil is returned.
+func GetPreviousJwtAlgorithm() *jwt.HMACSHA {
+	Mutex.RLock()
+	defer Mutex.RUnlock()
+
+	if _config == nil || !_config.PreviousTokenActive() {
+		return nil
+	}
+
+	return _previousJwtAlgo
+}
+
+// Determines if the previous daemon token is still within its grace period.
+func (c *Configuration) PreviousTokenActive() bool {
+	return c.PreviousAuthenticationToken != "" && time.Now().Before(c.PreviousAuthenticationTokenExpiry)
+}
+
+// Replaces the daemon token, or the token for the named API key if a name is provided, and
+// writes the updated configuration to the disk. The token being replaced continues to be
+// accepted for the grace period so that anything using it has time to switch over. If a
+// token ID is provided it replaces the ID sent to the Panel along with the daemon token.
+func RotateToken(key string, tokenId string, token string, grace time.Duration) error {
+	Mutex.Lock()
+	c := _config
+
+	if key == "" {
+		c.PreviousAuthenticationToken = c.AuthenticationToken
+		c.PreviousAuthenticationTokenExpiry = time.Now().Add(grace)
+		c.AuthenticationToken = token
+		if tokenId != "" {
+			c.AuthenticationTokenId = tokenId
+		}
+
+		_previousJwtAlgo = _jwtAlgo
+		_jwtAlgo = jwt.NewHS256([]byte(token))
+	} else {
+		var found bool
+		for i := range c.ApiKeys {
+			if c.ApiKeys[i].Name == key {
+				c.ApiKeys[i].PreviousToken = c.ApiKeys[i].Token
+				c.ApiKeys[i].PreviousTokenExpiry = time.Now().Add(grace)
+				c.ApiKeys[i].Token = token
+				found = true
+			}
+		}
+
+		if !found {
+			Mutex.Unlock()
+			return errors.New(fmt.Sprintf("no api key exists with the name \"%s\"", key))
+		}
+	}
+	Mutex.Unlock()
+
+	return c.WriteToDisk()
+}
+
+// Puts the node into, or takes it out of, maintenance mode and saves the change to the
+// configuration file so that it persists across restarts.
+func SetMaintenanceMode(enabled bool, message string) error {
+	Mutex.Lock()
+	c := _config
+	c.System.Maintenance.Enabled = enabled
+	c.System.Maintenance.Message = message
+	Mutex.Unlock()
+
+	return c.WriteToDisk()
+}
+
 // Ensures that the Pterodactyl core user exists on the system. This user will be the
 // owner of all data in the root data directory and is used as the user within containers.
 //
 // If files are not owned by this user there will be issues with permissions on Docker
 // mount points.
 func (c *Configuration) EnsurePterodactylUser() (*user.User, error) {
+	// Windows has no concept of a system user we can create and chown files to, so just
+	// run everything as the user the daemon is running as. The same goes for rootless
+	// Docker, where files written by containers belong to the user running Docker.
+	if runtime.GOOS == "windows" || c.Docker.Rootless.Active {
+		u, err := user.Current()
+		if err != nil {
+			return nil, err
+		}
+
+		return u, c.setSystemUser(u)
+	}
+
 	u, err := user.Lookup(c.System.Username)
 
 	// If an error is returned but it isn't the unknown user error just abort
@@ -285,13 +1249,19 @@ func (c *Configuration) EnsurePterodactylUser() (*user.User, error) {
 		return nil, err
 	}
 
+	var command = fmt.Sprintf("useradd --system --no-create-home --shell /bin/false %s", c.System.Username)
+
+	// FreeBSD manages users with pw(8) and does not ship lsb_release, so handle it before
+	// trying to determine the name of the Linux distribution being used.
+	if runtime.GOOS == "freebsd" {
+		command = fmt.Sprintf("pw useradd -n %s -d /nonexistent -s /usr/sbin/nologin", c.System.Username)
+	}
+
 	sysName, err := getSystemName()
-	if err != nil {
+	if err != nil && runtime.GOOS != "freebsd" {
 		return nil, err
 	}
 
-	var command = fmt.Sprintf("useradd --system --no-create-home --shell /bin/false %s", c.System.Username)
-
 	// Alpine Linux is the only OS we currently support that doesn't work with the useradd command, so
 	// in those cases we just modify the command a bit to work as expected.
 	if strings.HasPrefix(sysName, "Alpine") {
@@ -337,7 +1307,7 @@ func (c *Configuration) setSystemUser(u *user.User) error {
 func (c *Configuration) EnsureFilePermissions() error {
 	// Don't run this unless it is configured to be run. On large system this can often slow
 	// things down dramatically during the boot process.
-	if !c.System.SetPermissionsOnBoot {
+	if !c.System.SetPermissionsOnBoot || runtime.GOOS == "windows" {
 		return nil
 	}
 
@@ -373,7 +1343,7 @@ func (c *Configuration) EnsureFilePermissions() error {
 			uid, _ := strconv.Atoi(su.Uid)
 			gid, _ := strconv.Atoi(su.Gid)
 
-			if err := os.Chown(path.Join(c.System.Data, f.Name()), uid, gid); err != nil {
+			if err := os.Chown(filepath.Join(c.System.Data, f.Name()), uid, gid); err != nil {
 				zap.S().Warnw("failed to chown server directory", zap.String("directory", f.Name()), zap.Error(err))
 			}
 		}(file)
@@ -395,6 +1365,11 @@ func (c *Configuration) WriteToDisk() error {
 		ccopy.Debug = false
 	}
 
+	// Never write secrets that were loaded from somewhere else back into the file.
+	if err := ccopy.restoreSecretReferences(); err != nil {
+		return err
+	}
+
 	b, err := yaml.Marshal(&ccopy)
 	if err != nil {
 		return err
@@ -0,0 +1,245 @@
+package config
+
+import (
+	"fmt"
+	"github.com/buger/jsonparser"
+	"github.com/pkg/errors"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Defines where secrets referenced in the configuration file can be loaded from.
+type SecretsConfiguration struct {
+	Vault VaultConfiguration `json:"-" yaml:"vault"`
+}
+
+// Defines the HashiCorp Vault instance that "vault:" secret references are read from. If
+// the address or token are not set the VAULT_ADDR and VAULT_TOKEN environment variables
+// are used instead.
+type VaultConfiguration struct {
+	Address string `yaml:"address"`
+
+	// The token used to authenticate with Vault. This can itself be an "env:" or "file:"
+	// reference, but cannot be loaded from Vault.
+	Token string `yaml:"token"`
+}
+
+// A secret that was loaded from a reference in the configuration file.
+type secretReference struct {
+	reference string
+	value     string
+}
+
+// Determines if a configuration value is a reference to a secret stored elsewhere rather
+// than the secret itself.
+func isSecretReference(v string) bool {
+	return strings.HasPrefix(v, "env:") || strings.HasPrefix(v, "file:") || strings.HasPrefix(v, "vault:")
+}
+
+// Replaces any secret references in the configuration with the values they point to.
+// Fields that can contain secrets are marked with a `secret:"true"` tag, and a value is
+// treated as a reference when it is in one of the following formats:
+//
+//	env:NAME                 the value of the environment variable NAME
+//	file:/path/to/file       the contents of the file, with trailing newlines removed
+//	vault:secret/data/x#key  the key field of the secret at the given path in Vault
+//
+// The references are kept so that they, rather than the secrets themselves, are written
+// back to the configuration file when it is saved.
+func (c *Configuration) resolveSecrets() error {
+	c.secrets = make(map[string]secretReference)
+
+	return walkSecrets(reflect.ValueOf(c).Elem(), "", false, func(path string, f reflect.Value) error {
+		ref := f.String()
+		if !isSecretReference(ref) {
+			return nil
+		}
+
+		v, err := c.loadSecret(ref)
+		if err != nil {
+			return errors.Wrap(err, fmt.Sprintf("failed to load secret for %s", path))
+		}
+
+		c.secrets[path] = secretReference{reference: ref, value: v}
+		f.SetString(v)
+
+		return nil
+	})
+}
+
+// Puts the original references back in place of any secrets that were loaded from them,
+// as long as the secret has not been changed since it was loaded. This should only be
+// called on a copy of the configuration, any slices containing secrets are copied before
+// being modified so that the original configuration is not changed.
+func (c *Configuration) restoreSecretReferences() error {
+	if len(c.secrets) == 0 {
+		return nil
+	}
+
+	return walkSecrets(reflect.ValueOf(c).Elem(), "", true, func(path string, f reflect.Value) error {
+		if s, ok := c.secrets[path]; ok && f.String() == s.value {
+			f.SetString(s.reference)
+		}
+
+		return nil
+	})
+}
+
+// Walks through a configuration struct calling the function for every string field that
+// is tagged as containing a secret. The path passed to the function identifies the field,
+// including the index of any slice it is within.
+func walkSecrets(v reflect.Value, path string, copySlices bool, fn func(string, reflect.Value) error) error {
+	t := v.Type()
+
+	for i := 0; i < v.NumField(); i++ {
+		f := v.Field(i)
+		sf := t.Field(i)
+		if !f.CanSet() || sf.Anonymous {
+			continue
+		}
+
+		p := sf.Name
+		if path != "" {
+			p = path + "." + sf.Name
+		}
+
+		switch f.Kind() {
+		case reflect.String:
+			if sf.Tag.Get("secret") == "true" {
+				if err := fn(p, f); err != nil {
+					return err
+				}
+			}
+		case reflect.Struct:
+			if err := walkSecrets(f, p, copySlices, fn); err != nil {
+				return err
+			}
+		case reflect.Slice:
+			if f.Type().Elem().Kind() != reflect.Struct || f.Len() == 0 {
+				continue
+			}
+
+			if copySlices {
+				n := reflect.MakeSlice(f.Type(), f.Len(), f.Len())
+				reflect.Copy(n, f)
+				f.Set(n)
+			}
+
+			for j := 0; j < f.Len(); j++ {
+				if err := walkSecrets(f.Index(j), p+"."+strconv.Itoa(j), copySlices, fn); err != nil {
+					return err
+				}
+			}
+		}
+	}
+
+	return nil
+}
+
+// Loads the secret that a reference points to.
+func (c *Configuration) loadSecret(ref string) (string, error) {
+	switch {
+	case strings.HasPrefix(ref, "env:"):
+		v, ok := os.LookupEnv(strings.TrimPrefix(ref, "env:"))
+		if !ok {
+			return "", errors.New(fmt.Sprintf("environment variable %s is not set", strings.TrimPrefix(ref, "env:")))
+		}
+
+		return v, nil
+	case strings.HasPrefix(ref, "file:"):
+		b, err := ioutil.ReadFile(strings.TrimPrefix(ref, "file:"))
+		if err != nil {
+			return "", errors.WithStack(err)
+		}
+
+		return strings.TrimRight(string(b), "\r\n"), nil
+	case strings.HasPrefix(ref, "vault:"):
+		return c.loadVaultSecret(strings.TrimPrefix(ref, "vault:"))
+	}
+
+	return ref, nil
+}
+
+// Reads a single field of a secret stored in Vault. Both version 1 and version 2 of the
+// key/value secrets engine are supported.
+func (c *Configuration) loadVaultSecret(ref string) (string, error) {
+	parts := strings.SplitN(ref, "#", 2)
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return "", errors.New("vault references must be in the format vault:path#key")
+	}
+
+	addr := c.Secrets.Vault.Address
+	if addr == "" {
+		addr = os.Getenv("VAULT_ADDR")
+	}
+
+	token := c.Secrets.Vault.Token
+	if token == "" {
+		token = os.Getenv("VAULT_TOKEN")
+	} else if strings.HasPrefix(token, "vault:") {
+		return "", errors.New("the vault token cannot be loaded from vault")
+	} else if isSecretReference(token) {
+		t, err := c.loadSecret(token)
+		if err != nil {
+			return "", err
+		}
+
+		token = t
+	}
+
+	if addr == "" || token == "" {
+		return "", errors.New("no vault address or token has been configured")
+	}
+
+	req, err := http.NewRequest(http.MethodGet, strings.TrimRight(addr, "/")+"/v1/"+strings.TrimLeft(parts[0], "/"), nil)
+	if err != nil {
+		return "", errors.WithStack(err)
+	}
+	req.Header.Set("X-Vault-Token", token)
+
+	client := &http.Client{Timeout: time.Second * 10}
+	res, err := client.Do(req)
+	if err != nil {
+		return "", errors.WithStack(err)
+	}
+	defer res.Body.Close()
+
+	b, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return "", errors.WithStack(err)
+	}
+
+	if res.StatusCode != http.StatusOK {
+		return "", errors.New(fmt.Sprintf("vault responded with status %d for %s", res.StatusCode, parts[0]))
+	}
+
+	// Secrets in version 2 of the key/value engine are nested within a second data key.
+	if v, err := jsonparser.GetString(b, "data", "data", parts[1]); err == nil {
+		return v, nil
+	}
+
+	v, err := jsonparser.GetString(b, "data", parts[1])
+	if err != nil {
+		return "", errors.New(fmt.Sprintf("vault secret %s does not contain the key %s", parts[0], parts[1]))
+	}
+
+	return v, nil
+}
+
+// Returns the PEM encoded data for a TLS setting. The setting is normally the path to a
+// file, but when it has been loaded from a secret reference it may contain the PEM data
+// itself.
+func ReadPEM(v string) ([]byte, error) {
+	if strings.HasPrefix(strings.TrimSpace(v), "-----BEGIN") {
+		return []byte(v), nil
+	}
+
+	b, err := ioutil.ReadFile(v)
+
+	return b, errors.WithStack(err)
+}
@@ -0,0 +1,291 @@
+package encryption
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"github.com/pkg/errors"
+	"io"
+	"io/ioutil"
+	"strings"
+)
+
+// Archives are encrypted using AES-256-GCM in chunks so that they can be written and read
+// as a stream without holding the entire archive in memory. The header of an encrypted file
+// is the magic bytes, the fingerprint of the key, and a random nonce prefix. Every chunk is
+// sealed using a nonce made from that prefix, the index of the chunk, and a flag marking the
+// final chunk, so chunks cannot be reordered, dropped, or truncated without detection.
+const (
+	KeySize = 32
+
+	magic          = "WENC\x01"
+	fingerprintLen = 16
+	prefixLen      = 7
+	chunkSize      = 64 * 1024
+)
+
+var (
+	ErrInvalidKey   = errors.New("encryption: key must be 32 bytes")
+	ErrNotEncrypted = errors.New("encryption: data is not encrypted")
+	ErrWrongKey     = errors.New("encryption: data was encrypted using a different key")
+	ErrCorrupt      = errors.New("encryption: data is corrupt or has been modified")
+)
+
+// Parses a key encoded as base64 or hex.
+func ParseKey(s string) ([]byte, error) {
+	s = strings.TrimSpace(s)
+
+	if b, err := base64.StdEncoding.DecodeString(s); err == nil && len(b) == KeySize {
+		return b, nil
+	}
+
+	if b, err := hex.DecodeString(s); err == nil && len(b) == KeySize {
+		return b, nil
+	}
+
+	return nil, ErrInvalidKey
+}
+
+// Reads a key encoded as base64 or hex from a file.
+func ReadKeyFile(p string) ([]byte, error) {
+	b, err := ioutil.ReadFile(p)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	return ParseKey(string(b))
+}
+
+// Returns a fingerprint identifying the key, without revealing the key itself. This can be
+// stored alongside encrypted data to find the key that is needed to decrypt it.
+func Fingerprint(key []byte) string {
+	return hex.EncodeToString(fingerprint(key))
+}
+
+func fingerprint(key []byte) []byte {
+	h := sha256.Sum256(append([]byte("wings backup key\x00"), key...))
+
+	return h[:fingerprintLen]
+}
+
+// Reads the fingerprint of the key that the data was encrypted with from its header.
+func ReadFingerprint(r io.Reader) (string, error) {
+	h := make([]byte, len(magic)+fingerprintLen)
+	if _, err := io.ReadFull(r, h); err != nil {
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return "", ErrNotEncrypted
+		}
+
+		return "", errors.WithStack(err)
+	}
+
+	if string(h[:len(magic)]) != magic {
+		return "", ErrNotEncrypted
+	}
+
+	return hex.EncodeToString(h[len(magic):]), nil
+}
+
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	if len(key) != KeySize {
+		return nil, ErrInvalidKey
+	}
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	return cipher.NewGCM(block)
+}
+
+func chunkNonce(prefix []byte, index uint32, final bool) []byte {
+	nonce := make([]byte, prefixLen+5)
+	copy(nonce, prefix)
+	binary.BigEndian.PutUint32(nonce[prefixLen:], index)
+	if final {
+		nonce[prefixLen+4] = 1
+	}
+
+	return nonce
+}
+
+type writer struct {
+	w      io.Writer
+	aead   cipher.AEAD
+	prefix []byte
+	index  uint32
+	buf    []byte
+	closed bool
+}
+
+// Returns a writer that encrypts everything written to it using the key before passing it
+// on to w. The writer must be closed to write the final chunk, otherwise the data cannot be
+// decrypted. Closing the writer does not close w.
+func NewWriter(w io.Writer, key []byte) (io.WriteCloser, error) {
+	aead, err := newAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+
+	prefix := make([]byte, prefixLen)
+	if _, err := rand.Read(prefix); err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	h := new(bytes.Buffer)
+	h.WriteString(magic)
+	h.Write(fingerprint(key))
+	h.Write(prefix)
+	if _, err := w.Write(h.Bytes()); err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	return &writer{
+		w:      w,
+		aead:   aead,
+		prefix: prefix,
+		buf:    make([]byte, 0, chunkSize+aead.Overhead()),
+	}, nil
+}
+
+func (ew *writer) Write(p []byte) (int, error) {
+	if ew.closed {
+		return 0, errors.New("encryption: write to closed writer")
+	}
+
+	n := 0
+	for len(p) > 0 {
+		// A full chunk is only sealed once more data arrives, since the final chunk is
+		// always shorter than a full chunk, even if that means it is empty.
+		if len(ew.buf) == chunkSize {
+			if err := ew.seal(false); err != nil {
+				return n, err
+			}
+		}
+
+		c := copy(ew.buf[len(ew.buf):chunkSize], p)
+		ew.buf = ew.buf[:len(ew.buf)+c]
+		p = p[c:]
+		n += c
+	}
+
+	return n, nil
+}
+
+func (ew *writer) Close() error {
+	if ew.closed {
+		return nil
+	}
+	ew.closed = true
+
+	if len(ew.buf) == chunkSize {
+		if err := ew.seal(false); err != nil {
+			return err
+		}
+	}
+
+	return ew.seal(true)
+}
+
+func (ew *writer) seal(final bool) error {
+	out := ew.aead.Seal(ew.buf[:0], chunkNonce(ew.prefix, ew.index, final), ew.buf, nil)
+	ew.index++
+
+	if _, err := ew.w.Write(out); err != nil {
+		return errors.WithStack(err)
+	}
+	ew.buf = ew.buf[:0]
+
+	return nil
+}
+
+type reader struct {
+	r      io.Reader
+	aead   cipher.AEAD
+	prefix []byte
+	index  uint32
+	buf    []byte
+	out    []byte
+	done   bool
+}
+
+// Returns a reader that decrypts data read from r using the key. An error is returned if the
+// data was not encrypted using the key, and reading fails if the data has been modified.
+func NewReader(r io.Reader, key []byte) (io.Reader, error) {
+	aead, err := newAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+
+	f, err := ReadFingerprint(r)
+	if err != nil {
+		return nil, err
+	}
+
+	if f != Fingerprint(key) {
+		return nil, ErrWrongKey
+	}
+
+	prefix := make([]byte, prefixLen)
+	if _, err := io.ReadFull(r, prefix); err != nil {
+		return nil, ErrCorrupt
+	}
+
+	return &reader{
+		r:      r,
+		aead:   aead,
+		prefix: prefix,
+		buf:    make([]byte, chunkSize+aead.Overhead()),
+	}, nil
+}
+
+func (er *reader) Read(p []byte) (int, error) {
+	for len(er.out) == 0 {
+		if er.done {
+			return 0, io.EOF
+		}
+
+		if err := er.open(); err != nil {
+			return 0, err
+		}
+	}
+
+	n := copy(p, er.out)
+	er.out = er.out[n:]
+
+	return n, nil
+}
+
+func (er *reader) open() error {
+	n, err := io.ReadFull(er.r, er.buf)
+
+	var final bool
+	switch err {
+	case nil:
+	case io.ErrUnexpectedEOF:
+		final = true
+	case io.EOF:
+		// The final chunk is never a full chunk, so running out of data here means the
+		// data was truncated.
+		return ErrCorrupt
+	default:
+		return errors.WithStack(err)
+	}
+
+	out, err := er.aead.Open(er.buf[:0], chunkNonce(er.prefix, er.index, final), er.buf[:n], nil)
+	if err != nil {
+		return ErrCorrupt
+	}
+	er.index++
+
+	er.out = out
+	er.done = final
+
+	return nil
+}
@@ -2,6 +2,7 @@ package environment
 
 import (
 	"context"
+	"strings"
 
 	"github.com/docker/docker/api/types"
 	"github.com/docker/docker/api/types/network"
@@ -43,23 +44,59 @@ func ConfigureDocker(c *config.DockerConfiguration) error {
 	return nil
 }
 
+// Determines if the daemon should run in rootless mode, which is the case if it has been
+// enabled in the configuration or Docker reports that it is running rootless.
+func DetectRootless(c *config.DockerConfiguration) error {
+	c.Rootless.Active = c.Rootless.Enabled
+	if c.Rootless.Active || !c.Rootless.Detect {
+		return nil
+	}
+
+	cli, err := client.NewClientWithOpts(client.FromEnv)
+	if err != nil {
+		return err
+	}
+
+	info, err := cli.Info(context.Background())
+	if err != nil {
+		return err
+	}
+
+	for _, opt := range info.SecurityOptions {
+		for _, o := range strings.Split(opt, ",") {
+			if o == "name=rootless" {
+				c.Rootless.Active = true
+			}
+		}
+	}
+
+	return nil
+}
+
 // Creates a new network on the machine if one does not exist already.
 func createDockerNetwork(cli *client.Client, c *config.DockerConfiguration) error {
+	ipam := []network.IPAMConfig{
+		{
+			Subnet:  c.Network.Interfaces.V4.Subnet,
+			Gateway: c.Network.Interfaces.V4.Gateway,
+		},
+	}
+
+	// Rootless Docker cannot route IPv6 traffic to containers unless it has been set up
+	// to do so, so the network is only created with IPv4 in that case.
+	if !c.Rootless.Active {
+		ipam = append(ipam, network.IPAMConfig{
+			Subnet:  c.Network.Interfaces.V6.Subnet,
+			Gateway: c.Network.Interfaces.V6.Gateway,
+		})
+	}
+
 	_, err := cli.NetworkCreate(context.Background(), c.Network.Name, types.NetworkCreate{
 		Driver:     c.Network.Driver,
-		EnableIPv6: true,
+		EnableIPv6: !c.Rootless.Active,
 		Internal:   c.Network.IsInternal,
 		IPAM: &network.IPAM{
-			Config: []network.IPAMConfig{
-				{
-					Subnet:  c.Network.Interfaces.V4.Subnet,
-					Gateway: c.Network.Interfaces.V4.Gateway,
-				},
-				{
-					Subnet:  c.Network.Interfaces.V6.Subnet,
-					Gateway: c.Network.Interfaces.V6.Gateway,
-				},
-			},
+			Config: ipam,
 		},
 		Options: map[string]string{
 			"encryption": "false",
@@ -0,0 +1,219 @@
+package ftp
+
+import (
+	"github.com/pkg/errors"
+	"github.com/pterodactyl/wings/server"
+	"io"
+	"io/ioutil"
+	"os"
+)
+
+// Returned when removing a directory that still has files in it.
+var errDirectoryNotEmpty = errors.New("directory is not empty")
+
+// Handles the file operations for a single server. All paths are resolved through the
+// server filesystem so that the same protections applied to the file API also apply here,
+// and the permissions checked are the same ones used by the SFTP server.
+type fileSystem struct {
+	*server.FileAccess
+}
+
+func (fs *fileSystem) stat(name string) (os.FileInfo, error) {
+	if !fs.Can("list-files") {
+		return nil, os.ErrPermission
+	}
+
+	p, err := fs.Server.Filesystem.SafePath(name)
+	if err != nil {
+		return nil, os.ErrNotExist
+	}
+
+	return os.Stat(p)
+}
+
+// Returns the contents of a directory, or the file itself if the path is not a directory.
+func (fs *fileSystem) list(name string) ([]os.FileInfo, error) {
+	st, err := fs.stat(name)
+	if err != nil {
+		return nil, err
+	}
+
+	if !st.IsDir() {
+		return []os.FileInfo{st}, nil
+	}
+
+	p, _ := fs.Server.Filesystem.SafePath(name)
+
+	return ioutil.ReadDir(p)
+}
+
+func (fs *fileSystem) open(name string) (*os.File, error) {
+	if !fs.Can("edit-files") {
+		return nil, os.ErrPermission
+	}
+
+	p, err := fs.Server.Filesystem.SafePath(name)
+	if err != nil {
+		return nil, os.ErrNotExist
+	}
+
+	if st, err := os.Stat(p); err != nil {
+		return nil, err
+	} else if st.IsDir() {
+		return nil, os.ErrInvalid
+	}
+
+	return fs.Server.Filesystem.OpenFile(p, os.O_RDONLY, 0)
+}
+
+// Opens a file for an upload, creating it if it does not exist. The file is truncated unless
+// the upload is being appended to it.
+func (fs *fileSystem) create(name string, append bool) (*uploadedFile, error) {
+	p, err := fs.Server.Filesystem.SafePath(name)
+	if err != nil {
+		return nil, os.ErrNotExist
+	}
+
+	if !fs.CanModify(p) {
+		return nil, os.ErrPermission
+	}
+
+	if st, err := os.Stat(p); os.IsNotExist(err) {
+		if !fs.Can("create-files") {
+			return nil, os.ErrPermission
+		}
+	} else if err != nil {
+		return nil, err
+	} else if st.IsDir() {
+		return nil, os.ErrInvalid
+	} else if !fs.Can("save-files") {
+		return nil, os.ErrPermission
+	}
+
+	if !fs.HasSpaceAvailable() {
+		return nil, os.ErrPermission
+	}
+
+	upload, err := fs.BeginUpload()
+	if err != nil {
+		return nil, err
+	}
+
+	flag := os.O_WRONLY | os.O_CREATE | os.O_TRUNC
+	if append {
+		flag = os.O_WRONLY | os.O_CREATE | os.O_APPEND
+	}
+
+	f, err := fs.Server.Filesystem.OpenFile(p, flag, 0644)
+	if err != nil {
+		upload.Done()
+		return nil, err
+	}
+
+	fs.Chown(p)
+
+	return &uploadedFile{file: f, fs: fs, path: p, upload: upload}, nil
+}
+
+func (fs *fileSystem) remove(name string) error {
+	p, err := fs.Server.Filesystem.SafeLinkPath(name)
+	if err != nil {
+		return os.ErrNotExist
+	}
+
+	if !fs.Can("delete-files") || !fs.CanModify(p) {
+		return os.ErrPermission
+	}
+
+	if st, err := os.Lstat(p); err != nil {
+		return err
+	} else if st.IsDir() {
+		return os.ErrInvalid
+	}
+
+	return os.Remove(p)
+}
+
+// Removes a directory, which must be empty.
+func (fs *fileSystem) removeDir(name string) error {
+	p, err := fs.Server.Filesystem.SafeLinkPath(name)
+	if err != nil {
+		return os.ErrNotExist
+	}
+
+	if !fs.Can("delete-files") || !fs.CanModify(p) || p == fs.Server.Filesystem.Path() {
+		return os.ErrPermission
+	}
+
+	if err := os.Remove(p); os.IsExist(err) {
+		return errDirectoryNotEmpty
+	} else if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (fs *fileSystem) mkdir(name string) error {
+	p, err := fs.Server.Filesystem.SafePath(name)
+	if err != nil {
+		return os.ErrNotExist
+	}
+
+	if !fs.Can("create-files") || !fs.CanModify(p) {
+		return os.ErrPermission
+	}
+
+	if err := os.Mkdir(p, 0755); err != nil {
+		return err
+	}
+
+	fs.Chown(p)
+
+	return nil
+}
+
+func (fs *fileSystem) rename(from string, to string) error {
+	src, err := fs.Server.Filesystem.SafeLinkPath(from)
+	if err != nil {
+		return os.ErrNotExist
+	}
+
+	dst, err := fs.Server.Filesystem.SafeLinkPath(to)
+	if err != nil {
+		return os.ErrPermission
+	}
+
+	if !fs.Can("move-files") || !fs.CanModify(src) || !fs.CanModify(dst) || src == fs.Server.Filesystem.Path() {
+		return os.ErrPermission
+	}
+
+	if err := os.Rename(src, dst); err != nil {
+		return err
+	}
+
+	fs.Chown(dst)
+
+	return nil
+}
+
+// A file being uploaded over FTP. Writes are throttled to the configured upload bandwidth
+// limits, and once the file is closed it is scanned for malware in the background.
+type uploadedFile struct {
+	file   *os.File
+	fs     *fileSystem
+	path   string
+	upload *server.Upload
+}
+
+// Copies the upload from the data connection into the file.
+func (f *uploadedFile) ReadFrom(r io.Reader) (int64, error) {
+	return io.Copy(f.file, f.upload.Reader(r))
+}
+
+func (f *uploadedFile) Close() error {
+	err := f.file.Close()
+	f.fs.FinishUpload(f.path, f.upload)
+
+	return err
+}
@@ -0,0 +1,106 @@
+package ftp
+
+import (
+	"crypto/tls"
+	"fmt"
+	"github.com/pkg/errors"
+	"github.com/pterodactyl/sftp-server"
+	"github.com/pterodactyl/wings/api"
+	"github.com/pterodactyl/wings/config"
+	"github.com/pterodactyl/wings/server"
+	"go.uber.org/zap"
+	"net"
+	"time"
+)
+
+func Initialize(config *config.Configuration) error {
+	// Initialize the FTP server in a background thread since this is a long running
+	// operation.
+	go func() {
+		if err := listen(config); err != nil {
+			zap.S().Named("ftp").Errorw("failed to initialize FTP subsystem", zap.Error(errors.WithStack(err)))
+		}
+	}()
+
+	return nil
+}
+
+// Starts listening for inbound FTP connections.
+func listen(cfg *config.Configuration) error {
+	logger := zap.S().Named("ftp")
+	c := cfg.System.Ftp
+
+	var tlsConfig *tls.Config
+	if cfg.Api.Ssl.Enabled {
+		cert, err := tls.LoadX509KeyPair(cfg.Api.Ssl.CertificateFile, cfg.Api.Ssl.KeyFile)
+		if err != nil {
+			return errors.WithStack(err)
+		}
+
+		tlsConfig = &tls.Config{
+			Certificates: []tls.Certificate{cert},
+			MinVersion:   tls.VersionTLS12,
+		}
+	} else if c.RequireTls {
+		return errors.New("ftp server requires tls, but ssl is not enabled for the api")
+	}
+
+	l, err := net.Listen("tcp", fmt.Sprintf("%s:%d", c.Address, c.Port))
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	logger.Infow("ftp subsystem listening for connections", zap.String("host", c.Address), zap.Int("port", c.Port), zap.Bool("tls", tlsConfig != nil))
+
+	// Temporary failures, such as running out of file descriptors, are retried with an
+	// increasing delay rather than immediately so that they do not spin the CPU. Any other
+	// error means the listener is closed or unusable.
+	var delay time.Duration
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			if ne, ok := err.(net.Error); ok && ne.Temporary() {
+				if delay == 0 {
+					delay = 5 * time.Millisecond
+				} else if delay *= 2; delay > time.Second {
+					delay = time.Second
+				}
+
+				logger.Warnw("failed to accept ftp connection, retrying", zap.Duration("delay", delay), zap.Error(err))
+				time.Sleep(delay)
+				continue
+			}
+
+			if oe, ok := err.(*net.OpError); ok && oe.Err == net.ErrClosed {
+				return nil
+			}
+
+			return errors.WithStack(err)
+		}
+
+		delay = 0
+		go newSession(conn, tlsConfig, logger).serve()
+	}
+}
+
+// Validates a set of credentials against the Panel using the same endpoint as the SFTP
+// server, returning the server they are for and the permissions of the user on it.
+func validateCredentials(user string, pass string) (*server.Server, []string, error) {
+	resp, err := api.NewRequester().ValidateSftpCredentials(sftp_server.AuthenticationRequest{
+		User: user,
+		Pass: pass,
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	s := server.GetServers().Find(func(s *server.Server) bool {
+		return s.Uuid == resp.Server
+	})
+
+	if s == nil {
+		return nil, nil, errors.New("no server found with that UUID")
+	}
+
+	return s, resp.Permissions, nil
+}
@@ -0,0 +1,649 @@
+package ftp
+
+import (
+	"bufio"
+	"crypto/tls"
+	"fmt"
+	"github.com/pkg/errors"
+	"github.com/pterodactyl/sftp-server"
+	"github.com/pterodactyl/wings/config"
+	"github.com/pterodactyl/wings/server"
+	"go.uber.org/zap"
+	"io"
+	"math/rand"
+	"net"
+	"net/textproto"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// The amount of time a client can stay connected without sending a command.
+	idleTimeout = time.Minute * 5
+	// The amount of time a client has to open a data connection once a transfer is started.
+	dataTimeout = time.Second * 30
+)
+
+// A single control connection from an FTP client.
+type session struct {
+	conn      net.Conn
+	text      *textproto.Conn
+	tlsConfig *tls.Config
+	logger    *zap.SugaredLogger
+
+	// Tracks if the control connection has been secured using AUTH TLS, and if the client
+	// asked for data connections to be secured as well using PROT P.
+	secure  bool
+	protect bool
+
+	// The filesystem of the server the user logged in to, which is nil until they have.
+	user string
+	fs   *fileSystem
+
+	cwd        string
+	renameFrom string
+	passive    net.Listener
+}
+
+func newSession(conn net.Conn, tlsConfig *tls.Config, logger *zap.SugaredLogger) *session {
+	return &session{
+		conn:      conn,
+		text:      textproto.NewConn(conn),
+		tlsConfig: tlsConfig,
+		logger:    logger,
+		cwd:       "/",
+	}
+}
+
+// Handles commands sent by the client until they disconnect or stop responding.
+func (s *session) serve() {
+	defer s.close()
+
+	s.reply(220, "Pterodactyl FTP server ready.")
+
+	for {
+		s.conn.SetReadDeadline(time.Now().Add(idleTimeout))
+
+		line, err := s.text.ReadLine()
+		if err != nil {
+			return
+		}
+
+		cmd, arg := line, ""
+		if i := strings.IndexByte(line, ' '); i >= 0 {
+			cmd, arg = line[:i], line[i+1:]
+		}
+
+		if !s.handle(strings.ToUpper(cmd), arg) {
+			return
+		}
+	}
+}
+
+func (s *session) close() {
+	s.closePassive()
+	s.conn.Close()
+}
+
+func (s *session) reply(code int, msg string) {
+	s.text.PrintfLine("%d %s", code, msg)
+}
+
+// Replies to the client with an error that was returned by the filesystem.
+func (s *session) replyError(err error) {
+	switch {
+	case err == errDirectoryNotEmpty:
+		s.reply(550, "Directory is not empty.")
+	case os.IsPermission(err):
+		s.reply(550, "Permission denied.")
+	case os.IsNotExist(err):
+		s.reply(550, "No such file or directory.")
+	case os.IsExist(err):
+		s.reply(550, "File already exists.")
+	default:
+		s.logger.Debugw("error handling ftp command", zap.String("server", s.fs.Server.Uuid), zap.Error(err))
+		s.reply(550, "Requested action not taken.")
+	}
+}
+
+// Returns the path an argument refers to, relative to the current working directory. The
+// path is always absolute within the root of the server, the server filesystem takes care
+// of making sure it cannot escape that root.
+func (s *session) path(arg string) string {
+	if arg == "" {
+		return s.cwd
+	}
+
+	if !path.IsAbs(arg) {
+		arg = path.Join(s.cwd, arg)
+	}
+
+	return path.Clean(arg)
+}
+
+// Handles a single command, returning false if the connection should be closed.
+func (s *session) handle(cmd string, arg string) bool {
+	switch cmd {
+	case "QUIT":
+		s.reply(221, "Goodbye.")
+		return false
+	case "AUTH":
+		return s.handleAuth(arg)
+	case "FEAT":
+		s.text.PrintfLine("211-Features:")
+		for _, f := range []string{"AUTH TLS", "PBSZ", "PROT", "EPSV", "PASV", "SIZE", "MDTM", "MLST type*;size*;modify*;", "UTF8"} {
+			s.text.PrintfLine(" %s", f)
+		}
+		s.reply(211, "End")
+		return true
+	case "SYST":
+		s.reply(215, "UNIX Type: L8")
+		return true
+	case "NOOP":
+		s.reply(200, "OK.")
+		return true
+	case "OPTS":
+		if strings.ToUpper(arg) == "UTF8 ON" {
+			s.reply(200, "UTF8 enabled.")
+		} else {
+			s.reply(501, "Option not understood.")
+		}
+		return true
+	case "PBSZ":
+		s.reply(200, "PBSZ=0")
+		return true
+	case "PROT":
+		s.handleProt(arg)
+		return true
+	case "USER":
+		if config.Get().System.Ftp.RequireTls && !s.secure {
+			s.reply(530, "TLS is required, use AUTH TLS first.")
+			return true
+		}
+
+		s.user = arg
+		s.fs = nil
+		s.reply(331, "Password required.")
+		return true
+	case "PASS":
+		s.handlePass(arg)
+		return true
+	}
+
+	if s.fs == nil {
+		s.reply(530, "Please log in with USER and PASS.")
+		return true
+	}
+
+	switch cmd {
+	case "PWD", "XPWD":
+		s.reply(257, fmt.Sprintf(`"%s" is the current directory.`, strings.Replace(s.cwd, `"`, `""`, -1)))
+	case "CWD", "XCWD":
+		s.changeDir(s.path(arg))
+	case "CDUP", "XCUP":
+		s.changeDir(path.Dir(s.cwd))
+	case "TYPE":
+		// Every transfer is done in binary, ASCII mode is only accepted since some clients
+		// will refuse to continue if it is not.
+		switch strings.ToUpper(arg) {
+		case "A", "A N", "I", "L 8":
+			s.reply(200, "Type set.")
+		default:
+			s.reply(504, "Type not supported.")
+		}
+	case "MODE":
+		if strings.ToUpper(arg) == "S" {
+			s.reply(200, "Mode set.")
+		} else {
+			s.reply(504, "Mode not supported.")
+		}
+	case "STRU":
+		if strings.ToUpper(arg) == "F" {
+			s.reply(200, "Structure set.")
+		} else {
+			s.reply(504, "Structure not supported.")
+		}
+	case "PASV":
+		s.handlePasv(false)
+	case "EPSV":
+		s.handlePasv(true)
+	case "PORT", "EPRT":
+		s.reply(502, "Active mode is not supported, use passive mode instead.")
+	case "LIST", "NLST", "MLSD":
+		s.handleList(cmd, arg)
+	case "MLST":
+		st, err := s.fs.stat(s.path(arg))
+		if err != nil {
+			s.replyError(err)
+			break
+		}
+
+		s.text.PrintfLine("250-Listing %s", s.path(arg))
+		s.text.PrintfLine(" %s", formatFacts(st, s.path(arg)))
+		s.reply(250, "End")
+	case "RETR":
+		s.handleRetr(arg)
+	case "STOR", "APPE":
+		s.handleStor(arg, cmd == "APPE")
+	case "DELE":
+		if err := s.fs.remove(s.path(arg)); err != nil {
+			s.replyError(err)
+		} else {
+			s.reply(250, "File deleted.")
+		}
+	case "MKD", "XMKD":
+		p := s.path(arg)
+		if err := s.fs.mkdir(p); err != nil {
+			s.replyError(err)
+		} else {
+			s.reply(257, fmt.Sprintf(`"%s" created.`, strings.Replace(p, `"`, `""`, -1)))
+		}
+	case "RMD", "XRMD":
+		if err := s.fs.removeDir(s.path(arg)); err != nil {
+			s.replyError(err)
+		} else {
+			s.reply(250, "Directory removed.")
+		}
+	case "RNFR":
+		if _, err := s.fs.stat(s.path(arg)); err != nil {
+			s.replyError(err)
+			break
+		}
+
+		s.renameFrom = s.path(arg)
+		s.reply(350, "Ready for RNTO.")
+	case "RNTO":
+		if s.renameFrom == "" {
+			s.reply(503, "Use RNFR first.")
+			break
+		}
+
+		from := s.renameFrom
+		s.renameFrom = ""
+		if err := s.fs.rename(from, s.path(arg)); err != nil {
+			s.replyError(err)
+		} else {
+			s.reply(250, "File renamed.")
+		}
+	case "SIZE":
+		st, err := s.fs.stat(s.path(arg))
+		if err != nil {
+			s.replyError(err)
+		} else if st.IsDir() {
+			s.reply(550, "Not a regular file.")
+		} else {
+			s.reply(213, strconv.FormatInt(st.Size(), 10))
+		}
+	case "MDTM":
+		st, err := s.fs.stat(s.path(arg))
+		if err != nil {
+			s.replyError(err)
+		} else {
+			s.reply(213, st.ModTime().UTC().Format("20060102150405"))
+		}
+	default:
+		s.reply(502, "Command not implemented.")
+	}
+
+	return true
+}
+
+// Upgrades the control connection to TLS. If the handshake fails the connection is closed
+// since there is no way to know what state the client is in.
+func (s *session) handleAuth(arg string) bool {
+	if s.tlsConfig == nil {
+		s.reply(431, "TLS is not available.")
+		return true
+	}
+
+	if s.secure {
+		s.reply(503, "Connection is already secured.")
+		return true
+	}
+
+	switch strings.ToUpper(arg) {
+	case "TLS", "TLS-C", "SSL":
+	default:
+		s.reply(504, "Security mechanism not supported.")
+		return true
+	}
+
+	s.reply(234, "Proceed with negotiation.")
+
+	conn := tls.Server(s.conn, s.tlsConfig)
+	conn.SetDeadline(time.Now().Add(dataTimeout))
+	if err := conn.Handshake(); err != nil {
+		s.logger.Debugw("failed to secure ftp connection", zap.String("ip", s.conn.RemoteAddr().String()), zap.Error(err))
+		return false
+	}
+	conn.SetDeadline(time.Time{})
+
+	s.conn = conn
+	s.text = textproto.NewConn(conn)
+	s.secure = true
+
+	return true
+}
+
+func (s *session) handleProt(arg string) {
+	switch strings.ToUpper(arg) {
+	case "P":
+		if !s.secure {
+			s.reply(503, "Use AUTH TLS first.")
+			return
+		}
+
+		s.protect = true
+		s.reply(200, "Data connections will be secured.")
+	case "C":
+		s.protect = false
+		s.reply(200, "Data connections will not be secured.")
+	default:
+		s.reply(504, "Protection level not supported.")
+	}
+}
+
+func (s *session) handlePass(pass string) {
+	if s.user == "" {
+		s.reply(503, "Use USER first.")
+		return
+	}
+
+	srv, permissions, err := validateCredentials(s.user, pass)
+	if err != nil {
+		if !sftp_server.IsInvalidCredentialsError(err) {
+			s.logger.Errorw("encountered error validating user credentials", zap.String("ip", s.conn.RemoteAddr().String()), zap.Error(err))
+		}
+
+		// Slow down clients that are guessing passwords.
+		time.Sleep(time.Second)
+
+		s.user = ""
+		s.reply(530, "Login incorrect.")
+		return
+	}
+
+	s.fs = &fileSystem{FileAccess: server.NewFileAccess(srv, permissions, config.Get().System.Ftp.ReadOnly, s.logger)}
+	s.cwd = "/"
+
+	s.logger.Debugw("user logged in over ftp", zap.String("server", srv.Uuid), zap.String("ip", s.conn.RemoteAddr().String()))
+	s.reply(230, "Login successful.")
+}
+
+func (s *session) changeDir(p string) {
+	st, err := s.fs.stat(p)
+	if err != nil {
+		s.replyError(err)
+		return
+	}
+
+	if !st.IsDir() {
+		s.reply(550, "Not a directory.")
+		return
+	}
+
+	s.cwd = p
+	s.reply(250, "Directory changed.")
+}
+
+// Opens a listener in the passive port range for the next data connection. Ports are
+// tried starting at a random offset so that concurrent sessions do not all race for the
+// first port in the range.
+func (s *session) handlePasv(extended bool) {
+	s.closePassive()
+
+	c := config.Get().System.Ftp
+
+	var ip net.IP
+	if !extended {
+		if c.PublicIp != "" {
+			ip = net.ParseIP(c.PublicIp).To4()
+		} else if addr, ok := s.conn.LocalAddr().(*net.TCPAddr); ok {
+			ip = addr.IP.To4()
+		}
+
+		if ip == nil {
+			s.reply(425, "Passive mode is only supported over IPv4, use EPSV instead.")
+			return
+		}
+	}
+
+	n := c.PassivePortMax - c.PassivePortMin + 1
+	if n <= 0 {
+		s.reply(425, "No passive ports are configured.")
+		return
+	}
+
+	start := rand.Intn(n)
+	for i := 0; i < n; i++ {
+		port := c.PassivePortMin + (start+i)%n
+
+		l, err := net.Listen("tcp", fmt.Sprintf("%s:%d", c.Address, port))
+		if err != nil {
+			continue
+		}
+
+		s.passive = l
+
+		if extended {
+			s.reply(229, fmt.Sprintf("Entering Extended Passive Mode (|||%d|)", port))
+		} else {
+			s.reply(227, fmt.Sprintf("Entering Passive Mode (%d,%d,%d,%d,%d,%d)", ip[0], ip[1], ip[2], ip[3], port>>8, port&0xff))
+		}
+
+		return
+	}
+
+	s.reply(425, "No passive ports are available.")
+}
+
+func (s *session) closePassive() {
+	if s.passive != nil {
+		s.passive.Close()
+		s.passive = nil
+	}
+}
+
+// Checks that a data connection can be opened for a transfer, replying to the client if
+// it cannot.
+func (s *session) canTransfer() bool {
+	if s.passive == nil {
+		s.reply(425, "Use PASV or EPSV first.")
+		return false
+	}
+
+	if config.Get().System.Ftp.RequireTls && !s.protect {
+		s.reply(521, "Data connections must be secured using PROT P.")
+		return false
+	}
+
+	return true
+}
+
+// Accepts the data connection for a transfer from the passive listener. The connection
+// must come from the same address as the control connection, otherwise anyone could steal
+// the transfer by connecting to the port first.
+func (s *session) openData() (net.Conn, error) {
+	l := s.passive
+	s.passive = nil
+	defer l.Close()
+
+	if tl, ok := l.(*net.TCPListener); ok {
+		tl.SetDeadline(time.Now().Add(dataTimeout))
+	}
+
+	conn, err := l.Accept()
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	remote, _, _ := net.SplitHostPort(conn.RemoteAddr().String())
+	control, _, _ := net.SplitHostPort(s.conn.RemoteAddr().String())
+	if remote != control {
+		conn.Close()
+		return nil, errors.New("data connection was opened from a different address")
+	}
+
+	if s.protect {
+		tc := tls.Server(conn, s.tlsConfig)
+		tc.SetDeadline(time.Now().Add(dataTimeout))
+		if err := tc.Handshake(); err != nil {
+			tc.Close()
+			return nil, errors.WithStack(err)
+		}
+		tc.SetDeadline(time.Time{})
+
+		return tc, nil
+	}
+
+	return conn, nil
+}
+
+// Starts a transfer by opening the data connection, returning nil if it could not be
+// opened.
+func (s *session) beginTransfer() net.Conn {
+	s.reply(150, "Opening data connection.")
+
+	conn, err := s.openData()
+	if err != nil {
+		s.logger.Debugw("failed to open ftp data connection", zap.String("server", s.fs.Server.Uuid), zap.Error(err))
+		s.reply(425, "Cannot open data connection.")
+		return nil
+	}
+
+	return conn
+}
+
+// Closes the data connection of a transfer, replying to the client with the result.
+func (s *session) endTransfer(conn net.Conn, err error) {
+	if cerr := conn.Close(); err == nil {
+		err = cerr
+	}
+
+	if err != nil {
+		s.logger.Debugw("ftp transfer failed", zap.String("server", s.fs.Server.Uuid), zap.Error(err))
+		s.reply(426, "Transfer aborted.")
+		return
+	}
+
+	s.reply(226, "Transfer complete.")
+}
+
+func (s *session) handleList(cmd string, arg string) {
+	// Clients commonly pass flags for ls along with LIST, which are ignored.
+	if cmd == "LIST" {
+		for strings.HasPrefix(arg, "-") {
+			if i := strings.IndexByte(arg, ' '); i >= 0 {
+				arg = strings.TrimSpace(arg[i+1:])
+			} else {
+				arg = ""
+			}
+		}
+	}
+
+	p := s.path(arg)
+	files, err := s.fs.list(p)
+	if err != nil {
+		s.replyError(err)
+		return
+	}
+
+	if !s.canTransfer() {
+		return
+	}
+
+	conn := s.beginTransfer()
+	if conn == nil {
+		return
+	}
+
+	w := bufio.NewWriter(conn)
+	for _, f := range files {
+		switch cmd {
+		case "NLST":
+			fmt.Fprintf(w, "%s\r\n", f.Name())
+		case "MLSD":
+			fmt.Fprintf(w, "%s\r\n", formatFacts(f, f.Name()))
+		default:
+			fmt.Fprintf(w, "%s\r\n", formatListing(f))
+		}
+	}
+
+	s.endTransfer(conn, w.Flush())
+}
+
+func (s *session) handleRetr(arg string) {
+	f, err := s.fs.open(s.path(arg))
+	if err != nil {
+		s.replyError(err)
+		return
+	}
+	defer f.Close()
+
+	if !s.canTransfer() {
+		return
+	}
+
+	conn := s.beginTransfer()
+	if conn == nil {
+		return
+	}
+
+	_, err = io.Copy(conn, f)
+
+	s.endTransfer(conn, err)
+}
+
+func (s *session) handleStor(arg string, append bool) {
+	if !s.canTransfer() {
+		return
+	}
+
+	f, err := s.fs.create(s.path(arg), append)
+	if err != nil {
+		s.replyError(err)
+		return
+	}
+
+	conn := s.beginTransfer()
+	if conn == nil {
+		f.Close()
+		return
+	}
+
+	_, err = f.ReadFrom(conn)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+
+	s.endTransfer(conn, err)
+}
+
+// Formats a file in the same way as "ls -l", which is what most clients expect to receive
+// when listing a directory.
+func formatListing(f os.FileInfo) string {
+	mode := f.Mode().String()
+	if strings.HasPrefix(mode, "L") {
+		mode = "l" + mode[1:]
+	}
+
+	layout := "Jan _2 15:04"
+	if time.Since(f.ModTime()) > time.Hour*24*180 {
+		layout = "Jan _2  2006"
+	}
+
+	return fmt.Sprintf("%s 1 pterodactyl pterodactyl %12d %s %s", mode, f.Size(), f.ModTime().Format(layout), f.Name())
+}
+
+// Formats a file as a set of machine readable facts, as defined for MLSD and MLST.
+func formatFacts(f os.FileInfo, name string) string {
+	t := "file"
+	if f.IsDir() {
+		t = "dir"
+	}
+
+	return fmt.Sprintf("type=%s;size=%d;modify=%s; %s", t, f.Size(), f.ModTime().UTC().Format("20060102150405"), name)
+}
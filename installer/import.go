@@ -0,0 +1,372 @@
+package installer
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/asaskevich/govalidator"
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/mount"
+	"github.com/docker/docker/client"
+	"github.com/pkg/errors"
+	"github.com/pterodactyl/wings/api"
+	"github.com/pterodactyl/wings/server"
+	"go.uber.org/zap"
+	"io"
+	"os"
+	"path/filepath"
+	"syscall"
+	"time"
+)
+
+// Describes an existing server that should be adopted by the daemon. The files for the
+// server are taken from either a directory or the data mount of an existing container. If
+// neither is given the files must already be in the data directory for the server.
+type ImportRequest struct {
+	Uuid      string `json:"uuid"`
+	Directory string `json:"directory"`
+	Container string `json:"container"`
+
+	// If set the container the files were taken from is removed once it has been stopped,
+	// otherwise it is only stopped.
+	RemoveContainer bool `json:"remove_container"`
+}
+
+// Validates a request to import an existing server and moves its files into the data
+// directory for the server. The configuration for the server is fetched from the Panel,
+// so the server must already exist there. The returned installer should then be adopted
+// using Adopt() rather than executed, since the server does not need to be installed.
+func NewImport(data []byte) (*Installer, error) {
+	r := ImportRequest{}
+	if err := json.Unmarshal(data, &r); err != nil {
+		return nil, NewValidationError("the request body could not be parsed")
+	}
+
+	if !govalidator.IsUUIDv4(r.Uuid) {
+		return nil, NewValidationError("uuid provided was not in a valid format")
+	}
+
+	if r.Directory != "" && r.Container != "" {
+		return nil, NewValidationError("only one of a directory or container can be imported")
+	}
+
+	if r.Directory != "" && !filepath.IsAbs(r.Directory) {
+		return nil, NewValidationError("directory provided must be an absolute path")
+	}
+
+	exists := server.GetServers().Find(func(s *server.Server) bool {
+		return s.Uuid == r.Uuid
+	})
+	if exists != nil {
+		return nil, NewValidationError("a server with this uuid already exists on the node")
+	}
+
+	c, rerr, err := api.NewRequester().GetServerConfiguration(r.Uuid)
+	if err != nil || rerr != nil {
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+
+		return nil, errors.New(rerr.String())
+	}
+
+	s, err := server.FromConfiguration(c)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := server.CheckAllocationConflicts(s.Uuid, s.Allocations.Mappings); err != nil {
+		return nil, err
+	}
+
+	if err := server.ReserveCapacity(s.Uuid, s.Build.MemoryLimit, s.Build.DiskSpace); err != nil {
+		return nil, err
+	}
+
+	// The capacity reserved is released once the server is added to the collection, or
+	// here if the import fails before then.
+	imported := false
+	defer func() {
+		if !imported {
+			server.ReleaseCapacity(s.Uuid)
+		}
+	}()
+
+	source := r.Directory
+	var container *importContainer
+	if r.Container != "" {
+		if container, err = inspectContainer(r.Container); err != nil {
+			return nil, err
+		}
+		source = container.source
+	}
+
+	// Everything that can be checked is checked before the container is touched, so that a
+	// request that cannot succeed leaves the existing server exactly as it was.
+	if err := validateServerData(s.Filesystem.Path(), source); err != nil {
+		return nil, err
+	}
+
+	// The container is stopped before its files are moved so that nothing is written to
+	// them part way through, and started again if they could not be moved. It is only
+	// removed once the files are in place.
+	if container != nil {
+		if err := container.stop(); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := moveServerData(s.Filesystem.Path(), source); err != nil {
+		if container != nil {
+			container.restore()
+		}
+
+		return nil, err
+	}
+
+	if container != nil && r.RemoveContainer {
+		if err := container.remove(); err != nil {
+			zap.S().Warnw("failed to remove container after importing server", zap.String("container", container.id), zap.Error(err))
+		}
+	}
+
+	imported = true
+
+	return &Installer{server: s}, nil
+}
+
+// An existing container that the files of a server are being imported from.
+type importContainer struct {
+	cli     *client.Client
+	id      string
+	source  string
+	running bool
+	stopped bool
+}
+
+// Returns the container along with the directory mounted as its data directory.
+func inspectContainer(id string) (*importContainer, error) {
+	cli, err := client.NewClientWithOpts(client.FromEnv)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	c, err := cli.ContainerInspect(context.Background(), id)
+	if err != nil {
+		if client.IsErrNotFound(err) {
+			return nil, NewValidationError("the container provided does not exist")
+		}
+
+		return nil, errors.WithStack(err)
+	}
+
+	// Containers created by the daemon, and by most other panels, mount the server files at
+	// /home/container. If there is no mount there but only a single bind mount, that is
+	// assumed to contain the server files instead.
+	var source string
+	var binds []string
+	for _, m := range c.Mounts {
+		if m.Destination == "/home/container" {
+			source = m.Source
+			break
+		}
+
+		if m.Type == mount.TypeBind {
+			binds = append(binds, m.Source)
+		}
+	}
+
+	if source == "" && len(binds) == 1 {
+		source = binds[0]
+	}
+
+	if source == "" {
+		return nil, NewValidationError("the data directory of the container could not be determined")
+	}
+
+	return &importContainer{
+		cli:     cli,
+		id:      c.ID,
+		source:  source,
+		running: c.State != nil && c.State.Running,
+	}, nil
+}
+
+// Stops the container so that the server is not running twice once it has been imported.
+func (c *importContainer) stop() error {
+	if !c.running {
+		return nil
+	}
+
+	zap.S().Infow("stopping container being imported", zap.String("container", c.id))
+
+	t := time.Second * 30
+	if err := c.cli.ContainerStop(context.Background(), c.id, &t); err != nil {
+		return errors.WithStack(err)
+	}
+	c.stopped = true
+
+	return nil
+}
+
+// Starts the container again if it was stopped, used when the import fails.
+func (c *importContainer) restore() {
+	if !c.stopped {
+		return
+	}
+
+	if err := c.cli.ContainerStart(context.Background(), c.id, types.ContainerStartOptions{}); err != nil {
+		zap.S().Warnw("failed to start container again after import failed", zap.String("container", c.id), zap.Error(err))
+	}
+}
+
+func (c *importContainer) remove() error {
+	return errors.WithStack(c.cli.ContainerRemove(context.Background(), c.id, types.ContainerRemoveOptions{}))
+}
+
+// Checks that the files being imported can be moved into the data directory for the server.
+// If no source is given, or the source is the data directory, the files must already be in
+// place.
+func validateServerData(target string, source string) error {
+	if source == "" || filepath.Clean(source) == target {
+		if st, err := os.Stat(target); err != nil {
+			if os.IsNotExist(err) {
+				return NewValidationError("the server data directory does not exist")
+			}
+
+			return errors.WithStack(err)
+		} else if !st.IsDir() {
+			return NewValidationError("the server data directory is not a directory")
+		}
+
+		return nil
+	}
+
+	if st, err := os.Stat(source); err != nil {
+		if os.IsNotExist(err) {
+			return NewValidationError("the directory provided does not exist")
+		}
+
+		return errors.WithStack(err)
+	} else if !st.IsDir() {
+		return NewValidationError("the path provided is not a directory")
+	}
+
+	if _, err := os.Stat(target); err == nil {
+		return NewValidationError("the server data directory already exists")
+	} else if !os.IsNotExist(err) {
+		return errors.WithStack(err)
+	}
+
+	return nil
+}
+
+// Moves the files being imported into the data directory for the server, which must have
+// been checked using validateServerData first.
+func moveServerData(target string, source string) error {
+	if source == "" || filepath.Clean(source) == target {
+		return nil
+	}
+
+	if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+		return errors.WithStack(err)
+	}
+
+	err := os.Rename(source, target)
+	if err == nil {
+		return nil
+	}
+
+	// Renaming only works within a single filesystem, otherwise the files are copied and
+	// the originals only removed once every file has been copied.
+	if le, ok := err.(*os.LinkError); !ok || le.Err != syscall.EXDEV {
+		return errors.Wrap(err, "failed to move directory into the server data directory")
+	}
+
+	if err := copyTree(source, target); err != nil {
+		os.RemoveAll(target)
+
+		return errors.Wrap(err, "failed to copy directory into the server data directory")
+	}
+
+	if err := os.RemoveAll(source); err != nil {
+		zap.S().Warnw("failed to remove imported directory after copying it", zap.String("directory", source), zap.Error(err))
+	}
+
+	return nil
+}
+
+// Copies a directory and everything in it, keeping file modes and symlinks. Ownership is
+// not kept since the files are given to the daemon user once imported.
+func copyTree(source string, target string) error {
+	return filepath.Walk(source, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		rel, err := filepath.Rel(source, p)
+		if err != nil {
+			return err
+		}
+		dst := filepath.Join(target, rel)
+
+		switch {
+		case info.IsDir():
+			return os.MkdirAll(dst, info.Mode().Perm()|0700)
+		case info.Mode()&os.ModeSymlink != 0:
+			link, err := os.Readlink(p)
+			if err != nil {
+				return err
+			}
+
+			return os.Symlink(link, dst)
+		case info.Mode().IsRegular():
+			return copyFile(p, dst, info.Mode().Perm())
+		default:
+			// Sockets, devices and other special files are not part of a server.
+			return nil
+		}
+	})
+}
+
+func copyFile(source string, target string, mode os.FileMode) error {
+	in, err := os.Open(source)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.OpenFile(target, os.O_CREATE|os.O_EXCL|os.O_WRONLY, mode)
+	if err != nil {
+		return err
+	}
+
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+
+	return out.Close()
+}
+
+// Completes the import of a server by taking ownership of its files, calculating the disk
+// space used by them and creating the environment for the server. The installation process
+// is not run, and the Panel is told that the server has been installed.
+func (i *Installer) Adopt() error {
+	if err := i.server.Filesystem.Chown("/"); err != nil {
+		return err
+	}
+
+	size, err := i.server.DiskUsage()
+	if err != nil {
+		return err
+	}
+	i.server.UpdateResources(func(ru *server.ResourceUsage) {
+		ru.Disk = size
+	})
+
+	if err := i.server.Environment.Create(); err != nil {
+		return err
+	}
+
+	return i.server.MarkInstalled()
+}
@@ -10,7 +10,7 @@ import (
 	"github.com/pterodactyl/wings/server"
 	"go.uber.org/zap"
 	"os"
-	"path"
+	"path/filepath"
 )
 
 type Installer struct {
@@ -71,6 +71,24 @@ func New(data []byte) (*Installer, error) {
 		}
 	}
 
+	if err := server.CheckAllocationConflicts(s.Uuid, s.Allocations.Mappings); err != nil {
+		return nil, err
+	}
+
+	if err := server.ReserveCapacity(s.Uuid, s.Build.MemoryLimit, s.Build.DiskSpace); err != nil {
+		return nil, err
+	}
+
+	// The capacity reserved is released once the server is added to the collection, or
+	// here if the server cannot be created.
+	uuid := s.Uuid
+	created := false
+	defer func() {
+		if !created {
+			server.ReleaseCapacity(uuid)
+		}
+	}()
+
 	s.Container.Image = getString(data, "container", "image")
 
 	c, rerr, err := api.NewRequester().GetServerConfiguration(s.Uuid)
@@ -88,6 +106,7 @@ func New(data []byte) (*Installer, error) {
 	// Create a new server instance using the configuration we wrote to the disk
 	// so that everything gets instantiated correctly on the struct.
 	s2, err := server.FromConfiguration(c)
+	created = err == nil
 
 	return &Installer{
 		server: s2,
@@ -109,12 +128,12 @@ func (i *Installer) Server() *server.Server {
 // the server instance.
 func (i *Installer) Execute() {
 	zap.S().Debugw("creating required server data directory", zap.String("server", i.Uuid()))
-	if err := os.MkdirAll(path.Join(config.Get().System.Data, i.Uuid()), 0755); err != nil {
+	if err := os.MkdirAll(filepath.Join(config.Get().System.Data, i.Uuid()), 0755); err != nil {
 		zap.S().Errorw("failed to create server data directory", zap.String("server", i.Uuid()), zap.Error(errors.WithStack(err)))
 		return
 	}
 
-	if err := os.Chown(path.Join(config.Get().System.Data, i.Uuid()), config.Get().System.User.Uid, config.Get().System.User.Gid); err != nil {
+	if err := os.Chown(filepath.Join(config.Get().System.Data, i.Uuid()), config.Get().System.User.Uid, config.Get().System.User.Gid); err != nil {
 		zap.S().Errorw("failed to chown server data directory", zap.String("server", i.Uuid()), zap.Error(errors.WithStack(err)))
 		return
 	}
@@ -0,0 +1,65 @@
+package logship
+
+import (
+	"go.uber.org/zap/zapcore"
+	"strings"
+)
+
+// A zap core that ships every entry logged by the daemon, so that it can be used
+// alongside the core writing to stdout.
+type core struct {
+	zapcore.LevelEnabler
+	enc     zapcore.Encoder
+	shipper *Shipper
+}
+
+// Returns a zap core that ships entries at or above the given level.
+func NewCore(s *Shipper, level zapcore.LevelEnabler) zapcore.Core {
+	cfg := zapcore.EncoderConfig{
+		MessageKey:     "msg",
+		NameKey:        "logger",
+		CallerKey:      "caller",
+		StacktraceKey:  "stacktrace",
+		LineEnding:     zapcore.DefaultLineEnding,
+		EncodeDuration: zapcore.StringDurationEncoder,
+		EncodeCaller:   zapcore.ShortCallerEncoder,
+	}
+
+	return &core{LevelEnabler: level, enc: zapcore.NewConsoleEncoder(cfg), shipper: s}
+}
+
+func (c *core) With(fields []zapcore.Field) zapcore.Core {
+	enc := c.enc.Clone()
+	for _, f := range fields {
+		f.AddTo(enc)
+	}
+
+	return &core{LevelEnabler: c.LevelEnabler, enc: enc, shipper: c.shipper}
+}
+
+func (c *core) Check(e zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if c.Enabled(e.Level) {
+		return ce.AddCore(e, c)
+	}
+
+	return ce
+}
+
+func (c *core) Write(e zapcore.Entry, fields []zapcore.Field) error {
+	buf, err := c.enc.EncodeEntry(e, fields)
+	if err != nil {
+		return err
+	}
+	defer buf.Free()
+
+	c.shipper.Ship(map[string]string{
+		"source": "daemon",
+		"level":  e.Level.String(),
+	}, strings.TrimRight(buf.String(), "\n"))
+
+	return nil
+}
+
+func (c *core) Sync() error {
+	return nil
+}
@@ -0,0 +1,211 @@
+package logship
+
+import (
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// A single line of log output along with the labels identifying where it came from.
+type Entry struct {
+	Time   time.Time
+	Labels map[string]string
+	Line   string
+}
+
+// Delivers a batch of entries to a remote endpoint.
+type sender interface {
+	send(entries []Entry) error
+}
+
+// The options used to create a shipper.
+type Options struct {
+	// Either "syslog" or "loki".
+	Driver string
+
+	// For syslog this is a URL in the form of "udp://host:514" or "tcp://host:514", and for
+	// Loki it is the base URL of the Loki server.
+	Address string
+
+	// Credentials used for HTTP basic authentication when pushing to Loki.
+	Username string
+	Password string
+
+	// Labels that are added to every entry.
+	Labels map[string]string
+
+	// The maximum number of entries sent at once.
+	BatchSize int
+
+	// How long entries can be waiting before they are sent, even if the batch is not full.
+	FlushInterval time.Duration
+
+	// The maximum number of entries that can be waiting to be sent. Any entries logged
+	// while the buffer is full are dropped.
+	BufferSize int
+}
+
+// The number of times a batch is sent before it is given up on.
+const attempts = 3
+
+// Ships log entries to a remote endpoint in batches. Entries are buffered in memory so that
+// logging never blocks, and are dropped if the endpoint cannot keep up.
+type Shipper struct {
+	sender    sender
+	labels    map[string]string
+	batchSize int
+	interval  time.Duration
+
+	entries chan Entry
+	dropped uint64
+
+	closeOnce sync.Once
+	done      chan struct{}
+}
+
+// Creates a shipper using the given options and starts sending entries in the background.
+func New(o Options) (*Shipper, error) {
+	var snd sender
+	var err error
+
+	switch o.Driver {
+	case "syslog":
+		snd, err = newSyslog(o.Address)
+	case "loki":
+		snd, err = newLoki(o.Address, o.Username, o.Password)
+	default:
+		return nil, errors.New("logship: unknown driver " + o.Driver)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	labels := make(map[string]string, len(o.Labels)+1)
+	if h, err := os.Hostname(); err == nil {
+		labels["host"] = h
+	}
+	for k, v := range o.Labels {
+		labels[k] = v
+	}
+
+	if o.BatchSize <= 0 {
+		o.BatchSize = 500
+	}
+	if o.FlushInterval <= 0 {
+		o.FlushInterval = time.Second * 5
+	}
+	if o.BufferSize < o.BatchSize {
+		o.BufferSize = o.BatchSize
+	}
+
+	s := &Shipper{
+		sender:    snd,
+		labels:    labels,
+		batchSize: o.BatchSize,
+		interval:  o.FlushInterval,
+		entries:   make(chan Entry, o.BufferSize),
+		done:      make(chan struct{}),
+	}
+
+	go s.run()
+
+	return s, nil
+}
+
+// Queues a line to be shipped with the given labels in addition to the labels configured
+// for the shipper. This never blocks, if the buffer is full the line is dropped.
+func (s *Shipper) Ship(labels map[string]string, line string) {
+	l := make(map[string]string, len(s.labels)+len(labels))
+	for k, v := range s.labels {
+		l[k] = v
+	}
+	for k, v := range labels {
+		l[k] = v
+	}
+
+	select {
+	case s.entries <- Entry{Time: time.Now(), Labels: l, Line: line}:
+	default:
+		atomic.AddUint64(&s.dropped, 1)
+	}
+}
+
+// Stops accepting entries and sends any that are still waiting. Lines shipped after this
+// is called are dropped.
+func (s *Shipper) Close() error {
+	s.closeOnce.Do(func() {
+		close(s.done)
+	})
+
+	return nil
+}
+
+func (s *Shipper) run() {
+	t := time.NewTicker(s.interval)
+	defer t.Stop()
+
+	batch := make([]Entry, 0, s.batchSize)
+	var failing bool
+
+	flush := func() {
+		if len(batch) == 0 {
+			return
+		}
+
+		err := s.sendWithRetry(batch)
+		if err != nil && !failing {
+			zap.S().Warnw("failed to ship log entries, entries are being dropped", zap.Int("count", len(batch)), zap.Error(err))
+		} else if err == nil && failing {
+			zap.S().Infow("shipping log entries again")
+		}
+		failing = err != nil
+
+		if n := atomic.SwapUint64(&s.dropped, 0); n > 0 {
+			zap.S().Warnw("dropped log entries because the shipping buffer was full", zap.Uint64("count", n))
+		}
+
+		batch = make([]Entry, 0, s.batchSize)
+	}
+
+	for {
+		select {
+		case e := <-s.entries:
+			batch = append(batch, e)
+			if len(batch) >= s.batchSize {
+				flush()
+			}
+		case <-t.C:
+			flush()
+		case <-s.done:
+			for {
+				select {
+				case e := <-s.entries:
+					batch = append(batch, e)
+				default:
+					flush()
+					return
+				}
+			}
+		}
+	}
+}
+
+// Sends the batch, retrying with an increasing delay between each attempt.
+func (s *Shipper) sendWithRetry(batch []Entry) error {
+	var err error
+	for i := 0; i < attempts; i++ {
+		if i > 0 {
+			time.Sleep(time.Second * time.Duration(i))
+		}
+
+		if err = s.sender.send(batch); err == nil {
+			return nil
+		}
+	}
+
+	return err
+}
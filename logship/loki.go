@@ -0,0 +1,113 @@
+package logship
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/pkg/errors"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Sends entries to the push API of a Loki server. Entries with the same labels are sent
+// together as a single stream.
+//
+// @see https://grafana.com/docs/loki/latest/api/#post-lokiapiv1push
+type lokiSender struct {
+	url      string
+	username string
+	password string
+	client   *http.Client
+}
+
+type lokiStream struct {
+	Stream map[string]string `json:"stream"`
+	Values [][2]string       `json:"values"`
+}
+
+func newLoki(address string, username string, password string) (*lokiSender, error) {
+	if !strings.HasPrefix(address, "http://") && !strings.HasPrefix(address, "https://") {
+		return nil, errors.New("logship: loki address must be a http or https URL")
+	}
+
+	return &lokiSender{
+		url:      strings.TrimRight(address, "/") + "/loki/api/v1/push",
+		username: username,
+		password: password,
+		client:   &http.Client{Timeout: time.Second * 15},
+	}, nil
+}
+
+func (l *lokiSender) send(entries []Entry) error {
+	streams := make(map[string]*lokiStream)
+	var order []string
+
+	for _, e := range entries {
+		k := streamKey(e.Labels)
+		st, ok := streams[k]
+		if !ok {
+			st = &lokiStream{Stream: e.Labels}
+			streams[k] = st
+			order = append(order, k)
+		}
+
+		st.Values = append(st.Values, [2]string{strconv.FormatInt(e.Time.UnixNano(), 10), e.Line})
+	}
+
+	body := struct {
+		Streams []*lokiStream `json:"streams"`
+	}{}
+	for _, k := range order {
+		body.Streams = append(body.Streams, streams[k])
+	}
+
+	b, err := json.Marshal(body)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	req, err := http.NewRequest(http.MethodPost, l.url, bytes.NewReader(b))
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	if l.username != "" || l.password != "" {
+		req.SetBasicAuth(l.username, l.password)
+	}
+
+	res, err := l.client.Do(req)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		msg, _ := ioutil.ReadAll(io.LimitReader(res.Body, 1024))
+
+		return errors.New(fmt.Sprintf("logship: loki returned status %d: %s", res.StatusCode, strings.TrimSpace(string(msg))))
+	}
+
+	return nil
+}
+
+// Returns a key that is the same for every set of labels with the same values.
+func streamKey(labels map[string]string) string {
+	keys := make([]string, 0, len(labels))
+	for k := range labels {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var b strings.Builder
+	for _, k := range keys {
+		b.WriteString(k + "=" + labels[k] + "\x00")
+	}
+
+	return b.String()
+}
@@ -0,0 +1,122 @@
+package logship
+
+import (
+	"fmt"
+	"github.com/pkg/errors"
+	"net"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// The private enterprise number used for the structured data element that carries the
+// labels of each entry. 32473 is reserved for documentation use.
+const syslogEnterpriseId = "32473"
+
+// Sends entries to a syslog server using the RFC 5424 format. Messages sent over TCP are
+// framed using octet counting.
+//
+// @see https://tools.ietf.org/html/rfc5424
+// @see https://tools.ietf.org/html/rfc6587#section-3.4.1
+type syslogSender struct {
+	network  string
+	address  string
+	hostname string
+	conn     net.Conn
+}
+
+func newSyslog(address string) (*syslogSender, error) {
+	u, err := url.Parse(address)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	if u.Scheme != "udp" && u.Scheme != "tcp" {
+		return nil, errors.New("logship: syslog address must use the udp or tcp scheme")
+	}
+
+	hostname, _ := os.Hostname()
+	if hostname == "" {
+		hostname = "-"
+	}
+
+	return &syslogSender{network: u.Scheme, address: u.Host, hostname: hostname}, nil
+}
+
+func (s *syslogSender) send(entries []Entry) error {
+	if s.conn == nil {
+		c, err := net.DialTimeout(s.network, s.address, time.Second*10)
+		if err != nil {
+			return errors.WithStack(err)
+		}
+
+		s.conn = c
+	}
+
+	s.conn.SetWriteDeadline(time.Now().Add(time.Second * 10))
+
+	for _, e := range entries {
+		msg := s.format(e)
+		if s.network == "tcp" {
+			msg = fmt.Sprintf("%d %s", len(msg), msg)
+		}
+
+		if _, err := s.conn.Write([]byte(msg)); err != nil {
+			s.conn.Close()
+			s.conn = nil
+
+			return errors.WithStack(err)
+		}
+	}
+
+	return nil
+}
+
+// Formats an entry as a syslog message. The labels are included as structured data so
+// that they can be searched on by the receiving server.
+func (s *syslogSender) format(e Entry) string {
+	keys := make([]string, 0, len(e.Labels))
+	for k := range e.Labels {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var sd strings.Builder
+	sd.WriteString("[labels@" + syslogEnterpriseId)
+	for _, k := range keys {
+		fmt.Fprintf(&sd, " %s=\"%s\"", k, sdEscaper.Replace(e.Labels[k]))
+	}
+	sd.WriteString("]")
+
+	// Use the "user" facility with a severity based on the level of the entry.
+	pri := 8 + severity(e.Labels["level"])
+
+	return fmt.Sprintf(
+		"<%d>1 %s %s wings - - %s %s",
+		pri,
+		e.Time.UTC().Format(time.RFC3339Nano),
+		s.hostname,
+		sd.String(),
+		e.Line,
+	)
+}
+
+// Characters that must be escaped in structured data parameter values.
+var sdEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, `]`, `\]`)
+
+func severity(level string) int {
+	switch level {
+	case "fatal", "panic", "dpanic":
+		return 2
+	case "error":
+		return 3
+	case "warn":
+		return 4
+	case "debug":
+		return 7
+	default:
+		return 6
+	}
+}
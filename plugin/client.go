@@ -0,0 +1,206 @@
+package plugin
+
+import (
+	"bufio"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"github.com/pkg/errors"
+	"io"
+	"net"
+	"net/rpc"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// A connection to a running plugin process. The client implements the Driver interface
+// by making RPC calls to the plugin.
+type Client struct {
+	Name string
+
+	cmd *exec.Cmd
+	rpc *rpc.Client
+	mu  sync.Mutex
+}
+
+var _ Driver = (*Client)(nil)
+
+// Launches the plugin binary at the given path and connects to it. The plugin must
+// complete the handshake within ten seconds or it will be killed.
+func Launch(name string, path string, args ...string) (*Client, error) {
+	b := make([]byte, secretSize)
+	if _, err := rand.Read(b); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	secret := hex.EncodeToString(b)
+
+	cmd := exec.Command(path, args...)
+	cmd.Env = append(os.Environ(), MagicCookieKey+"="+MagicCookieValue, SecretKey+"="+secret)
+	cmd.Stderr = os.Stderr
+
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	if err := cmd.Start(); err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	line := make(chan string, 1)
+	go func() {
+		r := bufio.NewReader(stdout)
+		l, _ := r.ReadString('\n')
+		line <- strings.TrimSpace(l)
+	}()
+
+	var handshake string
+	select {
+	case handshake = <-line:
+	case <-time.After(time.Second * 10):
+		cmd.Process.Kill()
+		return nil, errors.New(fmt.Sprintf("plugin %s did not complete the handshake in time", name))
+	}
+
+	parts := strings.SplitN(handshake, "|", 3)
+	if len(parts) != 3 {
+		cmd.Process.Kill()
+		return nil, errors.New(fmt.Sprintf("plugin %s returned an invalid handshake: %s", name, handshake))
+	}
+
+	if v, _ := strconv.Atoi(parts[0]); v != ProtocolVersion {
+		cmd.Process.Kill()
+		return nil, errors.New(fmt.Sprintf("plugin %s uses protocol version %s, expected %d", name, parts[0], ProtocolVersion))
+	}
+
+	conn, err := dial(parts[1], parts[2], secret)
+	if err != nil {
+		cmd.Process.Kill()
+		return nil, errors.Wrap(err, fmt.Sprintf("plugin %s", name))
+	}
+
+	return &Client{Name: name, cmd: cmd, rpc: rpc.NewClient(conn)}, nil
+}
+
+// Connects to a plugin and sends it the secret it was launched with, waiting for the plugin
+// to accept it before any requests are made.
+func dial(network string, address string, secret string) (net.Conn, error) {
+	conn, err := net.DialTimeout(network, address, handshakeTimeout)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	conn.SetDeadline(time.Now().Add(handshakeTimeout))
+
+	b := make([]byte, 1)
+	if _, err := conn.Write([]byte(secret)); err == nil {
+		_, err = io.ReadFull(conn, b)
+	}
+
+	if err != nil || b[0] != handshakeAccepted {
+		conn.Close()
+		return nil, errors.New("the plugin did not accept the secret it was launched with")
+	}
+
+	conn.SetDeadline(time.Time{})
+
+	return conn, nil
+}
+
+// Closes the connection to the plugin and terminates the process.
+func (c *Client) Close() error {
+	c.rpc.Close()
+
+	return c.cmd.Process.Kill()
+}
+
+func (c *Client) call(method string, args interface{}, reply interface{}) error {
+	if reply == nil {
+		reply = &Empty{}
+	}
+
+	if err := c.rpc.Call(rpcServiceName+"."+method, args, reply); err != nil {
+		return errors.Wrap(err, fmt.Sprintf("plugin %s", c.Name))
+	}
+
+	return nil
+}
+
+func (c *Client) Create(s Server) error {
+	return c.call("Create", &ServerArgs{Server: s}, nil)
+}
+
+func (c *Client) Exists(uuid string) (bool, error) {
+	var reply bool
+	err := c.call("Exists", &UuidArgs{Uuid: uuid}, &reply)
+
+	return reply, err
+}
+
+func (c *Client) IsRunning(uuid string) (bool, error) {
+	var reply bool
+	err := c.call("IsRunning", &UuidArgs{Uuid: uuid}, &reply)
+
+	return reply, err
+}
+
+func (c *Client) Start(s Server) error {
+	return c.call("Start", &ServerArgs{Server: s}, nil)
+}
+
+func (c *Client) Stop(uuid string) error {
+	return c.call("Stop", &UuidArgs{Uuid: uuid}, nil)
+}
+
+func (c *Client) Terminate(uuid string, signal syscall.Signal) error {
+	return c.call("Terminate", &TerminateArgs{Uuid: uuid, Signal: int(signal)}, nil)
+}
+
+func (c *Client) Destroy(uuid string) error {
+	return c.call("Destroy", &UuidArgs{Uuid: uuid}, nil)
+}
+
+func (c *Client) InSituUpdate(s Server) error {
+	return c.call("InSituUpdate", &ServerArgs{Server: s}, nil)
+}
+
+func (c *Client) ExitState(uuid string) (ExitState, error) {
+	var reply ExitState
+	err := c.call("ExitState", &UuidArgs{Uuid: uuid}, &reply)
+
+	return reply, err
+}
+
+func (c *Client) SendCommand(uuid string, command string) error {
+	return c.call("SendCommand", &CommandArgs{Uuid: uuid, Command: command}, nil)
+}
+
+func (c *Client) Readlog(uuid string, len int64) ([]string, error) {
+	var reply []string
+	err := c.call("Readlog", &ReadlogArgs{Uuid: uuid, Len: len}, &reply)
+
+	return reply, err
+}
+
+func (c *Client) Stats(uuid string) (Stats, error) {
+	var reply Stats
+	err := c.call("Stats", &UuidArgs{Uuid: uuid}, &reply)
+
+	return reply, err
+}
+
+func (c *Client) Events(uuid string, wait int) ([]Event, error) {
+	if wait <= 0 {
+		wait = defaultEventsWait
+	}
+
+	var reply []Event
+	err := c.call("Events", &EventsArgs{Uuid: uuid, Wait: wait}, &reply)
+
+	return reply, err
+}
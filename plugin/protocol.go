@@ -0,0 +1,135 @@
+package plugin
+
+import (
+	"syscall"
+	"time"
+)
+
+// The handshake values that must match between the daemon and a plugin process. The
+// cookie is not a security measure, it simply makes sure that a plugin binary that is
+// executed directly by a user prints a helpful message instead of hanging.
+const (
+	ProtocolVersion   = 2
+	MagicCookieKey    = "WINGS_PLUGIN_MAGIC_COOKIE"
+	MagicCookieValue  = "9c1e3e5a0d5b4b7f8a6f2e6c1d7a4b3e"
+	rpcServiceName    = "Plugin"
+	defaultEventsWait = 30
+)
+
+// A random secret is generated by the daemon each time it launches a plugin and passed to
+// it in this environment variable. The daemon sends the secret as soon as it connects, and
+// the plugin does not serve any requests on a connection until it has received it, so no
+// other process on the machine can connect to the plugin in place of the daemon.
+const (
+	SecretKey        = "WINGS_PLUGIN_SECRET"
+	secretSize       = 32
+	handshakeTimeout = time.Second * 10
+
+	// Sent by the plugin once it has accepted the secret.
+	handshakeAccepted = byte(1)
+)
+
+// Defines the event types that a plugin can emit for a server.
+const (
+	EventConsoleOutput = "console output"
+	EventExited        = "exited"
+)
+
+// The details about a server that are passed through to a plugin whenever it needs
+// to create or modify the environment for the server.
+type Server struct {
+	Uuid string
+
+	// The startup command with all of the variables already replaced.
+	Invocation string
+
+	// Environment variables in KEY=VALUE form.
+	Environment []string
+
+	// The absolute path to the data directory for the server on the host.
+	DataPath string
+
+	// The image defined for the server. Plugins are free to interpret this however makes
+	// sense for the runtime they provide.
+	Image string
+
+	Build       Build
+	Allocations map[string][]int
+}
+
+// Resource limits for a server. These match the build settings used by the daemon.
+type Build struct {
+	MemoryLimit int64
+	Swap        int64
+	IoWeight    uint16
+	CpuLimit    int64
+	DiskSpace   int64
+	Threads     string
+}
+
+// The exit state of the last process run for a server.
+type ExitState struct {
+	Code      uint32
+	OomKilled bool
+}
+
+// Current resource usage of a server process.
+type Stats struct {
+	Memory      uint64
+	MemoryLimit uint64
+	CpuAbsolute float64
+	RxBytes     uint64
+	TxBytes     uint64
+}
+
+// An event emitted by the plugin for a given server.
+type Event struct {
+	Type string
+	Data string
+}
+
+// The interface that a plugin must implement to provide an environment for servers.
+// Every method is called with the UUID of the server it is acting on, a single plugin
+// process handles every server on the node using that environment.
+type Driver interface {
+	// Creates the environment for the server if it does not already exist.
+	Create(s Server) error
+
+	// Determines if the environment for the server exists.
+	Exists(uuid string) (bool, error)
+
+	// Determines if the server process is currently running.
+	IsRunning(uuid string) (bool, error)
+
+	// Starts the server process.
+	Start(s Server) error
+
+	// Gracefully stops the server process. This is only called when the stop
+	// configuration for the server is not a console command.
+	Stop(uuid string) error
+
+	// Sends the given signal to the server process.
+	Terminate(uuid string, signal syscall.Signal) error
+
+	// Removes the environment for the server, terminating the process if needed.
+	Destroy(uuid string) error
+
+	// Applies updated resource limits to a running server.
+	InSituUpdate(s Server) error
+
+	// Returns the exit state of the last server process.
+	ExitState(uuid string) (ExitState, error)
+
+	// Writes a command to the stdin of the server process.
+	SendCommand(uuid string, command string) error
+
+	// Returns the last len bytes of console output for the server as lines.
+	Readlog(uuid string, len int64) ([]string, error)
+
+	// Returns the current resource usage of the server process.
+	Stats(uuid string) (Stats, error)
+
+	// Blocks until at least one event is available for the server, or until the given
+	// number of seconds has elapsed, and returns any events that are available.
+	Events(uuid string, wait int) ([]Event, error)
+}
@@ -0,0 +1,225 @@
+package plugin
+
+import (
+	"crypto/subtle"
+	"fmt"
+	"github.com/pkg/errors"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/rpc"
+	"os"
+	"path/filepath"
+	"runtime"
+	"syscall"
+	"time"
+)
+
+// Serves the given driver over RPC. This should be called from the main function of a
+// plugin binary and will block until the daemon closes the connection. The address the
+// plugin is listening on is written to stdout so that the daemon can connect to it.
+func Serve(d Driver) error {
+	if os.Getenv(MagicCookieKey) != MagicCookieValue {
+		fmt.Fprintln(os.Stderr, "This binary is a plugin for the Pterodactyl daemon and is not meant to be executed directly.")
+		os.Exit(1)
+	}
+
+	secret := os.Getenv(SecretKey)
+	if len(secret) != secretSize*2 {
+		return errors.New("the daemon did not provide a valid secret to the plugin")
+	}
+
+	// Processes started by the driver have no reason to know the secret.
+	os.Unsetenv(SecretKey)
+
+	l, err := listen()
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	defer l.Close()
+
+	s := rpc.NewServer()
+	if err := s.RegisterName(rpcServiceName, &rpcServer{driver: d}); err != nil {
+		return errors.WithStack(err)
+	}
+
+	// The handshake line is in the format of "version|network|address".
+	fmt.Printf("%d|%s|%s\n", ProtocolVersion, l.Addr().Network(), l.Addr().String())
+
+	conn, err := acceptDaemon(l, secret)
+	if err != nil {
+		return err
+	}
+
+	// Only a single connection from the daemon that launched us is ever expected, once
+	// it goes away there is no reason for this process to continue running.
+	l.Close()
+	s.ServeConn(conn)
+
+	return nil
+}
+
+// Accepts connections until one sends the secret the plugin was launched with, and returns
+// it. Every connection is checked in the background, so a process that connects and never
+// sends anything does not hold up the daemon.
+func acceptDaemon(l net.Listener, secret string) (net.Conn, error) {
+	accepted := make(chan net.Conn, 1)
+	failed := make(chan error, 1)
+
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				failed <- errors.WithStack(err)
+				return
+			}
+
+			go func(conn net.Conn) {
+				if !authenticate(conn, secret) {
+					conn.Close()
+					return
+				}
+
+				select {
+				case accepted <- conn:
+				default:
+					conn.Close()
+				}
+			}(conn)
+		}
+	}()
+
+	select {
+	case conn := <-accepted:
+		return conn, nil
+	case err := <-failed:
+		return nil, err
+	}
+}
+
+// Reads the secret from a new connection, letting the other side know if it matched.
+func authenticate(conn net.Conn, secret string) bool {
+	conn.SetDeadline(time.Now().Add(handshakeTimeout))
+	defer conn.SetDeadline(time.Time{})
+
+	b := make([]byte, len(secret))
+	if _, err := io.ReadFull(conn, b); err != nil {
+		return false
+	}
+
+	if subtle.ConstantTimeCompare(b, []byte(secret)) != 1 {
+		return false
+	}
+
+	_, err := conn.Write([]byte{handshakeAccepted})
+
+	return err == nil
+}
+
+// Listens on a unix socket where supported, otherwise on a random loopback port.
+func listen() (net.Listener, error) {
+	if runtime.GOOS == "windows" {
+		return net.Listen("tcp", "127.0.0.1:0")
+	}
+
+	d, err := ioutil.TempDir("", "wings-plugin")
+	if err != nil {
+		return nil, err
+	}
+
+	return net.Listen("unix", filepath.Join(d, "plugin.sock"))
+}
+
+type ServerArgs struct {
+	Server Server
+}
+
+type UuidArgs struct {
+	Uuid string
+}
+
+type TerminateArgs struct {
+	Uuid   string
+	Signal int
+}
+
+type CommandArgs struct {
+	Uuid    string
+	Command string
+}
+
+type ReadlogArgs struct {
+	Uuid string
+	Len  int64
+}
+
+type EventsArgs struct {
+	Uuid string
+	Wait int
+}
+
+type Empty struct{}
+
+// Exposes a driver over net/rpc. Each method matches the signature that package expects
+// and simply calls through to the driver.
+type rpcServer struct {
+	driver Driver
+}
+
+func (r *rpcServer) Create(args *ServerArgs, _ *Empty) error {
+	return r.driver.Create(args.Server)
+}
+
+func (r *rpcServer) Exists(args *UuidArgs, reply *bool) (err error) {
+	*reply, err = r.driver.Exists(args.Uuid)
+	return
+}
+
+func (r *rpcServer) IsRunning(args *UuidArgs, reply *bool) (err error) {
+	*reply, err = r.driver.IsRunning(args.Uuid)
+	return
+}
+
+func (r *rpcServer) Start(args *ServerArgs, _ *Empty) error {
+	return r.driver.Start(args.Server)
+}
+
+func (r *rpcServer) Stop(args *UuidArgs, _ *Empty) error {
+	return r.driver.Stop(args.Uuid)
+}
+
+func (r *rpcServer) Terminate(args *TerminateArgs, _ *Empty) error {
+	return r.driver.Terminate(args.Uuid, syscall.Signal(args.Signal))
+}
+
+func (r *rpcServer) Destroy(args *UuidArgs, _ *Empty) error {
+	return r.driver.Destroy(args.Uuid)
+}
+
+func (r *rpcServer) InSituUpdate(args *ServerArgs, _ *Empty) error {
+	return r.driver.InSituUpdate(args.Server)
+}
+
+func (r *rpcServer) ExitState(args *UuidArgs, reply *ExitState) (err error) {
+	*reply, err = r.driver.ExitState(args.Uuid)
+	return
+}
+
+func (r *rpcServer) SendCommand(args *CommandArgs, _ *Empty) error {
+	return r.driver.SendCommand(args.Uuid, args.Command)
+}
+
+func (r *rpcServer) Readlog(args *ReadlogArgs, reply *[]string) (err error) {
+	*reply, err = r.driver.Readlog(args.Uuid, args.Len)
+	return
+}
+
+func (r *rpcServer) Stats(args *UuidArgs, reply *Stats) (err error) {
+	*reply, err = r.driver.Stats(args.Uuid)
+	return
+}
+
+func (r *rpcServer) Events(args *EventsArgs, reply *[]Event) (err error) {
+	*reply, err = r.driver.Events(args.Uuid, args.Wait)
+	return
+}
@@ -0,0 +1,233 @@
+package proxyproto
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"github.com/pkg/errors"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// The signature that every version 2 PROXY protocol header begins with.
+var v2Signature = []byte("\r\n\r\n\x00\r\nQUIT\n")
+
+// The maximum length of a version 1 header, including the trailing CRLF.
+const v1MaxLength = 107
+
+// The amount of time a client has to send the PROXY protocol header before the
+// connection is treated as having failed.
+const headerTimeout = time.Second * 10
+
+// Wraps a listener so that connections from trusted sources have any PROXY protocol
+// header stripped off and parsed, with the source address in the header being used as
+// the remote address of the connection.
+type Listener struct {
+	net.Listener
+
+	trusted []*net.IPNet
+}
+
+// Returns a new listener that understands the PROXY protocol. Headers are only accepted
+// from connections originating in one of the trusted CIDR ranges, if no ranges are given
+// then headers are not accepted from any source.
+func NewListener(l net.Listener, trusted []string) (*Listener, error) {
+	pl := &Listener{Listener: l}
+
+	for _, t := range trusted {
+		if !strings.Contains(t, "/") {
+			if strings.Contains(t, ":") {
+				t += "/128"
+			} else {
+				t += "/32"
+			}
+		}
+
+		_, n, err := net.ParseCIDR(t)
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+
+		pl.trusted = append(pl.trusted, n)
+	}
+
+	return pl, nil
+}
+
+// Accepts the next connection on the listener. The PROXY protocol header is not read
+// until the connection is first used, so a slow client cannot block other connections
+// from being accepted.
+func (l *Listener) Accept() (net.Conn, error) {
+	c, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+
+	if !l.isTrusted(c.RemoteAddr()) {
+		return c, nil
+	}
+
+	return &Conn{Conn: c, r: bufio.NewReader(c)}, nil
+}
+
+// Determines if the given address is allowed to send a PROXY protocol header.
+func (l *Listener) isTrusted(addr net.Addr) bool {
+	tcp, ok := addr.(*net.TCPAddr)
+	if !ok {
+		return false
+	}
+
+	for _, n := range l.trusted {
+		if n.Contains(tcp.IP) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// A connection that may begin with a PROXY protocol header.
+type Conn struct {
+	net.Conn
+
+	r      *bufio.Reader
+	once   sync.Once
+	err    error
+	remote net.Addr
+}
+
+// Reads the PROXY protocol header from the connection if it has not yet been done.
+// Connections that do not begin with a header are passed through untouched.
+func (c *Conn) init() {
+	c.once.Do(func() {
+		c.Conn.SetReadDeadline(time.Now().Add(headerTimeout))
+		defer c.Conn.SetReadDeadline(time.Time{})
+
+		c.remote, c.err = readHeader(c.r)
+	})
+}
+
+func (c *Conn) Read(b []byte) (int, error) {
+	c.init()
+	if c.err != nil {
+		return 0, c.err
+	}
+
+	return c.r.Read(b)
+}
+
+// Returns the address of the client as reported by the proxy, or the actual remote
+// address of the connection if no header was sent.
+func (c *Conn) RemoteAddr() net.Addr {
+	c.init()
+	if c.remote != nil {
+		return c.remote
+	}
+
+	return c.Conn.RemoteAddr()
+}
+
+// Reads a version 1 or 2 header from the reader. A nil address is returned if there
+// is no header, or if the header does not contain a usable source address.
+func readHeader(r *bufio.Reader) (net.Addr, error) {
+	// Only look at the first byte initially, otherwise a client that sends a very short
+	// first message and then waits for a response would block here.
+	first, err := r.Peek(1)
+	if err != nil {
+		return nil, nil
+	}
+
+	switch first[0] {
+	case v2Signature[0]:
+		if b, err := r.Peek(len(v2Signature)); err == nil && bytes.Equal(b, v2Signature) {
+			return readV2Header(r)
+		}
+	case 'P':
+		if b, err := r.Peek(6); err == nil && string(b) == "PROXY " {
+			return readV1Header(r)
+		}
+	}
+
+	return nil, nil
+}
+
+// Parses a human readable version 1 header, e.g. "PROXY TCP4 1.2.3.4 5.6.7.8 1234 80".
+func readV1Header(r *bufio.Reader) (net.Addr, error) {
+	var line []byte
+	for len(line) < v1MaxLength {
+		b, err := r.ReadByte()
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+
+		line = append(line, b)
+		if bytes.HasSuffix(line, []byte("\r\n")) {
+			break
+		}
+	}
+
+	if !bytes.HasSuffix(line, []byte("\r\n")) {
+		return nil, errors.New("proxyproto: v1 header exceeds the maximum length")
+	}
+
+	parts := strings.Split(strings.TrimSpace(string(line)), " ")
+	if len(parts) >= 2 && parts[1] == "UNKNOWN" {
+		return nil, nil
+	}
+
+	if len(parts) != 6 || (parts[1] != "TCP4" && parts[1] != "TCP6") {
+		return nil, errors.New("proxyproto: malformed v1 header")
+	}
+
+	ip := net.ParseIP(parts[2])
+	port, err := strconv.Atoi(parts[4])
+	if ip == nil || err != nil || port < 0 || port > 65535 {
+		return nil, errors.New("proxyproto: invalid source address in v1 header")
+	}
+
+	return &net.TCPAddr{IP: ip, Port: port}, nil
+}
+
+// Parses a binary version 2 header.
+func readV2Header(r *bufio.Reader) (net.Addr, error) {
+	header := make([]byte, 16)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	if header[12]>>4 != 2 {
+		return nil, errors.New("proxyproto: unsupported v2 header version")
+	}
+
+	payload := make([]byte, binary.BigEndian.Uint16(header[14:16]))
+	if _, err := io.ReadFull(r, payload); err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	// The LOCAL command is used by proxies for health checks, the connection should be
+	// treated as coming from the proxy itself.
+	if header[12]&0x0f == 0 {
+		return nil, nil
+	}
+
+	switch header[13] >> 4 {
+	case 1:
+		if len(payload) < 12 {
+			return nil, errors.New("proxyproto: truncated v2 IPv4 address block")
+		}
+
+		return &net.TCPAddr{IP: net.IP(payload[0:4]), Port: int(binary.BigEndian.Uint16(payload[8:10]))}, nil
+	case 2:
+		if len(payload) < 36 {
+			return nil, errors.New("proxyproto: truncated v2 IPv6 address block")
+		}
+
+		return &net.TCPAddr{IP: net.IP(payload[0:16]), Port: int(binary.BigEndian.Uint16(payload[32:34]))}, nil
+	default:
+		return nil, nil
+	}
+}
@@ -0,0 +1,123 @@
+package pubsub
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"github.com/pkg/errors"
+	"net"
+	"strings"
+	"time"
+)
+
+// Publishes messages to a NATS server using the core NATS protocol.
+//
+// @see https://docs.nats.io/nats-protocol/nats-protocol
+type natsPublisher struct {
+	conn
+	username string
+	password string
+}
+
+func (p *natsPublisher) Publish(subject string, data []byte) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	c, err := p.get(p.handshake)
+	if err != nil {
+		return err
+	}
+
+	c.SetWriteDeadline(time.Now().Add(timeout))
+
+	msg := make([]byte, 0, len(subject)+len(data)+32)
+	msg = append(msg, fmt.Sprintf("PUB %s %d\r\n", subject, len(data))...)
+	msg = append(msg, data...)
+	msg = append(msg, "\r\n"...)
+
+	if _, err := c.Write(msg); err != nil {
+		p.drop()
+
+		return errors.WithStack(err)
+	}
+
+	return nil
+}
+
+// Reads the INFO message sent by the server and identifies this client. The server is
+// then pinged to confirm that the connection was accepted.
+func (p *natsPublisher) handshake(c net.Conn) error {
+	r := bufio.NewReader(c)
+
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	if !strings.HasPrefix(line, "INFO ") {
+		return errors.New("pubsub: unexpected greeting from nats server: " + strings.TrimSpace(line))
+	}
+
+	opts := map[string]interface{}{
+		"verbose":  false,
+		"pedantic": false,
+		"name":     "wings",
+		"lang":     "go",
+	}
+	if p.username != "" {
+		opts["user"] = p.username
+		opts["pass"] = p.password
+	} else if p.password != "" {
+		opts["auth_token"] = p.password
+	}
+
+	b, err := json.Marshal(opts)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	if _, err := c.Write([]byte("CONNECT " + string(b) + "\r\nPING\r\n")); err != nil {
+		return errors.WithStack(err)
+	}
+
+	line, err = r.ReadString('\n')
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	if strings.TrimSpace(line) != "PONG" {
+		return errors.New("pubsub: nats server rejected connection: " + strings.TrimSpace(line))
+	}
+
+	// The server periodically sends a PING and closes connections that do not respond,
+	// and reports errors asynchronously, so the connection has to be read from for as
+	// long as it is open.
+	go p.readLoop(c, r)
+
+	return nil
+}
+
+func (p *natsPublisher) readLoop(c net.Conn, r *bufio.Reader) {
+	for {
+		line, err := r.ReadString('\n')
+		// The server closes the connection after sending an error, so stop using it.
+		if err != nil || strings.HasPrefix(line, "-ERR") {
+			break
+		}
+
+		if strings.HasPrefix(line, "PING") {
+			p.mu.Lock()
+			if p.c == c {
+				c.SetWriteDeadline(time.Now().Add(timeout))
+				c.Write([]byte("PONG\r\n"))
+			}
+			p.mu.Unlock()
+		}
+	}
+
+	p.mu.Lock()
+	if p.c == c {
+		p.drop()
+	}
+	p.mu.Unlock()
+}
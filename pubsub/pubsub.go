@@ -0,0 +1,82 @@
+package pubsub
+
+import (
+	"github.com/pkg/errors"
+	"net"
+	"sync"
+	"time"
+)
+
+// How long to wait when connecting to, or writing to, the server.
+const timeout = time.Second * 10
+
+// Publishes messages to channels on a pub/sub server. Publishers connect lazily and will
+// reconnect on the next publish if the connection is lost.
+type Publisher interface {
+	Publish(channel string, data []byte) error
+	Close() error
+}
+
+// Returns a publisher for the given driver, which must be either "nats" or "redis".
+func New(driver string, address string, username string, password string) (Publisher, error) {
+	switch driver {
+	case "nats":
+		return &natsPublisher{conn: conn{address: address}, username: username, password: password}, nil
+	case "redis":
+		return &redisPublisher{conn: conn{address: address}, username: username, password: password}, nil
+	}
+
+	return nil, errors.New("pubsub: unknown driver " + driver)
+}
+
+// A connection that is established when first needed and dropped after any error so that
+// it can be established again.
+type conn struct {
+	mu      sync.Mutex
+	address string
+	c       net.Conn
+}
+
+// Returns the current connection, dialing a new one if needed. The handshake function is
+// called for new connections before they are used. The lock must be held.
+func (c *conn) get(handshake func(net.Conn) error) (net.Conn, error) {
+	if c.c != nil {
+		return c.c, nil
+	}
+
+	nc, err := net.DialTimeout("tcp", c.address, timeout)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	nc.SetDeadline(time.Now().Add(timeout))
+	if err := handshake(nc); err != nil {
+		nc.Close()
+
+		return nil, err
+	}
+	nc.SetDeadline(time.Time{})
+
+	c.c = nc
+
+	return nc, nil
+}
+
+// Closes the current connection, if there is one. The lock must be held.
+func (c *conn) drop() error {
+	if c.c == nil {
+		return nil
+	}
+
+	err := c.c.Close()
+	c.c = nil
+
+	return err
+}
+
+func (c *conn) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.drop()
+}
@@ -0,0 +1,79 @@
+package pubsub
+
+import (
+	"bufio"
+	"fmt"
+	"github.com/pkg/errors"
+	"net"
+	"strings"
+	"time"
+)
+
+// Publishes messages to a Redis server using the PUBLISH command.
+//
+// @see https://redis.io/topics/protocol
+type redisPublisher struct {
+	conn
+	username string
+	password string
+	reader   *bufio.Reader
+}
+
+func (p *redisPublisher) Publish(channel string, data []byte) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	c, err := p.get(p.handshake)
+	if err != nil {
+		return err
+	}
+
+	c.SetDeadline(time.Now().Add(timeout))
+	if err := p.command(c, "PUBLISH", channel, string(data)); err != nil {
+		p.drop()
+
+		return err
+	}
+
+	return nil
+}
+
+// Authenticates with the server if a password has been configured.
+func (p *redisPublisher) handshake(c net.Conn) error {
+	p.reader = bufio.NewReader(c)
+
+	if p.password == "" {
+		return nil
+	}
+
+	if p.username != "" {
+		return p.command(c, "AUTH", p.username, p.password)
+	}
+
+	return p.command(c, "AUTH", p.password)
+}
+
+// Sends a command to the server and reads the reply, returning an error if the server
+// replied with one.
+func (p *redisPublisher) command(c net.Conn, args ...string) error {
+	var b strings.Builder
+	fmt.Fprintf(&b, "*%d\r\n", len(args))
+	for _, a := range args {
+		fmt.Fprintf(&b, "$%d\r\n%s\r\n", len(a), a)
+	}
+
+	if _, err := c.Write([]byte(b.String())); err != nil {
+		return errors.WithStack(err)
+	}
+
+	line, err := p.reader.ReadString('\n')
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	if strings.HasPrefix(line, "-") {
+		return errors.New("pubsub: redis returned an error: " + strings.TrimSpace(line[1:]))
+	}
+
+	return nil
+}
@@ -0,0 +1,116 @@
+package query
+
+import (
+	"bytes"
+	"encoding/binary"
+	"github.com/pkg/errors"
+	"io"
+	"net"
+	"time"
+)
+
+func init() {
+	Register("a2s", QueryA2S)
+}
+
+var a2sInfoRequest = append([]byte{0xFF, 0xFF, 0xFF, 0xFF, 'T'}, []byte("Source Engine Query\x00")...)
+
+const (
+	a2sInfoResponse      = 'I'
+	a2sChallengeResponse = 'A'
+)
+
+// Queries a server using the Source engine A2S_INFO request. Servers that require a
+// challenge are sent the request a second time with the challenge appended.
+//
+// @see https://developer.valvesoftware.com/wiki/Server_queries#A2S_INFO
+func QueryA2S(address string, timeout time.Duration) (*Result, error) {
+	conn, err := net.DialTimeout("udp", address, timeout)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	defer conn.Close()
+
+	conn.SetDeadline(time.Now().Add(timeout))
+
+	resp, err := a2sRequest(conn, a2sInfoRequest)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp[0] == a2sChallengeResponse {
+		if len(resp) < 5 {
+			return nil, errors.New("a2s: truncated challenge response")
+		}
+
+		resp, err = a2sRequest(conn, append(append([]byte{}, a2sInfoRequest...), resp[1:5]...))
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if resp[0] != a2sInfoResponse {
+		return nil, errors.New("a2s: unexpected response type")
+	}
+
+	return parseA2SInfo(resp[1:])
+}
+
+// Sends a request and returns the response payload with the packet header removed.
+// Split responses are not supported since A2S_INFO responses always fit in a single
+// packet in practice.
+func a2sRequest(conn net.Conn, req []byte) ([]byte, error) {
+	if _, err := conn.Write(req); err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	buf := make([]byte, 1400)
+	n, err := conn.Read(buf)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	if n < 5 || !bytes.Equal(buf[:4], []byte{0xFF, 0xFF, 0xFF, 0xFF}) {
+		return nil, errors.New("a2s: invalid or split response packet")
+	}
+
+	return buf[4:n], nil
+}
+
+// Parses the body of an A2S_INFO response.
+func parseA2SInfo(b []byte) (*Result, error) {
+	r := bytes.NewBuffer(b)
+
+	// Protocol version, not used.
+	if _, err := r.ReadByte(); err != nil {
+		return nil, errors.New("a2s: truncated info response")
+	}
+
+	var fields [4]string
+	for i := range fields {
+		s, err := r.ReadString(0)
+		if err != nil {
+			return nil, errors.New("a2s: truncated info response")
+		}
+
+		fields[i] = s[:len(s)-1]
+	}
+
+	// The application ID, followed by the player counts.
+	var id uint16
+	if err := binary.Read(r, binary.LittleEndian, &id); err != nil {
+		return nil, errors.New("a2s: truncated info response")
+	}
+
+	counts := make([]byte, 2)
+	if _, err := io.ReadFull(r, counts); err != nil {
+		return nil, errors.New("a2s: truncated info response")
+	}
+
+	return &Result{
+		Name:       fields[0],
+		Map:        fields[1],
+		Players:    int(counts[0]),
+		MaxPlayers: int(counts[1]),
+	}, nil
+}
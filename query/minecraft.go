@@ -0,0 +1,224 @@
+package query
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"github.com/pkg/errors"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+func init() {
+	Register("minecraft", QueryMinecraft)
+	Register("bedrock", QueryBedrock)
+}
+
+// The magic bytes included in every RakNet offline message.
+var raknetMagic = []byte{0x00, 0xFF, 0xFF, 0x00, 0xFE, 0xFE, 0xFE, 0xFE, 0xFD, 0xFD, 0xFD, 0xFD, 0x12, 0x34, 0x56, 0x78}
+
+// The response to a Java edition status request. Only the fields that are used are
+// defined here.
+type minecraftStatus struct {
+	Version struct {
+		Name string `json:"name"`
+	} `json:"version"`
+	Players struct {
+		Max    int `json:"max"`
+		Online int `json:"online"`
+	} `json:"players"`
+	Description json.RawMessage `json:"description"`
+}
+
+// Queries a Minecraft Java edition server using the server list ping protocol.
+//
+// @see https://wiki.vg/Server_List_Ping
+func QueryMinecraft(address string, timeout time.Duration) (*Result, error) {
+	host, portStr, err := net.SplitHostPort(address)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	port, _ := strconv.Atoi(portStr)
+
+	conn, err := net.DialTimeout("tcp", address, timeout)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	defer conn.Close()
+
+	conn.SetDeadline(time.Now().Add(timeout))
+
+	// The handshake packet, using a protocol version of -1 since the server version is
+	// not known ahead of time, followed by a request for the server status.
+	handshake := new(bytes.Buffer)
+	writeVarInt(handshake, 0x00)
+	writeVarInt(handshake, -1)
+	writeVarInt(handshake, int32(len(host)))
+	handshake.WriteString(host)
+	binary.Write(handshake, binary.BigEndian, uint16(port))
+	writeVarInt(handshake, 1)
+
+	packet := new(bytes.Buffer)
+	writeVarInt(packet, int32(handshake.Len()))
+	packet.Write(handshake.Bytes())
+	packet.Write([]byte{0x01, 0x00})
+
+	if _, err := conn.Write(packet.Bytes()); err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	r := bufio.NewReader(conn)
+	if _, err := readVarInt(r); err != nil {
+		return nil, err
+	}
+
+	if id, err := readVarInt(r); err != nil {
+		return nil, err
+	} else if id != 0x00 {
+		return nil, errors.New("minecraft: unexpected response packet")
+	}
+
+	l, err := readVarInt(r)
+	if err != nil {
+		return nil, err
+	}
+
+	if l < 0 || l > 1<<20 {
+		return nil, errors.New("minecraft: invalid status response length")
+	}
+
+	b := make([]byte, l)
+	if _, err := io.ReadFull(r, b); err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	var status minecraftStatus
+	if err := json.Unmarshal(b, &status); err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	return &Result{
+		Motd:       parseMinecraftDescription(status.Description),
+		Version:    status.Version.Name,
+		Players:    status.Players.Online,
+		MaxPlayers: status.Players.Max,
+	}, nil
+}
+
+// The description of a server can either be a plain string or a chat component. For
+// chat components the text of the component and any children is joined together.
+func parseMinecraftDescription(raw json.RawMessage) string {
+	var s string
+	if err := json.Unmarshal(raw, &s); err == nil {
+		return s
+	}
+
+	var c struct {
+		Text  string            `json:"text"`
+		Extra []json.RawMessage `json:"extra"`
+	}
+	if err := json.Unmarshal(raw, &c); err != nil {
+		return ""
+	}
+
+	out := c.Text
+	for _, e := range c.Extra {
+		out += parseMinecraftDescription(e)
+	}
+
+	return out
+}
+
+// Queries a Minecraft Bedrock edition server using a RakNet unconnected ping.
+func QueryBedrock(address string, timeout time.Duration) (*Result, error) {
+	conn, err := net.DialTimeout("udp", address, timeout)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	defer conn.Close()
+
+	conn.SetDeadline(time.Now().Add(timeout))
+
+	req := new(bytes.Buffer)
+	req.WriteByte(0x01)
+	binary.Write(req, binary.BigEndian, time.Now().UnixNano()/int64(time.Millisecond))
+	req.Write(raknetMagic)
+	binary.Write(req, binary.BigEndian, int64(0))
+
+	if _, err := conn.Write(req.Bytes()); err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	buf := make([]byte, 1500)
+	n, err := conn.Read(buf)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	// Unconnected pong: id, time, server guid, magic, and then the length prefixed
+	// server id string.
+	if n < 35 || buf[0] != 0x1C {
+		return nil, errors.New("bedrock: invalid pong response")
+	}
+
+	l := int(binary.BigEndian.Uint16(buf[33:35]))
+	if 35+l > n {
+		return nil, errors.New("bedrock: truncated pong response")
+	}
+
+	// The server id is in the format of "MCPE;motd;protocol;version;players;max;...".
+	parts := strings.Split(string(buf[35:35+l]), ";")
+	if len(parts) < 6 {
+		return nil, errors.New("bedrock: malformed server id in pong response")
+	}
+
+	players, _ := strconv.Atoi(parts[4])
+	max, _ := strconv.Atoi(parts[5])
+
+	res := &Result{
+		Motd:       parts[1],
+		Version:    parts[3],
+		Players:    players,
+		MaxPlayers: max,
+	}
+
+	if len(parts) > 7 {
+		res.Map = parts[7]
+	}
+
+	return res, nil
+}
+
+func writeVarInt(w *bytes.Buffer, v int32) {
+	u := uint32(v)
+	for {
+		if u&^0x7F == 0 {
+			w.WriteByte(byte(u))
+			return
+		}
+
+		w.WriteByte(byte(u&0x7F | 0x80))
+		u >>= 7
+	}
+}
+
+func readVarInt(r io.ByteReader) (int32, error) {
+	var out uint32
+	for i := uint(0); i < 5; i++ {
+		b, err := r.ReadByte()
+		if err != nil {
+			return 0, errors.WithStack(err)
+		}
+
+		out |= uint32(b&0x7F) << (7 * i)
+		if b&0x80 == 0 {
+			return int32(out), nil
+		}
+	}
+
+	return 0, errors.New("minecraft: varint is too long")
+}
@@ -0,0 +1,62 @@
+package query
+
+import (
+	"fmt"
+	"github.com/pkg/errors"
+	"sort"
+	"sync"
+	"time"
+)
+
+// The status information returned by querying a game server. Not every provider is
+// able to return every field, in which case they are left empty.
+type Result struct {
+	Name       string `json:"name,omitempty"`
+	Map        string `json:"map,omitempty"`
+	Motd       string `json:"motd,omitempty"`
+	Version    string `json:"version,omitempty"`
+	Players    int    `json:"players"`
+	MaxPlayers int    `json:"max_players"`
+}
+
+// A function that queries the game server listening at the given address and returns
+// its current status.
+type Provider func(address string, timeout time.Duration) (*Result, error)
+
+var providersMutex sync.RWMutex
+var providers = map[string]Provider{}
+
+// Registers a query provider using the given name.
+func Register(name string, provider Provider) {
+	providersMutex.Lock()
+	defer providersMutex.Unlock()
+
+	providers[name] = provider
+}
+
+// Returns the names of every registered query provider.
+func Providers() []string {
+	providersMutex.RLock()
+	defer providersMutex.RUnlock()
+
+	var out []string
+	for k := range providers {
+		out = append(out, k)
+	}
+	sort.Strings(out)
+
+	return out
+}
+
+// Queries the server at the given address using the named provider.
+func Query(name string, address string, timeout time.Duration) (*Result, error) {
+	providersMutex.RLock()
+	provider, ok := providers[name]
+	providersMutex.RUnlock()
+
+	if !ok {
+		return nil, errors.New(fmt.Sprintf("no query provider registered with the name \"%s\"", name))
+	}
+
+	return provider(address, timeout)
+}
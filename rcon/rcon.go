@@ -0,0 +1,114 @@
+package rcon
+
+import (
+	"bytes"
+	"encoding/binary"
+	"github.com/pkg/errors"
+	"io"
+	"net"
+	"time"
+)
+
+// Packet types used by the Source RCON protocol. Minecraft and most other games that
+// support RCON use this same protocol.
+//
+// @see https://developer.valvesoftware.com/wiki/Source_RCON_Protocol
+const (
+	packetResponse = 0
+	packetCommand  = 2
+	packetAuth     = 3
+)
+
+// The largest packet body a server is allowed to send.
+const maxPacketSize = 4096
+
+type invalidPasswordError struct {
+}
+
+func (e *invalidPasswordError) Error() string {
+	return "rcon: invalid password"
+}
+
+func IsInvalidPasswordError(err error) bool {
+	_, ok := err.(*invalidPasswordError)
+
+	return ok
+}
+
+// Connects to the RCON server at the given address, authenticates, runs the command and
+// returns the response from the server.
+func Execute(address string, password string, command string, timeout time.Duration) (string, error) {
+	conn, err := net.DialTimeout("tcp", address, timeout)
+	if err != nil {
+		return "", errors.WithStack(err)
+	}
+	defer conn.Close()
+
+	conn.SetDeadline(time.Now().Add(timeout))
+
+	if err := write(conn, 1, packetAuth, password); err != nil {
+		return "", err
+	}
+
+	// Source servers send an empty response packet before the auth response, while other
+	// implementations only send the auth response, so skip anything that is not it.
+	for {
+		id, typ, _, err := read(conn)
+		if err != nil {
+			return "", err
+		}
+
+		if typ != packetResponse {
+			if id == -1 {
+				return "", &invalidPasswordError{}
+			}
+
+			break
+		}
+	}
+
+	if err := write(conn, 2, packetCommand, command); err != nil {
+		return "", err
+	}
+
+	_, _, body, err := read(conn)
+	if err != nil {
+		return "", err
+	}
+
+	return body, nil
+}
+
+func write(w io.Writer, id int32, typ int32, body string) error {
+	b := new(bytes.Buffer)
+	binary.Write(b, binary.LittleEndian, int32(len(body)+10))
+	binary.Write(b, binary.LittleEndian, id)
+	binary.Write(b, binary.LittleEndian, typ)
+	b.WriteString(body)
+	b.Write([]byte{0x00, 0x00})
+
+	_, err := w.Write(b.Bytes())
+
+	return errors.WithStack(err)
+}
+
+func read(r io.Reader) (int32, int32, string, error) {
+	var size, id, typ int32
+	if err := binary.Read(r, binary.LittleEndian, &size); err != nil {
+		return 0, 0, "", errors.WithStack(err)
+	}
+
+	if size < 10 || size > maxPacketSize+10 {
+		return 0, 0, "", errors.New("rcon: invalid packet size received")
+	}
+
+	b := make([]byte, size)
+	if _, err := io.ReadFull(r, b); err != nil {
+		return 0, 0, "", errors.WithStack(err)
+	}
+
+	id = int32(binary.LittleEndian.Uint32(b[0:4]))
+	typ = int32(binary.LittleEndian.Uint32(b[4:8]))
+
+	return id, typ, string(bytes.TrimRight(b[8:], "\x00")), nil
+}
@@ -0,0 +1,246 @@
+package router
+
+import (
+	"compress/gzip"
+	"github.com/gin-gonic/gin"
+	"github.com/klauspost/compress/zstd"
+	"github.com/pterodactyl/wings/config"
+	"go.uber.org/zap"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// Types of content that are already compressed, so compressing them again only wastes
+// time on the node.
+var incompressibleTypes = []string{
+	"image/",
+	"video/",
+	"audio/",
+	"font/woff",
+	"application/gzip",
+	"application/x-gzip",
+	"application/zip",
+	"application/zstd",
+	"application/x-bzip2",
+	"application/x-xz",
+	"application/x-7z-compressed",
+	"application/x-rar-compressed",
+	"application/vnd.rar",
+	"text/event-stream",
+}
+
+// Compresses responses using zstd or gzip when the client supports it. Responses are only
+// compressed once they are larger than the configured minimum size, and responses that are
+// streamed, partial, or already compressed are left alone.
+func CompressionMiddleware(c *gin.Context) {
+	cfg := config.Get().Api.Compression
+	if !cfg.Enabled || c.Request.Method == http.MethodHead || c.GetHeader("Range") != "" || c.GetHeader("Upgrade") != "" {
+		c.Next()
+		return
+	}
+
+	encoding := negotiateEncoding(c.GetHeader("Accept-Encoding"), cfg.Zstd)
+	if encoding == "" {
+		c.Next()
+		return
+	}
+
+	w := &compressWriter{ResponseWriter: c.Writer, encoding: encoding, level: cfg.Level, minSize: cfg.MinSize}
+	c.Writer = w
+	defer w.finish()
+
+	c.Next()
+}
+
+// Returns the encoding that should be used for a response based on the Accept-Encoding
+// header of the request, preferring zstd when it is allowed.
+func negotiateEncoding(header string, allowZstd bool) string {
+	accepted := make(map[string]bool)
+	for _, part := range strings.Split(header, ",") {
+		fields := strings.Split(part, ";")
+		name := strings.ToLower(strings.TrimSpace(fields[0]))
+
+		q := 1.0
+		for _, f := range fields[1:] {
+			f = strings.TrimSpace(f)
+			if strings.HasPrefix(f, "q=") {
+				if v, err := strconv.ParseFloat(f[2:], 64); err == nil {
+					q = v
+				}
+			}
+		}
+
+		accepted[name] = q > 0
+	}
+
+	if allowZstd && accepted["zstd"] {
+		return "zstd"
+	}
+
+	if accepted["gzip"] {
+		return "gzip"
+	}
+
+	return ""
+}
+
+func compressible(contentType string) bool {
+	ct := strings.ToLower(strings.TrimSpace(strings.SplitN(contentType, ";", 2)[0]))
+	if ct == "image/svg+xml" {
+		return true
+	}
+
+	for _, t := range incompressibleTypes {
+		if strings.HasPrefix(ct, t) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// Wraps the response writer so that the response is buffered until it is large enough to
+// be worth compressing, at which point the headers are sent and the rest of the response is
+// compressed as it is written.
+type compressWriter struct {
+	gin.ResponseWriter
+	encoding string
+	level    int
+	minSize  int
+
+	status  int
+	buf     []byte
+	decided bool
+	enc     io.WriteCloser
+}
+
+func (w *compressWriter) WriteHeader(code int) {
+	if w.decided {
+		w.ResponseWriter.WriteHeader(code)
+		return
+	}
+
+	w.status = code
+}
+
+func (w *compressWriter) WriteHeaderNow() {
+	if !w.decided {
+		w.decide()
+	}
+}
+
+func (w *compressWriter) Status() int {
+	if !w.decided && w.status != 0 {
+		return w.status
+	}
+
+	return w.ResponseWriter.Status()
+}
+
+func (w *compressWriter) Written() bool {
+	return w.decided && w.ResponseWriter.Written()
+}
+
+func (w *compressWriter) Write(b []byte) (int, error) {
+	if w.decided {
+		if w.enc != nil {
+			return w.enc.Write(b)
+		}
+
+		return w.ResponseWriter.Write(b)
+	}
+
+	w.buf = append(w.buf, b...)
+	if len(w.buf) >= w.minSize {
+		if err := w.decide(); err != nil {
+			return 0, err
+		}
+	}
+
+	return len(b), nil
+}
+
+func (w *compressWriter) WriteString(s string) (int, error) {
+	return w.Write([]byte(s))
+}
+
+// Sends anything that has been buffered so that streamed responses reach the client.
+func (w *compressWriter) Flush() {
+	if !w.decided {
+		w.decide()
+	}
+
+	if f, ok := w.enc.(interface{ Flush() error }); ok {
+		f.Flush()
+	}
+
+	w.ResponseWriter.Flush()
+}
+
+// Determines if the response should be compressed, sends the headers, and then writes
+// out anything that has been buffered so far.
+func (w *compressWriter) decide() error {
+	w.decided = true
+
+	h := w.Header()
+	if h.Get("Content-Type") == "" && len(w.buf) > 0 {
+		h.Set("Content-Type", http.DetectContentType(w.buf))
+	}
+
+	status := w.status
+	if status == 0 {
+		status = http.StatusOK
+	}
+
+	ok := len(w.buf) >= w.minSize &&
+		status != http.StatusNoContent &&
+		status != http.StatusNotModified &&
+		status != http.StatusPartialContent &&
+		h.Get("Content-Encoding") == "" &&
+		compressible(h.Get("Content-Type"))
+
+	if ok {
+		var err error
+		if w.encoding == "zstd" {
+			w.enc, err = zstd.NewWriter(w.ResponseWriter, zstd.WithEncoderConcurrency(1))
+		} else {
+			w.enc, err = gzip.NewWriterLevel(w.ResponseWriter, w.level)
+		}
+
+		if err != nil {
+			zap.S().Warnw("failed to create response compressor", zap.String("encoding", w.encoding), zap.Error(err))
+			w.enc = nil
+		} else {
+			h.Set("Content-Encoding", w.encoding)
+			h.Del("Content-Length")
+		}
+	}
+
+	h.Add("Vary", "Accept-Encoding")
+	w.ResponseWriter.WriteHeader(status)
+
+	buf := w.buf
+	w.buf = nil
+	if len(buf) == 0 {
+		return nil
+	}
+
+	_, err := w.Write(buf)
+
+	return err
+}
+
+// Writes out any response that is still buffered and completes the compressed stream.
+func (w *compressWriter) finish() {
+	if !w.decided {
+		w.decide()
+	}
+
+	if w.enc != nil {
+		if err := w.enc.Close(); err != nil {
+			zap.S().Debugw("failed to complete compressed response", zap.Error(err))
+		}
+	}
+}
@@ -0,0 +1,47 @@
+package router
+
+import (
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Sets the ETag and Last-Modified headers for the response and determines if the client
+// already has the current version of the resource. If it does a 304 response is sent and
+// true is returned, in which case the handler should not send anything else.
+func checkNotModified(c *gin.Context, etag string, modified time.Time) bool {
+	c.Header("ETag", etag)
+	if !modified.IsZero() {
+		c.Header("Last-Modified", modified.UTC().Format(http.TimeFormat))
+	}
+
+	// If-None-Match takes precedence over If-Modified-Since when both are sent.
+	if inm := c.GetHeader("If-None-Match"); inm != "" {
+		if !etagMatches(inm, etag) {
+			return false
+		}
+	} else if ims, err := http.ParseTime(c.GetHeader("If-Modified-Since")); err != nil || modified.IsZero() || modified.Truncate(time.Second).After(ims) {
+		return false
+	}
+
+	c.Status(http.StatusNotModified)
+	c.Abort()
+
+	return true
+}
+
+// Determines if any of the tags in an If-None-Match header match the ETag, using the
+// weak comparison that is required for this header.
+func etagMatches(header string, etag string) bool {
+	etag = strings.TrimPrefix(etag, "W/")
+
+	for _, t := range strings.Split(header, ",") {
+		t = strings.TrimSpace(t)
+		if t == "*" || strings.TrimPrefix(t, "W/") == etag {
+			return true
+		}
+	}
+
+	return false
+}
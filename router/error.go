@@ -59,6 +59,15 @@ func (e *RequestError) AbortWithStatus(status int, c *gin.Context) {
 		return
 	}
 
+	// Files protected by the server configuration are an expected failure case, so these
+	// do not need to be logged either.
+	if server.IsProtectedFileError(errors.Cause(e.Err)) {
+		c.AbortWithStatusJSON(http.StatusForbidden, gin.H{
+			"error": "This file is protected and cannot be modified.",
+		})
+		return
+	}
+
 	// Otherwise, log the error to zap, and then report the error back to the user.
 	if status >= 500 {
 		if e.server != nil {
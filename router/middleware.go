@@ -1,12 +1,23 @@
 package router
 
 import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
+	"github.com/patrickmn/go-cache"
 	"github.com/pterodactyl/wings/config"
 	"github.com/pterodactyl/wings/server"
+	"io"
+	"io/ioutil"
 	"net/http"
+	"os"
+	"strconv"
 	"strings"
+	"time"
 )
 
 // Set the access request control headers on all of the requests.
@@ -16,9 +27,75 @@ func SetAccessControlHeaders(c *gin.Context) {
 	c.Next()
 }
 
-// Authenticates the request token against the given permission string, ensuring that
-// if it is a server permission, the token has control over that server. If it is a global
-// token, this will ensure that the request is using a properly signed global token.
+// The scopes that can be assigned to named API keys. The admin scope grants access to
+// every route on the daemon.
+const (
+	ScopeRead  = "read"
+	ScopePower = "power"
+	ScopeFiles = "files"
+	ScopeAdmin = "admin"
+)
+
+// Returns the scope an API key must have to access the route being requested, as defined
+// in the route table. Any route that is not in the table requires the admin scope.
+func requiredScope(c *gin.Context) string {
+	if scope, ok := routeScopes[c.Request.Method+" "+c.FullPath()]; ok {
+		return scope
+	}
+
+	return ScopeAdmin
+}
+
+// Validates a token against the global daemon token and any named API keys, returning
+// the name of the matching key if it has been granted the given scope. The global token
+// is always able to access every scope. Tokens that have been rotated are still accepted
+// until their grace period has passed.
+func AuthenticateToken(token string, scope string) (string, bool) {
+	cfg := config.Get()
+
+	if tokenMatches(token, cfg.AuthenticationToken) || (cfg.PreviousTokenActive() && tokenMatches(token, cfg.PreviousAuthenticationToken)) {
+		return "daemon", true
+	}
+
+	for _, k := range cfg.ApiKeys {
+		if tokenMatches(token, k.Token) || (k.PreviousTokenActive() && tokenMatches(token, k.PreviousToken)) {
+			return k.Name, k.HasScope(scope)
+		}
+	}
+
+	return "", false
+}
+
+// Determines if the token used to make the request has been granted the given scope. This
+// is used by routes that return extra information to keys with a higher scope.
+func hasScope(c *gin.Context, scope string) bool {
+	name := c.GetString("api_key")
+	if name == "daemon" {
+		return true
+	}
+
+	for _, k := range config.Get().ApiKeys {
+		if k.Name == name {
+			return k.HasScope(scope)
+		}
+	}
+
+	return false
+}
+
+// Compares two tokens in constant time. Empty tokens never match, so a key that has been
+// configured without a token cannot be used.
+func tokenMatches(provided string, expected string) bool {
+	if expected == "" {
+		return false
+	}
+
+	return subtle.ConstantTimeCompare([]byte(provided), []byte(expected)) == 1
+}
+
+// Authenticates the request token against the permission required for the route, ensuring
+// that if a named API key is being used it has been granted access to the route. The name
+// of the key that was used is stored in the request context as "api_key".
 func AuthorizationMiddleware(c *gin.Context) {
 	auth := strings.SplitN(c.GetHeader("Authorization"), " ", 2)
 
@@ -31,20 +108,160 @@ func AuthorizationMiddleware(c *gin.Context) {
 		return
 	}
 
-	// Try to match the request against the global token for the Daemon, regardless
-	// of the permission type. If nothing is matched we will fall through to the Panel
-	// API to try and validate permissions for a server.
-	if auth[1] == config.Get().AuthenticationToken {
+	name, ok := AuthenticateToken(auth[1], requiredScope(c))
+	if ok {
+		c.Set("api_key", name)
 		c.Next()
 
 		return
 	}
 
+	// A valid key that is missing the scope for this route is not a failed attempt to
+	// authenticate, only tokens that do not match anything are.
+	if name == "" {
+		recordAuthFailure(c)
+	}
+
 	c.AbortWithStatusJSON(http.StatusForbidden, gin.H{
 		"error": "You are not authorized to access this endpoint.",
 	})
 }
 
+// Requires that the request was made using a client certificate signed by one of the
+// configured authorities when client certificate authentication is enabled. The TLS
+// handshake has already verified any certificate that was provided, so this only needs
+// to check that one was.
+func ClientCertificateMiddleware(c *gin.Context) {
+	ssl := config.Get().Api.Ssl
+	if !ssl.Enabled || ssl.ClientCaFile == "" {
+		c.Next()
+		return
+	}
+
+	if c.Request.TLS == nil || len(c.Request.TLS.VerifiedChains) == 0 {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{
+			"error": "A valid client certificate is required to access this endpoint.",
+		})
+		return
+	}
+
+	c.Next()
+}
+
+// Tracks the signatures of requests that have already been received so that a signed
+// request cannot be replayed. Entries only need to be kept for as long as the timestamp
+// of the request would still be accepted.
+var seenSignatures = cache.New(10*time.Minute, 5*time.Minute)
+
+// The largest request body that is held in memory while its signature is checked. Larger
+// bodies, such as file uploads, are written to a temporary file as they are hashed instead.
+const maxSignedBodyMemory = 4 << 20
+
+// Requires that requests are signed using the shared secret when request signing has been
+// enabled. The signature is sent in the X-Signature header as a hex encoded HMAC-SHA256
+// over the request method, path including the query string, hex encoded SHA256 hash of
+// the body, and the timestamp from the X-Signature-Timestamp header, each separated by a
+// newline.
+func RequestSignatureMiddleware(c *gin.Context) {
+	cfg := config.Get().Api.RequestSigning
+	if !cfg.Enabled {
+		c.Next()
+		return
+	}
+
+	abort := func() {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{
+			"error": "The request signature is missing or invalid.",
+		})
+	}
+
+	ts, err := strconv.ParseInt(c.GetHeader("X-Signature-Timestamp"), 10, 64)
+	if err != nil {
+		abort()
+		return
+	}
+
+	skew := time.Duration(cfg.MaxSkew) * time.Second
+	if d := time.Since(time.Unix(ts, 0)); d > skew || d < -skew {
+		abort()
+		return
+	}
+
+	signature, err := hex.DecodeString(c.GetHeader("X-Signature"))
+	if err != nil || len(signature) == 0 {
+		abort()
+		return
+	}
+
+	h := sha256.New()
+	body, err := spoolBody(io.TeeReader(c.Request.Body, h))
+	if err != nil {
+		TrackedError(err).AbortWithServerError(c)
+		return
+	}
+	defer body.Close()
+	c.Request.Body = body
+
+	mac := hmac.New(sha256.New, []byte(cfg.Secret))
+	mac.Write([]byte(c.Request.Method + "\n" + c.Request.URL.RequestURI() + "\n" + hex.EncodeToString(h.Sum(nil)) + "\n" + strconv.FormatInt(ts, 10)))
+
+	if !hmac.Equal(signature, mac.Sum(nil)) {
+		abort()
+		return
+	}
+
+	// Add fails if the signature has already been seen within the window, which means the
+	// request is being replayed.
+	if err := seenSignatures.Add(hex.EncodeToString(signature), nil, 2*skew); err != nil {
+		abort()
+		return
+	}
+
+	c.Next()
+}
+
+// Reads a request body so that it can be hashed before the request is handled, returning a
+// reader that replays it. Bodies up to the in-memory limit are kept in memory, anything
+// larger is written to a temporary file that is removed when the returned reader is closed.
+func spoolBody(r io.Reader) (io.ReadCloser, error) {
+	var buf bytes.Buffer
+	if n, err := io.CopyN(&buf, r, maxSignedBodyMemory+1); err != nil && err != io.EOF {
+		return nil, err
+	} else if n <= maxSignedBodyMemory {
+		return ioutil.NopCloser(bytes.NewReader(buf.Bytes())), nil
+	}
+
+	f, err := ioutil.TempFile("", "wings-request")
+	if err != nil {
+		return nil, err
+	}
+
+	tmp := &tempFile{File: f}
+	if _, err := io.Copy(f, io.MultiReader(&buf, r)); err != nil {
+		tmp.Close()
+		return nil, err
+	}
+
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		tmp.Close()
+		return nil, err
+	}
+
+	return tmp, nil
+}
+
+// A temporary file that is removed once it has been closed.
+type tempFile struct {
+	*os.File
+}
+
+func (f *tempFile) Close() error {
+	err := f.File.Close()
+	os.Remove(f.Name())
+
+	return err
+}
+
 // Helper function to fetch a server out of the servers collection stored in memory.
 func GetServer(uuid string) *server.Server {
 	return server.GetServers().Find(func(s *server.Server) bool {
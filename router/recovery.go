@@ -0,0 +1,78 @@
+package router
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+	"net/http"
+	"runtime/debug"
+	"sync/atomic"
+)
+
+// The number of panics that have been recovered from while handling requests.
+var recoveredPanics uint64
+
+// Returns the number of panics that have been recovered from while handling requests.
+func RecoveredPanics() uint64 {
+	return atomic.LoadUint64(&recoveredPanics)
+}
+
+// Assigns every request an ID which is returned in the X-Request-Id header and included in
+// any errors that are logged, so that a response can be matched up with the logs. An ID
+// provided by a proxy in front of the daemon is used if there is one.
+func RequestIdMiddleware(c *gin.Context) {
+	id := c.GetHeader("X-Request-Id")
+	if id == "" || len(id) > 64 {
+		id = uuid.Must(uuid.NewRandom()).String()
+	}
+
+	c.Set("request_id", id)
+	c.Header("X-Request-Id", id)
+
+	c.Next()
+}
+
+// Recovers from any panic in a handler so that a single broken request cannot crash the
+// daemon. The stack is logged and the client receives the same error response that is sent
+// for any other unexpected error.
+func RecoveryMiddleware(c *gin.Context) {
+	defer func() {
+		r := recover()
+		if r == nil {
+			return
+		}
+
+		// This is used to abort a response that is being streamed, and is handled by the
+		// HTTP server itself.
+		if r == http.ErrAbortHandler {
+			panic(r)
+		}
+
+		atomic.AddUint64(&recoveredPanics, 1)
+
+		errorId := uuid.Must(uuid.NewRandom()).String()
+		zap.S().Errorw(
+			"recovered from panic while handling HTTP request",
+			zap.String("request_id", c.GetString("request_id")),
+			zap.String("error_id", errorId),
+			zap.String("method", c.Request.Method),
+			zap.String("path", c.Request.URL.Path),
+			zap.Any("panic", r),
+			zap.ByteString("stack", debug.Stack()),
+		)
+
+		// If part of the response has already been sent there is no way to send an error,
+		// so the best that can be done is to stop here.
+		if c.Writer.Written() {
+			c.Abort()
+			return
+		}
+
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{
+			"error":    "An unexpected error was encountered while processing this request.",
+			"error_id": errorId,
+		})
+	}()
+
+	c.Next()
+}
@@ -1,77 +1,100 @@
 package router
 
 import (
+	"context"
 	"github.com/gin-gonic/gin"
+	"github.com/pterodactyl/wings/config"
+	"github.com/pterodactyl/wings/server"
+	"net/http"
+	"time"
 )
 
 // Configures the routing infrastructure for this daemon instance.
 func Configure() *gin.Engine {
-	router := gin.Default()
-	router.Use(SetAccessControlHeaders)
+	router := gin.New()
+	router.Use(gin.Logger(), RequestIdMiddleware, RecoveryMiddleware)
+	router.Use(SetAccessControlHeaders, BanMiddleware, CompressionMiddleware)
 
-	router.OPTIONS("/api/system", func(c *gin.Context) {
-		c.Status(200)
-	})
+	for _, r := range apiRoutes() {
+		var handlers []gin.HandlerFunc
 
-	// These routes use signed URLs to validate access to the resource being requested.
-	router.GET("/download/backup", getDownloadBackup)
-	router.GET("/download/file", getDownloadFile)
-
-	// This route is special it sits above all of the other requests because we are
-	// using a JWT to authorize access to it, therefore it needs to be publicly
-	// accessible.
-	router.GET("/api/servers/:server/ws", getServerWebsocket)
-
-	// This request is called by another daemon when a server is going to be transferred out.
-	// This request does not need the AuthorizationMiddleware as the panel should never call it
-	// and requests are authenticated through a JWT the panel issues to the other daemon.
-	router.GET("/api/servers/:server/archive", getServerArchive)
-
-	// All of the routes beyond this mount will use an authorization middleware
-	// and will not be accessible without the correct Authorization header provided.
-	protected := router.Use(AuthorizationMiddleware)
-	protected.POST("/api/update", postUpdateConfiguration)
-	protected.GET("/api/system", getSystemInformation)
-	protected.GET("/api/servers", getAllServers)
-	protected.POST("/api/servers", postCreateServer)
-	protected.POST("/api/transfer", postTransfer)
-
-	// These are server specific routes, and require that the request be authorized, and
-	// that the server exist on the Daemon.
-	server := router.Group("/api/servers/:server")
-	server.Use(AuthorizationMiddleware, ServerExists)
-	{
-		server.GET("", getServer)
-		server.PATCH("", patchServer)
-		server.DELETE("", deleteServer)
-
-		server.GET("/logs", getServerLogs)
-		server.POST("/power", postServerPower)
-		server.POST("/commands", postServerCommands)
-		server.POST("/install", postServerInstall)
-		server.POST("/reinstall", postServerReinstall)
-
-		// This archive request causes the archive to start being created
-		// this should only be triggered by the panel.
-		server.POST("/archive", postServerArchive)
-
-		files := server.Group("/files")
-		{
-			files.GET("/contents", getServerFileContents)
-			files.GET("/list-directory", getServerListDirectory)
-			files.PUT("/rename", putServerRenameFile)
-			files.POST("/copy", postServerCopyFile)
-			files.POST("/write", postServerWriteFile)
-			files.POST("/create-directory", postServerCreateDirectory)
-			files.POST("/delete", postServerDeleteFile)
+		// Routes that are not public will not be accessible without the correct Authorization
+		// header provided. When request signing is enabled they must also be signed, and when
+		// client certificates are enabled they must be made using a trusted certificate.
+		if r.Access != accessPublic {
+			handlers = append(handlers, ClientCertificateMiddleware, AuthorizationMiddleware, RequestSignatureMiddleware)
 		}
 
-		backup := server.Group("/backup")
-		{
-			backup.POST("", postServerBackup)
-			backup.DELETE("/:backup", deleteServerBackup)
+		if r.Access == accessServer {
+			handlers = append(handlers, ServerExists)
 		}
+
+		router.Handle(r.Method, r.Path, append(handlers, r.Handler)...)
+	}
+
+	if config.Get().Api.LegacyRoutes {
+		configureLegacyRoutes(router)
 	}
 
 	return router
 }
+
+// Returns a context for a long-running operation started by a request, which is cancelled
+// when the client disconnects or the operation timeout configured for the API is reached.
+func operationContext(c *gin.Context) (context.Context, context.CancelFunc) {
+	if t := config.Get().Api.Timeouts.Operation; t > 0 {
+		return context.WithTimeout(c.Request.Context(), time.Second*time.Duration(t))
+	}
+
+	return context.WithCancel(c.Request.Context())
+}
+
+// Aborts the request with an error for an operation that could not be queued for a server.
+func abortWithOperationError(c *gin.Context, s *server.Server, err error) {
+	switch {
+	case server.IsOperationConflictError(err):
+		c.AbortWithStatusJSON(http.StatusConflict, gin.H{
+			"error": "This operation is already running or waiting to run for this server.",
+		})
+	case server.IsOperationQueueFullError(err):
+		c.AbortWithStatusJSON(http.StatusServiceUnavailable, gin.H{
+			"error": "There are too many operations waiting to run for this server, try again shortly.",
+		})
+	default:
+		TrackedServerError(err, s).AbortWithServerError(c)
+	}
+}
+
+// Aborts the request if the error is because the node does not have the capacity for the
+// change being made, returning true if it was. The details are sent along so the Panel can
+// show what the node is short of.
+func abortIfCapacityError(c *gin.Context, err error) bool {
+	if !server.IsCapacityError(err) {
+		return false
+	}
+
+	c.AbortWithStatusJSON(http.StatusConflict, gin.H{
+		"error":    err.Error(),
+		"capacity": err,
+	})
+
+	return true
+}
+
+// Aborts the request if the context of the operation it started was cancelled, returning
+// true if it was. An operation that timed out is reported to the client, while one that was
+// cancelled because the client disconnected has nobody left to report to.
+func abortIfCancelled(c *gin.Context, ctx context.Context) bool {
+	switch ctx.Err() {
+	case context.DeadlineExceeded:
+		c.AbortWithStatusJSON(http.StatusGatewayTimeout, gin.H{
+			"error": "The operation did not complete in time and was cancelled.",
+		})
+		return true
+	case context.Canceled:
+		c.Abort()
+		return true
+	}
+
+	return false
+}
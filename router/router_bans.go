@@ -0,0 +1,339 @@
+package router
+
+import (
+	"encoding/json"
+	"github.com/gin-gonic/gin"
+	"github.com/patrickmn/go-cache"
+	"github.com/pterodactyl/wings/config"
+	"github.com/pterodactyl/wings/server"
+	"github.com/pterodactyl/wings/store"
+	"go.uber.org/zap"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// How long a ban is remembered for after it expires. An address that is banned again
+// within this time is banned for twice as long as it was the last time.
+const banMemory = time.Hour * 24
+
+// The services that addresses can be banned from. Each keeps its own bans and counts its
+// own failures, so an address banned from SFTP can still reach the API and the other way
+// around.
+const (
+	banServiceApi  = "api"
+	banServiceSftp = "sftp"
+)
+
+// The bans for a single service, along with the number of failed authentication attempts
+// made by each address within the window.
+type banList struct {
+	service  string
+	repo     *store.Repository
+	failures *cache.Cache
+}
+
+var (
+	apiBans  = &banList{service: banServiceApi, repo: store.NewRepository(store.ApiBans), failures: cache.New(5*time.Minute, time.Minute)}
+	sftpBans = &banList{service: banServiceSftp, repo: store.NewRepository(store.SftpBans), failures: cache.New(5*time.Minute, time.Minute)}
+)
+
+// A ban preventing an address from making any requests to the API, or from connecting to
+// the SFTP server.
+type AddressBan struct {
+	Address  string    `json:"address"`
+	Service  string    `json:"service"`
+	Reason   string    `json:"reason"`
+	Offences int       `json:"offences"`
+	BannedAt time.Time `json:"banned_at"`
+	Expires  time.Time `json:"expires"`
+}
+
+// Determines if the ban is still in effect.
+func (b *AddressBan) Active() bool {
+	return time.Now().Before(b.Expires)
+}
+
+// Returns the address that the request was made from. This uses the address of the
+// connection rather than any forwarding headers, which can be set by anyone. When PROXY
+// protocol support is enabled the connection address is already the real client address.
+func remoteAddress(c *gin.Context) string {
+	host, _, err := net.SplitHostPort(c.Request.RemoteAddr)
+	if err != nil {
+		return c.Request.RemoteAddr
+	}
+
+	return host
+}
+
+// Determines if the address can never be banned.
+func isBanExempt(address string) bool {
+	ip := net.ParseIP(address)
+	if ip == nil {
+		return false
+	}
+
+	for _, e := range config.Get().Api.AuthBans.Exempt {
+		if _, n, err := net.ParseCIDR(e); err == nil {
+			if n.Contains(ip) {
+				return true
+			}
+		} else if ip.Equal(net.ParseIP(e)) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Returns the ban for an address, if there is one. The ban might no longer be active.
+func (l *banList) lookup(address string) (*AddressBan, bool) {
+	var b AddressBan
+	if ok, err := l.repo.Get(address, &b); err != nil || !ok {
+		if err != nil {
+			zap.S().Warnw("failed to look up ban for address", zap.String("address", address), zap.String("service", l.service), zap.Error(err))
+		}
+
+		return nil, false
+	}
+
+	// Bans saved before the service was recorded do not have one set.
+	b.Service = l.service
+
+	return &b, true
+}
+
+// Bans an address for the given duration. If no duration is given the length of the ban is
+// based on how many times the address has been banned recently.
+func (l *banList) ban(address string, reason string, d time.Duration) (*AddressBan, error) {
+	cfg := config.Get().Api.AuthBans
+
+	b := &AddressBan{Address: address, Service: l.service, Reason: reason, Offences: 1, BannedAt: time.Now()}
+	if prev, ok := l.lookup(address); ok {
+		b.Offences = prev.Offences + 1
+	}
+
+	if d <= 0 {
+		d = time.Duration(cfg.Duration) * time.Second
+		max := time.Duration(cfg.MaxDuration) * time.Second
+
+		for i := 1; i < b.Offences && d < max; i++ {
+			d *= 2
+		}
+
+		if d > max {
+			d = max
+		}
+	}
+
+	b.Expires = b.BannedAt.Add(d)
+
+	if err := l.repo.PutWithExpiry(address, b, b.Expires.Add(banMemory)); err != nil {
+		return nil, err
+	}
+
+	l.failures.Delete(address)
+
+	zap.S().Warnw("banned address", zap.String("address", address), zap.String("service", l.service), zap.String("reason", reason), zap.Time("expires", b.Expires))
+	server.PublishNodeEvent(server.AddressBannedEvent, "", b)
+
+	return b, nil
+}
+
+// Records a failed attempt to authenticate from an address, banning it once it has failed
+// too many times.
+func (l *banList) recordFailure(address string) {
+	cfg := config.Get().Api.AuthBans
+	if !cfg.Enabled {
+		return
+	}
+
+	if isBanExempt(address) {
+		return
+	}
+
+	n, err := l.failures.IncrementInt(address, 1)
+	if err != nil {
+		if l.failures.Add(address, 1, time.Duration(cfg.Window)*time.Second) != nil {
+			n, _ = l.failures.IncrementInt(address, 1)
+		} else {
+			n = 1
+		}
+	}
+
+	if n < cfg.MaxFailures {
+		return
+	}
+
+	if _, err := l.ban(address, "too many failed authentication attempts", 0); err != nil {
+		zap.S().Errorw("failed to ban address", zap.String("address", address), zap.String("service", l.service), zap.Error(err))
+	}
+}
+
+// Returns the ban for an address if it is currently banned.
+func (l *banList) active(address string) (*AddressBan, bool) {
+	if !config.Get().Api.AuthBans.Enabled {
+		return nil, false
+	}
+
+	if b, ok := l.lookup(address); ok && b.Active() {
+		return b, true
+	}
+
+	return nil, false
+}
+
+// Records a failed attempt to authenticate from the address the request was made from,
+// banning the address once it has failed too many times.
+func recordAuthFailure(c *gin.Context) {
+	RecordAuthFailure(remoteAddress(c))
+}
+
+// Records a failed attempt to authenticate from an address, banning it once it has failed
+// too many times. This is used by the other APIs served alongside the webserver so that
+// they share the same limits.
+func RecordAuthFailure(address string) {
+	apiBans.recordFailure(address)
+}
+
+// Returns the ban for an address if it is currently banned from accessing the API.
+func ActiveBan(address string) (*AddressBan, bool) {
+	return apiBans.active(address)
+}
+
+// Records a failed attempt to log in to the SFTP server from an address, banning it from
+// the SFTP server once it has failed too many times.
+func RecordSftpAuthFailure(address string) {
+	sftpBans.recordFailure(address)
+}
+
+// Returns the ban for an address if it is currently banned from the SFTP server.
+func ActiveSftpBan(address string) (*AddressBan, bool) {
+	return sftpBans.active(address)
+}
+
+// Returns the list of bans for the service given in the "service" query parameter, which
+// defaults to the API.
+func banListFor(c *gin.Context) (*banList, bool) {
+	switch c.DefaultQuery("service", banServiceApi) {
+	case banServiceApi:
+		return apiBans, true
+	case banServiceSftp:
+		return sftpBans, true
+	}
+
+	c.AbortWithStatusJSON(http.StatusUnprocessableEntity, gin.H{
+		"error": "The service must be one of \"api\" or \"sftp\".",
+	})
+
+	return nil, false
+}
+
+// Rejects any request made from an address that is currently banned.
+func BanMiddleware(c *gin.Context) {
+	if b, ok := ActiveBan(remoteAddress(c)); ok {
+		c.Header("Retry-After", strconv.Itoa(int(time.Until(b.Expires).Seconds())+1))
+		c.AbortWithStatusJSON(http.StatusForbidden, gin.H{
+			"error": "This address has been temporarily banned from accessing the API.",
+		})
+		return
+	}
+
+	c.Next()
+}
+
+// Returns every address that is currently banned from the API and the SFTP server.
+func getBans(c *gin.Context) {
+	bans := make([]AddressBan, 0)
+
+	for _, l := range []*banList{apiBans, sftpBans} {
+		err := l.repo.Each(func(key string, data []byte) error {
+			var b AddressBan
+			if err := json.Unmarshal(data, &b); err != nil {
+				return err
+			}
+
+			if b.Active() {
+				b.Service = l.service
+				bans = append(bans, b)
+			}
+
+			return nil
+		})
+		if err != nil {
+			TrackedError(err).AbortWithServerError(c)
+			return
+		}
+	}
+
+	c.JSON(http.StatusOK, bans)
+}
+
+// Bans an address manually. A duration in seconds can be provided, otherwise the length of
+// the ban is determined in the same way as for addresses that are banned automatically. The
+// address is banned from the API unless the "service" query parameter is "sftp".
+func postBan(c *gin.Context) {
+	l, ok := banListFor(c)
+	if !ok {
+		return
+	}
+
+	var data struct {
+		Address  string `json:"address"`
+		Reason   string `json:"reason"`
+		Duration int    `json:"duration"`
+	}
+
+	if err := c.BindJSON(&data); err != nil {
+		return
+	}
+
+	if net.ParseIP(data.Address) == nil {
+		c.AbortWithStatusJSON(http.StatusUnprocessableEntity, gin.H{
+			"error": "The address provided is not a valid IP address.",
+		})
+		return
+	}
+
+	if data.Reason == "" {
+		data.Reason = "banned manually"
+	}
+
+	b, err := l.ban(data.Address, data.Reason, time.Duration(data.Duration)*time.Second)
+	if err != nil {
+		TrackedError(err).AbortWithServerError(c)
+		return
+	}
+
+	c.JSON(http.StatusOK, b)
+}
+
+// Removes the ban for an address, along with any record of its previous bans. The ban is
+// removed from the API unless the "service" query parameter is "sftp".
+func deleteBan(c *gin.Context) {
+	l, ok := banListFor(c)
+	if !ok {
+		return
+	}
+
+	address := c.Param("address")
+
+	b, ok := l.lookup(address)
+	if !ok {
+		c.AbortWithStatusJSON(http.StatusNotFound, gin.H{
+			"error": "The requested address is not banned.",
+		})
+		return
+	}
+
+	if err := l.repo.Delete(address); err != nil {
+		TrackedError(err).AbortWithServerError(c)
+		return
+	}
+
+	l.failures.Delete(address)
+	server.PublishNodeEvent(server.AddressUnbannedEvent, "", b)
+
+	c.Status(http.StatusNoContent)
+}
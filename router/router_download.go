@@ -4,15 +4,43 @@ import (
 	"bufio"
 	"github.com/gin-gonic/gin"
 	"github.com/pterodactyl/wings/router/tokens"
+	"github.com/pterodactyl/wings/server"
+	"go.uber.org/zap"
 	"net/http"
 	"os"
 	"strconv"
 )
 
+// Registers a new download for the server. If there are already too many downloads in
+// progress the request is aborted and false is returned. Downloads share their bandwidth
+// with the others started by the same user, which is identified by the token when the
+// Panel includes them in it, otherwise by the address of the request.
+func beginDownload(c *gin.Context, s *server.Server, user string) (*server.Download, bool) {
+	if user == "" {
+		user = "address:" + remoteAddress(c)
+	}
+
+	d, err := s.Filesystem.BeginDownload(user)
+	if err != nil {
+		if server.IsTooManyDownloadsError(err) {
+			c.AbortWithStatusJSON(http.StatusTooManyRequests, gin.H{
+				"error": "There are too many downloads in progress, please try again shortly.",
+			})
+			return nil, false
+		}
+
+		TrackedServerError(err, s).AbortWithServerError(c)
+		return nil, false
+	}
+
+	return d, true
+}
+
 // Handle a download request for a server backup.
 func getDownloadBackup(c *gin.Context) {
 	token := tokens.BackupPayload{}
 	if err := tokens.ParseToken([]byte(c.Query("token")), &token); err != nil {
+		recordAuthFailure(c)
 		TrackedError(err).AbortWithServerError(c)
 		return
 	}
@@ -31,6 +59,12 @@ func getDownloadBackup(c *gin.Context) {
 		return
 	}
 
+	d, ok := beginDownload(c, s, token.UserUuid)
+	if !ok {
+		return
+	}
+	defer d.Done()
+
 	f, err := os.Open(p)
 	if err != nil {
 		TrackedServerError(err, s).AbortWithServerError(c)
@@ -42,13 +76,14 @@ func getDownloadBackup(c *gin.Context) {
 	c.Header("Content-Disposition", "attachment; filename="+st.Name())
 	c.Header("Content-Type", "application/octet-stream")
 
-	bufio.NewReader(f).WriteTo(c.Writer)
+	bufio.NewReader(d.Reader(f)).WriteTo(c.Writer)
 }
 
 // Handles downloading a specific file for a server.
 func getDownloadFile(c *gin.Context) {
 	token := tokens.FilePayload{}
 	if err := tokens.ParseToken([]byte(c.Query("token")), &token); err != nil {
+		recordAuthFailure(c)
 		TrackedError(err).AbortWithServerError(c)
 		return
 	}
@@ -75,6 +110,12 @@ func getDownloadFile(c *gin.Context) {
 		return
 	}
 
+	d, ok := beginDownload(c, s, token.UserUuid)
+	if !ok {
+		return
+	}
+	defer d.Done()
+
 	f, err := os.Open(p)
 	if err != nil {
 		TrackedServerError(err, s).AbortWithServerError(c)
@@ -85,5 +126,39 @@ func getDownloadFile(c *gin.Context) {
 	c.Header("Content-Disposition", "attachment; filename="+st.Name())
 	c.Header("Content-Type", "application/octet-stream")
 
-	bufio.NewReader(f).WriteTo(c.Writer)
-}
\ No newline at end of file
+	bufio.NewReader(d.Reader(f)).WriteTo(c.Writer)
+}
+
+// Streams a compressed archive of the entire server directory. The archive is generated
+// as it is sent so that users can download their data without first creating a backup.
+func getDownloadServerArchive(c *gin.Context) {
+	token := tokens.ArchivePayload{}
+	if err := tokens.ParseToken([]byte(c.Query("token")), &token); err != nil {
+		recordAuthFailure(c)
+		TrackedError(err).AbortWithServerError(c)
+		return
+	}
+
+	s := GetServer(token.ServerUuid)
+	if s == nil || token.ServerUuid != c.Param("server") || !token.IsUniqueRequest() {
+		c.AbortWithStatusJSON(http.StatusNotFound, gin.H{
+			"error": "The requested resource was not found on this server.",
+		})
+		return
+	}
+
+	d, ok := beginDownload(c, s, token.UserUuid)
+	if !ok {
+		return
+	}
+	defer d.Done()
+
+	c.Header("Content-Disposition", "attachment; filename="+s.Uuid+".tar.gz")
+	c.Header("Content-Type", "application/gzip")
+
+	// The size of the archive is not known ahead of time, so once the response begins
+	// there is no way to report an error to the client other than ending the stream.
+	if err := s.Filesystem.StreamArchive(c.Request.Context(), d.Writer(c.Writer), s.Filesystem.IgnoreRules(token.IgnoredFiles)); err != nil {
+		zap.S().Errorw("failed to stream server archive", zap.String("server", s.Uuid), zap.Error(err))
+	}
+}
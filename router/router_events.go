@@ -0,0 +1,57 @@
+package router
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/pterodactyl/wings/server"
+	"io"
+	"strings"
+	"time"
+)
+
+// Streams events from every server on the node using server-sent events. The events sent
+// can be limited by passing a comma separated list of event names as the "events" query
+// parameter. Each event contains the UUID of the server it is for.
+func getEvents(c *gin.Context) {
+	topics := server.NodeEventTopics
+	if c.Query("events") != "" {
+		topics = strings.Split(c.Query("events"), ",")
+	}
+
+	// The channel is buffered so that a slow client does not hold up the publishing of
+	// events for long, and so that anything published while unsubscribing does not block.
+	ch := make(chan server.Event, 64)
+	for _, t := range topics {
+		server.NodeEvents().Subscribe(t, ch)
+	}
+
+	defer func() {
+		for _, t := range topics {
+			server.NodeEvents().Unsubscribe(t, ch)
+		}
+	}()
+
+	ticker := time.NewTicker(time.Second * 30)
+	defer ticker.Stop()
+
+	c.Header("Cache-Control", "no-cache")
+	c.Header("X-Accel-Buffering", "no")
+
+	c.Stream(func(w io.Writer) bool {
+		select {
+		case <-c.Request.Context().Done():
+			return false
+		case <-shuttingDown:
+			return false
+		case e := <-ch:
+			c.SSEvent(e.Topic, e.Data)
+		case <-ticker.C:
+			// Send a comment to keep the connection from being closed by any proxies
+			// while no events are happening.
+			if _, err := w.Write([]byte(": keepalive\n\n")); err != nil {
+				return false
+			}
+		}
+
+		return true
+	})
+}
@@ -0,0 +1,376 @@
+package router
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/graph-gophers/graphql-go"
+	"github.com/pterodactyl/wings/config"
+	"github.com/pterodactyl/wings/server"
+	"github.com/pterodactyl/wings/system"
+	"net/http"
+	"sort"
+	"time"
+)
+
+// The schema served by the GraphQL endpoint. Every field is read-only, anything that makes
+// changes to a server must still be done through the REST API. Byte counts are returned as
+// floats since they do not fit into the 32-bit integers GraphQL uses.
+const graphqlSchema = `
+schema {
+	query: Query
+}
+
+type Query {
+	# Information about the system the daemon is running on.
+	system: System!
+	# Every server on the node.
+	servers: [Server!]!
+	# A single server, or null if it does not exist.
+	server(uuid: ID!): Server
+}
+
+type System {
+	version: String!
+	kernelVersion: String!
+	architecture: String!
+	os: String!
+	# The platform images are pulled for, such as "linux/amd64".
+	platform: String!
+	cpuCount: Int!
+}
+
+type Server {
+	uuid: ID!
+	name: String!
+	description: String!
+	tags: [String!]!
+	state: String!
+	suspended: Boolean!
+	installing: Boolean!
+	image: String!
+	platform: String!
+	invocation: String!
+	build: Build!
+	stats: Stats!
+	defaultAllocation: Allocation!
+	allocations: [Allocation!]!
+	backups: [Backup!]!
+}
+
+type Build {
+	# Limits in megabytes.
+	memoryLimit: Int!
+	swap: Int!
+	diskSpace: Int!
+	# The CPU limit as a percentage of a single thread.
+	cpuLimit: Int!
+	ioWeight: Int!
+	threads: String!
+}
+
+type Stats {
+	memoryBytes: Float!
+	memoryLimitBytes: Float!
+	cpuAbsolute: Float!
+	diskBytes: Float!
+	networkRxBytes: Float!
+	networkTxBytes: Float!
+}
+
+type Allocation {
+	ip: String!
+	port: Int!
+}
+
+type Backup {
+	uuid: ID!
+	size: Float!
+	# RFC 3339 timestamp.
+	createdAt: String!
+	# Fingerprint of the key the backup was encrypted with, null if it is not encrypted.
+	keyFingerprint: String
+}
+`
+
+var graphqlQuerySchema = graphql.MustParseSchema(graphqlSchema, &graphqlResolver{}, graphql.MaxDepth(10))
+
+// The body of a request to the GraphQL endpoint.
+type graphqlRequest struct {
+	Query         string                 `json:"query"`
+	OperationName string                 `json:"operationName"`
+	Variables     map[string]interface{} `json:"variables"`
+}
+
+// Executes a query against the GraphQL schema. Like the REST API, errors that occur while
+// resolving a field are included in the response along with any data that was resolved.
+func postGraphql(c *gin.Context) {
+	if !config.Get().Api.Graphql {
+		c.AbortWithStatusJSON(http.StatusNotFound, gin.H{
+			"error": "The GraphQL endpoint is not enabled on this instance.",
+		})
+		return
+	}
+
+	var data graphqlRequest
+	if err := c.BindJSON(&data); err != nil {
+		return
+	}
+
+	if data.Query == "" {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error": "A query must be provided in the request body.",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, graphqlQuerySchema.Exec(c.Request.Context(), data.Query, data.OperationName, data.Variables))
+}
+
+type graphqlResolver struct{}
+
+func (r *graphqlResolver) System() (*graphqlSystem, error) {
+	i, err := system.GetSystemInformation()
+	if err != nil {
+		return nil, err
+	}
+
+	return &graphqlSystem{i}, nil
+}
+
+func (r *graphqlResolver) Servers() []*graphqlServer {
+	servers := server.GetServers().All()
+
+	out := make([]*graphqlServer, 0, len(servers))
+	for _, s := range servers {
+		out = append(out, &graphqlServer{s})
+	}
+
+	sort.Slice(out, func(i, j int) bool {
+		return out[i].s.Uuid < out[j].s.Uuid
+	})
+
+	return out
+}
+
+func (r *graphqlResolver) Server(args struct{ Uuid graphql.ID }) *graphqlServer {
+	if s := GetServer(string(args.Uuid)); s != nil {
+		return &graphqlServer{s}
+	}
+
+	return nil
+}
+
+type graphqlSystem struct {
+	i *system.Information
+}
+
+func (r *graphqlSystem) Version() string {
+	return r.i.Version
+}
+
+func (r *graphqlSystem) KernelVersion() string {
+	return r.i.KernelVersion
+}
+
+func (r *graphqlSystem) Architecture() string {
+	return r.i.Architecture
+}
+
+func (r *graphqlSystem) Os() string {
+	return r.i.OS
+}
+
+func (r *graphqlSystem) Platform() string {
+	return server.NodePlatform()
+}
+
+func (r *graphqlSystem) CpuCount() int32 {
+	return int32(r.i.CpuCount)
+}
+
+type graphqlServer struct {
+	s *server.Server
+}
+
+func (r *graphqlServer) Uuid() graphql.ID {
+	return graphql.ID(r.s.Uuid)
+}
+
+func (r *graphqlServer) Name() string {
+	return r.s.Meta.Name
+}
+
+func (r *graphqlServer) Description() string {
+	return r.s.Meta.Description
+}
+
+func (r *graphqlServer) Tags() []string {
+	if r.s.Tags == nil {
+		return []string{}
+	}
+
+	return r.s.Tags
+}
+
+func (r *graphqlServer) State() string {
+	return r.s.GetState()
+}
+
+func (r *graphqlServer) Suspended() bool {
+	return r.s.Suspended
+}
+
+func (r *graphqlServer) Installing() bool {
+	return r.s.IsInstalling()
+}
+
+func (r *graphqlServer) Image() string {
+	return r.s.ContainerImage()
+}
+
+func (r *graphqlServer) Platform() string {
+	return r.s.ContainerPlatform()
+}
+
+func (r *graphqlServer) Invocation() string {
+	return r.s.Invocation
+}
+
+func (r *graphqlServer) Build() *graphqlBuild {
+	return &graphqlBuild{r.s.Build}
+}
+
+func (r *graphqlServer) Stats() *graphqlStats {
+	return &graphqlStats{r.s.GetResources()}
+}
+
+func (r *graphqlServer) DefaultAllocation() *graphqlAllocation {
+	return &graphqlAllocation{ip: r.s.Allocations.DefaultMapping.Ip, port: r.s.Allocations.DefaultMapping.Port}
+}
+
+func (r *graphqlServer) Allocations() []*graphqlAllocation {
+	out := []*graphqlAllocation{}
+	for ip, ports := range r.s.Allocations.Mappings {
+		for _, port := range ports {
+			out = append(out, &graphqlAllocation{ip: ip, port: port})
+		}
+	}
+
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].ip != out[j].ip {
+			return out[i].ip < out[j].ip
+		}
+
+		return out[i].port < out[j].port
+	})
+
+	return out
+}
+
+// Backups are only read from the disk when they are part of the query, since listing them
+// for every server on the node is comparatively slow.
+func (r *graphqlServer) Backups() ([]*graphqlBackup, error) {
+	backups, err := r.s.LocalBackups()
+	if err != nil {
+		return nil, err
+	}
+
+	out := make([]*graphqlBackup, 0, len(backups))
+	for _, b := range backups {
+		out = append(out, &graphqlBackup{b})
+	}
+
+	return out, nil
+}
+
+type graphqlBuild struct {
+	b server.BuildSettings
+}
+
+func (r *graphqlBuild) MemoryLimit() int32 {
+	return int32(r.b.MemoryLimit)
+}
+
+func (r *graphqlBuild) Swap() int32 {
+	return int32(r.b.Swap)
+}
+
+func (r *graphqlBuild) DiskSpace() int32 {
+	return int32(r.b.DiskSpace)
+}
+
+func (r *graphqlBuild) CpuLimit() int32 {
+	return int32(r.b.CpuLimit)
+}
+
+func (r *graphqlBuild) IoWeight() int32 {
+	return int32(r.b.IoWeight)
+}
+
+func (r *graphqlBuild) Threads() string {
+	return r.b.Threads
+}
+
+type graphqlStats struct {
+	u server.ResourceUsage
+}
+
+func (r *graphqlStats) MemoryBytes() float64 {
+	return float64(r.u.Memory)
+}
+
+func (r *graphqlStats) MemoryLimitBytes() float64 {
+	return float64(r.u.MemoryLimit)
+}
+
+func (r *graphqlStats) CpuAbsolute() float64 {
+	return r.u.CpuAbsolute
+}
+
+func (r *graphqlStats) DiskBytes() float64 {
+	return float64(r.u.Disk)
+}
+
+func (r *graphqlStats) NetworkRxBytes() float64 {
+	return float64(r.u.Network.RxBytes)
+}
+
+func (r *graphqlStats) NetworkTxBytes() float64 {
+	return float64(r.u.Network.TxBytes)
+}
+
+type graphqlAllocation struct {
+	ip   string
+	port int
+}
+
+func (r *graphqlAllocation) Ip() string {
+	return r.ip
+}
+
+func (r *graphqlAllocation) Port() int32 {
+	return int32(r.port)
+}
+
+type graphqlBackup struct {
+	b server.LocalBackup
+}
+
+func (r *graphqlBackup) Uuid() graphql.ID {
+	return graphql.ID(r.b.Uuid)
+}
+
+func (r *graphqlBackup) Size() float64 {
+	return float64(r.b.Size)
+}
+
+func (r *graphqlBackup) CreatedAt() string {
+	return r.b.CreatedAt.UTC().Format(time.RFC3339)
+}
+
+func (r *graphqlBackup) KeyFingerprint() *string {
+	if r.b.KeyFingerprint == "" {
+		return nil
+	}
+
+	return &r.b.KeyFingerprint
+}
@@ -0,0 +1,235 @@
+package router
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/gin-gonic/gin"
+	"io/ioutil"
+	"net/http"
+	"path"
+	"strings"
+)
+
+// A route of the legacy Node.js daemon, which is served by the handler of the route that
+// replaced it. The request is adapted to what the current handler expects before it is
+// called, while the response is sent back in its current form.
+type legacyRoute struct {
+	Method string
+	Path   string
+
+	// The method and path of the route in the current API that serves this route. The
+	// access level and scope of that route apply to this one as well.
+	Target string
+
+	// Rewrites the request into the form expected by the current handler, aborting it if
+	// that is not possible.
+	Adapt gin.HandlerFunc
+}
+
+// Returns the routes of the legacy daemon that are served when they are enabled. Routes that
+// have no equivalent in the current API are not included.
+func legacyRoutes() []legacyRoute {
+	return []legacyRoute{
+		{Method: http.MethodGet, Path: "/v1", Target: "GET /api/system"},
+		{Method: http.MethodGet, Path: "/v1/servers", Target: "GET /api/servers"},
+		{Method: http.MethodPost, Path: "/v1/servers", Target: "POST /api/servers"},
+		{Method: http.MethodDelete, Path: "/v1/servers", Target: "DELETE /api/servers/:server"},
+
+		{Method: http.MethodGet, Path: "/v1/server", Target: "GET /api/servers/:server"},
+		{Method: http.MethodPatch, Path: "/v1/server", Target: "PATCH /api/servers/:server"},
+		{Method: http.MethodPost, Path: "/v1/server/suspend", Target: "PATCH /api/servers/:server", Adapt: legacySuspend(true)},
+		{Method: http.MethodPost, Path: "/v1/server/unsuspend", Target: "PATCH /api/servers/:server", Adapt: legacySuspend(false)},
+		{Method: http.MethodPost, Path: "/v1/server/reinstall", Target: "POST /api/servers/:server/reinstall"},
+		{Method: http.MethodGet, Path: "/v1/server/log", Target: "GET /api/servers/:server/logs"},
+		{Method: http.MethodPut, Path: "/v1/server/power", Target: "POST /api/servers/:server/power"},
+		{Method: http.MethodPost, Path: "/v1/server/command", Target: "POST /api/servers/:server/commands", Adapt: legacyCommand},
+
+		{Method: http.MethodGet, Path: "/v1/server/directory/*directory", Target: "GET /api/servers/:server/files/list-directory", Adapt: legacyWildcard("directory", "directory")},
+		{Method: http.MethodGet, Path: "/v1/server/file/f/*file", Target: "GET /api/servers/:server/files/contents", Adapt: legacyWildcard("file", "file")},
+		{Method: http.MethodDelete, Path: "/v1/server/file/f/*file", Target: "POST /api/servers/:server/files/delete", Adapt: legacyDeleteFile},
+		{Method: http.MethodPost, Path: "/v1/server/file/save", Target: "POST /api/servers/:server/files/write", Adapt: legacySaveFile},
+		{Method: http.MethodPost, Path: "/v1/server/file/folder", Target: "POST /api/servers/:server/files/create-directory", Adapt: legacyCreateFolder},
+		{Method: http.MethodPost, Path: "/v1/server/file/copy", Target: "POST /api/servers/:server/files/copy", Adapt: legacyCopyFile},
+		{Method: http.MethodPost, Path: "/v1/server/file/move", Target: "PUT /api/servers/:server/files/rename", Adapt: legacyRenameFile},
+		{Method: http.MethodPost, Path: "/v1/server/file/rename", Target: "PUT /api/servers/:server/files/rename", Adapt: legacyRenameFile},
+	}
+}
+
+// Returns the routes of the current API, keyed by their method and path.
+func routesByTarget() map[string]route {
+	targets := make(map[string]route)
+	for _, r := range apiRoutes() {
+		targets[r.Method+" "+r.Path] = r
+	}
+
+	return targets
+}
+
+func init() {
+	targets := routesByTarget()
+	for _, r := range legacyRoutes() {
+		if t, ok := targets[r.Target]; ok {
+			routeScopes[r.Method+" "+r.Path] = t.Scope
+		}
+	}
+}
+
+// Adds the routes of the legacy daemon to the router. Each one goes through the same
+// middleware as the route it is served by, after the headers used by the legacy daemon
+// have been translated into the ones used by the current API.
+func configureLegacyRoutes(router *gin.Engine) {
+	targets := routesByTarget()
+	for _, r := range legacyRoutes() {
+		t, ok := targets[r.Target]
+		if !ok {
+			continue
+		}
+
+		handlers := []gin.HandlerFunc{LegacyHeadersMiddleware}
+		if t.Access != accessPublic {
+			handlers = append(handlers, ClientCertificateMiddleware, AuthorizationMiddleware, RequestSignatureMiddleware)
+		}
+
+		if t.Access == accessServer {
+			handlers = append(handlers, ServerExists)
+		}
+
+		if r.Adapt != nil {
+			handlers = append(handlers, r.Adapt)
+		}
+
+		router.Handle(r.Method, r.Path, append(handlers, t.Handler)...)
+	}
+}
+
+// Translates the headers used to authenticate with the legacy daemon. The token sent in the
+// X-Access-Token header is used as a bearer token, so only the daemon token and API keys are
+// accepted, not the per-server tokens the old daemon issued. The server being acted on is
+// taken from the X-Access-Server header, since the legacy routes do not include it.
+func LegacyHeadersMiddleware(c *gin.Context) {
+	if t := c.GetHeader("X-Access-Token"); t != "" && c.GetHeader("Authorization") == "" {
+		c.Request.Header.Set("Authorization", "Bearer "+t)
+	}
+
+	if u := c.GetHeader("X-Access-Server"); u != "" {
+		c.Params = append(c.Params, gin.Param{Key: "server", Value: u})
+	}
+
+	c.Next()
+}
+
+// Sets a query parameter on the request. This must be done before the handler reads any of
+// the query, since the parsed query is cached on the context.
+func setLegacyQuery(c *gin.Context, key string, value string) {
+	q := c.Request.URL.Query()
+	q.Set(key, value)
+
+	c.Request.URL.RawQuery = q.Encode()
+}
+
+// Replaces the body of the request with the JSON encoding of the value.
+func setLegacyBody(c *gin.Context, v interface{}) {
+	b, _ := json.Marshal(v)
+
+	c.Request.Body = ioutil.NopCloser(bytes.NewReader(b))
+	c.Request.ContentLength = int64(len(b))
+}
+
+// Reads the JSON body sent to a legacy route, aborting the request if it cannot be decoded.
+func bindLegacyBody(c *gin.Context, v interface{}) bool {
+	if err := json.NewDecoder(c.Request.Body).Decode(v); err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error": "The request body could not be decoded.",
+		})
+		return false
+	}
+
+	return true
+}
+
+// Passes the path matched by a wildcard in the legacy route as a query parameter.
+func legacyWildcard(param string, key string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		setLegacyQuery(c, key, strings.TrimPrefix(c.Param(param), "/"))
+	}
+}
+
+func legacySuspend(suspended bool) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		setLegacyBody(c, gin.H{"suspended": suspended})
+	}
+}
+
+func legacyCommand(c *gin.Context) {
+	var data struct {
+		Command string `json:"command"`
+	}
+	if !bindLegacyBody(c, &data) {
+		return
+	}
+
+	setLegacyBody(c, gin.H{"commands": []string{data.Command}})
+}
+
+func legacyDeleteFile(c *gin.Context) {
+	setLegacyBody(c, gin.H{"location": strings.TrimPrefix(c.Param("file"), "/")})
+}
+
+func legacySaveFile(c *gin.Context) {
+	var data struct {
+		Path    string `json:"path"`
+		Content string `json:"content"`
+	}
+	if !bindLegacyBody(c, &data) {
+		return
+	}
+
+	setLegacyQuery(c, "file", data.Path)
+	c.Request.Body = ioutil.NopCloser(strings.NewReader(data.Content))
+	c.Request.ContentLength = int64(len(data.Content))
+}
+
+func legacyCreateFolder(c *gin.Context) {
+	var data struct {
+		Path string `json:"path"`
+	}
+	if !bindLegacyBody(c, &data) {
+		return
+	}
+
+	dir, name := path.Split(strings.TrimSuffix(data.Path, "/"))
+	setLegacyBody(c, gin.H{"name": name, "path": dir})
+}
+
+func legacyCopyFile(c *gin.Context) {
+	var data struct {
+		From string `json:"from"`
+		To   string `json:"to"`
+	}
+	if !bindLegacyBody(c, &data) {
+		return
+	}
+
+	// The current API copies a file next to the original, so copies to any other location
+	// cannot be served.
+	if data.To != "" && path.Dir(path.Clean("/"+data.To)) != path.Dir(path.Clean("/"+data.From)) {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error": "Files can only be copied into the directory they are already in.",
+		})
+		return
+	}
+
+	setLegacyBody(c, gin.H{"location": data.From})
+}
+
+func legacyRenameFile(c *gin.Context) {
+	var data struct {
+		From string `json:"from"`
+		To   string `json:"to"`
+	}
+	if !bindLegacyBody(c, &data) {
+		return
+	}
+
+	setLegacyBody(c, gin.H{"rename_from": data.From, "rename_to": data.To})
+}
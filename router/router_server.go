@@ -2,8 +2,10 @@ package router
 
 import (
 	"bytes"
+	"encoding/json"
 	"github.com/gin-gonic/gin"
 	"github.com/pkg/errors"
+	"github.com/pterodactyl/wings/rcon"
 	"github.com/pterodactyl/wings/server"
 	"go.uber.org/zap"
 	"net/http"
@@ -11,9 +13,127 @@ import (
 	"strconv"
 )
 
-// Returns a single server from the collection of servers.
+// The structured representation of a single server returned by the API. This is kept
+// separate from the server struct itself so that internal changes to that struct do not
+// change the shape of the response.
+type serverDetails struct {
+	Uuid  string `json:"uuid"`
+	State string `json:"state"`
+
+	Name        string   `json:"name"`
+	Description string   `json:"description"`
+	Tags        []string `json:"tags"`
+
+	Suspended       bool `json:"suspended"`
+	Installing      bool `json:"installing"`
+	RequiresRebuild bool `json:"requires_rebuild"`
+
+	// The health reported by the healthcheck for the server, if it has one and is running.
+	Health string `json:"health,omitempty"`
+
+	// Set if the server was killed the last time it was started for taking too long to start.
+	StartupFailed bool `json:"startup_failed"`
+
+	// The name of the environment driver the server is running in, such as "docker".
+	Environment string `json:"environment"`
+
+	Configuration serverConfiguration  `json:"configuration"`
+	Limits        server.BuildSettings `json:"limits"`
+	Allocations   server.Allocations   `json:"allocations"`
+	Resources     server.ResourceUsage `json:"resources"`
+
+	// The outcome of the last installation process run for the server, if known.
+	LastInstall *server.InstallRecord `json:"last_install"`
+
+	// The operation running for the server and those waiting to run after it.
+	Operations server.OperationState `json:"operations"`
+
+	// Only included when requested, see getServer.
+	Stats *server.ResourceUsage `json:"stats,omitempty"`
+}
+
+// The configuration used when running the server process.
+type serverConfiguration struct {
+	Invocation     string                `json:"invocation"`
+	Image          string                `json:"image"`
+	Platform       string                `json:"platform"`
+	OomDisabled    bool                  `json:"oom_disabled"`
+	Variables      map[string]string     `json:"variables,omitempty"`
+	CrashDetection server.CrashDetection `json:"crash_detection"`
+	ProtectedFiles []string              `json:"protected_files"`
+}
+
+// Builds the structured details for a server. The variables of the server often contain
+// secrets such as database passwords, so they are only included when requested by a key
+// with the admin scope.
+func newServerDetails(s *server.Server, variables bool) *serverDetails {
+	d := &serverDetails{
+		Uuid:            s.Uuid,
+		State:           s.GetState(),
+		Name:            s.Meta.Name,
+		Description:     s.Meta.Description,
+		Tags:            s.Tags,
+		Suspended:       s.Suspended,
+		Installing:      s.IsInstalling(),
+		RequiresRebuild: s.RequiresRebuild(),
+		Health:          s.Health(),
+		StartupFailed:   s.StartupFailed(),
+		Configuration: serverConfiguration{
+			Invocation:     s.Invocation,
+			Image:          s.ContainerImage(),
+			Platform:       s.ContainerPlatform(),
+			OomDisabled:    s.Container.OomDisabled,
+			CrashDetection: s.CrashDetection,
+			ProtectedFiles: s.ProtectedFiles,
+		},
+		Limits:      s.Build,
+		Allocations: s.Allocations,
+		Resources:   s.GetResources(),
+		Operations:  s.Operations(),
+	}
+
+	if variables {
+		d.Configuration.Variables = s.EnvVars
+	}
+
+	if s.Environment != nil {
+		d.Environment = s.Environment.Type()
+	}
+
+	if r, err := s.LastInstall(); err != nil {
+		zap.S().Warnw("failed to read server install state", zap.String("server", s.Uuid), zap.Error(err))
+	} else {
+		d.LastInstall = r
+	}
+
+	return d
+}
+
+// Returns a single server from the collection of servers. If "include" contains "stats"
+// the current resource usage is gathered for the server, including its disk usage.
 func getServer(c *gin.Context) {
-	c.JSON(http.StatusOK, GetServer(c.Param("server")))
+	s := GetServer(c.Param("server"))
+
+	d := newServerDetails(s, hasScope(c, ScopeAdmin))
+	if includes(c, "stats") {
+		usage := server.GatherResourceUsage([]*server.Server{s}, 1)[s.Uuid]
+		d.Stats = &usage
+	}
+
+	c.JSON(http.StatusOK, d)
+}
+
+// Returns the resource usage of a server that has been saved over the last day.
+func getServerStatsHistory(c *gin.Context) {
+	s := GetServer(c.Param("server"))
+
+	samples, err := s.StatsHistory()
+	if err != nil {
+		TrackedServerError(err, s).AbortWithServerError(c)
+		return
+	}
+
+	c.JSON(http.StatusOK, samples)
 }
 
 // Returns the logs for a given server instance.
@@ -34,6 +154,31 @@ func getServerLogs(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{"data": out})
 }
 
+// Returns the output of the last installation process run for a server.
+func getServerInstallLogs(c *gin.Context) {
+	s := GetServer(c.Param("server"))
+
+	l, _ := strconv.ParseInt(c.DefaultQuery("size", "65536"), 10, 64)
+	if l <= 0 {
+		l = 65536
+	}
+
+	out, err := s.ReadInstallLog(l)
+	if err != nil {
+		if os.IsNotExist(err) {
+			c.AbortWithStatusJSON(http.StatusNotFound, gin.H{
+				"error": "There are no installation logs for this server.",
+			})
+			return
+		}
+
+		TrackedServerError(err, s).AbortWithServerError(c)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": out})
+}
+
 // Handles a request to control the power state of a server. If the action being passed
 // through is invalid a 404 is returned. Otherwise, a HTTP/202 Accepted response is returned
 // and the actual power action is run asynchronously so that we don't have to block the
@@ -61,6 +206,10 @@ func postServerPower(c *gin.Context) {
 	//
 	// We don't really care about any of the other actions at this point, they'll all result
 	// in the process being stopped, which should have happened anyways if the server is suspended.
+	if (data.Action == "start" || data.Action == "restart") && abortIfMaintenance(c) {
+		return
+	}
+
 	if (data.Action == "start" || data.Action == "restart") && s.Suspended {
 		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
 			"error": "Cannot start or restart a server that is suspended.",
@@ -68,22 +217,75 @@ func postServerPower(c *gin.Context) {
 		return
 	}
 
-	// Pass the actual heavy processing off to a seperate thread to handle so that
-	// we can immediately return a response from the server. Some of these actions
-	// can take quite some time, especially stopping or restarting.
-	go func() {
-		if err := s.HandlePowerAction(data); err != nil {
-			zap.S().Errorw(
-				"encountered an error processing a server power action",
-				zap.String("server", s.Uuid),
-				zap.Error(err),
-			)
-		}
-	}()
+	// Pass the actual heavy processing off to the power queue so that we can immediately
+	// return a response from the server. Some of these actions can take quite some time,
+	// especially stopping or restarting.
+	if err := s.QueuePowerAction(data); err != nil {
+		abortWithOperationError(c, s, err)
+		return
+	}
 
 	c.Status(http.StatusAccepted)
 }
 
+// The power action to run for every server with all of the given tags.
+type bulkPowerRequest struct {
+	Action string   `json:"action"`
+	Tags   []string `json:"tags"`
+}
+
+// Changes the power state of every server with all of the tags provided. At least one tag
+// is required so that every server on the node is not acted on by mistake. Servers that
+// the action cannot be queued for, such as suspended servers being started, are skipped
+// and returned along with the reason.
+func postServersPower(c *gin.Context) {
+	var data bulkPowerRequest
+	if err := c.BindJSON(&data); err != nil {
+		return
+	}
+
+	action := server.PowerAction{Action: data.Action}
+	if !action.IsValid() {
+		c.AbortWithStatusJSON(http.StatusUnprocessableEntity, gin.H{
+			"error": "The power action provided was not valid, should be one of \"stop\", \"start\", \"restart\", \"kill\"",
+		})
+		return
+	}
+
+	if len(data.Tags) == 0 {
+		c.AbortWithStatusJSON(http.StatusUnprocessableEntity, gin.H{
+			"error": "At least one tag must be provided to select the servers to act on.",
+		})
+		return
+	}
+
+	starting := action.Action == "start" || action.Action == "restart"
+	if starting && abortIfMaintenance(c) {
+		return
+	}
+
+	queued := []string{}
+	skipped := make(map[string]string)
+	for _, s := range server.GetServers().Filter(func(s *server.Server) bool { return s.HasTags(data.Tags) }) {
+		if starting && s.Suspended {
+			skipped[s.Uuid] = "Cannot start or restart a server that is suspended."
+			continue
+		}
+
+		if err := s.QueuePowerAction(action); err != nil {
+			skipped[s.Uuid] = err.Error()
+			continue
+		}
+
+		queued = append(queued, s.Uuid)
+	}
+
+	c.JSON(http.StatusAccepted, gin.H{
+		"queued":  queued,
+		"skipped": skipped,
+	})
+}
+
 // Sends an array of commands to a running server instance.
 func postServerCommands(c *gin.Context) {
 	s := GetServer(c.Param("server"))
@@ -101,6 +303,18 @@ func postServerCommands(c *gin.Context) {
 	var data struct{ Commands []string `json:"commands"` }
 	c.BindJSON(&data)
 
+	// None of the commands are sent if any of them are denied, so that a partial sequence
+	// of commands is never run.
+	for _, command := range data.Commands {
+		if err := s.CheckCommand(command, server.CommandSourceApi); err != nil {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{
+				"error":   "A command provided is not allowed to be sent to this server.",
+				"command": command,
+			})
+			return
+		}
+	}
+
 	for _, command := range data.Commands {
 		if err := s.Environment.SendCommand(command); err != nil {
 			zap.S().Warnw(
@@ -115,6 +329,64 @@ func postServerCommands(c *gin.Context) {
 	c.Status(http.StatusNoContent)
 }
 
+// Relays a command to the server process over RCON and returns the response. This allows
+// the Panel to make use of RCON without the port needing to be publicly accessible.
+func postServerRcon(c *gin.Context) {
+	s := GetServer(c.Param("server"))
+
+	var data struct {
+		Command string `json:"command"`
+	}
+	c.BindJSON(&data)
+
+	if data.Command == "" {
+		c.AbortWithStatusJSON(http.StatusUnprocessableEntity, gin.H{
+			"error": "A command must be provided.",
+		})
+		return
+	}
+
+	if running, err := s.Environment.IsRunning(); err != nil {
+		TrackedServerError(err, s).AbortWithServerError(c)
+		return
+	} else if !running {
+		c.AbortWithStatusJSON(http.StatusBadGateway, gin.H{
+			"error": "Cannot send commands to a stopped server instance.",
+		})
+		return
+	}
+
+	if err := s.CheckCommand(data.Command, server.CommandSourceRcon); err != nil {
+		c.AbortWithStatusJSON(http.StatusForbidden, gin.H{
+			"error":   "The command provided is not allowed to be sent to this server.",
+			"command": data.Command,
+		})
+		return
+	}
+
+	out, err := s.ExecuteRconCommand(data.Command)
+	if err != nil {
+		if server.IsRconNotConfiguredError(err) {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+				"error": "RCON is not configured for this server.",
+			})
+			return
+		}
+
+		if rcon.IsInvalidPasswordError(err) {
+			c.AbortWithStatusJSON(http.StatusBadGateway, gin.H{
+				"error": "The RCON password configured for this server was rejected.",
+			})
+			return
+		}
+
+		TrackedServerError(err, s).SetMessage("Failed to send the command to the server over RCON.").AbortWithStatus(http.StatusBadGateway, c)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"response": out})
+}
+
 // Updates information about a server internally.
 func patchServer(c *gin.Context) {
 	s := GetServer(c.Param("server"))
@@ -122,7 +394,57 @@ func patchServer(c *gin.Context) {
 	buf := bytes.Buffer{}
 	buf.ReadFrom(c.Request.Body)
 
+	// Any variables being changed are checked against the egg rules, using the rules sent
+	// along with them if there are any, before anything is merged into the server.
+	var data struct {
+		EnvVars       map[string]string `json:"environment"`
+		VariableRules map[string]string `json:"variable_rules"`
+		Build         struct {
+			MemoryLimit int64 `json:"memory_limit"`
+			DiskSpace   int64 `json:"disk_space"`
+		} `json:"build"`
+	}
+	decoded := json.Unmarshal(buf.Bytes(), &data) == nil
+	if decoded && len(data.EnvVars) > 0 {
+		rules := data.VariableRules
+		if rules == nil {
+			rules = s.VariableRules
+		}
+
+		if err := server.ValidateVariables(rules, data.EnvVars); err != nil {
+			c.AbortWithStatusJSON(http.StatusUnprocessableEntity, gin.H{
+				"error":  "The variables provided in the request could not be validated.",
+				"errors": err.(*server.VariableValidationError).Fields,
+			})
+			return
+		}
+	}
+
+	// Limits left out of the request are not changed, since only the values sent are merged
+	// into the server.
+	if decoded && (data.Build.MemoryLimit != 0 || data.Build.DiskSpace != 0) {
+		memory, disk := s.Build.MemoryLimit, s.Build.DiskSpace
+		if data.Build.MemoryLimit != 0 {
+			memory = data.Build.MemoryLimit
+		}
+		if data.Build.DiskSpace != 0 {
+			disk = data.Build.DiskSpace
+		}
+
+		if abortIfCapacityError(c, server.ReserveCapacity(s.Uuid, memory, disk)) {
+			return
+		}
+		defer server.ReleaseCapacity(s.Uuid)
+	}
+
 	if err := s.UpdateDataStructure(buf.Bytes(), true); err != nil {
+		if server.IsAllocationConflictError(err) {
+			c.AbortWithStatusJSON(http.StatusConflict, gin.H{
+				"error": err.Error(),
+			})
+			return
+		}
+
 		TrackedServerError(err, s).AbortWithServerError(c)
 		return
 	}
@@ -130,36 +452,73 @@ func patchServer(c *gin.Context) {
 	c.Status(http.StatusNoContent)
 }
 
+// Fetches the latest configuration for the server from the Panel and applies it, returning
+// the updated details for the server.
+func postServerSync(c *gin.Context) {
+	s := GetServer(c.Param("server"))
+
+	if err := s.Reconcile(); err != nil {
+		if server.IsServerDoesNotExistError(err) {
+			c.AbortWithStatusJSON(http.StatusNotFound, gin.H{
+				"error": "The Panel reported that this server does not exist.",
+			})
+			return
+		}
+
+		TrackedServerError(err, s).AbortWithServerError(c)
+		return
+	}
+
+	c.JSON(http.StatusOK, newServerDetails(s, true))
+}
+
 // Performs a server installation in a background thread.
 func postServerInstall(c *gin.Context) {
+	if abortIfMaintenance(c) {
+		return
+	}
+
 	s := GetServer(c.Param("server"))
 
-	go func(serv *server.Server) {
-		if err := serv.Install(); err != nil {
-			zap.S().Errorw(
-				"failed to execute server installation process",
-				zap.String("server", serv.Uuid),
-				zap.Error(err),
-			)
-		}
-	}(s)
+	if err := s.QueueOperation(server.OperationInstall, s.Install); err != nil {
+		abortWithOperationError(c, s, err)
+		return
+	}
 
 	c.Status(http.StatusAccepted)
 }
 
-// Reinstalls a server.
+// Reinstalls a server. The request body can optionally contain the options for the
+// reinstall, allowing the existing files to be wiped while keeping anything matched by
+// the provided patterns.
 func postServerReinstall(c *gin.Context) {
+	if abortIfMaintenance(c) {
+		return
+	}
+
 	s := GetServer(c.Param("server"))
 
-	go func(serv *server.Server) {
-		if err := serv.Reinstall(); err != nil {
-			zap.S().Errorw(
-				"failed to complete server reinstall process",
-				zap.String("server", serv.Uuid),
-				zap.Error(err),
-			)
+	var opts server.ReinstallOptions
+	if c.Request.ContentLength != 0 {
+		if err := c.BindJSON(&opts); err != nil {
+			return
 		}
-	}(s)
+	}
+
+	if err := opts.Validate(); err != nil {
+		c.AbortWithStatusJSON(http.StatusUnprocessableEntity, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	err := s.QueueOperation(server.OperationReinstall, func() error {
+		return s.Reinstall(opts)
+	})
+	if err != nil {
+		abortWithOperationError(c, s, err)
+		return
+	}
 
 	c.Status(http.StatusAccepted)
 }
@@ -171,6 +530,7 @@ func deleteServer(c *gin.Context) {
 	// Immediately suspend the server to prevent a user from attempting
 	// to start it while this process is running.
 	s.Suspended = true
+	s.DisableWakeOnConnect()
 
 	// Delete the server's archive if it exists. We intentionally don't return
 	// here, if the archive fails to delete, the server can still be removed.
@@ -185,17 +545,61 @@ func deleteServer(c *gin.Context) {
 		TrackedServerError(err, s).AbortWithServerError(c)
 	}
 
+	// Stop tracking the disk usage of the server before its files are removed, otherwise
+	// every directory removed would need to be processed.
+	s.Filesystem.StopUsageTracking()
+
 	// Once the environment is terminated, remove the server files from the system. This is
 	// done in a separate process since failure is not the end of the world and can be
 	// manually cleaned up after the fact.
 	//
 	// In addition, servers with large amounts of files can take some time to finish deleting
 	// so we don't want to block the HTTP call while waiting on this.
-	go func(p string) {
-		if err := os.RemoveAll(p); err != nil {
-			zap.S().Warnw("failed to remove server files during deletion process", zap.String("path", p), zap.Error(errors.WithStack(err)))
+	go func(fs server.Filesystem) {
+		if err := os.RemoveAll(fs.Path()); err != nil {
+			zap.S().Warnw("failed to remove server files during deletion process", zap.String("path", fs.Path()), zap.Error(errors.WithStack(err)))
+		}
+
+		if err := fs.PurgeVersions(); err != nil {
+			zap.S().Warnw("failed to remove saved file versions during deletion process", zap.String("server", fs.Server.Uuid), zap.Error(err))
 		}
-	}(s.Filesystem.Path())
+	}(s.Filesystem)
+
+	if err := s.RemovePersistedConfiguration(); err != nil {
+		zap.S().Warnw("failed to remove persisted server configuration during deletion process", zap.String("server", s.Uuid), zap.Error(err))
+	}
+
+	if err := s.RemoveSelectedImage(); err != nil {
+		zap.S().Warnw("failed to remove selected server image during deletion process", zap.String("server", s.Uuid), zap.Error(err))
+	}
+
+	if err := s.RemoveInstallRecord(); err != nil {
+		zap.S().Warnw("failed to remove server install state during deletion process", zap.String("server", s.Uuid), zap.Error(err))
+	}
+
+	if err := s.RemoveInstallLog(); err != nil {
+		zap.S().Warnw("failed to remove server install log during deletion process", zap.String("server", s.Uuid), zap.Error(err))
+	}
+
+	if err := s.RemoveMacros(); err != nil {
+		zap.S().Warnw("failed to remove server command macros during deletion process", zap.String("server", s.Uuid), zap.Error(err))
+	}
+
+	if err := s.RemoveStatsHistory(); err != nil {
+		zap.S().Warnw("failed to remove server stats history during deletion process", zap.String("server", s.Uuid), zap.Error(err))
+	}
+
+	if err := s.RemoveGitRepositories(); err != nil {
+		zap.S().Warnw("failed to remove server git repositories during deletion process", zap.String("server", s.Uuid), zap.Error(err))
+	}
+
+	if err := s.CloseFirewall(); err != nil {
+		zap.S().Warnw("failed to close server allocations in firewall during deletion process", zap.String("server", s.Uuid), zap.Error(err))
+	}
+
+	// Cancels the transfer of the server if one is somehow still running, which is usually
+	// not the case as the Panel deletes the server from this node once it has been sent.
+	server.RemoveTransfer(s.Uuid)
 
 	var uuid = s.Uuid
 	server.GetServers().Remove(func(s2 *server.Server) bool {
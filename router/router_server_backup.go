@@ -3,7 +3,6 @@ package router
 import (
 	"github.com/gin-gonic/gin"
 	"github.com/pterodactyl/wings/server"
-	"go.uber.org/zap"
 	"net/http"
 	"os"
 )
@@ -18,11 +17,11 @@ func postServerBackup(c *gin.Context) {
 	}
 	c.BindJSON(&data)
 
-	go func(backup *server.Backup) {
-		if err := backup.BackupAndNotify(); err != nil {
-			zap.S().Errorw("failed to generate backup for server", zap.Error(err))
-		}
-	}(s.NewBackup(data.Uuid, data.IgnoredFiles))
+	b := s.NewBackup(data.Uuid, data.IgnoredFiles)
+	if err := s.QueueOperation(server.OperationBackup, b.BackupAndNotify); err != nil {
+		abortWithOperationError(c, s, err)
+		return
+	}
 
 	c.Status(http.StatusAccepted)
 }
@@ -2,10 +2,20 @@ package router
 
 import (
 	"bufio"
+	"bytes"
+	"context"
 	"github.com/gin-gonic/gin"
+	"github.com/pkg/errors"
+	"github.com/pterodactyl/wings/config"
+	"github.com/pterodactyl/wings/server"
+	"go.uber.org/zap"
+	"io/ioutil"
 	"net/http"
 	"os"
+	"path/filepath"
 	"strconv"
+	"strings"
+	"time"
 )
 
 // Returns the contents of a file on the server.
@@ -32,7 +42,25 @@ func getServerFileContents(c *gin.Context) {
 		return
 	}
 
-	f, err := os.Open(cleaned)
+	if etag, modified := server.FileETag(st.Info); checkNotModified(c, etag, modified) {
+		return
+	}
+
+	// Files being opened in the editor must be small enough, and not binary, otherwise the
+	// Panel would end up trying to load something like a world file into the browser.
+	if c.Query("download") == "" {
+		if err := s.Filesystem.IsEditable(c.Query("file")); err != nil {
+			if server.IsEditableFileError(err) {
+				c.AbortWithStatusJSON(http.StatusUnprocessableEntity, err)
+				return
+			}
+
+			TrackedServerError(err, s).AbortWithServerError(c)
+			return
+		}
+	}
+
+	f, err := s.Filesystem.OpenFile(cleaned, os.O_RDONLY, 0)
 	if err != nil {
 		TrackedServerError(err, s).AbortWithServerError(c)
 		return
@@ -40,38 +68,160 @@ func getServerFileContents(c *gin.Context) {
 	defer f.Close()
 
 	c.Header("X-Mime-Type", st.Mimetype)
-	c.Header("Content-Length", strconv.Itoa(int(st.Info.Size())))
 
 	// If a download parameter is included in the URL go ahead and attach the necessary headers
 	// so that the file can be downloaded.
 	if c.Query("download") != "" {
+		c.Header("Content-Length", strconv.Itoa(int(st.Info.Size())))
 		c.Header("Content-Disposition", "attachment; filename="+st.Info.Name())
 		c.Header("Content-Type", "application/octet-stream")
+
+		bufio.NewReader(f).WriteTo(c.Writer)
+		return
 	}
 
-	bufio.NewReader(f).WriteTo(c.Writer)
+	// Files opened in the editor are always sent as UTF-8, along with the encoding they
+	// were stored in so that they can be written back using the same encoding.
+	b, err := ioutil.ReadAll(f)
+	if err != nil {
+		TrackedServerError(err, s).AbortWithServerError(c)
+		return
+	}
+
+	enc := server.DetectEncoding(b)
+	if b, err = server.DecodeText(b, enc); err != nil {
+		TrackedServerError(err, s).AbortWithServerError(c)
+		return
+	}
+
+	c.Header("X-File-Encoding", enc)
+	c.Header("Content-Length", strconv.Itoa(len(b)))
+	c.Writer.Write(b)
 }
 
-// Returns the contents of a directory for a server.
+// Returns the contents of a directory for a server. The entries can be filtered using a
+// glob pattern in "filter", sorted using "sort" and "order", and paginated using "offset"
+// and "limit", with the total number of matching entries returned in the X-Total-Count
+// header.
 func getServerListDirectory(c *gin.Context) {
 	s := GetServer(c.Param("server"))
 
-	stats, err := s.Filesystem.ListDirectory(c.Query("directory"))
+	// Building the listing requires detecting the type of every file, so check if the
+	// directory has changed at all before doing that work.
+	etag, modified, err := s.Filesystem.DirectoryETag(c.Query("directory"))
+	if err != nil {
+		TrackedServerError(err, s).AbortWithServerError(c)
+		return
+	}
+
+	if checkNotModified(c, etag, modified) {
+		return
+	}
+
+	offset, err := strconv.Atoi(c.DefaultQuery("offset", "0"))
+	if err != nil || offset < 0 {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error": "The offset provided must be a positive integer.",
+		})
+		return
+	}
+
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "0"))
+	if err != nil || limit < 0 {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error": "The limit provided must be a positive integer.",
+		})
+		return
+	}
+
+	opts := server.ListOptions{
+		Filter:     c.Query("filter"),
+		Descending: c.Query("order") == "desc",
+		Offset:     offset,
+		Limit:      limit,
+	}
+
+	// Listings are sorted by name in descending order unless a sort or order is asked for.
+	switch c.Query("sort") {
+	case "":
+		if c.Query("order") != "" {
+			opts.Sort = server.ListSortName
+		}
+	case server.ListSortName:
+		opts.Sort = server.ListSortName
+	case server.ListSortSize:
+		opts.Sort = server.ListSortSize
+	case server.ListSortModified, "mtime":
+		opts.Sort = server.ListSortModified
+	default:
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error": "The sort field must be one of \"name\", \"size\" or \"modified\".",
+		})
+		return
+	}
+
+	if _, err := filepath.Match(opts.Filter, ""); err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error": "The filter provided is not a valid glob pattern.",
+		})
+		return
+	}
+
+	stats, total, err := s.Filesystem.ListDirectory(c.Query("directory"), opts)
 	if err != nil {
 		TrackedServerError(err, s).AbortWithServerError(c)
 		return
 	}
 
+	c.Header("X-Total-Count", strconv.Itoa(total))
 	c.JSON(http.StatusOK, stats)
 }
 
+// Searches the server files for names, and optionally contents, matching the query.
+func getServerSearchFiles(c *gin.Context) {
+	s := GetServer(c.Param("server"))
+
+	q := c.Query("query")
+	if len(q) < 3 {
+		c.AbortWithStatusJSON(http.StatusUnprocessableEntity, gin.H{
+			"error": "The search query must be at least 3 characters long.",
+		})
+		return
+	}
+
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "100"))
+	if limit <= 0 {
+		limit = 100
+	} else if limit > 500 {
+		limit = 500
+	}
+
+	content, _ := strconv.ParseBool(c.DefaultQuery("content", "false"))
+
+	// Searching a large number of files can take quite a while, so cap the amount of time
+	// spent on a single request and return whatever has been found at that point.
+	ctx, cancel := context.WithTimeout(c.Request.Context(), time.Second*30)
+	defer cancel()
+
+	results, truncated, err := s.Filesystem.Search(ctx, c.DefaultQuery("directory", "/"), q, content, limit)
+	if err != nil {
+		TrackedServerError(err, s).AbortWithServerError(c)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"data":      results,
+		"truncated": truncated,
+	})
+}
+
 // Renames (or moves) a file for a server.
 func putServerRenameFile(c *gin.Context) {
 	s := GetServer(c.Param("server"))
 
-	var data struct{
+	var data struct {
 		RenameFrom string `json:"rename_from"`
-		RenameTo string `json:"rename_to"`
+		RenameTo   string `json:"rename_to"`
 	}
 	c.BindJSON(&data)
 
@@ -99,7 +249,14 @@ func postServerCopyFile(c *gin.Context) {
 	}
 	c.BindJSON(&data)
 
-	if err := s.Filesystem.Copy(data.Location); err != nil {
+	ctx, cancel := operationContext(c)
+	defer cancel()
+
+	if err := s.Filesystem.Copy(ctx, data.Location); err != nil {
+		if abortIfCancelled(c, ctx) {
+			return
+		}
+
 		TrackedServerError(err, s).AbortWithServerError(c)
 		return
 	}
@@ -128,7 +285,75 @@ func postServerDeleteFile(c *gin.Context) {
 func postServerWriteFile(c *gin.Context) {
 	s := GetServer(c.Param("server"))
 
-	if err := s.Filesystem.Writefile(c.Query("file"), c.Request.Body); err != nil {
+	upload, err := s.Filesystem.BeginUpload()
+	if err != nil {
+		if server.IsTooManyUploadsError(err) {
+			c.AbortWithStatusJSON(http.StatusTooManyRequests, gin.H{
+				"error": "There are too many uploads in progress, please try again shortly.",
+			})
+			return
+		}
+
+		TrackedServerError(err, s).AbortWithServerError(c)
+		return
+	}
+	defer upload.Done()
+
+	b, err := server.ReadEditableContent(upload.Reader(c.Request.Body))
+	if err != nil {
+		if server.IsEditableFileError(err) {
+			c.AbortWithStatusJSON(http.StatusUnprocessableEntity, err)
+			return
+		}
+
+		TrackedServerError(err, s).AbortWithServerError(c)
+		return
+	}
+
+	// Contents are sent from the editor as UTF-8, and are written back using the encoding
+	// requested, or the encoding the file is already stored in.
+	enc := c.Query("encoding")
+	if enc == "" {
+		if enc, err = s.Filesystem.FileEncoding(c.Query("file")); err != nil {
+			TrackedServerError(err, s).AbortWithServerError(c)
+			return
+		}
+	}
+
+	if b, err = server.EncodeText(b, enc); err != nil {
+		if server.IsUnsupportedEncodingError(err) {
+			c.AbortWithStatusJSON(http.StatusUnprocessableEntity, gin.H{
+				"error": err.Error(),
+			})
+			return
+		}
+
+		c.AbortWithStatusJSON(http.StatusUnprocessableEntity, gin.H{
+			"error":    "The contents include characters that cannot be saved using the encoding of the file.",
+			"encoding": enc,
+		})
+		return
+	}
+
+	if err := s.Filesystem.ScanContent(c.Query("file"), b); err != nil {
+		if server.IsInfectedFileError(err) {
+			c.AbortWithStatusJSON(http.StatusUnprocessableEntity, gin.H{
+				"error": "This file was rejected because it was detected as malicious.",
+			})
+			return
+		}
+
+		TrackedServerError(err, s).AbortWithServerError(c)
+		return
+	}
+
+	// Keep a copy of the file as it was before this write so that the change can be rolled
+	// back. Failing to do so should not prevent the file from being saved.
+	if err := s.Filesystem.SaveVersion(c.Query("file")); err != nil {
+		zap.S().Warnw("failed to save previous version of file", zap.String("server", s.Uuid), zap.String("file", c.Query("file")), zap.Error(err))
+	}
+
+	if err := s.Filesystem.Writefile(c.Query("file"), bytes.NewReader(b)); err != nil {
 		TrackedServerError(err, s).AbortWithServerError(c)
 		return
 	}
@@ -152,4 +377,169 @@ func postServerCreateDirectory(c *gin.Context) {
 	}
 
 	c.Status(http.StatusNoContent)
-}
\ No newline at end of file
+}
+
+// Returns the items in the trash for a server.
+func getServerTrash(c *gin.Context) {
+	s := GetServer(c.Param("server"))
+
+	items, err := s.Filesystem.TrashItems()
+	if err != nil {
+		TrackedServerError(err, s).AbortWithServerError(c)
+		return
+	}
+
+	c.JSON(http.StatusOK, items)
+}
+
+// Restores an item in the trash back to its original location.
+func postServerRestoreTrash(c *gin.Context) {
+	s := GetServer(c.Param("server"))
+
+	var data struct {
+		Id string `json:"id"`
+	}
+	c.BindJSON(&data)
+
+	if err := s.Filesystem.RestoreTrashItem(data.Id); err != nil {
+		if server.IsTrashRestoreConflictError(err) {
+			c.AbortWithStatusJSON(http.StatusConflict, gin.H{
+				"error": "A file already exists at the original location of this item.",
+			})
+			return
+		}
+
+		TrackedServerError(err, s).AbortWithServerError(c)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// Permanently removes items from the trash. If no items are provided the entire trash
+// is emptied.
+func postServerPurgeTrash(c *gin.Context) {
+	s := GetServer(c.Param("server"))
+
+	var data struct {
+		Ids []string `json:"ids"`
+	}
+	c.BindJSON(&data)
+
+	if err := s.Filesystem.PurgeTrash(data.Ids); err != nil {
+		TrackedServerError(err, s).AbortWithServerError(c)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// Returns the saved versions of a file on the server.
+func getServerFileVersions(c *gin.Context) {
+	s := GetServer(c.Param("server"))
+
+	versions, err := s.Filesystem.FileVersions(c.Query("file"))
+	if err != nil {
+		TrackedServerError(err, s).AbortWithServerError(c)
+		return
+	}
+
+	c.JSON(http.StatusOK, versions)
+}
+
+// Restores a file on the server to a previously saved version.
+func postServerRestoreFileVersion(c *gin.Context) {
+	s := GetServer(c.Param("server"))
+
+	var data struct {
+		File string `json:"file"`
+		Id   string `json:"id"`
+	}
+
+	if err := c.BindJSON(&data); err != nil {
+		return
+	}
+
+	if data.File == "" || data.Id == "" {
+		c.AbortWithStatusJSON(http.StatusUnprocessableEntity, gin.H{
+			"error": "A file and the ID of the version to restore must be provided.",
+		})
+		return
+	}
+
+	if err := s.Filesystem.RestoreVersion(data.File, data.Id); err != nil {
+		if server.IsVersionNotFoundError(errors.Cause(err)) {
+			c.AbortWithStatusJSON(http.StatusNotFound, gin.H{
+				"error": "The requested version of the file does not exist.",
+			})
+			return
+		}
+
+		TrackedServerError(err, s).AbortWithServerError(c)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// Returns a unified diff between a file and the contents provided, or between two files. This
+// allows the Panel to show what saving a file would change before it is written.
+func postServerDiffFiles(c *gin.Context) {
+	s := GetServer(c.Param("server"))
+
+	// The contents are sent as a JSON string, which can be up to twice as large once it has
+	// been escaped.
+	if max := config.Get().Api.MaxEditableSize * 1024 * 1024; max > 0 {
+		c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, max*2+64*1024)
+	}
+
+	var data struct {
+		File    string  `json:"file"`
+		Content *string `json:"content"`
+		Other   string  `json:"other"`
+	}
+
+	if err := c.BindJSON(&data); err != nil {
+		return
+	}
+
+	if data.File == "" || (data.Content == nil) == (data.Other == "") {
+		c.AbortWithStatusJSON(http.StatusUnprocessableEntity, gin.H{
+			"error": "A file must be provided along with either the contents or another file to compare it to.",
+		})
+		return
+	}
+
+	var diff string
+	var err error
+	if data.Content != nil {
+		var b []byte
+		if b, err = server.ReadEditableContent(strings.NewReader(*data.Content)); err == nil {
+			diff, err = s.Filesystem.Diff(data.File, b)
+		}
+	} else {
+		diff, err = s.Filesystem.DiffFiles(data.File, data.Other)
+	}
+
+	if err != nil {
+		if server.IsEditableFileError(err) {
+			c.AbortWithStatusJSON(http.StatusUnprocessableEntity, err)
+			return
+		}
+
+		if os.IsNotExist(errors.Cause(err)) || errors.Cause(err) == server.InvalidPathResolution {
+			c.AbortWithStatusJSON(http.StatusNotFound, gin.H{
+				"error": "The file requested could not be found.",
+			})
+			return
+		}
+
+		TrackedServerError(err, s).AbortWithServerError(c)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"changed": diff != "",
+		"diff":    diff,
+	})
+}
@@ -0,0 +1,76 @@
+package router
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/pterodactyl/wings/server"
+	"net/http"
+)
+
+// Clones a git repository into a directory within the server.
+func postServerGitClone(c *gin.Context) {
+	s := GetServer(c.Param("server"))
+
+	var data server.GitDeployment
+	c.BindJSON(&data)
+
+	if data.Url == "" {
+		c.AbortWithStatusJSON(http.StatusUnprocessableEntity, gin.H{
+			"error": "A repository URL must be provided.",
+		})
+		return
+	}
+
+	ctx, cancel := operationContext(c)
+	defer cancel()
+
+	out, err := s.GitClone(ctx, data)
+	if err != nil && abortIfCancelled(c, ctx) {
+		return
+	}
+
+	handleGitResponse(c, s, out, err)
+}
+
+// Pulls the latest changes for a repository previously deployed into the server.
+func postServerGitPull(c *gin.Context) {
+	s := GetServer(c.Param("server"))
+
+	var data server.GitDeployment
+	c.BindJSON(&data)
+
+	ctx, cancel := operationContext(c)
+	defer cancel()
+
+	out, err := s.GitPull(ctx, data)
+	if err != nil && abortIfCancelled(c, ctx) {
+		return
+	}
+
+	handleGitResponse(c, s, out, err)
+}
+
+func handleGitResponse(c *gin.Context, s *server.Server, out string, err error) {
+	if err != nil {
+		if server.IsGitOperationInProgressError(err) {
+			c.AbortWithStatusJSON(http.StatusConflict, gin.H{
+				"error": "Another git operation is already running for this server.",
+			})
+			return
+		}
+
+		if err == server.InvalidPathResolution {
+			c.AbortWithStatusJSON(http.StatusNotFound, gin.H{
+				"error": "The directory provided could not be found.",
+			})
+			return
+		}
+
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error":  err.Error(),
+			"output": out,
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"output": out})
+}
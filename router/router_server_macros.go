@@ -0,0 +1,115 @@
+package router
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/pterodactyl/wings/server"
+	"net/http"
+	"sort"
+)
+
+// Lists the command macros defined for a server.
+func getServerMacros(c *gin.Context) {
+	s := GetServer(c.Param("server"))
+
+	macros, err := s.Macros()
+	if err != nil {
+		TrackedServerError(err, s).AbortWithServerError(c)
+		return
+	}
+
+	out := make([]server.CommandMacro, 0, len(macros))
+	for _, m := range macros {
+		out = append(out, m)
+	}
+
+	sort.Slice(out, func(i, j int) bool {
+		return out[i].Name < out[j].Name
+	})
+
+	c.JSON(http.StatusOK, gin.H{"data": out})
+}
+
+// Creates or replaces a command macro for a server.
+func putServerMacro(c *gin.Context) {
+	s := GetServer(c.Param("server"))
+
+	var data struct {
+		Steps []server.MacroStep `json:"steps"`
+	}
+
+	if err := c.BindJSON(&data); err != nil {
+		return
+	}
+
+	m := server.CommandMacro{Name: c.Param("name"), Steps: data.Steps}
+
+	if err := s.SetMacro(m); err != nil {
+		if server.IsMacroValidationError(err) {
+			c.AbortWithStatusJSON(http.StatusUnprocessableEntity, gin.H{
+				"error": err.Error(),
+			})
+			return
+		}
+
+		TrackedServerError(err, s).AbortWithServerError(c)
+		return
+	}
+
+	c.JSON(http.StatusOK, m)
+}
+
+// Removes a command macro from a server.
+func deleteServerMacro(c *gin.Context) {
+	s := GetServer(c.Param("server"))
+
+	if err := s.DeleteMacro(c.Param("name")); err != nil {
+		if server.IsMacroNotFoundError(err) {
+			c.AbortWithStatusJSON(http.StatusNotFound, gin.H{
+				"error": "The requested macro does not exist.",
+			})
+			return
+		}
+
+		TrackedServerError(err, s).AbortWithServerError(c)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// Runs a command macro for a server. The commands are sent in the background, so this
+// returns as soon as the macro has been started.
+func postServerRunMacro(c *gin.Context) {
+	s := GetServer(c.Param("server"))
+
+	if running, err := s.Environment.IsRunning(); err != nil {
+		TrackedServerError(err, s).AbortWithServerError(c)
+		return
+	} else if !running {
+		c.AbortWithStatusJSON(http.StatusBadGateway, gin.H{
+			"error": "Cannot send commands to a stopped server instance.",
+		})
+		return
+	}
+
+	if err := s.RunMacro(c.Param("name")); err != nil {
+		if server.IsMacroNotFoundError(err) {
+			c.AbortWithStatusJSON(http.StatusNotFound, gin.H{
+				"error": "The requested macro does not exist.",
+			})
+			return
+		}
+
+		if server.IsCommandDeniedError(err) {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{
+				"error": "The macro contains a command that is not allowed to be sent to this server.",
+			})
+			return
+		}
+
+		TrackedServerError(err, s).AbortWithServerError(c)
+		return
+	}
+
+	c.Status(http.StatusAccepted)
+}
@@ -0,0 +1,13 @@
+package router
+
+import (
+	"github.com/gin-gonic/gin"
+	"net/http"
+)
+
+// Returns the schedules defined for a server along with the status of their last run.
+func getServerSchedules(c *gin.Context) {
+	s := GetServer(c.Param("server"))
+
+	c.JSON(http.StatusOK, gin.H{"data": s.ScheduleStatuses()})
+}
@@ -0,0 +1,171 @@
+package router
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/pterodactyl/wings/server"
+	"net/http"
+)
+
+// Switches the Docker image used by a server to another image allowed by its egg. The
+// image is pulled before the change is saved, and applies the next time the server is
+// started.
+func putServerImage(c *gin.Context) {
+	s := GetServer(c.Param("server"))
+
+	var data struct {
+		Image string `json:"image"`
+	}
+
+	if err := c.BindJSON(&data); err != nil {
+		return
+	}
+
+	if data.Image == "" {
+		c.AbortWithStatusJSON(http.StatusUnprocessableEntity, gin.H{
+			"error": "An image must be provided.",
+		})
+		return
+	}
+
+	ctx, cancel := operationContext(c)
+	defer cancel()
+
+	if err := s.SetImage(ctx, data.Image); err != nil {
+		if abortIfCancelled(c, ctx) {
+			return
+		}
+
+		if server.IsImageNotAllowedError(err) || server.IsNoMatchingManifestError(err) {
+			c.AbortWithStatusJSON(http.StatusUnprocessableEntity, gin.H{
+				"error": err.Error(),
+			})
+			return
+		}
+
+		TrackedServerError(err, s).SetMessage("Failed to pull the requested image.").AbortWithStatus(http.StatusBadGateway, c)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"image":            s.ContainerImage(),
+		"requires_rebuild": s.RequiresRebuild(),
+	})
+}
+
+// Replaces the startup variables for a server, rewriting its configuration files using
+// the new values. The rendered startup command is returned along with whether or not the
+// server needs to be restarted for the change to take effect.
+func putServerVariables(c *gin.Context) {
+	s := GetServer(c.Param("server"))
+
+	var data struct {
+		Variables map[string]string `json:"variables"`
+	}
+
+	if err := c.BindJSON(&data); err != nil {
+		return
+	}
+
+	restart, err := s.UpdateEnvironmentVariables(data.Variables)
+	if err != nil {
+		if verr, ok := err.(*server.VariableValidationError); ok {
+			c.AbortWithStatusJSON(http.StatusUnprocessableEntity, gin.H{
+				"error":  "The variables provided in the request could not be validated.",
+				"errors": verr.Fields,
+			})
+			return
+		}
+
+		TrackedServerError(err, s).AbortWithServerError(c)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"invocation":       s.RenderedInvocation(),
+		"requires_restart": restart,
+	})
+}
+
+// Updates the build limits for a server, applying them to the running server without a
+// restart where the environment supports it.
+func patchServerBuild(c *gin.Context) {
+	s := GetServer(c.Param("server"))
+
+	var data server.BuildUpdate
+	if err := c.BindJSON(&data); err != nil {
+		return
+	}
+
+	if err := data.Validate(); err != nil {
+		c.AbortWithStatusJSON(http.StatusUnprocessableEntity, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	applied, err := s.UpdateBuild(data)
+	if err != nil {
+		if abortIfCapacityError(c, err) {
+			return
+		}
+
+		TrackedServerError(err, s).AbortWithServerError(c)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"build":            s.Build,
+		"applied":          applied,
+		"requires_rebuild": s.RequiresRebuild(),
+	})
+}
+
+// Updates the name and description of a server, such as when it is renamed in the Panel.
+func patchServerDetails(c *gin.Context) {
+	s := GetServer(c.Param("server"))
+
+	var data server.DetailsUpdate
+	if err := c.BindJSON(&data); err != nil {
+		return
+	}
+
+	if err := data.Validate(); err != nil {
+		c.AbortWithStatusJSON(http.StatusUnprocessableEntity, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	if err := s.UpdateDetails(data); err != nil {
+		TrackedServerError(err, s).AbortWithServerError(c)
+		return
+	}
+
+	c.JSON(http.StatusOK, newServerDetails(s, true))
+}
+
+// Replaces the tags of a server.
+func putServerTags(c *gin.Context) {
+	s := GetServer(c.Param("server"))
+
+	var data struct {
+		Tags []string `json:"tags"`
+	}
+	if err := c.BindJSON(&data); err != nil {
+		return
+	}
+
+	if err := s.SetTags(data.Tags); err != nil {
+		if server.IsInvalidTagsError(err) {
+			c.AbortWithStatusJSON(http.StatusUnprocessableEntity, gin.H{
+				"error": err.Error(),
+			})
+			return
+		}
+
+		TrackedServerError(err, s).AbortWithServerError(c)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"tags": s.Tags})
+}
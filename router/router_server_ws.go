@@ -18,6 +18,8 @@ func getServerWebsocket(c *gin.Context) {
 		return
 	}
 	defer handler.Connection.Close()
+	defer trackWebsocket(handler.Connection)()
+	defer handler.StopWatching()
 
 	// Create a context that can be canceled when the user disconnects from this
 	// socket that will also cancel listeners running in separate threads.
@@ -53,8 +55,54 @@ func getServerWebsocket(c *gin.Context) {
 		}
 
 		if err := handler.HandleInbound(j); err != nil {
+			// Count invalid tokens towards banning the address the same way the API does,
+			// otherwise tokens could be guessed over the websocket without limit.
+			if websocket.IsInvalidTokenError(err) {
+				recordAuthFailure(c)
+			}
+
 			handler.SendErrorJson(err)
 		}
 	}
 }
 
+// Upgrades a connection to the admin websocket, which allows the console and stats of
+// many servers to be followed over a single connection. Every message sent includes the
+// UUID of the server it is for.
+func getAdminWebsocket(c *gin.Context) {
+	handler, err := websocket.GetAdminHandler(c.Writer, c.Request)
+	if err != nil {
+		TrackedError(err).AbortWithServerError(c)
+		return
+	}
+	defer handler.Connection.Close()
+	defer trackWebsocket(handler.Connection)()
+	defer handler.UnsubscribeAll()
+
+	for {
+		j := websocket.AdminMessage{}
+
+		_, p, err := handler.Connection.ReadMessage()
+		if err != nil {
+			if !ws.IsCloseError(
+				err,
+				ws.CloseNormalClosure,
+				ws.CloseGoingAway,
+				ws.CloseNoStatusReceived,
+				ws.CloseServiceRestart,
+				ws.CloseAbnormalClosure,
+			) {
+				zap.S().Warnw("error handling admin websocket message", zap.Error(err))
+			}
+			break
+		}
+
+		if err := json.Unmarshal(p, &j); err != nil {
+			continue
+		}
+
+		if err := handler.HandleInbound(j); err != nil {
+			handler.SendErrorJson(j.Server, err)
+		}
+	}
+}
@@ -0,0 +1,260 @@
+package router
+
+import (
+	"encoding"
+	"encoding/json"
+	"github.com/gin-gonic/gin"
+	"github.com/pterodactyl/wings/system"
+	"net/http"
+	"reflect"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	specOnce sync.Once
+	spec     []byte
+	specErr  error
+)
+
+// Returns an OpenAPI document describing every route served by the daemon, generated from
+// the route table. The document is only generated the first time it is requested since the
+// routes cannot change while the daemon is running.
+func getSpec(c *gin.Context) {
+	specOnce.Do(func() {
+		spec, specErr = json.Marshal(buildSpec(apiRoutes()))
+	})
+
+	if specErr != nil {
+		TrackedError(specErr).AbortWithServerError(c)
+		return
+	}
+
+	c.Data(http.StatusOK, "application/json", spec)
+}
+
+var pathParameterRegex = regexp.MustCompile(`[:*]([A-Za-z0-9_]+)`)
+
+// Builds an OpenAPI 3.0 document from the given routes. Any request and response types
+// defined for a route are converted into schemas that are stored in the components of the
+// document and referenced by the operation.
+func buildSpec(routes []route) gin.H {
+	g := &schemaGenerator{schemas: make(map[string]interface{})}
+	paths := make(map[string]map[string]interface{})
+
+	for _, r := range routes {
+		p := pathParameterRegex.ReplaceAllString(r.Path, "{$1}")
+
+		op := gin.H{
+			"summary":     r.Summary,
+			"operationId": strings.ToLower(r.Method) + operationName(r.Path),
+			"responses": gin.H{
+				"200": g.response(r.Response),
+			},
+		}
+
+		var params []gin.H
+		for _, m := range pathParameterRegex.FindAllStringSubmatch(r.Path, -1) {
+			params = append(params, gin.H{
+				"name":     m[1],
+				"in":       "path",
+				"required": true,
+				"schema":   gin.H{"type": "string"},
+			})
+		}
+		if len(params) > 0 {
+			op["parameters"] = params
+		}
+
+		if r.Request != nil {
+			op["requestBody"] = gin.H{
+				"required": true,
+				"content": gin.H{
+					"application/json": gin.H{"schema": g.schema(reflect.TypeOf(r.Request))},
+				},
+			}
+		}
+
+		if r.Access == accessPublic {
+			op["security"] = []gin.H{}
+		} else {
+			op["x-scope"] = r.Scope
+		}
+
+		if _, ok := paths[p]; !ok {
+			paths[p] = make(map[string]interface{})
+		}
+		paths[p][strings.ToLower(r.Method)] = op
+	}
+
+	return gin.H{
+		"openapi": "3.0.3",
+		"info": gin.H{
+			"title":   "Wings API",
+			"version": system.Version,
+		},
+		"paths": paths,
+		"components": gin.H{
+			"schemas": g.schemas,
+			"securitySchemes": gin.H{
+				"bearerAuth": gin.H{"type": "http", "scheme": "bearer"},
+			},
+		},
+		"security": []gin.H{{"bearerAuth": []string{}}},
+	}
+}
+
+// Converts a route path into a camel cased name that can be used to identify an operation,
+// for example "/api/servers/:server/files/list" becomes "ServersServerFilesList".
+func operationName(path string) string {
+	var b strings.Builder
+	for _, part := range strings.FieldsFunc(path, func(r rune) bool {
+		return r == '/' || r == ':' || r == '*' || r == '-' || r == '_'
+	}) {
+		if part == "api" {
+			continue
+		}
+		b.WriteString(strings.ToUpper(part[:1]) + part[1:])
+	}
+
+	return b.String()
+}
+
+var (
+	timeType          = reflect.TypeOf(time.Time{})
+	jsonMarshalerType = reflect.TypeOf((*json.Marshaler)(nil)).Elem()
+	textMarshalerType = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+)
+
+// Generates JSON schemas for Go types using reflection, following the same rules as the
+// encoding/json package for determining the name of each field.
+type schemaGenerator struct {
+	schemas map[string]interface{}
+}
+
+// Returns the response object for a route that responds with the given type. Routes that
+// do not define a response type are assumed to return an empty body on success.
+func (g *schemaGenerator) response(v interface{}) gin.H {
+	if v == nil {
+		return gin.H{"description": "The request was successful."}
+	}
+
+	return gin.H{
+		"description": "The request was successful.",
+		"content": gin.H{
+			"application/json": gin.H{"schema": g.schema(reflect.TypeOf(v))},
+		},
+	}
+}
+
+// Returns the schema for a type. Named struct types are added to the components of the
+// document and a reference to them is returned instead, which also prevents recursive
+// types from being expanded forever.
+func (g *schemaGenerator) schema(t reflect.Type) gin.H {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	if t == timeType {
+		return gin.H{"type": "string", "format": "date-time"}
+	}
+
+	// Types that marshal themselves cannot be described from their fields, so anything is
+	// allowed for them.
+	if t.Implements(jsonMarshalerType) || reflect.PtrTo(t).Implements(jsonMarshalerType) {
+		return gin.H{}
+	}
+	if t.Implements(textMarshalerType) || reflect.PtrTo(t).Implements(textMarshalerType) {
+		return gin.H{"type": "string"}
+	}
+
+	switch t.Kind() {
+	case reflect.Bool:
+		return gin.H{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return gin.H{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return gin.H{"type": "number"}
+	case reflect.String:
+		return gin.H{"type": "string"}
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return gin.H{"type": "string", "format": "byte"}
+		}
+		return gin.H{"type": "array", "items": g.schema(t.Elem())}
+	case reflect.Map:
+		return gin.H{"type": "object", "additionalProperties": g.schema(t.Elem())}
+	case reflect.Struct:
+		if t.Name() == "" {
+			return g.object(t)
+		}
+
+		name := schemaName(t)
+		if _, ok := g.schemas[name]; !ok {
+			// Reserve the name before generating the schema so that a type that refers to
+			// itself ends up referencing the component rather than recursing.
+			g.schemas[name] = gin.H{}
+			g.schemas[name] = g.object(t)
+		}
+
+		return gin.H{"$ref": "#/components/schemas/" + name}
+	}
+
+	return gin.H{}
+}
+
+// Returns the object schema for a struct, flattening any embedded structs into it in the
+// same way they are when encoded.
+func (g *schemaGenerator) object(t reflect.Type) gin.H {
+	properties := make(map[string]interface{})
+	g.fields(t, properties)
+
+	return gin.H{"type": "object", "properties": properties}
+}
+
+func (g *schemaGenerator) fields(t reflect.Type, properties map[string]interface{}) {
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+
+		tag := f.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+
+		name := strings.Split(tag, ",")[0]
+		if f.Anonymous && name == "" {
+			ft := f.Type
+			if ft.Kind() == reflect.Ptr {
+				ft = ft.Elem()
+			}
+			if ft.Kind() == reflect.Struct {
+				g.fields(ft, properties)
+				continue
+			}
+		}
+
+		if f.PkgPath != "" {
+			continue
+		}
+
+		if name == "" {
+			name = f.Name
+		}
+
+		properties[name] = g.schema(f.Type)
+	}
+}
+
+// Returns the name of the component used for a type, which is the name of the package it
+// is defined in followed by the name of the type, for example "server.BuildUpdate".
+func schemaName(t reflect.Type) string {
+	p := t.PkgPath()
+	if i := strings.LastIndex(p, "/"); i != -1 {
+		p = p[i+1:]
+	}
+
+	return p + "." + t.Name()
+}
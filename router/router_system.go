@@ -2,6 +2,9 @@ package router
 
 import (
 	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
 	"github.com/gin-gonic/gin"
 	"github.com/pterodactyl/wings/config"
 	"github.com/pterodactyl/wings/installer"
@@ -9,6 +12,10 @@ import (
 	"github.com/pterodactyl/wings/system"
 	"go.uber.org/zap"
 	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
 )
 
 // Returns information about the system that wings is running on.
@@ -20,18 +27,254 @@ func getSystemInformation(c *gin.Context) {
 		return
 	}
 
-	c.JSON(http.StatusOK, i)
+	c.JSON(http.StatusOK, struct {
+		*system.Information
+		Platform        string                          `json:"platform"`
+		Maintenance     config.MaintenanceConfiguration `json:"maintenance"`
+		RecoveredPanics uint64                          `json:"recovered_panics"`
+		PowerQueue      server.PowerQueueStats          `json:"power_queue"`
+	}{
+		Information:     i,
+		Platform:        server.NodePlatform(),
+		Maintenance:     config.Get().System.Maintenance,
+		RecoveredPanics: RecoveredPanics(),
+		PowerQueue:      server.GetPowerQueueStats(),
+	})
 }
 
-// Returns all of the servers that are registered and configured correctly on
-// this wings instance.
+// Returns the combined resource usage of every server on the node, along with the capacity
+// of the node and how much of it has been allocated.
+func getSystemUtilization(c *gin.Context) {
+	c.JSON(http.StatusOK, server.GatherNodeUtilization(server.GetServers().All(), statsConcurrency))
+}
+
+// Returns the health of the daemon. This is not authenticated so that it can be used by
+// load balancers and monitoring systems.
+func getHealth(c *gin.Context) {
+	m := config.Get().System.Maintenance
+
+	status := "ok"
+	if m.Enabled {
+		status = "maintenance"
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"status":      status,
+		"maintenance": m.Enabled,
+	})
+}
+
+// Puts the node into, or takes it out of, maintenance mode. Servers that are already
+// running are not affected.
+func putMaintenanceMode(c *gin.Context) {
+	var data config.MaintenanceConfiguration
+	if err := c.BindJSON(&data); err != nil {
+		return
+	}
+
+	if err := config.SetMaintenanceMode(data.Enabled, data.Message); err != nil {
+		TrackedError(err).AbortWithServerError(c)
+		return
+	}
+
+	zap.S().Infow("changed node maintenance mode", zap.Bool("enabled", data.Enabled), zap.String("message", data.Message))
+
+	c.JSON(http.StatusOK, config.Get().System.Maintenance)
+}
+
+// Aborts the request with an error if the node is in maintenance mode, returning true if
+// the request was aborted.
+func abortIfMaintenance(c *gin.Context) bool {
+	if err := server.CheckMaintenanceMode(); err != nil {
+		c.AbortWithStatusJSON(http.StatusServiceUnavailable, gin.H{
+			"error": err.Error(),
+		})
+		return true
+	}
+
+	return false
+}
+
+// Returns the servers that are registered and configured correctly on this wings
+// instance. The servers can be filtered using the "state", "tag" and "uuid" query parameters,
+// where state is a comma separated list of states, tag is a comma separated list of tags
+// that servers must all have, and uuid is a prefix to match. The
+// results are sorted by UUID and can be paginated using "page" and "per_page", with the
+// total number of matching servers returned in the X-Total-Count header. If "fields" is
+// provided only those top-level fields are returned for each server, and if "include"
+// contains "stats" the current resource usage of each server is included as well.
+//
+// Servers are encoded one at a time as the response is written so that nodes with a
+// large number of servers do not need to build the entire response in memory.
 func getAllServers(c *gin.Context) {
-	c.JSON(http.StatusOK, server.GetServers().All())
+	page, err := strconv.Atoi(c.DefaultQuery("page", "1"))
+	if err != nil || page < 1 {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error": "The page provided must be a positive integer.",
+		})
+		return
+	}
+
+	perPage, err := strconv.Atoi(c.DefaultQuery("per_page", "0"))
+	if err != nil || perPage < 0 {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error": "The number of servers per page must be a positive integer.",
+		})
+		return
+	}
+
+	var states []string
+	if c.Query("state") != "" {
+		states = strings.Split(c.Query("state"), ",")
+	}
+
+	var fields []string
+	if c.Query("fields") != "" {
+		fields = strings.Split(c.Query("fields"), ",")
+	}
+
+	var tags []string
+	if c.Query("tag") != "" {
+		tags = strings.Split(c.Query("tag"), ",")
+	}
+
+	prefix := c.Query("uuid")
+	servers := server.GetServers().Filter(func(s *server.Server) bool {
+		if !strings.HasPrefix(s.Uuid, prefix) || !s.HasTags(tags) {
+			return false
+		}
+
+		if len(states) == 0 {
+			return true
+		}
+
+		state := s.GetState()
+		for _, v := range states {
+			if v == state {
+				return true
+			}
+		}
+
+		return false
+	})
+
+	sort.Slice(servers, func(i, j int) bool {
+		return servers[i].Uuid < servers[j].Uuid
+	})
+
+	c.Header("X-Total-Count", strconv.Itoa(len(servers)))
+	if perPage > 0 {
+		c.Header("X-Page", strconv.Itoa(page))
+		c.Header("X-Per-Page", strconv.Itoa(perPage))
+
+		start := (page - 1) * perPage
+		if start > len(servers) {
+			start = len(servers)
+		}
+
+		end := start + perPage
+		if end > len(servers) {
+			end = len(servers)
+		}
+
+		servers = servers[start:end]
+	}
+
+	var stats map[string]server.ResourceUsage
+	if includes(c, "stats") {
+		stats = server.GatherResourceUsage(servers, statsConcurrency)
+	}
+
+	c.Header("Content-Type", "application/json; charset=utf-8")
+	c.Status(http.StatusOK)
+
+	variables := hasScope(c, ScopeAdmin)
+
+	c.Writer.WriteString("[")
+	for i, s := range servers {
+		var usage *server.ResourceUsage
+		if u, ok := stats[s.Uuid]; ok {
+			usage = &u
+		}
+
+		b, err := encodeServer(s, fields, usage, variables)
+		if err != nil {
+			// The response has already been started at this point, so the only thing that
+			// can be done is to log the failure and stop sending data.
+			zap.S().Errorw("failed to encode server for listing", zap.String("server", s.Uuid), zap.Error(err))
+			return
+		}
+
+		if i > 0 {
+			c.Writer.WriteString(",")
+		}
+		c.Writer.Write(b)
+		c.Writer.Flush()
+	}
+	c.Writer.WriteString("]")
+}
+
+// The maximum number of servers that resource usage is gathered for at once when stats
+// are included in a response.
+const statsConcurrency = 8
+
+// Determines if the given value was requested using the comma separated "include" query
+// parameter.
+func includes(c *gin.Context, v string) bool {
+	for _, i := range strings.Split(c.Query("include"), ",") {
+		if i == v {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Encodes a server to JSON, only including the given top-level fields if any are provided.
+// If resource usage is provided it is included as the "stats" field. The environment
+// variables of the server are removed unless variables is true, since they often contain
+// secrets that keys without the admin scope should not see.
+func encodeServer(s *server.Server, fields []string, stats *server.ResourceUsage, variables bool) ([]byte, error) {
+	b, err := json.Marshal(s)
+	if err != nil || (len(fields) == 0 && stats == nil && variables) {
+		return b, err
+	}
+
+	var m map[string]json.RawMessage
+	if err := json.Unmarshal(b, &m); err != nil {
+		return nil, err
+	}
+
+	if !variables {
+		delete(m, "environment")
+	}
+
+	out := m
+	if len(fields) > 0 {
+		out = make(map[string]json.RawMessage, len(fields))
+		for _, f := range fields {
+			if v, ok := m[f]; ok {
+				out[f] = v
+			}
+		}
+	}
+
+	if stats != nil {
+		if out["stats"], err = json.Marshal(stats); err != nil {
+			return nil, err
+		}
+	}
+
+	return json.Marshal(out)
 }
 
 // Creates a new server on the wings daemon and begins the installation process
 // for it.
 func postCreateServer(c *gin.Context) {
+	if abortIfMaintenance(c) {
+		return
+	}
+
 	buf := bytes.Buffer{}
 	buf.ReadFrom(c.Request.Body)
 
@@ -44,6 +287,17 @@ func postCreateServer(c *gin.Context) {
 			return
 		}
 
+		if server.IsAllocationConflictError(err) {
+			c.AbortWithStatusJSON(http.StatusConflict, gin.H{
+				"error": err.Error(),
+			})
+			return
+		}
+
+		if abortIfCapacityError(c, err) {
+			return
+		}
+
 		TrackedError(err).AbortWithServerError(c)
 		return
 	}
@@ -70,6 +324,55 @@ func postCreateServer(c *gin.Context) {
 	c.Status(http.StatusAccepted)
 }
 
+// Imports an existing server into the daemon, using either a directory or the data mount of
+// an existing container for its files. Once the files are in place the environment for the
+// server is created in the background, without running the installation process.
+func postImportServer(c *gin.Context) {
+	if abortIfMaintenance(c) {
+		return
+	}
+
+	buf := bytes.Buffer{}
+	buf.ReadFrom(c.Request.Body)
+
+	i, err := installer.NewImport(buf.Bytes())
+	if err != nil {
+		if installer.IsValidationError(err) {
+			c.AbortWithStatusJSON(http.StatusUnprocessableEntity, gin.H{
+				"error": err.Error(),
+			})
+			return
+		}
+
+		if server.IsAllocationConflictError(err) {
+			c.AbortWithStatusJSON(http.StatusConflict, gin.H{
+				"error": err.Error(),
+			})
+			return
+		}
+
+		if abortIfCapacityError(c, err) {
+			return
+		}
+
+		TrackedError(err).AbortWithServerError(c)
+		return
+	}
+
+	server.GetServers().Add(i.Server())
+
+	go func(i *installer.Installer) {
+		if err := i.Adopt(); err != nil {
+			zap.S().Errorw("failed to import server", zap.String("server", i.Uuid()), zap.Error(err))
+			return
+		}
+
+		zap.S().Infow("imported existing server", zap.String("server", i.Uuid()))
+	}(i)
+
+	c.Status(http.StatusAccepted)
+}
+
 // Updates the running configuration for this daemon instance.
 func postUpdateConfiguration(c *gin.Context) {
 	// A backup of the configuration for error purposes.
@@ -90,4 +393,55 @@ func postUpdateConfiguration(c *gin.Context) {
 	}
 
 	c.Status(http.StatusNoContent)
-}
\ No newline at end of file
+}
+
+// Rotates the daemon token, or the token for a named API key if one is provided. If no new
+// token is provided in the request a random one is generated. The previous token continues
+// to work for the grace period so that the Panel can be updated without requests failing.
+func postRotateToken(c *gin.Context) {
+	var data struct {
+		Key         string `json:"key"`
+		TokenId     string `json:"token_id"`
+		Token       string `json:"token"`
+		GracePeriod *int   `json:"grace_period"`
+	}
+
+	if err := c.BindJSON(&data); err != nil {
+		return
+	}
+
+	if data.Token == "" {
+		b := make([]byte, 32)
+		if _, err := rand.Read(b); err != nil {
+			TrackedError(err).AbortWithServerError(c)
+			return
+		}
+
+		data.Token = hex.EncodeToString(b)
+	}
+
+	grace := config.Get().Api.TokenGracePeriod
+	if data.GracePeriod != nil {
+		grace = *data.GracePeriod
+	}
+
+	if grace < 0 {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error": "The grace period cannot be negative.",
+		})
+		return
+	}
+
+	d := time.Duration(grace) * time.Second
+	if err := config.RotateToken(data.Key, data.TokenId, data.Token, d); err != nil {
+		TrackedError(err).AbortWithServerError(c)
+		return
+	}
+
+	zap.S().Infow("rotated api token", zap.String("key", data.Key), zap.Int("grace_period", grace))
+
+	c.JSON(http.StatusOK, gin.H{
+		"token":                data.Token,
+		"previous_valid_until": time.Now().Add(d),
+	})
+}
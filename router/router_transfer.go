@@ -5,15 +5,17 @@ import (
 	"bytes"
 	"crypto/sha256"
 	"encoding/hex"
-	"errors"
+	"encoding/json"
 	"github.com/buger/jsonparser"
 	"github.com/gin-gonic/gin"
 	"github.com/mholt/archiver/v3"
+	"github.com/pkg/errors"
 	"github.com/pterodactyl/wings/api"
 	"github.com/pterodactyl/wings/config"
 	"github.com/pterodactyl/wings/installer"
 	"github.com/pterodactyl/wings/router/tokens"
 	"github.com/pterodactyl/wings/server"
+	"github.com/pterodactyl/wings/store"
 	"go.uber.org/zap"
 	"io"
 	"io/ioutil"
@@ -25,7 +27,9 @@ import (
 	"time"
 )
 
-func getServerArchive(c *gin.Context) {
+// Checks the token sent by the node that a server is being transferred to, which is issued
+// by the Panel for the transfer. Returns false if the request was aborted.
+func authorizeTransferRequest(c *gin.Context) bool {
 	auth := strings.SplitN(c.GetHeader("Authorization"), " ", 2)
 
 	if len(auth) != 2 || auth[0] != "Bearer" {
@@ -33,19 +37,28 @@ func getServerArchive(c *gin.Context) {
 		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{
 			"error": "The required authorization heads were not present in the request.",
 		})
-		return
+		return false
 	}
 
 	token := tokens.TransferPayload{}
 	if err := tokens.ParseToken([]byte(auth[1]), &token); err != nil {
+		recordAuthFailure(c)
 		TrackedError(err).AbortWithServerError(c)
-		return
+		return false
 	}
 
 	if token.Subject != c.Param("server") {
 		c.AbortWithStatusJSON(http.StatusForbidden, gin.H{
 			"error": "( .. •˘___˘• .. )",
 		})
+		return false
+	}
+
+	return true
+}
+
+func getServerArchive(c *gin.Context) {
+	if !authorizeTransferRequest(c) {
 		return
 	}
 
@@ -88,69 +101,213 @@ func getServerArchive(c *gin.Context) {
 	c.Header("Content-Disposition", "attachment; filename="+s.Archiver.ArchiveName())
 	c.Header("Content-Type", "application/octet-stream")
 
-	bufio.NewReader(file).WriteTo(c.Writer)
+	// Track the progress of sending the archive if it was created for a transfer that is
+	// still running, it may have been created before the daemon was last restarted.
+	var w io.Writer = c.Writer
+	t := server.GetTransfer(s.Uuid)
+	if t != nil && !t.Finished() {
+		t.SetTotal(st.Info.Size())
+		t.SetPhase(server.TransferPhaseSending)
+
+		w = t.SendWriter(c.Writer)
+	} else {
+		t = nil
+	}
+
+	_, err = bufio.NewReader(file).WriteTo(w)
+	if t != nil {
+		t.Finish(err)
+
+		if t.Context().Err() != nil {
+			if err := s.Archiver.DeleteIfExists(); err != nil {
+				zap.S().Warnw("failed to delete archive of cancelled server transfer", zap.String("server", s.Uuid), zap.Error(err))
+			}
+		}
+	}
 }
 
 func postServerArchive(c *gin.Context) {
+	if abortIfMaintenance(c) {
+		return
+	}
+
 	s := GetServer(c.Param("server"))
 
-	go func(server *server.Server) {
+	t, err := server.NewTransfer(s.Uuid, server.TransferPhaseArchiving)
+	if err != nil {
+		if server.IsTransferInProgressError(err) {
+			c.AbortWithStatusJSON(http.StatusConflict, gin.H{
+				"error": "A transfer is already in progress for this server.",
+			})
+			return
+		}
+
+		TrackedServerError(err, s).AbortWithServerError(c)
+		return
+	}
+
+	err = s.QueueOperation(server.OperationTransfer, func() error {
 		start := time.Now()
 
-		if err := server.Archiver.Archive(); err != nil {
+		successful := true
+		if err := s.Archiver.Archive(t); err != nil {
+			t.Finish(err)
+			successful = false
+
 			zap.S().Errorw("failed to get archive for server", zap.String("server", s.Uuid), zap.Error(err))
-			return
-		}
+		} else {
+			t.SetPhase(server.TransferPhaseArchived)
 
-		zap.S().Debugw(
-			"successfully created archive for server",
-			zap.String("server", server.Uuid),
-			zap.Duration("time", time.Now().Sub(start).Round(time.Microsecond)),
-		)
+			zap.S().Debugw(
+				"successfully created archive for server",
+				zap.String("server", s.Uuid),
+				zap.Duration("time", time.Now().Sub(start).Round(time.Microsecond)),
+			)
+		}
 
 		r := api.NewRequester()
-		rerr, err := r.SendArchiveStatus(server.Uuid, true)
+		rerr, err := r.SendArchiveStatus(s.Uuid, successful)
 		if rerr != nil || err != nil {
 			if err != nil {
-				zap.S().Errorw("failed to notify panel with archive status", zap.String("server", server.Uuid), zap.Error(err))
-				return
+				zap.S().Errorw("failed to notify panel with archive status", zap.String("server", s.Uuid), zap.Error(err))
+				return nil
 			}
 
 			zap.S().Errorw(
 				"panel returned an error when sending the archive status",
-				zap.String("server", server.Uuid),
+				zap.String("server", s.Uuid),
 				zap.Error(errors.New(rerr.String())),
 			)
-			return
+			return nil
 		}
 
-		zap.S().Debugw("successfully notified panel about archive status", zap.String("server", server.Uuid))
-	}(s)
+		zap.S().Debugw("successfully notified panel about archive status", zap.String("server", s.Uuid))
+
+		return nil
+	})
+	if err != nil {
+		t.Finish(err)
+		abortWithOperationError(c, s, err)
+		return
+	}
 
 	c.Status(http.StatusAccepted)
 }
 
+// Returns the progress of the transfer being sent or received for a server. The server
+// does not exist on the receiving node until its archive has been downloaded, so this does
+// not require that it does.
+func getServerTransferStatus(c *gin.Context) {
+	t := server.GetTransfer(c.Param("server"))
+	if t == nil {
+		c.AbortWithStatusJSON(http.StatusNotFound, gin.H{
+			"error": "There is no transfer for this server.",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, t.Progress())
+}
+
+// Cancels the transfer being sent or received for a server. The other node notices that
+// the connection between them was closed and cancels the transfer on its end as well, and
+// the Panel is told that the transfer failed.
+func deleteServerTransfer(c *gin.Context) {
+	uuid := c.Param("server")
+
+	t := server.GetTransfer(uuid)
+	if t == nil {
+		c.AbortWithStatusJSON(http.StatusNotFound, gin.H{
+			"error": "There is no transfer for this server.",
+		})
+		return
+	}
+
+	if t.Finished() {
+		c.AbortWithStatusJSON(http.StatusConflict, gin.H{
+			"error": "The transfer for this server has already finished.",
+		})
+		return
+	}
+
+	phase := t.Progress().Phase
+	t.Cancel()
+
+	// Nothing is working on a transfer once its archive has been created and is waiting to
+	// be downloaded, so it is finished here. Removing the archive means the other node can
+	// no longer download it, and it reports the transfer as having failed.
+	if phase == server.TransferPhaseArchived {
+		t.Finish(nil)
+
+		if s := GetServer(uuid); s != nil {
+			if err := s.Archiver.DeleteIfExists(); err != nil {
+				zap.S().Warnw("failed to delete archive of cancelled server transfer", zap.String("server", uuid), zap.Error(err))
+			}
+		}
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
 func postTransfer(c *gin.Context) {
+	if abortIfMaintenance(c) {
+		return
+	}
+
 	zap.S().Debug("incoming transfer from panel")
 
 	buf := bytes.Buffer{}
 	buf.ReadFrom(c.Request.Body)
 
+	serverID, _ := jsonparser.GetString(buf.Bytes(), "server_id")
+
+	t, err := server.NewTransfer(serverID, server.TransferPhaseReceiving)
+	if err != nil {
+		if server.IsTransferInProgressError(err) {
+			c.AbortWithStatusJSON(http.StatusConflict, gin.H{
+				"error": "A transfer is already in progress for this server.",
+			})
+			return
+		}
+
+		TrackedError(err).AbortWithServerError(c)
+		return
+	}
+
 	go func(data []byte) {
-		serverID, _ := jsonparser.GetString(data, "server_id")
-		url, _ := jsonparser.GetString(data, "url")
-		token, _ := jsonparser.GetString(data, "token")
+		started := time.Now()
+		recordTransfer(serverID, transferInProgress, started)
+
+		// The Panel can request a mode for the transfer, otherwise the mode configured for
+		// this node is used.
+		mode, _ := jsonparser.GetString(data, "mode")
+		if mode == "" {
+			mode = config.Get().System.Transfers.Mode
+		}
 
-		// Create an http client with no timeout.
-		client := &http.Client{Timeout: 0}
+		var s *server.Server
+		var err error
+		if mode == config.TransferModeSync {
+			s, err = syncTransfer(t, data)
+		} else {
+			s, err = receiveTransfer(t, data)
+		}
+		if err != nil {
+			t.Finish(err)
+			recordTransfer(serverID, transferFailed, started)
 
-		hasError := true
-		defer func() {
-			if !hasError {
-				return
+			zap.S().Errorw("server transfer has failed", zap.String("server", serverID), zap.Error(err))
+
+			// Anything left over from the transfer is removed, since the server stays on
+			// the node it was being transferred from.
+			if err := os.Remove(transferArchivePath(serverID)); err != nil && !os.IsNotExist(err) {
+				zap.S().Warnw("failed to remove archive of failed server transfer", zap.String("server", serverID), zap.Error(err))
+			}
+
+			if s != nil {
+				removeTransferredServer(s)
 			}
 
-			zap.S().Errorw("server transfer has failed", zap.String("server", serverID))
 			rerr, err := api.NewRequester().SendTransferFailure(serverID)
 			if rerr != nil || err != nil {
 				if err != nil {
@@ -163,151 +320,281 @@ func postTransfer(c *gin.Context) {
 			}
 
 			zap.S().Debugw("successfully notified panel about transfer failure", zap.String("server", serverID))
-		}()
-
-		// Make a new GET request to the URL the panel gave us.
-		req, err := http.NewRequest("GET", url, nil)
-		if err != nil {
-			zap.S().Errorw("failed to create http request", zap.Error(err))
 			return
 		}
 
-		// Add the authorization header.
-		req.Header.Set("Authorization", token)
-
-		// Execute the http request.
-		res, err := client.Do(req)
-		if err != nil {
-			zap.S().Errorw("failed to send http request", zap.Error(err))
-			return
-		}
-		defer res.Body.Close()
+		// We mark the process as being successful here as if we fail to send a transfer success,
+		// then a transfer failure won't probably be successful either.
+		//
+		// It may be useful to retry sending the transfer success every so often just in case of a small
+		// hiccup or the fix of whatever error causing the success request to fail.
+		t.Finish(nil)
+		recordTransfer(serverID, transferCompleted, started)
+
+		// Scan the extracted files in the background, the server data is already in place
+		// so there is no need to hold up the transfer while this completes.
+		go func(s *server.Server) {
+			if n, err := s.Filesystem.ScanDirectory("/"); err != nil {
+				zap.S().Warnw("failed to scan transferred server files", zap.String("server", s.Uuid), zap.Error(err))
+			} else if n > 0 {
+				zap.S().Warnw("removed infected files from transferred server", zap.String("server", s.Uuid), zap.Int("count", n))
+			}
+		}(s)
 
-		// Handle non-200 status codes.
-		if res.StatusCode != 200 {
-			body, err := ioutil.ReadAll(res.Body)
+		// Notify the panel that the transfer succeeded.
+		rerr, err := api.NewRequester().SendTransferSuccess(serverID)
+		if rerr != nil || err != nil {
 			if err != nil {
-				zap.S().Errorw("failed to read response body", zap.Int("status", res.StatusCode), zap.Error(err))
+				zap.S().Errorw("failed to notify panel with transfer success", zap.String("server", serverID), zap.Error(err))
 				return
 			}
 
-			zap.S().Errorw("failed to request server archive", zap.Int("status", res.StatusCode), zap.String("body", string(body)))
+			zap.S().Errorw("panel returned an error when notifying of a transfer success", zap.String("server", serverID), zap.Error(errors.New(rerr.String())))
 			return
 		}
 
-		// Get the path to the archive.
-		archivePath := filepath.Join(config.Get().System.ArchiveDirectory, serverID + ".tar.gz")
+		zap.S().Debugw("successfully notified panel about transfer success", zap.String("server", serverID))
+	}(buf.Bytes())
 
-		// Check if the archive already exists and delete it if it does.
-		_, err = os.Stat(archivePath)
-		if err != nil {
-			if !os.IsNotExist(err) {
-				zap.S().Errorw("failed to stat file", zap.Error(err))
-				return
-			}
-		} else {
-			if err := os.Remove(archivePath); err != nil {
-				zap.S().Errorw("failed to delete old file", zap.Error(err))
-				return
-			}
-		}
+	c.Status(http.StatusAccepted)
+}
 
-		// Create the file.
-		file, err := os.Create(archivePath)
-		if err != nil {
-			zap.S().Errorw("failed to open file on disk", zap.Error(err))
-			return
-		}
+// Returns the path that the archive of a server being received is downloaded to.
+func transferArchivePath(serverID string) string {
+	return filepath.Join(config.Get().System.ArchiveDirectory, serverID+".tar.gz")
+}
 
-		// Copy the file.
-		_, err = io.Copy(file, res.Body)
-		if err != nil {
-			zap.S().Errorw("failed to copy file to disk", zap.Error(err))
-			return
-		}
+// Downloads the archive of a server being transferred to this node from the node it is
+// currently on, and then creates the server using it. The server is returned once it has
+// been created, even if the transfer fails after that, so that it can be removed again.
+func receiveTransfer(t *server.Transfer, data []byte) (*server.Server, error) {
+	serverID, _ := jsonparser.GetString(data, "server_id")
+	url, _ := jsonparser.GetString(data, "url")
+	token, _ := jsonparser.GetString(data, "token")
 
-		// Close the file so it can be opened to verify the checksum.
-		if err := file.Close(); err != nil {
-			zap.S().Errorw("failed to close archive file", zap.Error(err))
-			return
-		}
-		zap.S().Debug("server archive has been downloaded, computing checksum..", zap.String("server", serverID))
+	// Create an http client with no timeout.
+	client := &http.Client{Timeout: 0}
+
+	// Make a new GET request to the URL the panel gave us, which is cancelled along with
+	// the transfer.
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to create http request")
+	}
+	req = req.WithContext(t.Context())
 
-		// Open the archive file for computing a checksum.
-		file, err = os.Open(archivePath)
+	// Add the authorization header.
+	req.Header.Set("Authorization", token)
+
+	// Execute the http request.
+	res, err := client.Do(req)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to send http request")
+	}
+	defer res.Body.Close()
+
+	// Handle non-200 status codes.
+	if res.StatusCode != 200 {
+		body, err := ioutil.ReadAll(res.Body)
 		if err != nil {
-			zap.S().Errorw("failed to open file on disk", zap.Error(err))
-			return
+			return nil, errors.Wrap(err, "failed to read response body")
 		}
 
-		// Compute the sha256 checksum of the file.
-		hash := sha256.New()
-		if _, err := io.Copy(hash, file); err != nil {
-			zap.S().Errorw("failed to copy file for checksum verification", zap.Error(err))
-			return
-		}
+		return nil, errors.Errorf("failed to request server archive: status %d: %s", res.StatusCode, string(body))
+	}
 
-		// Verify the two checksums.
-		if hex.EncodeToString(hash.Sum(nil)) != res.Header.Get("X-Checksum") {
-			zap.S().Errorw("checksum failed verification")
-			return
-		}
+	if res.ContentLength > 0 {
+		t.SetTotal(res.ContentLength)
+	}
 
-		// Close the file.
-		if err := file.Close(); err != nil {
-			zap.S().Errorw("failed to close archive file", zap.Error(err))
-			return
-		}
+	// Get the path to the archive.
+	archivePath := transferArchivePath(serverID)
 
-		zap.S().Infow("server archive transfer was successful", zap.String("server", serverID))
+	// Check if the archive already exists and delete it if it does.
+	if err := os.Remove(archivePath); err != nil && !os.IsNotExist(err) {
+		return nil, errors.Wrap(err, "failed to delete old file")
+	}
 
-		// Get the server data from the request.
-		serverData, t, _, _ := jsonparser.Get(data, "server")
-		if t != jsonparser.Object {
-			zap.S().Errorw("invalid server data passed in request")
-			return
-		}
+	// Create the file.
+	file, err := os.Create(archivePath)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to open file on disk")
+	}
 
-		// Create a new server installer (note this does not execute the install script)
-		i, err := installer.New(serverData)
-		if err != nil {
-			zap.S().Warnw("failed to validate the received server data", zap.Error(err))
-			return
-		}
+	// Copy the file.
+	if _, err := io.Copy(file, t.ReceiveReader(res.Body)); err != nil {
+		file.Close()
+
+		return nil, errors.Wrap(err, "failed to copy file to disk")
+	}
 
-		// Add the server to the collection.
-		server.GetServers().Add(i.Server())
+	// Close the file so it can be opened to verify the checksum.
+	if err := file.Close(); err != nil {
+		return nil, errors.Wrap(err, "failed to close archive file")
+	}
 
-		// Create the server's environment (note this does not execute the install script)
-		i.Execute()
+	zap.S().Debugw("server archive has been downloaded, computing checksum..", zap.String("server", serverID))
+	t.SetPhase(server.TransferPhaseVerifying)
 
-		// Un-archive the archive. That sounds weird..
-		if err := archiver.NewTarGz().Unarchive(archivePath, i.Server().Filesystem.Path()); err != nil {
-			zap.S().Errorw("failed to extract archive", zap.String("server", serverID), zap.Error(err))
-			return
+	// Open the archive file for computing a checksum.
+	file, err = os.Open(archivePath)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to open file on disk")
+	}
+
+	// Compute the sha256 checksum of the file.
+	hash := sha256.New()
+	_, err = io.Copy(hash, file)
+	file.Close()
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to copy file for checksum verification")
+	}
+
+	// Verify the two checksums.
+	if hex.EncodeToString(hash.Sum(nil)) != res.Header.Get("X-Checksum") {
+		return nil, errors.New("checksum failed verification")
+	}
+
+	zap.S().Infow("server archive transfer was successful", zap.String("server", serverID))
+
+	if err := t.Context().Err(); err != nil {
+		return nil, err
+	}
+
+	// Get the server data from the request.
+	serverData, dt, _, _ := jsonparser.Get(data, "server")
+	if dt != jsonparser.Object {
+		return nil, errors.New("invalid server data passed in request")
+	}
+
+	// Create a new server installer (note this does not execute the install script)
+	i, err := installer.New(serverData)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to validate the received server data")
+	}
+
+	// Add the server to the collection.
+	server.GetServers().Add(i.Server())
+
+	// Create the server's environment (note this does not execute the install script)
+	i.Execute()
+
+	t.SetPhase(server.TransferPhaseExtracting)
+
+	// Un-archive the archive. That sounds weird..
+	if err := archiver.NewTarGz().Unarchive(archivePath, i.Server().Filesystem.Path()); err != nil {
+		return i.Server(), errors.Wrap(err, "failed to extract archive")
+	}
+
+	// The extraction cannot be interrupted, so a transfer cancelled while it was running
+	// is only stopped once it has completed.
+	return i.Server(), t.Context().Err()
+}
+
+// Removes a server that was created while receiving a transfer that then failed.
+func removeTransferredServer(s *server.Server) {
+	if err := s.Environment.Destroy(); err != nil {
+		zap.S().Warnw("failed to destroy environment of failed server transfer", zap.String("server", s.Uuid), zap.Error(err))
+	}
+
+	s.Filesystem.StopUsageTracking()
+
+	if err := os.RemoveAll(s.Filesystem.Path()); err != nil {
+		zap.S().Warnw("failed to remove files of failed server transfer", zap.String("server", s.Uuid), zap.Error(errors.WithStack(err)))
+	}
+
+	if err := s.RemovePersistedConfiguration(); err != nil {
+		zap.S().Warnw("failed to remove persisted configuration of failed server transfer", zap.String("server", s.Uuid), zap.Error(err))
+	}
+
+	if err := s.CloseFirewall(); err != nil {
+		zap.S().Warnw("failed to close allocations of failed server transfer in firewall", zap.String("server", s.Uuid), zap.Error(err))
+	}
+
+	server.GetServers().Remove(func(s2 *server.Server) bool {
+		return s2.Uuid == s.Uuid
+	})
+}
+
+const (
+	transferInProgress = "in_progress"
+	transferCompleted  = "completed"
+	transferFailed     = "failed"
+)
+
+// How long finished transfers are kept in the state store for.
+const transferRecordRetention = time.Hour * 24 * 7
+
+// A server transfer being received by this daemon, stored so that a transfer that was
+// interrupted by the daemon stopping can be reported to the Panel as having failed.
+type transferRecord struct {
+	Status     string     `json:"status"`
+	StartedAt  time.Time  `json:"started_at"`
+	FinishedAt *time.Time `json:"finished_at,omitempty"`
+}
+
+var transferRecords = store.NewRepository(store.Transfers)
+
+// Saves the current status of a transfer to the state store.
+func recordTransfer(serverID string, status string, started time.Time) {
+	r := &transferRecord{Status: status, StartedAt: started}
+
+	var expires time.Time
+	if status != transferInProgress {
+		now := time.Now()
+		r.FinishedAt = &now
+		expires = now.Add(transferRecordRetention)
+	}
+
+	if err := transferRecords.PutWithExpiry(serverID, r, expires); err != nil {
+		zap.S().Warnw("failed to save server transfer state", zap.String("server", serverID), zap.Error(err))
+	}
+
+	switch status {
+	case transferInProgress:
+		server.PublishNodeEvent(server.TransferStartedEvent, serverID, nil)
+	case transferCompleted:
+		server.PublishNodeEvent(server.TransferCompletedEvent, serverID, nil)
+	case transferFailed:
+		server.PublishNodeEvent(server.TransferFailedEvent, serverID, nil)
+	}
+}
+
+// Notifies the Panel that any transfers which were still in progress when the daemon was
+// last stopped have failed, otherwise the Panel would wait on them forever.
+func FailInterruptedTransfers() {
+	interrupted := make(map[string]*transferRecord)
+
+	err := transferRecords.Each(func(serverID string, data []byte) error {
+		r := &transferRecord{}
+		if err := json.Unmarshal(data, r); err != nil {
+			return err
 		}
 
-		// We mark the process as being successful here as if we fail to send a transfer success,
-		// then a transfer failure won't probably be successful either.
-		//
-		// It may be useful to retry sending the transfer success every so often just in case of a small
-		// hiccup or the fix of whatever error causing the success request to fail.
-		hasError = false
+		if r.Status == transferInProgress {
+			interrupted[serverID] = r
+		}
 
-		// Notify the panel that the transfer succeeded.
-		rerr, err := api.NewRequester().SendTransferSuccess(serverID)
+		return nil
+	})
+	if err != nil {
+		zap.S().Warnw("failed to read server transfers from the state store", zap.Error(err))
+		return
+	}
+
+	for serverID, r := range interrupted {
+		zap.S().Warnw("server transfer was interrupted by the daemon stopping", zap.String("server", serverID))
+
+		rerr, err := api.NewRequester().SendTransferFailure(serverID)
 		if rerr != nil || err != nil {
-			if err != nil {
-				zap.S().Errorw("failed to notify panel with transfer success", zap.String("server", serverID), zap.Error(err))
-				return
+			if err == nil {
+				err = errors.New(rerr.String())
 			}
 
-			zap.S().Errorw("panel returned an error when notifying of a transfer success", zap.String("server", serverID), zap.Error(errors.New(rerr.String())))
-			return
+			zap.S().Errorw("failed to notify panel of interrupted transfer", zap.String("server", serverID), zap.Error(err))
+			continue
 		}
 
-		zap.S().Debugw("successfully notified panel about transfer success", zap.String("server", serverID))
-	}(buf.Bytes())
-
-	c.Status(http.StatusAccepted)
+		recordTransfer(serverID, transferFailed, r.StartedAt)
+	}
 }
@@ -0,0 +1,340 @@
+package router
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"github.com/buger/jsonparser"
+	"github.com/gin-gonic/gin"
+	"github.com/pkg/errors"
+	"github.com/pterodactyl/wings/config"
+	"github.com/pterodactyl/wings/installer"
+	"github.com/pterodactyl/wings/server"
+	"go.uber.org/zap"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+)
+
+// Returns the transfer of a server that is being synced to another node, starting one if
+// this is the first request made for it.
+func syncingTransfer(s *server.Server) (*server.Transfer, error) {
+	if t := server.GetTransfer(s.Uuid); t != nil && !t.Finished() {
+		return t, nil
+	}
+
+	t, err := server.NewTransfer(s.Uuid, server.TransferPhaseSending)
+	if err != nil && server.IsTransferInProgressError(err) {
+		// Another request started the transfer at the same time.
+		if t := server.GetTransfer(s.Uuid); t != nil {
+			return t, nil
+		}
+	}
+
+	return t, err
+}
+
+// Returns the server that a sync request is for, aborting the request if the token is not
+// valid or the server does not exist on this node.
+func getSyncingServer(c *gin.Context) (*server.Server, *server.Transfer, bool) {
+	if !authorizeTransferRequest(c) {
+		return nil, nil, false
+	}
+
+	s := GetServer(c.Param("server"))
+	if s == nil {
+		c.AbortWithStatusJSON(http.StatusNotFound, gin.H{
+			"error": "The requested server does not exist on this node.",
+		})
+		return nil, nil, false
+	}
+
+	t, err := syncingTransfer(s)
+	if err != nil {
+		TrackedServerError(err, s).AbortWithServerError(c)
+		return nil, nil, false
+	}
+
+	return s, t, true
+}
+
+// Returns the manifest of the files of a server being synced to another node. The checksum
+// of every file is included if "checksums" is true.
+func getServerSyncManifest(c *gin.Context) {
+	s, t, ok := getSyncingServer(c)
+	if !ok {
+		return
+	}
+
+	entries, err := s.Filesystem.SyncManifest(t.Context(), c.Query("checksums") == "true")
+	if err != nil {
+		TrackedServerError(err, s).AbortWithServerError(c)
+		return
+	}
+
+	c.JSON(http.StatusOK, entries)
+}
+
+// Sends a single file of a server being synced to another node. The checksum of the file
+// is sent as a trailer once all of it has been sent, since the file may still be changing
+// while the server is running.
+func getServerSyncFile(c *gin.Context) {
+	s, t, ok := getSyncingServer(c)
+	if !ok {
+		return
+	}
+
+	f, err := s.Filesystem.OpenFile(c.Query("path"), os.O_RDONLY, 0)
+	if err != nil {
+		if os.IsNotExist(errors.Cause(err)) {
+			c.AbortWithStatusJSON(http.StatusNotFound, gin.H{
+				"error": "The requested file does not exist.",
+			})
+			return
+		}
+
+		TrackedServerError(err, s).AbortWithServerError(c)
+		return
+	}
+	defer f.Close()
+
+	if st, err := f.Stat(); err != nil {
+		TrackedServerError(err, s).AbortWithServerError(c)
+		return
+	} else if !st.Mode().IsRegular() {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error": "Only regular files can be synced.",
+		})
+		return
+	}
+
+	c.Header("Content-Type", "application/octet-stream")
+	c.Header("Trailer", "X-Checksum")
+	c.Status(http.StatusOK)
+
+	h := sha256.New()
+	if _, err := io.Copy(io.MultiWriter(t.SendWriter(c.Writer), h), f); err != nil {
+		zap.S().Debugw("failed to send file of server being synced", zap.String("server", s.Uuid), zap.Error(err))
+		return
+	}
+
+	c.Writer.Header().Set("X-Checksum", hex.EncodeToString(h.Sum(nil)))
+}
+
+// Stops a server being synced to another node for the final pass, and keeps it stopped
+// until the transfer has finished.
+func postServerSyncStop(c *gin.Context) {
+	s, t, ok := getSyncingServer(c)
+	if !ok {
+		return
+	}
+
+	t.SetPhase(server.TransferPhaseFinalSync)
+
+	err := s.RunOperation(server.OperationPower, func() error {
+		return s.Environment.WaitForStop(60, true)
+	})
+	if err != nil {
+		abortWithOperationError(c, s, err)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// Finishes the transfer of a server that was synced to another node, which allows the
+// server to be started again if the transfer failed.
+func postServerSyncFinish(c *gin.Context) {
+	if !authorizeTransferRequest(c) {
+		return
+	}
+
+	var data struct {
+		Successful bool `json:"successful"`
+	}
+	if err := c.BindJSON(&data); err != nil {
+		return
+	}
+
+	if t := server.GetTransfer(c.Param("server")); t != nil && !t.Finished() {
+		if data.Successful {
+			t.Finish(nil)
+		} else {
+			t.Finish(errors.New("the transfer failed on the node the server was being synced to"))
+		}
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// Makes requests to the node that a server is being synced from.
+type syncClient struct {
+	t      *server.Transfer
+	base   string
+	token  string
+	client *http.Client
+}
+
+func (sc *syncClient) request(ctx context.Context, method string, path string, body io.Reader) (*http.Response, error) {
+	req, err := http.NewRequest(method, sc.base+path, body)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to create http request")
+	}
+	req = req.WithContext(ctx)
+
+	req.Header.Set("Authorization", sc.token)
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	res, err := sc.client.Do(req)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to send http request")
+	}
+
+	if res.StatusCode != http.StatusOK && res.StatusCode != http.StatusNoContent {
+		b, _ := ioutil.ReadAll(res.Body)
+		res.Body.Close()
+
+		return nil, errors.Errorf("request to %s failed: status %d: %s", path, res.StatusCode, string(b))
+	}
+
+	return res, nil
+}
+
+// Makes a single pass over the files of the server, copying everything that has changed.
+// If checksums is true files are compared using their checksums rather than only their size
+// and modification time.
+func (sc *syncClient) pass(s *server.Server, checksums bool) (*server.SyncResult, error) {
+	path := "/transfer/sync/manifest"
+	if checksums {
+		path += "?checksums=true"
+	}
+
+	res, err := sc.request(sc.t.Context(), http.MethodGet, path, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	var entries []server.SyncEntry
+	if err := json.NewDecoder(res.Body).Decode(&entries); err != nil {
+		return nil, errors.Wrap(err, "failed to decode server manifest")
+	}
+
+	var total int64
+	for _, e := range entries {
+		total += e.Size
+	}
+	sc.t.SetTotal(total)
+
+	return s.Filesystem.ApplySync(sc.t.Context(), entries, sc.fetch)
+}
+
+func (sc *syncClient) fetch(ctx context.Context, e server.SyncEntry, w io.Writer) error {
+	res, err := sc.request(ctx, http.MethodGet, "/transfer/sync/file?path="+url.QueryEscape(e.Path), nil)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(io.MultiWriter(w, h), sc.t.ReceiveReader(res.Body)); err != nil {
+		return errors.Wrap(err, "failed to copy file "+e.Path)
+	}
+
+	if hex.EncodeToString(h.Sum(nil)) != res.Trailer.Get("X-Checksum") {
+		return errors.New("checksum of file " + e.Path + " failed verification")
+	}
+
+	return nil
+}
+
+// Tells the node the server was synced from whether the transfer was successful. This is
+// sent even if the transfer was cancelled, so a new context is used for it.
+func (sc *syncClient) finish(successful bool) {
+	b, _ := json.Marshal(map[string]bool{"successful": successful})
+
+	res, err := sc.request(context.Background(), http.MethodPost, "/transfer/sync/finish", bytes.NewReader(b))
+	if err != nil {
+		zap.S().Warnw("failed to notify node of server sync outcome", zap.String("server", sc.t.Server), zap.Error(err))
+		return
+	}
+
+	res.Body.Close()
+}
+
+// Syncs a server being transferred to this node from the node it is currently on. The
+// files are copied over a number of passes while the server keeps running, until a pass
+// copies little enough that the server can be stopped for a final pass.
+func syncTransfer(t *server.Transfer, data []byte) (s *server.Server, err error) {
+	archiveURL, _ := jsonparser.GetString(data, "url")
+	token, _ := jsonparser.GetString(data, "token")
+
+	sc := &syncClient{
+		t:      t,
+		base:   strings.TrimSuffix(archiveURL, "/archive"),
+		token:  token,
+		client: &http.Client{Timeout: 0},
+	}
+	defer func() {
+		sc.finish(err == nil)
+	}()
+
+	// Get the server data from the request.
+	serverData, dt, _, _ := jsonparser.Get(data, "server")
+	if dt != jsonparser.Object {
+		return nil, errors.New("invalid server data passed in request")
+	}
+
+	// The server is created before the files are copied so that they can be copied straight
+	// into its data directory.
+	i, err := installer.New(serverData)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to validate the received server data")
+	}
+
+	server.GetServers().Add(i.Server())
+	i.Execute()
+
+	s = i.Server()
+	t.SetPhase(server.TransferPhaseSyncing)
+
+	cfg := config.Get().System.Transfers
+	for pass := 1; pass <= cfg.SyncPasses; pass++ {
+		r, err := sc.pass(s, false)
+		if err != nil {
+			return s, err
+		}
+
+		zap.S().Debugw("completed server sync pass", zap.String("server", s.Uuid), zap.Int("pass", pass), zap.Int("files", r.Files), zap.Int64("bytes", r.Bytes), zap.Int("removed", r.Removed))
+
+		if r.Bytes < cfg.SyncThreshold*1024*1024 {
+			break
+		}
+	}
+
+	t.SetPhase(server.TransferPhaseFinalSync)
+
+	res, err := sc.request(t.Context(), http.MethodPost, "/transfer/sync/stop", nil)
+	if err != nil {
+		return s, err
+	}
+	res.Body.Close()
+
+	// The final pass compares the checksums of every file, since a file changed within the
+	// same second as the last pass without its size changing would otherwise be missed.
+	r, err := sc.pass(s, true)
+	if err != nil {
+		return s, err
+	}
+
+	zap.S().Infow("server sync transfer was successful", zap.String("server", s.Uuid), zap.Int("files", r.Files), zap.Int64("bytes", r.Bytes))
+
+	return s, nil
+}
@@ -0,0 +1,137 @@
+package router
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/pterodactyl/wings/config"
+	"github.com/pterodactyl/wings/installer"
+	"github.com/pterodactyl/wings/server"
+	"github.com/pterodactyl/wings/system"
+	"net/http"
+)
+
+// The ways that a route can be accessed.
+const (
+	// Routes that do not require a token. These either authorize requests themselves using
+	// signed URLs and JWTs, or do not need to be authorized at all.
+	accessPublic = iota
+
+	// Routes that require a token with the scope of the route. When request signing or
+	// client certificates are enabled those are required as well.
+	accessToken
+
+	// The same as accessToken, for routes that act on a server which must exist.
+	accessServer
+)
+
+// Describes a single route served by the daemon. The request and response values are
+// only used to describe the route in the API specification.
+type route struct {
+	Method   string
+	Path     string
+	Access   int
+	Scope    string
+	Summary  string
+	Handler  gin.HandlerFunc
+	Request  interface{}
+	Response interface{}
+}
+
+// Returns every route served by the daemon. The router is built from this table, and it is
+// also used to determine the scope required for each route and to generate the
+// specification served at /api/spec.
+func apiRoutes() []route {
+	return []route{
+		{Method: http.MethodOptions, Path: "/api/system", Access: accessPublic, Summary: "Responds to CORS preflight requests", Handler: func(c *gin.Context) { c.Status(http.StatusOK) }},
+		{Method: http.MethodGet, Path: "/api/health", Access: accessPublic, Summary: "Returns the health of the daemon", Handler: getHealth},
+		{Method: http.MethodGet, Path: "/api/spec", Access: accessPublic, Summary: "Returns the OpenAPI specification for the daemon", Handler: getSpec},
+
+		// These routes use signed URLs to validate access to the resource being requested.
+		{Method: http.MethodGet, Path: "/download/backup", Access: accessPublic, Summary: "Downloads a backup using a signed URL", Handler: getDownloadBackup},
+		{Method: http.MethodGet, Path: "/download/file", Access: accessPublic, Summary: "Downloads a file using a signed URL", Handler: getDownloadFile},
+		{Method: http.MethodGet, Path: "/api/servers/:server/files/download-all", Access: accessPublic, Summary: "Downloads all of the files for a server using a signed URL", Handler: getDownloadServerArchive},
+
+		// The websocket is authorized using a JWT sent once the connection is open, and the
+		// archive and sync routes are requested by another daemon using a JWT issued by the
+		// Panel.
+		{Method: http.MethodGet, Path: "/api/servers/:server/ws", Access: accessPublic, Summary: "Opens the websocket for a server", Handler: getServerWebsocket},
+		{Method: http.MethodGet, Path: "/api/servers/:server/archive", Access: accessPublic, Summary: "Downloads the archive of a server being transferred", Handler: getServerArchive},
+		{Method: http.MethodGet, Path: "/api/servers/:server/transfer/sync/manifest", Access: accessPublic, Summary: "Lists the files of a server being synced to another node", Handler: getServerSyncManifest, Response: []server.SyncEntry{}},
+		{Method: http.MethodGet, Path: "/api/servers/:server/transfer/sync/file", Access: accessPublic, Summary: "Downloads a file of a server being synced to another node", Handler: getServerSyncFile},
+		{Method: http.MethodPost, Path: "/api/servers/:server/transfer/sync/stop", Access: accessPublic, Summary: "Stops a server for the final pass of a sync", Handler: postServerSyncStop},
+		{Method: http.MethodPost, Path: "/api/servers/:server/transfer/sync/finish", Access: accessPublic, Summary: "Finishes the sync of a server to another node", Handler: postServerSyncFinish},
+
+		{Method: http.MethodPost, Path: "/api/update", Access: accessToken, Scope: ScopeAdmin, Summary: "Updates the configuration of the daemon", Handler: postUpdateConfiguration, Request: config.Configuration{}},
+		{Method: http.MethodPost, Path: "/api/token/rotate", Access: accessToken, Scope: ScopeAdmin, Summary: "Rotates the token used to access the daemon", Handler: postRotateToken},
+		{Method: http.MethodGet, Path: "/api/system", Access: accessToken, Scope: ScopeRead, Summary: "Returns information about the system", Handler: getSystemInformation, Response: system.Information{}},
+		{Method: http.MethodGet, Path: "/api/system/utilization", Access: accessToken, Scope: ScopeRead, Summary: "Returns the combined resource usage of the servers on the node", Handler: getSystemUtilization, Response: server.NodeUtilization{}},
+		{Method: http.MethodPut, Path: "/api/system/maintenance", Access: accessToken, Scope: ScopeAdmin, Summary: "Changes the maintenance mode of the node", Handler: putMaintenanceMode, Request: config.MaintenanceConfiguration{}, Response: config.MaintenanceConfiguration{}},
+		{Method: http.MethodGet, Path: "/api/system/bans", Access: accessToken, Scope: ScopeAdmin, Summary: "Lists the addresses that are banned", Handler: getBans, Response: []AddressBan{}},
+		{Method: http.MethodPost, Path: "/api/system/bans", Access: accessToken, Scope: ScopeAdmin, Summary: "Bans an address", Handler: postBan, Response: AddressBan{}},
+		{Method: http.MethodDelete, Path: "/api/system/bans/:address", Access: accessToken, Scope: ScopeAdmin, Summary: "Removes the ban for an address", Handler: deleteBan},
+		{Method: http.MethodPost, Path: "/api/graphql", Access: accessToken, Scope: ScopeRead, Summary: "Executes a read-only GraphQL query", Handler: postGraphql, Request: graphqlRequest{}},
+		{Method: http.MethodGet, Path: "/api/events", Access: accessToken, Scope: ScopeAdmin, Summary: "Streams events for every server using server-sent events", Handler: getEvents},
+		{Method: http.MethodGet, Path: "/api/ws", Access: accessToken, Scope: ScopeAdmin, Summary: "Opens the admin websocket", Handler: getAdminWebsocket},
+		{Method: http.MethodGet, Path: "/api/servers", Access: accessToken, Scope: ScopeRead, Summary: "Lists the servers on the node", Handler: getAllServers},
+		{Method: http.MethodPost, Path: "/api/servers", Access: accessToken, Scope: ScopeAdmin, Summary: "Creates a server", Handler: postCreateServer},
+		{Method: http.MethodPost, Path: "/api/servers/power", Access: accessToken, Scope: ScopePower, Summary: "Changes the power state of every server with the given tags", Handler: postServersPower, Request: bulkPowerRequest{}},
+		{Method: http.MethodPost, Path: "/api/servers/import", Access: accessToken, Scope: ScopeAdmin, Summary: "Imports an existing server directory or container", Handler: postImportServer, Request: installer.ImportRequest{}},
+		{Method: http.MethodPost, Path: "/api/transfer", Access: accessToken, Scope: ScopeAdmin, Summary: "Receives a server being transferred from another node", Handler: postTransfer},
+		{Method: http.MethodGet, Path: "/api/servers/:server/transfer/status", Access: accessToken, Scope: ScopeAdmin, Summary: "Returns the progress of the transfer of a server", Handler: getServerTransferStatus, Response: server.TransferProgress{}},
+		{Method: http.MethodDelete, Path: "/api/servers/:server/transfer", Access: accessToken, Scope: ScopeAdmin, Summary: "Cancels the transfer of a server", Handler: deleteServerTransfer},
+
+		{Method: http.MethodGet, Path: "/api/servers/:server", Access: accessServer, Scope: ScopeRead, Summary: "Returns a server", Handler: getServer, Response: serverDetails{}},
+		{Method: http.MethodPatch, Path: "/api/servers/:server", Access: accessServer, Scope: ScopeAdmin, Summary: "Updates the configuration of a server", Handler: patchServer},
+		{Method: http.MethodDelete, Path: "/api/servers/:server", Access: accessServer, Scope: ScopeAdmin, Summary: "Deletes a server", Handler: deleteServer},
+		{Method: http.MethodGet, Path: "/api/servers/:server/logs", Access: accessServer, Scope: ScopeRead, Summary: "Returns the console logs of a server", Handler: getServerLogs},
+		{Method: http.MethodGet, Path: "/api/servers/:server/stats/history", Access: accessServer, Scope: ScopeRead, Summary: "Returns the saved resource usage of a server", Handler: getServerStatsHistory, Response: []server.StatsSample{}},
+		{Method: http.MethodPost, Path: "/api/servers/:server/power", Access: accessServer, Scope: ScopePower, Summary: "Changes the power state of a server", Handler: postServerPower, Request: server.PowerAction{}},
+		{Method: http.MethodPost, Path: "/api/servers/:server/commands", Access: accessServer, Scope: ScopePower, Summary: "Sends commands to a server", Handler: postServerCommands},
+		{Method: http.MethodGet, Path: "/api/servers/:server/commands/macros", Access: accessServer, Scope: ScopeRead, Summary: "Lists the command macros of a server", Handler: getServerMacros, Response: []server.CommandMacro{}},
+		{Method: http.MethodPut, Path: "/api/servers/:server/commands/macros/:name", Access: accessServer, Scope: ScopeAdmin, Summary: "Creates or replaces a command macro", Handler: putServerMacro, Response: server.CommandMacro{}},
+		{Method: http.MethodDelete, Path: "/api/servers/:server/commands/macros/:name", Access: accessServer, Scope: ScopeAdmin, Summary: "Deletes a command macro", Handler: deleteServerMacro},
+		{Method: http.MethodPost, Path: "/api/servers/:server/commands/macro/:name", Access: accessServer, Scope: ScopePower, Summary: "Runs a command macro", Handler: postServerRunMacro},
+		{Method: http.MethodPost, Path: "/api/servers/:server/rcon", Access: accessServer, Scope: ScopePower, Summary: "Sends a command to a server over RCON", Handler: postServerRcon},
+		{Method: http.MethodPost, Path: "/api/servers/:server/install", Access: accessServer, Scope: ScopeAdmin, Summary: "Runs the installation process for a server", Handler: postServerInstall},
+		{Method: http.MethodGet, Path: "/api/servers/:server/install-logs", Access: accessServer, Scope: ScopeRead, Summary: "Returns the output of the last installation of a server", Handler: getServerInstallLogs},
+		{Method: http.MethodPost, Path: "/api/servers/:server/reinstall", Access: accessServer, Scope: ScopeAdmin, Summary: "Reinstalls a server", Handler: postServerReinstall, Request: server.ReinstallOptions{}},
+		{Method: http.MethodPost, Path: "/api/servers/:server/sync", Access: accessServer, Scope: ScopeAdmin, Summary: "Syncs the configuration of a server with the Panel", Handler: postServerSync, Response: serverDetails{}},
+		{Method: http.MethodPut, Path: "/api/servers/:server/settings/image", Access: accessServer, Scope: ScopeAdmin, Summary: "Changes the Docker image of a server", Handler: putServerImage},
+		{Method: http.MethodPatch, Path: "/api/servers/:server/details", Access: accessServer, Scope: ScopeAdmin, Summary: "Changes the name and description of a server", Handler: patchServerDetails, Request: server.DetailsUpdate{}, Response: serverDetails{}},
+		{Method: http.MethodPut, Path: "/api/servers/:server/tags", Access: accessServer, Scope: ScopeAdmin, Summary: "Replaces the tags of a server", Handler: putServerTags},
+		{Method: http.MethodPatch, Path: "/api/servers/:server/build", Access: accessServer, Scope: ScopeAdmin, Summary: "Changes the build limits of a server", Handler: patchServerBuild, Request: server.BuildUpdate{}},
+		{Method: http.MethodPut, Path: "/api/servers/:server/settings/variables", Access: accessServer, Scope: ScopeAdmin, Summary: "Changes the startup variables of a server", Handler: putServerVariables},
+		{Method: http.MethodPost, Path: "/api/servers/:server/archive", Access: accessServer, Scope: ScopeAdmin, Summary: "Creates the archive of a server for a transfer", Handler: postServerArchive},
+
+		{Method: http.MethodGet, Path: "/api/servers/:server/files/contents", Access: accessServer, Scope: ScopeFiles, Summary: "Returns the contents of a file", Handler: getServerFileContents},
+		{Method: http.MethodGet, Path: "/api/servers/:server/files/list-directory", Access: accessServer, Scope: ScopeFiles, Summary: "Lists the contents of a directory", Handler: getServerListDirectory},
+		{Method: http.MethodGet, Path: "/api/servers/:server/files/search", Access: accessServer, Scope: ScopeFiles, Summary: "Searches the files of a server", Handler: getServerSearchFiles},
+		{Method: http.MethodPut, Path: "/api/servers/:server/files/rename", Access: accessServer, Scope: ScopeFiles, Summary: "Renames a file", Handler: putServerRenameFile},
+		{Method: http.MethodPost, Path: "/api/servers/:server/files/copy", Access: accessServer, Scope: ScopeFiles, Summary: "Copies a file", Handler: postServerCopyFile},
+		{Method: http.MethodPost, Path: "/api/servers/:server/files/write", Access: accessServer, Scope: ScopeFiles, Summary: "Writes the contents of a file", Handler: postServerWriteFile},
+		{Method: http.MethodPost, Path: "/api/servers/:server/files/diff", Access: accessServer, Scope: ScopeFiles, Summary: "Compares a file to new contents or to another file", Handler: postServerDiffFiles},
+		{Method: http.MethodPost, Path: "/api/servers/:server/files/create-directory", Access: accessServer, Scope: ScopeFiles, Summary: "Creates a directory", Handler: postServerCreateDirectory},
+		{Method: http.MethodPost, Path: "/api/servers/:server/files/delete", Access: accessServer, Scope: ScopeFiles, Summary: "Deletes a file", Handler: postServerDeleteFile},
+		{Method: http.MethodGet, Path: "/api/servers/:server/files/trash", Access: accessServer, Scope: ScopeFiles, Summary: "Lists the files in the recycle bin", Handler: getServerTrash, Response: []*server.TrashItem{}},
+		{Method: http.MethodPost, Path: "/api/servers/:server/files/trash/restore", Access: accessServer, Scope: ScopeFiles, Summary: "Restores a file from the recycle bin", Handler: postServerRestoreTrash},
+		{Method: http.MethodPost, Path: "/api/servers/:server/files/trash/purge", Access: accessServer, Scope: ScopeFiles, Summary: "Permanently deletes files from the recycle bin", Handler: postServerPurgeTrash},
+		{Method: http.MethodGet, Path: "/api/servers/:server/files/versions", Access: accessServer, Scope: ScopeFiles, Summary: "Lists the previous versions of a file", Handler: getServerFileVersions, Response: []*server.FileVersion{}},
+		{Method: http.MethodPost, Path: "/api/servers/:server/files/versions/restore", Access: accessServer, Scope: ScopeFiles, Summary: "Restores a previous version of a file", Handler: postServerRestoreFileVersion},
+
+		{Method: http.MethodGet, Path: "/api/servers/:server/schedules", Access: accessServer, Scope: ScopeRead, Summary: "Lists the schedules of a server", Handler: getServerSchedules},
+		{Method: http.MethodPost, Path: "/api/servers/:server/git/clone", Access: accessServer, Scope: ScopeFiles, Summary: "Clones a git repository into a server", Handler: postServerGitClone, Request: server.GitDeployment{}},
+		{Method: http.MethodPost, Path: "/api/servers/:server/git/pull", Access: accessServer, Scope: ScopeFiles, Summary: "Pulls the latest changes for a git repository", Handler: postServerGitPull, Request: server.GitDeployment{}},
+		{Method: http.MethodPost, Path: "/api/servers/:server/backup", Access: accessServer, Scope: ScopeAdmin, Summary: "Creates a backup of a server", Handler: postServerBackup},
+		{Method: http.MethodDelete, Path: "/api/servers/:server/backup/:backup", Access: accessServer, Scope: ScopeAdmin, Summary: "Deletes a backup of a server", Handler: deleteServerBackup},
+	}
+}
+
+// The scope required for each route, keyed by the method and path of the route.
+var routeScopes = make(map[string]string)
+
+func init() {
+	for _, r := range apiRoutes() {
+		if r.Access != accessPublic {
+			routeScopes[r.Method+" "+r.Path] = r.Scope
+		}
+	}
+}
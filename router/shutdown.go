@@ -0,0 +1,48 @@
+package router
+
+import (
+	ws "github.com/gorilla/websocket"
+	"sync"
+	"time"
+)
+
+var (
+	shutdownOnce sync.Once
+	shuttingDown = make(chan struct{})
+
+	websocketsMu sync.Mutex
+	websockets   = make(map[*ws.Conn]struct{})
+)
+
+// Tracks an open websocket connection so that it can be closed cleanly when the daemon
+// is stopped. The returned function should be called once the connection is closed.
+func trackWebsocket(conn *ws.Conn) func() {
+	websocketsMu.Lock()
+	websockets[conn] = struct{}{}
+	websocketsMu.Unlock()
+
+	return func() {
+		websocketsMu.Lock()
+		delete(websockets, conn)
+		websocketsMu.Unlock()
+	}
+}
+
+// Ends every long running connection, such as websockets and event streams, so that the
+// webserver can finish shutting down. The HTTP server does not track connections that have
+// been upgraded to websockets, so those are sent a close message here, letting clients know
+// that they should reconnect once the daemon is back.
+func Shutdown() {
+	shutdownOnce.Do(func() {
+		close(shuttingDown)
+	})
+
+	websocketsMu.Lock()
+	defer websocketsMu.Unlock()
+
+	msg := ws.FormatCloseMessage(ws.CloseServiceRestart, "the daemon is restarting")
+	for conn := range websockets {
+		conn.WriteControl(ws.CloseMessage, msg, time.Now().Add(time.Second*5))
+		conn.Close()
+	}
+}
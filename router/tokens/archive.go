@@ -0,0 +1,26 @@
+package tokens
+
+import (
+	"github.com/gbrlsnchs/jwt/v3"
+)
+
+type ArchivePayload struct {
+	jwt.Payload
+	ServerUuid   string   `json:"server_uuid"`
+	IgnoredFiles []string `json:"ignored_files"`
+	UniqueId     string   `json:"unique_id"`
+	UserUuid     string   `json:"user_uuid"`
+}
+
+// Returns the JWT payload.
+func (p *ArchivePayload) GetPayload() *jwt.Payload {
+	return &p.Payload
+}
+
+// Determines if this JWT is valid for the given request cycle. If the
+// unique ID passed in the token has already been seen before this will
+// return false. This allows us to use this JWT as a one-time token that
+// validates all of the request.
+func (p *ArchivePayload) IsUniqueRequest() bool {
+	return getTokenStore().IsValidToken(p.UniqueId)
+}
@@ -9,6 +9,7 @@ type BackupPayload struct {
 	ServerUuid string `json:"server_uuid"`
 	BackupUuid string `json:"backup_uuid"`
 	UniqueId   string `json:"unique_id"`
+	UserUuid   string `json:"user_uuid"`
 }
 
 // Returns the JWT payload.
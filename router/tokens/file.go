@@ -9,6 +9,7 @@ type FilePayload struct {
 	FilePath   string `json:"file_path"`
 	ServerUuid string `json:"server_uuid"`
 	UniqueId   string `json:"unique_id"`
+	UserUuid   string `json:"user_uuid"`
 }
 
 // Returns the JWT payload.
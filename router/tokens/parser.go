@@ -23,5 +23,15 @@ func ParseToken(token []byte, data TokenData) error {
 
 	_, err := jwt.Verify(token, config.GetJwtAlgorithm(), &data, verifyOptions)
 
+	// Tokens signed by the Panel using the previous daemon token are still accepted for a
+	// short time after it has been rotated.
+	if err != nil {
+		if prev := config.GetPreviousJwtAlgorithm(); prev != nil {
+			if _, perr := jwt.Verify(token, prev, &data, verifyOptions); perr == nil {
+				return nil
+			}
+		}
+	}
+
 	return err
 }
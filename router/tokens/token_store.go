@@ -2,6 +2,8 @@ package tokens
 
 import (
 	"github.com/patrickmn/go-cache"
+	"github.com/pterodactyl/wings/store"
+	"go.uber.org/zap"
 	"sync"
 	"time"
 )
@@ -9,17 +11,20 @@ import (
 type TokenStore struct {
 	sync.Mutex
 	cache *cache.Cache
+	used  *store.Repository
 }
 
 var _tokens *TokenStore
 
 // Returns the global unique token store cache. This is used to validate
 // one time token usage by storing any received tokens in a local memory
-// cache until they are ready to expire.
+// cache until they are ready to expire. Tokens are also written to the
+// state store so that they cannot be used again after the daemon restarts.
 func getTokenStore() *TokenStore {
 	if _tokens == nil {
 		_tokens = &TokenStore{
 			cache: cache.New(time.Minute*60, time.Minute*5),
+			used:  store.NewRepository(store.TokenDenylist),
 		}
 	}
 
@@ -31,11 +36,23 @@ func (t *TokenStore) IsValidToken(token string) bool {
 	t.Lock()
 	defer t.Unlock()
 
-	_, exists := t.cache.Get(token)
+	if _, exists := t.cache.Get(token); exists {
+		return false
+	}
+
+	t.cache.Add(token, "", time.Minute*60)
+
+	// If the state store cannot be read the in-memory cache is still enforced, so the
+	// token is allowed rather than rejecting every request until the store recovers.
+	if used, err := t.used.Has(token); err != nil {
+		zap.S().Warnw("failed to check token against the state store", zap.Error(err))
+	} else if used {
+		return false
+	}
 
-	if !exists {
-		t.cache.Add(token, "", time.Minute*60)
+	if err := t.used.PutWithExpiry(token, true, time.Now().Add(time.Minute*60)); err != nil {
+		zap.S().Warnw("failed to persist used token to the state store", zap.Error(err))
 	}
 
-	return !exists
+	return true
 }
@@ -0,0 +1,184 @@
+package websocket
+
+import (
+	"fmt"
+	"github.com/gorilla/websocket"
+	"github.com/pkg/errors"
+	"github.com/pterodactyl/wings/server"
+	"net/http"
+	"sync"
+)
+
+// Events sent and received over the admin websocket.
+const (
+	SubscribeEvent    = "subscribe"
+	UnsubscribeEvent  = "unsubscribe"
+	SubscribedEvent   = "subscribed"
+	UnsubscribedEvent = "unsubscribed"
+)
+
+// The streams that can be subscribed to for a server over the admin websocket, and the
+// server events that they are made up of.
+var adminStreams = map[string]string{
+	"console": server.ConsoleOutputEvent,
+	"stats":   server.StatsEvent,
+}
+
+// A message sent over the admin websocket. This is the same as a normal websocket message
+// but every message includes the UUID of the server it relates to.
+type AdminMessage struct {
+	Event  string   `json:"event"`
+	Server string   `json:"server,omitempty"`
+	Args   []string `json:"args,omitempty"`
+}
+
+// Handles a websocket connection that can follow the console and stats of any number of
+// servers at once. This is only available to requests authenticated using an admin
+// token, so unlike the server websocket there are no per-message permission checks.
+type AdminHandler struct {
+	mu            sync.Mutex
+	Connection    *websocket.Conn
+	subscriptions map[string]*adminSubscription
+}
+
+type adminSubscription struct {
+	server *server.Server
+	topics []string
+	events chan server.Event
+	done   chan struct{}
+}
+
+// Upgrades the request to an admin websocket connection.
+func GetAdminHandler(w http.ResponseWriter, r *http.Request) (*AdminHandler, error) {
+	upgrader := websocket.Upgrader{}
+
+	conn, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	return &AdminHandler{
+		Connection:    conn,
+		subscriptions: make(map[string]*adminSubscription),
+	}, nil
+}
+
+// Sends a message over the connection.
+func (h *AdminHandler) SendJson(v *AdminMessage) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	return h.Connection.WriteJSON(v)
+}
+
+// Sends an error back over the connection, tagged with the server it relates to.
+func (h *AdminHandler) SendErrorJson(uuid string, err error) error {
+	return h.SendJson(&AdminMessage{Event: ErrorEvent, Server: uuid, Args: []string{err.Error()}})
+}
+
+// Handles a message received over the connection.
+func (h *AdminHandler) HandleInbound(m AdminMessage) error {
+	switch m.Event {
+	case SubscribeEvent:
+		return h.subscribe(m.Server, m.Args)
+	case UnsubscribeEvent:
+		h.unsubscribe(m.Server)
+
+		return h.SendJson(&AdminMessage{Event: UnsubscribedEvent, Server: m.Server})
+	}
+
+	return errors.New(fmt.Sprintf("unknown event \"%s\"", m.Event))
+}
+
+// Subscribes to the given streams for a server, replacing any existing subscription for
+// the server. If no streams are provided all of them are subscribed to.
+func (h *AdminHandler) subscribe(uuid string, streams []string) error {
+	s := server.GetServers().Find(func(s *server.Server) bool {
+		return s.Uuid == uuid
+	})
+
+	if s == nil {
+		return errors.New("no server exists with the provided uuid")
+	}
+
+	if len(streams) == 0 {
+		for k := range adminStreams {
+			streams = append(streams, k)
+		}
+	}
+
+	var topics []string
+	for _, v := range streams {
+		t, ok := adminStreams[v]
+		if !ok {
+			return errors.New(fmt.Sprintf("unknown stream \"%s\"", v))
+		}
+
+		topics = append(topics, t)
+	}
+
+	h.unsubscribe(uuid)
+
+	sub := &adminSubscription{
+		server: s,
+		topics: topics,
+		// Buffered so that a slow connection does not hold up the server, and so that any
+		// events published while unsubscribing do not block.
+		events: make(chan server.Event, 128),
+		done:   make(chan struct{}),
+	}
+
+	for _, t := range topics {
+		s.Events().Subscribe(t, sub.events)
+	}
+
+	h.mu.Lock()
+	h.subscriptions[uuid] = sub
+	h.mu.Unlock()
+
+	go func() {
+		for {
+			select {
+			case <-sub.done:
+				return
+			case e := <-sub.events:
+				h.SendJson(&AdminMessage{Event: e.Topic, Server: uuid, Args: []string{e.Data}})
+			}
+		}
+	}()
+
+	return h.SendJson(&AdminMessage{Event: SubscribedEvent, Server: uuid, Args: streams})
+}
+
+// Stops sending events for the given server.
+func (h *AdminHandler) unsubscribe(uuid string) {
+	h.mu.Lock()
+	sub, ok := h.subscriptions[uuid]
+	delete(h.subscriptions, uuid)
+	h.mu.Unlock()
+
+	if !ok {
+		return
+	}
+
+	for _, t := range sub.topics {
+		sub.server.Events().Unsubscribe(t, sub.events)
+	}
+
+	close(sub.done)
+}
+
+// Removes all of the subscriptions for the connection, this must be called once the
+// connection is closed.
+func (h *AdminHandler) UnsubscribeAll() {
+	h.mu.Lock()
+	var uuids []string
+	for k := range h.subscriptions {
+		uuids = append(uuids, k)
+	}
+	h.mu.Unlock()
+
+	for _, u := range uuids {
+		h.unsubscribe(u)
+	}
+}
@@ -45,6 +45,10 @@ func (h *Handler) ListenForServerEvents(ctx context.Context) {
 		server.InstallOutputEvent,
 		server.DaemonMessageEvent,
 		server.BackupCompletedEvent,
+		server.QueryEvent,
+		server.FileScanEvent,
+		server.HealthEvent,
+		server.TransferProgressEvent,
 	}
 
 	eventChannel := make(chan server.Event)
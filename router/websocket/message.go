@@ -8,6 +8,11 @@ const (
 	SetStateEvent              = "set state"
 	SendServerLogsEvent        = "send logs"
 	SendCommandEvent           = "send command"
+	CommandThrottledEvent      = "command throttled"
+	ResizeTerminalEvent        = "resize terminal"
+	WatchDirectoryEvent        = "watch directory"
+	UnwatchDirectoryEvent      = "unwatch directory"
+	FileChangeEvent            = "file change"
 	ErrorEvent                 = "daemon error"
 )
 
@@ -0,0 +1,166 @@
+package websocket
+
+import (
+	"github.com/pterodactyl/wings/config"
+	"sync"
+	"time"
+)
+
+// The longest that a command is held when commands over the limit are delayed.
+const maxCommandDelay = time.Second * 5
+
+// A token bucket limiting the number of commands that can be sent.
+type commandLimiter struct {
+	mu     sync.Mutex
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+func newCommandLimiter(burst int, rate float64) *commandLimiter {
+	return &commandLimiter{rate: rate, burst: float64(burst), tokens: float64(burst), last: time.Now()}
+}
+
+// Refills the bucket for the time passed since it was last used. The lock must be held when
+// this is called.
+func (l *commandLimiter) refill(now time.Time) {
+	l.tokens += now.Sub(l.last).Seconds() * l.rate
+	if l.tokens > l.burst {
+		l.tokens = l.burst
+	}
+	l.last = now
+}
+
+// Returns how long to wait until a command is allowed. If the wait is no longer than the
+// maximum given the command is counted against the bucket, otherwise it is not counted and
+// should be dropped.
+func (l *commandLimiter) reserve(max time.Duration) (time.Duration, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.refill(time.Now())
+
+	var wait time.Duration
+	if l.tokens < 1 {
+		if l.rate <= 0 {
+			return 0, false
+		}
+
+		wait = time.Duration((1 - l.tokens) / l.rate * float64(time.Second))
+	}
+
+	if wait > max {
+		return wait, false
+	}
+
+	l.tokens--
+
+	return wait, true
+}
+
+// Gives back a command that was reserved but never sent.
+func (l *commandLimiter) cancel() {
+	l.mu.Lock()
+	l.tokens++
+	l.mu.Unlock()
+}
+
+// Determines if the bucket has refilled completely, meaning it no longer needs to be kept.
+func (l *commandLimiter) full() bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.refill(time.Now())
+
+	return l.tokens >= l.burst
+}
+
+var userLimiters = struct {
+	sync.Mutex
+	limiters map[string]*commandLimiter
+	swept    time.Time
+}{limiters: make(map[string]*commandLimiter)}
+
+// Returns the limiter shared by every connection for a user. Limiters for users that have
+// not sent a command recently are removed periodically.
+func getUserLimiter(user string, c config.ConsoleRateLimitConfiguration) *commandLimiter {
+	userLimiters.Lock()
+	defer userLimiters.Unlock()
+
+	if time.Since(userLimiters.swept) > time.Minute {
+		for k, l := range userLimiters.limiters {
+			if l.full() {
+				delete(userLimiters.limiters, k)
+			}
+		}
+		userLimiters.swept = time.Now()
+	}
+
+	l, ok := userLimiters.limiters[user]
+	if !ok {
+		l = newCommandLimiter(c.UserBurst, c.UserRate)
+		userLimiters.limiters[user] = l
+	}
+
+	return l
+}
+
+// Determines if a command can be sent using this connection, waiting until it can be if
+// delaying is enabled. If the command is dropped a warning is sent to the connection, only
+// once until commands are allowed again so that the warnings do not flood the client.
+func (h *Handler) allowCommand() bool {
+	c := config.Get().Api.ConsoleRateLimit
+	if !c.Enabled {
+		return true
+	}
+
+	max := time.Duration(0)
+	if c.Delay {
+		max = maxCommandDelay
+	}
+
+	conn, ok := h.limiter.reserve(max)
+	if !ok {
+		h.warnThrottled()
+		return false
+	}
+
+	wait := conn
+	if j := h.GetJwt(); j != nil && j.UserID != "" {
+		user, ok := getUserLimiter(j.UserID.String(), c).reserve(max)
+		if !ok {
+			h.limiter.cancel()
+			h.warnThrottled()
+			return false
+		}
+
+		if user > wait {
+			wait = user
+		}
+	}
+
+	h.Lock()
+	h.throttled = false
+	h.Unlock()
+
+	if wait > 0 {
+		time.Sleep(wait)
+	}
+
+	return true
+}
+
+func (h *Handler) warnThrottled() {
+	h.Lock()
+	warned := h.throttled
+	h.throttled = true
+	h.Unlock()
+
+	if !warned {
+		h.SendJson(&Message{
+			Event: CommandThrottledEvent,
+			Args:  []string{"Commands are being sent too quickly, some commands have not been sent to the server."},
+		})
+	}
+}
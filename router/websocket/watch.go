@@ -0,0 +1,45 @@
+package websocket
+
+import (
+	"github.com/pterodactyl/wings/server"
+)
+
+// Starts sending the changes made to files in a directory of the server over the socket,
+// replacing the directory that was previously being watched. Only a single directory is
+// watched for each connection, which is the one currently open in the file manager.
+func (h *Handler) WatchDirectory(dir string) error {
+	h.watchMu.Lock()
+	defer h.watchMu.Unlock()
+
+	if h.watcher != nil {
+		h.watcher.Close()
+		h.watcher = nil
+	}
+
+	w, err := h.server.Filesystem.WatchDirectory(dir, func(changes []server.FileChange) {
+		for _, c := range changes {
+			h.SendJson(&Message{
+				Event: FileChangeEvent,
+				Args:  []string{c.Action, c.Path},
+			})
+		}
+	})
+	if err != nil {
+		return err
+	}
+
+	h.watcher = w
+
+	return nil
+}
+
+// Stops sending file changes over the socket.
+func (h *Handler) StopWatching() {
+	h.watchMu.Lock()
+	defer h.watchMu.Unlock()
+
+	if h.watcher != nil {
+		h.watcher.Close()
+		h.watcher = nil
+	}
+}
@@ -12,6 +12,7 @@ import (
 	"go.uber.org/zap"
 	"net/http"
 	"os"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
@@ -28,6 +29,7 @@ const (
 	PermissionReceiveErrors    = "admin.errors"
 	PermissionReceiveInstall   = "admin.install"
 	PermissionReceiveBackups   = "backup.read"
+	PermissionReadFiles        = "file.read"
 )
 
 type Handler struct {
@@ -35,6 +37,15 @@ type Handler struct {
 	Connection *websocket.Conn
 	jwt        *tokens.WebsocketPayload `json:"-"`
 	server     *server.Server
+
+	// Limits the commands sent using this connection, and tracks whether the client has
+	// been warned about sending commands too quickly.
+	limiter   *commandLimiter
+	throttled bool
+
+	// The directory that the client has asked to receive file changes for, if any.
+	watchMu sync.Mutex
+	watcher *server.DirectoryWatcher
 }
 
 // Parses a JWT into a websocket token payload.
@@ -42,7 +53,11 @@ func NewTokenPayload(token []byte) (*tokens.WebsocketPayload, error) {
 	payload := tokens.WebsocketPayload{}
 	err := tokens.ParseToken(token, &payload)
 	if err != nil {
-		return nil, err
+		if err == jwt.ErrExpValidation {
+			return nil, err
+		}
+
+		return nil, &invalidToken{err: err}
 	}
 
 	if !payload.HasPermission(PermissionConnect) {
@@ -52,6 +67,23 @@ func NewTokenPayload(token []byte) (*tokens.WebsocketPayload, error) {
 	return &payload, nil
 }
 
+// Returned when a client authenticates using a token that was not signed by the Panel, as
+// opposed to one that has just expired.
+type invalidToken struct {
+	err error
+}
+
+func (e *invalidToken) Error() string {
+	return e.err.Error()
+}
+
+// Determines if the error was caused by a client authenticating using an invalid token.
+func IsInvalidTokenError(err error) bool {
+	_, ok := err.(*invalidToken)
+
+	return ok
+}
+
 // Returns a new websocket handler using the context provided.
 func GetHandler(s *server.Server, w http.ResponseWriter, r *http.Request) (*Handler, error) {
 	upgrader := websocket.Upgrader{
@@ -67,10 +99,13 @@ func GetHandler(s *server.Server, w http.ResponseWriter, r *http.Request) (*Hand
 		return nil, err
 	}
 
+	rl := config.Get().Api.ConsoleRateLimit
+
 	return &Handler{
 		Connection: conn,
 		jwt:        nil,
 		server:     s,
+		limiter:    newCommandLimiter(rl.Burst, rl.Rate),
 	}, nil
 }
 
@@ -86,7 +121,6 @@ func (h *Handler) SendJson(v *Message) error {
 		// If we're sending installation output but the user does not have the required
 		// permissions to see the output, don't send it down the line.
 		if v.Event == server.InstallOutputEvent {
-			zap.S().Debugf("%+v", v.Args)
 			if !j.HasPermission(PermissionReceiveInstall) {
 				return nil
 			}
@@ -146,7 +180,7 @@ func (h *Handler) SendErrorJson(err error) error {
 	j := h.GetJwt()
 
 	message := "an unexpected error was encountered while handling this request"
-	if server.IsSuspendedError(err) || (j != nil && j.HasPermission(PermissionReceiveErrors)) {
+	if server.IsSuspendedError(err) || server.IsMaintenanceModeError(err) || server.IsCommandDeniedError(err) || server.IsTerminalSizeInvalidError(err) || (j != nil && j.HasPermission(PermissionReceiveErrors)) {
 		message = err.Error()
 	}
 
@@ -155,7 +189,8 @@ func (h *Handler) SendErrorJson(err error) error {
 	wsm := Message{Event: ErrorEvent}
 	wsm.Args = []string{m}
 
-	if !server.IsSuspendedError(err) {
+	// Denied commands have already been logged when they were checked.
+	if !server.IsSuspendedError(err) && !server.IsCommandDeniedError(err) {
 		zap.S().Errorw(
 			"an error was encountered in the websocket process",
 			zap.String("server", h.server.Uuid),
@@ -238,7 +273,14 @@ func (h *Handler) HandleInbound(m Message) error {
 		}
 	case SetStateEvent:
 		{
-			switch strings.Join(m.Args, "") {
+			action := strings.Join(m.Args, "")
+			if action == "start" || action == "restart" {
+				if err := server.CheckMaintenanceMode(); err != nil {
+					return err
+				}
+			}
+
+			switch action {
 			case "start":
 				if h.GetJwt().HasPermission(PermissionSendPowerStart) {
 					return h.server.Environment.Start()
@@ -297,7 +339,52 @@ func (h *Handler) HandleInbound(m Message) error {
 				return nil
 			}
 
-			return h.server.Environment.SendCommand(strings.Join(m.Args, ""))
+			command := strings.Join(m.Args, "")
+			if err := h.server.CheckCommand(command, server.CommandSourceWebsocket); err != nil {
+				return err
+			}
+
+			if !h.allowCommand() {
+				return nil
+			}
+
+			return h.server.Environment.SendCommand(command)
+		}
+	case ResizeTerminalEvent:
+		{
+			if !h.GetJwt().HasPermission(PermissionSendCommand) {
+				return nil
+			}
+
+			if len(m.Args) != 2 {
+				return errors.New("a terminal resize must include the number of columns and rows")
+			}
+
+			width, err := strconv.ParseUint(m.Args[0], 10, 32)
+			if err != nil {
+				return errors.WithStack(err)
+			}
+
+			height, err := strconv.ParseUint(m.Args[1], 10, 32)
+			if err != nil {
+				return errors.WithStack(err)
+			}
+
+			return h.server.ResizeTerminal(uint(width), uint(height))
+		}
+	case WatchDirectoryEvent:
+		{
+			if !h.GetJwt().HasPermission(PermissionReadFiles) {
+				return nil
+			}
+
+			return h.WatchDirectory(strings.Join(m.Args, ""))
+		}
+	case UnwatchDirectoryEvent:
+		{
+			h.StopWatching()
+
+			return nil
 		}
 	}
 
@@ -0,0 +1,121 @@
+package rpc
+
+import (
+	"context"
+	"github.com/pterodactyl/wings/config"
+	"github.com/pterodactyl/wings/router"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+	"net"
+	"strings"
+)
+
+// The scope an API key must have been granted to make each call. Calls that are not listed
+// here require the admin scope.
+var methodScopes = map[string]string{
+	"/wings.v1.Wings/ListServers":   router.ScopeRead,
+	"/wings.v1.Wings/GetServer":     router.ScopeRead,
+	"/wings.v1.Wings/StreamStats":   router.ScopeRead,
+	"/wings.v1.Wings/Power":         router.ScopePower,
+	"/wings.v1.Wings/SendCommand":   router.ScopePower,
+	"/wings.v1.Wings/ListDirectory": router.ScopeFiles,
+	"/wings.v1.Wings/ReadFile":      router.ScopeFiles,
+	"/wings.v1.Wings/WriteFile":     router.ScopeFiles,
+	"/wings.v1.Wings/DeleteFiles":   router.ScopeFiles,
+}
+
+// Returns the address the call was made from, which is used to apply the same bans as the
+// REST API.
+func peerAddress(p *peer.Peer) string {
+	if p == nil || p.Addr == nil {
+		return ""
+	}
+
+	host, _, err := net.SplitHostPort(p.Addr.String())
+	if err != nil {
+		return p.Addr.String()
+	}
+
+	return host
+}
+
+// Determines if the call was made using a client certificate signed by one of the configured
+// authorities. The TLS handshake has already verified any certificate that was provided, so
+// this only needs to check that one was.
+func hasVerifiedCertificate(p *peer.Peer) bool {
+	if p == nil {
+		return false
+	}
+
+	info, ok := p.AuthInfo.(credentials.TLSInfo)
+
+	return ok && len(info.State.VerifiedChains) > 0
+}
+
+// Checks the bearer token sent in the metadata of a call, using the same tokens and API
+// keys that are accepted by the REST API. Calls are subject to the same address bans and
+// client certificate requirements as the REST API, and failed attempts count towards a ban.
+func authenticate(ctx context.Context, method string) error {
+	p, _ := peer.FromContext(ctx)
+	address := peerAddress(p)
+
+	if _, ok := router.ActiveBan(address); ok {
+		return status.Error(codes.PermissionDenied, "this address has been temporarily banned from accessing the API")
+	}
+
+	ssl := config.Get().Api.Ssl
+	if ssl.Enabled && ssl.ClientCaFile != "" && !hasVerifiedCertificate(p) {
+		return status.Error(codes.Unauthenticated, "a valid client certificate is required to make this call")
+	}
+
+	md, _ := metadata.FromIncomingContext(ctx)
+
+	var token string
+	if v := md.Get("authorization"); len(v) > 0 {
+		parts := strings.SplitN(v[0], " ", 2)
+		if len(parts) == 2 && parts[0] == "Bearer" {
+			token = parts[1]
+		}
+	}
+
+	if token == "" {
+		return status.Error(codes.Unauthenticated, "the required authorization metadata was not present in the request")
+	}
+
+	scope, ok := methodScopes[method]
+	if !ok {
+		scope = router.ScopeAdmin
+	}
+
+	if name, ok := router.AuthenticateToken(token, scope); !ok {
+		// A valid key that is missing the scope for this call is not a failed attempt to
+		// authenticate, only tokens that do not match anything are.
+		if name == "" {
+			router.RecordAuthFailure(address)
+		}
+
+		return status.Error(codes.PermissionDenied, "you are not authorized to make this call")
+	}
+
+	return nil
+}
+
+func unaryAuth(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	if err := authenticate(ctx, info.FullMethod); err != nil {
+		return nil, err
+	}
+
+	return handler(ctx, req)
+}
+
+func streamAuth(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	if err := authenticate(ss.Context(), info.FullMethod); err != nil {
+		return err
+	}
+
+	return handler(srv, ss)
+}
@@ -0,0 +1,331 @@
+package rpc
+
+//go:generate protoc --go_out=plugins=grpc,paths=source_relative:. wings.proto
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"github.com/pkg/errors"
+	"github.com/pterodactyl/wings/server"
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// The size of each chunk sent when streaming the contents of a file.
+const chunkSize = 64 * 1024
+
+// Returns a gRPC server that provides the Wings service.
+func NewServer() *grpc.Server {
+	g := grpc.NewServer(grpc.UnaryInterceptor(unaryAuth), grpc.StreamInterceptor(streamAuth))
+	RegisterWingsServer(g, &wingsServer{})
+
+	return g
+}
+
+// Returns a handler that passes gRPC requests to the gRPC server and everything else to
+// the given handler. This is used when serving over TLS, where HTTP/2 is negotiated by the
+// webserver itself.
+func Handler(g *grpc.Server, h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.ProtoMajor == 2 && strings.HasPrefix(r.Header.Get("Content-Type"), "application/grpc") {
+			g.ServeHTTP(w, r)
+			return
+		}
+
+		h.ServeHTTP(w, r)
+	})
+}
+
+type wingsServer struct{}
+
+// Returns the server with the given UUID, or a not found error.
+func findServer(uuid string) (*server.Server, error) {
+	s := server.GetServers().Find(func(s *server.Server) bool {
+		return s.Uuid == uuid
+	})
+
+	if s == nil {
+		return nil, status.Error(codes.NotFound, "the requested server does not exist")
+	}
+
+	return s, nil
+}
+
+// Converts an error encountered while handling a call into a status that can be returned
+// to the client. Unexpected errors are logged and a generic error is returned.
+func callError(s *server.Server, err error) error {
+	cause := errors.Cause(err)
+
+	switch {
+	case os.IsNotExist(cause):
+		return status.Error(codes.NotFound, "the requested resource was not found on the system")
+	case server.IsProtectedFileError(cause):
+		return status.Error(codes.PermissionDenied, "this file is protected and cannot be modified")
+	case server.IsEditableFileError(cause), server.IsInfectedFileError(cause):
+		return status.Error(codes.InvalidArgument, err.Error())
+	case server.IsTooManyUploadsError(cause):
+		return status.Error(codes.ResourceExhausted, "there are too many uploads in progress, please try again shortly")
+	case server.IsOperationQueueFullError(cause):
+		return status.Error(codes.ResourceExhausted, err.Error())
+	case server.IsOperationConflictError(cause):
+		return status.Error(codes.FailedPrecondition, err.Error())
+	}
+
+	zap.S().Errorw("encountered error while handling gRPC call", zap.String("server", s.Uuid), zap.Error(err))
+
+	return status.Error(codes.Internal, "an unexpected error was encountered while processing this request")
+}
+
+func toStats(s *server.Server, r *server.ResourceUsage) *Stats {
+	return &Stats{
+		State:            s.GetState(),
+		MemoryBytes:      r.Memory,
+		MemoryLimitBytes: r.MemoryLimit,
+		CpuAbsolute:      r.CpuAbsolute,
+		DiskBytes:        r.Disk,
+		NetworkRxBytes:   r.Network.RxBytes,
+		NetworkTxBytes:   r.Network.TxBytes,
+	}
+}
+
+func toServer(s *server.Server) *Server {
+	r := s.GetResources()
+
+	return &Server{
+		Uuid:        s.Uuid,
+		State:       s.GetState(),
+		Suspended:   s.Suspended,
+		Utilization: toStats(s, &r),
+	}
+}
+
+func (w *wingsServer) ListServers(ctx context.Context, req *ListServersRequest) (*ListServersResponse, error) {
+	res := &ListServersResponse{}
+	for _, s := range server.GetServers().All() {
+		res.Servers = append(res.Servers, toServer(s))
+	}
+
+	return res, nil
+}
+
+func (w *wingsServer) GetServer(ctx context.Context, req *ServerRequest) (*Server, error) {
+	s, err := findServer(req.Uuid)
+	if err != nil {
+		return nil, err
+	}
+
+	return toServer(s), nil
+}
+
+func (w *wingsServer) Power(ctx context.Context, req *PowerRequest) (*Empty, error) {
+	s, err := findServer(req.Uuid)
+	if err != nil {
+		return nil, err
+	}
+
+	action := server.PowerAction{Action: req.Action}
+	if !action.IsValid() {
+		return nil, status.Error(codes.InvalidArgument, `the power action provided was not valid, should be one of "stop", "start", "restart", "kill"`)
+	}
+
+	if action.Action == "start" || action.Action == "restart" {
+		if err := server.CheckMaintenanceMode(); err != nil {
+			return nil, status.Error(codes.Unavailable, err.Error())
+		}
+
+		if s.Suspended {
+			return nil, status.Error(codes.FailedPrecondition, "cannot start or restart a server that is suspended")
+		}
+	}
+
+	if err := s.QueuePowerAction(action); err != nil {
+		return nil, callError(s, err)
+	}
+
+	return &Empty{}, nil
+}
+
+func (w *wingsServer) SendCommand(ctx context.Context, req *CommandRequest) (*Empty, error) {
+	s, err := findServer(req.Uuid)
+	if err != nil {
+		return nil, err
+	}
+
+	if running, err := s.Environment.IsRunning(); err != nil {
+		return nil, callError(s, err)
+	} else if !running {
+		return nil, status.Error(codes.FailedPrecondition, "cannot send commands to a stopped server instance")
+	}
+
+	for _, command := range req.Commands {
+		if err := s.CheckCommand(command, server.CommandSourceGrpc); err != nil {
+			return nil, status.Error(codes.PermissionDenied, err.Error())
+		}
+	}
+
+	for _, command := range req.Commands {
+		if err := s.Environment.SendCommand(command); err != nil {
+			zap.S().Warnw("failed to send command to server", zap.String("server", s.Uuid), zap.String("command", command), zap.Error(err))
+		}
+	}
+
+	return &Empty{}, nil
+}
+
+func (w *wingsServer) StreamStats(req *ServerRequest, stream Wings_StreamStatsServer) error {
+	s, err := findServer(req.Uuid)
+	if err != nil {
+		return err
+	}
+
+	ch := make(chan server.Event, 8)
+	s.Events().Subscribe(server.StatsEvent, ch)
+	defer s.Events().Unsubscribe(server.StatsEvent, ch)
+
+	r := s.GetResources()
+	if err := stream.Send(toStats(s, &r)); err != nil {
+		return err
+	}
+
+	for {
+		select {
+		case <-stream.Context().Done():
+			return nil
+		case e := <-ch:
+			var r server.ResourceUsage
+			if err := json.Unmarshal([]byte(e.Data), &r); err != nil {
+				continue
+			}
+
+			if err := stream.Send(toStats(s, &r)); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+func (w *wingsServer) ListDirectory(ctx context.Context, req *ListDirectoryRequest) (*ListDirectoryResponse, error) {
+	s, err := findServer(req.Uuid)
+	if err != nil {
+		return nil, err
+	}
+
+	stats, _, err := s.Filesystem.ListDirectory(req.Directory, server.ListOptions{})
+	if err != nil {
+		return nil, callError(s, err)
+	}
+
+	res := &ListDirectoryResponse{}
+	for _, st := range stats {
+		res.Files = append(res.Files, &FileInfo{
+			Name:      st.Info.Name(),
+			Size:      st.Info.Size(),
+			Mode:      st.Info.Mode().String(),
+			Directory: st.Info.IsDir(),
+			Symlink:   st.Info.Mode()&os.ModeSymlink != 0,
+			Mime:      st.Mimetype,
+			Modified:  st.Info.ModTime().Unix(),
+		})
+	}
+
+	return res, nil
+}
+
+func (w *wingsServer) ReadFile(req *FileRequest, stream Wings_ReadFileServer) error {
+	s, err := findServer(req.Uuid)
+	if err != nil {
+		return err
+	}
+
+	cleaned, err := s.Filesystem.SafePath(req.Path)
+	if err != nil {
+		return status.Error(codes.NotFound, "the file requested could not be found")
+	}
+
+	st, err := s.Filesystem.Stat(cleaned)
+	if err != nil {
+		return callError(s, err)
+	}
+
+	if st.Info.IsDir() {
+		return status.Error(codes.InvalidArgument, "the path requested is a directory")
+	}
+
+	f, err := s.Filesystem.OpenFile(cleaned, os.O_RDONLY, 0)
+	if err != nil {
+		return callError(s, err)
+	}
+	defer f.Close()
+
+	buf := make([]byte, chunkSize)
+	for {
+		n, err := f.Read(buf)
+		if n > 0 {
+			if err := stream.Send(&FileChunk{Data: buf[:n]}); err != nil {
+				return err
+			}
+		}
+
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return callError(s, err)
+		}
+	}
+}
+
+// Writes a file in the same way as files saved through the REST API, so the contents are
+// checked, scanned, and the previous version of the file is kept.
+func (w *wingsServer) WriteFile(ctx context.Context, req *WriteFileRequest) (*Empty, error) {
+	s, err := findServer(req.Uuid)
+	if err != nil {
+		return nil, err
+	}
+
+	upload, err := s.Filesystem.BeginUpload()
+	if err != nil {
+		return nil, callError(s, err)
+	}
+	defer upload.Done()
+
+	b, err := server.ReadEditableContent(upload.Reader(bytes.NewReader(req.Content)))
+	if err != nil {
+		return nil, callError(s, err)
+	}
+
+	if err := s.Filesystem.ScanContent(req.Path, b); err != nil {
+		return nil, callError(s, err)
+	}
+
+	if err := s.Filesystem.SaveVersion(req.Path); err != nil {
+		zap.S().Warnw("failed to save previous version of file", zap.String("server", s.Uuid), zap.String("file", req.Path), zap.Error(err))
+	}
+
+	if err := s.Filesystem.Writefile(req.Path, bytes.NewReader(b)); err != nil {
+		return nil, callError(s, err)
+	}
+
+	return &Empty{}, nil
+}
+
+func (w *wingsServer) DeleteFiles(ctx context.Context, req *DeleteFilesRequest) (*Empty, error) {
+	s, err := findServer(req.Uuid)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, p := range req.Paths {
+		if err := s.Filesystem.Delete(p); err != nil {
+			return nil, callError(s, err)
+		}
+	}
+
+	return &Empty{}, nil
+}
@@ -0,0 +1,1290 @@
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// source: wings.proto
+
+package rpc
+
+import (
+	context "context"
+	fmt "fmt"
+	proto "github.com/golang/protobuf/proto"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+	math "math"
+)
+
+// Reference imports to suppress errors if they are not otherwise used.
+var _ = proto.Marshal
+var _ = fmt.Errorf
+var _ = math.Inf
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the proto package it is being compiled against.
+// A compilation error at this line likely means your copy of the
+// proto package needs to be updated.
+const _ = proto.ProtoPackageIsVersion3 // please upgrade the proto package
+
+type Empty struct {
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *Empty) Reset()         { *m = Empty{} }
+func (m *Empty) String() string { return proto.CompactTextString(m) }
+func (*Empty) ProtoMessage()    {}
+func (*Empty) Descriptor() ([]byte, []int) {
+	return fileDescriptor_dcb6b122875a1d04, []int{0}
+}
+
+func (m *Empty) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_Empty.Unmarshal(m, b)
+}
+func (m *Empty) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_Empty.Marshal(b, m, deterministic)
+}
+func (m *Empty) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_Empty.Merge(m, src)
+}
+func (m *Empty) XXX_Size() int {
+	return xxx_messageInfo_Empty.Size(m)
+}
+func (m *Empty) XXX_DiscardUnknown() {
+	xxx_messageInfo_Empty.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_Empty proto.InternalMessageInfo
+
+type ListServersRequest struct {
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *ListServersRequest) Reset()         { *m = ListServersRequest{} }
+func (m *ListServersRequest) String() string { return proto.CompactTextString(m) }
+func (*ListServersRequest) ProtoMessage()    {}
+func (*ListServersRequest) Descriptor() ([]byte, []int) {
+	return fileDescriptor_dcb6b122875a1d04, []int{1}
+}
+
+func (m *ListServersRequest) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_ListServersRequest.Unmarshal(m, b)
+}
+func (m *ListServersRequest) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_ListServersRequest.Marshal(b, m, deterministic)
+}
+func (m *ListServersRequest) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_ListServersRequest.Merge(m, src)
+}
+func (m *ListServersRequest) XXX_Size() int {
+	return xxx_messageInfo_ListServersRequest.Size(m)
+}
+func (m *ListServersRequest) XXX_DiscardUnknown() {
+	xxx_messageInfo_ListServersRequest.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_ListServersRequest proto.InternalMessageInfo
+
+type ListServersResponse struct {
+	Servers              []*Server `protobuf:"bytes,1,rep,name=servers,proto3" json:"servers,omitempty"`
+	XXX_NoUnkeyedLiteral struct{}  `json:"-"`
+	XXX_unrecognized     []byte    `json:"-"`
+	XXX_sizecache        int32     `json:"-"`
+}
+
+func (m *ListServersResponse) Reset()         { *m = ListServersResponse{} }
+func (m *ListServersResponse) String() string { return proto.CompactTextString(m) }
+func (*ListServersResponse) ProtoMessage()    {}
+func (*ListServersResponse) Descriptor() ([]byte, []int) {
+	return fileDescriptor_dcb6b122875a1d04, []int{2}
+}
+
+func (m *ListServersResponse) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_ListServersResponse.Unmarshal(m, b)
+}
+func (m *ListServersResponse) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_ListServersResponse.Marshal(b, m, deterministic)
+}
+func (m *ListServersResponse) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_ListServersResponse.Merge(m, src)
+}
+func (m *ListServersResponse) XXX_Size() int {
+	return xxx_messageInfo_ListServersResponse.Size(m)
+}
+func (m *ListServersResponse) XXX_DiscardUnknown() {
+	xxx_messageInfo_ListServersResponse.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_ListServersResponse proto.InternalMessageInfo
+
+func (m *ListServersResponse) GetServers() []*Server {
+	if m != nil {
+		return m.Servers
+	}
+	return nil
+}
+
+type ServerRequest struct {
+	Uuid                 string   `protobuf:"bytes,1,opt,name=uuid,proto3" json:"uuid,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *ServerRequest) Reset()         { *m = ServerRequest{} }
+func (m *ServerRequest) String() string { return proto.CompactTextString(m) }
+func (*ServerRequest) ProtoMessage()    {}
+func (*ServerRequest) Descriptor() ([]byte, []int) {
+	return fileDescriptor_dcb6b122875a1d04, []int{3}
+}
+
+func (m *ServerRequest) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_ServerRequest.Unmarshal(m, b)
+}
+func (m *ServerRequest) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_ServerRequest.Marshal(b, m, deterministic)
+}
+func (m *ServerRequest) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_ServerRequest.Merge(m, src)
+}
+func (m *ServerRequest) XXX_Size() int {
+	return xxx_messageInfo_ServerRequest.Size(m)
+}
+func (m *ServerRequest) XXX_DiscardUnknown() {
+	xxx_messageInfo_ServerRequest.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_ServerRequest proto.InternalMessageInfo
+
+func (m *ServerRequest) GetUuid() string {
+	if m != nil {
+		return m.Uuid
+	}
+	return ""
+}
+
+type Server struct {
+	Uuid                 string   `protobuf:"bytes,1,opt,name=uuid,proto3" json:"uuid,omitempty"`
+	State                string   `protobuf:"bytes,2,opt,name=state,proto3" json:"state,omitempty"`
+	Suspended            bool     `protobuf:"varint,3,opt,name=suspended,proto3" json:"suspended,omitempty"`
+	Utilization          *Stats   `protobuf:"bytes,4,opt,name=utilization,proto3" json:"utilization,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *Server) Reset()         { *m = Server{} }
+func (m *Server) String() string { return proto.CompactTextString(m) }
+func (*Server) ProtoMessage()    {}
+func (*Server) Descriptor() ([]byte, []int) {
+	return fileDescriptor_dcb6b122875a1d04, []int{4}
+}
+
+func (m *Server) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_Server.Unmarshal(m, b)
+}
+func (m *Server) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_Server.Marshal(b, m, deterministic)
+}
+func (m *Server) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_Server.Merge(m, src)
+}
+func (m *Server) XXX_Size() int {
+	return xxx_messageInfo_Server.Size(m)
+}
+func (m *Server) XXX_DiscardUnknown() {
+	xxx_messageInfo_Server.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_Server proto.InternalMessageInfo
+
+func (m *Server) GetUuid() string {
+	if m != nil {
+		return m.Uuid
+	}
+	return ""
+}
+
+func (m *Server) GetState() string {
+	if m != nil {
+		return m.State
+	}
+	return ""
+}
+
+func (m *Server) GetSuspended() bool {
+	if m != nil {
+		return m.Suspended
+	}
+	return false
+}
+
+func (m *Server) GetUtilization() *Stats {
+	if m != nil {
+		return m.Utilization
+	}
+	return nil
+}
+
+type PowerRequest struct {
+	Uuid string `protobuf:"bytes,1,opt,name=uuid,proto3" json:"uuid,omitempty"`
+	// One of "start", "stop", "restart", or "kill".
+	Action               string   `protobuf:"bytes,2,opt,name=action,proto3" json:"action,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *PowerRequest) Reset()         { *m = PowerRequest{} }
+func (m *PowerRequest) String() string { return proto.CompactTextString(m) }
+func (*PowerRequest) ProtoMessage()    {}
+func (*PowerRequest) Descriptor() ([]byte, []int) {
+	return fileDescriptor_dcb6b122875a1d04, []int{5}
+}
+
+func (m *PowerRequest) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_PowerRequest.Unmarshal(m, b)
+}
+func (m *PowerRequest) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_PowerRequest.Marshal(b, m, deterministic)
+}
+func (m *PowerRequest) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_PowerRequest.Merge(m, src)
+}
+func (m *PowerRequest) XXX_Size() int {
+	return xxx_messageInfo_PowerRequest.Size(m)
+}
+func (m *PowerRequest) XXX_DiscardUnknown() {
+	xxx_messageInfo_PowerRequest.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_PowerRequest proto.InternalMessageInfo
+
+func (m *PowerRequest) GetUuid() string {
+	if m != nil {
+		return m.Uuid
+	}
+	return ""
+}
+
+func (m *PowerRequest) GetAction() string {
+	if m != nil {
+		return m.Action
+	}
+	return ""
+}
+
+type CommandRequest struct {
+	Uuid                 string   `protobuf:"bytes,1,opt,name=uuid,proto3" json:"uuid,omitempty"`
+	Commands             []string `protobuf:"bytes,2,rep,name=commands,proto3" json:"commands,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *CommandRequest) Reset()         { *m = CommandRequest{} }
+func (m *CommandRequest) String() string { return proto.CompactTextString(m) }
+func (*CommandRequest) ProtoMessage()    {}
+func (*CommandRequest) Descriptor() ([]byte, []int) {
+	return fileDescriptor_dcb6b122875a1d04, []int{6}
+}
+
+func (m *CommandRequest) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_CommandRequest.Unmarshal(m, b)
+}
+func (m *CommandRequest) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_CommandRequest.Marshal(b, m, deterministic)
+}
+func (m *CommandRequest) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_CommandRequest.Merge(m, src)
+}
+func (m *CommandRequest) XXX_Size() int {
+	return xxx_messageInfo_CommandRequest.Size(m)
+}
+func (m *CommandRequest) XXX_DiscardUnknown() {
+	xxx_messageInfo_CommandRequest.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_CommandRequest proto.InternalMessageInfo
+
+func (m *CommandRequest) GetUuid() string {
+	if m != nil {
+		return m.Uuid
+	}
+	return ""
+}
+
+func (m *CommandRequest) GetCommands() []string {
+	if m != nil {
+		return m.Commands
+	}
+	return nil
+}
+
+type Stats struct {
+	State                string   `protobuf:"bytes,1,opt,name=state,proto3" json:"state,omitempty"`
+	MemoryBytes          uint64   `protobuf:"varint,2,opt,name=memory_bytes,json=memoryBytes,proto3" json:"memory_bytes,omitempty"`
+	MemoryLimitBytes     uint64   `protobuf:"varint,3,opt,name=memory_limit_bytes,json=memoryLimitBytes,proto3" json:"memory_limit_bytes,omitempty"`
+	CpuAbsolute          float64  `protobuf:"fixed64,4,opt,name=cpu_absolute,json=cpuAbsolute,proto3" json:"cpu_absolute,omitempty"`
+	DiskBytes            int64    `protobuf:"varint,5,opt,name=disk_bytes,json=diskBytes,proto3" json:"disk_bytes,omitempty"`
+	NetworkRxBytes       uint64   `protobuf:"varint,6,opt,name=network_rx_bytes,json=networkRxBytes,proto3" json:"network_rx_bytes,omitempty"`
+	NetworkTxBytes       uint64   `protobuf:"varint,7,opt,name=network_tx_bytes,json=networkTxBytes,proto3" json:"network_tx_bytes,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *Stats) Reset()         { *m = Stats{} }
+func (m *Stats) String() string { return proto.CompactTextString(m) }
+func (*Stats) ProtoMessage()    {}
+func (*Stats) Descriptor() ([]byte, []int) {
+	return fileDescriptor_dcb6b122875a1d04, []int{7}
+}
+
+func (m *Stats) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_Stats.Unmarshal(m, b)
+}
+func (m *Stats) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_Stats.Marshal(b, m, deterministic)
+}
+func (m *Stats) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_Stats.Merge(m, src)
+}
+func (m *Stats) XXX_Size() int {
+	return xxx_messageInfo_Stats.Size(m)
+}
+func (m *Stats) XXX_DiscardUnknown() {
+	xxx_messageInfo_Stats.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_Stats proto.InternalMessageInfo
+
+func (m *Stats) GetState() string {
+	if m != nil {
+		return m.State
+	}
+	return ""
+}
+
+func (m *Stats) GetMemoryBytes() uint64 {
+	if m != nil {
+		return m.MemoryBytes
+	}
+	return 0
+}
+
+func (m *Stats) GetMemoryLimitBytes() uint64 {
+	if m != nil {
+		return m.MemoryLimitBytes
+	}
+	return 0
+}
+
+func (m *Stats) GetCpuAbsolute() float64 {
+	if m != nil {
+		return m.CpuAbsolute
+	}
+	return 0
+}
+
+func (m *Stats) GetDiskBytes() int64 {
+	if m != nil {
+		return m.DiskBytes
+	}
+	return 0
+}
+
+func (m *Stats) GetNetworkRxBytes() uint64 {
+	if m != nil {
+		return m.NetworkRxBytes
+	}
+	return 0
+}
+
+func (m *Stats) GetNetworkTxBytes() uint64 {
+	if m != nil {
+		return m.NetworkTxBytes
+	}
+	return 0
+}
+
+type ListDirectoryRequest struct {
+	Uuid                 string   `protobuf:"bytes,1,opt,name=uuid,proto3" json:"uuid,omitempty"`
+	Directory            string   `protobuf:"bytes,2,opt,name=directory,proto3" json:"directory,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *ListDirectoryRequest) Reset()         { *m = ListDirectoryRequest{} }
+func (m *ListDirectoryRequest) String() string { return proto.CompactTextString(m) }
+func (*ListDirectoryRequest) ProtoMessage()    {}
+func (*ListDirectoryRequest) Descriptor() ([]byte, []int) {
+	return fileDescriptor_dcb6b122875a1d04, []int{8}
+}
+
+func (m *ListDirectoryRequest) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_ListDirectoryRequest.Unmarshal(m, b)
+}
+func (m *ListDirectoryRequest) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_ListDirectoryRequest.Marshal(b, m, deterministic)
+}
+func (m *ListDirectoryRequest) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_ListDirectoryRequest.Merge(m, src)
+}
+func (m *ListDirectoryRequest) XXX_Size() int {
+	return xxx_messageInfo_ListDirectoryRequest.Size(m)
+}
+func (m *ListDirectoryRequest) XXX_DiscardUnknown() {
+	xxx_messageInfo_ListDirectoryRequest.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_ListDirectoryRequest proto.InternalMessageInfo
+
+func (m *ListDirectoryRequest) GetUuid() string {
+	if m != nil {
+		return m.Uuid
+	}
+	return ""
+}
+
+func (m *ListDirectoryRequest) GetDirectory() string {
+	if m != nil {
+		return m.Directory
+	}
+	return ""
+}
+
+type FileInfo struct {
+	Name      string `protobuf:"bytes,1,opt,name=name,proto3" json:"name,omitempty"`
+	Size      int64  `protobuf:"varint,2,opt,name=size,proto3" json:"size,omitempty"`
+	Mode      string `protobuf:"bytes,3,opt,name=mode,proto3" json:"mode,omitempty"`
+	Directory bool   `protobuf:"varint,4,opt,name=directory,proto3" json:"directory,omitempty"`
+	Symlink   bool   `protobuf:"varint,5,opt,name=symlink,proto3" json:"symlink,omitempty"`
+	Mime      string `protobuf:"bytes,6,opt,name=mime,proto3" json:"mime,omitempty"`
+	// The time the file was last modified as a unix timestamp.
+	Modified             int64    `protobuf:"varint,7,opt,name=modified,proto3" json:"modified,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *FileInfo) Reset()         { *m = FileInfo{} }
+func (m *FileInfo) String() string { return proto.CompactTextString(m) }
+func (*FileInfo) ProtoMessage()    {}
+func (*FileInfo) Descriptor() ([]byte, []int) {
+	return fileDescriptor_dcb6b122875a1d04, []int{9}
+}
+
+func (m *FileInfo) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_FileInfo.Unmarshal(m, b)
+}
+func (m *FileInfo) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_FileInfo.Marshal(b, m, deterministic)
+}
+func (m *FileInfo) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_FileInfo.Merge(m, src)
+}
+func (m *FileInfo) XXX_Size() int {
+	return xxx_messageInfo_FileInfo.Size(m)
+}
+func (m *FileInfo) XXX_DiscardUnknown() {
+	xxx_messageInfo_FileInfo.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_FileInfo proto.InternalMessageInfo
+
+func (m *FileInfo) GetName() string {
+	if m != nil {
+		return m.Name
+	}
+	return ""
+}
+
+func (m *FileInfo) GetSize() int64 {
+	if m != nil {
+		return m.Size
+	}
+	return 0
+}
+
+func (m *FileInfo) GetMode() string {
+	if m != nil {
+		return m.Mode
+	}
+	return ""
+}
+
+func (m *FileInfo) GetDirectory() bool {
+	if m != nil {
+		return m.Directory
+	}
+	return false
+}
+
+func (m *FileInfo) GetSymlink() bool {
+	if m != nil {
+		return m.Symlink
+	}
+	return false
+}
+
+func (m *FileInfo) GetMime() string {
+	if m != nil {
+		return m.Mime
+	}
+	return ""
+}
+
+func (m *FileInfo) GetModified() int64 {
+	if m != nil {
+		return m.Modified
+	}
+	return 0
+}
+
+type ListDirectoryResponse struct {
+	Files                []*FileInfo `protobuf:"bytes,1,rep,name=files,proto3" json:"files,omitempty"`
+	XXX_NoUnkeyedLiteral struct{}    `json:"-"`
+	XXX_unrecognized     []byte      `json:"-"`
+	XXX_sizecache        int32       `json:"-"`
+}
+
+func (m *ListDirectoryResponse) Reset()         { *m = ListDirectoryResponse{} }
+func (m *ListDirectoryResponse) String() string { return proto.CompactTextString(m) }
+func (*ListDirectoryResponse) ProtoMessage()    {}
+func (*ListDirectoryResponse) Descriptor() ([]byte, []int) {
+	return fileDescriptor_dcb6b122875a1d04, []int{10}
+}
+
+func (m *ListDirectoryResponse) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_ListDirectoryResponse.Unmarshal(m, b)
+}
+func (m *ListDirectoryResponse) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_ListDirectoryResponse.Marshal(b, m, deterministic)
+}
+func (m *ListDirectoryResponse) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_ListDirectoryResponse.Merge(m, src)
+}
+func (m *ListDirectoryResponse) XXX_Size() int {
+	return xxx_messageInfo_ListDirectoryResponse.Size(m)
+}
+func (m *ListDirectoryResponse) XXX_DiscardUnknown() {
+	xxx_messageInfo_ListDirectoryResponse.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_ListDirectoryResponse proto.InternalMessageInfo
+
+func (m *ListDirectoryResponse) GetFiles() []*FileInfo {
+	if m != nil {
+		return m.Files
+	}
+	return nil
+}
+
+type FileRequest struct {
+	Uuid                 string   `protobuf:"bytes,1,opt,name=uuid,proto3" json:"uuid,omitempty"`
+	Path                 string   `protobuf:"bytes,2,opt,name=path,proto3" json:"path,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *FileRequest) Reset()         { *m = FileRequest{} }
+func (m *FileRequest) String() string { return proto.CompactTextString(m) }
+func (*FileRequest) ProtoMessage()    {}
+func (*FileRequest) Descriptor() ([]byte, []int) {
+	return fileDescriptor_dcb6b122875a1d04, []int{11}
+}
+
+func (m *FileRequest) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_FileRequest.Unmarshal(m, b)
+}
+func (m *FileRequest) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_FileRequest.Marshal(b, m, deterministic)
+}
+func (m *FileRequest) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_FileRequest.Merge(m, src)
+}
+func (m *FileRequest) XXX_Size() int {
+	return xxx_messageInfo_FileRequest.Size(m)
+}
+func (m *FileRequest) XXX_DiscardUnknown() {
+	xxx_messageInfo_FileRequest.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_FileRequest proto.InternalMessageInfo
+
+func (m *FileRequest) GetUuid() string {
+	if m != nil {
+		return m.Uuid
+	}
+	return ""
+}
+
+func (m *FileRequest) GetPath() string {
+	if m != nil {
+		return m.Path
+	}
+	return ""
+}
+
+type FileChunk struct {
+	Data                 []byte   `protobuf:"bytes,1,opt,name=data,proto3" json:"data,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *FileChunk) Reset()         { *m = FileChunk{} }
+func (m *FileChunk) String() string { return proto.CompactTextString(m) }
+func (*FileChunk) ProtoMessage()    {}
+func (*FileChunk) Descriptor() ([]byte, []int) {
+	return fileDescriptor_dcb6b122875a1d04, []int{12}
+}
+
+func (m *FileChunk) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_FileChunk.Unmarshal(m, b)
+}
+func (m *FileChunk) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_FileChunk.Marshal(b, m, deterministic)
+}
+func (m *FileChunk) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_FileChunk.Merge(m, src)
+}
+func (m *FileChunk) XXX_Size() int {
+	return xxx_messageInfo_FileChunk.Size(m)
+}
+func (m *FileChunk) XXX_DiscardUnknown() {
+	xxx_messageInfo_FileChunk.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_FileChunk proto.InternalMessageInfo
+
+func (m *FileChunk) GetData() []byte {
+	if m != nil {
+		return m.Data
+	}
+	return nil
+}
+
+type WriteFileRequest struct {
+	Uuid                 string   `protobuf:"bytes,1,opt,name=uuid,proto3" json:"uuid,omitempty"`
+	Path                 string   `protobuf:"bytes,2,opt,name=path,proto3" json:"path,omitempty"`
+	Content              []byte   `protobuf:"bytes,3,opt,name=content,proto3" json:"content,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *WriteFileRequest) Reset()         { *m = WriteFileRequest{} }
+func (m *WriteFileRequest) String() string { return proto.CompactTextString(m) }
+func (*WriteFileRequest) ProtoMessage()    {}
+func (*WriteFileRequest) Descriptor() ([]byte, []int) {
+	return fileDescriptor_dcb6b122875a1d04, []int{13}
+}
+
+func (m *WriteFileRequest) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_WriteFileRequest.Unmarshal(m, b)
+}
+func (m *WriteFileRequest) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_WriteFileRequest.Marshal(b, m, deterministic)
+}
+func (m *WriteFileRequest) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_WriteFileRequest.Merge(m, src)
+}
+func (m *WriteFileRequest) XXX_Size() int {
+	return xxx_messageInfo_WriteFileRequest.Size(m)
+}
+func (m *WriteFileRequest) XXX_DiscardUnknown() {
+	xxx_messageInfo_WriteFileRequest.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_WriteFileRequest proto.InternalMessageInfo
+
+func (m *WriteFileRequest) GetUuid() string {
+	if m != nil {
+		return m.Uuid
+	}
+	return ""
+}
+
+func (m *WriteFileRequest) GetPath() string {
+	if m != nil {
+		return m.Path
+	}
+	return ""
+}
+
+func (m *WriteFileRequest) GetContent() []byte {
+	if m != nil {
+		return m.Content
+	}
+	return nil
+}
+
+type DeleteFilesRequest struct {
+	Uuid                 string   `protobuf:"bytes,1,opt,name=uuid,proto3" json:"uuid,omitempty"`
+	Paths                []string `protobuf:"bytes,2,rep,name=paths,proto3" json:"paths,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *DeleteFilesRequest) Reset()         { *m = DeleteFilesRequest{} }
+func (m *DeleteFilesRequest) String() string { return proto.CompactTextString(m) }
+func (*DeleteFilesRequest) ProtoMessage()    {}
+func (*DeleteFilesRequest) Descriptor() ([]byte, []int) {
+	return fileDescriptor_dcb6b122875a1d04, []int{14}
+}
+
+func (m *DeleteFilesRequest) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_DeleteFilesRequest.Unmarshal(m, b)
+}
+func (m *DeleteFilesRequest) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_DeleteFilesRequest.Marshal(b, m, deterministic)
+}
+func (m *DeleteFilesRequest) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_DeleteFilesRequest.Merge(m, src)
+}
+func (m *DeleteFilesRequest) XXX_Size() int {
+	return xxx_messageInfo_DeleteFilesRequest.Size(m)
+}
+func (m *DeleteFilesRequest) XXX_DiscardUnknown() {
+	xxx_messageInfo_DeleteFilesRequest.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_DeleteFilesRequest proto.InternalMessageInfo
+
+func (m *DeleteFilesRequest) GetUuid() string {
+	if m != nil {
+		return m.Uuid
+	}
+	return ""
+}
+
+func (m *DeleteFilesRequest) GetPaths() []string {
+	if m != nil {
+		return m.Paths
+	}
+	return nil
+}
+
+func init() {
+	proto.RegisterType((*Empty)(nil), "wings.v1.Empty")
+	proto.RegisterType((*ListServersRequest)(nil), "wings.v1.ListServersRequest")
+	proto.RegisterType((*ListServersResponse)(nil), "wings.v1.ListServersResponse")
+	proto.RegisterType((*ServerRequest)(nil), "wings.v1.ServerRequest")
+	proto.RegisterType((*Server)(nil), "wings.v1.Server")
+	proto.RegisterType((*PowerRequest)(nil), "wings.v1.PowerRequest")
+	proto.RegisterType((*CommandRequest)(nil), "wings.v1.CommandRequest")
+	proto.RegisterType((*Stats)(nil), "wings.v1.Stats")
+	proto.RegisterType((*ListDirectoryRequest)(nil), "wings.v1.ListDirectoryRequest")
+	proto.RegisterType((*FileInfo)(nil), "wings.v1.FileInfo")
+	proto.RegisterType((*ListDirectoryResponse)(nil), "wings.v1.ListDirectoryResponse")
+	proto.RegisterType((*FileRequest)(nil), "wings.v1.FileRequest")
+	proto.RegisterType((*FileChunk)(nil), "wings.v1.FileChunk")
+	proto.RegisterType((*WriteFileRequest)(nil), "wings.v1.WriteFileRequest")
+	proto.RegisterType((*DeleteFilesRequest)(nil), "wings.v1.DeleteFilesRequest")
+}
+
+func init() {
+	proto.RegisterFile("wings.proto", fileDescriptor_dcb6b122875a1d04)
+}
+
+var fileDescriptor_dcb6b122875a1d04 = []byte{
+	// 775 bytes of a gzipped FileDescriptorProto
+	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0x9c, 0x55, 0xcb, 0x6e, 0xeb, 0x36,
+	0x10, 0x85, 0x62, 0xcb, 0xb6, 0x46, 0xbe, 0xb7, 0x06, 0xaf, 0x6f, 0x2a, 0x18, 0x49, 0xe3, 0xa8,
+	0x45, 0x21, 0x14, 0x85, 0xf3, 0x28, 0x5a, 0xa4, 0x0f, 0x14, 0xcd, 0xa3, 0x4f, 0x64, 0x11, 0x30,
+	0x01, 0x02, 0x74, 0x13, 0xc8, 0x12, 0x93, 0x10, 0x91, 0x44, 0x55, 0xa4, 0x92, 0x38, 0xdb, 0xf6,
+	0x7b, 0xba, 0xec, 0xf7, 0x15, 0x22, 0x29, 0x4b, 0xb2, 0x1a, 0x2f, 0xba, 0xe3, 0x9c, 0x39, 0x3c,
+	0x1a, 0x1e, 0x0e, 0x47, 0x60, 0x3f, 0xd1, 0xe4, 0x8e, 0xcf, 0xd2, 0x8c, 0x09, 0x86, 0x06, 0x2a,
+	0x78, 0x3c, 0x70, 0xfb, 0x60, 0xfe, 0x18, 0xa7, 0x62, 0xe1, 0x8e, 0x01, 0x9d, 0x53, 0x2e, 0x2e,
+	0x49, 0xf6, 0x48, 0x32, 0x8e, 0xc9, 0x1f, 0x39, 0xe1, 0xc2, 0x3d, 0x86, 0x77, 0x0d, 0x94, 0xa7,
+	0x2c, 0xe1, 0x04, 0x7d, 0x06, 0x7d, 0xae, 0x20, 0xc7, 0x98, 0x76, 0x3c, 0xfb, 0x70, 0x34, 0x2b,
+	0x15, 0x67, 0x8a, 0x8b, 0x4b, 0x82, 0xfb, 0x31, 0xbc, 0xd1, 0x90, 0xd2, 0x44, 0x08, 0xba, 0x79,
+	0x4e, 0x43, 0xc7, 0x98, 0x1a, 0x9e, 0x85, 0xe5, 0xda, 0xfd, 0xd3, 0x80, 0x9e, 0x62, 0xfd, 0x57,
+	0x1a, 0x8d, 0xc1, 0xe4, 0xc2, 0x17, 0xc4, 0xd9, 0x90, 0xa0, 0x0a, 0xd0, 0x16, 0x58, 0x3c, 0xe7,
+	0x29, 0x49, 0x42, 0x12, 0x3a, 0x9d, 0xa9, 0xe1, 0x0d, 0x70, 0x05, 0xa0, 0x03, 0xb0, 0x73, 0x41,
+	0x23, 0xfa, 0xe2, 0x0b, 0xca, 0x12, 0xa7, 0x3b, 0x35, 0x3c, 0xfb, 0xf0, 0x83, 0x5a, 0x9d, 0xc2,
+	0x17, 0x1c, 0xd7, 0x39, 0xee, 0x37, 0x30, 0xbc, 0x60, 0x4f, 0x6b, 0x2b, 0x45, 0x9b, 0xd0, 0xf3,
+	0x03, 0xa9, 0xa8, 0x6a, 0xd1, 0x91, 0xfb, 0x03, 0xbc, 0x3d, 0x65, 0x71, 0xec, 0x27, 0xe1, 0xba,
+	0xdd, 0x13, 0x18, 0x04, 0x8a, 0xc5, 0x9d, 0x8d, 0x69, 0xc7, 0xb3, 0xf0, 0x32, 0x76, 0xff, 0xda,
+	0x00, 0x53, 0x16, 0x55, 0x1d, 0xd7, 0xa8, 0x1f, 0x77, 0x17, 0x86, 0x31, 0x89, 0x59, 0xb6, 0xb8,
+	0x99, 0x2f, 0x04, 0xe1, 0xf2, 0xfb, 0x5d, 0x6c, 0x2b, 0xec, 0xa4, 0x80, 0xd0, 0xe7, 0x80, 0x34,
+	0x25, 0xa2, 0x31, 0x15, 0x9a, 0xd8, 0x91, 0xc4, 0x91, 0xca, 0x9c, 0x17, 0x09, 0xc5, 0xde, 0x85,
+	0x61, 0x90, 0xe6, 0x37, 0xfe, 0x9c, 0xb3, 0x28, 0x17, 0x44, 0x5a, 0x64, 0x60, 0x3b, 0x48, 0xf3,
+	0x63, 0x0d, 0xa1, 0x6d, 0x80, 0x90, 0xf2, 0x07, 0x2d, 0x64, 0x4e, 0x0d, 0xaf, 0x83, 0xad, 0x02,
+	0x51, 0x0a, 0x1e, 0x8c, 0x12, 0x22, 0x9e, 0x58, 0xf6, 0x70, 0x93, 0x3d, 0x6b, 0x52, 0x4f, 0x7e,
+	0xed, 0xad, 0xc6, 0xf1, 0x73, 0x8b, 0x29, 0x4a, 0x66, 0xbf, 0xc1, 0xbc, 0x52, 0x4c, 0xf7, 0x17,
+	0x18, 0x17, 0x2d, 0x77, 0x46, 0x33, 0x12, 0x08, 0x96, 0x2d, 0xd6, 0xd9, 0xb9, 0x05, 0x56, 0x58,
+	0xf2, 0xf4, 0x7d, 0x54, 0x80, 0xfb, 0xb7, 0x01, 0x83, 0x9f, 0x68, 0x44, 0x7e, 0x4d, 0x6e, 0x59,
+	0xb1, 0x3d, 0xf1, 0xe3, 0xd2, 0x52, 0xb9, 0x2e, 0x30, 0x4e, 0x5f, 0x54, 0x57, 0x75, 0xb0, 0x5c,
+	0x17, 0x58, 0xcc, 0x42, 0x22, 0x4d, 0xb3, 0xb0, 0x5c, 0x37, 0x3f, 0xd3, 0x55, 0x8d, 0xb6, 0x04,
+	0x90, 0x03, 0x7d, 0xbe, 0x88, 0x23, 0x9a, 0x3c, 0x48, 0x83, 0x06, 0xb8, 0x0c, 0xa5, 0x16, 0x8d,
+	0x89, 0xd3, 0xd3, 0x5a, 0x34, 0x26, 0x45, 0x07, 0xc4, 0x2c, 0xa4, 0xb7, 0x94, 0x84, 0xd2, 0x80,
+	0x0e, 0x5e, 0xc6, 0xee, 0x31, 0xbc, 0x5f, 0x39, 0xba, 0x7e, 0x6f, 0x1e, 0x98, 0xb7, 0x34, 0x22,
+	0xe5, 0x6b, 0x43, 0x55, 0x17, 0x97, 0xe7, 0xc3, 0x8a, 0xe0, 0x7e, 0x09, 0x76, 0x01, 0xad, 0x33,
+	0x0d, 0x41, 0x37, 0xf5, 0xc5, 0xbd, 0xf6, 0x4b, 0xae, 0xdd, 0x1d, 0xb0, 0x8a, 0x6d, 0xa7, 0xf7,
+	0xb9, 0x2a, 0x3b, 0xf4, 0x85, 0x2f, 0x37, 0x0d, 0xb1, 0x5c, 0xbb, 0x57, 0x30, 0xba, 0xce, 0xa8,
+	0x20, 0xff, 0x43, 0xbc, 0x30, 0x28, 0x60, 0x89, 0x20, 0x89, 0x90, 0xae, 0x0e, 0x71, 0x19, 0xba,
+	0xdf, 0x03, 0x3a, 0x23, 0x11, 0x51, 0xb2, 0x7c, 0x9d, 0xee, 0x18, 0xcc, 0x42, 0xab, 0x7c, 0x35,
+	0x2a, 0x38, 0xfc, 0xa7, 0x0b, 0xe6, 0x75, 0x61, 0x05, 0xfa, 0x0d, 0xec, 0xda, 0xa0, 0x42, 0x5b,
+	0x95, 0x43, 0xed, 0xa9, 0x36, 0xd9, 0x7e, 0x25, 0xab, 0xdd, 0xfe, 0x0a, 0xac, 0x9f, 0x89, 0x46,
+	0xd1, 0x87, 0xad, 0xc9, 0xa6, 0x45, 0x5a, 0x23, 0x0f, 0xed, 0x83, 0x29, 0xc7, 0x07, 0xda, 0xac,
+	0x52, 0xf5, 0x79, 0x32, 0xa9, 0x4d, 0x1f, 0x39, 0x74, 0xd1, 0x11, 0xd8, 0x97, 0x24, 0x09, 0xf5,
+	0xe0, 0x40, 0x4e, 0x95, 0x6f, 0xce, 0x92, 0xf6, 0xce, 0xaf, 0xc1, 0xbe, 0x14, 0x19, 0xf1, 0x63,
+	0x35, 0x31, 0x5e, 0xad, 0x72, 0x75, 0xe0, 0xed, 0x1b, 0xe8, 0x02, 0xde, 0x34, 0xba, 0x0c, 0x7d,
+	0xd4, 0xb4, 0x63, 0xf5, 0xe5, 0x4d, 0x76, 0x5e, 0xcd, 0x6b, 0xc3, 0x8e, 0x60, 0x80, 0x89, 0x1f,
+	0x16, 0x97, 0x88, 0xde, 0x37, 0x7b, 0xb3, 0xd4, 0x78, 0xd7, 0x84, 0x65, 0xa3, 0xed, 0x1b, 0xe8,
+	0x08, 0xac, 0x65, 0x5b, 0xa1, 0x49, 0xc5, 0x59, 0xed, 0xb5, 0xb6, 0x01, 0xdf, 0x81, 0x5d, 0x6b,
+	0x9d, 0xfa, 0x85, 0xb7, 0x3b, 0xaa, 0xb5, 0xfb, 0xe4, 0xd3, 0xdf, 0x3f, 0xb9, 0xa3, 0xe2, 0x3e,
+	0x9f, 0xcf, 0x02, 0x16, 0xef, 0xa5, 0x82, 0x64, 0x2c, 0xf4, 0x03, 0xb1, 0x88, 0xf6, 0x24, 0x71,
+	0x2f, 0x4b, 0x83, 0x6f, 0xb3, 0x34, 0x98, 0xf7, 0xe4, 0xff, 0xf2, 0x8b, 0x7f, 0x07, 0x00, 0x39,
+	0x03, 0x16, 0xc9, 0x3e, 0x07, 0x00, 0x00,
+}
+
+// Reference imports to suppress errors if they are not otherwise used.
+var _ context.Context
+var _ grpc.ClientConnInterface
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+const _ = grpc.SupportPackageIsVersion6
+
+// WingsClient is the client API for Wings service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://godoc.org/google.golang.org/grpc#ClientConn.NewStream.
+type WingsClient interface {
+	// Returns every server on the node.
+	ListServers(ctx context.Context, in *ListServersRequest, opts ...grpc.CallOption) (*ListServersResponse, error)
+	// Returns a single server.
+	GetServer(ctx context.Context, in *ServerRequest, opts ...grpc.CallOption) (*Server, error)
+	// Starts, stops, restarts, or kills a server. The action is carried out in the
+	// background and this returns as soon as it has begun.
+	Power(ctx context.Context, in *PowerRequest, opts ...grpc.CallOption) (*Empty, error)
+	// Sends commands to the console of a running server.
+	SendCommand(ctx context.Context, in *CommandRequest, opts ...grpc.CallOption) (*Empty, error)
+	// Streams the resource usage of a server each time it is collected.
+	StreamStats(ctx context.Context, in *ServerRequest, opts ...grpc.CallOption) (Wings_StreamStatsClient, error)
+	// Returns the contents of a directory.
+	ListDirectory(ctx context.Context, in *ListDirectoryRequest, opts ...grpc.CallOption) (*ListDirectoryResponse, error)
+	// Streams the contents of a file in chunks.
+	ReadFile(ctx context.Context, in *FileRequest, opts ...grpc.CallOption) (Wings_ReadFileClient, error)
+	// Writes the contents of a file, replacing it if it exists.
+	WriteFile(ctx context.Context, in *WriteFileRequest, opts ...grpc.CallOption) (*Empty, error)
+	// Deletes files and directories.
+	DeleteFiles(ctx context.Context, in *DeleteFilesRequest, opts ...grpc.CallOption) (*Empty, error)
+}
+
+type wingsClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewWingsClient(cc grpc.ClientConnInterface) WingsClient {
+	return &wingsClient{cc}
+}
+
+func (c *wingsClient) ListServers(ctx context.Context, in *ListServersRequest, opts ...grpc.CallOption) (*ListServersResponse, error) {
+	out := new(ListServersResponse)
+	err := c.cc.Invoke(ctx, "/wings.v1.Wings/ListServers", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *wingsClient) GetServer(ctx context.Context, in *ServerRequest, opts ...grpc.CallOption) (*Server, error) {
+	out := new(Server)
+	err := c.cc.Invoke(ctx, "/wings.v1.Wings/GetServer", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *wingsClient) Power(ctx context.Context, in *PowerRequest, opts ...grpc.CallOption) (*Empty, error) {
+	out := new(Empty)
+	err := c.cc.Invoke(ctx, "/wings.v1.Wings/Power", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *wingsClient) SendCommand(ctx context.Context, in *CommandRequest, opts ...grpc.CallOption) (*Empty, error) {
+	out := new(Empty)
+	err := c.cc.Invoke(ctx, "/wings.v1.Wings/SendCommand", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *wingsClient) StreamStats(ctx context.Context, in *ServerRequest, opts ...grpc.CallOption) (Wings_StreamStatsClient, error) {
+	stream, err := c.cc.NewStream(ctx, &_Wings_serviceDesc.Streams[0], "/wings.v1.Wings/StreamStats", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &wingsStreamStatsClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type Wings_StreamStatsClient interface {
+	Recv() (*Stats, error)
+	grpc.ClientStream
+}
+
+type wingsStreamStatsClient struct {
+	grpc.ClientStream
+}
+
+func (x *wingsStreamStatsClient) Recv() (*Stats, error) {
+	m := new(Stats)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (c *wingsClient) ListDirectory(ctx context.Context, in *ListDirectoryRequest, opts ...grpc.CallOption) (*ListDirectoryResponse, error) {
+	out := new(ListDirectoryResponse)
+	err := c.cc.Invoke(ctx, "/wings.v1.Wings/ListDirectory", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *wingsClient) ReadFile(ctx context.Context, in *FileRequest, opts ...grpc.CallOption) (Wings_ReadFileClient, error) {
+	stream, err := c.cc.NewStream(ctx, &_Wings_serviceDesc.Streams[1], "/wings.v1.Wings/ReadFile", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &wingsReadFileClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type Wings_ReadFileClient interface {
+	Recv() (*FileChunk, error)
+	grpc.ClientStream
+}
+
+type wingsReadFileClient struct {
+	grpc.ClientStream
+}
+
+func (x *wingsReadFileClient) Recv() (*FileChunk, error) {
+	m := new(FileChunk)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (c *wingsClient) WriteFile(ctx context.Context, in *WriteFileRequest, opts ...grpc.CallOption) (*Empty, error) {
+	out := new(Empty)
+	err := c.cc.Invoke(ctx, "/wings.v1.Wings/WriteFile", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *wingsClient) DeleteFiles(ctx context.Context, in *DeleteFilesRequest, opts ...grpc.CallOption) (*Empty, error) {
+	out := new(Empty)
+	err := c.cc.Invoke(ctx, "/wings.v1.Wings/DeleteFiles", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// WingsServer is the server API for Wings service.
+type WingsServer interface {
+	// Returns every server on the node.
+	ListServers(context.Context, *ListServersRequest) (*ListServersResponse, error)
+	// Returns a single server.
+	GetServer(context.Context, *ServerRequest) (*Server, error)
+	// Starts, stops, restarts, or kills a server. The action is carried out in the
+	// background and this returns as soon as it has begun.
+	Power(context.Context, *PowerRequest) (*Empty, error)
+	// Sends commands to the console of a running server.
+	SendCommand(context.Context, *CommandRequest) (*Empty, error)
+	// Streams the resource usage of a server each time it is collected.
+	StreamStats(*ServerRequest, Wings_StreamStatsServer) error
+	// Returns the contents of a directory.
+	ListDirectory(context.Context, *ListDirectoryRequest) (*ListDirectoryResponse, error)
+	// Streams the contents of a file in chunks.
+	ReadFile(*FileRequest, Wings_ReadFileServer) error
+	// Writes the contents of a file, replacing it if it exists.
+	WriteFile(context.Context, *WriteFileRequest) (*Empty, error)
+	// Deletes files and directories.
+	DeleteFiles(context.Context, *DeleteFilesRequest) (*Empty, error)
+}
+
+// UnimplementedWingsServer can be embedded to have forward compatible implementations.
+type UnimplementedWingsServer struct {
+}
+
+func (*UnimplementedWingsServer) ListServers(ctx context.Context, req *ListServersRequest) (*ListServersResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListServers not implemented")
+}
+func (*UnimplementedWingsServer) GetServer(ctx context.Context, req *ServerRequest) (*Server, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetServer not implemented")
+}
+func (*UnimplementedWingsServer) Power(ctx context.Context, req *PowerRequest) (*Empty, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Power not implemented")
+}
+func (*UnimplementedWingsServer) SendCommand(ctx context.Context, req *CommandRequest) (*Empty, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method SendCommand not implemented")
+}
+func (*UnimplementedWingsServer) StreamStats(req *ServerRequest, srv Wings_StreamStatsServer) error {
+	return status.Errorf(codes.Unimplemented, "method StreamStats not implemented")
+}
+func (*UnimplementedWingsServer) ListDirectory(ctx context.Context, req *ListDirectoryRequest) (*ListDirectoryResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListDirectory not implemented")
+}
+func (*UnimplementedWingsServer) ReadFile(req *FileRequest, srv Wings_ReadFileServer) error {
+	return status.Errorf(codes.Unimplemented, "method ReadFile not implemented")
+}
+func (*UnimplementedWingsServer) WriteFile(ctx context.Context, req *WriteFileRequest) (*Empty, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method WriteFile not implemented")
+}
+func (*UnimplementedWingsServer) DeleteFiles(ctx context.Context, req *DeleteFilesRequest) (*Empty, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method DeleteFiles not implemented")
+}
+
+func RegisterWingsServer(s *grpc.Server, srv WingsServer) {
+	s.RegisterService(&_Wings_serviceDesc, srv)
+}
+
+func _Wings_ListServers_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListServersRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(WingsServer).ListServers(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/wings.v1.Wings/ListServers",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(WingsServer).ListServers(ctx, req.(*ListServersRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Wings_GetServer_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ServerRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(WingsServer).GetServer(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/wings.v1.Wings/GetServer",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(WingsServer).GetServer(ctx, req.(*ServerRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Wings_Power_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(PowerRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(WingsServer).Power(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/wings.v1.Wings/Power",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(WingsServer).Power(ctx, req.(*PowerRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Wings_SendCommand_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(CommandRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(WingsServer).SendCommand(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/wings.v1.Wings/SendCommand",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(WingsServer).SendCommand(ctx, req.(*CommandRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Wings_StreamStats_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(ServerRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(WingsServer).StreamStats(m, &wingsStreamStatsServer{stream})
+}
+
+type Wings_StreamStatsServer interface {
+	Send(*Stats) error
+	grpc.ServerStream
+}
+
+type wingsStreamStatsServer struct {
+	grpc.ServerStream
+}
+
+func (x *wingsStreamStatsServer) Send(m *Stats) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func _Wings_ListDirectory_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListDirectoryRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(WingsServer).ListDirectory(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/wings.v1.Wings/ListDirectory",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(WingsServer).ListDirectory(ctx, req.(*ListDirectoryRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Wings_ReadFile_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(FileRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(WingsServer).ReadFile(m, &wingsReadFileServer{stream})
+}
+
+type Wings_ReadFileServer interface {
+	Send(*FileChunk) error
+	grpc.ServerStream
+}
+
+type wingsReadFileServer struct {
+	grpc.ServerStream
+}
+
+func (x *wingsReadFileServer) Send(m *FileChunk) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func _Wings_WriteFile_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(WriteFileRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(WingsServer).WriteFile(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/wings.v1.Wings/WriteFile",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(WingsServer).WriteFile(ctx, req.(*WriteFileRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Wings_DeleteFiles_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(DeleteFilesRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(WingsServer).DeleteFiles(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/wings.v1.Wings/DeleteFiles",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(WingsServer).DeleteFiles(ctx, req.(*DeleteFilesRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+var _Wings_serviceDesc = grpc.ServiceDesc{
+	ServiceName: "wings.v1.Wings",
+	HandlerType: (*WingsServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "ListServers",
+			Handler:    _Wings_ListServers_Handler,
+		},
+		{
+			MethodName: "GetServer",
+			Handler:    _Wings_GetServer_Handler,
+		},
+		{
+			MethodName: "Power",
+			Handler:    _Wings_Power_Handler,
+		},
+		{
+			MethodName: "SendCommand",
+			Handler:    _Wings_SendCommand_Handler,
+		},
+		{
+			MethodName: "ListDirectory",
+			Handler:    _Wings_ListDirectory_Handler,
+		},
+		{
+			MethodName: "WriteFile",
+			Handler:    _Wings_WriteFile_Handler,
+		},
+		{
+			MethodName: "DeleteFiles",
+			Handler:    _Wings_DeleteFiles_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "StreamStats",
+			Handler:       _Wings_StreamStats_Handler,
+			ServerStreams: true,
+		},
+		{
+			StreamName:    "ReadFile",
+			Handler:       _Wings_ReadFile_Handler,
+			ServerStreams: true,
+		},
+	},
+	Metadata: "wings.proto",
+}
@@ -0,0 +1,94 @@
+package server
+
+import (
+	"net"
+	"strconv"
+	"strings"
+)
+
+// Returns an allocation IP in its bare form. IPv6 addresses may be provided wrapped in
+// brackets, which need to be removed before they can be parsed or passed to Docker.
+func normalizeAllocationIp(ip string) string {
+	return strings.TrimSuffix(strings.TrimPrefix(ip, "["), "]")
+}
+
+// Determines if the given allocation IP is an IPv6 address.
+func isIpv6Allocation(ip string) bool {
+	parsed := net.ParseIP(normalizeAllocationIp(ip))
+
+	return parsed != nil && parsed.To4() == nil
+}
+
+// Returns the default allocation in host:port form, wrapping IPv6 addresses in brackets
+// so that the result can be used anywhere a network address is expected.
+func (a *Allocations) DefaultAddress() string {
+	return net.JoinHostPort(normalizeAllocationIp(a.DefaultMapping.Ip), strconv.Itoa(a.DefaultMapping.Port))
+}
+
+// Determines if two allocation IPs overlap. An allocation bound to the unspecified
+// address listens on every interface, so it overlaps with every other IP.
+func allocationIpsOverlap(a string, b string) bool {
+	if a == b {
+		return true
+	}
+
+	ipa, ipb := net.ParseIP(normalizeAllocationIp(a)), net.ParseIP(normalizeAllocationIp(b))
+	if ipa == nil || ipb == nil {
+		return false
+	}
+
+	return ipa.IsUnspecified() || ipb.IsUnspecified() || ipa.Equal(ipb)
+}
+
+// Checks the given allocation mappings against every other server on this node and
+// returns an error if any of the IP and port combinations are already assigned.
+func CheckAllocationConflicts(uuid string, mappings map[string][]int) error {
+	for _, s := range GetServers().All() {
+		if s.Uuid == uuid {
+			continue
+		}
+
+		for ip, ports := range mappings {
+			for eip, eports := range s.Allocations.Mappings {
+				if !allocationIpsOverlap(ip, eip) {
+					continue
+				}
+
+				for _, port := range ports {
+					for _, eport := range eports {
+						if port == eport {
+							return &allocationConflict{ip: ip, port: port, server: s.Uuid}
+						}
+					}
+				}
+			}
+		}
+	}
+
+	return nil
+}
+
+// Verifies that every port assigned to the server is free on the host for both TCP and
+// UDP. This should be called right before the server process is started so that a clear
+// error is returned rather than an obscure failure from the environment.
+func (s *Server) EnsureAllocationsAvailable() error {
+	for ip, ports := range s.Allocations.Mappings {
+		for _, port := range ports {
+			addr := net.JoinHostPort(normalizeAllocationIp(ip), strconv.Itoa(port))
+
+			l, err := net.Listen("tcp", addr)
+			if err != nil {
+				return &allocationConflict{ip: ip, port: port}
+			}
+			l.Close()
+
+			pc, err := net.ListenPacket("udp", addr)
+			if err != nil {
+				return &allocationConflict{ip: ip, port: port}
+			}
+			pc.Close()
+		}
+	}
+
+	return nil
+}
@@ -3,10 +3,8 @@ package server
 import (
 	"crypto/sha256"
 	"encoding/hex"
-	"github.com/mholt/archiver/v3"
 	"github.com/pterodactyl/wings/config"
 	"io"
-	"io/ioutil"
 	"os"
 	"path/filepath"
 )
@@ -40,21 +38,9 @@ func (a *Archiver) Stat() (*Stat, error) {
 	return a.Server.Filesystem.unsafeStat(a.ArchivePath())
 }
 
-// Archive creates an archive of the server and deletes the previous one.
-func (a *Archiver) Archive() error {
-	path := a.Server.Filesystem.Path()
-
-	// Get the list of root files and directories to archive.
-	var files []string
-	fileInfo, err := ioutil.ReadDir(path)
-	if err != nil {
-		return err
-	}
-
-	for _, file := range fileInfo {
-		files = append(files, filepath.Join(path, file.Name()))
-	}
-
+// Archive creates an archive of the server for a transfer and deletes the previous one. The
+// archive is removed again if the transfer is cancelled while it is being created.
+func (a *Archiver) Archive(t *Transfer) error {
 	stat, err := a.Stat()
 	if err != nil && !os.IsNotExist(err) {
 		return err
@@ -67,7 +53,20 @@ func (a *Archiver) Archive() error {
 		}
 	}
 
-	return archiver.NewTarGz().Archive(files, a.ArchivePath())
+	f, err := os.OpenFile(a.ArchivePath(), os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	if err := a.Server.Filesystem.WriteArchive(t.Context(), t.ArchiveWriter(f), CompressionGzip, 0, "", nil); err != nil {
+		f.Close()
+		os.Remove(a.ArchivePath())
+
+		return err
+	}
+
+	return f.Close()
 }
 
 // DeleteIfExists deletes the archive if it exists.
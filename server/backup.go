@@ -1,18 +1,22 @@
 package server
 
 import (
+	"context"
 	"crypto/sha256"
 	"encoding/hex"
-	"github.com/mholt/archiver/v3"
 	"github.com/pkg/errors"
 	"github.com/pterodactyl/wings/api"
 	"github.com/pterodactyl/wings/config"
+	"github.com/pterodactyl/wings/encryption"
 	"go.uber.org/zap"
 	"io"
+	"io/ioutil"
 	"os"
-	"path"
+	"path/filepath"
+	"sort"
 	"strings"
 	"sync"
+	"time"
 )
 
 type Backup struct {
@@ -20,6 +24,9 @@ type Backup struct {
 	IgnoredFiles   []string `json:"ignored_files"`
 	server         *Server
 	localDirectory string
+	compression    string
+	level          int
+	key            []byte
 }
 
 // Create a new Backup struct from data passed through in a request.
@@ -28,16 +35,50 @@ func (s *Server) NewBackup(uuid string, ignore []string) *Backup {
 		Uuid:           uuid,
 		IgnoredFiles:   ignore,
 		server:         s,
-		localDirectory: path.Join(config.Get().System.BackupDirectory, s.Uuid),
+		localDirectory: filepath.Join(config.Get().System.BackupDirectory, s.Uuid),
+		compression:    config.Get().System.Backups.Compression,
+		level:          config.Get().System.Backups.Level,
 	}
 }
 
+// The extensions of every archive format a backup can be stored as. Backups created before
+// the compression or encryption was changed keep their original format, so all of them are
+// checked when looking for a backup.
+var backupExtensions = []string{
+	ArchiveExtension(CompressionGzip),
+	ArchiveExtension(CompressionZstd),
+	ArchiveExtension(CompressionNone),
+	ArchiveExtension(CompressionGzip) + encryptedExtension,
+	ArchiveExtension(CompressionZstd) + encryptedExtension,
+	ArchiveExtension(CompressionNone) + encryptedExtension,
+}
+
+// Returns the uuid of the backup stored in the given file, or false if the file is not a
+// backup archive.
+func backupUuidFromName(name string) (string, bool) {
+	for _, ext := range backupExtensions {
+		if strings.HasSuffix(name, ext) {
+			return strings.TrimSuffix(name, ext), true
+		}
+	}
+
+	return "", false
+}
+
 // Locates the backup for a server and returns the local path. This will obviously only
 // work if the backup was created as a local backup.
 func (s *Server) LocateBackup(uuid string) (string, os.FileInfo, error) {
-	p := path.Join(config.Get().System.BackupDirectory, s.Uuid, uuid+".tar.gz")
+	var p string
+	var st os.FileInfo
+	var err error
+	for _, ext := range backupExtensions {
+		p = filepath.Join(config.Get().System.BackupDirectory, s.Uuid, uuid+ext)
+
+		if st, err = os.Stat(p); err == nil || !os.IsNotExist(err) {
+			break
+		}
+	}
 
-	st, err := os.Stat(p)
 	if err != nil {
 		return "", nil, err
 	}
@@ -49,6 +90,58 @@ func (s *Server) LocateBackup(uuid string) (string, os.FileInfo, error) {
 	return p, st, nil
 }
 
+// Describes a backup stored on the local disk for a server.
+type LocalBackup struct {
+	Uuid      string    `json:"uuid"`
+	Size      int64     `json:"size"`
+	CreatedAt time.Time `json:"created_at"`
+	// The fingerprint of the key the backup was encrypted with, if it is encrypted.
+	KeyFingerprint string `json:"key_fingerprint,omitempty"`
+}
+
+// Returns the backups stored on the local disk for a server, ordered from the oldest to the
+// newest backup.
+func (s *Server) LocalBackups() ([]LocalBackup, error) {
+	files, err := ioutil.ReadDir(filepath.Join(config.Get().System.BackupDirectory, s.Uuid))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return []LocalBackup{}, nil
+		}
+
+		return nil, errors.WithStack(err)
+	}
+
+	backups := make([]LocalBackup, 0, len(files))
+	for _, f := range files {
+		if f.IsDir() {
+			continue
+		}
+
+		uuid, ok := backupUuidFromName(f.Name())
+		if !ok {
+			continue
+		}
+
+		b := LocalBackup{
+			Uuid:      uuid,
+			Size:      f.Size(),
+			CreatedAt: f.ModTime(),
+		}
+
+		if strings.HasSuffix(f.Name(), encryptedExtension) {
+			b.KeyFingerprint = readBackupFingerprint(filepath.Join(config.Get().System.BackupDirectory, s.Uuid, f.Name()))
+		}
+
+		backups = append(backups, b)
+	}
+
+	sort.SliceStable(backups, func(i, j int) bool {
+		return backups[i].CreatedAt.Before(backups[j].CreatedAt)
+	})
+
+	return backups, nil
+}
+
 // Ensures that the local backup destination for files exists.
 func (b *Backup) ensureLocalBackupLocation() error {
 	if _, err := os.Stat(b.localDirectory); err != nil {
@@ -64,7 +157,12 @@ func (b *Backup) ensureLocalBackupLocation() error {
 
 // Returns the path for this specific backup.
 func (b *Backup) GetPath() string {
-	return path.Join(b.localDirectory, b.Uuid+".tar.gz")
+	p := filepath.Join(b.localDirectory, b.Uuid+ArchiveExtension(b.compression))
+	if b.key != nil {
+		p += encryptedExtension
+	}
+
+	return p
 }
 
 func (b *Backup) GetChecksum() ([]byte, error) {
@@ -86,25 +184,18 @@ func (b *Backup) GetChecksum() ([]byte, error) {
 // Generates a backup of the selected files and pushes it to the defined location
 // for this instance.
 func (b *Backup) Backup() (*api.BackupRequest, error) {
-	rootPath := b.server.Filesystem.Path()
-
 	if err := b.ensureLocalBackupLocation(); err != nil {
 		return nil, errors.WithStack(err)
 	}
 
-	zap.S().Debugw("starting archive of server files for backup", zap.String("server", b.server.Uuid), zap.String("backup", b.Uuid))
-	if err := archiver.Archive([]string{rootPath}, b.GetPath()); err != nil {
-		if strings.HasPrefix(err.Error(), "file already exists") {
-			zap.S().Debugw("backup already exists on system, removing and re-attempting", zap.String("backup", b.Uuid))
-
-			if rerr := os.Remove(b.GetPath()); rerr != nil {
-				return nil, errors.WithStack(rerr)
-			}
-
-			// Re-attempt this backup.
-			return b.Backup()
-		}
+	key, err := b.server.backupEncryptionKey()
+	if err != nil {
+		return nil, err
+	}
+	b.key = key
 
+	zap.S().Debugw("starting archive of server files for backup", zap.String("server", b.server.Uuid), zap.String("backup", b.Uuid), zap.String("compression", b.compression))
+	if err := b.writeArchive(); err != nil {
 		// If there was some error with the archive, just go ahead and ensure the backup
 		// is completely destroyed at this point. Ignore any errors from this function.
 		os.Remove(b.GetPath())
@@ -142,11 +233,47 @@ func (b *Backup) Backup() (*api.BackupRequest, error) {
 
 	wg.Wait()
 
-	return &api.BackupRequest{
+	r := &api.BackupRequest{
 		Successful: true,
 		Sha256Hash: checksum,
 		FileSize:   s,
-	}, nil
+	}
+
+	if b.key != nil {
+		r.KeyFingerprint = encryption.Fingerprint(b.key)
+	}
+
+	return r, nil
+}
+
+// Writes the archive of the server files to the path of the backup, replacing any existing
+// archive for the backup. Files are placed in a directory named after the server within the
+// archive. The archive is encrypted as it is written if the backup has a key.
+func (b *Backup) writeArchive() error {
+	f, err := os.OpenFile(b.GetPath(), os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	defer f.Close()
+
+	var w io.WriteCloser = f
+	if b.key != nil {
+		if w, err = encryption.NewWriter(f, b.key); err != nil {
+			return err
+		}
+	}
+
+	if err := b.server.Filesystem.WriteArchive(context.Background(), w, b.compression, b.level, b.server.Uuid, nil); err != nil {
+		return err
+	}
+
+	if b.key != nil {
+		if err := w.Close(); err != nil {
+			return err
+		}
+	}
+
+	return errors.WithStack(f.Close())
 }
 
 // Performs a server backup and then notifies the Panel of the completed status
@@ -172,11 +299,18 @@ func (b *Backup) BackupAndNotify() error {
 
 	// Emit an event over the socket so we can update the backup in realtime on
 	// the frontend for the server.
-	b.server.Events().PublishJson(BackupCompletedEvent+":"+b.Uuid, map[string]interface{}{
+	data := map[string]interface{}{
 		"uuid":        b.Uuid,
 		"sha256_hash": resp.Sha256Hash,
 		"file_size":   resp.FileSize,
-	})
+	}
+
+	if resp.KeyFingerprint != "" {
+		data["key_fingerprint"] = resp.KeyFingerprint
+	}
+
+	b.server.Events().PublishJson(BackupCompletedEvent+":"+b.Uuid, data)
+	PublishNodeEvent(BackupCompletedEvent, b.server.Uuid, data)
 
 	return nil
 }
@@ -0,0 +1,50 @@
+package server
+
+import (
+	"github.com/pkg/errors"
+	"github.com/pterodactyl/wings/config"
+	"github.com/pterodactyl/wings/encryption"
+	"os"
+)
+
+// The extension added to the name of backup archives that have been encrypted.
+const encryptedExtension = ".enc"
+
+// Returns the key that backups of the server are encrypted with, or nil if backups of the
+// server are not encrypted. A key set for the server takes priority over the node key.
+func (s *Server) backupEncryptionKey() ([]byte, error) {
+	if s.BackupEncryptionKey != "" {
+		key, err := encryption.ParseKey(s.BackupEncryptionKey)
+		if err != nil {
+			return nil, errors.Wrap(err, "invalid backup encryption key for server")
+		}
+
+		return key, nil
+	}
+
+	c := config.Get().System.Backups.Encryption
+	if !c.Enabled {
+		return nil, nil
+	}
+
+	key, err := encryption.ReadKeyFile(c.KeyFile)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read backup encryption key")
+	}
+
+	return key, nil
+}
+
+// Returns the fingerprint of the key an encrypted backup was created with, or an empty
+// string if it cannot be read.
+func readBackupFingerprint(p string) string {
+	f, err := os.Open(p)
+	if err != nil {
+		return ""
+	}
+	defer f.Close()
+
+	fp, _ := encryption.ReadFingerprint(f)
+
+	return fp
+}
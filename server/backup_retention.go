@@ -0,0 +1,135 @@
+package server
+
+import (
+	"fmt"
+	"github.com/pkg/errors"
+	"github.com/pterodactyl/wings/store"
+	"go.uber.org/zap"
+	"os"
+	"sort"
+)
+
+// Defines which of the backups created by schedules are kept for a server, every other
+// scheduled backup is removed after a new one is created. A backup is kept if it matches
+// any of the rules. If no rules are set every backup is kept. Backups created through the
+// Panel are never removed.
+type BackupRetention struct {
+	// The number of most recent backups to keep.
+	KeepLast int `json:"keep_last" yaml:"keep_last"`
+
+	// The number of days to keep the most recent backup of, counting only the days on
+	// which a backup was created.
+	KeepDaily int `json:"keep_daily" yaml:"keep_daily"`
+
+	// The number of weeks to keep the most recent backup of, counting only the weeks in
+	// which a backup was created.
+	KeepWeekly int `json:"keep_weekly" yaml:"keep_weekly"`
+}
+
+// Determines if any retention rules have been set.
+func (r *BackupRetention) enabled() bool {
+	return r.KeepLast > 0 || r.KeepDaily > 0 || r.KeepWeekly > 0
+}
+
+// Returns the backups that are not kept by any of the retention rules.
+func (r *BackupRetention) expired(backups []LocalBackup) []LocalBackup {
+	sorted := make([]LocalBackup, len(backups))
+	copy(sorted, backups)
+
+	// Work from the newest backup to the oldest so that the most recent backup within each
+	// day or week is the one that is kept.
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].CreatedAt.After(sorted[j].CreatedAt)
+	})
+
+	days := make(map[string]bool)
+	weeks := make(map[string]bool)
+
+	var out []LocalBackup
+	for i, b := range sorted {
+		keep := i < r.KeepLast
+
+		t := b.CreatedAt.Local()
+		if day := t.Format("2006-01-02"); !days[day] && len(days) < r.KeepDaily {
+			days[day] = true
+			keep = true
+		}
+
+		y, w := t.ISOWeek()
+		if week := fmt.Sprintf("%d-%d", y, w); !weeks[week] && len(weeks) < r.KeepWeekly {
+			weeks[week] = true
+			keep = true
+		}
+
+		if !keep {
+			out = append(out, b)
+		}
+	}
+
+	return out
+}
+
+var scheduledBackups = store.NewRepository(store.ScheduledBackups)
+
+// Records that a backup was created by a schedule for the server.
+func (s *Server) recordScheduledBackup(uuid string) error {
+	var ids []string
+	if _, err := scheduledBackups.Get(s.Uuid, &ids); err != nil {
+		return err
+	}
+
+	return scheduledBackups.Put(s.Uuid, append(ids, uuid))
+}
+
+// Removes the backups created by schedules for the server that are not kept by its
+// retention rules. Backups that have already been removed from the disk are forgotten.
+func (s *Server) PruneScheduledBackups() error {
+	var ids []string
+	if found, err := scheduledBackups.Get(s.Uuid, &ids); err != nil || !found {
+		return err
+	}
+
+	local, err := s.LocalBackups()
+	if err != nil {
+		return err
+	}
+
+	scheduled := make(map[string]bool, len(ids))
+	for _, id := range ids {
+		scheduled[id] = true
+	}
+
+	var backups []LocalBackup
+	for _, b := range local {
+		if scheduled[b.Uuid] {
+			backups = append(backups, b)
+		}
+	}
+
+	removed := make(map[string]bool)
+	if s.BackupRetention.enabled() {
+		for _, b := range s.BackupRetention.expired(backups) {
+			p, _, err := s.LocateBackup(b.Uuid)
+			if err != nil {
+				return err
+			}
+
+			if err := os.Remove(p); err != nil && !os.IsNotExist(err) {
+				return errors.WithStack(err)
+			}
+
+			zap.S().Debugw("removed scheduled backup by retention policy", zap.String("server", s.Uuid), zap.String("backup", b.Uuid))
+
+			removed[b.Uuid] = true
+		}
+	}
+
+	remaining := make([]string, 0, len(backups))
+	for _, b := range backups {
+		if !removed[b.Uuid] {
+			remaining = append(remaining, b.Uuid)
+		}
+	}
+
+	return scheduledBackups.Put(s.Uuid, remaining)
+}
@@ -0,0 +1,30 @@
+package server
+
+import (
+	"context"
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+)
+
+// Applies the bandwidth limits for the server to the network interface of its running
+// container. Limits of zero remove any shaping that was previously applied.
+func (d *DockerEnvironment) applyBandwidthLimits() error {
+	c, err := d.Client.ContainerInspect(context.Background(), d.Server.Uuid)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	if c.State == nil || !c.State.Running || c.State.Pid == 0 {
+		return nil
+	}
+
+	return shapeContainerInterface(c.State.Pid, d.Server.Build.BandwidthEgress, d.Server.Build.BandwidthIngress)
+}
+
+// Applies the bandwidth limits after the container has been started. A failure here is
+// logged rather than preventing the server from running.
+func (d *DockerEnvironment) applyBandwidthLimitsOnStart() {
+	if err := d.applyBandwidthLimits(); err != nil {
+		zap.S().Warnw("failed to apply bandwidth limits to server container", zap.String("server", d.Server.Uuid), zap.Error(err))
+	}
+}
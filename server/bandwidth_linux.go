@@ -0,0 +1,92 @@
+package server
+
+import (
+	"fmt"
+	"github.com/pkg/errors"
+	"io/ioutil"
+	"net"
+	"os/exec"
+	"strconv"
+	"strings"
+)
+
+// Shapes the traffic of a container using tc on the host side of its veth pair. Traffic
+// sent by the container arrives on the ingress of the host interface where it is policed,
+// and traffic sent to the container leaves through the egress of the host interface where
+// it is limited by a HTB class. Limits are in megabits per second.
+func shapeContainerInterface(pid int, egress int64, ingress int64) error {
+	veth, err := hostInterfaceForContainer(pid)
+	if err != nil {
+		return err
+	}
+
+	// Remove the existing shaping first so that the limits are always replaced. These fail
+	// when nothing has been applied yet, which is fine.
+	exec.Command("tc", "qdisc", "del", "dev", veth, "root").Run()
+	exec.Command("tc", "qdisc", "del", "dev", veth, "ingress").Run()
+
+	if ingress > 0 {
+		rate := fmt.Sprintf("%dmbit", ingress)
+
+		if err := tc("qdisc", "add", "dev", veth, "root", "handle", "1:", "htb", "default", "10"); err != nil {
+			return err
+		}
+
+		if err := tc("class", "add", "dev", veth, "parent", "1:", "classid", "1:10", "htb", "rate", rate, "ceil", rate); err != nil {
+			return err
+		}
+	}
+
+	if egress > 0 {
+		// Allow bursts of roughly 10ms of traffic at the limited rate, with a lower bound so
+		// that very low limits do not drop every full sized packet.
+		burst := egress * 1000000 / 8 / 100
+		if burst < 32*1024 {
+			burst = 32 * 1024
+		}
+
+		if err := tc("qdisc", "add", "dev", veth, "handle", "ffff:", "ingress"); err != nil {
+			return err
+		}
+
+		err := tc(
+			"filter", "add", "dev", veth, "parent", "ffff:", "protocol", "all", "u32", "match", "u32", "0", "0",
+			"police", "rate", fmt.Sprintf("%dmbit", egress), "burst", strconv.FormatInt(burst, 10), "drop", "flowid", ":1",
+		)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Returns the name of the host interface that is paired with the eth0 interface inside of
+// the network namespace of the process.
+func hostInterfaceForContainer(pid int) (string, error) {
+	b, err := ioutil.ReadFile(fmt.Sprintf("/proc/%d/root/sys/class/net/eth0/iflink", pid))
+	if err != nil {
+		return "", errors.Wrap(err, "could not find the network interface of the container")
+	}
+
+	idx, err := strconv.Atoi(strings.TrimSpace(string(b)))
+	if err != nil {
+		return "", errors.WithStack(err)
+	}
+
+	i, err := net.InterfaceByIndex(idx)
+	if err != nil {
+		return "", errors.WithStack(err)
+	}
+
+	return i.Name, nil
+}
+
+func tc(args ...string) error {
+	out, err := exec.Command("tc", args...).CombinedOutput()
+	if err != nil {
+		return errors.Errorf("tc %s: %s", strings.Join(args, " "), strings.TrimSpace(string(out)))
+	}
+
+	return nil
+}
@@ -0,0 +1,121 @@
+package server
+
+import (
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+)
+
+// The build settings that can be changed for a server. Any setting that is not provided is
+// left as it is.
+type BuildUpdate struct {
+	MemoryLimit *int64  `json:"memory_limit"`
+	Swap        *int64  `json:"swap"`
+	IoWeight    *uint16 `json:"io_weight"`
+	CpuLimit    *int64  `json:"cpu_limit"`
+	DiskSpace   *int64  `json:"disk_space"`
+	Threads     *string `json:"threads"`
+
+	BandwidthEgress  *int64 `json:"bandwidth_egress"`
+	BandwidthIngress *int64 `json:"bandwidth_ingress"`
+}
+
+// Checks that the values being set are within the ranges accepted by the environment.
+func (u *BuildUpdate) Validate() error {
+	if u.MemoryLimit != nil && *u.MemoryLimit < 0 {
+		return errors.New("the memory limit cannot be negative")
+	}
+
+	// A swap value of -1 allows unlimited swap.
+	if u.Swap != nil && *u.Swap < -1 {
+		return errors.New("the swap limit cannot be less than -1")
+	}
+
+	if u.IoWeight != nil && (*u.IoWeight < 10 || *u.IoWeight > 1000) {
+		return errors.New("the io weight must be between 10 and 1000")
+	}
+
+	if u.CpuLimit != nil && *u.CpuLimit < 0 {
+		return errors.New("the cpu limit cannot be negative")
+	}
+
+	if u.DiskSpace != nil && *u.DiskSpace < 0 {
+		return errors.New("the disk space limit cannot be negative")
+	}
+
+	if (u.BandwidthEgress != nil && *u.BandwidthEgress < 0) || (u.BandwidthIngress != nil && *u.BandwidthIngress < 0) {
+		return errors.New("the bandwidth limits cannot be negative")
+	}
+
+	return nil
+}
+
+// Changes the build settings for the server and applies them to the running environment
+// if possible. Returns true if the new limits are already in effect, otherwise they apply
+// the next time the server is started and the server is marked as requiring a rebuild.
+func (s *Server) UpdateBuild(u BuildUpdate) (bool, error) {
+	if err := u.Validate(); err != nil {
+		return false, err
+	}
+
+	memory, disk := s.Build.MemoryLimit, s.Build.DiskSpace
+	if u.MemoryLimit != nil {
+		memory = *u.MemoryLimit
+	}
+	if u.DiskSpace != nil {
+		disk = *u.DiskSpace
+	}
+
+	if err := ReserveCapacity(s.Uuid, memory, disk); err != nil {
+		return false, err
+	}
+	defer ReleaseCapacity(s.Uuid)
+
+	s.Lock()
+	if u.MemoryLimit != nil {
+		s.Build.MemoryLimit = *u.MemoryLimit
+	}
+	if u.Swap != nil {
+		s.Build.Swap = *u.Swap
+	}
+	if u.IoWeight != nil {
+		s.Build.IoWeight = *u.IoWeight
+	}
+	if u.CpuLimit != nil {
+		s.Build.CpuLimit = *u.CpuLimit
+	}
+	if u.DiskSpace != nil {
+		s.Build.DiskSpace = *u.DiskSpace
+	}
+	if u.Threads != nil {
+		s.Build.Threads = *u.Threads
+	}
+	if u.BandwidthEgress != nil {
+		s.Build.BandwidthEgress = *u.BandwidthEgress
+	}
+	if u.BandwidthIngress != nil {
+		s.Build.BandwidthIngress = *u.BandwidthIngress
+	}
+	s.Unlock()
+
+	if err := s.persistConfiguration(); err != nil {
+		zap.S().Warnw("failed to persist server configuration to disk", zap.String("server", s.Uuid), zap.Error(err))
+	}
+
+	// The disk limit is enforced by the daemon itself, so it always applies immediately,
+	// the remaining limits only need to be applied if the server is currently running.
+	if s.GetState() == ProcessOfflineState {
+		return true, nil
+	}
+
+	if err := s.Environment.InSituUpdate(); err != nil {
+		zap.S().Warnw("failed to apply updated build settings to running server", zap.String("server", s.Uuid), zap.Error(err))
+
+		s.Lock()
+		s.rebuildRequired = true
+		s.Unlock()
+
+		return false, nil
+	}
+
+	return true, nil
+}
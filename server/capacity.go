@@ -0,0 +1,169 @@
+package server
+
+import (
+	"fmt"
+	"github.com/pterodactyl/wings/config"
+	"github.com/pterodactyl/wings/system"
+	"go.uber.org/zap"
+	"sync"
+)
+
+// Returned when a server would be allocated more memory or disk space than the node has
+// left, which is sent back to the Panel so it can show what the node is short of.
+type CapacityError struct {
+	// Either "memory" or "disk".
+	Resource string `json:"resource"`
+
+	// The amount allocated to every server on the node, including the change being made,
+	// and the amount that can be allocated in total. Both are in megabytes.
+	Allocated int64 `json:"allocated"`
+	Capacity  int64 `json:"capacity"`
+}
+
+func (e *CapacityError) Error() string {
+	return fmt.Sprintf("allocating %d MB of %s would exceed the %d MB available on this node", e.Allocated, e.Resource, e.Capacity)
+}
+
+func IsCapacityError(err error) bool {
+	_, ok := err.(*CapacityError)
+
+	return ok
+}
+
+// Memory and disk space, in megabytes, that has been checked for a server but not yet
+// given to it. Reservations are counted as allocated so that requests made at the same
+// time cannot each be given the last of the capacity of the node.
+type capacityReservation struct {
+	memory int64
+	disk   int64
+}
+
+// Guards checking the capacity of the node along with the reservations made once it has
+// been checked, so that the check and the reservation happen as one.
+var capacityMu sync.Mutex
+var capacityReservations = make(map[string]capacityReservation)
+
+// Checks that giving the server the amount of memory and disk space provided, in megabytes,
+// does not allocate more than the node has, and reserves it for the server until
+// ReleaseCapacity is called once the change has been made. Only increases are checked, so
+// a server can always be lowered or left as it is, even if the node is already over its
+// capacity.
+//
+// A limit of 0 means the server is not limited and can use everything the node has, so it
+// is counted as the entire physical capacity of the node. This means that in refuse mode a
+// server can only be left unlimited if the overcommit ratio leaves room for the others.
+func ReserveCapacity(uuid string, memory int64, disk int64) error {
+	cfg := config.Get().System.Capacity
+	if cfg.Mode == config.CapacityModeOff {
+		return nil
+	}
+
+	capacityMu.Lock()
+	defer capacityMu.Unlock()
+
+	err := checkCapacity(uuid, memory, disk, cfg)
+	if err != nil {
+		if cfg.Mode == config.CapacityModeRefuse {
+			return err
+		}
+
+		zap.S().Warnw("server is being allocated more than the capacity of the node", zap.String("server", uuid), zap.String("resource", err.Resource), zap.Int64("allocated", err.Allocated), zap.Int64("capacity", err.Capacity))
+	}
+
+	capacityReservations[uuid] = capacityReservation{memory: memory, disk: disk}
+
+	return nil
+}
+
+// Releases the capacity reserved for the server, which should be done once the server
+// has been given it, or if the change was abandoned.
+func ReleaseCapacity(uuid string) {
+	capacityMu.Lock()
+	defer capacityMu.Unlock()
+
+	delete(capacityReservations, uuid)
+}
+
+func checkCapacity(uuid string, memory int64, disk int64, cfg config.CapacityConfiguration) *CapacityError {
+	var physicalMemory, physicalDisk int64
+	if b, err := system.TotalMemory(); err != nil {
+		zap.S().Warnw("failed to determine memory capacity of node", zap.Error(err))
+	} else {
+		physicalMemory = int64(b / 1000000)
+	}
+
+	if b, err := system.DiskCapacity(config.Get().System.Data); err != nil {
+		zap.S().Warnw("failed to determine disk capacity of node", zap.Error(err))
+	} else {
+		physicalDisk = int64(b / 1000000)
+	}
+
+	// Returns the amount of a resource allocated to a server, counting unlimited servers
+	// as having the entire node.
+	allocated := func(limit int64, physical int64) int64 {
+		if limit == 0 {
+			return physical
+		}
+
+		return limit
+	}
+
+	allocations := make(map[string]capacityReservation)
+	for _, s := range GetServers().All() {
+		s.RLock()
+		allocations[s.Uuid] = capacityReservation{memory: s.Build.MemoryLimit, disk: s.Build.DiskSpace}
+		s.RUnlock()
+	}
+
+	var currentMemory, currentDisk, totalMemory, totalDisk int64
+	for u, a := range allocations {
+		m, d := allocated(a.memory, physicalMemory), allocated(a.disk, physicalDisk)
+
+		// A server that has capacity reserved for it is counted as having whichever is
+		// larger, since the reservation may be for an increase that has not been made yet.
+		if r, ok := capacityReservations[u]; ok && u != uuid {
+			if rm := allocated(r.memory, physicalMemory); rm > m {
+				m = rm
+			}
+			if rd := allocated(r.disk, physicalDisk); rd > d {
+				d = rd
+			}
+		}
+
+		if u == uuid {
+			currentMemory, currentDisk = m, d
+			continue
+		}
+
+		totalMemory += m
+		totalDisk += d
+	}
+
+	// Servers that are still being created are not in the collection yet.
+	for u, r := range capacityReservations {
+		if _, ok := allocations[u]; ok || u == uuid {
+			continue
+		}
+
+		totalMemory += allocated(r.memory, physicalMemory)
+		totalDisk += allocated(r.disk, physicalDisk)
+	}
+
+	if physicalMemory > 0 {
+		if m := allocated(memory, physicalMemory); m > currentMemory {
+			if c := int64(float64(physicalMemory) * cfg.MemoryOvercommit); totalMemory+m > c {
+				return &CapacityError{Resource: "memory", Allocated: totalMemory + m, Capacity: c}
+			}
+		}
+	}
+
+	if physicalDisk > 0 {
+		if d := allocated(disk, physicalDisk); d > currentDisk {
+			if c := int64(float64(physicalDisk) * cfg.DiskOvercommit); totalDisk+d > c {
+				return &CapacityError{Resource: "disk", Allocated: totalDisk + d, Capacity: c}
+			}
+		}
+	}
+
+	return nil
+}
@@ -22,11 +22,14 @@ func (c *Collection) All() []*Server {
 	return c.items
 }
 
-// Adds an item to the collection store.
+// Adds an item to the collection store. Any capacity reserved for the server while it was
+// being created is released, since the server itself is now counted instead.
 func (c *Collection) Add(s *Server) {
 	c.Lock()
 	c.items = append(c.items, s)
 	c.Unlock()
+
+	ReleaseCapacity(s.Uuid)
 }
 
 // Returns only those items matching the filter criteria.
@@ -0,0 +1,101 @@
+package server
+
+import (
+	"go.uber.org/zap"
+	"regexp"
+	"strings"
+)
+
+// Regular expressions matching commands that cannot be sent to the server process through the
+// API, websocket, or RCON proxy. Commands run by schedules are not checked, since those are
+// configured by the Panel rather than sent by a user.
+type DeniedCommands struct {
+	// The patterns defined by the egg the server was created from.
+	Egg []string `json:"egg" yaml:"egg"`
+
+	// The patterns defined for this server specifically.
+	Server []string `json:"server" yaml:"server"`
+}
+
+// The places a command can be sent to the server from, recorded when a command is denied.
+const (
+	CommandSourceApi       = "api"
+	CommandSourceWebsocket = "websocket"
+	CommandSourceRcon      = "rcon"
+	CommandSourceGrpc      = "grpc"
+	CommandSourceMacro     = "macro"
+)
+
+// A denied command pattern that has been compiled.
+type deniedPattern struct {
+	pattern string
+	r       *regexp.Regexp
+}
+
+// Compiles all of the patterns. Patterns that are not valid regular expressions are logged
+// and ignored.
+func (d *DeniedCommands) compile() []deniedPattern {
+	var patterns []deniedPattern
+	for _, p := range append(append([]string{}, d.Egg...), d.Server...) {
+		r, err := regexp.Compile(p)
+		if err != nil {
+			zap.S().Warnw("ignoring invalid denied command pattern", zap.String("pattern", p), zap.Error(err))
+			continue
+		}
+
+		patterns = append(patterns, deniedPattern{pattern: p, r: r})
+	}
+
+	return patterns
+}
+
+// Returns the first pattern that matches the command, or an empty string if the command is
+// allowed. The server process receives every line of the command separately, so each line
+// is checked on its own.
+func matchDeniedCommand(patterns []deniedPattern, command string) string {
+	lines := strings.FieldsFunc(command, func(r rune) bool {
+		return r == '\r' || r == '\n'
+	})
+
+	for _, line := range lines {
+		line = strings.TrimSpace(line)
+
+		for _, p := range patterns {
+			if p.r.MatchString(line) {
+				return p.pattern
+			}
+		}
+	}
+
+	return ""
+}
+
+// Checks that the command is allowed to be sent to the server, returning an error if it
+// is not. Denied commands are logged and published to the node event bus so that attempts
+// to use them can be audited.
+func (s *Server) CheckCommand(command string, source string) error {
+	s.RLock()
+	patterns := s.deniedCommands
+	s.RUnlock()
+
+	p := matchDeniedCommand(patterns, command)
+	if p == "" {
+		return nil
+	}
+
+	zap.S().Warnw(
+		"denied command sent to server",
+		zap.String("server", s.Uuid),
+		zap.String("command", command),
+		zap.String("pattern", p),
+		zap.String("source", source),
+	)
+
+	PublishNodeEvent(CommandDeniedEvent, s.Uuid, map[string]string{
+		"command": command,
+		"pattern": p,
+		"source":  source,
+	})
+
+	return &commandDenied{command: command}
+}
@@ -1,9 +1,12 @@
 package server
 
 import (
+	"bufio"
+	"bytes"
 	"fmt"
 	"github.com/mitchellh/colorstring"
 	"io"
+	"os"
 )
 
 type Console struct {
@@ -32,3 +35,46 @@ func (s *Server) PublishConsoleOutputFromDaemon(data string) {
 		colorstring.Color(fmt.Sprintf("[yellow][bold][Pterodactyl Daemon]:[default] %s", data)),
 	)
 }
+
+// Sends output to the installation output of the server, formatted so that it can be told
+// apart from the output of the installation script itself.
+func (s *Server) PublishInstallOutputFromDaemon(data string) {
+	s.Events().Publish(
+		InstallOutputEvent,
+		colorstring.Color(fmt.Sprintf("[cyan][bold][Pterodactyl Installer]:[default] %s", data)),
+	)
+}
+
+// Reads the last len bytes of a plain-text console log file and returns the lines
+// contained within. This is used by environments that write the server output to a
+// log file themselves rather than relying on Docker to do it.
+func readLogLines(p string, len int64) ([]string, error) {
+	f, err := os.Open(p)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	if st, err := f.Stat(); err != nil {
+		return nil, err
+	} else if st.Size() < len {
+		len = st.Size()
+	}
+
+	if _, err := f.Seek(-len, io.SeekEnd); err != nil {
+		return nil, err
+	}
+
+	b := make([]byte, len)
+	if _, err := f.Read(b); err != nil && err != io.EOF {
+		return nil, err
+	}
+
+	var out []string
+	s := bufio.NewScanner(bytes.NewReader(b))
+	for s.Scan() {
+		out = append(out, s.Text())
+	}
+
+	return out, nil
+}
@@ -8,13 +8,71 @@ import (
 	"time"
 )
 
+// The policies that determine when a server that stopped unexpectedly is restarted.
+const (
+	// Restarts the server whenever it stops without being asked to, even if it exited cleanly.
+	RestartAlways = "always"
+	// Restarts the server only if it was detected as having crashed.
+	RestartOnCrash = "on-crash"
+	// Never restarts the server, crashes are only reported.
+	RestartNever = "never"
+)
+
 type CrashDetection struct {
 	// If set to false, the system will not listen for crash detection events that
 	// can indicate that the server stopped unexpectedly.
 	Enabled bool `default:"true" json:"enabled" yaml:"enabled"`
 
+	// Determines when the server is restarted after it stops unexpectedly, one of "always",
+	// "on-crash" or "never".
+	RestartPolicy string `default:"on-crash" json:"restart_policy" yaml:"restart_policy"`
+
+	// The number of times in a row the server is restarted after crashing before it is left
+	// offline. A value of 0 means there is no limit.
+	MaxAttempts int `default:"1" json:"max_attempts" yaml:"max_attempts"`
+
+	// The number of seconds that must pass since the last crash before the count of restart
+	// attempts is reset.
+	ResetAfter int `default:"60" json:"reset_after" yaml:"reset_after"`
+
+	// The number of seconds to wait before restarting the server, which is doubled for every
+	// attempt made in a row up to the maximum backoff.
+	Backoff    int `default:"0" json:"backoff" yaml:"backoff"`
+	MaxBackoff int `default:"300" json:"max_backoff" yaml:"max_backoff"`
+
 	// Tracks the time of the last server crash event.
 	lastCrash time.Time
+	// The number of restarts attempted since the count was last reset.
+	attempts int
+}
+
+// Returns the restart policy for the server, falling back to restarting on a crash if the
+// policy is not one that is recognized.
+func (cd *CrashDetection) restartPolicy() string {
+	switch cd.RestartPolicy {
+	case RestartAlways, RestartNever:
+		return cd.RestartPolicy
+	}
+
+	return RestartOnCrash
+}
+
+// Returns the amount of time to wait before making the next restart attempt.
+func (cd *CrashDetection) backoff() time.Duration {
+	if cd.Backoff <= 0 {
+		return 0
+	}
+
+	d := time.Duration(cd.Backoff) * time.Second
+	max := time.Duration(cd.MaxBackoff) * time.Second
+	for i := 0; i < cd.attempts; i++ {
+		d *= 2
+		if max > 0 && d >= max {
+			return max
+		}
+	}
+
+	return d
 }
 
 // Looks at the environment exit state to determine if the process exited cleanly or
@@ -25,21 +83,14 @@ type CrashDetection struct {
 // look at the exit state and check if it meets the criteria of being called a crash
 // by Wings.
 //
-// If the server is determined to have crashed, the process will be restarted and the
-// counter for the server will be incremented.
+// If the server is determined to have crashed, the process is restarted according to the
+// restart policy of the server, and the counter of restart attempts is incremented.
 //
 // @todo output event to server console
 func (s *Server) handleServerCrash() error {
 	// No point in doing anything here if the server isn't currently offline, there
-	// is no reason to do a crash detection event. If the server crash detection is
-	// disabled we want to skip anything after this as well.
-	if s.GetState() != ProcessOfflineState || !s.CrashDetection.Enabled {
-		if !s.CrashDetection.Enabled {
-			zap.S().Debugw("server triggered crash detection but handler is disabled for server process", zap.String("server", s.Uuid))
-
-			s.PublishConsoleOutputFromDaemon("Server detected as crashed; crash detection is disabled for this instance.")
-		}
-
+	// is no reason to do a crash detection event.
+	if s.GetState() != ProcessOfflineState {
 		return nil
 	}
 
@@ -48,28 +99,114 @@ func (s *Server) handleServerCrash() error {
 		return errors.WithStack(err)
 	}
 
+	// Actions defined for specific exit codes are run even if crash detection is disabled,
+	// since the process exiting with that code is expected.
+	if handled, err := s.handleExitCode(exitCode); handled {
+		return err
+	}
+
+	// If the server crash detection is disabled we want to skip anything after this.
+	if !s.CrashDetection.Enabled {
+		zap.S().Debugw("server triggered crash detection but handler is disabled for server process", zap.String("server", s.Uuid))
+
+		s.PublishConsoleOutputFromDaemon("Server detected as crashed; crash detection is disabled for this instance.")
+
+		return nil
+	}
+
+	policy := s.CrashDetection.restartPolicy()
+
 	// If the system is not configured to detect a clean exit code as a crash, and the
-	// crash is not the result of the program running out of memory, do nothing.
+	// crash is not the result of the program running out of memory, do nothing unless the
+	// server should be restarted whenever it stops.
 	if exitCode == 0 && !oomKilled && !config.Get().System.DetectCleanExitAsCrash {
-		zap.S().Debugw("server exited with successful code; system configured to not detect as crash", zap.String("server", s.Uuid))
+		if policy != RestartAlways {
+			zap.S().Debugw("server exited with successful code; system configured to not detect as crash", zap.String("server", s.Uuid))
 
-		return nil
+			return nil
+		}
+
+		s.PublishConsoleOutputFromDaemon("Server process exited; restarting as configured.")
+
+		return s.restartAfterCrash()
 	}
 
+	PublishNodeEvent(CrashEvent, s.Uuid, map[string]interface{}{
+		"exit_code":  exitCode,
+		"oom_killed": oomKilled,
+	})
+
 	s.PublishConsoleOutputFromDaemon("---------- Detected server process in a crashed state! ----------")
 	s.PublishConsoleOutputFromDaemon(fmt.Sprintf("Exit code: %d", exitCode))
 	s.PublishConsoleOutputFromDaemon(fmt.Sprintf("Out of memory: %t", oomKilled))
 
-	c := s.CrashDetection.lastCrash
-	// If the last crash time was within the last 60 seconds we do not want to perform
-	// an automatic reboot of the process. Return an error that can be handled.
-	if !c.IsZero() && c.Add(time.Second * 60).After(time.Now()) {
-		s.PublishConsoleOutputFromDaemon("Aborting automatic reboot: last crash occurred less than 60 seconds ago.")
+	if err := s.RunHooks(PostCrashHook); err != nil {
+		zap.S().Warnw("failed to run post-crash hooks for server", zap.String("server", s.Uuid), zap.Error(err))
+	}
+
+	if policy == RestartNever {
+		s.PublishConsoleOutputFromDaemon("Not restarting server: the restart policy for this server is set to never.")
+
+		return nil
+	}
+
+	return s.restartAfterCrash()
+}
+
+// Restarts the server after it stopped unexpectedly, unless it has already been restarted
+// too many times in a row. Returns an error that can be handled if it is not restarted.
+func (s *Server) restartAfterCrash() error {
+	cd := &s.CrashDetection
+
+	// Once enough time has passed since the last crash the server is considered to have
+	// recovered, and the count of attempts starts over.
+	c := cd.lastCrash
+	if c.IsZero() || c.Add(time.Second*time.Duration(cd.ResetAfter)).Before(time.Now()) {
+		cd.attempts = 0
+	}
+
+	cd.lastCrash = time.Now()
+
+	if cd.MaxAttempts > 0 && cd.attempts >= cd.MaxAttempts {
+		s.PublishConsoleOutputFromDaemon(fmt.Sprintf("Aborting automatic reboot: server has crashed %d times in a row.", cd.attempts+1))
 
 		return &crashTooFrequent{}
 	}
 
-	s.CrashDetection.lastCrash = time.Now()
+	d := cd.backoff()
+	if d > 0 {
+		s.PublishConsoleOutputFromDaemon(fmt.Sprintf("Restarting server in %s.", d))
+	}
+
+	cd.attempts++
+
+	s.scheduleRestart(d)
+
+	return nil
+}
+
+// Starts the server again once the delay has passed. The start is queued in the same way
+// as any other power action so that it runs after the operations already queued for the
+// server, and it is skipped if the server is no longer offline by the time it runs.
+func (s *Server) scheduleRestart(d time.Duration) {
+	start := func() {
+		err := s.QueueOperation(OperationPower, func() error {
+			if s.GetState() != ProcessOfflineState {
+				return nil
+			}
+
+			return getPowerQueue().submit(s, PowerAction{Action: "start"})
+		})
+
+		if err != nil {
+			zap.S().Errorw("failed to queue restart of server", zap.String("server", s.Uuid), zap.Error(err))
+		}
+	}
+
+	if d <= 0 {
+		start()
+		return
+	}
 
-	return s.Environment.Start()
-}
\ No newline at end of file
+	time.AfterFunc(d, start)
+}
@@ -0,0 +1,148 @@
+package server
+
+import (
+	"fmt"
+	"github.com/pkg/errors"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// A parsed standard five field cron expression in the format of
+// "minute hour day-of-month month day-of-week". Each field is stored as a set of the
+// values that it matches.
+type cronExpression struct {
+	minutes  map[int]bool
+	hours    map[int]bool
+	days     map[int]bool
+	months   map[int]bool
+	weekdays map[int]bool
+
+	// Tracks if the day fields were restricted. When both are restricted a time only
+	// needs to match one of them, which mirrors the behavior of the traditional cron. As
+	// with the traditional cron, a field starting with a wildcard such as "*/2" is not
+	// treated as restricted.
+	anyDay     bool
+	anyWeekday bool
+}
+
+var cronMacros = map[string]string{
+	"@yearly":   "0 0 1 1 *",
+	"@annually": "0 0 1 1 *",
+	"@monthly":  "0 0 1 * *",
+	"@weekly":   "0 0 * * 0",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@hourly":   "0 * * * *",
+}
+
+// Parses a cron expression. Fields support wildcards, ranges, steps, and comma
+// separated lists, as well as the common "@daily" style macros.
+func parseCronExpression(expr string) (*cronExpression, error) {
+	expr = strings.TrimSpace(expr)
+	if m, ok := cronMacros[strings.ToLower(expr)]; ok {
+		expr = m
+	}
+
+	fields := strings.Fields(expr)
+	if len(fields) != 5 {
+		return nil, errors.New(fmt.Sprintf("cron expression \"%s\" must contain exactly 5 fields", expr))
+	}
+
+	var err error
+	c := &cronExpression{
+		anyDay:     strings.HasPrefix(fields[2], "*"),
+		anyWeekday: strings.HasPrefix(fields[4], "*"),
+	}
+
+	if c.minutes, err = parseCronField(fields[0], 0, 59); err != nil {
+		return nil, err
+	}
+
+	if c.hours, err = parseCronField(fields[1], 0, 23); err != nil {
+		return nil, err
+	}
+
+	if c.days, err = parseCronField(fields[2], 1, 31); err != nil {
+		return nil, err
+	}
+
+	if c.months, err = parseCronField(fields[3], 1, 12); err != nil {
+		return nil, err
+	}
+
+	if c.weekdays, err = parseCronField(fields[4], 0, 7); err != nil {
+		return nil, err
+	}
+
+	// Both 0 and 7 represent Sunday.
+	if c.weekdays[7] {
+		c.weekdays[0] = true
+	}
+
+	return c, nil
+}
+
+// Parses a single field of a cron expression into the set of values it matches.
+func parseCronField(field string, min int, max int) (map[int]bool, error) {
+	out := make(map[int]bool)
+
+	for _, part := range strings.Split(field, ",") {
+		step := 1
+		if i := strings.Index(part, "/"); i >= 0 {
+			s, err := strconv.Atoi(part[i+1:])
+			if err != nil || s <= 0 {
+				return nil, errors.New(fmt.Sprintf("invalid step in cron field \"%s\"", field))
+			}
+
+			step = s
+			part = part[:i]
+		}
+
+		start, end := min, max
+		if part != "*" {
+			bounds := strings.SplitN(part, "-", 2)
+
+			v, err := strconv.Atoi(bounds[0])
+			if err != nil {
+				return nil, errors.New(fmt.Sprintf("invalid value in cron field \"%s\"", field))
+			}
+			start, end = v, v
+
+			if len(bounds) == 2 {
+				if end, err = strconv.Atoi(bounds[1]); err != nil {
+					return nil, errors.New(fmt.Sprintf("invalid range in cron field \"%s\"", field))
+				}
+			} else if step > 1 {
+				// A value with a step such as "5/15" runs from that value to the maximum.
+				end = max
+			}
+		}
+
+		if start < min || end > max || start > end {
+			return nil, errors.New(fmt.Sprintf("cron field \"%s\" is out of the range %d-%d", field, min, max))
+		}
+
+		for i := start; i <= end; i += step {
+			out[i] = true
+		}
+	}
+
+	return out, nil
+}
+
+// Determines if the expression matches the given time, at minute precision.
+func (c *cronExpression) Matches(t time.Time) bool {
+	if !c.minutes[t.Minute()] || !c.hours[t.Hour()] || !c.months[int(t.Month())] {
+		return false
+	}
+
+	day := c.days[t.Day()]
+	weekday := c.weekdays[int(t.Weekday())]
+
+	if !c.anyDay && !c.anyWeekday {
+		return day || weekday
+	}
+
+	return day && weekday
+}
@@ -0,0 +1,58 @@
+package server
+
+import (
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+	"strings"
+	"unicode/utf8"
+)
+
+// The details of a server that can be changed. Any detail that is not provided is left
+// as it is.
+type DetailsUpdate struct {
+	Name        *string `json:"name"`
+	Description *string `json:"description"`
+}
+
+// Checks that the details being set are within the limits used by the Panel.
+func (u *DetailsUpdate) Validate() error {
+	if u.Name != nil {
+		if strings.TrimSpace(*u.Name) == "" {
+			return errors.New("the name cannot be empty")
+		}
+
+		if utf8.RuneCountInString(*u.Name) > 191 {
+			return errors.New("the name cannot be longer than 191 characters")
+		}
+	}
+
+	if u.Description != nil && utf8.RuneCountInString(*u.Description) > 65535 {
+		return errors.New("the description cannot be longer than 65535 characters")
+	}
+
+	return nil
+}
+
+// Changes the details of the server, such as when it is renamed in the Panel. The labels
+// of the container are updated the next time it is created, which happens whenever the
+// server is started.
+func (s *Server) UpdateDetails(u DetailsUpdate) error {
+	if err := u.Validate(); err != nil {
+		return err
+	}
+
+	s.Lock()
+	if u.Name != nil {
+		s.Meta.Name = strings.TrimSpace(*u.Name)
+	}
+	if u.Description != nil {
+		s.Meta.Description = *u.Description
+	}
+	s.Unlock()
+
+	if err := s.persistConfiguration(); err != nil {
+		zap.S().Warnw("failed to persist server configuration to disk", zap.String("server", s.Uuid), zap.Error(err))
+	}
+
+	return nil
+}
@@ -0,0 +1,129 @@
+package server
+
+import (
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/go-units"
+	"github.com/pterodactyl/wings/config"
+	"go.uber.org/zap"
+	"strings"
+)
+
+// Options passed through to the Docker container of a server for games that need more from
+// the host than a container normally has, such as a VPN needing /dev/net/tun. These are set
+// by administrators of the Panel, and each one is only applied if it is allowed by the
+// configuration of the node.
+type DockerOverrides struct {
+	// The Linux capabilities added to the container, such as "net_admin".
+	Capabilities []string `json:"capabilities" yaml:"capabilities"`
+
+	// Resource limits set on the container process.
+	Ulimits []DockerUlimit `json:"ulimits" yaml:"ulimits"`
+
+	// Devices on the host passed through to the container, either as a single path or in
+	// the form "host:container[:permissions]".
+	Devices []string `json:"devices" yaml:"devices"`
+
+	// The size of /dev/shm in megabytes. When this is 0 the default used by Docker is kept.
+	ShmSize int64 `json:"shm_size" yaml:"shm_size"`
+
+	// Security options set on the container, such as "apparmor=unconfined".
+	SecurityOpts []string `json:"security_opts" yaml:"security_opts"`
+}
+
+// A resource limit set on the process of a container.
+type DockerUlimit struct {
+	Name string `json:"name" yaml:"name"`
+	Soft int64  `json:"soft" yaml:"soft"`
+	Hard int64  `json:"hard" yaml:"hard"`
+}
+
+// Returns the name of a capability in the form used by the daemon, which is lowercase and
+// does not include the "CAP_" prefix.
+func normalizeCapability(c string) string {
+	return strings.TrimPrefix(strings.ToLower(strings.TrimSpace(c)), "cap_")
+}
+
+func allowedOverride(allowed []string, v string, normalize func(string) string) bool {
+	for _, a := range allowed {
+		if normalize(a) == normalize(v) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Applies the overrides of the server that are allowed by the configuration of the node to
+// the configuration of its container. Overrides that are not allowed are skipped with a
+// warning rather than stopping the server from starting.
+func (s *Server) applyDockerOverrides(hostConf *container.HostConfig) {
+	o := s.DockerOverrides
+	cfg := config.Get().Docker.Overrides
+
+	skip := func(kind string, value string) {
+		zap.S().Warnw("docker override for server is not allowed by the node, skipping", zap.String("server", s.Uuid), zap.String("type", kind), zap.String("value", value))
+	}
+
+	for _, c := range o.Capabilities {
+		if !allowedOverride(cfg.Capabilities, c, normalizeCapability) {
+			skip("capability", c)
+			continue
+		}
+
+		// Capabilities dropped by default need to be removed from that list as well, since
+		// Docker applies the capabilities that are dropped after those that are added.
+		c = normalizeCapability(c)
+		for i, d := range hostConf.CapDrop {
+			if d == c {
+				hostConf.CapDrop = append(hostConf.CapDrop[:i], hostConf.CapDrop[i+1:]...)
+				break
+			}
+		}
+
+		hostConf.CapAdd = append(hostConf.CapAdd, c)
+	}
+
+	for _, u := range o.Ulimits {
+		if !allowedOverride(cfg.Ulimits, u.Name, strings.ToLower) {
+			skip("ulimit", u.Name)
+			continue
+		}
+
+		hostConf.Ulimits = append(hostConf.Ulimits, &units.Ulimit{Name: strings.ToLower(u.Name), Soft: u.Soft, Hard: u.Hard})
+	}
+
+	for _, d := range o.Devices {
+		parts := strings.Split(d, ":")
+		if len(parts) > 3 || !allowedOverride(cfg.Devices, parts[0], strings.TrimSpace) {
+			skip("device", d)
+			continue
+		}
+
+		m := container.DeviceMapping{PathOnHost: parts[0], PathInContainer: parts[0], CgroupPermissions: "rwm"}
+		if len(parts) > 1 && parts[1] != "" {
+			m.PathInContainer = parts[1]
+		}
+		if len(parts) > 2 && parts[2] != "" {
+			m.CgroupPermissions = parts[2]
+		}
+
+		hostConf.Devices = append(hostConf.Devices, m)
+	}
+
+	if o.ShmSize > 0 {
+		if o.ShmSize > cfg.MaxShmSize {
+			zap.S().Warnw("docker override for server is larger than the node allows, skipping", zap.String("server", s.Uuid), zap.String("type", "shm_size"), zap.Int64("value", o.ShmSize), zap.Int64("max", cfg.MaxShmSize))
+		} else {
+			hostConf.ShmSize = o.ShmSize * 1000000
+		}
+	}
+
+	for _, opt := range o.SecurityOpts {
+		if !allowedOverride(cfg.SecurityOpts, opt, strings.TrimSpace) {
+			skip("security_opt", opt)
+			continue
+		}
+
+		hostConf.SecurityOpt = append(hostConf.SecurityOpt, strings.TrimSpace(opt))
+	}
+}
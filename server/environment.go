@@ -1,9 +1,62 @@
 package server
 
 import (
+	"fmt"
+	"github.com/pkg/errors"
+	"github.com/pterodactyl/wings/config"
 	"os"
+	"sync"
 )
 
+// Defines the function used to create a new environment for a server. The constructor
+// is responsible for assigning the environment to the server instance.
+type EnvironmentConstructor func(server *Server) error
+
+var environmentsMutex sync.RWMutex
+var environments = map[string]EnvironmentConstructor{}
+
+// Registers an environment driver using the given name. Drivers are generally registered
+// from an init() function so that platform specific drivers only exist on the platforms
+// they are built for.
+func RegisterEnvironment(name string, constructor EnvironmentConstructor) {
+	environmentsMutex.Lock()
+	defer environmentsMutex.Unlock()
+
+	environments[name] = constructor
+}
+
+// Returns the names of all of the environment drivers currently registered.
+func RegisteredEnvironments() []string {
+	environmentsMutex.RLock()
+	defer environmentsMutex.RUnlock()
+
+	var out []string
+	for k := range environments {
+		out = append(out, k)
+	}
+
+	return out
+}
+
+// Creates a new environment for the server using the driver configured for this node
+// and attaches it to the server instance.
+func NewEnvironment(server *Server) error {
+	name := config.Get().System.Environment
+	if name == "" {
+		name = "docker"
+	}
+
+	environmentsMutex.RLock()
+	constructor, ok := environments[name]
+	environmentsMutex.RUnlock()
+
+	if !ok {
+		return errors.New(fmt.Sprintf("no environment driver registered with the name \"%s\"", name))
+	}
+
+	return constructor(server)
+}
+
 // Defines the basic interface that all environments need to implement so that
 // a server can be properly controlled.
 type Environment interface {
@@ -11,15 +11,19 @@ import (
 	"github.com/docker/docker/api/types/mount"
 	"github.com/docker/docker/client"
 	"github.com/docker/docker/daemon/logger/jsonfilelog"
+	"github.com/docker/docker/pkg/stdcopy"
 	"github.com/docker/go-connections/nat"
 	"github.com/pkg/errors"
 	"github.com/pterodactyl/wings/api"
 	"github.com/pterodactyl/wings/config"
+	"github.com/pterodactyl/wings/system"
 	"go.uber.org/zap"
 	"io"
+	"net"
 	"os"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 )
 
@@ -39,11 +43,20 @@ type DockerEnvironment struct {
 	// the running container instance.
 	stream types.HijackedResponse
 
+	// The last size requested for the terminal of the container, in columns and rows.
+	termMu     sync.Mutex
+	termWidth  uint
+	termHeight uint
+
 	// Holds the stats stream used by the polling commands so that we can easily close
 	// it out.
 	stats io.ReadCloser
 }
 
+func init() {
+	RegisterEnvironment("docker", NewDockerEnvironment)
+}
+
 // Creates a new base Docker environment. A server must still be attached to it.
 func NewDockerEnvironment(server *Server) error {
 	cli, err := client.NewClientWithOpts(client.FromEnv)
@@ -130,7 +143,7 @@ func (d *DockerEnvironment) InSituUpdate() error {
 		return errors.WithStack(err)
 	}
 
-	return nil
+	return d.applyBandwidthLimits()
 }
 
 // Run before the container starts and get the process configuration from the Panel.
@@ -165,7 +178,11 @@ func (d *DockerEnvironment) OnBeforeStart() error {
 		return err
 	}
 
-	return nil
+	if err := d.Server.EnsureAllocationsAvailable(); err != nil {
+		return err
+	}
+
+	return d.Server.RunHooks(PreStartHook)
 }
 
 // Starts the server environment and begins piping output to the event listeners for the
@@ -243,6 +260,8 @@ func (d *DockerEnvironment) Start() error {
 		return errors.WithStack(err)
 	}
 
+	d.applyBandwidthLimitsOnStart()
+
 	// No errors, good to continue through.
 	sawError = false
 
@@ -351,6 +370,52 @@ func (d *DockerEnvironment) ExitState() (uint32, bool, error) {
 	return uint32(c.State.ExitCode), c.State.OOMKilled, nil
 }
 
+// Returns the status of the healthcheck running in the container, which is empty if the
+// container does not have a healthcheck.
+func (d *DockerEnvironment) Health() (string, error) {
+	c, err := d.Client.ContainerInspect(context.Background(), d.Server.Uuid)
+	if err != nil {
+		return "", errors.WithStack(err)
+	}
+
+	if c.State == nil || c.State.Health == nil {
+		return "", nil
+	}
+
+	return c.State.Health.Status, nil
+}
+
+// Returns the address of the container on the network it is attached to, which can be used
+// to reach ports inside of the container that are not published on the host.
+func (d *DockerEnvironment) ContainerIp() (net.IP, error) {
+	c, err := d.Client.ContainerInspect(context.Background(), d.Server.Uuid)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	if c.NetworkSettings == nil {
+		return nil, errors.New("the container is not attached to a network")
+	}
+
+	// The network the container was created on is preferred, in case it has been attached
+	// to others since.
+	if c.HostConfig != nil {
+		if n, ok := c.NetworkSettings.Networks[string(c.HostConfig.NetworkMode)]; ok {
+			if ip := net.ParseIP(n.IPAddress); ip != nil {
+				return ip, nil
+			}
+		}
+	}
+
+	for _, n := range c.NetworkSettings.Networks {
+		if ip := net.ParseIP(n.IPAddress); ip != nil {
+			return ip, nil
+		}
+	}
+
+	return nil, errors.New("the container does not have an address on any network")
+}
+
 // Attaches to the docker container itself and ensures that we can pipe data in and out
 // of the process stream. This should not be used for reading console data as you *will*
 // miss important output at the beginning because of the time delay with attaching to the
@@ -383,6 +448,15 @@ func (d *DockerEnvironment) Attach() error {
 	}
 
 	d.attached = true
+
+	// Containers are created with the default terminal size, so apply the last size that
+	// was requested for the console.
+	if w, h := d.terminalSize(); w > 0 && h > 0 {
+		if err := d.ResizeTerminal(w, h); err != nil {
+			zap.S().Debugw("failed to resize terminal of server container", zap.String("server", d.Server.Uuid), zap.Error(err))
+		}
+	}
+
 	go func() {
 		if err := d.EnableResourcePolling(); err != nil {
 			zap.S().Warnw("failed to enabled resource polling on server", zap.String("server", d.Server.Uuid), zap.Error(errors.WithStack(err)))
@@ -423,11 +497,26 @@ func (d *DockerEnvironment) FollowConsoleOutput() error {
 	}
 
 	reader, err := d.Client.ContainerLogs(ctx, d.Server.Uuid, opts)
+	if err != nil {
+		return errors.WithStack(err)
+	}
 
 	go func(r io.ReadCloser) {
 		defer r.Close()
 
-		s := bufio.NewScanner(r)
+		// Without a terminal Docker sends the output and error streams multiplexed over a
+		// single connection, which need to be separated out again.
+		var out io.Reader = r
+		if !d.Server.Container.Tty {
+			pr, pw := io.Pipe()
+			go func() {
+				_, err := stdcopy.StdCopy(pw, pw, r)
+				pw.CloseWithError(err)
+			}()
+			out = pr
+		}
+
+		s := bufio.NewScanner(out)
 		for s.Scan() {
 			d.Server.Events().Publish(ConsoleOutputEvent, s.Text())
 		}
@@ -437,7 +526,7 @@ func (d *DockerEnvironment) FollowConsoleOutput() error {
 		}
 	}(reader)
 
-	return errors.WithStack(err)
+	return nil
 }
 
 // Enables resource polling on the docker instance. Except we aren't actually polling Docker for this
@@ -477,20 +566,22 @@ func (d *DockerEnvironment) EnableResourcePolling() error {
 				return
 			}
 
-			s.Resources.CpuAbsolute = s.Resources.CalculateAbsoluteCpu(&v.PreCPUStats, &v.CPUStats)
-			s.Resources.Memory = v.MemoryStats.Usage
-			s.Resources.MemoryLimit = v.MemoryStats.Limit
+			s.UpdateResources(func(ru *ResourceUsage) {
+				ru.CpuAbsolute = ru.CalculateAbsoluteCpu(&v.PreCPUStats, &v.CPUStats)
+				ru.Memory = ru.CalculateMemoryUsage(&v.MemoryStats)
+				ru.MemoryLimit = v.MemoryStats.Limit
+
+				for _, nw := range v.Networks {
+					ru.Network.RxBytes += nw.RxBytes
+					ru.Network.TxBytes += nw.TxBytes
+				}
+			})
 
 			// Why you ask? This already has the logic for caching disk space in use and then
 			// also handles pushing that value to the resources object automatically.
 			s.Filesystem.HasSpaceAvailable()
 
-			for _, nw := range v.Networks {
-				s.Resources.Network.RxBytes += nw.RxBytes
-				s.Resources.Network.TxBytes += nw.TxBytes
-			}
-
-			b, _ := json.Marshal(s.Resources)
+			b, _ := json.Marshal(s.GetResources())
 			s.Events().Publish(StatsEvent, string(b))
 		}
 	}(d.Server)
@@ -506,10 +597,12 @@ func (d *DockerEnvironment) DisableResourcePolling() error {
 
 	err := d.stats.Close()
 
-	d.Server.Resources.CpuAbsolute = 0
-	d.Server.Resources.Memory = 0
-	d.Server.Resources.Network.TxBytes = 0
-	d.Server.Resources.Network.RxBytes = 0
+	d.Server.UpdateResources(func(ru *ResourceUsage) {
+		ru.CpuAbsolute = 0
+		ru.Memory = 0
+		ru.Network.TxBytes = 0
+		ru.Network.RxBytes = 0
+	})
 
 	return errors.WithStack(err)
 }
@@ -517,29 +610,60 @@ func (d *DockerEnvironment) DisableResourcePolling() error {
 // Pulls the image from Docker.
 //
 // @todo handle authorization & local images
-func (d *DockerEnvironment) ensureImageExists(c *client.Client) error {
-	out, err := c.ImagePull(context.Background(), d.Server.Container.Image, types.ImagePullOptions{All: false})
+func (d *DockerEnvironment) ensureImageExists(ctx context.Context, c *client.Client) error {
+	return pullImage(ctx, c, d.Server.ContainerImage(), d.Server.ContainerPlatform())
+}
+
+// Pulls an image so that it is available before the server is switched over to it.
+func (d *DockerEnvironment) PullImage(ctx context.Context, image string) error {
+	return pullImage(ctx, d.Client, image, d.Server.ContainerPlatform())
+}
+
+// Pulls an image for the given platform, blocking until it has been completely downloaded.
+// Cancelling the context closes the connection to Docker, which stops the pull.
+func pullImage(ctx context.Context, c *client.Client, image string, platform string) error {
+	out, err := c.ImagePull(ctx, image, types.ImagePullOptions{All: false, Platform: platform})
 	if err != nil {
-		return err
+		return pullError(image, platform, err)
 	}
 	defer out.Close()
 
-	zap.S().Debugw("pulling docker image... this could take a bit of time", zap.String("image", d.Server.Container.Image))
+	zap.S().Debugw("pulling docker image... this could take a bit of time", zap.String("image", image), zap.String("platform", platform))
 
-	// I'm not sure what the best approach here is, but this will block execution until the image
-	// is done being pulled, which is what we need.
+	// Docker reports most failures as a message in the output of the pull rather than by
+	// failing the request, so every message is checked for an error.
 	scanner := bufio.NewScanner(out)
 	for scanner.Scan() {
-		continue
+		var m struct {
+			Error string `json:"error"`
+		}
+
+		if err := json.Unmarshal(scanner.Bytes(), &m); err == nil && m.Error != "" {
+			return pullError(image, platform, errors.New(m.Error))
+		}
 	}
 
 	if err := scanner.Err(); err != nil {
+		if ctx.Err() != nil {
+			return errors.WithStack(ctx.Err())
+		}
+
 		return err
 	}
 
 	return nil
 }
 
+// Returns the error for a failed pull, which is a clearer error if the image does not have
+// a version for the platform that was requested.
+func pullError(image string, platform string, err error) error {
+	if strings.Contains(err.Error(), "no matching manifest") {
+		return &noMatchingManifest{image: image, platform: platform}
+	}
+
+	return errors.WithStack(err)
+}
+
 // Creates a new container for the server using all of the data that is currently
 // available for it. If the container already exists it will be returned.
 //
@@ -566,28 +690,27 @@ func (d *DockerEnvironment) Create() error {
 	}
 
 	// Try to pull the requested image before creating the container.
-	if err := d.ensureImageExists(cli); err != nil {
+	if err := d.ensureImageExists(ctx, cli); err != nil {
 		return errors.WithStack(err)
 	}
 
 	conf := &container.Config{
 		Hostname:     "container",
-		User:         strconv.Itoa(config.Get().System.User.Uid),
+		User:         d.containerUser(),
 		AttachStdin:  true,
 		AttachStdout: true,
 		AttachStderr: true,
 		OpenStdin:    true,
-		Tty:          true,
+		Tty:          d.Server.Container.Tty,
 
 		ExposedPorts: d.exposedPorts(),
 
-		Image: d.Server.Container.Image,
+		Image: d.Server.ContainerImage(),
 		Env:   d.environmentVariables(),
 
-		Labels: map[string]string{
-			"Service":       "Pterodactyl",
-			"ContainerType": "server_process",
-		},
+		Labels: d.Server.containerLabels("server_process"),
+
+		Healthcheck: d.Server.Healthcheck.containerConfig(),
 	}
 
 	hostConf := &container.HostConfig{
@@ -638,16 +761,22 @@ func (d *DockerEnvironment) Create() error {
 		NetworkMode: "pterodactyl_nw",
 	}
 
-	// Pretty sure TZ=X in the environment variables negates the need for this
-	// to happen. Leaving it until I can confirm that works for everything.
-	//
-	// if err := mountTimezoneData(hostConf); err != nil {
-	// 	if os.IsNotExist(err) {
-	// 		zap.S().Warnw("the timezone data path configured does not exist on the system", zap.Error(errors.WithStack(err)))
-	// 	} else {
-	// 		zap.S().Warnw("failed to mount timezone data into container", zap.Error(errors.WithStack(err)))
-	// 	}
-	// }
+	d.Server.applyDockerOverrides(hostConf)
+
+	// The TZ variable is enough for most images, but some do not read it or do not include
+	// timezone data of their own, so the data is mounted from the host as well.
+	if config.Get().Docker.MountTimezone {
+		if p := timezoneDataPath(); p != "" {
+			hostConf.Mounts = append(hostConf.Mounts, mount.Mount{
+				Target:   "/etc/localtime",
+				Source:   p,
+				Type:     mount.TypeBind,
+				ReadOnly: true,
+			})
+		} else {
+			zap.S().Debugw("timezone data does not exist on the host, not mounting it into container", zap.String("server", d.Server.Uuid), zap.String("timezone", Timezone()))
+		}
+	}
 
 	if _, err := cli.ContainerCreate(ctx, conf, hostConf, nil, d.Server.Uuid); err != nil {
 		return errors.WithStack(err)
@@ -656,6 +785,132 @@ func (d *DockerEnvironment) Create() error {
 	return nil
 }
 
+// Changes the size of the terminal for the server process. The size is remembered and applied
+// to the container again whenever it is attached to, since a new container is created each
+// time the server is started.
+func (d *DockerEnvironment) ResizeTerminal(width uint, height uint) error {
+	if !d.Server.Container.Tty {
+		return nil
+	}
+
+	d.termMu.Lock()
+	d.termWidth, d.termHeight = width, height
+	d.termMu.Unlock()
+
+	if !d.attached {
+		return nil
+	}
+
+	err := d.Client.ContainerResize(context.Background(), d.Server.Uuid, types.ResizeOptions{
+		Width:  width,
+		Height: height,
+	})
+
+	return errors.WithStack(err)
+}
+
+// Starts a process inside of the running container, as the same user as the server process
+// and in the same directory.
+func (d *DockerEnvironment) Exec(opts ExecOptions) (ExecProcess, error) {
+	ctx := context.Background()
+
+	resp, err := d.Client.ContainerExecCreate(ctx, d.Server.Uuid, types.ExecConfig{
+		User:         d.containerUser(),
+		Tty:          opts.Tty,
+		AttachStdin:  true,
+		AttachStdout: true,
+		AttachStderr: true,
+		Env:          opts.Env,
+		WorkingDir:   "/home/container",
+		Cmd:          opts.Command,
+	})
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	stream, err := d.Client.ContainerExecAttach(ctx, resp.ID, types.ExecStartCheck{Tty: opts.Tty})
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	p := &dockerExecProcess{client: d.Client, id: resp.ID, tty: opts.Tty, stream: stream}
+
+	if opts.Tty {
+		if err := p.Resize(opts.Width, opts.Height); err != nil {
+			zap.S().Debugw("failed to resize terminal of process in server container", zap.String("server", d.Server.Uuid), zap.Error(err))
+		}
+	}
+
+	return p, nil
+}
+
+// A process started inside of a server container using docker exec.
+type dockerExecProcess struct {
+	client *client.Client
+	id     string
+	tty    bool
+	stream types.HijackedResponse
+}
+
+func (p *dockerExecProcess) Stream(stdin io.Reader, stdout io.Writer, stderr io.Writer) error {
+	defer p.stream.Close()
+
+	go func() {
+		io.Copy(p.stream.Conn, stdin)
+		p.stream.CloseWrite()
+	}()
+
+	var err error
+	if p.tty {
+		_, err = io.Copy(stdout, p.stream.Reader)
+	} else {
+		_, err = stdcopy.StdCopy(stdout, stderr, p.stream.Reader)
+	}
+
+	return errors.WithStack(err)
+}
+
+func (p *dockerExecProcess) Resize(width uint, height uint) error {
+	if !p.tty {
+		return nil
+	}
+
+	err := p.client.ContainerExecResize(context.Background(), p.id, types.ResizeOptions{
+		Width:  width,
+		Height: height,
+	})
+
+	return errors.WithStack(err)
+}
+
+// Returns the exit code of the process. Docker can take a moment to notice the process has
+// exited after its output has ended, so this waits for up to a second for that to happen.
+func (p *dockerExecProcess) ExitCode() (int, error) {
+	for i := 0; ; i++ {
+		r, err := p.client.ContainerExecInspect(context.Background(), p.id)
+		if err != nil {
+			return 0, errors.WithStack(err)
+		}
+
+		if !r.Running {
+			return r.ExitCode, nil
+		}
+
+		if i == 10 {
+			return 0, errors.New("process is still running")
+		}
+
+		time.Sleep(time.Millisecond * 100)
+	}
+}
+
+func (d *DockerEnvironment) terminalSize() (uint, uint) {
+	d.termMu.Lock()
+	defer d.termMu.Unlock()
+
+	return d.termWidth, d.termHeight
+}
+
 // Sends the specified command to the stdin of the running container instance. There is no
 // confirmation that this data is sent successfully, only that it gets pushed into the stdin.
 func (d *DockerEnvironment) SendCommand(c string) error {
@@ -747,15 +1002,13 @@ func (d *DockerEnvironment) parseLogToStrings(b []byte) ([]string, error) {
 
 // Returns the environment variables for a server in KEY="VALUE" form.
 func (d *DockerEnvironment) environmentVariables() []string {
-	zone, _ := time.Now().In(time.Local).Zone()
-
-	var out = []string{
-		fmt.Sprintf("TZ=%s", zone),
+	var out = append(localeVariables(),
 		fmt.Sprintf("STARTUP=%s", d.Server.Invocation),
 		fmt.Sprintf("SERVER_MEMORY=%d", d.Server.Build.MemoryLimit),
 		fmt.Sprintf("SERVER_IP=%s", d.Server.Allocations.DefaultMapping.Ip),
 		fmt.Sprintf("SERVER_PORT=%d", d.Server.Allocations.DefaultMapping.Port),
-	}
+		fmt.Sprintf("SERVER_ADDRESS=%s", d.Server.Allocations.DefaultAddress()),
+	)
 
 eloop:
 	for k, v := range d.Server.EnvVars {
@@ -775,6 +1028,17 @@ func (d *DockerEnvironment) volumes() map[string]struct{} {
 	return nil
 }
 
+// Returns the user that the server process runs as inside of the container. When Docker is
+// running rootless the files in the container are owned by the user mapped to the root
+// of the container, so the configured container user is used instead of the system user.
+func (d *DockerEnvironment) containerUser() string {
+	if c := config.Get().Docker.Rootless; c.Active {
+		return strconv.Itoa(c.ContainerUid)
+	}
+
+	return strconv.Itoa(config.Get().System.User.Uid)
+}
+
 // Converts the server allocation mappings into a format that can be understood
 // by Docker.
 func (d *DockerEnvironment) portBindings() nat.PortMap {
@@ -787,15 +1051,22 @@ func (d *DockerEnvironment) portBindings() nat.PortMap {
 				continue
 			}
 
-			binding := []nat.PortBinding{
-				{
-					HostIP:   ip,
-					HostPort: strconv.Itoa(port),
-				},
+			if isPrivilegedPort(port) && config.Get().Docker.Rootless.SkipPrivilegedPorts {
+				continue
 			}
 
-			out[nat.Port(fmt.Sprintf("%d/tcp", port))] = binding
-			out[nat.Port(fmt.Sprintf("%d/udp", port))] = binding
+			binding := nat.PortBinding{
+				HostIP:   normalizeAllocationIp(ip),
+				HostPort: strconv.Itoa(port),
+			}
+
+			// The same port can be assigned on multiple IPs, for example when a server has
+			// both an IPv4 and IPv6 allocation, so append rather than replace the bindings.
+			tcp := nat.Port(fmt.Sprintf("%d/tcp", port))
+			udp := nat.Port(fmt.Sprintf("%d/udp", port))
+
+			out[tcp] = append(out[tcp], binding)
+			out[udp] = append(out[udp], binding)
 		}
 	}
 
@@ -821,6 +1092,13 @@ func (d *DockerEnvironment) exposedPorts() nat.PortSet {
 // Formats the resources available to a server instance in such as way that Docker will
 // generate a matching environment in the container.
 func (d *DockerEnvironment) getResourcesForServer() container.Resources {
+	// The OOM killer cannot be disabled for a cgroup when using cgroup v2, so the option
+	// is left out rather than having Docker warn about it every time a container is made.
+	var oomKillDisable *bool
+	if system.CgroupVersion() == system.CgroupsV1 {
+		oomKillDisable = &d.Server.Container.OomDisabled
+	}
+
 	return container.Resources{
 		// @todo memory limit should be slightly higher than the reservation
 		Memory:            d.Server.Build.MemoryLimit * 1000000,
@@ -830,7 +1108,7 @@ func (d *DockerEnvironment) getResourcesForServer() container.Resources {
 		CPUPeriod:         100000,
 		CPUShares:         1024,
 		BlkioWeight:       d.Server.Build.IoWeight,
-		OomKillDisable:    &d.Server.Container.OomDisabled,
+		OomKillDisable:    oomKillDisable,
 		CpusetCpus:        d.Server.Build.Threads,
 	}
 }
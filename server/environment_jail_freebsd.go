@@ -0,0 +1,569 @@
+package server
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"github.com/pkg/errors"
+	"github.com/pterodactyl/wings/api"
+	"github.com/pterodactyl/wings/config"
+	"go.uber.org/zap"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+func init() {
+	RegisterEnvironment("jail", NewJailEnvironment)
+}
+
+// Defines an environment that runs server processes inside of a FreeBSD jail. Each server
+// gets a dedicated jail using a read-only copy of the configured base system as its root
+// and the server data directory mounted at /home/container.
+type JailEnvironment struct {
+	Server *Server
+
+	mu sync.RWMutex
+
+	// The running server process. This is the script(1) wrapper around jexec(8) which
+	// gives the server process a pseudo-terminal to write to.
+	cmd *exec.Cmd
+
+	// The stdin of the running server process, used when sending commands.
+	stdin io.WriteCloser
+
+	// Closed once the running process has exited.
+	done chan struct{}
+
+	// Set while the process is running. The process state of the command is written by
+	// the goroutine waiting on it, so this is checked instead.
+	running bool
+
+	// The exit code of the last process that was run in this jail.
+	exitCode uint32
+
+	// Closing this channel stops the resource polling loop for the jail.
+	polling chan struct{}
+}
+
+// Creates a new jail environment for the server.
+func NewJailEnvironment(server *Server) error {
+	server.Environment = &JailEnvironment{
+		Server: server,
+	}
+
+	return nil
+}
+
+var _ Environment = (*JailEnvironment)(nil)
+
+// Returns the name of the environment.
+func (j *JailEnvironment) Type() string {
+	return "jail"
+}
+
+// Returns the name of the jail for the server. Jail names cannot contain hyphens so
+// they are swapped out for underscores.
+func (j *JailEnvironment) name() string {
+	return "pterodactyl_" + strings.Replace(j.Server.Uuid, "-", "_", -1)
+}
+
+// Returns the root directory for the jail.
+func (j *JailEnvironment) root() string {
+	return filepath.Join(config.Get().System.Jail.Directory, j.Server.Uuid)
+}
+
+// Returns the path to the console log file for the jail.
+func (j *JailEnvironment) logPath() string {
+	return filepath.Join(config.Get().System.Jail.Directory, j.Server.Uuid+".log")
+}
+
+// Runs a command on the host system and returns an error including any output from
+// the command if it does not exit cleanly.
+func (j *JailEnvironment) run(name string, args ...string) ([]byte, error) {
+	out, err := exec.Command(name, args...).CombinedOutput()
+	if err != nil {
+		return out, errors.Wrap(err, fmt.Sprintf("%s: %s", name, strings.TrimSpace(string(out))))
+	}
+
+	return out, nil
+}
+
+// Determines if the jail for this server currently exists on the system.
+func (j *JailEnvironment) Exists() (bool, error) {
+	if err := exec.Command("jls", "-j", j.name()).Run(); err != nil {
+		if _, ok := err.(*exec.ExitError); ok {
+			return false, nil
+		}
+
+		return false, errors.WithStack(err)
+	}
+
+	return true, nil
+}
+
+// Determines if the server process is currently running inside the jail.
+func (j *JailEnvironment) IsRunning() (bool, error) {
+	j.mu.RLock()
+	defer j.mu.RUnlock()
+
+	return j.running, nil
+}
+
+// Applies the current build limits to the jail using rctl(8). Limits are removed and
+// then re-added so that lowering a limit is applied correctly.
+func (j *JailEnvironment) applyResourceLimits() error {
+	subject := "jail:" + j.name()
+
+	// Removing the rules fails if there are none, which is fine.
+	exec.Command("rctl", "-r", subject).Run()
+
+	var rules []string
+	if j.Server.Build.MemoryLimit > 0 {
+		rules = append(rules, fmt.Sprintf("%s:memoryuse:deny=%d", subject, j.Server.Build.MemoryLimit*1000000))
+	}
+
+	if j.Server.Build.Swap > 0 {
+		rules = append(rules, fmt.Sprintf("%s:swapuse:deny=%d", subject, j.Server.Build.Swap*1000000))
+	}
+
+	if j.Server.Build.CpuLimit > 0 {
+		rules = append(rules, fmt.Sprintf("%s:pcpu:deny=%d", subject, j.Server.Build.CpuLimit))
+	}
+
+	for _, rule := range rules {
+		if _, err := j.run("rctl", "-a", rule); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Updates the resource limits on the jail without restarting the server process.
+func (j *JailEnvironment) InSituUpdate() error {
+	if exists, err := j.Exists(); err != nil || !exists {
+		return err
+	}
+
+	return j.applyResourceLimits()
+}
+
+// Syncs the server configuration with the Panel and ensures the jail exists before
+// the server process is started.
+func (j *JailEnvironment) OnBeforeStart() error {
+	zap.S().Infow("syncing server configuration with Panel", zap.String("server", j.Server.Uuid))
+	if err := j.Server.Sync(); err != nil {
+		return err
+	}
+
+	if err := j.Create(); err != nil {
+		return err
+	}
+
+	if err := j.applyResourceLimits(); err != nil {
+		return err
+	}
+
+	if err := j.Server.EnsureAllocationsAvailable(); err != nil {
+		return err
+	}
+
+	return j.Server.RunHooks(PreStartHook)
+}
+
+// Starts the server process inside the jail and begins piping the console output to
+// the server event listeners.
+func (j *JailEnvironment) Start() error {
+	sawError := false
+	defer func() {
+		if sawError {
+			j.Server.SetState(ProcessOfflineState)
+		}
+	}()
+
+	if j.Server.Suspended {
+		return &suspendedError{}
+	}
+
+	if running, _ := j.IsRunning(); running {
+		j.Server.SetState(ProcessRunningState)
+
+		return nil
+	}
+
+	j.Server.SetState(ProcessStartingState)
+	sawError = true
+
+	if err := j.OnBeforeStart(); err != nil {
+		return errors.WithStack(err)
+	}
+
+	j.Server.UpdateConfigurationFiles()
+
+	if err := j.Server.Filesystem.Chown("/"); err != nil {
+		return errors.WithStack(err)
+	}
+
+	logFile, err := os.OpenFile(j.logPath(), os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	// Running the process through script(1) allocates a pseudo-terminal for it, which
+	// means the output is line buffered and behaves the same as it does in a container.
+	cmd := exec.Command(
+		"script", "-q", "/dev/null",
+		"jexec", "-U", config.Get().System.Username, j.name(),
+		"/bin/sh", "-c", "cd /home/container && exec "+j.Server.RenderedInvocation(),
+	)
+	cmd.Env = j.Server.GetEnvironmentVariables()
+
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		logFile.Close()
+		return errors.WithStack(err)
+	}
+
+	pr, pw := io.Pipe()
+	cmd.Stdout = io.MultiWriter(logFile, pw)
+	cmd.Stderr = cmd.Stdout
+
+	if err := cmd.Start(); err != nil {
+		logFile.Close()
+		return errors.WithStack(err)
+	}
+
+	done := make(chan struct{})
+
+	j.mu.Lock()
+	j.cmd = cmd
+	j.stdin = stdin
+	j.done = done
+	j.running = true
+	j.mu.Unlock()
+
+	go func() {
+		s := bufio.NewScanner(pr)
+		for s.Scan() {
+			j.Server.Events().Publish(ConsoleOutputEvent, s.Text())
+		}
+	}()
+
+	go func() {
+		err := cmd.Wait()
+		pw.Close()
+		logFile.Close()
+
+		var code uint32
+		if exitErr, ok := err.(*exec.ExitError); ok {
+			if status, ok := exitErr.Sys().(syscall.WaitStatus); ok {
+				code = uint32(status.ExitStatus())
+			}
+		}
+
+		j.mu.Lock()
+		j.exitCode = code
+		j.running = false
+		j.mu.Unlock()
+
+		close(done)
+		j.Server.SetState(ProcessOfflineState)
+	}()
+
+	sawError = false
+
+	go func() {
+		if err := j.EnableResourcePolling(); err != nil {
+			zap.S().Warnw("failed to enable resource polling on server", zap.String("server", j.Server.Uuid), zap.Error(err))
+		}
+	}()
+
+	return nil
+}
+
+// Stops the server process using the stop configuration defined for the server.
+func (j *JailEnvironment) Stop() error {
+	stop := j.Server.processConfiguration.Stop
+	if stop.Type == api.ProcessStopSignal {
+		return j.Terminate(os.Kill)
+	}
+
+	j.Server.SetState(ProcessStoppingState)
+	if stop.Type == api.ProcessStopCommand {
+		return j.SendCommand(stop.Value)
+	}
+
+	return j.Terminate(syscall.SIGTERM)
+}
+
+// Stops the server and waits for the process to exit. If it is still running after the
+// given number of seconds it is either killed or an error is returned.
+func (j *JailEnvironment) WaitForStop(seconds int, terminate bool) error {
+	if j.Server.GetState() == ProcessOfflineState {
+		return nil
+	}
+
+	if err := j.Stop(); err != nil {
+		return errors.WithStack(err)
+	}
+
+	j.mu.RLock()
+	done := j.done
+	j.mu.RUnlock()
+
+	if done == nil {
+		return nil
+	}
+
+	select {
+	case <-done:
+		return nil
+	case <-time.After(time.Duration(seconds) * time.Second):
+		if terminate {
+			return j.Terminate(os.Kill)
+		}
+
+		return errors.New("timed out waiting for server process to stop")
+	}
+}
+
+// Sends the given signal to every process running inside of the jail.
+func (j *JailEnvironment) Terminate(signal os.Signal) error {
+	if running, _ := j.IsRunning(); !running {
+		return nil
+	}
+
+	j.Server.SetState(ProcessStoppingState)
+
+	sig, ok := signal.(syscall.Signal)
+	if !ok {
+		sig = syscall.SIGKILL
+	}
+
+	if _, err := j.run("jexec", j.name(), "kill", "-"+strconv.Itoa(int(sig)), "-1"); err != nil {
+		zap.S().Debugw("failed to signal processes inside jail", zap.String("server", j.Server.Uuid), zap.Error(err))
+	}
+
+	j.mu.RLock()
+	defer j.mu.RUnlock()
+
+	if j.cmd != nil && j.cmd.Process != nil {
+		return j.cmd.Process.Signal(sig)
+	}
+
+	return nil
+}
+
+// Removes the jail from the system along with any resource limits and mounts that
+// were created for it. Server data is left untouched.
+func (j *JailEnvironment) Destroy() error {
+	j.Server.SetState(ProcessStoppingState)
+
+	if err := j.Terminate(os.Kill); err != nil {
+		return err
+	}
+
+	if exists, _ := j.Exists(); exists {
+		if _, err := j.run("jail", "-r", j.name()); err != nil {
+			return err
+		}
+	}
+
+	exec.Command("rctl", "-r", "jail:"+j.name()).Run()
+	exec.Command("umount", filepath.Join(j.root(), "home", "container")).Run()
+	exec.Command("umount", j.root()).Run()
+
+	return nil
+}
+
+// Returns the exit code of the last process run in the jail. Resource limits in a jail
+// deny allocations rather than killing the process, so it is never marked as OOM killed.
+func (j *JailEnvironment) ExitState() (uint32, bool, error) {
+	j.mu.RLock()
+	defer j.mu.RUnlock()
+
+	return j.exitCode, false, nil
+}
+
+// Creates the jail for the server if it does not already exist. The base system is
+// mounted read-only as the jail root, and the server data directory is mounted on
+// top of it at /home/container.
+func (j *JailEnvironment) Create() error {
+	if err := j.Server.Filesystem.EnsureDataDirectory(); err != nil {
+		return errors.WithStack(err)
+	}
+
+	if exists, err := j.Exists(); err != nil {
+		return err
+	} else if exists {
+		return nil
+	}
+
+	if err := os.MkdirAll(j.root(), 0755); err != nil {
+		return errors.WithStack(err)
+	}
+
+	cfg := config.Get().System.Jail
+	if _, err := j.run("mount_nullfs", "-o", "ro", cfg.BaseDirectory, j.root()); err != nil {
+		return err
+	}
+
+	if _, err := j.run("mount_nullfs", j.Server.Filesystem.Path(), filepath.Join(j.root(), "home", "container")); err != nil {
+		return err
+	}
+
+	args := []string{
+		"-c",
+		"name=" + j.name(),
+		"path=" + j.root(),
+		"host.hostname=container",
+		"mount.devfs",
+		"persist",
+	}
+
+	if cfg.Interface == "" {
+		args = append(args, "ip4=inherit", "ip6=inherit")
+	} else {
+		var addrs4, addrs6 []string
+		for ip := range j.Server.Allocations.Mappings {
+			if isIpv6Allocation(ip) {
+				addrs6 = append(addrs6, cfg.Interface+"|"+normalizeAllocationIp(ip))
+			} else {
+				addrs4 = append(addrs4, cfg.Interface+"|"+ip)
+			}
+		}
+
+		if len(addrs4) > 0 {
+			args = append(args, "ip4.addr="+strings.Join(addrs4, ","))
+		}
+
+		if len(addrs6) > 0 {
+			args = append(args, "ip6.addr="+strings.Join(addrs6, ","))
+		}
+	}
+
+	_, err := j.run("jail", args...)
+
+	return err
+}
+
+// The console output is streamed from the moment the process is started, so there is
+// nothing to attach to here beyond confirming the process is running.
+func (j *JailEnvironment) Attach() error {
+	if running, _ := j.IsRunning(); !running {
+		return errors.New("cannot attach to a jail with no running server process")
+	}
+
+	return nil
+}
+
+// Console output is already piped to the server event bus when the process is started.
+func (j *JailEnvironment) FollowConsoleOutput() error {
+	return nil
+}
+
+// Writes the command to the stdin of the running server process.
+func (j *JailEnvironment) SendCommand(c string) error {
+	j.mu.RLock()
+	defer j.mu.RUnlock()
+
+	if j.stdin == nil || !j.running {
+		return errors.New("attempting to send command to non-running instance")
+	}
+
+	_, err := j.stdin.Write([]byte(c + "\n"))
+
+	return errors.WithStack(err)
+}
+
+// Reads the last len bytes of the console log for the jail.
+func (j *JailEnvironment) Readlog(len int64) ([]string, error) {
+	return readLogLines(j.logPath(), len)
+}
+
+// Polls rctl(8) for the resource usage of the jail once a second and publishes the
+// results to the server stats event.
+func (j *JailEnvironment) EnableResourcePolling() error {
+	if j.Server.GetState() == ProcessOfflineState {
+		return errors.New("cannot enable resource polling on a server that is not running")
+	}
+
+	stop := make(chan struct{})
+
+	j.mu.Lock()
+	if j.polling != nil {
+		close(j.polling)
+	}
+	j.polling = stop
+	j.mu.Unlock()
+
+	go func(s *Server) {
+		ticker := time.NewTicker(time.Second)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+				if s.GetState() == ProcessOfflineState {
+					j.DisableResourcePolling()
+					return
+				}
+
+				out, err := exec.Command("rctl", "-u", "jail:"+j.name()).Output()
+				if err != nil {
+					continue
+				}
+
+				usage := map[string]string{}
+				for _, line := range strings.Split(string(out), "\n") {
+					if parts := strings.SplitN(line, "=", 2); len(parts) == 2 {
+						usage[parts[0]] = strings.TrimSpace(parts[1])
+					}
+				}
+
+				mem, _ := strconv.ParseUint(usage["memoryuse"], 10, 64)
+				cpu, _ := strconv.ParseFloat(usage["pcpu"], 64)
+
+				limit := uint64(s.Build.MemoryLimit * 1000000)
+				s.UpdateResources(func(ru *ResourceUsage) {
+					ru.Memory = mem
+					ru.MemoryLimit = limit
+					ru.CpuAbsolute = cpu
+				})
+
+				s.Filesystem.HasSpaceAvailable()
+
+				b, _ := json.Marshal(s.GetResources())
+				s.Events().Publish(StatsEvent, string(b))
+			}
+		}
+	}(j.Server)
+
+	return nil
+}
+
+// Stops the resource polling loop and resets the usage values for the server.
+func (j *JailEnvironment) DisableResourcePolling() error {
+	j.mu.Lock()
+	if j.polling != nil {
+		close(j.polling)
+		j.polling = nil
+	}
+	j.mu.Unlock()
+
+	j.Server.UpdateResources(func(ru *ResourceUsage) {
+		ru.CpuAbsolute = 0
+		ru.Memory = 0
+	})
+
+	return nil
+}
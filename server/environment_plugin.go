@@ -0,0 +1,389 @@
+package server
+
+import (
+	"encoding/json"
+	"github.com/pkg/errors"
+	"github.com/pterodactyl/wings/api"
+	"github.com/pterodactyl/wings/config"
+	"github.com/pterodactyl/wings/plugin"
+	"go.uber.org/zap"
+	"os"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// Launches every plugin defined in the configuration and registers it as an environment
+// driver using the configured name. A plugin that fails to launch is logged and skipped
+// so that servers using other drivers can still be booted.
+func RegisterPluginEnvironments(plugins map[string]config.PluginConfiguration) {
+	for name, cfg := range plugins {
+		client, err := plugin.Launch(name, cfg.Path, cfg.Args...)
+		if err != nil {
+			zap.S().Errorw("failed to launch environment plugin", zap.String("plugin", name), zap.Error(err))
+			continue
+		}
+
+		zap.S().Infow("registered environment plugin", zap.String("plugin", name), zap.String("path", cfg.Path))
+
+		RegisterEnvironment(name, func(server *Server) error {
+			server.Environment = &PluginEnvironment{
+				Server: server,
+				client: client,
+			}
+
+			return nil
+		})
+	}
+}
+
+// Defines an environment that delegates all of the process management for a server to an
+// external plugin process.
+type PluginEnvironment struct {
+	Server *Server
+
+	client *plugin.Client
+
+	mu sync.Mutex
+
+	// Closing this channel stops the event pump for the server.
+	events chan struct{}
+
+	// Closing this channel stops the resource polling loop for the server.
+	polling chan struct{}
+}
+
+var _ Environment = (*PluginEnvironment)(nil)
+
+// Returns the name of the plugin providing this environment.
+func (p *PluginEnvironment) Type() string {
+	return p.client.Name
+}
+
+// Builds the server details that are passed along to the plugin.
+func (p *PluginEnvironment) details() plugin.Server {
+	return plugin.Server{
+		Uuid:        p.Server.Uuid,
+		Invocation:  p.Server.RenderedInvocation(),
+		Environment: p.Server.GetEnvironmentVariables(),
+		DataPath:    p.Server.Filesystem.Path(),
+		Image:       p.Server.ContainerImage(),
+		Build: plugin.Build{
+			MemoryLimit: p.Server.Build.MemoryLimit,
+			Swap:        p.Server.Build.Swap,
+			IoWeight:    p.Server.Build.IoWeight,
+			CpuLimit:    p.Server.Build.CpuLimit,
+			DiskSpace:   p.Server.Build.DiskSpace,
+			Threads:     p.Server.Build.Threads,
+		},
+		Allocations: p.Server.Allocations.Mappings,
+	}
+}
+
+func (p *PluginEnvironment) Exists() (bool, error) {
+	return p.client.Exists(p.Server.Uuid)
+}
+
+func (p *PluginEnvironment) IsRunning() (bool, error) {
+	return p.client.IsRunning(p.Server.Uuid)
+}
+
+func (p *PluginEnvironment) InSituUpdate() error {
+	if exists, err := p.Exists(); err != nil || !exists {
+		return err
+	}
+
+	return p.client.InSituUpdate(p.details())
+}
+
+// Syncs the server configuration with the Panel and ensures the environment exists
+// before the server process is started.
+func (p *PluginEnvironment) OnBeforeStart() error {
+	zap.S().Infow("syncing server configuration with Panel", zap.String("server", p.Server.Uuid))
+	if err := p.Server.Sync(); err != nil {
+		return err
+	}
+
+	if err := p.Create(); err != nil {
+		return err
+	}
+
+	if err := p.Server.EnsureAllocationsAvailable(); err != nil {
+		return err
+	}
+
+	return p.Server.RunHooks(PreStartHook)
+}
+
+// Starts the server process through the plugin and begins forwarding the events it
+// emits to the server event bus.
+func (p *PluginEnvironment) Start() error {
+	sawError := false
+	defer func() {
+		if sawError {
+			p.Server.SetState(ProcessOfflineState)
+		}
+	}()
+
+	if p.Server.Suspended {
+		return &suspendedError{}
+	}
+
+	if running, err := p.IsRunning(); err != nil {
+		return errors.WithStack(err)
+	} else if running {
+		p.Server.SetState(ProcessRunningState)
+
+		return p.FollowConsoleOutput()
+	}
+
+	p.Server.SetState(ProcessStartingState)
+	sawError = true
+
+	if err := p.OnBeforeStart(); err != nil {
+		return errors.WithStack(err)
+	}
+
+	p.Server.UpdateConfigurationFiles()
+
+	if err := p.Server.Filesystem.Chown("/"); err != nil {
+		return errors.WithStack(err)
+	}
+
+	if err := p.client.Start(p.details()); err != nil {
+		return errors.WithStack(err)
+	}
+
+	if err := p.FollowConsoleOutput(); err != nil {
+		return errors.WithStack(err)
+	}
+
+	sawError = false
+
+	go func() {
+		if err := p.EnableResourcePolling(); err != nil {
+			zap.S().Warnw("failed to enable resource polling on server", zap.String("server", p.Server.Uuid), zap.Error(err))
+		}
+	}()
+
+	return nil
+}
+
+// Stops the server process using the stop configuration defined for the server. Console
+// commands are sent through the plugin, anything else is left to the plugin to handle.
+func (p *PluginEnvironment) Stop() error {
+	stop := p.Server.processConfiguration.Stop
+	if stop.Type == api.ProcessStopSignal {
+		return p.Terminate(os.Kill)
+	}
+
+	p.Server.SetState(ProcessStoppingState)
+	if stop.Type == api.ProcessStopCommand {
+		return p.SendCommand(stop.Value)
+	}
+
+	return p.client.Stop(p.Server.Uuid)
+}
+
+// Stops the server and waits for the process to exit. If it is still running after the
+// given number of seconds it is either killed or an error is returned.
+func (p *PluginEnvironment) WaitForStop(seconds int, terminate bool) error {
+	if p.Server.GetState() == ProcessOfflineState {
+		return nil
+	}
+
+	if err := p.Stop(); err != nil {
+		return errors.WithStack(err)
+	}
+
+	deadline := time.Now().Add(time.Duration(seconds) * time.Second)
+	for time.Now().Before(deadline) {
+		if running, err := p.IsRunning(); err != nil {
+			return errors.WithStack(err)
+		} else if !running {
+			return nil
+		}
+
+		time.Sleep(time.Millisecond * 500)
+	}
+
+	if terminate {
+		return p.Terminate(os.Kill)
+	}
+
+	return errors.New("timed out waiting for server process to stop")
+}
+
+func (p *PluginEnvironment) Terminate(signal os.Signal) error {
+	if running, _ := p.IsRunning(); !running {
+		return nil
+	}
+
+	p.Server.SetState(ProcessStoppingState)
+
+	sig, ok := signal.(syscall.Signal)
+	if !ok {
+		sig = syscall.SIGKILL
+	}
+
+	return p.client.Terminate(p.Server.Uuid, sig)
+}
+
+func (p *PluginEnvironment) Destroy() error {
+	p.Server.SetState(ProcessStoppingState)
+
+	return p.client.Destroy(p.Server.Uuid)
+}
+
+func (p *PluginEnvironment) ExitState() (uint32, bool, error) {
+	state, err := p.client.ExitState(p.Server.Uuid)
+
+	return state.Code, state.OomKilled, err
+}
+
+func (p *PluginEnvironment) Create() error {
+	if err := p.Server.Filesystem.EnsureDataDirectory(); err != nil {
+		return errors.WithStack(err)
+	}
+
+	if exists, err := p.Exists(); err != nil {
+		return err
+	} else if exists {
+		return nil
+	}
+
+	return p.client.Create(p.details())
+}
+
+// Output from the plugin is received through the event pump, so there is nothing to
+// attach to here beyond confirming the process is running.
+func (p *PluginEnvironment) Attach() error {
+	if running, _ := p.IsRunning(); !running {
+		return errors.New("cannot attach to a server with no running process")
+	}
+
+	return nil
+}
+
+// Starts long-polling the plugin for events emitted by the server and forwards them to
+// the server event bus. Polling stops once the plugin reports the process has exited.
+func (p *PluginEnvironment) FollowConsoleOutput() error {
+	stop := make(chan struct{})
+
+	p.mu.Lock()
+	if p.events != nil {
+		close(p.events)
+	}
+	p.events = stop
+	p.mu.Unlock()
+
+	go func(s *Server) {
+		for {
+			select {
+			case <-stop:
+				return
+			default:
+			}
+
+			events, err := p.client.Events(s.Uuid, 0)
+			if err != nil {
+				zap.S().Warnw("failed to read events from environment plugin", zap.String("server", s.Uuid), zap.Error(err))
+				time.Sleep(time.Second * 5)
+				continue
+			}
+
+			for _, e := range events {
+				switch e.Type {
+				case plugin.EventConsoleOutput:
+					s.Events().Publish(ConsoleOutputEvent, e.Data)
+				case plugin.EventExited:
+					s.SetState(ProcessOfflineState)
+					return
+				}
+			}
+		}
+	}(p.Server)
+
+	return nil
+}
+
+func (p *PluginEnvironment) SendCommand(c string) error {
+	return p.client.SendCommand(p.Server.Uuid, c)
+}
+
+func (p *PluginEnvironment) Readlog(len int64) ([]string, error) {
+	return p.client.Readlog(p.Server.Uuid, len)
+}
+
+// Polls the plugin for the resource usage of the server once a second and publishes
+// the results to the server stats event.
+func (p *PluginEnvironment) EnableResourcePolling() error {
+	if p.Server.GetState() == ProcessOfflineState {
+		return errors.New("cannot enable resource polling on a server that is not running")
+	}
+
+	stop := make(chan struct{})
+
+	p.mu.Lock()
+	if p.polling != nil {
+		close(p.polling)
+	}
+	p.polling = stop
+	p.mu.Unlock()
+
+	go func(s *Server) {
+		ticker := time.NewTicker(time.Second)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+				if s.GetState() == ProcessOfflineState {
+					p.DisableResourcePolling()
+					return
+				}
+
+				stats, err := p.client.Stats(s.Uuid)
+				if err != nil {
+					continue
+				}
+
+				s.UpdateResources(func(ru *ResourceUsage) {
+					ru.Memory = stats.Memory
+					ru.MemoryLimit = stats.MemoryLimit
+					ru.CpuAbsolute = stats.CpuAbsolute
+					ru.Network.RxBytes = stats.RxBytes
+					ru.Network.TxBytes = stats.TxBytes
+				})
+
+				s.Filesystem.HasSpaceAvailable()
+
+				b, _ := json.Marshal(s.GetResources())
+				s.Events().Publish(StatsEvent, string(b))
+			}
+		}
+	}(p.Server)
+
+	return nil
+}
+
+// Stops the resource polling loop and resets the usage values for the server.
+func (p *PluginEnvironment) DisableResourcePolling() error {
+	p.mu.Lock()
+	if p.polling != nil {
+		close(p.polling)
+		p.polling = nil
+	}
+	p.mu.Unlock()
+
+	p.Server.UpdateResources(func(ru *ResourceUsage) {
+		ru.CpuAbsolute = 0
+		ru.Memory = 0
+		ru.Network.RxBytes = 0
+		ru.Network.TxBytes = 0
+	})
+
+	return nil
+}
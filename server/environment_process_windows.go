@@ -0,0 +1,672 @@
+package server
+
+import (
+	"bufio"
+	"encoding/json"
+	"github.com/pkg/errors"
+	"github.com/pterodactyl/wings/api"
+	"github.com/pterodactyl/wings/config"
+	"go.uber.org/zap"
+	"golang.org/x/sys/windows"
+	"io"
+	"math"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+	"unsafe"
+)
+
+func init() {
+	RegisterEnvironment("process", NewProcessEnvironment)
+}
+
+const (
+	jobObjectCpuRateControlEnable  = 0x1
+	jobObjectCpuRateControlHardCap = 0x4
+)
+
+// Not defined by the version of x/sys we're using, so define it ourselves.
+type jobObjectCpuRateControlInformation struct {
+	ControlFlags uint32
+	CpuRate      uint32
+}
+
+type jobObjectBasicAccountingInformation struct {
+	TotalUserTime             int64
+	TotalKernelTime           int64
+	ThisPeriodTotalUserTime   int64
+	ThisPeriodTotalKernelTime int64
+	TotalPageFaultCount       uint32
+	TotalProcesses            uint32
+	ActiveProcesses           uint32
+	TotalTerminatedProcesses  uint32
+}
+
+type processMemoryCounters struct {
+	Cb                         uint32
+	PageFaultCount             uint32
+	PeakWorkingSetSize         uintptr
+	WorkingSetSize             uintptr
+	QuotaPeakPagedPoolUsage    uintptr
+	QuotaPagedPoolUsage        uintptr
+	QuotaPeakNonPagedPoolUsage uintptr
+	QuotaNonPagedPoolUsage     uintptr
+	PagefileUsage              uintptr
+	PeakPagefileUsage          uintptr
+}
+
+var (
+	modkernel32                   = windows.NewLazySystemDLL("kernel32.dll")
+	modpsapi                      = windows.NewLazySystemDLL("psapi.dll")
+	procQueryInformationJobObject = modkernel32.NewProc("QueryInformationJobObject")
+	procGetProcessMemoryInfo      = modpsapi.NewProc("GetProcessMemoryInfo")
+)
+
+// Characters that cmd.exe gives a special meaning to, which would allow the value of a
+// variable to run other commands on the host. Escaping them with a caret does not work for
+// every character, since variables are still expanded inside of quotes.
+const cmdMetacharacters = "&|<>^%\"\r\n"
+
+// Returns the startup command of the server with the values of its variables substituted
+// in. The startup command itself comes from the Panel, but the values of variables can be
+// edited by users, so any value containing characters that cmd.exe treats specially is
+// refused rather than being passed to the shell.
+func renderProcessInvocation(s *Server) (string, error) {
+	var pairs []string
+	for _, e := range s.GetEnvironmentVariables() {
+		parts := strings.SplitN(e, "=", 2)
+		if len(parts) != 2 || parts[0] == "STARTUP" {
+			continue
+		}
+
+		placeholder := "{{" + parts[0] + "}}"
+		if !strings.Contains(s.Invocation, placeholder) {
+			continue
+		}
+
+		if strings.ContainsAny(parts[1], cmdMetacharacters) {
+			return "", errors.Errorf("the value of the %s variable contains characters that are not allowed in the startup command", parts[0])
+		}
+
+		pairs = append(pairs, placeholder, parts[1])
+	}
+
+	// Every placeholder is replaced in a single pass, so a value cannot introduce another
+	// placeholder that is then replaced with a value that was not checked.
+	return strings.NewReplacer(pairs...).Replace(s.Invocation), nil
+}
+
+// The variables from the environment of the daemon that the server process is given, which
+// are needed for most programs to run at all. Nothing else is passed through, since the
+// environment of the daemon can contain secrets such as the token for the Panel.
+var processBaseVariables = []string{"SystemRoot", "PATH", "TEMP"}
+
+func processBaseEnvironment() []string {
+	var env []string
+	for _, k := range processBaseVariables {
+		if v, ok := os.LookupEnv(k); ok {
+			env = append(env, k+"="+v)
+		}
+	}
+
+	return env
+}
+
+// Defines an environment that runs the server process directly on a Windows host. The
+// process and any children it spawns are placed into a Job Object which is used to
+// enforce memory and CPU limits, and to ensure nothing is left running on termination.
+type ProcessEnvironment struct {
+	Server *Server
+
+	mu sync.RWMutex
+
+	cmd   *exec.Cmd
+	stdin io.WriteCloser
+	done  chan struct{}
+	job   windows.Handle
+
+	// Set while the process is running. The process state of the command is written by
+	// the goroutine waiting on it, so this is checked instead.
+	running bool
+
+	exitCode uint32
+
+	polling chan struct{}
+}
+
+// Creates a new process environment for the server.
+func NewProcessEnvironment(server *Server) error {
+	server.Environment = &ProcessEnvironment{
+		Server: server,
+	}
+
+	return nil
+}
+
+var _ Environment = (*ProcessEnvironment)(nil)
+
+// Returns the name of the environment.
+func (p *ProcessEnvironment) Type() string {
+	return "process"
+}
+
+// Returns the path to the console log file for the server.
+func (p *ProcessEnvironment) logPath() string {
+	return filepath.Join(config.Get().System.Data, ".logs", p.Server.Uuid+".log")
+}
+
+// There is nothing to create ahead of time for a process, so as long as the data
+// directory exists the environment exists.
+func (p *ProcessEnvironment) Exists() (bool, error) {
+	if _, err := os.Stat(p.Server.Filesystem.Path()); err != nil {
+		if os.IsNotExist(err) {
+			return false, nil
+		}
+
+		return false, errors.WithStack(err)
+	}
+
+	return true, nil
+}
+
+// Determines if the server process is currently running.
+func (p *ProcessEnvironment) IsRunning() (bool, error) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	return p.running, nil
+}
+
+// Applies the build limits of the server to the job object.
+func (p *ProcessEnvironment) applyResourceLimits() error {
+	p.mu.RLock()
+	job := p.job
+	p.mu.RUnlock()
+
+	if job == 0 {
+		return nil
+	}
+
+	return p.setJobLimits(job)
+}
+
+// Sets the build limits of the server on a job object.
+func (p *ProcessEnvironment) setJobLimits(job windows.Handle) error {
+	info := windows.JOBOBJECT_EXTENDED_LIMIT_INFORMATION{}
+	info.BasicLimitInformation.LimitFlags = windows.JOB_OBJECT_LIMIT_KILL_ON_JOB_CLOSE
+	if p.Server.Build.MemoryLimit > 0 {
+		info.BasicLimitInformation.LimitFlags |= windows.JOB_OBJECT_LIMIT_JOB_MEMORY
+		info.JobMemoryLimit = uintptr((p.Server.Build.MemoryLimit + p.Server.Build.Swap) * 1000000)
+	}
+
+	if _, err := windows.SetInformationJobObject(
+		job,
+		windows.JobObjectExtendedLimitInformation,
+		uintptr(unsafe.Pointer(&info)),
+		uint32(unsafe.Sizeof(info)),
+	); err != nil {
+		return errors.WithStack(err)
+	}
+
+	// The CPU rate is expressed as a percentage of the entire system multiplied by 100,
+	// while the CPU limit of a server is a percentage of a single core.
+	cpu := jobObjectCpuRateControlInformation{}
+	if p.Server.Build.CpuLimit > 0 {
+		cpu.ControlFlags = jobObjectCpuRateControlEnable | jobObjectCpuRateControlHardCap
+		cpu.CpuRate = uint32(math.Min(10000, float64(p.Server.Build.CpuLimit*100)/float64(runtime.NumCPU())))
+	}
+
+	if _, err := windows.SetInformationJobObject(
+		job,
+		windows.JobObjectCpuRateControlInformation,
+		uintptr(unsafe.Pointer(&cpu)),
+		uint32(unsafe.Sizeof(cpu)),
+	); err != nil {
+		return errors.WithStack(err)
+	}
+
+	return nil
+}
+
+// Updates the limits on the job object for a running server.
+func (p *ProcessEnvironment) InSituUpdate() error {
+	return p.applyResourceLimits()
+}
+
+// Syncs the server configuration with the Panel before the process is started.
+func (p *ProcessEnvironment) OnBeforeStart() error {
+	zap.S().Infow("syncing server configuration with Panel", zap.String("server", p.Server.Uuid))
+	if err := p.Server.Sync(); err != nil {
+		return err
+	}
+
+	if err := p.Create(); err != nil {
+		return err
+	}
+
+	if err := p.Server.EnsureAllocationsAvailable(); err != nil {
+		return err
+	}
+
+	return p.Server.RunHooks(PreStartHook)
+}
+
+// Starts the server process inside a new job object and begins piping the output to
+// the server event listeners.
+func (p *ProcessEnvironment) Start() error {
+	sawError := false
+	defer func() {
+		if sawError {
+			p.Server.SetState(ProcessOfflineState)
+		}
+	}()
+
+	if p.Server.Suspended {
+		return &suspendedError{}
+	}
+
+	if running, _ := p.IsRunning(); running {
+		p.Server.SetState(ProcessRunningState)
+
+		return nil
+	}
+
+	p.Server.SetState(ProcessStartingState)
+	sawError = true
+
+	if err := p.OnBeforeStart(); err != nil {
+		return errors.WithStack(err)
+	}
+
+	p.Server.UpdateConfigurationFiles()
+
+	if err := os.MkdirAll(filepath.Dir(p.logPath()), 0755); err != nil {
+		return errors.WithStack(err)
+	}
+
+	logFile, err := os.OpenFile(p.logPath(), os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	invocation, err := renderProcessInvocation(p.Server)
+	if err != nil {
+		logFile.Close()
+		return err
+	}
+
+	job, err := windows.CreateJobObject(nil, nil)
+	if err != nil {
+		logFile.Close()
+		return errors.WithStack(err)
+	}
+
+	cmd := exec.Command("cmd.exe", "/C", invocation)
+	cmd.Dir = p.Server.Filesystem.Path()
+	cmd.Env = append(processBaseEnvironment(), p.Server.GetEnvironmentVariables()...)
+
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		logFile.Close()
+		windows.CloseHandle(job)
+		return errors.WithStack(err)
+	}
+
+	pr, pw := io.Pipe()
+	cmd.Stdout = io.MultiWriter(logFile, pw)
+	cmd.Stderr = cmd.Stdout
+
+	// The process is created suspended so that it cannot run, or create any processes of
+	// its own, until it is in the job and the limits of the job are in place.
+	cmd.SysProcAttr = &syscall.SysProcAttr{CreationFlags: windows.CREATE_SUSPENDED}
+
+	if err := cmd.Start(); err != nil {
+		logFile.Close()
+		windows.CloseHandle(job)
+		return errors.WithStack(err)
+	}
+
+	// Assign the process to the job so that the limits apply to it and every process it
+	// goes on to create.
+	handle, err := windows.OpenProcess(windows.PROCESS_SET_QUOTA|windows.PROCESS_TERMINATE, false, uint32(cmd.Process.Pid))
+	if err == nil {
+		err = windows.AssignProcessToJobObject(job, handle)
+		windows.CloseHandle(handle)
+	}
+
+	if err == nil {
+		err = p.setJobLimits(job)
+	}
+
+	if err == nil {
+		err = resumeProcess(uint32(cmd.Process.Pid))
+	}
+
+	if err != nil {
+		cmd.Process.Kill()
+		cmd.Wait()
+		logFile.Close()
+		windows.CloseHandle(job)
+		return errors.WithStack(err)
+	}
+
+	done := make(chan struct{})
+
+	p.mu.Lock()
+	p.cmd = cmd
+	p.stdin = stdin
+	p.done = done
+	p.job = job
+	p.running = true
+	p.mu.Unlock()
+
+	go func() {
+		s := bufio.NewScanner(pr)
+		for s.Scan() {
+			p.Server.Events().Publish(ConsoleOutputEvent, s.Text())
+		}
+	}()
+
+	go func() {
+		err := cmd.Wait()
+		pw.Close()
+		logFile.Close()
+
+		var code uint32
+		if exitErr, ok := err.(*exec.ExitError); ok {
+			if status, ok := exitErr.Sys().(syscall.WaitStatus); ok {
+				code = uint32(status.ExitStatus())
+			}
+		}
+
+		p.mu.Lock()
+		p.exitCode = code
+		p.running = false
+		windows.CloseHandle(p.job)
+		p.job = 0
+		p.mu.Unlock()
+
+		close(done)
+		p.Server.SetState(ProcessOfflineState)
+	}()
+
+	sawError = false
+
+	go func() {
+		if err := p.EnableResourcePolling(); err != nil {
+			zap.S().Warnw("failed to enable resource polling on server", zap.String("server", p.Server.Uuid), zap.Error(err))
+		}
+	}()
+
+	return nil
+}
+
+// Resumes the main thread of a process that was created suspended. The handle to the
+// thread is not kept when Go starts a process, so it is found using the process ID. A
+// suspended process has not had the chance to create any other threads yet.
+func resumeProcess(pid uint32) error {
+	snapshot, err := windows.CreateToolhelp32Snapshot(windows.TH32CS_SNAPTHREAD, 0)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	defer windows.CloseHandle(snapshot)
+
+	entry := windows.ThreadEntry32{}
+	entry.Size = uint32(unsafe.Sizeof(entry))
+
+	for err = windows.Thread32First(snapshot, &entry); err == nil; err = windows.Thread32Next(snapshot, &entry) {
+		if entry.OwnerProcessID != pid {
+			continue
+		}
+
+		thread, err := windows.OpenThread(windows.THREAD_SUSPEND_RESUME, false, entry.ThreadID)
+		if err != nil {
+			return errors.WithStack(err)
+		}
+
+		_, err = windows.ResumeThread(thread)
+		windows.CloseHandle(thread)
+
+		return errors.WithStack(err)
+	}
+
+	return errors.New("could not find the main thread of the server process")
+}
+
+// Stops the server process. Windows has no equivalent to a graceful termination signal
+// so unless a stop command is configured the process is terminated.
+func (p *ProcessEnvironment) Stop() error {
+	stop := p.Server.processConfiguration.Stop
+
+	p.Server.SetState(ProcessStoppingState)
+	if stop.Type == api.ProcessStopCommand {
+		return p.SendCommand(stop.Value)
+	}
+
+	return p.Terminate(os.Kill)
+}
+
+// Stops the server and waits for the process to exit.
+func (p *ProcessEnvironment) WaitForStop(seconds int, terminate bool) error {
+	if p.Server.GetState() == ProcessOfflineState {
+		return nil
+	}
+
+	if err := p.Stop(); err != nil {
+		return errors.WithStack(err)
+	}
+
+	p.mu.RLock()
+	done := p.done
+	p.mu.RUnlock()
+
+	if done == nil {
+		return nil
+	}
+
+	select {
+	case <-done:
+		return nil
+	case <-time.After(time.Duration(seconds) * time.Second):
+		if terminate {
+			return p.Terminate(os.Kill)
+		}
+
+		return errors.New("timed out waiting for server process to stop")
+	}
+}
+
+// Terminates every process in the job object. Signals are not supported on Windows so
+// the signal passed through is ignored.
+func (p *ProcessEnvironment) Terminate(signal os.Signal) error {
+	if running, _ := p.IsRunning(); !running {
+		return nil
+	}
+
+	p.Server.SetState(ProcessStoppingState)
+
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	if p.job != 0 {
+		return errors.WithStack(windows.TerminateJobObject(p.job, 1))
+	}
+
+	return p.cmd.Process.Kill()
+}
+
+// Terminates the running process. There is no other state to clean up.
+func (p *ProcessEnvironment) Destroy() error {
+	p.Server.SetState(ProcessStoppingState)
+
+	return p.Terminate(os.Kill)
+}
+
+// Returns the exit code of the last process. Exceeding the job memory limit causes
+// allocations to fail rather than the process being killed.
+func (p *ProcessEnvironment) ExitState() (uint32, bool, error) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	return p.exitCode, false, nil
+}
+
+// Ensures the data directory for the server exists.
+func (p *ProcessEnvironment) Create() error {
+	return p.Server.Filesystem.EnsureDataDirectory()
+}
+
+// Output is piped from the moment the process starts, so there is nothing to attach to.
+func (p *ProcessEnvironment) Attach() error {
+	if running, _ := p.IsRunning(); !running {
+		return errors.New("cannot attach to a server with no running process")
+	}
+
+	return nil
+}
+
+// Output is piped from the moment the process starts.
+func (p *ProcessEnvironment) FollowConsoleOutput() error {
+	return nil
+}
+
+// Writes the command to the stdin of the running process.
+func (p *ProcessEnvironment) SendCommand(c string) error {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	if p.stdin == nil || !p.running {
+		return errors.New("attempting to send command to non-running instance")
+	}
+
+	_, err := p.stdin.Write([]byte(c + "\r\n"))
+
+	return errors.WithStack(err)
+}
+
+// Reads the last len bytes of the console log for the server.
+func (p *ProcessEnvironment) Readlog(len int64) ([]string, error) {
+	return readLogLines(p.logPath(), len)
+}
+
+// Polls the job object accounting information once a second to determine the CPU usage
+// of the server, and the working set of the main process for the memory usage.
+func (p *ProcessEnvironment) EnableResourcePolling() error {
+	if p.Server.GetState() == ProcessOfflineState {
+		return errors.New("cannot enable resource polling on a server that is not running")
+	}
+
+	stop := make(chan struct{})
+
+	p.mu.Lock()
+	if p.polling != nil {
+		close(p.polling)
+	}
+	p.polling = stop
+	p.mu.Unlock()
+
+	go func(s *Server) {
+		ticker := time.NewTicker(time.Second)
+		defer ticker.Stop()
+
+		var lastCpu int64
+		var lastTime time.Time
+
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+				if s.GetState() == ProcessOfflineState {
+					p.DisableResourcePolling()
+					return
+				}
+
+				p.mu.RLock()
+				job := p.job
+				var pid int
+				if p.cmd != nil && p.cmd.Process != nil {
+					pid = p.cmd.Process.Pid
+				}
+				p.mu.RUnlock()
+
+				if job == 0 {
+					continue
+				}
+
+				acct := jobObjectBasicAccountingInformation{}
+				r, _, _ := procQueryInformationJobObject.Call(
+					uintptr(job),
+					uintptr(1), // JobObjectBasicAccountingInformation
+					uintptr(unsafe.Pointer(&acct)),
+					unsafe.Sizeof(acct),
+					0,
+				)
+
+				if r != 0 {
+					// Accounting times are in 100ns intervals.
+					total := acct.TotalUserTime + acct.TotalKernelTime
+					now := time.Now()
+					if !lastTime.IsZero() {
+						elapsed := now.Sub(lastTime).Nanoseconds() / 100
+						if elapsed > 0 {
+							cpu := math.Round(float64(total-lastCpu)/float64(elapsed)*100*1000) / 1000
+							s.UpdateResources(func(ru *ResourceUsage) {
+								ru.CpuAbsolute = cpu
+							})
+						}
+					}
+
+					lastCpu = total
+					lastTime = now
+				}
+
+				if pid != 0 {
+					if h, err := windows.OpenProcess(windows.PROCESS_QUERY_LIMITED_INFORMATION, false, uint32(pid)); err == nil {
+						mem := processMemoryCounters{}
+						mem.Cb = uint32(unsafe.Sizeof(mem))
+						if r, _, _ := procGetProcessMemoryInfo.Call(uintptr(h), uintptr(unsafe.Pointer(&mem)), uintptr(mem.Cb)); r != 0 {
+							s.UpdateResources(func(ru *ResourceUsage) {
+								ru.Memory = uint64(mem.WorkingSetSize)
+							})
+						}
+						windows.CloseHandle(h)
+					}
+				}
+
+				limit := uint64(s.Build.MemoryLimit * 1000000)
+				s.UpdateResources(func(ru *ResourceUsage) {
+					ru.MemoryLimit = limit
+				})
+				s.Filesystem.HasSpaceAvailable()
+
+				b, _ := json.Marshal(s.GetResources())
+				s.Events().Publish(StatsEvent, string(b))
+			}
+		}
+	}(p.Server)
+
+	return nil
+}
+
+// Stops the resource polling loop and resets the usage values for the server.
+func (p *ProcessEnvironment) DisableResourcePolling() error {
+	p.mu.Lock()
+	if p.polling != nil {
+		close(p.polling)
+		p.polling = nil
+	}
+	p.mu.Unlock()
+
+	p.Server.UpdateResources(func(ru *ResourceUsage) {
+		ru.CpuAbsolute = 0
+		ru.Memory = 0
+	})
+
+	return nil
+}
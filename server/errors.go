@@ -1,5 +1,7 @@
 package server
 
+import "fmt"
+
 type suspendedError struct {
 }
 
@@ -17,7 +19,7 @@ type crashTooFrequent struct {
 }
 
 func (e *crashTooFrequent) Error() string {
-	return "server has crashed too soon after the last detected crash"
+	return "server has crashed too many times in a row to be restarted again"
 }
 
 func IsTooFrequentCrashError(err error) bool {
@@ -37,4 +39,121 @@ func IsServerDoesNotExistError(err error) bool {
 	_, ok := err.(*serverDoesNotExist)
 
 	return ok
-}
\ No newline at end of file
+}
+
+type allocationConflict struct {
+	ip     string
+	port   int
+	server string
+}
+
+func (e *allocationConflict) Error() string {
+	if e.server == "" {
+		return fmt.Sprintf("allocation %s:%d is already in use on the host system", e.ip, e.port)
+	}
+
+	return fmt.Sprintf("allocation %s:%d is already assigned to server %s", e.ip, e.port, e.server)
+}
+
+func IsAllocationConflictError(err error) bool {
+	_, ok := err.(*allocationConflict)
+
+	return ok
+}
+
+type trashRestoreConflict struct {
+	path string
+}
+
+func (e *trashRestoreConflict) Error() string {
+	return fmt.Sprintf("cannot restore trash item, a file already exists at %s", e.path)
+}
+
+func IsTrashRestoreConflictError(err error) bool {
+	_, ok := err.(*trashRestoreConflict)
+
+	return ok
+}
+
+type macroNotFound struct {
+	name string
+}
+
+func (e *macroNotFound) Error() string {
+	return fmt.Sprintf("no command macro named \"%s\" exists for this server", e.name)
+}
+
+func IsMacroNotFoundError(err error) bool {
+	_, ok := err.(*macroNotFound)
+
+	return ok
+}
+
+type macroValidationError struct {
+	message string
+}
+
+func (e *macroValidationError) Error() string {
+	return e.message
+}
+
+func IsMacroValidationError(err error) bool {
+	_, ok := err.(*macroValidationError)
+
+	return ok
+}
+
+type commandDenied struct {
+	command string
+}
+
+func (e *commandDenied) Error() string {
+	return fmt.Sprintf("the command \"%s\" is not allowed to be sent to this server", e.command)
+}
+
+func IsCommandDeniedError(err error) bool {
+	_, ok := err.(*commandDenied)
+
+	return ok
+}
+
+type terminalSizeInvalid struct {
+}
+
+func (e *terminalSizeInvalid) Error() string {
+	return "terminal size must be between 1 and 1000 columns and rows"
+}
+
+func IsTerminalSizeInvalidError(err error) bool {
+	_, ok := err.(*terminalSizeInvalid)
+
+	return ok
+}
+
+type execUnavailable struct {
+	reason string
+}
+
+func (e *execUnavailable) Error() string {
+	return "cannot start a process in the server: " + e.reason
+}
+
+func IsExecUnavailableError(err error) bool {
+	_, ok := err.(*execUnavailable)
+
+	return ok
+}
+
+type versionNotFound struct {
+	id string
+}
+
+func (e *versionNotFound) Error() string {
+	return fmt.Sprintf("no version \"%s\" has been saved for the file", e.id)
+}
+
+func IsVersionNotFoundError(err error) bool {
+	_, ok := err.(*versionNotFound)
+
+	return ok
+}
@@ -0,0 +1,96 @@
+package server
+
+import (
+	"github.com/buger/jsonparser"
+	"github.com/pterodactyl/wings/config"
+	"github.com/pterodactyl/wings/pubsub"
+	"go.uber.org/zap"
+	"strings"
+)
+
+// The number of events that can be waiting to be published before new events are dropped.
+const eventSinkBuffer = 256
+
+// Returns every topic that can be published to the event sink.
+func eventSinkTopics() []string {
+	return append(append([]string{}, NodeEventTopics...), StatsEvent)
+}
+
+// Publishes events from the node event bus to the configured NATS or Redis server until
+// the daemon is stopped. Events are dropped rather than delaying the rest of the daemon if
+// the server cannot keep up or cannot be reached.
+func StartEventSink() {
+	cfg := config.Get().System.EventSink
+	if cfg.Driver == "" {
+		return
+	}
+
+	p, err := pubsub.New(cfg.Driver, cfg.Address, cfg.Username, cfg.Password)
+	if err != nil {
+		zap.S().Errorw("failed to configure event sink", zap.Error(err))
+		return
+	}
+
+	topics := cfg.Events
+	if len(topics) == 0 {
+		topics = eventSinkTopics()
+	}
+
+	in := make(chan Event)
+	out := make(chan Event, eventSinkBuffer)
+
+	for _, t := range topics {
+		NodeEvents().Subscribe(t, in)
+	}
+
+	go func() {
+		var dropped int
+		for e := range in {
+			select {
+			case out <- e:
+				if dropped > 0 {
+					zap.S().Warnw("dropped events that could not be published to the event sink", zap.Int("count", dropped))
+					dropped = 0
+				}
+			default:
+				dropped++
+			}
+		}
+	}()
+
+	go func() {
+		var failing bool
+		for e := range out {
+			if err := p.Publish(eventSinkChannel(cfg.Channel, e), []byte(e.Data)); err != nil {
+				if !failing {
+					zap.S().Warnw("failed to publish event to event sink", zap.String("driver", cfg.Driver), zap.Error(err))
+				}
+				failing = true
+
+				continue
+			}
+
+			if failing {
+				zap.S().Infow("publishing events to event sink again", zap.String("driver", cfg.Driver))
+				failing = false
+			}
+		}
+	}()
+
+	zap.S().Infow("publishing events to event sink", zap.String("driver", cfg.Driver), zap.String("address", cfg.Address))
+}
+
+// Returns the channel that an event is published to using the configured template.
+func eventSinkChannel(template string, e Event) string {
+	topic := e.Topic
+	if i := strings.Index(topic, ":"); i != -1 {
+		topic = topic[:i]
+	}
+
+	server, _ := jsonparser.GetString([]byte(e.Data), "server")
+
+	return strings.NewReplacer(
+		"{event}", strings.Replace(topic, " ", "_", -1),
+		"{server}", server,
+	).Replace(template)
+}
@@ -9,12 +9,16 @@ import (
 // Defines all of the possible output events for a server.
 // noinspection GoNameStartsWithPackageName
 const (
-	DaemonMessageEvent   = "daemon message"
-	InstallOutputEvent   = "install output"
-	ConsoleOutputEvent   = "console output"
-	StatusEvent          = "status"
-	StatsEvent           = "stats"
-	BackupCompletedEvent = "backup completed"
+	DaemonMessageEvent    = "daemon message"
+	InstallOutputEvent    = "install output"
+	ConsoleOutputEvent    = "console output"
+	StatusEvent           = "status"
+	StatsEvent            = "stats"
+	BackupCompletedEvent  = "backup completed"
+	QueryEvent            = "query"
+	FileScanEvent         = "file scan"
+	HealthEvent           = "health"
+	TransferProgressEvent = "transfer progress"
 )
 
 type Event struct {
@@ -25,6 +29,10 @@ type Event struct {
 type EventBus struct {
 	subscribers map[string][]chan Event
 	mu          sync.Mutex
+
+	// The UUID of the server that owns this bus, if any. Stats published for a server are
+	// also published to the node event bus so that they can be followed for every server.
+	owner string
 }
 
 // Returns the server's emitter instance.
@@ -32,6 +40,7 @@ func (s *Server) Events() *EventBus {
 	if s.emitter == nil {
 		s.emitter = &EventBus{
 			subscribers: map[string][]chan Event{},
+			owner:       s.Uuid,
 		}
 	}
 
@@ -40,6 +49,10 @@ func (s *Server) Events() *EventBus {
 
 // Publish data to a given topic.
 func (e *EventBus) Publish(topic string, data string) {
+	if e.owner != "" && topic == StatsEvent {
+		PublishNodeEvent(StatsEvent, e.owner, json.RawMessage(data))
+	}
+
 	e.mu.Lock()
 	defer e.mu.Unlock()
 
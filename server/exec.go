@@ -0,0 +1,211 @@
+package server
+
+import (
+	"go.uber.org/zap"
+	"io"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// The maximum number of bytes of input and output recorded for each process started by a
+// user. Anything past this is dropped from the recording, but is still counted.
+const maxSessionRecording = 64 * 1024
+
+// The options used to start a process inside of a server, such as a shell opened by a user
+// over SSH.
+type ExecOptions struct {
+	// The command to run and its arguments.
+	Command []string
+
+	// If set, the process is given a terminal with the given number of columns and rows.
+	Tty    bool
+	Width  uint
+	Height uint
+
+	// Additional environment variables for the process, such as TERM.
+	Env []string
+
+	// Identifies who started the process and how, which is recorded when it starts and exits.
+	User   string
+	Ip     string
+	Source string
+}
+
+// A process started inside of a server by a user.
+type ExecProcess interface {
+	// Copies input to the process and its output back until the process exits. Without a
+	// terminal the output of the process is split between stdout and stderr, otherwise
+	// everything is written to stdout.
+	Stream(stdin io.Reader, stdout io.Writer, stderr io.Writer) error
+
+	// Changes the size of the terminal given to the process, in columns and rows.
+	Resize(width uint, height uint) error
+
+	// Returns the exit code of the process once it has exited.
+	ExitCode() (int, error)
+}
+
+// Implemented by environments that can start additional processes alongside the server
+// process.
+type execer interface {
+	Exec(opts ExecOptions) (ExecProcess, error)
+}
+
+// Starts a process inside of the server for a user, running as the same user as the server
+// process. The server must be running. Every process started is logged and published to the
+// node event bus when it starts and when it exits, so that access to servers can be audited.
+func (s *Server) Exec(opts ExecOptions) (ExecProcess, error) {
+	e, ok := s.Environment.(execer)
+	if !ok {
+		return nil, &execUnavailable{reason: "the environment does not support it"}
+	}
+
+	if s.GetState() != ProcessRunningState {
+		return nil, &execUnavailable{reason: "the server is not running"}
+	}
+
+	if opts.Tty && (opts.Width == 0 || opts.Height == 0 || opts.Width > maxTerminalSize || opts.Height > maxTerminalSize) {
+		opts.Width, opts.Height = 80, 24
+	}
+
+	p, err := e.Exec(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	command := strings.Join(opts.Command, " ")
+
+	zap.S().Infow(
+		"started process in server",
+		zap.String("server", s.Uuid),
+		zap.String("user", opts.User),
+		zap.String("ip", opts.Ip),
+		zap.String("source", opts.Source),
+		zap.String("command", command),
+	)
+
+	PublishNodeEvent(ExecStartedEvent, s.Uuid, map[string]interface{}{
+		"user":    opts.User,
+		"ip":      opts.Ip,
+		"source":  opts.Source,
+		"command": command,
+		"tty":     opts.Tty,
+	})
+
+	return &auditedProcess{ExecProcess: p, server: s, opts: opts, started: time.Now()}, nil
+}
+
+// Records when a process started by a user exits, along with how long it ran for, the
+// amount of input and output sent to and from it and a recording of the session.
+type auditedProcess struct {
+	ExecProcess
+
+	server  *Server
+	opts    ExecOptions
+	started time.Time
+}
+
+func (p *auditedProcess) Stream(stdin io.Reader, stdout io.Writer, stderr io.Writer) error {
+	rec := &sessionRecorder{}
+
+	in := &countingReader{Reader: io.TeeReader(stdin, rec)}
+	out := &countingWriter{Writer: io.MultiWriter(stdout, rec)}
+	errOut := &countingWriter{Writer: io.MultiWriter(stderr, rec)}
+
+	err := p.ExecProcess.Stream(in, out, errOut)
+
+	code, cerr := p.ExitCode()
+	if cerr != nil {
+		code = -1
+	}
+
+	zap.S().Infow(
+		"process in server exited",
+		zap.String("server", p.server.Uuid),
+		zap.String("user", p.opts.User),
+		zap.String("ip", p.opts.Ip),
+		zap.Int("exit_code", code),
+		zap.Duration("duration", time.Since(p.started)),
+	)
+
+	PublishNodeEvent(ExecEndedEvent, p.server.Uuid, map[string]interface{}{
+		"user":      p.opts.User,
+		"ip":        p.opts.Ip,
+		"source":    p.opts.Source,
+		"command":   strings.Join(p.opts.Command, " "),
+		"exit_code": code,
+		"duration":  int64(time.Since(p.started).Seconds()),
+		"bytes_in":  atomic.LoadInt64(&in.n),
+		"bytes_out": atomic.LoadInt64(&out.n) + atomic.LoadInt64(&errOut.n),
+		"recording": rec.String(),
+		"truncated": rec.Truncated(),
+	})
+
+	return err
+}
+
+// Records the input and output of a session in the order it is sent, up to the maximum size
+// of a recording. Writes never fail, so a full recording does not interrupt the session.
+type sessionRecorder struct {
+	mu        sync.Mutex
+	buf       []byte
+	truncated bool
+}
+
+func (r *sessionRecorder) Write(b []byte) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	n := len(b)
+	if left := maxSessionRecording - len(r.buf); n > left {
+		b = b[:left]
+		r.truncated = true
+	}
+
+	r.buf = append(r.buf, b...)
+
+	return n, nil
+}
+
+func (r *sessionRecorder) String() string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return string(r.buf)
+}
+
+// Returns true if anything was left out of the recording because it was full.
+func (r *sessionRecorder) Truncated() bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.truncated
+}
+
+// Counts the bytes passing through a stream. Input is copied to the process in the
+// background, so the count may still be changing when it is read.
+type countingReader struct {
+	io.Reader
+	n int64
+}
+
+func (r *countingReader) Read(b []byte) (int, error) {
+	n, err := r.Reader.Read(b)
+	atomic.AddInt64(&r.n, int64(n))
+
+	return n, err
+}
+
+type countingWriter struct {
+	io.Writer
+	n int64
+}
+
+func (w *countingWriter) Write(b []byte) (int, error) {
+	n, err := w.Writer.Write(b)
+	atomic.AddInt64(&w.n, int64(n))
+
+	return n, err
+}
@@ -0,0 +1,98 @@
+package server
+
+import (
+	"fmt"
+	"go.uber.org/zap"
+)
+
+// The actions that can be taken when the server process exits with a specific code.
+const (
+	// Starts the server again without treating the exit as a crash. The restart is limited
+	// and delayed in the same way as restarts after a crash.
+	ExitActionRestart = "restart"
+	// Leaves the server offline, without treating the exit as a crash.
+	ExitActionStop = "stop"
+	// Runs a command on the host, then continues with the crash detection.
+	ExitActionHook = "hook"
+	// Sends a command to the server once it has next started, then continues with the
+	// crash detection.
+	ExitActionCommand = "command"
+)
+
+// Defines what happens when the server process exits with a specific code. This allows
+// processes that use their exit code to request something from the daemon, such as the
+// many wrappers that exit with a code of 2 when they want to be restarted.
+type ExitCodeAction struct {
+	Code   uint32 `json:"code" yaml:"code"`
+	Action string `json:"action" yaml:"action"`
+
+	// The command run on the host for the "hook" action, or sent to the server for the
+	// "command" action.
+	Command string `json:"command" yaml:"command"`
+
+	// The number of seconds the command for the "hook" action is allowed to run for.
+	Timeout int `default:"60" json:"timeout" yaml:"timeout"`
+}
+
+// Returns the action defined for an exit code, if there is one.
+func (s *Server) exitCodeAction(code uint32) (ExitCodeAction, bool) {
+	for _, a := range s.ExitCodes {
+		if a.Code == code {
+			return a, true
+		}
+	}
+
+	return ExitCodeAction{}, false
+}
+
+// Runs the action defined for the exit code of the server process. Returns true if the
+// exit was handled by the action, in which case the crash detection is skipped.
+func (s *Server) handleExitCode(code uint32) (bool, error) {
+	a, ok := s.exitCodeAction(code)
+	if !ok {
+		return false, nil
+	}
+
+	zap.S().Debugw("running action for server exit code", zap.String("server", s.Uuid), zap.Uint32("code", code), zap.String("action", a.Action))
+
+	switch a.Action {
+	case ExitActionRestart:
+		s.PublishConsoleOutputFromDaemon(fmt.Sprintf("Server process exited with code %d, restarting as configured.", code))
+
+		return true, s.restartAfterCrash()
+	case ExitActionStop:
+		s.PublishConsoleOutputFromDaemon(fmt.Sprintf("Server process exited with code %d, leaving it stopped as configured.", code))
+
+		return true, nil
+	case ExitActionHook:
+		s.PublishConsoleOutputFromDaemon(fmt.Sprintf("Running hook for exit code %d: %s", code, a.Command))
+
+		if err := s.runHook(Hook{Command: a.Command, Timeout: a.Timeout}); err != nil {
+			s.PublishConsoleOutputFromDaemon(fmt.Sprintf("Hook failed: %s", err.Error()))
+
+			zap.S().Warnw("failed to run hook for server exit code", zap.String("server", s.Uuid), zap.Uint32("code", code), zap.Error(err))
+		}
+	case ExitActionCommand:
+		s.Lock()
+		s.bootCommands = append(s.bootCommands, a.Command)
+		s.Unlock()
+	default:
+		zap.S().Warnw("unknown action defined for server exit code", zap.String("server", s.Uuid), zap.Uint32("code", code), zap.String("action", a.Action))
+	}
+
+	return false, nil
+}
+
+// Sends the commands queued by exit code actions to the server now that it is running.
+func (s *Server) sendBootCommands() {
+	s.Lock()
+	commands := s.bootCommands
+	s.bootCommands = nil
+	s.Unlock()
+
+	for _, c := range commands {
+		if err := s.Environment.SendCommand(c); err != nil {
+			zap.S().Warnw("failed to send queued command to server", zap.String("server", s.Uuid), zap.Error(err))
+		}
+	}
+}
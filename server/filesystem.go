@@ -3,6 +3,7 @@ package server
 import (
 	"bufio"
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"github.com/gabriel-vasile/mimetype"
@@ -12,8 +13,8 @@ import (
 	"io"
 	"io/ioutil"
 	"os"
-	"path"
 	"path/filepath"
+	"runtime"
 	"sort"
 	"strconv"
 	"strings"
@@ -30,6 +31,9 @@ type Filesystem struct {
 	Server *Server
 
 	Configuration *config.SystemConfiguration
+
+	// Tracks the disk space used by the server using filesystem notifications.
+	usage *usageTracker
 }
 
 // Returns the root path that contains all of a server's data.
@@ -37,6 +41,20 @@ func (fs *Filesystem) Path() string {
 	return filepath.Join(fs.Configuration.Data, fs.Server.Uuid)
 }
 
+// Determines if the given path is within the root directory for the server. Windows
+// paths are case-insensitive, and EvalSymlinks will return the casing used on the
+// disk, so the comparison must be as well.
+func (fs *Filesystem) isInRoot(p string) bool {
+	root := fs.Path()
+	if runtime.GOOS == "windows" {
+		p, root = strings.ToLower(p), strings.ToLower(root)
+	}
+
+	// Compare against the root with a trailing separator, otherwise a directory such as
+	// "/srv/daemon-data/abc-backup" would be considered inside of "/srv/daemon-data/abc".
+	return p == root || strings.HasPrefix(p, root+string(filepath.Separator))
+}
+
 // Normalizes a directory being passed in to ensure the user is not able to escape
 // from their data directory. After normalization if the directory is still within their home
 // path it is returned. If they managed to "escape" an error will be returned.
@@ -45,6 +63,7 @@ func (fs *Filesystem) Path() string {
 // either gets ported into this application, or is able to make use of this package.
 func (fs *Filesystem) SafePath(p string) (string, error) {
 	var nonExistentPathResolution string
+	var try string
 
 	// Calling filpath.Clean on the joined directory will resolve it to the absolute path,
 	// removing any ../ type of resolution arguments, and leaving us with a direct path link.
@@ -61,15 +80,14 @@ func (fs *Filesystem) SafePath(p string) (string, error) {
 	} else if os.IsNotExist(err) {
 		// The requested directory doesn't exist, so at this point we need to iterate up the
 		// path chain until we hit a directory that _does_ exist and can be validated.
-		parts := strings.Split(filepath.Dir(r), "/")
+		parts := strings.Split(filepath.Dir(r), string(filepath.Separator))
 
-		var try string
 		// Range over all of the path parts and form directory pathings from the end
 		// moving up until we have a valid resolution or we run out of paths to try.
 		for k := range parts {
-			try = strings.Join(parts[:(len(parts) - k)], "/")
+			try = strings.Join(parts[:(len(parts)-k)], string(filepath.Separator))
 
-			if !strings.HasPrefix(try, fs.Path()) {
+			if !fs.isInRoot(try) {
 				break
 			}
 
@@ -84,10 +102,17 @@ func (fs *Filesystem) SafePath(p string) (string, error) {
 	// If the new path doesn't start with their root directory there is clearly an escape
 	// attempt going on, and we should NOT resolve this path for them.
 	if nonExistentPathResolution != "" {
-		if !strings.HasPrefix(nonExistentPathResolution, fs.Path()) {
+		if !fs.isInRoot(nonExistentPathResolution) {
 			return "", InvalidPathResolution
 		}
 
+		// The first part of the path that could not be resolved may be a dangling symlink
+		// rather than something that does not exist at all. Writing to it would create
+		// whatever it points to, so make sure that target is within the root as well.
+		if err := fs.checkDanglingSymlink(r, try, nonExistentPathResolution, 0); err != nil {
+			return "", err
+		}
+
 		// If the nonExistentPathResolution variable is not empty then the initial path requested
 		// did not exist and we looped through the pathway until we found a match. At this point
 		// we've confirmed the first matched pathway exists in the root server directory, so we
@@ -98,13 +123,127 @@ func (fs *Filesystem) SafePath(p string) (string, error) {
 	// If the requested directory from EvalSymlinks begins with the server root directory go
 	// ahead and return it. If not we'll return an error which will block any further action
 	// on the file.
-	if strings.HasPrefix(p, fs.Path()) {
+	if fs.isInRoot(p) {
 		return p, nil
 	}
 
 	return "", InvalidPathResolution
 }
 
+// Checks the first component of the requested path below the deepest directory that could
+// be resolved. If it is a symlink pointing to a location that does not exist yet, the target
+// of the link must also resolve to a location within the server root.
+func (fs *Filesystem) checkDanglingSymlink(requested string, existing string, resolved string, depth int) error {
+	// Avoid following a chain of dangling links forever.
+	if depth > 16 {
+		return InvalidPathResolution
+	}
+
+	rel, err := filepath.Rel(existing, requested)
+	if err != nil || rel == "." {
+		return nil
+	}
+
+	next := filepath.Join(resolved, strings.Split(rel, string(filepath.Separator))[0])
+
+	st, err := os.Lstat(next)
+	if err != nil || st.Mode()&os.ModeSymlink == 0 {
+		return nil
+	}
+
+	target, err := os.Readlink(next)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	if !filepath.IsAbs(target) {
+		target = filepath.Join(resolved, target)
+	}
+	target = filepath.Clean(target)
+
+	if !fs.isInRoot(target) {
+		return InvalidPathResolution
+	}
+
+	// The target is within the root, but may itself be a link, or be within a directory
+	// that is a link, leading somewhere else.
+	if t, err := filepath.EvalSymlinks(target); err == nil {
+		if !fs.isInRoot(t) {
+			return InvalidPathResolution
+		}
+
+		return nil
+	}
+
+	for p := filepath.Dir(target); fs.isInRoot(p); p = filepath.Dir(p) {
+		if t, err := filepath.EvalSymlinks(p); err == nil {
+			if !fs.isInRoot(t) {
+				return InvalidPathResolution
+			}
+
+			return fs.checkDanglingSymlink(target, p, t, depth+1)
+		}
+	}
+
+	return InvalidPathResolution
+}
+
+// Returns the path to a file without resolving the final component of it if that is a
+// symlink, only the directory containing it is resolved and validated. This should be
+// used for operations that act on a symlink itself rather than where it points, such as
+// deleting or renaming it.
+func (fs *Filesystem) SafeLinkPath(p string) (string, error) {
+	r := filepath.Clean(filepath.Join(fs.Path(), strings.TrimPrefix(p, fs.Path())))
+	if r == fs.Path() {
+		return r, nil
+	}
+
+	dir, err := fs.SafePath(filepath.Dir(r))
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(dir, filepath.Base(r)), nil
+}
+
+// Opens a file within the server data directory. The path is validated and then opened
+// one component at a time without following any symlinks, so a symlink swapped into the
+// path between it being validated and the file being opened cannot be used to escape the
+// root. Files with more than one hard link are refused, since the other links may be
+// outside of the root.
+func (fs *Filesystem) OpenFile(p string, flag int, perm os.FileMode) (*os.File, error) {
+	cleaned, err := fs.SafePath(p)
+	if err != nil {
+		return nil, err
+	}
+
+	// The file is only truncated once it is known to not be a hard link.
+	f, err := openBeneath(fs.Path(), cleaned, flag&^os.O_TRUNC, perm)
+	if err != nil {
+		return nil, err
+	}
+
+	st, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, errors.WithStack(err)
+	}
+
+	if err := checkHardLinks(st); err != nil {
+		f.Close()
+		return nil, err
+	}
+
+	if flag&os.O_TRUNC != 0 && st.Mode().IsRegular() {
+		if err := f.Truncate(0); err != nil {
+			f.Close()
+			return nil, errors.WithStack(err)
+		}
+	}
+
+	return f, nil
+}
+
 // Determines if the directory a file is trying to be added to has enough space available
 // for the file to be written to.
 //
@@ -119,7 +258,9 @@ func (fs *Filesystem) HasSpaceAvailable() bool {
 	}
 
 	var size int64
-	if x, exists := fs.Server.Cache.Get("disk_used"); exists {
+	if tracked, ok := fs.TrackedUsage(); ok {
+		size = tracked
+	} else if x, exists := fs.Server.Cache.Get("disk_used"); exists {
 		size = x.(int64)
 	}
 
@@ -131,13 +272,22 @@ func (fs *Filesystem) HasSpaceAvailable() bool {
 		if size, err := fs.DirectorySize("/"); err != nil {
 			zap.S().Warnw("failed to determine directory size", zap.String("server", fs.Server.Uuid), zap.Error(err))
 		} else {
-			fs.Server.Cache.Set("disk_used", size, time.Second * 60)
+			fs.Server.Cache.Set("disk_used", size, time.Second*60)
 		}
 	}
 
+	// If the server is over its limit try to make room by clearing out items in the trash,
+	// starting with the ones that were deleted the longest time ago.
+	if (size/1000.0/1000.0) > space && fs.Configuration.Trash.Enabled {
+		size = fs.reclaimTrashSpace(size, space*1000*1000)
+		fs.Server.Cache.Set("disk_used", size, time.Second*60)
+	}
+
 	// Determine if their folder size, in bytes, is smaller than the amount of space they've
 	// been allocated.
-	fs.Server.Resources.Disk = size
+	fs.Server.UpdateResources(func(ru *ResourceUsage) {
+		ru.Disk = size
+	})
 
 	return (size / 1000.0 / 1000.0) <= space
 }
@@ -188,12 +338,13 @@ func (fs *Filesystem) DirectorySize(dir string) (int64, error) {
 // reader. This is not the most memory efficient usage since it will be reading the
 // entirety of the file into memory.
 func (fs *Filesystem) Readfile(p string) (io.Reader, error) {
-	cleaned, err := fs.SafePath(p)
+	f, err := fs.OpenFile(p, os.O_RDONLY, 0)
 	if err != nil {
 		return nil, err
 	}
+	defer f.Close()
 
-	b, err := ioutil.ReadFile(cleaned)
+	b, err := ioutil.ReadAll(f)
 	if err != nil {
 		return nil, err
 	}
@@ -210,6 +361,10 @@ func (fs *Filesystem) Writefile(p string, r io.Reader) error {
 		return errors.WithStack(err)
 	}
 
+	if err := fs.CheckProtected(cleaned); err != nil {
+		return err
+	}
+
 	// If the file does not exist on the system already go ahead and create the pathway
 	// to it and an empty file. We'll then write to it later on after this completes.
 	if stat, err := os.Stat(cleaned); err != nil && os.IsNotExist(err) {
@@ -228,7 +383,7 @@ func (fs *Filesystem) Writefile(p string, r io.Reader) error {
 
 	// This will either create the file if it does not already exist, or open and
 	// truncate the existing file.
-	file, err := os.OpenFile(cleaned, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0644)
+	file, err := fs.OpenFile(cleaned, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0644)
 	if err != nil {
 		return errors.WithStack(err)
 	}
@@ -328,41 +483,63 @@ func (fs *Filesystem) unsafeStat(p string) (*Stat, error) {
 
 // Creates a new directory (name) at a specificied path (p) for the server.
 func (fs *Filesystem) CreateDirectory(name string, p string) error {
-	cleaned, err := fs.SafePath(path.Join(p, name))
+	cleaned, err := fs.SafePath(filepath.Join(p, name))
 	if err != nil {
 		return errors.WithStack(err)
 	}
 
+	if err := fs.CheckProtected(cleaned); err != nil {
+		return err
+	}
+
 	return os.MkdirAll(cleaned, 0755)
 }
 
 // Moves (or renames) a file or directory.
 func (fs *Filesystem) Rename(from string, to string) error {
-	cleanedFrom, err := fs.SafePath(from)
+	cleanedFrom, err := fs.SafeLinkPath(from)
 	if err != nil {
 		return errors.WithStack(err)
 	}
 
-	cleanedTo, err := fs.SafePath(to)
+	cleanedTo, err := fs.SafeLinkPath(to)
 	if err != nil {
 		return errors.WithStack(err)
 	}
 
+	if err := fs.CheckProtected(cleanedFrom); err != nil {
+		return err
+	}
+
+	if err := fs.CheckProtected(cleanedTo); err != nil {
+		return err
+	}
+
 	return os.Rename(cleanedFrom, cleanedTo)
 }
 
 // Recursively iterates over a directory and sets the permissions on all of the
 // underlying files.
 func (fs *Filesystem) Chown(path string) error {
+	// File ownership is not something that can be changed using a UID and GID on Windows
+	// so there is nothing to do here.
+	if runtime.GOOS == "windows" {
+		return nil
+	}
+
 	cleaned, err := fs.SafePath(path)
 	if err != nil {
 		return errors.WithStack(err)
 	}
 
-	if s, err := os.Stat(cleaned); err != nil {
+	if s, err := os.Lstat(cleaned); err != nil {
 		return errors.WithStack(err)
 	} else if !s.IsDir() {
-		return os.Chown(cleaned, fs.Configuration.User.Uid, fs.Configuration.User.Gid)
+		if err := checkHardLinks(s); err != nil {
+			return err
+		}
+
+		return os.Lchown(cleaned, fs.Configuration.User.Uid, fs.Configuration.User.Gid)
 	}
 
 	return fs.chownDirectory(cleaned)
@@ -380,7 +557,7 @@ func (fs *Filesystem) chownDirectory(path string) error {
 	}
 
 	// Chown the directory itself.
-	os.Chown(cleaned, config.Get().System.User.Uid, config.Get().System.User.Gid)
+	os.Lchown(cleaned, fs.Configuration.User.Uid, fs.Configuration.User.Gid)
 
 	files, err := ioutil.ReadDir(cleaned)
 	if err != nil {
@@ -395,9 +572,11 @@ func (fs *Filesystem) chownDirectory(path string) error {
 				defer wg.Done()
 				fs.chownDirectory(p)
 			}(filepath.Join(cleaned, f.Name()))
-		} else {
-			// Chown the file.
-			os.Chown(filepath.Join(cleaned, f.Name()), fs.Configuration.User.Uid, fs.Configuration.User.Gid)
+		} else if checkHardLinks(f) == nil {
+			// Chown the file. Symlinks are changed themselves rather than whatever they point
+			// to, otherwise a link could be used to take ownership of files outside the server.
+			// Files with more than one hard link are skipped for the same reason.
+			os.Lchown(filepath.Join(cleaned, f.Name()), fs.Configuration.User.Uid, fs.Configuration.User.Gid)
 		}
 	}
 
@@ -407,10 +586,10 @@ func (fs *Filesystem) chownDirectory(path string) error {
 }
 
 // Copies a given file to the same location and appends a suffix to the file to indicate that
-// it has been copied.
+// it has been copied. The copy is removed if the context is cancelled before it completes.
 //
 // @todo need to get an exclusive lock on the file.
-func (fs *Filesystem) Copy(p string) error {
+func (fs *Filesystem) Copy(ctx context.Context, p string) error {
 	cleaned, err := fs.SafePath(p)
 	if err != nil {
 		return errors.WithStack(err)
@@ -446,7 +625,7 @@ func (fs *Filesystem) Copy(p string) error {
 		}
 
 		tryName := fmt.Sprintf("%s%s%s", name, copySuffix, extension)
-		tryLocation, err := fs.SafePath(path.Join(relative, tryName))
+		tryLocation, err := fs.SafePath(filepath.Join(relative, tryName))
 		if err != nil {
 			return errors.WithStack(err)
 		}
@@ -463,24 +642,28 @@ func (fs *Filesystem) Copy(p string) error {
 		}
 	}
 
-	finalPath, err := fs.SafePath(path.Join(relative, fmt.Sprintf("%s%s%s", name, copySuffix, extension)))
+	finalPath, err := fs.SafePath(filepath.Join(relative, fmt.Sprintf("%s%s%s", name, copySuffix, extension)))
 	if err != nil {
 		return errors.WithStack(err)
 	}
 
-	source, err := os.Open(cleaned)
+	source, err := fs.OpenFile(cleaned, os.O_RDONLY, 0)
 	if err != nil {
 		return errors.WithStack(err)
 	}
 	defer source.Close()
 
-	dest, err := os.Create(finalPath)
+	dest, err := fs.OpenFile(finalPath, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
 	if err != nil {
 		return errors.WithStack(err)
 	}
 	defer dest.Close()
 
-	if _, err := io.Copy(dest, source); err != nil {
+	// Remove the partial copy if the copy fails or is cancelled part of the way through.
+	if _, err := io.Copy(dest, &contextReader{ctx: ctx, r: source}); err != nil {
+		dest.Close()
+		os.Remove(finalPath)
+
 		return errors.WithStack(err)
 	}
 
@@ -490,7 +673,9 @@ func (fs *Filesystem) Copy(p string) error {
 // Deletes a file or folder from the system. Prevents the user from accidentally
 // (or maliciously) removing their root server data directory.
 func (fs *Filesystem) Delete(p string) error {
-	cleaned, err := fs.SafePath(p)
+	// Resolve everything but the final part of the path so that deleting a symlink only
+	// removes the link, and not whatever it was pointing to.
+	cleaned, err := fs.SafeLinkPath(p)
 	if err != nil {
 		return errors.WithStack(err)
 	}
@@ -500,20 +685,121 @@ func (fs *Filesystem) Delete(p string) error {
 		return errors.New("cannot delete root server directory")
 	}
 
+	if err := fs.CheckProtected(cleaned); err != nil {
+		return err
+	}
+
+	// When the trash is enabled move the file into it rather than removing it, unless it
+	// is already in the trash, in which case it is removed for good.
+	if fs.Configuration.Trash.Enabled && !fs.isInTrash(cleaned) {
+		return fs.moveToTrash(cleaned)
+	}
+
 	return os.RemoveAll(cleaned)
 }
 
+// The fields that a directory listing can be sorted by.
+const (
+	ListSortName     = "name"
+	ListSortSize     = "size"
+	ListSortModified = "modified"
+)
+
+// Options controlling which entries of a directory listing are returned.
+type ListOptions struct {
+	// A glob pattern that the name of an entry must match, case-insensitively.
+	Filter string
+	// The field to sort the entries by. If this is not set the entries are sorted by name
+	// in descending order, which is the order that listings have always been returned in.
+	Sort string
+	// Sorts the entries in descending order, directories are always listed first.
+	Descending bool
+	// The number of entries to skip, and the maximum number to return. A limit of
+	// zero returns every remaining entry.
+	Offset int
+	Limit  int
+}
+
+// Sorts the entries of a directory so that directories are listed first, followed by
+// files, each sorted by the given field.
+func sortFileInfo(files []os.FileInfo, by string, desc bool) {
+	if by == "" {
+		by, desc = ListSortName, true
+	}
+
+	sort.SliceStable(files, func(i, j int) bool {
+		a, b := files[i], files[j]
+		if a.IsDir() != b.IsDir() {
+			return a.IsDir()
+		}
+
+		if desc {
+			a, b = b, a
+		}
+
+		switch by {
+		case ListSortSize:
+			if a.Size() != b.Size() {
+				return a.Size() < b.Size()
+			}
+		case ListSortModified:
+			if !a.ModTime().Equal(b.ModTime()) {
+				return a.ModTime().Before(b.ModTime())
+			}
+		}
+
+		return a.Name() < b.Name()
+	})
+}
+
 // Lists the contents of a given directory and returns stat information about each
-// file and folder within it.
-func (fs *Filesystem) ListDirectory(p string) ([]*Stat, error) {
+// file and folder within it, along with the total number of entries that matched the
+// filter before the offset and limit were applied.
+//
+// Filtering, sorting and pagination are done before the mime-type of each file is
+// detected, so that directories containing a huge number of files remain cheap to list
+// a page at a time.
+func (fs *Filesystem) ListDirectory(p string, opts ListOptions) ([]*Stat, int, error) {
 	cleaned, err := fs.SafePath(p)
 	if err != nil {
-		return nil, err
+		return nil, 0, err
 	}
 
 	files, err := ioutil.ReadDir(cleaned)
 	if err != nil {
-		return nil, err
+		return nil, 0, err
+	}
+
+	if opts.Filter != "" {
+		pattern := strings.ToLower(opts.Filter)
+
+		matched := files[:0]
+		for _, f := range files {
+			ok, err := filepath.Match(pattern, strings.ToLower(f.Name()))
+			if err != nil {
+				return nil, 0, errors.WithStack(err)
+			}
+
+			if ok {
+				matched = append(matched, f)
+			}
+		}
+		files = matched
+	}
+
+	total := len(files)
+
+	sortFileInfo(files, opts.Sort, opts.Descending)
+
+	if opts.Offset > 0 {
+		if opts.Offset > len(files) {
+			opts.Offset = len(files)
+		}
+		files = files[opts.Offset:]
+	}
+
+	if opts.Limit > 0 && opts.Limit < len(files) {
+		files = files[:opts.Limit]
 	}
 
 	var wg sync.WaitGroup
@@ -524,15 +810,20 @@ func (fs *Filesystem) ListDirectory(p string) ([]*Stat, error) {
 	out := make([]*Stat, len(files))
 
 	// Iterate over all of the files and directories returned and perform an async process
-	// to get the mime-type for them all.
+	// to get the mime-type for them all. The order of the output matches the order of the
+	// sorted entries since each result is written to its own index.
 	for i, file := range files {
 		wg.Add(1)
 
 		go func(idx int, f os.FileInfo) {
 			defer wg.Done()
 
+			// Symlinks are never followed here, they may point to a location outside of
+			// the server that should not be read from.
 			var m = "inode/directory"
-			if !f.IsDir() {
+			if f.Mode()&os.ModeSymlink != 0 {
+				m = "inode/symlink"
+			} else if !f.IsDir() {
 				m, _, _ = mimetype.DetectFile(filepath.Join(cleaned, f.Name()))
 			}
 
@@ -545,23 +836,7 @@ func (fs *Filesystem) ListDirectory(p string) ([]*Stat, error) {
 
 	wg.Wait()
 
-	// Sort the output alphabetically to begin with since we've run the output
-	// through an asynchronous process and the order is gonna be very random.
-	sort.SliceStable(out, func(i, j int) bool {
-		if out[i].Info.Name() == out[j].Info.Name() || out[i].Info.Name() > out[j].Info.Name() {
-			return true
-		}
-
-		return false
-	})
-
-	// Then, sort it so that directories are listed first in the output. Everything
-	// will continue to be alphabetized at this point.
-	sort.SliceStable(out, func(i, j int) bool {
-		return out[i].Info.IsDir()
-	})
-
-	return out, nil
+	return out, total, nil
 }
 
 // Ensures that the data directory for the server instance exists.
@@ -578,3 +853,18 @@ func (fs *Filesystem) EnsureDataDirectory() error {
 
 	return nil
 }
+
+// Wraps a reader so that reading from it fails once the context has been cancelled, which
+// stops a copy of a large file from continuing after the request for it has gone away.
+type contextReader struct {
+	ctx context.Context
+	r   io.Reader
+}
+
+func (cr *contextReader) Read(p []byte) (int, error) {
+	if err := cr.ctx.Err(); err != nil {
+		return 0, err
+	}
+
+	return cr.r.Read(p)
+}
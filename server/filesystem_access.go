@@ -0,0 +1,113 @@
+package server
+
+import (
+	"github.com/pterodactyl/wings/config"
+	"go.uber.org/zap"
+	"os"
+	"path/filepath"
+)
+
+// The access a user has to the files of a server over one of the file transfer protocols,
+// such as SFTP, WebDAV or FTP. Permissions are the ones returned by the Panel when the
+// credentials of the user were validated, so every protocol checks them the same way.
+type FileAccess struct {
+	Server      *Server
+	Permissions []string
+	Logger      *zap.SugaredLogger
+
+	// If set, nothing can be modified regardless of the permissions of the user.
+	ReadOnly bool
+}
+
+// Creates the access for a user to a server, logging using the given logger.
+func NewFileAccess(s *Server, permissions []string, readOnly bool, logger *zap.SugaredLogger) *FileAccess {
+	return &FileAccess{
+		Server:      s,
+		Permissions: permissions,
+		Logger:      logger,
+		ReadOnly:    readOnly,
+	}
+}
+
+// Determines if the user has the given permission.
+func (a *FileAccess) Can(permission string) bool {
+	// Server owners and super admins have their permissions returned as '[*]' via the Panel
+	// API, so for the sake of speed do an initial check for that before iterating over the
+	// entire array of permissions.
+	if len(a.Permissions) == 1 && a.Permissions[0] == "*" {
+		return true
+	}
+
+	for _, p := range a.Permissions {
+		if p == permission {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Returns true if the file is protected by the server configuration, logging the attempt
+// to modify it.
+func (a *FileAccess) IsProtected(p string) bool {
+	err := a.Server.Filesystem.CheckProtected(p)
+	if err == nil {
+		return false
+	}
+
+	a.Logger.Infow("denying modification of protected file", zap.String("server", a.Server.Uuid), zap.Error(err))
+
+	return true
+}
+
+// Determines if the user is allowed to modify the path, which is not the case if access is
+// read only or the path is protected.
+func (a *FileAccess) CanModify(p string) bool {
+	return !a.ReadOnly && !a.IsProtected(p)
+}
+
+// Chowns a file to the daemon user. Failing here is not treated as an error since the file
+// was still created, it is just owned incorrectly and will likely cause some issues.
+func (a *FileAccess) Chown(p string) {
+	u := config.Get().System.User
+	if err := os.Lchown(p, u.Uid, u.Gid); err != nil {
+		a.Logger.Warnw("error chowning file", zap.String("file", p), zap.Error(err))
+	}
+}
+
+// Determines if the server has disk space left for files to be written, logging when it
+// does not.
+func (a *FileAccess) HasSpaceAvailable() bool {
+	if a.Server.Filesystem.HasSpaceAvailable() {
+		return true
+	}
+
+	a.Logger.Infow("denying file write due to space limit", zap.String("server", a.Server.Uuid))
+
+	return false
+}
+
+// Registers a new upload to the server, refusing it if the server already has too many
+// uploads in progress.
+func (a *FileAccess) BeginUpload() (*Upload, error) {
+	upload, err := a.Server.Filesystem.BeginUpload()
+	if err != nil {
+		a.Logger.Infow("denying file write due to upload limit", zap.String("server", a.Server.Uuid), zap.Error(err))
+		return nil, err
+	}
+
+	return upload, nil
+}
+
+// Marks an upload to the given path as finished, once the file written to has been closed,
+// and scans the file for malware in the background.
+func (a *FileAccess) FinishUpload(p string, upload *Upload) {
+	upload.Done()
+
+	go func() {
+		rel, _ := filepath.Rel(a.Server.Filesystem.Path(), p)
+		if err := a.Server.Filesystem.ScanFile(rel); IsInfectedFileError(err) {
+			a.Logger.Warnw("removed infected uploaded file", zap.String("server", a.Server.Uuid), zap.Error(err))
+		}
+	}()
+}
@@ -0,0 +1,394 @@
+package server
+
+import (
+	"archive/tar"
+	"bufio"
+	"compress/gzip"
+	"context"
+	"github.com/klauspost/compress/zstd"
+	"github.com/klauspost/pgzip"
+	"github.com/pkg/errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// The name of the file in the root of a server that can list paths to exclude when
+// generating archives of the server.
+const ignoreFileName = ".pteroignore"
+
+// A set of patterns used to exclude files from an archive. Patterns use the same syntax as
+// filepath.Match and are compared against both the path relative to the server root and the
+// base name of the file. A pattern ending in a slash only matches directories.
+type IgnoreRules []string
+
+// Reads the ignore file from the root of the server, if one exists, and merges it with
+// any additional patterns provided.
+func (fs *Filesystem) IgnoreRules(extra []string) IgnoreRules {
+	rules := IgnoreRules{}
+
+	f, err := fs.OpenFile(ignoreFileName, os.O_RDONLY, 0)
+	if err == nil {
+		defer f.Close()
+
+		s := bufio.NewScanner(f)
+		for s.Scan() {
+			rules = append(rules, s.Text())
+		}
+	}
+
+	return append(rules, extra...)
+}
+
+// Determines if the given path, relative to the server root, should be ignored.
+func (r IgnoreRules) Matches(rel string, dir bool) bool {
+	rel = filepath.ToSlash(rel)
+	base := filepath.Base(rel)
+
+	for _, p := range r {
+		p = strings.TrimSpace(p)
+		if p == "" || strings.HasPrefix(p, "#") {
+			continue
+		}
+
+		if strings.HasSuffix(p, "/") {
+			if !dir {
+				continue
+			}
+			p = strings.TrimSuffix(p, "/")
+		}
+
+		p = strings.TrimPrefix(p, "/")
+		if ok, _ := filepath.Match(p, rel); ok {
+			return true
+		}
+
+		if ok, _ := filepath.Match(p, base); ok && !strings.Contains(p, "/") {
+			return true
+		}
+	}
+
+	return false
+}
+
+// The compression formats that archives of a server can be created using.
+const (
+	CompressionGzip = "gzip"
+	CompressionZstd = "zstd"
+	CompressionNone = "none"
+)
+
+// Returns the file extension used for archives created using the given compression.
+func ArchiveExtension(compression string) string {
+	switch compression {
+	case CompressionZstd:
+		return ".tar.zst"
+	case CompressionNone:
+		return ".tar"
+	default:
+		return ".tar.gz"
+	}
+}
+
+// The size of each block compressed in parallel when using gzip.
+const gzipBlockSize = 1024 * 1024
+
+// Wraps the writer with a compressor for the given format, compressing using up to the given
+// number of threads. A level of 0 uses the default level of the format.
+func newCompressor(w io.Writer, compression string, level int, threads int) (io.WriteCloser, error) {
+	if threads < 1 {
+		threads = 1
+	}
+
+	switch compression {
+	case CompressionGzip, "":
+		if level == 0 {
+			level = gzip.DefaultCompression
+		}
+
+		if threads == 1 {
+			return gzip.NewWriterLevel(w, level)
+		}
+
+		gw, err := pgzip.NewWriterLevel(w, level)
+		if err != nil {
+			return nil, err
+		}
+
+		return gw, gw.SetConcurrency(gzipBlockSize, threads)
+	case CompressionZstd:
+		opts := []zstd.EOption{zstd.WithEncoderConcurrency(threads)}
+		if level != 0 {
+			opts = append(opts, zstd.WithEncoderLevel(zstd.EncoderLevelFromZstd(level)))
+		}
+
+		return zstd.NewWriter(w, opts...)
+	case CompressionNone:
+		return nopWriteCloser{w}, nil
+	}
+
+	return nil, errors.New("unknown archive compression: " + compression)
+}
+
+type nopWriteCloser struct {
+	io.Writer
+}
+
+func (nopWriteCloser) Close() error {
+	return nil
+}
+
+// Writes a gzip compressed tarball of the entire server directory to the writer, skipping
+// anything matched by the ignore rules. The archive is generated on the fly so nothing is
+// written to the disk. Symlinks are stored as links and never followed.
+func (fs *Filesystem) StreamArchive(ctx context.Context, w io.Writer, rules IgnoreRules) error {
+	return fs.WriteArchive(ctx, w, CompressionGzip, 0, "", rules)
+}
+
+// Files no larger than this are read into memory ahead of being written to an archive, larger
+// files are left open and streamed into the archive once it reaches them.
+const archivePrefetchSize = 1024 * 1024
+
+// A single file or directory being written to an archive. Regular files are opened by the
+// reader pool, and done is closed once they have been.
+type archiveEntry struct {
+	root   string
+	path   string
+	header *tar.Header
+	done   chan struct{}
+	data   []byte
+	file   *os.File
+	err    error
+}
+
+// Opens the file for the entry, reading it entirely if it is small enough.
+func (e *archiveEntry) open() {
+	defer close(e.done)
+
+	f, err := openBeneath(e.root, e.path, os.O_RDONLY, 0)
+	if err != nil {
+		e.err = err
+		return
+	}
+
+	if st, err := f.Stat(); err != nil || checkHardLinks(st) != nil {
+		f.Close()
+		e.err = InvalidPathResolution
+		return
+	}
+
+	if e.header.Size > archivePrefetchSize {
+		e.file = f
+		return
+	}
+	defer f.Close()
+
+	e.data = make([]byte, e.header.Size)
+	if _, err := io.ReadFull(f, e.data); err != nil {
+		e.err = err
+	}
+}
+
+// Closes the file for the entry if it was left open.
+func (e *archiveEntry) close() {
+	<-e.done
+	if e.file != nil {
+		e.file.Close()
+	}
+}
+
+// Writes a tarball of the entire server directory to the writer using the given compression,
+// skipping anything matched by the ignore rules. If a prefix is given every file is placed
+// within a directory of that name in the archive.
+//
+// Files are read by a pool of goroutines ahead of being written, and the compression is
+// spread across multiple threads, both limited by the archive configuration for the node.
+// Entries are always written in the order they were walked, so the archive is identical no
+// matter how many threads are used. The walk and compression stop as soon as the context is
+// cancelled, in which case an error is returned since the archive is incomplete.
+func (fs *Filesystem) WriteArchive(ctx context.Context, w io.Writer, compression string, level int, prefix string, rules IgnoreRules) error {
+	gw, err := newCompressor(w, compression, level, fs.Configuration.Archives.CompressionThreadLimit())
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	tw := tar.NewWriter(gw)
+
+	readers := fs.Configuration.Archives.ReadThreads
+	if readers < 1 {
+		readers = 1
+	}
+
+	// Entries are passed to the reader pool to be opened, and to the writer in the order
+	// they were walked. Buffering the entries limits how far ahead of the writer the
+	// readers can get, and so how much is held in memory at once.
+	work := make(chan *archiveEntry, readers*2)
+	ordered := make(chan *archiveEntry, readers*2)
+	stop := make(chan struct{})
+
+	for i := 0; i < readers; i++ {
+		go func() {
+			for e := range work {
+				e.open()
+			}
+		}()
+	}
+
+	var walkErr error
+	go func() {
+		defer close(ordered)
+		defer close(work)
+
+		walkErr = fs.walkArchive(prefix, rules, func(e *archiveEntry) bool {
+			select {
+			case <-stop:
+				return false
+			case <-ctx.Done():
+				return false
+			case ordered <- e:
+			}
+
+			if e.header.Typeflag == tar.TypeReg {
+				work <- e
+			}
+
+			return true
+		})
+	}()
+
+	err = writeArchiveEntries(ctx, tw, ordered)
+
+	// Stop the walk early if writing failed, and close any files that were left open by
+	// the readers for entries that were never written.
+	close(stop)
+	for e := range ordered {
+		e.close()
+	}
+
+	if err == nil {
+		err = walkErr
+	}
+
+	// A cancelled walk stops without an error, so make sure an archive that is missing
+	// entries is never treated as complete.
+	if err == nil {
+		err = ctx.Err()
+	}
+
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	if err := tw.Close(); err != nil {
+		return errors.WithStack(err)
+	}
+
+	return errors.WithStack(gw.Close())
+}
+
+// Walks the server directory, passing an entry for every file and directory that should be
+// included in the archive to the callback. The walk is stopped if the callback returns false.
+func (fs *Filesystem) walkArchive(prefix string, rules IgnoreRules, cb func(*archiveEntry) bool) error {
+	errStopped := errors.New("archive walk stopped")
+
+	root := fs.Path()
+	err := filepath.Walk(root, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if p == root && prefix == "" {
+			return nil
+		}
+
+		rel, err := filepath.Rel(root, p)
+		if err != nil {
+			return err
+		}
+
+		if p != root && rules.Matches(rel, info.IsDir()) {
+			if info.IsDir() {
+				return filepath.SkipDir
+			}
+
+			return nil
+		}
+
+		// Files with more than one hard link could be a link to a file outside of the root,
+		// so they are left out of the archive.
+		if checkHardLinks(info) != nil {
+			return nil
+		}
+
+		var link string
+		if info.Mode()&os.ModeSymlink != 0 {
+			if link, err = os.Readlink(p); err != nil {
+				return err
+			}
+		}
+
+		header, err := tar.FileInfoHeader(info, link)
+		if err != nil {
+			return err
+		}
+		header.Name = filepath.ToSlash(filepath.Join(prefix, rel))
+
+		e := &archiveEntry{root: root, path: p, header: header, done: make(chan struct{})}
+		if header.Typeflag != tar.TypeReg {
+			close(e.done)
+		}
+
+		if !cb(e) {
+			return errStopped
+		}
+
+		return nil
+	})
+
+	if err == errStopped {
+		return nil
+	}
+
+	return err
+}
+
+// Writes each of the entries to the archive as they are opened by the reader pool.
+func writeArchiveEntries(ctx context.Context, tw *tar.Writer, entries <-chan *archiveEntry) error {
+	for e := range entries {
+		<-e.done
+		if err := ctx.Err(); err != nil {
+			e.close()
+			return err
+		}
+
+		if e.err != nil {
+			return e.err
+		}
+
+		if err := writeArchiveEntry(ctx, tw, e); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func writeArchiveEntry(ctx context.Context, tw *tar.Writer, e *archiveEntry) error {
+	defer e.close()
+
+	if err := tw.WriteHeader(e.header); err != nil {
+		return err
+	}
+
+	if e.file != nil {
+		// Only the size of the file when it was walked is written, since the header has
+		// already been written with that size.
+		_, err := io.CopyN(tw, &contextReader{ctx: ctx, r: e.file}, e.header.Size)
+
+		return err
+	}
+
+	_, err := tw.Write(e.data)
+
+	return err
+}
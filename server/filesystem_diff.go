@@ -0,0 +1,122 @@
+package server
+
+import (
+	"github.com/pkg/errors"
+	"github.com/pmezard/go-difflib/difflib"
+	"io/ioutil"
+	"os"
+	"strings"
+)
+
+// The number of unchanged lines shown around each change in a diff.
+const diffContextLines = 3
+
+// The largest files that can be compared. The time taken to find the changes grows with
+// the square of the number of lines in the worst case, so these are well below the size
+// of a file that can be edited.
+const (
+	maxDiffSize  = 512 * 1024
+	maxDiffLines = 5000
+)
+
+// Reads a file so that it can be compared to another. The file must be small enough to be
+// edited and cannot contain binary data. If allowMissing is true a file that does not exist
+// is treated as being empty.
+func (fs *Filesystem) readForDiff(p string, allowMissing bool) (string, bool, error) {
+	if err := fs.IsEditable(p); err != nil {
+		if allowMissing && os.IsNotExist(errors.Cause(err)) {
+			return "", false, nil
+		}
+
+		return "", false, err
+	}
+
+	cleaned, err := fs.SafePath(p)
+	if err != nil {
+		return "", false, errors.WithStack(err)
+	}
+
+	f, err := fs.OpenFile(cleaned, os.O_RDONLY, 0)
+	if err != nil {
+		return "", false, errors.WithStack(err)
+	}
+	defer f.Close()
+
+	b, err := ioutil.ReadAll(f)
+	if err != nil {
+		return "", false, errors.WithStack(err)
+	}
+
+	return string(b), true, nil
+}
+
+// Returns a unified diff of the changes that writing the content to the file would make.
+// A file that does not exist yet is compared as if it were empty. An empty string is returned
+// if there would be no changes.
+func (fs *Filesystem) Diff(p string, content []byte) (string, error) {
+	current, exists, err := fs.readForDiff(p, true)
+	if err != nil {
+		return "", err
+	}
+
+	from := p
+	if !exists {
+		from = "/dev/null"
+	}
+
+	return unifiedDiff(from, current, p, string(content))
+}
+
+// Returns a unified diff of the changes between two files, or an empty string if they are
+// the same.
+func (fs *Filesystem) DiffFiles(a string, b string) (string, error) {
+	ac, _, err := fs.readForDiff(a, false)
+	if err != nil {
+		return "", err
+	}
+
+	bc, _, err := fs.readForDiff(b, false)
+	if err != nil {
+		return "", err
+	}
+
+	return unifiedDiff(a, ac, b, bc)
+}
+
+func unifiedDiff(fromName string, from string, toName string, to string) (string, error) {
+	if from == to {
+		return "", nil
+	}
+
+	if len(from) > maxDiffSize || len(to) > maxDiffSize {
+		return "", &editableFileError{code: editableFileTooLargeToDiff, limit: maxDiffSize}
+	}
+
+	a, b := diffLines(from), diffLines(to)
+	if len(a) > maxDiffLines || len(b) > maxDiffLines {
+		return "", &editableFileError{code: editableFileTooLargeToDiff, limit: maxDiffSize}
+	}
+
+	d, err := difflib.GetUnifiedDiffString(difflib.UnifiedDiff{
+		A:        a,
+		B:        b,
+		FromFile: fromName,
+		ToFile:   toName,
+		Context:  diffContextLines,
+	})
+
+	return d, errors.WithStack(err)
+}
+
+// Splits text into lines for a diff, keeping the line endings. A final line without a line
+// ending is marked the same way as in the output of diff and git.
+func diffLines(s string) []string {
+	lines := strings.SplitAfter(s, "\n")
+	if lines[len(lines)-1] == "" {
+		return lines[:len(lines)-1]
+	}
+
+	lines[len(lines)-1] += "\n\\ No newline at end of file\n"
+
+	return lines
+}
@@ -0,0 +1,123 @@
+package server
+
+import (
+	"github.com/pterodactyl/wings/config"
+	"github.com/pterodactyl/wings/throttle"
+	"io"
+	"sync"
+)
+
+type tooManyDownloadsError struct {
+	node bool
+}
+
+func (e *tooManyDownloadsError) Error() string {
+	if e.node {
+		return "too many downloads are currently in progress on this node"
+	}
+
+	return "too many downloads are currently in progress for this server"
+}
+
+func IsTooManyDownloadsError(err error) bool {
+	_, ok := err.(*tooManyDownloadsError)
+
+	return ok
+}
+
+// Tracks the downloads in progress across every server on the node.
+var nodeDownloads transferLimiter
+
+// The bandwidth shared by every download in progress for a single user, so that starting
+// many downloads in parallel does not multiply the limit.
+type userDownload struct {
+	bucket *throttle.Bucket
+	active int
+}
+
+var userDownloads = struct {
+	sync.Mutex
+	users map[string]*userDownload
+}{users: make(map[string]*userDownload)}
+
+// Returns the bandwidth bucket for the user, creating it if this is the only download
+// they have in progress.
+func acquireUserBucket(user string, rate int64) *throttle.Bucket {
+	userDownloads.Lock()
+	defer userDownloads.Unlock()
+
+	u, ok := userDownloads.users[user]
+	if !ok {
+		u = &userDownload{bucket: throttle.NewBucket(rate)}
+		userDownloads.users[user] = u
+	}
+
+	u.active++
+	u.bucket.SetRate(rate)
+
+	return u.bucket
+}
+
+func releaseUserBucket(user string) {
+	userDownloads.Lock()
+	defer userDownloads.Unlock()
+
+	if u, ok := userDownloads.users[user]; ok {
+		u.active--
+		if u.active <= 0 {
+			delete(userDownloads.users, user)
+		}
+	}
+}
+
+// A download that is in progress for a server. Data sent for the download should be
+// passed through it so that it is throttled, and Done must be called once it has finished.
+type Download struct {
+	server *transferLimiter
+	user   string
+	bucket *throttle.Bucket
+	once   sync.Once
+}
+
+// Starts a new download of the server's data for the given user. If either the server or
+// the node already has the maximum number of downloads in progress an error is returned.
+func (fs *Filesystem) BeginDownload(user string) (*Download, error) {
+	cfg := config.Get().System.Downloads
+
+	if !nodeDownloads.acquire(cfg.NodeConcurrency, 0) {
+		return nil, &tooManyDownloadsError{node: true}
+	}
+
+	if !fs.Server.downloads.acquire(cfg.ServerConcurrency, cfg.ServerBandwidth*1024) {
+		nodeDownloads.release()
+
+		return nil, &tooManyDownloadsError{}
+	}
+
+	return &Download{
+		server: &fs.Server.downloads,
+		user:   user,
+		bucket: acquireUserBucket(user, cfg.UserBandwidth*1024),
+	}, nil
+}
+
+// Returns a reader that throttles data read for the download to the configured bandwidth
+// limits for the user and the server.
+func (d *Download) Reader(r io.Reader) io.Reader {
+	return throttle.Reader(r, d.bucket, d.server.bucket)
+}
+
+// Returns a writer that throttles data written for the download to the configured
+// bandwidth limits for the user and the server.
+func (d *Download) Writer(w io.Writer) io.Writer {
+	return throttle.Writer(w, d.bucket, d.server.bucket)
+}
+
+// Marks the download as finished, allowing another download to take its place.
+func (d *Download) Done() {
+	d.once.Do(func() {
+		releaseUserBucket(d.user)
+		d.server.release()
+		nodeDownloads.release()
+	})
+}
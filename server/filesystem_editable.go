@@ -0,0 +1,132 @@
+package server
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/pkg/errors"
+	"github.com/pterodactyl/wings/config"
+	"io"
+	"io/ioutil"
+	"os"
+)
+
+const (
+	editableFileTooLarge       = "file_too_large"
+	editableFileIsBinary       = "file_is_binary"
+	editableFileTooLargeToDiff = "file_too_large_to_diff"
+)
+
+// Returned when a file cannot be opened or saved through the file editor. The error can be
+// marshaled directly into a response so the Panel is able to explain why to the user.
+type editableFileError struct {
+	code  string
+	limit int64
+}
+
+func (e *editableFileError) Error() string {
+	if e.code == editableFileTooLarge {
+		return fmt.Sprintf("file exceeds the maximum editable size of %d bytes", e.limit)
+	}
+
+	if e.code == editableFileTooLargeToDiff {
+		return fmt.Sprintf("file exceeds the maximum size of %d bytes or %d lines that can be compared", e.limit, maxDiffLines)
+	}
+
+	return "file contains binary data and cannot be edited"
+}
+
+func (e *editableFileError) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		Error   string `json:"error"`
+		Code    string `json:"code"`
+		MaxSize int64  `json:"max_size"`
+	}{
+		Error:   e.Error(),
+		Code:    e.code,
+		MaxSize: e.limit,
+	})
+}
+
+func IsEditableFileError(err error) bool {
+	_, ok := err.(*editableFileError)
+
+	return ok
+}
+
+// Returns the maximum size in bytes of a file that can be edited, or 0 if there is no limit.
+func maxEditableSize() int64 {
+	return config.Get().Api.MaxEditableSize * 1024 * 1024
+}
+
+// Determines if the data appears to be binary rather than text, based on the presence of
+// a null byte in the data. Text encoded as UTF-16 is never considered binary.
+func isBinaryContent(b []byte) bool {
+	return !hasUtf16Bom(b) && bytes.IndexByte(b, 0) >= 0
+}
+
+// Checks that a file is small enough to be opened in the file editor and does not contain
+// binary data.
+func (fs *Filesystem) IsEditable(p string) error {
+	cleaned, err := fs.SafePath(p)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	st, err := os.Stat(cleaned)
+	if err != nil {
+		return err
+	}
+
+	if max := maxEditableSize(); max > 0 && st.Size() > max {
+		return &editableFileError{code: editableFileTooLarge, limit: max}
+	}
+
+	f, err := fs.OpenFile(cleaned, os.O_RDONLY, 0)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	defer f.Close()
+
+	head, err := bufio.NewReader(f).Peek(512)
+	if err != nil && err != io.EOF {
+		return errors.WithStack(err)
+	}
+
+	if isBinaryContent(head) {
+		return &editableFileError{code: editableFileIsBinary, limit: maxEditableSize()}
+	}
+
+	return nil
+}
+
+// Reads the contents being saved through the file editor, returning an error if they are
+// larger than the editable size limit or appear to be binary. Reading stops as soon as the
+// limit is exceeded so that oversized requests are never fully buffered.
+func ReadEditableContent(r io.Reader) ([]byte, error) {
+	max := maxEditableSize()
+	if max > 0 {
+		r = io.LimitReader(r, max+1)
+	}
+
+	b, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	if max > 0 && int64(len(b)) > max {
+		return nil, &editableFileError{code: editableFileTooLarge, limit: max}
+	}
+
+	head := b
+	if len(head) > 512 {
+		head = head[:512]
+	}
+
+	if isBinaryContent(head) {
+		return nil, &editableFileError{code: editableFileIsBinary, limit: max}
+	}
+
+	return b, nil
+}
@@ -0,0 +1,173 @@
+package server
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/pkg/errors"
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/charmap"
+	"golang.org/x/text/encoding/unicode"
+	"io"
+	"os"
+	"unicode/utf8"
+)
+
+// The text encodings that files can be read and written using through the file editor.
+const (
+	EncodingUtf8    = "utf-8"
+	EncodingUtf8Bom = "utf-8-bom"
+	EncodingUtf16le = "utf-16le"
+	EncodingUtf16be = "utf-16be"
+	EncodingLatin1  = "iso-8859-1"
+)
+
+// The number of bytes at the start of a file that are read to determine its encoding.
+const encodingSniffSize = 8 * 1024
+
+var (
+	bomUtf8    = []byte{0xEF, 0xBB, 0xBF}
+	bomUtf16le = []byte{0xFF, 0xFE}
+	bomUtf16be = []byte{0xFE, 0xFF}
+)
+
+type unsupportedEncoding struct {
+	encoding string
+}
+
+func (e *unsupportedEncoding) Error() string {
+	return fmt.Sprintf("the encoding \"%s\" is not supported", e.encoding)
+}
+
+func IsUnsupportedEncodingError(err error) bool {
+	_, ok := err.(*unsupportedEncoding)
+
+	return ok
+}
+
+// Determines the encoding of text using its byte order mark. Text without a byte order mark
+// is UTF-8 if it is valid UTF-8, otherwise it is assumed to be ISO-8859-1, which is what most
+// older game servers write their configuration files using.
+func DetectEncoding(b []byte) string {
+	switch {
+	case bytes.HasPrefix(b, bomUtf8):
+		return EncodingUtf8Bom
+	case bytes.HasPrefix(b, bomUtf16le):
+		return EncodingUtf16le
+	case bytes.HasPrefix(b, bomUtf16be):
+		return EncodingUtf16be
+	case utf8.Valid(b):
+		return EncodingUtf8
+	}
+
+	return EncodingLatin1
+}
+
+// Determines if the text starts with a UTF-16 byte order mark. UTF-16 text contains null
+// bytes, so it must not be mistaken for binary data.
+func hasUtf16Bom(b []byte) bool {
+	return bytes.HasPrefix(b, bomUtf16le) || bytes.HasPrefix(b, bomUtf16be)
+}
+
+func textEncoding(enc string) (encoding.Encoding, error) {
+	switch enc {
+	case EncodingUtf16le:
+		return unicode.UTF16(unicode.LittleEndian, unicode.ExpectBOM), nil
+	case EncodingUtf16be:
+		return unicode.UTF16(unicode.BigEndian, unicode.ExpectBOM), nil
+	case EncodingLatin1:
+		return charmap.ISO8859_1, nil
+	}
+
+	return nil, &unsupportedEncoding{encoding: enc}
+}
+
+// Converts text in the given encoding to UTF-8, removing any byte order mark.
+func DecodeText(b []byte, enc string) ([]byte, error) {
+	switch enc {
+	case EncodingUtf8, "":
+		return b, nil
+	case EncodingUtf8Bom:
+		return bytes.TrimPrefix(b, bomUtf8), nil
+	}
+
+	e, err := textEncoding(enc)
+	if err != nil {
+		return nil, err
+	}
+
+	out, err := e.NewDecoder().Bytes(b)
+
+	return out, errors.WithStack(err)
+}
+
+// Converts UTF-8 text to the given encoding, adding a byte order mark if the encoding uses
+// one. An error is returned if the text contains characters that cannot be represented in
+// the encoding.
+func EncodeText(b []byte, enc string) ([]byte, error) {
+	switch enc {
+	case EncodingUtf8, "":
+		return b, nil
+	case EncodingUtf8Bom:
+		return append(append([]byte{}, bomUtf8...), bytes.TrimPrefix(b, bomUtf8)...), nil
+	}
+
+	e, err := textEncoding(enc)
+	if err != nil {
+		return nil, err
+	}
+
+	out, err := e.NewEncoder().Bytes(b)
+
+	return out, errors.WithStack(err)
+}
+
+// Returns the encoding of a file, or UTF-8 if the file does not exist. Only the start of the
+// file is read, so a large file that is only invalid UTF-8 further in is treated as UTF-8.
+func (fs *Filesystem) FileEncoding(p string) (string, error) {
+	cleaned, err := fs.SafePath(p)
+	if err != nil {
+		return "", errors.WithStack(err)
+	}
+
+	f, err := fs.OpenFile(cleaned, os.O_RDONLY, 0)
+	if err != nil {
+		if os.IsNotExist(errors.Cause(err)) {
+			return EncodingUtf8, nil
+		}
+
+		return "", errors.WithStack(err)
+	}
+	defer f.Close()
+
+	b := make([]byte, encodingSniffSize)
+	n, err := io.ReadFull(f, b)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return "", errors.WithStack(err)
+	}
+
+	// Only the start of larger files is read, which may end part way through a character
+	// that would otherwise make valid UTF-8 look invalid.
+	b = b[:n]
+	if n == encodingSniffSize {
+		b = trimPartialRune(b)
+	}
+
+	return DetectEncoding(b), nil
+}
+
+// Removes an incomplete UTF-8 character from the end of the text, if there is one.
+func trimPartialRune(b []byte) []byte {
+	for i := 1; i <= utf8.UTFMax && i <= len(b); i++ {
+		if !utf8.RuneStart(b[len(b)-i]) {
+			continue
+		}
+
+		if !utf8.FullRune(b[len(b)-i:]) {
+			return b[:len(b)-i]
+		}
+
+		break
+	}
+
+	return b
+}
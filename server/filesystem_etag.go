@@ -0,0 +1,50 @@
+package server
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"time"
+)
+
+// Returns a weak ETag for a file or directory based on its size and modification time,
+// along with the time it was last modified.
+func FileETag(st os.FileInfo) (string, time.Time) {
+	return `W/"` + strconv.FormatInt(st.Size(), 16) + "-" + strconv.FormatInt(st.ModTime().UnixNano(), 16) + `"`, st.ModTime()
+}
+
+// Returns a weak ETag for the listing of a directory along with the time that the most
+// recently modified entry was changed. This only reads the directory entries, so it is much
+// cheaper than building the listing itself and can be used to tell if the listing changed.
+func (fs *Filesystem) DirectoryETag(p string) (string, time.Time, error) {
+	cleaned, err := fs.SafePath(p)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+
+	st, err := os.Stat(cleaned)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+
+	files, err := ioutil.ReadDir(cleaned)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+
+	modified := st.ModTime()
+
+	h := sha1.New()
+	for _, f := range files {
+		fmt.Fprintf(h, "%s\x00%d\x00%d\x00%d\n", f.Name(), f.Size(), f.ModTime().UnixNano(), f.Mode())
+
+		if f.ModTime().After(modified) {
+			modified = f.ModTime()
+		}
+	}
+
+	return `W/"` + hex.EncodeToString(h.Sum(nil)) + `"`, modified, nil
+}
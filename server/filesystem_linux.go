@@ -10,4 +10,4 @@ func (s *Stat) CTime() time.Time {
 	st := s.Info.Sys().(*syscall.Stat_t)
 
 	return time.Unix(int64(st.Ctim.Sec), int64(st.Ctim.Nsec))
-}
\ No newline at end of file
+}
@@ -0,0 +1,78 @@
+package server
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+type protectedFileError struct {
+	path string
+}
+
+func (e *protectedFileError) Error() string {
+	return fmt.Sprintf("%s is protected and cannot be modified", e.path)
+}
+
+func IsProtectedFileError(err error) bool {
+	_, ok := err.(*protectedFileError)
+
+	return ok
+}
+
+// Checks if the given path is protected from being modified. A path is protected if it,
+// or any directory containing it, matches one of the protected file patterns defined for
+// the server. When the path is a directory everything within it is checked as well, since
+// removing or moving the directory would also affect any protected files inside of it.
+//
+// The path passed through must already be cleaned.
+func (fs *Filesystem) CheckProtected(cleaned string) error {
+	rules := IgnoreRules(fs.Server.ProtectedFiles)
+	if len(rules) == 0 {
+		return nil
+	}
+
+	rel, err := filepath.Rel(fs.Path(), cleaned)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return nil
+	}
+
+	st, err := os.Lstat(cleaned)
+	isDir := err == nil && st.IsDir()
+
+	if rel != "." {
+		if rules.Matches(rel, isDir) {
+			return &protectedFileError{path: filepath.ToSlash(rel)}
+		}
+
+		for p := filepath.Dir(rel); p != "."; p = filepath.Dir(p) {
+			if rules.Matches(p, true) {
+				return &protectedFileError{path: filepath.ToSlash(rel)}
+			}
+		}
+	}
+
+	if !isDir {
+		return nil
+	}
+
+	err = filepath.Walk(cleaned, func(p string, info os.FileInfo, err error) error {
+		if err != nil || p == cleaned {
+			return nil
+		}
+
+		r, _ := filepath.Rel(fs.Path(), p)
+		if rules.Matches(r, info.IsDir()) {
+			return &protectedFileError{path: filepath.ToSlash(r)}
+		}
+
+		return nil
+	})
+
+	if IsProtectedFileError(err) {
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,192 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/pkg/errors"
+	"github.com/pterodactyl/wings/clamav"
+	"github.com/pterodactyl/wings/config"
+	"go.uber.org/zap"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+)
+
+type infectedFileError struct {
+	path      string
+	signature string
+}
+
+func (e *infectedFileError) Error() string {
+	return fmt.Sprintf("%s was detected as infected (%s)", e.path, e.signature)
+}
+
+func IsInfectedFileError(err error) bool {
+	_, ok := err.(*infectedFileError)
+
+	return ok
+}
+
+// Scans data that is about to be written to the given path. If the data is infected it
+// is quarantined, if configured to do so, and an error is returned so that the caller
+// does not write it to the server.
+func (fs *Filesystem) ScanContent(p string, b []byte) error {
+	cfg := config.Get().System.ClamAV
+	if !cfg.Enabled {
+		return nil
+	}
+
+	rel := filepath.ToSlash(filepath.Clean("/" + p))
+
+	sig, err := fs.scan(bytes.NewReader(b))
+	if err != nil || sig == "" {
+		return nil
+	}
+
+	if cfg.Action == "quarantine" {
+		if err := fs.quarantine(rel, bytes.NewReader(b)); err != nil {
+			zap.S().Warnw("failed to quarantine infected file", zap.String("server", fs.Server.Uuid), zap.String("file", rel), zap.Error(err))
+		}
+	}
+
+	fs.reportInfected(rel, sig)
+
+	return &infectedFileError{path: rel, signature: sig}
+}
+
+// Scans a file that already exists on the server. If it is infected it is quarantined or
+// deleted, depending on the configured action, and an error is returned.
+func (fs *Filesystem) ScanFile(p string) error {
+	cfg := config.Get().System.ClamAV
+	if !cfg.Enabled {
+		return nil
+	}
+
+	cleaned, err := fs.SafePath(p)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	st, err := os.Lstat(cleaned)
+	if err != nil || !st.Mode().IsRegular() {
+		return nil
+	}
+
+	f, err := fs.OpenFile(cleaned, os.O_RDONLY, 0)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	sig, err := fs.scan(f)
+	f.Close()
+
+	if err != nil || sig == "" {
+		return nil
+	}
+
+	rel, _ := filepath.Rel(fs.Path(), cleaned)
+	rel = "/" + filepath.ToSlash(rel)
+
+	if cfg.Action == "quarantine" {
+		if f, err := fs.OpenFile(cleaned, os.O_RDONLY, 0); err == nil {
+			err = fs.quarantine(rel, f)
+			f.Close()
+
+			if err != nil {
+				zap.S().Warnw("failed to quarantine infected file", zap.String("server", fs.Server.Uuid), zap.String("file", rel), zap.Error(err))
+			}
+		}
+	}
+
+	if err := os.Remove(cleaned); err != nil {
+		zap.S().Errorw("failed to remove infected file", zap.String("server", fs.Server.Uuid), zap.String("file", rel), zap.Error(err))
+	}
+
+	fs.reportInfected(rel, sig)
+
+	return &infectedFileError{path: rel, signature: sig}
+}
+
+// Scans every file within a directory, such as after an archive has been extracted. Any
+// infected files are handled in the same way as ScanFile, and the number of infected files
+// found is returned.
+func (fs *Filesystem) ScanDirectory(p string) (int, error) {
+	if !config.Get().System.ClamAV.Enabled {
+		return 0, nil
+	}
+
+	cleaned, err := fs.SafePath(p)
+	if err != nil {
+		return 0, errors.WithStack(err)
+	}
+
+	var infected int
+	err = filepath.Walk(cleaned, func(f string, info os.FileInfo, err error) error {
+		if err != nil || !info.Mode().IsRegular() {
+			return nil
+		}
+
+		rel, _ := filepath.Rel(fs.Path(), f)
+		if IsInfectedFileError(fs.ScanFile(rel)) {
+			infected++
+		}
+
+		return nil
+	})
+
+	return infected, errors.WithStack(err)
+}
+
+// Sends the data to clamd and returns the matching signature, if any. Failures to reach
+// clamd are logged but otherwise ignored so that an unavailable scanner does not prevent
+// files from being written.
+func (fs *Filesystem) scan(r io.Reader) (string, error) {
+	cfg := config.Get().System.ClamAV
+
+	sig, err := clamav.Scan(cfg.Address, r, time.Duration(cfg.Timeout)*time.Second)
+	if err != nil {
+		zap.S().Warnw("failed to scan file using clamav", zap.String("server", fs.Server.Uuid), zap.Error(err))
+	}
+
+	return sig, err
+}
+
+// Copies infected data into the quarantine directory for the server.
+func (fs *Filesystem) quarantine(rel string, r io.Reader) error {
+	d := filepath.Join(config.Get().System.ClamAV.QuarantineDirectory, fs.Server.Uuid)
+	if err := os.MkdirAll(d, 0700); err != nil {
+		return errors.WithStack(err)
+	}
+
+	name := strconv.FormatInt(time.Now().UnixNano(), 10) + "-" + filepath.Base(rel)
+
+	f, err := os.OpenFile(filepath.Join(d, name), os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	defer f.Close()
+
+	_, err = io.Copy(f, r)
+
+	return errors.WithStack(err)
+}
+
+// Logs the detection of an infected file and publishes it to the server event bus.
+func (fs *Filesystem) reportInfected(rel string, sig string) {
+	zap.S().Warnw("detected infected file on server", zap.String("server", fs.Server.Uuid), zap.String("file", rel), zap.String("signature", sig), zap.String("action", config.Get().System.ClamAV.Action))
+
+	b, _ := json.Marshal(struct {
+		File      string `json:"file"`
+		Signature string `json:"signature"`
+		Action    string `json:"action"`
+	}{
+		File:      rel,
+		Signature: sig,
+		Action:    config.Get().System.ClamAV.Action,
+	})
+
+	fs.Server.Events().Publish(FileScanEvent, string(b))
+}
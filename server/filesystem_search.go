@@ -0,0 +1,144 @@
+package server
+
+import (
+	"bufio"
+	"context"
+	"github.com/pkg/errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"unicode/utf8"
+)
+
+// Files larger than this are not searched when searching file contents.
+const maxSearchFileSize = 5 * 1024 * 1024
+
+// The maximum number of matching lines returned for any single file.
+const maxSearchMatchesPerFile = 10
+
+// Error returned when the search was cut short because the context expired.
+var errSearchStopped = errors.New("search stopped")
+
+// A single file or directory matched by a search.
+type SearchResult struct {
+	// The path to the file relative to the root of the server data directory.
+	Path      string        `json:"path"`
+	Directory bool          `json:"directory"`
+	Size      int64         `json:"size"`
+	Matches   []SearchMatch `json:"matches,omitempty"`
+}
+
+// A line within a file that matched the content search.
+type SearchMatch struct {
+	Line int    `json:"line"`
+	Text string `json:"text"`
+}
+
+// Searches the given directory for files and folders with a name containing the query,
+// and optionally for files containing it. Matching is case-insensitive. The search stops
+// once the limit is reached or the context is done, in which case the second return
+// value will be true to indicate the results are incomplete.
+func (fs *Filesystem) Search(ctx context.Context, dir string, query string, content bool, limit int) ([]*SearchResult, bool, error) {
+	cleaned, err := fs.SafePath(dir)
+	if err != nil {
+		return nil, false, err
+	}
+
+	needle := strings.ToLower(query)
+	out := make([]*SearchResult, 0)
+	truncated := false
+
+	err = filepath.Walk(cleaned, func(p string, info os.FileInfo, err error) error {
+		select {
+		case <-ctx.Done():
+			truncated = true
+			return errSearchStopped
+		default:
+		}
+
+		// Skip anything that cannot be read rather than failing the whole search.
+		if err != nil || p == cleaned {
+			return nil
+		}
+
+		// Symlinks are never followed since they could point outside of the server's data
+		// directory.
+		if info.Mode()&os.ModeSymlink != 0 {
+			return nil
+		}
+
+		rel, _ := filepath.Rel(fs.Path(), p)
+		r := &SearchResult{
+			Path:      "/" + filepath.ToSlash(rel),
+			Directory: info.IsDir(),
+			Size:      info.Size(),
+		}
+
+		matched := strings.Contains(strings.ToLower(info.Name()), needle)
+		if content && info.Mode().IsRegular() && info.Size() <= maxSearchFileSize {
+			r.Matches = fs.searchFileContents(p, needle)
+			matched = matched || len(r.Matches) > 0
+		}
+
+		if matched {
+			if len(out) >= limit {
+				truncated = true
+				return errSearchStopped
+			}
+
+			out = append(out, r)
+		}
+
+		return nil
+	})
+
+	if err != nil && err != errSearchStopped {
+		return nil, false, errors.WithStack(err)
+	}
+
+	return out, truncated, nil
+}
+
+// Returns the lines in the file that contain the needle. Files that appear to be binary
+// are skipped.
+func (fs *Filesystem) searchFileContents(p string, needle string) []SearchMatch {
+	f, err := openBeneath(fs.Path(), p, os.O_RDONLY, 0)
+	if err != nil {
+		return nil
+	}
+	defer f.Close()
+
+	r := bufio.NewReader(f)
+	if head, err := r.Peek(512); (err == nil || err == io.EOF) && isBinaryContent(head) {
+		return nil
+	}
+
+	var matches []SearchMatch
+
+	s := bufio.NewScanner(r)
+	s.Buffer(make([]byte, 64*1024), 1024*1024)
+
+	for line := 1; s.Scan(); line++ {
+		text := s.Text()
+		if !strings.Contains(strings.ToLower(text), needle) {
+			continue
+		}
+
+		// Lines are cut short on a character boundary so that they remain valid UTF-8.
+		if len(text) > 256 {
+			i := 256
+			for i > 0 && !utf8.RuneStart(text[i]) {
+				i--
+			}
+			text = text[:i]
+		}
+
+		matches = append(matches, SearchMatch{Line: line, Text: text})
+		if len(matches) >= maxSearchMatchesPerFile {
+			break
+		}
+	}
+
+	return matches
+}
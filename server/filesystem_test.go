@@ -0,0 +1,181 @@
+//go:build !windows
+// +build !windows
+
+package server
+
+import (
+	"github.com/pterodactyl/wings/config"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+)
+
+// Creates a filesystem for a server inside of a temporary directory, along with a directory
+// next to the server root that the server should never be able to reach.
+func newTestFilesystem(t *testing.T) (*Filesystem, string) {
+	t.Helper()
+
+	tmp, err := ioutil.TempDir("", "wings-filesystem")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(tmp) })
+
+	// Resolve the temporary directory itself, it is a symlink on some systems.
+	tmp, err = filepath.EvalSymlinks(tmp)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fs := &Filesystem{
+		Configuration: &config.SystemConfiguration{Data: tmp},
+		Server:        &Server{Uuid: "a1b2c3d4-0000-0000-0000-000000000000"},
+	}
+
+	outside := filepath.Join(tmp, "outside")
+	for _, d := range []string{fs.Path(), outside} {
+		if err := os.MkdirAll(d, 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := ioutil.WriteFile(filepath.Join(outside, "secret.txt"), []byte("secret"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	return fs, outside
+}
+
+func TestFilesystem_SymlinkedDirectoryEscape(t *testing.T) {
+	fs, outside := newTestFilesystem(t)
+
+	if err := os.Symlink(outside, filepath.Join(fs.Path(), "link")); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := fs.SafePath("/link/secret.txt"); err != InvalidPathResolution {
+		t.Fatalf("expected SafePath to reject the path, got %v", err)
+	}
+
+	if f, err := fs.OpenFile("/link/secret.txt", os.O_RDONLY, 0); err == nil {
+		f.Close()
+		t.Fatal("expected OpenFile to reject a path through a symlinked directory")
+	}
+
+	if f, err := fs.OpenFile("/link/new.txt", os.O_CREATE|os.O_WRONLY, 0644); err == nil {
+		f.Close()
+		t.Fatal("expected OpenFile to refuse to create a file through a symlinked directory")
+	}
+
+	if _, err := os.Stat(filepath.Join(outside, "new.txt")); !os.IsNotExist(err) {
+		t.Fatal("a file was created outside of the server root")
+	}
+}
+
+func TestFilesystem_HardLinks(t *testing.T) {
+	fs, outside := newTestFilesystem(t)
+
+	linked := filepath.Join(fs.Path(), "linked.txt")
+	if err := os.Link(filepath.Join(outside, "secret.txt"), linked); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := ioutil.WriteFile(filepath.Join(fs.Path(), "normal.txt"), []byte("normal"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if f, err := fs.OpenFile("/linked.txt", os.O_RDWR|os.O_TRUNC, 0); err != InvalidPathResolution {
+		if f != nil {
+			f.Close()
+		}
+		t.Fatalf("expected OpenFile to refuse a hard linked file, got %v", err)
+	}
+
+	if b, err := ioutil.ReadFile(filepath.Join(outside, "secret.txt")); err != nil || string(b) != "secret" {
+		t.Fatalf("the hard linked file was changed: %q, %v", b, err)
+	}
+
+	f, err := fs.OpenFile("/normal.txt", os.O_RDWR|os.O_TRUNC, 0)
+	if err != nil {
+		t.Fatalf("expected OpenFile to open a regular file, got %v", err)
+	}
+	f.Close()
+
+	// Changing the owner of files requires root.
+	if os.Geteuid() != 0 {
+		return
+	}
+
+	fs.Configuration.User.Uid = 12345
+	fs.Configuration.User.Gid = 12345
+
+	if err := fs.Chown("/"); err != nil {
+		t.Fatal(err)
+	}
+
+	owner := func(p string) uint32 {
+		st, err := os.Lstat(p)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		return st.Sys().(*syscall.Stat_t).Uid
+	}
+
+	if owner(filepath.Join(outside, "secret.txt")) == 12345 {
+		t.Fatal("expected Chown to skip a hard linked file")
+	}
+
+	if owner(filepath.Join(fs.Path(), "normal.txt")) != 12345 {
+		t.Fatal("expected Chown to change the owner of a regular file")
+	}
+
+	if err := fs.Chown("/linked.txt"); err != InvalidPathResolution {
+		t.Fatalf("expected Chown to refuse a hard linked file, got %v", err)
+	}
+}
+
+func TestFilesystem_OpenBeneathSwappedDirectory(t *testing.T) {
+	fs, outside := newTestFilesystem(t)
+
+	dir := filepath.Join(fs.Path(), "dir")
+	if err := os.Mkdir(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	cleaned, err := fs.SafePath("/dir/secret.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Replace the directory with a symlink after the path has been validated, which is
+	// what a process inside of the server racing the daemon would do.
+	if err := os.Remove(dir); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.Symlink(outside, dir); err != nil {
+		t.Fatal(err)
+	}
+
+	if f, err := openBeneath(fs.Path(), cleaned, os.O_RDONLY, 0); err != InvalidPathResolution {
+		if f != nil {
+			f.Close()
+		}
+		t.Fatalf("expected openBeneath to refuse a swapped in symlink, got %v", err)
+	}
+
+	// A symlink swapped in as the file itself must not be followed either.
+	if err := os.Symlink(filepath.Join(outside, "secret.txt"), filepath.Join(fs.Path(), "file.txt")); err != nil {
+		t.Fatal(err)
+	}
+
+	if f, err := openBeneath(fs.Path(), filepath.Join(fs.Path(), "file.txt"), os.O_RDONLY, 0); err != InvalidPathResolution {
+		if f != nil {
+			f.Close()
+		}
+		t.Fatalf("expected openBeneath to refuse a symlinked file, got %v", err)
+	}
+}
@@ -0,0 +1,271 @@
+package server
+
+import (
+	"encoding/json"
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// The name of the hidden directory in the root of a server that deleted files are moved
+// into when the trash is enabled.
+const trashDirectory = ".trash"
+
+// Every item in the trash is stored in its own directory, named using the item ID, that
+// contains the deleted file or folder along with a metadata file describing it.
+const (
+	trashDataName     = "data"
+	trashMetadataName = "metadata.json"
+)
+
+// Describes a file or folder that has been moved into the trash.
+type TrashItem struct {
+	Id string `json:"id"`
+
+	// The path of the item relative to the root of the server before it was deleted.
+	Path string `json:"path"`
+
+	Directory bool      `json:"directory"`
+	Size      int64     `json:"size"`
+	DeletedAt time.Time `json:"deleted_at"`
+}
+
+// Returns the absolute path to the trash directory for the server.
+func (fs *Filesystem) trashPath() string {
+	return filepath.Join(fs.Path(), trashDirectory)
+}
+
+// Determines if the given absolute path is the trash directory, or something within it.
+func (fs *Filesystem) isInTrash(p string) bool {
+	return p == fs.trashPath() || strings.HasPrefix(p, fs.trashPath()+string(filepath.Separator))
+}
+
+// Moves a file or folder into the trash and records where it was deleted from so that it
+// can be restored later. The path passed through must already be cleaned.
+func (fs *Filesystem) moveToTrash(cleaned string) error {
+	st, err := os.Lstat(cleaned)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	rel, err := filepath.Rel(fs.Path(), cleaned)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	item := &TrashItem{
+		Id:        uuid.New().String(),
+		Path:      filepath.ToSlash(rel),
+		Directory: st.IsDir(),
+		Size:      st.Size(),
+		DeletedAt: time.Now(),
+	}
+
+	if st.IsDir() {
+		if item.Size, err = fs.DirectorySize(rel); err != nil {
+			return errors.WithStack(err)
+		}
+	}
+
+	d := filepath.Join(fs.trashPath(), item.Id)
+	if err := os.MkdirAll(d, 0700); err != nil {
+		return errors.WithStack(err)
+	}
+
+	b, err := json.Marshal(item)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	if err := ioutil.WriteFile(filepath.Join(d, trashMetadataName), b, 0600); err != nil {
+		return errors.WithStack(err)
+	}
+
+	if err := os.Rename(cleaned, filepath.Join(d, trashDataName)); err != nil {
+		os.RemoveAll(d)
+
+		return errors.WithStack(err)
+	}
+
+	return nil
+}
+
+// Returns all of the items currently in the trash for the server, with the most recently
+// deleted items first.
+func (fs *Filesystem) TrashItems() ([]*TrashItem, error) {
+	entries, err := ioutil.ReadDir(fs.trashPath())
+	if err != nil && !os.IsNotExist(err) {
+		return nil, errors.WithStack(err)
+	}
+
+	out := make([]*TrashItem, 0, len(entries))
+	for _, e := range entries {
+		if !e.IsDir() {
+			continue
+		}
+
+		item, err := fs.trashItem(e.Name())
+		if err != nil {
+			zap.S().Warnw("skipping unreadable item in server trash", zap.String("server", fs.Server.Uuid), zap.String("item", e.Name()), zap.Error(err))
+			continue
+		}
+
+		out = append(out, item)
+	}
+
+	sort.SliceStable(out, func(i, j int) bool {
+		return out[i].DeletedAt.After(out[j].DeletedAt)
+	})
+
+	return out, nil
+}
+
+// Reads the metadata for a single item in the trash.
+func (fs *Filesystem) trashItem(id string) (*TrashItem, error) {
+	// Item IDs are always UUIDs, anything else could be used to escape out of the
+	// trash directory.
+	if _, err := uuid.Parse(id); err != nil {
+		return nil, os.ErrNotExist
+	}
+
+	b, err := ioutil.ReadFile(filepath.Join(fs.trashPath(), id, trashMetadataName))
+	if err != nil {
+		return nil, err
+	}
+
+	item := &TrashItem{}
+	if err := json.Unmarshal(b, item); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	item.Id = id
+
+	return item, nil
+}
+
+// Restores an item from the trash back to the location it was deleted from. If something
+// now exists at that location the item is left in the trash and an error is returned.
+func (fs *Filesystem) RestoreTrashItem(id string) error {
+	item, err := fs.trashItem(id)
+	if err != nil {
+		return err
+	}
+
+	cleaned, err := fs.SafePath(item.Path)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	if cleaned == fs.Path() || fs.isInTrash(cleaned) {
+		return errors.New("cannot restore trash item to an invalid location")
+	}
+
+	if err := fs.CheckProtected(cleaned); err != nil {
+		return err
+	}
+
+	if _, err := os.Lstat(cleaned); err == nil {
+		return &trashRestoreConflict{path: item.Path}
+	} else if !os.IsNotExist(err) {
+		return errors.WithStack(err)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(cleaned), 0755); err != nil {
+		return errors.WithStack(err)
+	}
+
+	if err := os.Rename(filepath.Join(fs.trashPath(), id, trashDataName), cleaned); err != nil {
+		return errors.WithStack(err)
+	}
+
+	return errors.WithStack(os.RemoveAll(filepath.Join(fs.trashPath(), id)))
+}
+
+// Permanently removes the given items from the trash. If no IDs are provided the entire
+// trash is emptied.
+func (fs *Filesystem) PurgeTrash(ids []string) error {
+	if len(ids) == 0 {
+		return errors.WithStack(os.RemoveAll(fs.trashPath()))
+	}
+
+	for _, id := range ids {
+		if _, err := fs.trashItem(id); err != nil {
+			return err
+		}
+
+		if err := os.RemoveAll(filepath.Join(fs.trashPath(), id)); err != nil {
+			return errors.WithStack(err)
+		}
+	}
+
+	return nil
+}
+
+// Permanently removes any items that have been in the trash for longer than the given
+// duration.
+func (fs *Filesystem) PurgeExpiredTrash(age time.Duration) error {
+	items, err := fs.TrashItems()
+	if err != nil {
+		return err
+	}
+
+	var expired []string
+	for _, item := range items {
+		if time.Since(item.DeletedAt) > age {
+			expired = append(expired, item.Id)
+		}
+	}
+
+	if len(expired) == 0 {
+		return nil
+	}
+
+	zap.S().Debugw("purging expired items from server trash", zap.String("server", fs.Server.Uuid), zap.Int("count", len(expired)))
+
+	return fs.PurgeTrash(expired)
+}
+
+// Removes the oldest items from the trash until the disk space used by the server falls
+// under the given limit, or the trash is empty. Returns the amount of space that is still
+// being used by the server after the purge.
+func (fs *Filesystem) reclaimTrashSpace(used int64, limit int64) int64 {
+	items, err := fs.TrashItems()
+	if err != nil {
+		zap.S().Warnw("failed to read server trash while reclaiming disk space", zap.String("server", fs.Server.Uuid), zap.Error(err))
+		return used
+	}
+
+	for i := len(items) - 1; i >= 0 && used > limit; i-- {
+		if err := os.RemoveAll(filepath.Join(fs.trashPath(), items[i].Id)); err != nil {
+			zap.S().Warnw("failed to purge item from server trash", zap.String("server", fs.Server.Uuid), zap.String("item", items[i].Id), zap.Error(err))
+			continue
+		}
+
+		zap.S().Infow("purged item from server trash to reclaim disk space", zap.String("server", fs.Server.Uuid), zap.String("path", items[i].Path))
+
+		used -= items[i].Size
+	}
+
+	return used
+}
+
+// Starts a background loop that removes expired items from the trash of every server
+// once an hour.
+func StartTrashJanitor(maxAge int) {
+	go func() {
+		for {
+			for _, s := range GetServers().All() {
+				if err := s.Filesystem.PurgeExpiredTrash(time.Duration(maxAge) * time.Hour); err != nil {
+					zap.S().Warnw("failed to purge expired items from server trash", zap.String("server", s.Uuid), zap.Error(err))
+				}
+			}
+
+			time.Sleep(time.Hour)
+		}
+	}()
+}
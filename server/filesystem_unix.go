@@ -0,0 +1,76 @@
+//go:build !windows
+// +build !windows
+
+package server
+
+import (
+	"golang.org/x/sys/unix"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+)
+
+// Opens a file below the root directory one path component at a time, refusing to follow
+// a symlink at any point. The path must already have been validated and have had every
+// symlink in it resolved, so a symlink found now was swapped in after it was validated,
+// and opening the file fails rather than following it outside of the root.
+func openBeneath(root string, p string, flag int, perm os.FileMode) (*os.File, error) {
+	rel, err := filepath.Rel(root, p)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return nil, InvalidPathResolution
+	}
+
+	fd, err := unix.Open(root, unix.O_RDONLY|unix.O_DIRECTORY|unix.O_CLOEXEC, 0)
+	if err != nil {
+		return nil, &os.PathError{Op: "open", Path: root, Err: err}
+	}
+
+	if rel == "." {
+		return os.NewFile(uintptr(fd), root), nil
+	}
+
+	parts := strings.Split(rel, string(filepath.Separator))
+	for i, part := range parts {
+		last := i == len(parts)-1
+
+		f := unix.O_RDONLY | unix.O_DIRECTORY | unix.O_NOFOLLOW | unix.O_CLOEXEC
+		if last {
+			f = flag | unix.O_NOFOLLOW | unix.O_CLOEXEC
+		}
+
+		next, err := unix.Openat(fd, part, f, uint32(perm.Perm()))
+		unix.Close(fd)
+
+		if err != nil {
+			// A symlink in the final component is reported as ELOOP, and one in a directory
+			// component as ENOTDIR since it was opened with O_DIRECTORY.
+			if err == unix.ELOOP || (err == unix.ENOTDIR && !last) {
+				if st, lerr := os.Lstat(filepath.Join(root, filepath.Join(parts[:i+1]...))); lerr == nil && st.Mode()&os.ModeSymlink != 0 {
+					return nil, InvalidPathResolution
+				}
+			}
+
+			return nil, &os.PathError{Op: "open", Path: p, Err: err}
+		}
+
+		fd = next
+	}
+
+	return os.NewFile(uintptr(fd), p), nil
+}
+
+// Returns an error if the file has more than one hard link. The other links could be
+// anywhere on the same filesystem, including outside of the server root, so changing a file
+// through the link inside of the root could change a file that the server cannot access.
+func checkHardLinks(st os.FileInfo) error {
+	if !st.Mode().IsRegular() {
+		return nil
+	}
+
+	if s, ok := st.Sys().(*syscall.Stat_t); ok && s.Nlink > 1 {
+		return InvalidPathResolution
+	}
+
+	return nil
+}
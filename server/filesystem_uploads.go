@@ -0,0 +1,113 @@
+package server
+
+import (
+	"github.com/pterodactyl/wings/config"
+	"github.com/pterodactyl/wings/throttle"
+	"io"
+	"sync"
+)
+
+type tooManyUploadsError struct {
+	node bool
+}
+
+func (e *tooManyUploadsError) Error() string {
+	if e.node {
+		return "too many uploads are currently in progress on this node"
+	}
+
+	return "too many uploads are currently in progress for this server"
+}
+
+func IsTooManyUploadsError(err error) bool {
+	_, ok := err.(*tooManyUploadsError)
+
+	return ok
+}
+
+// Tracks the number of uploads or downloads in progress and the bandwidth they share,
+// either for a single server or for the entire node.
+type transferLimiter struct {
+	mu     sync.Mutex
+	active int
+	bucket *throttle.Bucket
+}
+
+// Tracks the uploads in progress across every server on the node.
+var nodeUploads transferLimiter
+
+// Registers a new transfer, returning false if the concurrency limit has already been
+// reached. The bandwidth limit is updated each time so that configuration changes apply
+// without needing to restart the daemon.
+func (l *transferLimiter) acquire(limit int, rate int64) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if limit > 0 && l.active >= limit {
+		return false
+	}
+
+	l.active++
+	if l.bucket == nil {
+		l.bucket = throttle.NewBucket(rate)
+	} else {
+		l.bucket.SetRate(rate)
+	}
+
+	return true
+}
+
+func (l *transferLimiter) release() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.active > 0 {
+		l.active--
+	}
+}
+
+// An upload that is in progress for a server. Data for the upload should be passed through
+// the upload so that it is throttled, and Done must be called once it has finished.
+type Upload struct {
+	server *transferLimiter
+	once   sync.Once
+}
+
+// Starts a new upload for the server. If either the server or the node already has the
+// maximum number of uploads in progress an error is returned.
+func (fs *Filesystem) BeginUpload() (*Upload, error) {
+	cfg := config.Get().System.Uploads
+
+	if !nodeUploads.acquire(cfg.NodeConcurrency, cfg.NodeBandwidth*1024) {
+		return nil, &tooManyUploadsError{node: true}
+	}
+
+	if !fs.Server.uploads.acquire(cfg.ServerConcurrency, cfg.ServerBandwidth*1024) {
+		nodeUploads.release()
+
+		return nil, &tooManyUploadsError{}
+	}
+
+	return &Upload{server: &fs.Server.uploads}, nil
+}
+
+// Returns a reader that throttles the data read for the upload to the configured server
+// and node bandwidth limits.
+func (u *Upload) Reader(r io.Reader) io.Reader {
+	return throttle.Reader(r, u.server.bucket, nodeUploads.bucket)
+}
+
+// Blocks until n bytes of upload data are allowed by the configured bandwidth limits. This
+// is used when the upload is not being read through a reader, such as over SFTP.
+func (u *Upload) Wait(n int) {
+	u.server.bucket.Wait(n)
+	nodeUploads.bucket.Wait(n)
+}
+
+// Marks the upload as finished, allowing another upload to take its place.
+func (u *Upload) Done() {
+	u.once.Do(func() {
+		u.server.release()
+		nodeUploads.release()
+	})
+}
@@ -0,0 +1,371 @@
+package server
+
+import (
+	"github.com/fsnotify/fsnotify"
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Changes are collected for this long before the directories they were made in are read
+// again, so that a file being written to constantly does not cause constant reads.
+const usageDebounce = time.Second
+
+// Tracks the disk space used by a server using filesystem notifications. The size of the
+// files directly within every directory is recorded, and when a notification is received
+// for a directory only that directory is read again, rather than the entire server. The
+// whole directory is walked again every so often to correct any drift.
+type usageTracker struct {
+	fs *Filesystem
+
+	// Only a single walk of the entire server directory is run at a time.
+	walkMu sync.Mutex
+
+	mu          sync.Mutex
+	sizes       map[string]int64
+	total       int64
+	ready       bool
+	closed      bool
+	reconciling bool
+	stale       bool
+	walked      time.Time
+	failed      time.Time
+
+	// The directories that have changed since they were last read, which is kept behind
+	// its own lock so that notifications are never blocked by a walk of the directory.
+	dirtyMu sync.Mutex
+	dirty   map[string]bool
+	timer   *time.Timer
+}
+
+func newUsageTracker(fs *Filesystem) *usageTracker {
+	return &usageTracker{
+		fs:    fs,
+		sizes: make(map[string]int64),
+		dirty: make(map[string]bool),
+	}
+}
+
+// Returns the disk space used by the server in bytes as tracked using filesystem
+// notifications. False is returned if the usage is not being tracked, in which case it
+// must be determined by walking the server directory instead.
+func (fs *Filesystem) TrackedUsage() (int64, bool) {
+	if fs.usage == nil || !fs.Configuration.DiskUsage.Incremental {
+		return 0, false
+	}
+
+	return fs.usage.usage(time.Duration(fs.Configuration.DiskUsage.ReconcileInterval) * time.Minute)
+}
+
+// Stops tracking the disk space used by the server, removing every watch that was added
+// for its directories.
+func (fs *Filesystem) StopUsageTracking() {
+	if fs.usage != nil {
+		fs.usage.close()
+	}
+}
+
+func (t *usageTracker) usage(interval time.Duration) (int64, bool) {
+	t.mu.Lock()
+	if t.closed {
+		t.mu.Unlock()
+		return 0, false
+	}
+
+	if t.ready {
+		if (t.stale || time.Since(t.walked) > interval) && !t.reconciling {
+			t.reconciling = true
+
+			go func() {
+				if err := t.reconcile(false); err != nil {
+					t.fail(err)
+				}
+			}()
+		}
+
+		total := t.total
+		t.mu.Unlock()
+
+		return total, true
+	}
+
+	// Tracking is not attempted again until the reconcile interval has passed since it
+	// last failed, which is usually because the limit on the number of watches was hit.
+	if !t.failed.IsZero() && time.Since(t.failed) < interval {
+		t.mu.Unlock()
+		return 0, false
+	}
+	t.mu.Unlock()
+
+	if err := t.reconcile(true); err != nil {
+		t.fail(err)
+		return 0, false
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	return t.total, t.ready
+}
+
+// Walks the entire server directory, replacing the tracked sizes with the ones found. The
+// walk is done without holding the lock so that the usage can still be read while it runs,
+// and changes made during the walk are only applied once it has completed.
+func (t *usageTracker) reconcile(initial bool) error {
+	t.walkMu.Lock()
+	defer t.walkMu.Unlock()
+
+	t.mu.Lock()
+	if t.closed || (initial && t.ready) {
+		t.mu.Unlock()
+		return nil
+	}
+	t.reconciling = true
+	t.mu.Unlock()
+
+	sizes := make(map[string]int64)
+	err := t.walk(t.fs.Path(), sizes)
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.reconciling = false
+
+	if t.closed {
+		for p := range sizes {
+			hub.remove(p, t)
+		}
+
+		return nil
+	}
+
+	if err != nil {
+		for p := range sizes {
+			if _, ok := t.sizes[p]; !ok {
+				hub.remove(p, t)
+			}
+		}
+
+		return err
+	}
+
+	for p := range t.sizes {
+		if _, ok := sizes[p]; !ok {
+			hub.remove(p, t)
+		}
+	}
+
+	var total int64
+	for _, size := range sizes {
+		total += size
+	}
+
+	t.sizes = sizes
+	t.total = total
+	t.ready = true
+	t.stale = false
+	t.walked = time.Now()
+
+	return nil
+}
+
+// Walks a directory, recording the size of the files directly within each directory and
+// watching every directory for changes. The watch is added before the directory is read
+// so that no changes are missed in between.
+func (t *usageTracker) walk(dir string, sizes map[string]int64) error {
+	if err := hub.add(dir, t); err != nil {
+		return err
+	}
+	sizes[dir] = 0
+
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		// The directory was removed while the walk was running, which the notification
+		// for its parent directory will take care of.
+		if os.IsNotExist(err) {
+			return nil
+		}
+
+		return errors.WithStack(err)
+	}
+
+	var size int64
+	for _, f := range files {
+		if f.IsDir() {
+			if err := t.walk(filepath.Join(dir, f.Name()), sizes); err != nil {
+				return err
+			}
+
+			continue
+		}
+
+		size += f.Size()
+	}
+
+	sizes[dir] = size
+
+	return nil
+}
+
+// Reads a directory that has changed again, walking any directories that were added to it
+// and forgetting any that were removed. Must be called while holding the lock.
+func (t *usageTracker) rescan(dir string) error {
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			t.drop(dir)
+			return nil
+		}
+
+		return errors.WithStack(err)
+	}
+
+	var size int64
+	seen := make(map[string]bool)
+	for _, f := range files {
+		if !f.IsDir() {
+			size += f.Size()
+			continue
+		}
+
+		p := filepath.Join(dir, f.Name())
+		seen[p] = true
+
+		if _, ok := t.sizes[p]; ok {
+			continue
+		}
+
+		sizes := make(map[string]int64)
+		err := t.walk(p, sizes)
+		for d, s := range sizes {
+			t.sizes[d] = s
+			t.total += s
+		}
+
+		if err != nil {
+			return err
+		}
+	}
+
+	t.total += size - t.sizes[dir]
+	t.sizes[dir] = size
+
+	for p := range t.sizes {
+		if filepath.Dir(p) == dir && p != dir && !seen[p] {
+			t.drop(p)
+		}
+	}
+
+	return nil
+}
+
+// Forgets a directory and everything within it. Must be called while holding the lock.
+func (t *usageTracker) drop(dir string) {
+	for p, size := range t.sizes {
+		if p == dir || strings.HasPrefix(p, dir+string(filepath.Separator)) {
+			t.total -= size
+			delete(t.sizes, p)
+			hub.remove(p, t)
+		}
+	}
+}
+
+// Marks the directory that a change was made in as needing to be read again.
+func (t *usageTracker) notify(e fsnotify.Event) {
+	t.dirtyMu.Lock()
+	defer t.dirtyMu.Unlock()
+
+	t.dirty[filepath.Dir(e.Name)] = true
+	if t.timer == nil {
+		t.timer = time.AfterFunc(usageDebounce, t.flush)
+	}
+}
+
+// Notifications were dropped, so the tracked usage can no longer be trusted until the
+// server directory has been walked again.
+func (t *usageTracker) overflow() {
+	t.mu.Lock()
+	t.stale = true
+	t.mu.Unlock()
+}
+
+func (t *usageTracker) flush() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.dirtyMu.Lock()
+	// Changes made while the server directory is being walked are held on to until the
+	// walk has completed, otherwise they would be overwritten by the result of the walk.
+	if t.reconciling && !t.closed {
+		t.timer = time.AfterFunc(usageDebounce, t.flush)
+		t.dirtyMu.Unlock()
+		return
+	}
+
+	dirty := t.dirty
+	t.dirty = make(map[string]bool)
+	t.timer = nil
+	t.dirtyMu.Unlock()
+
+	if !t.ready || t.closed {
+		return
+	}
+
+	for dir := range dirty {
+		if _, ok := t.sizes[dir]; !ok {
+			continue
+		}
+
+		if err := t.rescan(dir); err != nil {
+			t.abandon(err)
+			return
+		}
+	}
+}
+
+func (t *usageTracker) fail(err error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.abandon(err)
+}
+
+// Stops tracking the usage after a failure, falling back to walking the server directory
+// until tracking is attempted again. Must be called while holding the lock.
+func (t *usageTracker) abandon(err error) {
+	t.reset()
+	t.failed = time.Now()
+
+	zap.S().Warnw("failed to track server disk usage using filesystem notifications", zap.String("server", t.fs.Server.Uuid), zap.Error(err))
+}
+
+func (t *usageTracker) close() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.reset()
+	t.closed = true
+
+	t.dirtyMu.Lock()
+	if t.timer != nil {
+		t.timer.Stop()
+		t.timer = nil
+	}
+	t.dirtyMu.Unlock()
+}
+
+// Removes every watch and forgets the tracked usage. Must be called while holding the lock.
+func (t *usageTracker) reset() {
+	for p := range t.sizes {
+		hub.remove(p, t)
+	}
+
+	t.sizes = make(map[string]int64)
+	t.total = 0
+	t.ready = false
+}
@@ -0,0 +1,187 @@
+package server
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"github.com/pkg/errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// Describes a previous version of a file that was saved before it was overwritten.
+type FileVersion struct {
+	Id        string    `json:"id"`
+	Size      int64     `json:"size"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Returns the directory that contains all of the saved versions for the server.
+func (fs *Filesystem) versionsPath() string {
+	return filepath.Join(fs.Configuration.VersionDirectory, fs.Server.Uuid)
+}
+
+// Returns the directory that the versions of a specific file are stored in. The path is
+// hashed so that files in deeply nested directories do not need that structure to be
+// mirrored within the version directory.
+func (fs *Filesystem) fileVersionsPath(cleaned string) (string, error) {
+	rel, err := filepath.Rel(fs.Path(), cleaned)
+	if err != nil {
+		return "", errors.WithStack(err)
+	}
+
+	h := sha256.Sum256([]byte(filepath.ToSlash(rel)))
+
+	return filepath.Join(fs.versionsPath(), hex.EncodeToString(h[:])), nil
+}
+
+// Saves a copy of the file as it currently exists on the disk so that it can be restored
+// later. Nothing is saved if versioning is disabled, the file does not exist yet, or the
+// file is larger than the configured size limit. Once saved, any versions beyond the
+// configured limit are removed, oldest first.
+func (fs *Filesystem) SaveVersion(p string) error {
+	cfg := fs.Configuration.FileVersions
+	if cfg.Limit <= 0 {
+		return nil
+	}
+
+	cleaned, err := fs.SafePath(p)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	st, err := os.Stat(cleaned)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+
+		return errors.WithStack(err)
+	}
+
+	if !st.Mode().IsRegular() || st.Size() > cfg.MaxFileSize*1024 {
+		return nil
+	}
+
+	d, err := fs.fileVersionsPath(cleaned)
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(d, 0700); err != nil {
+		return errors.WithStack(err)
+	}
+
+	src, err := fs.OpenFile(cleaned, os.O_RDONLY, 0)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	defer src.Close()
+
+	dst, err := os.OpenFile(filepath.Join(d, strconv.FormatInt(time.Now().UnixNano(), 10)), os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	defer dst.Close()
+
+	if _, err := io.Copy(dst, src); err != nil {
+		return errors.WithStack(err)
+	}
+
+	versions, err := fs.FileVersions(p)
+	if err != nil {
+		return err
+	}
+
+	for i := cfg.Limit; i < len(versions); i++ {
+		if err := os.Remove(filepath.Join(d, versions[i].Id)); err != nil && !os.IsNotExist(err) {
+			return errors.WithStack(err)
+		}
+	}
+
+	return nil
+}
+
+// Returns the saved versions of a file, with the most recent version first.
+func (fs *Filesystem) FileVersions(p string) ([]*FileVersion, error) {
+	cleaned, err := fs.SafePath(p)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	d, err := fs.fileVersionsPath(cleaned)
+	if err != nil {
+		return nil, err
+	}
+
+	files, err := ioutil.ReadDir(d)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, errors.WithStack(err)
+	}
+
+	out := make([]*FileVersion, 0, len(files))
+	for _, f := range files {
+		ts, err := strconv.ParseInt(f.Name(), 10, 64)
+		if err != nil || f.IsDir() {
+			continue
+		}
+
+		out = append(out, &FileVersion{
+			Id:        f.Name(),
+			Size:      f.Size(),
+			CreatedAt: time.Unix(0, ts),
+		})
+	}
+
+	sort.SliceStable(out, func(i, j int) bool {
+		return out[i].CreatedAt.After(out[j].CreatedAt)
+	})
+
+	return out, nil
+}
+
+// Restores a saved version of a file, replacing its current contents. The current contents
+// are saved as a new version first so that the restoration itself can be undone, but only
+// once the version has been found, so that a bad request does not save a version.
+func (fs *Filesystem) RestoreVersion(p string, id string) error {
+	cleaned, err := fs.SafePath(p)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	// Version IDs are always timestamps, anything else could be used to read files from
+	// outside of the version directory.
+	if _, err := strconv.ParseInt(id, 10, 64); err != nil {
+		return &versionNotFound{id: id}
+	}
+
+	d, err := fs.fileVersionsPath(cleaned)
+	if err != nil {
+		return err
+	}
+
+	b, err := ioutil.ReadFile(filepath.Join(d, id))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return &versionNotFound{id: id}
+		}
+
+		return errors.WithStack(err)
+	}
+
+	if err := fs.SaveVersion(p); err != nil {
+		return err
+	}
+
+	return fs.Writefile(p, bytes.NewReader(b))
+}
+
+// Removes all of the saved file versions for the server.
+func (fs *Filesystem) PurgeVersions() error {
+	return errors.WithStack(os.RemoveAll(fs.versionsPath()))
+}
@@ -0,0 +1,287 @@
+package server
+
+import (
+	"github.com/fsnotify/fsnotify"
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// The actions reported for a file in a watched directory.
+const (
+	FileCreated  = "create"
+	FileModified = "modify"
+	FileDeleted  = "delete"
+)
+
+// Changes in a watched directory are collected for this long before they are reported,
+// so that a process writing a large number of files does not produce a flood of events.
+const watchDebounce = time.Millisecond * 250
+
+// A change to a file in a watched directory.
+type FileChange struct {
+	Action string `json:"action"`
+	// The path of the file relative to the root of the server.
+	Path string `json:"path"`
+}
+
+// Watches a single directory of a server for changes to the files directly within it.
+// Changes are reported in batches to the function that the watcher was created with.
+type DirectoryWatcher struct {
+	mu sync.Mutex
+
+	dir      string
+	relative string
+	fn       func([]FileChange)
+
+	pending map[string]string
+	timer   *time.Timer
+	closed  bool
+}
+
+// Receives the events for the directories it has been added to the hub for.
+type watchSubscriber interface {
+	// Called for every event on a file directly within a directory being watched.
+	notify(e fsnotify.Event)
+	// Called when events were dropped because they could not be processed quickly enough.
+	overflow()
+}
+
+// Everything watching directories on the node shares a single inotify instance, since the
+// number of instances that a user is allowed to create is usually very low.
+type watchHub struct {
+	mu       sync.Mutex
+	watcher  *fsnotify.Watcher
+	watchers map[string]map[watchSubscriber]bool
+}
+
+var hub = &watchHub{watchers: make(map[string]map[watchSubscriber]bool)}
+
+func (h *watchHub) add(dir string, sub watchSubscriber) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.watcher == nil {
+		fw, err := fsnotify.NewWatcher()
+		if err != nil {
+			return errors.WithStack(err)
+		}
+
+		h.watcher = fw
+		go h.run(fw)
+	}
+
+	// The directory is always added, even if it is already being watched, since the watch
+	// is dropped without notice if the directory was removed and then created again.
+	if err := h.watcher.Add(dir); err != nil {
+		return errors.WithStack(err)
+	}
+
+	if _, ok := h.watchers[dir]; !ok {
+		h.watchers[dir] = make(map[watchSubscriber]bool)
+	}
+
+	h.watchers[dir][sub] = true
+
+	return nil
+}
+
+func (h *watchHub) remove(dir string, sub watchSubscriber) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	subs, ok := h.watchers[dir]
+	if !ok {
+		return
+	}
+
+	delete(subs, sub)
+	if len(subs) == 0 {
+		delete(h.watchers, dir)
+
+		// The directory may have been removed already, in which case it is no longer
+		// being watched anyways.
+		h.watcher.Remove(dir)
+	}
+}
+
+func (h *watchHub) run(fw *fsnotify.Watcher) {
+	for {
+		select {
+		case e, ok := <-fw.Events:
+			if !ok {
+				return
+			}
+
+			h.dispatch(e)
+		case err, ok := <-fw.Errors:
+			if !ok {
+				return
+			}
+
+			if err == fsnotify.ErrEventOverflow {
+				for _, sub := range h.subscribers("") {
+					sub.overflow()
+				}
+				continue
+			}
+
+			zap.S().Debugw("error while watching server directories", zap.Error(err))
+		}
+	}
+}
+
+// Returns the subscribers for a directory, or every subscriber if no directory is given.
+func (h *watchHub) subscribers(dir string) []watchSubscriber {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	seen := make(map[watchSubscriber]bool)
+	for d, subs := range h.watchers {
+		if dir != "" && d != dir {
+			continue
+		}
+
+		for sub := range subs {
+			seen[sub] = true
+		}
+	}
+
+	out := make([]watchSubscriber, 0, len(seen))
+	for sub := range seen {
+		out = append(out, sub)
+	}
+
+	return out
+}
+
+func (h *watchHub) dispatch(e fsnotify.Event) {
+	for _, sub := range h.subscribers(filepath.Dir(e.Name)) {
+		sub.notify(e)
+	}
+}
+
+// Starts watching a directory of the server, calling the function with the changes made
+// to the files within it until the watcher is closed. Only the directory itself is watched,
+// changes made within its subdirectories are not reported.
+func (fs *Filesystem) WatchDirectory(p string, fn func([]FileChange)) (*DirectoryWatcher, error) {
+	cleaned, err := fs.SafePath(p)
+	if err != nil {
+		return nil, err
+	}
+
+	if st, err := os.Stat(cleaned); err != nil {
+		return nil, errors.WithStack(err)
+	} else if !st.IsDir() {
+		return nil, errors.New("cannot watch a file, only directories")
+	}
+
+	rel, err := filepath.Rel(fs.Path(), cleaned)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	relative := "/" + filepath.ToSlash(rel)
+	if rel == "." {
+		relative = "/"
+	}
+
+	w := &DirectoryWatcher{
+		dir:      cleaned,
+		relative: relative,
+		fn:       fn,
+		pending:  make(map[string]string),
+	}
+
+	if err := hub.add(w.dir, w); err != nil {
+		return nil, err
+	}
+
+	return w, nil
+}
+
+// Stops watching the directory. Changes that have not been reported yet are discarded.
+func (w *DirectoryWatcher) Close() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.closed {
+		return
+	}
+	w.closed = true
+
+	if w.timer != nil {
+		w.timer.Stop()
+	}
+
+	hub.remove(w.dir, w)
+}
+
+// Records a change to a file, merging it with any change to the same file that has not
+// been reported yet. A file that was created and then modified is still reported as
+// having been created.
+func (w *DirectoryWatcher) notify(e fsnotify.Event) {
+	var action string
+	switch {
+	case e.Op&fsnotify.Create != 0:
+		action = FileCreated
+	case e.Op&(fsnotify.Remove|fsnotify.Rename) != 0:
+		action = FileDeleted
+	case e.Op&(fsnotify.Write|fsnotify.Chmod) != 0:
+		action = FileModified
+	default:
+		return
+	}
+
+	name := filepath.Base(e.Name)
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.closed {
+		return
+	}
+
+	if w.pending[name] != FileCreated || action != FileModified {
+		w.pending[name] = action
+	}
+
+	if w.timer == nil {
+		w.timer = time.AfterFunc(watchDebounce, w.flush)
+	}
+}
+
+// Changes that were dropped cannot be recovered, the client is expected to refresh the
+// directory on its own every so often.
+func (w *DirectoryWatcher) overflow() {}
+
+func (w *DirectoryWatcher) flush() {
+	w.mu.Lock()
+	if w.closed {
+		w.mu.Unlock()
+		return
+	}
+
+	changes := make([]FileChange, 0, len(w.pending))
+	for name, action := range w.pending {
+		changes = append(changes, FileChange{
+			Action: action,
+			Path:   strings.TrimSuffix(w.relative, "/") + "/" + name,
+		})
+	}
+
+	w.pending = make(map[string]string)
+	w.timer = nil
+	w.mu.Unlock()
+
+	sort.Slice(changes, func(i, j int) bool {
+		return changes[i].Path < changes[j].Path
+	})
+
+	w.fn(changes)
+}
@@ -1,6 +1,7 @@
 package server
 
 import (
+	"os"
 	"time"
 )
 
@@ -9,4 +10,15 @@ import (
 // for right now.
 func (s *Stat) CTime() time.Time {
 	return s.Info.ModTime()
-}
\ No newline at end of file
+}
+
+// Opens a file below the root directory. Symlinks require elevated privileges to create on
+// Windows, so the path that was validated is opened directly.
+func openBeneath(root string, p string, flag int, perm os.FileMode) (*os.File, error) {
+	return os.OpenFile(p, flag, perm)
+}
+
+// Hard links cannot be created by the users of a server on Windows.
+func checkHardLinks(st os.FileInfo) error {
+	return nil
+}
@@ -0,0 +1,344 @@
+package server
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/pkg/errors"
+	"github.com/pterodactyl/wings/config"
+	"github.com/pterodactyl/wings/store"
+	"go.uber.org/zap"
+	"net"
+	"os/exec"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// A rule accepting traffic for a single port assigned to a server. Each rule applies to a
+// single protocol, so every allocation needs one rule for TCP and another for UDP.
+type firewallRule struct {
+	Ip       string `json:"ip"`
+	Port     int    `json:"port"`
+	Protocol string `json:"protocol"`
+}
+
+func (r firewallRule) String() string {
+	return net.JoinHostPort(normalizeAllocationIp(r.Ip), strconv.Itoa(r.Port)) + "/" + r.Protocol
+}
+
+// Determines if the rule applies to every address on the host, rather than a single one.
+func (r firewallRule) anyAddress() bool {
+	ip := net.ParseIP(normalizeAllocationIp(r.Ip))
+
+	return ip == nil || ip.IsUnspecified()
+}
+
+// Adds and removes the rules for the ports assigned to servers in the firewall of the host.
+type firewall interface {
+	open(uuid string, rules []firewallRule) error
+	close(uuid string, rules []firewallRule) error
+}
+
+var (
+	// Only one change is made to the firewall at a time, so that the rules stored for each
+	// server always match those that were actually added.
+	firewallMu    sync.Mutex
+	firewallState = store.NewRepository(store.FirewallRules)
+)
+
+// Returns the firewall configured for the node.
+func getFirewall() firewall {
+	cfg := config.Get().System.Firewall
+	if cfg.Backend == config.FirewallNftables {
+		return &nftFirewall{table: cfg.Table, chain: cfg.Chain}
+	}
+
+	return &firewalldFirewall{zone: cfg.Zone}
+}
+
+// Returns the firewall rules needed for the allocations of the server.
+func (s *Server) allocationFirewallRules() []firewallRule {
+	s.RLock()
+	defer s.RUnlock()
+
+	var rules []firewallRule
+	for ip, ports := range s.Allocations.Mappings {
+		for _, port := range ports {
+			if port < 1 || port > 65535 {
+				continue
+			}
+
+			rules = append(rules, firewallRule{Ip: ip, Port: port, Protocol: "tcp"}, firewallRule{Ip: ip, Port: port, Protocol: "udp"})
+		}
+	}
+
+	return rules
+}
+
+// Opens the ports assigned to the server in the firewall of the host and closes any that
+// are no longer assigned to it. The first time this runs for a server every rule is added
+// again, in case the rules were lost while the daemon was not running.
+func (s *Server) SyncFirewall() error {
+	if !config.Get().System.Firewall.Enabled {
+		return nil
+	}
+
+	firewallMu.Lock()
+	defer firewallMu.Unlock()
+
+	var current []firewallRule
+	if _, err := firewallState.Get(s.Uuid, &current); err != nil {
+		return err
+	}
+
+	wanted := s.allocationFirewallRules()
+
+	s.Lock()
+	applied := s.firewallApplied
+	s.firewallApplied = true
+	s.Unlock()
+
+	var add, remove []firewallRule
+	if applied {
+		add, remove = diffFirewallRules(current, wanted), diffFirewallRules(wanted, current)
+	} else {
+		add, remove = wanted, current
+	}
+
+	// If anything fails every rule is added again the next time this runs. The rules that
+	// are wanted are stored regardless, since removing a rule that was never added is not
+	// an error, while forgetting one that was added would leave the port open.
+	err := s.applyFirewallRules(add, remove)
+	if err != nil {
+		s.Lock()
+		s.firewallApplied = false
+		s.Unlock()
+
+		wanted = append(wanted, diffFirewallRules(current, wanted)...)
+	}
+
+	if len(wanted) == 0 {
+		return firewallState.Delete(s.Uuid)
+	}
+
+	if perr := firewallState.Put(s.Uuid, wanted); perr != nil {
+		return perr
+	}
+
+	return err
+}
+
+// Removes and then adds the given rules in the firewall of the host.
+func (s *Server) applyFirewallRules(add []firewallRule, remove []firewallRule) error {
+	fw := getFirewall()
+	if len(remove) > 0 {
+		if err := fw.close(s.Uuid, remove); err != nil {
+			return err
+		}
+	}
+
+	if len(add) > 0 {
+		return fw.open(s.Uuid, add)
+	}
+
+	return nil
+}
+
+// Closes every port opened in the firewall of the host for the server, this should be
+// called when the server is deleted from the node.
+func (s *Server) CloseFirewall() error {
+	if !config.Get().System.Firewall.Enabled {
+		return nil
+	}
+
+	firewallMu.Lock()
+	defer firewallMu.Unlock()
+
+	return closeFirewallRules(s.Uuid)
+}
+
+// Closes the ports opened for servers that no longer exist on this node, such as those
+// deleted while the firewall could not be reached.
+func CloseStaleFirewallRules() {
+	if !config.Get().System.Firewall.Enabled {
+		return
+	}
+
+	firewallMu.Lock()
+	defer firewallMu.Unlock()
+
+	var stale []string
+	err := firewallState.Each(func(uuid string, _ []byte) error {
+		s := GetServers().Find(func(s *Server) bool {
+			return s.Uuid == uuid
+		})
+		if s == nil {
+			stale = append(stale, uuid)
+		}
+
+		return nil
+	})
+	if err != nil {
+		zap.S().Warnw("failed to read firewall rules from state store", zap.Error(err))
+		return
+	}
+
+	for _, uuid := range stale {
+		if err := closeFirewallRules(uuid); err != nil {
+			zap.S().Warnw("failed to close firewall ports of removed server", zap.String("server", uuid), zap.Error(err))
+		}
+	}
+}
+
+// Removes the rules stored for a server from the firewall. The lock must be held when
+// this is called.
+func closeFirewallRules(uuid string) error {
+	var current []firewallRule
+	if found, err := firewallState.Get(uuid, &current); err != nil || !found {
+		return err
+	}
+
+	if err := getFirewall().close(uuid, current); err != nil {
+		return err
+	}
+
+	return firewallState.Delete(uuid)
+}
+
+// Returns the rules in a that are not in b.
+func diffFirewallRules(a []firewallRule, b []firewallRule) []firewallRule {
+	exists := make(map[firewallRule]bool, len(b))
+	for _, r := range b {
+		exists[r] = true
+	}
+
+	var out []firewallRule
+	for _, r := range a {
+		if !exists[r] {
+			out = append(out, r)
+		}
+	}
+
+	return out
+}
+
+// Runs a firewall command on the host, returning an error including the output of the
+// command if it does not exit cleanly.
+func runFirewallCommand(stdin string, name string, args ...string) ([]byte, error) {
+	cmd := exec.Command(name, args...)
+	if stdin != "" {
+		cmd.Stdin = strings.NewReader(stdin)
+	}
+
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		return out, errors.Wrap(err, fmt.Sprintf("%s: %s", name, strings.TrimSpace(string(out))))
+	}
+
+	return out, nil
+}
+
+// Opens ports using rich rules in a firewalld zone. Every change is made to both the
+// running firewall and its permanent configuration, so that it survives a reload.
+type firewalldFirewall struct {
+	zone string
+}
+
+func (f *firewalldFirewall) richRule(r firewallRule) string {
+	if r.anyAddress() {
+		return fmt.Sprintf(`rule port port="%d" protocol="%s" accept`, r.Port, r.Protocol)
+	}
+
+	family := "ipv4"
+	if isIpv6Allocation(r.Ip) {
+		family = "ipv6"
+	}
+
+	return fmt.Sprintf(`rule family="%s" destination address="%s" port port="%d" protocol="%s" accept`, family, normalizeAllocationIp(r.Ip), r.Port, r.Protocol)
+}
+
+func (f *firewalldFirewall) apply(flag string, rules []firewallRule) error {
+	args := []string{"--zone=" + f.zone}
+	for _, r := range rules {
+		args = append(args, flag+"="+f.richRule(r))
+	}
+
+	if _, err := runFirewallCommand("", "firewall-cmd", args...); err != nil {
+		return err
+	}
+
+	_, err := runFirewallCommand("", "firewall-cmd", append([]string{"--permanent"}, args...)...)
+
+	return err
+}
+
+func (f *firewalldFirewall) open(uuid string, rules []firewallRule) error {
+	return f.apply("--add-rich-rule", rules)
+}
+
+func (f *firewalldFirewall) close(uuid string, rules []firewallRule) error {
+	return f.apply("--remove-rich-rule", rules)
+}
+
+// Opens ports by adding rules to an existing nftables chain. Each rule is given a comment
+// naming the server and port it is for, which is used to find the rule again to remove it.
+type nftFirewall struct {
+	table string
+	chain string
+}
+
+var nftHandleRegex = regexp.MustCompile(`comment "([^"]*)" # handle (\d+)`)
+
+func (f *nftFirewall) comment(uuid string, r firewallRule) string {
+	return "pterodactyl " + uuid + " " + r.String()
+}
+
+func (f *nftFirewall) open(uuid string, rules []firewallRule) error {
+	var b bytes.Buffer
+	for _, r := range rules {
+		match := ""
+		if !r.anyAddress() {
+			if isIpv6Allocation(r.Ip) {
+				match = "ip6 daddr " + normalizeAllocationIp(r.Ip) + " "
+			} else {
+				match = "ip daddr " + normalizeAllocationIp(r.Ip) + " "
+			}
+		}
+
+		fmt.Fprintf(&b, "add rule %s %s %s%s dport %d accept comment \"%s\"\n", f.table, f.chain, match, r.Protocol, r.Port, f.comment(uuid, r))
+	}
+
+	_, err := runFirewallCommand(b.String(), "nft", "-f", "-")
+
+	return err
+}
+
+func (f *nftFirewall) close(uuid string, rules []firewallRule) error {
+	out, err := runFirewallCommand("", "nft", append([]string{"-a", "list", "chain"}, append(strings.Fields(f.table), f.chain)...)...)
+	if err != nil {
+		return err
+	}
+
+	comments := make(map[string]bool, len(rules))
+	for _, r := range rules {
+		comments[f.comment(uuid, r)] = true
+	}
+
+	var b bytes.Buffer
+	for _, m := range nftHandleRegex.FindAllStringSubmatch(string(out), -1) {
+		if comments[m[1]] {
+			fmt.Fprintf(&b, "delete rule %s %s handle %s\n", f.table, f.chain, m[2])
+		}
+	}
+
+	// Rules that are already gone, for example because the ruleset was reloaded, do not
+	// need to be removed.
+	if b.Len() == 0 {
+		return nil
+	}
+
+	_, err = runFirewallCommand(b.String(), "nft", "-f", "-")
+
+	return err
+}
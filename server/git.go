@@ -0,0 +1,324 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"github.com/pkg/errors"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// The maximum amount of time a single git operation is allowed to run for.
+const gitOperationTimeout = time.Minute * 10
+
+// Lock files older than this are assumed to have been left behind by a daemon that
+// crashed mid-operation and are removed.
+const gitStaleLockAge = time.Hour
+
+type gitOperationInProgress struct {
+}
+
+func (e *gitOperationInProgress) Error() string {
+	return "another git operation is already running for this server"
+}
+
+func IsGitOperationInProgressError(err error) bool {
+	_, ok := err.(*gitOperationInProgress)
+
+	return ok
+}
+
+// Defines a git repository to deploy into a directory within the server's data
+// directory.
+type GitDeployment struct {
+	// The URL of the repository to clone.
+	Url string `json:"url"`
+
+	// The branch to check out. If empty the default branch of the repository is used.
+	Branch string `json:"branch"`
+
+	// The directory, relative to the server root, to deploy the repository into.
+	Directory string `json:"directory"`
+
+	// An optional private key used when accessing the repository over SSH.
+	DeployKey string `json:"deploy_key"`
+}
+
+// Returns the path to the lock file used to prevent concurrent git operations on the
+// server. This lives outside of the server data directory so users cannot tamper with it.
+func (s *Server) gitLockPath() string {
+	return filepath.Join(s.Filesystem.Configuration.Data, ".locks", s.Uuid+"-git.lock")
+}
+
+// Obtains the git lock for the server, returning a function that releases it.
+func (s *Server) acquireGitLock() (func(), error) {
+	p := s.gitLockPath()
+	if err := os.MkdirAll(filepath.Dir(p), 0700); err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	if st, err := os.Stat(p); err == nil && time.Since(st.ModTime()) > gitStaleLockAge {
+		os.Remove(p)
+	}
+
+	f, err := os.OpenFile(p, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600)
+	if err != nil {
+		if os.IsExist(err) {
+			return nil, &gitOperationInProgress{}
+		}
+
+		return nil, errors.WithStack(err)
+	}
+	f.Close()
+
+	return func() {
+		os.Remove(p)
+	}, nil
+}
+
+// Returns the directory that holds the git repositories deployed into the server. These
+// live outside of the server data directory, since git runs commands defined in the
+// configuration of a repository, and that must never be something a user can write to.
+func (s *Server) gitRepositoriesPath() string {
+	return filepath.Join(s.Filesystem.Configuration.Data, ".git-repositories", s.Uuid)
+}
+
+// Returns the git directory for a repository deployed into the given directory of the
+// server, which is named after the path of the directory.
+func (s *Server) gitDir(target string) string {
+	return filepath.Join(s.gitRepositoriesPath(), fmt.Sprintf("%x", sha256.Sum256([]byte(target))))
+}
+
+// Creates the directory that holds the git repositories of the server, owned by the daemon
+// user so that git can write to it.
+func (s *Server) ensureGitRepositoriesPath() error {
+	p := s.gitRepositoriesPath()
+	if err := os.MkdirAll(p, 0700); err != nil {
+		return errors.WithStack(err)
+	}
+
+	for _, d := range []string{filepath.Dir(p), p} {
+		if err := chownToDaemonUser(d, s.Filesystem.Configuration); err != nil {
+			return errors.WithStack(err)
+		}
+	}
+
+	return nil
+}
+
+// Removes the git repositories deployed into the server, this should be called when the
+// server is deleted from the node.
+func (s *Server) RemoveGitRepositories() error {
+	return errors.WithStack(os.RemoveAll(s.gitRepositoriesPath()))
+}
+
+// Options passed to every git command. The configuration of a repository is kept out of
+// reach of users, but hooks and fsmonitor commands are still never run, and only remote
+// transports that cannot be used to read files on this machine are allowed.
+var gitSafeOptions = []string{
+	"-c", "core.hooksPath=/dev/null",
+	"-c", "core.fsmonitor=false",
+	"-c", "protocol.allow=never",
+	"-c", "protocol.https.allow=always",
+	"-c", "protocol.ssh.allow=always",
+}
+
+// Runs git with the given arguments as the daemon user in a directory. If a git directory
+// is provided it is used as the repository with the directory as its work tree, so that
+// git never looks for a repository within the server itself. If a deploy key is provided
+// it is written to a temporary file and used for any SSH connections made by git. The git
+// process is killed if the context is cancelled.
+func (s *Server) runGit(ctx context.Context, dir string, gitDir string, key string, args ...string) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, gitOperationTimeout)
+	defer cancel()
+
+	// Git is given an empty home directory so that no configuration outside of the
+	// repository is loaded.
+	home, err := ioutil.TempDir("", "wings-git-home")
+	if err != nil {
+		return "", errors.WithStack(err)
+	}
+	defer os.RemoveAll(home)
+
+	if err := chownToDaemonUser(home, s.Filesystem.Configuration); err != nil {
+		return "", errors.WithStack(err)
+	}
+
+	env := []string{
+		"HOME=" + home,
+		"GIT_TERMINAL_PROMPT=0",
+		"GIT_CONFIG_NOSYSTEM=1",
+		"GIT_CONFIG_GLOBAL=/dev/null",
+		"PATH=" + os.Getenv("PATH"),
+	}
+
+	sshCommand := "ssh -o StrictHostKeyChecking=accept-new -o UserKnownHostsFile=/dev/null"
+	if key != "" {
+		f, err := ioutil.TempFile("", "wings-deploy-key")
+		if err != nil {
+			return "", errors.WithStack(err)
+		}
+		defer os.Remove(f.Name())
+
+		if _, err := f.WriteString(strings.TrimSpace(key) + "\n"); err != nil {
+			f.Close()
+			return "", errors.WithStack(err)
+		}
+		f.Close()
+
+		// The key needs to be readable by the user git is run as.
+		if err := chownToDaemonUser(f.Name(), s.Filesystem.Configuration); err != nil {
+			return "", errors.WithStack(err)
+		}
+
+		sshCommand += " -o IdentitiesOnly=yes -i " + f.Name()
+	}
+	env = append(env, "GIT_SSH_COMMAND="+sshCommand)
+
+	opts := append([]string{}, gitSafeOptions...)
+	if gitDir != "" {
+		opts = append(opts, "--git-dir="+gitDir, "--work-tree="+dir)
+	}
+
+	cmd := exec.CommandContext(ctx, "git", append(opts, args...)...)
+	cmd.Dir = dir
+	cmd.Env = env
+	cmd.SysProcAttr = daemonUserSysProcAttr(s.Filesystem.Configuration)
+
+	var out bytes.Buffer
+	cmd.Stdout = &out
+	cmd.Stderr = &out
+
+	if err := cmd.Run(); err != nil {
+		if ctx.Err() == context.DeadlineExceeded {
+			return out.String(), errors.New("git operation timed out")
+		} else if ctx.Err() != nil {
+			return out.String(), errors.WithStack(ctx.Err())
+		}
+
+		return out.String(), errors.Wrap(err, fmt.Sprintf("git %s: %s", args[0], strings.TrimSpace(out.String())))
+	}
+
+	return out.String(), nil
+}
+
+// Clones a git repository into a directory within the server. The directory must either
+// not exist or be empty.
+func (s *Server) GitClone(ctx context.Context, d GitDeployment) (string, error) {
+	if d.Url == "" {
+		return "", errors.New("a repository url must be provided")
+	}
+
+	// Prevent the URL from being interpreted as an option, and disallow the "ext" transport
+	// which allows arbitrary commands to be run.
+	if strings.HasPrefix(d.Url, "-") || strings.HasPrefix(d.Url, "ext::") {
+		return "", errors.New("the repository url provided is not valid")
+	}
+
+	release, err := s.acquireGitLock()
+	if err != nil {
+		return "", err
+	}
+	defer release()
+
+	target, err := s.Filesystem.SafePath(d.Directory)
+	if err != nil {
+		return "", err
+	}
+
+	if err := os.MkdirAll(target, 0755); err != nil {
+		return "", errors.WithStack(err)
+	}
+
+	if err := s.Filesystem.Chown(d.Directory); err != nil {
+		return "", err
+	}
+
+	if err := s.ensureGitRepositoriesPath(); err != nil {
+		return "", err
+	}
+
+	// Checked here as well as by git, so that the repository of a deployment that is still
+	// in the directory is not removed below.
+	if files, err := ioutil.ReadDir(target); err != nil {
+		return "", errors.WithStack(err)
+	} else if len(files) > 0 {
+		return "", errors.New("the directory provided must be empty")
+	}
+
+	// Anything left behind by a repository previously deployed into the directory is
+	// removed, git refuses to clone into a git directory that already exists.
+	gitDir := s.gitDir(target)
+	if err := os.RemoveAll(gitDir); err != nil {
+		return "", errors.WithStack(err)
+	}
+
+	// The clone is run from the directory holding the repositories rather than from within
+	// the server, so that git does not find a repository planted in a parent directory.
+	args := []string{"clone", "--separate-git-dir", gitDir, "--depth", "1"}
+	if d.Branch != "" {
+		args = append(args, "--branch", d.Branch)
+	}
+	args = append(args, "--", d.Url, target)
+
+	out, err := s.runGit(ctx, s.gitRepositoriesPath(), "", d.DeployKey, args...)
+	if err != nil {
+		return out, err
+	}
+
+	// Git leaves a file in the work tree pointing to the git directory. It is never used,
+	// since the git directory is always passed to git directly.
+	if err := os.Remove(filepath.Join(target, ".git")); err != nil && !os.IsNotExist(err) {
+		return out, errors.WithStack(err)
+	}
+
+	return out, nil
+}
+
+// Pulls the latest changes for a git repository that was previously deployed into the
+// server, optionally switching to a different branch first.
+func (s *Server) GitPull(ctx context.Context, d GitDeployment) (string, error) {
+	release, err := s.acquireGitLock()
+	if err != nil {
+		return "", err
+	}
+	defer release()
+
+	target, err := s.Filesystem.SafePath(d.Directory)
+	if err != nil {
+		return "", err
+	}
+
+	gitDir := s.gitDir(target)
+	if st, err := os.Stat(gitDir); err != nil || !st.IsDir() {
+		return "", errors.New("the directory provided is not a git repository")
+	}
+
+	var out string
+	if d.Branch != "" {
+		if strings.HasPrefix(d.Branch, "-") {
+			return "", errors.New("the branch provided is not valid")
+		}
+
+		o, err := s.runGit(ctx, target, gitDir, d.DeployKey, "fetch", "--depth", "1", "origin", d.Branch)
+		out += o
+		if err != nil {
+			return out, err
+		}
+
+		o, err = s.runGit(ctx, target, gitDir, d.DeployKey, "checkout", "-B", d.Branch, "FETCH_HEAD")
+		out += o
+
+		return out, err
+	}
+
+	o, err := s.runGit(ctx, target, gitDir, d.DeployKey, "pull", "--ff-only")
+
+	return out + o, err
+}
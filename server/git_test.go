@@ -0,0 +1,101 @@
+//go:build !windows
+// +build !windows
+
+package server
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+)
+
+// Runs git as the test process, for setting up repositories outside of the daemon.
+func testGit(t *testing.T, dir string, args ...string) {
+	t.Helper()
+
+	cmd := exec.Command("git", append([]string{"-c", "user.name=test", "-c", "user.email=test@example.com"}, args...)...)
+	cmd.Dir = dir
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("git %v: %v: %s", args, err, out)
+	}
+}
+
+func TestGit_RepositoryConfigurationInServerIsIgnored(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+
+	// Git is run as the daemon user, which requires root to switch to.
+	if os.Geteuid() != 0 {
+		t.Skip("running git as the daemon user requires root")
+	}
+
+	fs, outside := newTestFilesystem(t)
+	s := &Server{Uuid: fs.Server.Uuid, Filesystem: *fs}
+	s.Filesystem.Server = s
+
+	// A repository to deploy, kept outside of the server.
+	src := filepath.Join(outside, "src")
+	if err := os.Mkdir(src, 0755); err != nil {
+		t.Fatal(err)
+	}
+	testGit(t, src, "init", "-q")
+	if err := ioutil.WriteFile(filepath.Join(src, "file.txt"), []byte("deployed"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	testGit(t, src, "add", "file.txt")
+	testGit(t, src, "commit", "-q", "-m", "initial")
+
+	// Deploy it the same way a clone does, since the daemon only allows remote transports.
+	target := filepath.Join(s.Filesystem.Path(), "app")
+	if err := s.ensureGitRepositoriesPath(); err != nil {
+		t.Fatal(err)
+	}
+	testGit(t, outside, "clone", "-q", "--separate-git-dir", s.gitDir(target), src, target)
+	if err := os.Remove(filepath.Join(target, ".git")); err != nil {
+		t.Fatal(err)
+	}
+
+	// Plant repositories configured to run a command, both in the deployed directory and in
+	// the root of the server, as a user with access to the files of the server could.
+	marker := filepath.Join(outside, "marker")
+	malicious := "[core]\n\tfsmonitor = touch " + marker + "\n" +
+		"[filter \"x\"]\n\tsmudge = touch " + marker + "\n\tclean = touch " + marker + "\n" +
+		"[diff]\n\texternal = touch " + marker + "\n"
+
+	for _, d := range []string{target, s.Filesystem.Path()} {
+		testGit(t, d, "init", "-q")
+		if err := ioutil.WriteFile(filepath.Join(d, ".git", "config"), []byte(malicious), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := ioutil.WriteFile(filepath.Join(target, ".gitattributes"), []byte("* filter=x diff=x\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := ioutil.WriteFile(filepath.Join(target, "file.txt"), []byte("changed"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, args := range [][]string{{"status"}, {"add", "file.txt"}, {"diff", "--cached"}, {"checkout", "-f", "HEAD"}} {
+		if out, err := s.runGit(context.Background(), target, s.gitDir(target), "", args...); err != nil {
+			t.Fatalf("git %v: %v: %s", args, err, out)
+		}
+	}
+
+	if _, err := os.Stat(marker); !os.IsNotExist(err) {
+		t.Fatal("a command configured by a repository within the server was run")
+	}
+
+	if b, err := ioutil.ReadFile(filepath.Join(target, "file.txt")); err != nil || string(b) != "deployed" {
+		t.Fatalf("expected the deployed file to be checked out, got %q, %v", b, err)
+	}
+
+	if _, err := s.GitPull(context.Background(), GitDeployment{Directory: "/missing"}); err == nil {
+		t.Fatal("expected pulling a directory without a deployed repository to fail")
+	}
+}
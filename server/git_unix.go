@@ -0,0 +1,25 @@
+//go:build !windows
+// +build !windows
+
+package server
+
+import (
+	"github.com/pterodactyl/wings/config"
+	"os"
+	"syscall"
+)
+
+// Returns the process attributes used to run commands as the daemon user rather than root,
+// such as git and lifecycle hooks, which run against files controlled by users.
+func daemonUserSysProcAttr(c *config.SystemConfiguration) *syscall.SysProcAttr {
+	return &syscall.SysProcAttr{
+		Credential: &syscall.Credential{
+			Uid: uint32(c.User.Uid),
+			Gid: uint32(c.User.Gid),
+		},
+	}
+}
+
+func chownToDaemonUser(p string, c *config.SystemConfiguration) error {
+	return os.Chown(p, c.User.Uid, c.User.Gid)
+}
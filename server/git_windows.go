@@ -0,0 +1,15 @@
+package server
+
+import (
+	"github.com/pterodactyl/wings/config"
+	"syscall"
+)
+
+// Processes on Windows run as the same user as the daemon.
+func daemonUserSysProcAttr(c *config.SystemConfiguration) *syscall.SysProcAttr {
+	return nil
+}
+
+func chownToDaemonUser(p string, c *config.SystemConfiguration) error {
+	return nil
+}
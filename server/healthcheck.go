@@ -0,0 +1,159 @@
+package server
+
+import (
+	"github.com/docker/docker/api/types/container"
+	"go.uber.org/zap"
+	"time"
+)
+
+// The health of a server process as reported by its healthcheck.
+const (
+	HealthStarting  = "starting"
+	HealthHealthy   = "healthy"
+	HealthUnhealthy = "unhealthy"
+)
+
+// Defines a command that is run periodically inside the server environment to check that
+// the server process is still responding, even if the process itself is still alive.
+type HealthcheckSettings struct {
+	// The command to run, using the shell of the container. The server is considered to be
+	// healthy when it exits with a code of 0. If empty, no healthcheck is run.
+	Command string `json:"command" yaml:"command"`
+
+	// The number of seconds between each run of the command.
+	Interval int `default:"30" json:"interval" yaml:"interval"`
+
+	// The number of seconds the command can run for before it is considered to have failed.
+	Timeout int `default:"10" json:"timeout" yaml:"timeout"`
+
+	// The number of consecutive failures before the server is considered unhealthy.
+	Retries int `default:"3" json:"retries" yaml:"retries"`
+
+	// The number of seconds after the server starts during which failures are not counted,
+	// giving the server process time to boot.
+	StartPeriod int `default:"0" json:"start_period" yaml:"start_period"`
+}
+
+// Returns the healthcheck configuration for a Docker container, or nil if the server does
+// not have a healthcheck defined.
+func (h *HealthcheckSettings) containerConfig() *container.HealthConfig {
+	if h.Command == "" {
+		return nil
+	}
+
+	return &container.HealthConfig{
+		Test:        []string{"CMD-SHELL", h.Command},
+		Interval:    time.Duration(h.interval()) * time.Second,
+		Timeout:     time.Duration(h.Timeout) * time.Second,
+		Retries:     h.Retries,
+		StartPeriod: time.Duration(h.StartPeriod) * time.Second,
+	}
+}
+
+func (h *HealthcheckSettings) interval() int {
+	if h.Interval <= 0 {
+		return 30
+	}
+
+	return h.Interval
+}
+
+// Implemented by environments that are able to run a healthcheck for the server process.
+// An empty status is returned if the environment is not running a healthcheck.
+type healthReporter interface {
+	Health() (string, error)
+}
+
+// Returns the health of the server process as last reported by its healthcheck, or an
+// empty string if the server has no healthcheck or is not running.
+func (s *Server) Health() string {
+	s.RLock()
+	defer s.RUnlock()
+
+	return s.health
+}
+
+// Begins following the health of the server process. Whenever the health changes it is
+// published over the event bus, and a server that is still starting is marked as running
+// once it has been reported as healthy.
+func (s *Server) enableHealthPolling() {
+	hr, ok := s.Environment.(healthReporter)
+	if !ok || s.Healthcheck.Command == "" {
+		return
+	}
+
+	stop := make(chan struct{})
+
+	s.Lock()
+	if s.healthPolling != nil {
+		close(s.healthPolling)
+	}
+	s.healthPolling = stop
+	s.Unlock()
+
+	go func() {
+		ticker := time.NewTicker(time.Duration(s.Healthcheck.interval()) * time.Second)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+				h, err := hr.Health()
+				if err != nil {
+					zap.S().Debugw("failed to check health of server process", zap.String("server", s.Uuid), zap.Error(err))
+					continue
+				}
+
+				s.setHealth(h)
+			}
+		}
+	}()
+}
+
+// Stops following the health of the server process and clears the last reported health.
+func (s *Server) disableHealthPolling() {
+	s.Lock()
+	if s.healthPolling != nil {
+		close(s.healthPolling)
+		s.healthPolling = nil
+	}
+	s.Unlock()
+
+	s.setHealth("")
+}
+
+// Updates the health of the server, publishing the change if it is different from the
+// health that was last reported.
+func (s *Server) setHealth(health string) {
+	s.Lock()
+	prev := s.health
+	s.health = health
+	s.Unlock()
+
+	if prev == health {
+		return
+	}
+
+	s.Events().Publish(HealthEvent, health)
+	PublishNodeEvent(HealthEvent, s.Uuid, map[string]string{
+		"previous": prev,
+		"health":   health,
+	})
+
+	switch health {
+	case HealthUnhealthy:
+		zap.S().Warnw("server process is unhealthy", zap.String("server", s.Uuid))
+
+		s.PublishConsoleOutputFromDaemon("Server is failing its healthcheck and may not be responding.")
+	case HealthHealthy:
+		if prev == HealthUnhealthy {
+			s.PublishConsoleOutputFromDaemon("Server is passing its healthcheck again.")
+		}
+
+		if s.GetState() == ProcessStartingState {
+			s.SetState(ProcessRunningState)
+		}
+	}
+}
@@ -0,0 +1,74 @@
+package server
+
+import (
+	"github.com/pkg/errors"
+	"github.com/pterodactyl/wings/api"
+	"github.com/pterodactyl/wings/config"
+	"github.com/pterodactyl/wings/system"
+	"go.uber.org/zap"
+	"math/rand"
+	"time"
+)
+
+// Builds the heartbeat for this node using the current state of all of the servers.
+func newHeartbeat() *api.Heartbeat {
+	h := &api.Heartbeat{
+		Version:     system.Version,
+		Maintenance: config.Get().System.Maintenance.Enabled,
+	}
+
+	for _, s := range GetServers().All() {
+		h.Servers.Total++
+		if s.GetState() != ProcessOfflineState {
+			h.Servers.Running++
+		}
+
+		r := s.GetResources()
+		h.Utilization.MemoryBytes += r.Memory
+		h.Utilization.CpuAbsolute += r.CpuAbsolute
+		h.Utilization.DiskBytes += r.Disk
+	}
+
+	return h
+}
+
+// Returns the given interval adjusted by a random amount of up to 10% either way.
+func jitter(interval time.Duration) time.Duration {
+	return interval + time.Duration((rand.Float64()*0.2-0.1)*float64(interval))
+}
+
+// Sends a heartbeat to the Panel on the configured interval until the daemon is stopped.
+// The first heartbeat is sent after a random delay so that a large number of nodes being
+// restarted at once do not all contact the Panel at the same moment.
+func StartHeartbeat() {
+	seconds := config.Get().System.Heartbeat.Interval
+	if seconds <= 0 {
+		return
+	}
+
+	interval := time.Second * time.Duration(seconds)
+
+	go func() {
+		time.Sleep(time.Duration(rand.Int63n(int64(interval))))
+
+		var failures int
+		for {
+			rerr, err := api.NewRequester().SendHeartbeat(newHeartbeat())
+			if err == nil && rerr != nil {
+				err = errors.New(rerr.String())
+			}
+
+			if err != nil {
+				failures++
+				zap.S().Warnw("failed to send heartbeat to panel", zap.Int("consecutive_failures", failures), zap.Error(err))
+			} else {
+				if failures > 0 {
+					zap.S().Infow("heartbeat to panel succeeded after previous failures", zap.Int("failures", failures))
+				}
+				failures = 0
+			}
+
+			time.Sleep(jitter(interval))
+		}
+	}()
+}
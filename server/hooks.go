@@ -0,0 +1,185 @@
+package server
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"github.com/pkg/errors"
+	"github.com/pterodactyl/wings/config"
+	"go.uber.org/zap"
+	"io"
+	"os/exec"
+	"runtime"
+	"strings"
+	"time"
+)
+
+const (
+	PreStartHook  = "pre_start"
+	PostStopHook  = "post_stop"
+	PostCrashHook = "post_crash"
+)
+
+// Defines the commands that are executed by the daemon on the host system around the
+// lifecycle events of a server process. Commands are run as the daemon user in the order
+// they are defined, using the server data directory as the working directory.
+type Hooks struct {
+	// Run before the server process is started. If any of these commands fail the
+	// server will not be started.
+	PreStart []Hook `json:"pre_start" yaml:"pre_start"`
+
+	// Run after the server process stops as a result of a stop or kill action.
+	PostStop []Hook `json:"post_stop" yaml:"post_stop"`
+
+	// Run after the server process is detected as having crashed, before any
+	// automatic restart of the process takes place.
+	PostCrash []Hook `json:"post_crash" yaml:"post_crash"`
+}
+
+// A single command executed as part of a lifecycle hook.
+type Hook struct {
+	// The command to run. This is passed through to the system shell, so it can be
+	// a path to a script or an inline command.
+	Command string `json:"command" yaml:"command"`
+
+	// The number of seconds to allow the command to run for before it is killed and
+	// treated as having failed.
+	Timeout int `default:"60" json:"timeout" yaml:"timeout"`
+}
+
+// Returns the hooks defined for the given lifecycle event.
+func (h *Hooks) get(event string) []Hook {
+	switch event {
+	case PreStartHook:
+		return h.PreStart
+	case PostStopHook:
+		return h.PostStop
+	case PostCrashHook:
+		return h.PostCrash
+	default:
+		return nil
+	}
+}
+
+// Runs all of the hooks defined for the given lifecycle event, piping their output to
+// the server console. Execution stops at the first hook that fails.
+func (s *Server) RunHooks(event string) error {
+	hooks := s.Hooks.get(event)
+	if len(hooks) == 0 {
+		return nil
+	}
+
+	zap.S().Debugw("running server lifecycle hooks", zap.String("server", s.Uuid), zap.String("event", event))
+
+	for _, h := range hooks {
+		s.PublishConsoleOutputFromDaemon(fmt.Sprintf("Running %s hook: %s", event, h.Command))
+
+		if err := s.runHook(h); err != nil {
+			s.PublishConsoleOutputFromDaemon(fmt.Sprintf("Hook failed: %s", err.Error()))
+
+			return errors.Wrap(err, fmt.Sprintf("%s hook \"%s\"", event, h.Command))
+		}
+	}
+
+	return nil
+}
+
+// Environment variables that change how the shell or the dynamic linker behave, which are
+// never passed to hooks from the server variables.
+var unsafeHookVariables = []string{"PATH", "HOME", "SHELL", "IFS", "ENV", "BASH_ENV", "SHELLOPTS", "BASHOPTS", "PS4", "CDPATH"}
+
+// Returns the environment hooks are run with. Nothing is inherited from the daemon, hooks
+// only receive a fixed PATH and the variables of the server, excluding any that could be
+// used to change what the hook runs.
+func (s *Server) hookEnvironment() []string {
+	env := []string{
+		"PATH=/usr/local/sbin:/usr/local/bin:/usr/sbin:/usr/bin:/sbin:/bin",
+		"HOME=" + s.Filesystem.Path(),
+		"SERVER_UUID=" + s.Uuid,
+	}
+
+vloop:
+	for _, v := range s.GetEnvironmentVariables() {
+		name := strings.ToUpper(strings.SplitN(v, "=", 2)[0])
+		if strings.HasPrefix(name, "LD_") || strings.HasPrefix(name, "DYLD_") || strings.HasPrefix(name, "BASH_FUNC_") {
+			continue
+		}
+
+		for _, u := range unsafeHookVariables {
+			if name == u {
+				continue vloop
+			}
+		}
+
+		env = append(env, v)
+	}
+
+	return env
+}
+
+// Executes a single hook command as the daemon user, killing it if it runs past the
+// configured timeout.
+func (s *Server) runHook(h Hook) error {
+	timeout := h.Timeout
+	if timeout <= 0 {
+		timeout = 60
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(timeout)*time.Second)
+	defer cancel()
+
+	var cmd *exec.Cmd
+	if runtime.GOOS == "windows" {
+		cmd = exec.Command("cmd.exe", "/C", h.Command)
+	} else {
+		cmd = exec.Command("/bin/sh", "-c", h.Command)
+	}
+
+	cmd.Dir = s.Filesystem.Path()
+	cmd.Env = s.hookEnvironment()
+	cmd.SysProcAttr = hookSysProcAttr(&config.Get().System)
+
+	pr, pw := io.Pipe()
+	cmd.Stdout = pw
+	cmd.Stderr = pw
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+
+		sc := bufio.NewScanner(pr)
+		for sc.Scan() {
+			s.Events().Publish(ConsoleOutputEvent, sc.Text())
+		}
+	}()
+
+	if err := cmd.Start(); err != nil {
+		pw.Close()
+		<-done
+
+		return errors.WithStack(err)
+	}
+
+	// Killing only the shell is not enough once the hook has timed out, anything it started
+	// in the background holds the output open and keeps Wait from returning, so every
+	// process started by the hook is killed.
+	exited := make(chan struct{})
+	go func() {
+		select {
+		case <-ctx.Done():
+			killHook(cmd)
+		case <-exited:
+		}
+	}()
+
+	err := cmd.Wait()
+	close(exited)
+	pw.Close()
+	<-done
+
+	if ctx.Err() == context.DeadlineExceeded {
+		return errors.New(fmt.Sprintf("timed out after %d seconds", timeout))
+	}
+
+	return errors.WithStack(err)
+}
@@ -0,0 +1,24 @@
+//go:build !windows
+// +build !windows
+
+package server
+
+import (
+	"github.com/pterodactyl/wings/config"
+	"os/exec"
+	"syscall"
+)
+
+// Hooks are run as the daemon user in their own process group, so that anything they start
+// in the background can be killed along with them.
+func hookSysProcAttr(c *config.SystemConfiguration) *syscall.SysProcAttr {
+	attr := daemonUserSysProcAttr(c)
+	attr.Setpgid = true
+
+	return attr
+}
+
+// Kills a hook along with every process it started.
+func killHook(cmd *exec.Cmd) {
+	syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+}
@@ -0,0 +1,19 @@
+package server
+
+import (
+	"github.com/pterodactyl/wings/config"
+	"os/exec"
+	"strconv"
+	"syscall"
+)
+
+func hookSysProcAttr(c *config.SystemConfiguration) *syscall.SysProcAttr {
+	return daemonUserSysProcAttr(c)
+}
+
+// Kills a hook along with every process it started.
+func killHook(cmd *exec.Cmd) {
+	if err := exec.Command("taskkill", "/T", "/F", "/PID", strconv.Itoa(cmd.Process.Pid)).Run(); err != nil {
+		cmd.Process.Kill()
+	}
+}
@@ -0,0 +1,117 @@
+package server
+
+import (
+	"fmt"
+	"go.uber.org/zap"
+	"time"
+)
+
+// Defines when a running server is considered idle and automatically stopped, allowing more
+// servers to share a node when most of them are not being played on at any one time.
+type IdleSettings struct {
+	// If set to true, the server is stopped once it has been idle for the timeout.
+	Enabled bool `default:"false" json:"enabled" yaml:"enabled"`
+
+	// The number of minutes the server must be idle for before it is stopped.
+	Timeout int `default:"30" json:"timeout" yaml:"timeout"`
+
+	// The number of minutes before the server is stopped that a warning is sent to the
+	// console. A value of 0 means no warning is sent.
+	Warning int `default:"5" json:"warning" yaml:"warning"`
+
+	// The server is idle while no players are online, which requires querying to be
+	// configured for the server. If a CPU threshold is set, the server is also idle while
+	// the absolute CPU usage of the server is below that percentage.
+	CpuThreshold float64 `default:"0" json:"cpu_threshold" yaml:"cpu_threshold"`
+}
+
+// The interval that servers are checked for being idle at.
+const idleCheckInterval = time.Second * 30
+
+// Determines if the server is currently idle using its last resource usage.
+func (s *Server) isIdle() bool {
+	r := s.GetResources()
+	if q := r.Query; q != nil && q.Players == 0 {
+		return true
+	}
+
+	return s.Idle.CpuThreshold > 0 && r.CpuAbsolute < s.Idle.CpuThreshold
+}
+
+// Begins checking if the server is idle, stopping it once it has been idle for the timeout.
+// The time spent idle is reset whenever the server is seen to be active.
+func (s *Server) enableIdleMonitor() {
+	if !s.Idle.Enabled || s.Idle.Timeout <= 0 {
+		return
+	}
+
+	stop := make(chan struct{})
+
+	s.Lock()
+	if s.idleMonitor != nil {
+		close(s.idleMonitor)
+	}
+	s.idleMonitor = stop
+	s.Unlock()
+
+	go func() {
+		ticker := time.NewTicker(idleCheckInterval)
+		defer ticker.Stop()
+
+		timeout := time.Duration(s.Idle.Timeout) * time.Minute
+		warning := time.Duration(s.Idle.Warning) * time.Minute
+
+		var since time.Time
+		var warned bool
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+				if !s.isIdle() {
+					since = time.Time{}
+					warned = false
+					continue
+				}
+
+				if since.IsZero() {
+					since = time.Now()
+				}
+
+				idle := time.Since(since)
+				if warning > 0 && !warned && idle >= timeout-warning {
+					warned = true
+
+					s.PublishConsoleOutputFromDaemon(fmt.Sprintf("Server is idle and will be stopped in %d minutes if it remains idle.", int((timeout-idle).Minutes()+0.5)))
+				}
+
+				if idle < timeout {
+					continue
+				}
+
+				zap.S().Infow("stopping idle server", zap.String("server", s.Uuid), zap.Duration("idle", idle))
+
+				s.PublishConsoleOutputFromDaemon("Server has been idle for too long and is being stopped.")
+				PublishNodeEvent(IdleStopEvent, s.Uuid, map[string]interface{}{
+					"idle_seconds": int(idle.Seconds()),
+				})
+
+				if err := s.RunPowerAction(PowerAction{Action: "stop"}); err != nil {
+					zap.S().Errorw("failed to stop idle server", zap.String("server", s.Uuid), zap.Error(err))
+				}
+
+				return
+			}
+		}
+	}()
+}
+
+// Stops checking if the server is idle.
+func (s *Server) disableIdleMonitor() {
+	s.Lock()
+	if s.idleMonitor != nil {
+		close(s.idleMonitor)
+		s.idleMonitor = nil
+	}
+	s.Unlock()
+}
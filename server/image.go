@@ -0,0 +1,135 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"github.com/pkg/errors"
+	"github.com/pterodactyl/wings/store"
+	"go.uber.org/zap"
+)
+
+type imageNotAllowedError struct {
+	image string
+}
+
+func (e *imageNotAllowedError) Error() string {
+	return fmt.Sprintf("the image %s is not one of the images allowed for this server", e.image)
+}
+
+func IsImageNotAllowedError(err error) bool {
+	_, ok := err.(*imageNotAllowedError)
+
+	return ok
+}
+
+// Implemented by environments that need an image to be downloaded before it can be used.
+type imagePuller interface {
+	PullImage(ctx context.Context, image string) error
+}
+
+var imageSelections = store.NewRepository(store.ServerImages)
+
+// Returns the image that the server should be run using. This is the image selected for
+// the server if there is one and it is still allowed by the egg, otherwise the default
+// image for the server.
+func (s *Server) ContainerImage() string {
+	s.RLock()
+	defer s.RUnlock()
+
+	if s.Container.SelectedImage != "" && s.isAllowedImage(s.Container.SelectedImage) {
+		return s.Container.SelectedImage
+	}
+
+	return s.Container.Image
+}
+
+// Determines if the server is allowed to use the given image. The lock must be held
+// when this is called.
+func (s *Server) isAllowedImage(image string) bool {
+	if image == s.Container.Image {
+		return true
+	}
+
+	for _, i := range s.Container.AllowedImages {
+		if i == image {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Switches the server to a different image from the list of images allowed by the egg.
+// The image is pulled before the change is made so that the server cannot be left with
+// an image that does not exist. A running server keeps using its current image until it
+// is restarted, and is marked as requiring a rebuild until then. The pull is aborted if the
+// context is cancelled.
+func (s *Server) SetImage(ctx context.Context, image string) error {
+	s.RLock()
+	allowed := s.isAllowedImage(image)
+	s.RUnlock()
+
+	if !allowed {
+		return &imageNotAllowedError{image: image}
+	}
+
+	if p, ok := s.Environment.(imagePuller); ok {
+		zap.S().Debugw("pulling image before switching server to it", zap.String("server", s.Uuid), zap.String("image", image))
+		if err := p.PullImage(ctx, image); err != nil {
+			return errors.WithStack(err)
+		}
+	}
+
+	s.Lock()
+	// Selecting the default image clears the selection, so the server follows any changes
+	// made to the default image in the Panel.
+	if image == s.Container.Image {
+		s.Container.SelectedImage = ""
+	} else {
+		s.Container.SelectedImage = image
+	}
+	selected := s.Container.SelectedImage
+	s.Unlock()
+
+	var err error
+	if selected == "" {
+		err = imageSelections.Delete(s.Uuid)
+	} else {
+		err = imageSelections.Put(s.Uuid, selected)
+	}
+	if err != nil {
+		return err
+	}
+
+	if s.GetState() != ProcessOfflineState {
+		s.Lock()
+		s.rebuildRequired = true
+		s.Unlock()
+	}
+
+	if err := s.persistConfiguration(); err != nil {
+		zap.S().Warnw("failed to persist server configuration to disk", zap.String("server", s.Uuid), zap.Error(err))
+	}
+
+	return nil
+}
+
+// Loads the image selected for the server from the state store.
+func (s *Server) loadSelectedImage() error {
+	var image string
+	if found, err := imageSelections.Get(s.Uuid, &image); err != nil || !found {
+		return err
+	}
+
+	s.Lock()
+	s.Container.SelectedImage = image
+	s.Unlock()
+
+	return nil
+}
+
+// Removes the image selected for the server from the state store, this should be called
+// when the server is deleted from the node.
+func (s *Server) RemoveSelectedImage() error {
+	return imageSelections.Delete(s.Uuid)
+}
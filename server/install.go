@@ -15,14 +15,33 @@ import (
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	"strings"
 	"sync"
 )
 
 // Executes the installation stack for a server process. Bubbles any errors up to the calling
 // function which should handle contacting the panel to notify it of the server state.
 func (s *Server) Install() error {
+	s.setInstalling(true)
+	PublishNodeEvent(InstallStartedEvent, s.Uuid, nil)
+
 	err := s.internalInstall()
 
+	s.setInstalling(false)
+	PublishNodeEvent(InstallCompletedEvent, s.Uuid, map[string]bool{"successful": err == nil})
+
+	if err != nil {
+		s.PublishInstallOutputFromDaemon("Installation failed: " + err.Error())
+	} else {
+		s.PublishInstallOutputFromDaemon("Installation completed successfully.")
+	}
+
+	// Save the outcome before notifying the Panel so that the notification can be sent
+	// again when the daemon boots if it does not go through.
+	if rerr := s.recordInstallState(err == nil, false); rerr != nil {
+		zap.S().Warnw("failed to save server install state", zap.String("server", s.Uuid), zap.Error(rerr))
+	}
+
 	zap.S().Debugw("notifying panel of server install state", zap.String("server", s.Uuid))
 	if serr := s.SyncInstallState(err == nil); serr != nil {
 		zap.S().Warnw(
@@ -31,24 +50,13 @@ func (s *Server) Install() error {
 			zap.Bool("was_successful", err == nil),
 			zap.Error(serr),
 		)
+	} else if rerr := s.recordInstallState(err == nil, true); rerr != nil {
+		zap.S().Warnw("failed to save server install state", zap.String("server", s.Uuid), zap.Error(rerr))
 	}
 
 	return err
 }
 
-// Reinstalls a server's software by utilizing the install script for the server egg. This
-// does not touch any existing files for the server, other than what the script modifies.
-func (s *Server) Reinstall() error {
-	if s.GetState() != ProcessOfflineState {
-		zap.S().Debugw("waiting for server instance to enter a stopped state", zap.String("server", s.Uuid))
-		if err := s.Environment.WaitForStop(10, true); err != nil {
-			return err
-		}
-	}
-
-	return s.Install()
-}
-
 // Internal installation function used to simplify reporting back to the Panel.
 func (s *Server) internalInstall() error {
 	script, rerr, err := api.NewRequester().GetInstallationScript(s.Uuid)
@@ -159,22 +167,9 @@ func (ip *InstallationProcess) writeScriptToDisk() (string, error) {
 
 // Pulls the docker image to be used for the installation container.
 func (ip *InstallationProcess) pullInstallationImage() error {
-	r, err := ip.client.ImagePull(context.Background(), ip.Script.ContainerImage, types.ImagePullOptions{})
-	if err != nil {
-		return errors.WithStack(err)
-	}
-
-	// Block continuation until the image has been pulled successfully.
-	scanner := bufio.NewScanner(r)
-	for scanner.Scan() {
-		zap.S().Debugw(scanner.Text())
-	}
+	ip.Server.PublishInstallOutputFromDaemon("Pulling installation image " + ip.Script.ContainerImage + "...")
 
-	if err := scanner.Err(); err != nil {
-		return errors.WithStack(err)
-	}
-
-	return nil
+	return pullImage(context.Background(), ip.client, ip.Script.ContainerImage, ip.Server.ContainerPlatform())
 }
 
 // Runs before the container is executed. This pulls down the required docker container image
@@ -248,16 +243,20 @@ func (ip *InstallationProcess) AfterExecute(containerId string) error {
 		return errors.WithStack(err)
 	}
 
-	f, err := os.OpenFile(filepath.Join("data/install_logs/", ip.Server.Uuid+".log"), os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
-	if err != nil {
-		return errors.WithStack(err)
-	}
-	defer f.Close()
-
 	// We write the contents of the container output to a more "permanent" file so that they
 	// can be referenced after this container is deleted.
-	if _, err := io.Copy(f, reader); err != nil {
-		return errors.WithStack(err)
+	if reader != nil {
+		defer reader.Close()
+
+		f, err := ip.Server.createInstallLog()
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+
+		if _, err := io.Copy(f, reader); err != nil {
+			return errors.WithStack(err)
+		}
 	}
 
 	zap.S().Debugw("removing server installation container", zap.String("server", ip.Server.Uuid), zap.String("container_id", containerId))
@@ -294,10 +293,7 @@ func (ip *InstallationProcess) Execute(installPath string) (string, error) {
 		Cmd:          []string{ip.Script.Entrypoint, "./mnt/install/install.sh"},
 		Image:        ip.Script.ContainerImage,
 		Env:          ip.Server.GetEnvironmentVariables(),
-		Labels: map[string]string{
-			"Service":       "Pterodactyl",
-			"ContainerType": "server_installer",
-		},
+		Labels:       ip.Server.containerLabels("server_installer"),
 	}
 
 	hostConf := &container.HostConfig{
@@ -348,6 +344,7 @@ func (ip *InstallationProcess) Execute(installPath string) (string, error) {
 
 	go func(id string) {
 		ip.Server.Events().Publish(DaemonMessageEvent, "Starting installation process, this could take a few minutes...")
+		ip.Server.PublishInstallOutputFromDaemon("Running installation script using " + ip.Script.ContainerImage + ".")
 		if err := ip.StreamOutput(id); err != nil {
 			zap.S().Errorw(
 				"error handling streaming output for server install process",
@@ -387,8 +384,12 @@ func (ip *InstallationProcess) StreamOutput(id string) error {
 	defer reader.Close()
 
 	s := bufio.NewScanner(reader)
+	// Installation scripts commonly print very long lines, such as when listing the files
+	// extracted from an archive, which would otherwise stop the output from being read.
+	s.Buffer(make([]byte, 64*1024), 1024*1024)
 	for s.Scan() {
-		ip.Server.Events().Publish(InstallOutputEvent, s.Text())
+		// The container is run with a terminal, so lines end with a carriage return.
+		ip.Server.Events().Publish(InstallOutputEvent, strings.TrimRight(s.Text(), "\r"))
 	}
 
 	if err := s.Err(); err != nil {
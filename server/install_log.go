@@ -0,0 +1,77 @@
+package server
+
+import (
+	"github.com/pkg/errors"
+	"github.com/pterodactyl/wings/config"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Returns the path to the file that the output of the last installation process run for
+// the server is written to.
+func (s *Server) InstallLogPath() string {
+	return filepath.Join(config.Get().System.InstallLogDirectory, s.Uuid+".log")
+}
+
+// Creates the install log for the server, replacing the log of any previous installation.
+func (s *Server) createInstallLog() (*os.File, error) {
+	p := s.InstallLogPath()
+	if err := os.MkdirAll(filepath.Dir(p), 0700); err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	f, err := os.OpenFile(p, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+
+	return f, errors.WithStack(err)
+}
+
+// Reads up to the given number of bytes from the end of the install log for the server,
+// returning the lines that were read. An error that satisfies os.IsNotExist is returned if
+// the installation process has not been run for the server.
+func (s *Server) ReadInstallLog(size int64) ([]string, error) {
+	f, err := os.Open(s.InstallLogPath())
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	st, err := f.Stat()
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	if st.Size() > size {
+		if _, err := f.Seek(-size, io.SeekEnd); err != nil {
+			return nil, errors.WithStack(err)
+		}
+	}
+
+	b, err := ioutil.ReadAll(f)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	out := strings.Split(strings.TrimRight(string(b), "\r\n"), "\n")
+	// The first line is only partially read if the log was cut short.
+	if st.Size() > size && len(out) > 1 {
+		out = out[1:]
+	}
+
+	for i, line := range out {
+		out[i] = strings.TrimRight(line, "\r")
+	}
+
+	return out, nil
+}
+
+// Removes the install log for the server, if there is one.
+func (s *Server) RemoveInstallLog() error {
+	if err := os.Remove(s.InstallLogPath()); err != nil && !os.IsNotExist(err) {
+		return errors.WithStack(err)
+	}
+
+	return nil
+}
@@ -0,0 +1,115 @@
+package server
+
+import (
+	"encoding/json"
+	"github.com/pkg/errors"
+	"github.com/pterodactyl/wings/store"
+	"go.uber.org/zap"
+	"time"
+)
+
+// The outcome of the last installation process that was run for a server. This is kept in
+// the state store so that it is still known after the daemon restarts.
+type InstallRecord struct {
+	Successful  bool      `json:"successful"`
+	CompletedAt time.Time `json:"completed_at"`
+
+	// Set once the Panel has been told about the outcome of the installation. If this
+	// is false the daemon will try to tell the Panel again the next time it boots.
+	Synced bool `json:"synced"`
+}
+
+var installRecords = store.NewRepository(store.InstallStates)
+
+// Saves the outcome of an installation process for the server.
+func (s *Server) recordInstallState(successful bool, synced bool) error {
+	return installRecords.Put(s.Uuid, &InstallRecord{
+		Successful:  successful,
+		CompletedAt: time.Now(),
+		Synced:      synced,
+	})
+}
+
+// Records that the server has been installed without running the installation process, such
+// as when it has been imported from existing files, and tells the Panel. If the Panel cannot
+// be reached it will be told again the next time the daemon boots.
+func (s *Server) MarkInstalled() error {
+	if err := s.SyncInstallState(true); err != nil {
+		if rerr := s.recordInstallState(true, false); rerr != nil {
+			zap.S().Warnw("failed to record server install state", zap.String("server", s.Uuid), zap.Error(rerr))
+		}
+
+		return err
+	}
+
+	return s.recordInstallState(true, true)
+}
+
+// Returns the outcome of the last installation process that was run for the server, or
+// nil if one has not been run since the state store was created.
+func (s *Server) LastInstall() (*InstallRecord, error) {
+	r := &InstallRecord{}
+
+	found, err := installRecords.Get(s.Uuid, r)
+	if err != nil || !found {
+		return nil, err
+	}
+
+	return r, nil
+}
+
+// Removes the saved installation outcome for the server, this should be called when the
+// server is deleted from the node.
+func (s *Server) RemoveInstallRecord() error {
+	return installRecords.Delete(s.Uuid)
+}
+
+// Tells the Panel about any installation processes that finished without the Panel being
+// notified, such as when the Panel could not be reached at the time, or the daemon was
+// stopped before the notification was sent.
+func SyncPendingInstallStates() {
+	var pending []string
+
+	err := installRecords.Each(func(uuid string, data []byte) error {
+		r := &InstallRecord{}
+		if err := json.Unmarshal(data, r); err != nil {
+			return errors.WithStack(err)
+		}
+
+		if !r.Synced {
+			pending = append(pending, uuid)
+		}
+
+		return nil
+	})
+	if err != nil {
+		zap.S().Warnw("failed to read install states from the state store", zap.Error(err))
+		return
+	}
+
+	for _, uuid := range pending {
+		s := GetServers().Find(func(s *Server) bool {
+			return s.Uuid == uuid
+		})
+
+		if s == nil {
+			installRecords.Delete(uuid)
+			continue
+		}
+
+		r, err := s.LastInstall()
+		if err != nil || r == nil {
+			continue
+		}
+
+		if err := s.SyncInstallState(r.Successful); err != nil {
+			zap.S().Warnw("failed to notify panel of pending server install state", zap.String("server", uuid), zap.Error(err))
+			continue
+		}
+
+		r.Synced = true
+		if err := installRecords.Put(uuid, r); err != nil {
+			zap.S().Warnw("failed to update install state in the state store", zap.String("server", uuid), zap.Error(err))
+		}
+	}
+}
@@ -0,0 +1,47 @@
+package server
+
+import (
+	"github.com/pterodactyl/wings/config"
+	"strings"
+)
+
+// The prefix used for the labels describing the server a container belongs to, so that
+// tools such as cAdvisor and Traefik can discover the containers managed by the daemon.
+const labelPrefix = "io.pterodactyl."
+
+// Returns the labels to apply to a container created for the server. Any labels set in the
+// configuration are included, but cannot replace the labels describing the server.
+func (s *Server) containerLabels(containerType string) map[string]string {
+	labels := make(map[string]string)
+	for k, v := range config.Get().Docker.Labels {
+		labels[k] = v
+	}
+
+	labels["Service"] = "Pterodactyl"
+	labels["ContainerType"] = containerType
+	labels[labelPrefix+"server.uuid"] = s.Uuid
+	labels[labelPrefix+"node.uuid"] = config.Get().Uuid
+
+	if s.Meta.Name != "" {
+		labels[labelPrefix+"server.name"] = s.Meta.Name
+	}
+
+	// Each tag gets a label of its own so that containers can be selected by tag, such as
+	// when grouping the metrics collected for them.
+	if len(s.Tags) > 0 {
+		labels[labelPrefix+"server.tags"] = strings.Join(s.Tags, ",")
+		for _, t := range s.Tags {
+			labels[labelPrefix+"server.tag."+t] = "true"
+		}
+	}
+
+	if s.Meta.Egg != "" {
+		labels[labelPrefix+"server.egg"] = s.Meta.Egg
+	}
+
+	if s.Meta.Owner != "" {
+		labels[labelPrefix+"server.owner"] = s.Meta.Owner
+	}
+
+	return labels
+}
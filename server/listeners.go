@@ -24,10 +24,16 @@ func (s *Server) AddEventListeners() {
 // Custom listener for console output events that will check if the given line
 // of output matches one that should mark the server as started or not.
 func (s *Server) onConsoleOutput(data string) {
+	shipConsoleOutput(s.Uuid, data)
+
 	// If the specific line of output is one that would mark the server as started,
 	// set the server to that state. Only do this if the server is not currently stopped
 	// or stopping.
-	if s.GetState() == ProcessStartingState && strings.Contains(data, s.processConfiguration.Startup.Done) {
+	// Output from servers running with a terminal can contain escape sequences, which are
+	// passed along to the console unchanged but removed before looking for these lines.
+	plain := stripAnsi(data)
+
+	if s.GetState() == ProcessStartingState && strings.Contains(plain, s.processConfiguration.Startup.Done) {
 		zap.S().Debugw(
 			"detected server in running state based on line output", zap.String("match", s.processConfiguration.Startup.Done), zap.String("against", data),
 		)
@@ -39,7 +45,7 @@ func (s *Server) onConsoleOutput(data string) {
 	// set the server to be in a stopping state, otherwise crash detection will kick in and
 	// cause the server to unexpectedly restart on the user.
 	if s.IsRunning() {
-		if s.processConfiguration.Stop.Type == api.ProcessStopCommand && data == s.processConfiguration.Stop.Value {
+		if s.processConfiguration.Stop.Type == api.ProcessStopCommand && plain == s.processConfiguration.Stop.Value {
 			s.SetState(ProcessStoppingState)
 		}
 	}
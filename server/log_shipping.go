@@ -0,0 +1,62 @@
+package server
+
+import (
+	"github.com/pterodactyl/wings/config"
+	"github.com/pterodactyl/wings/logship"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"time"
+)
+
+var consoleShipper *logship.Shipper
+
+// Starts shipping logs to the configured endpoint. The daemon logs are shipped by adding a
+// core to the global logger, so this should be called after logging has been configured.
+func StartLogShipping() error {
+	cfg := config.Get().System.LogShipping
+	if cfg.Driver == "" {
+		return nil
+	}
+
+	s, err := logship.New(logship.Options{
+		Driver:        cfg.Driver,
+		Address:       cfg.Address,
+		Username:      cfg.Username,
+		Password:      cfg.Password,
+		Labels:        cfg.Labels,
+		BatchSize:     cfg.BatchSize,
+		FlushInterval: time.Second * time.Duration(cfg.FlushInterval),
+		BufferSize:    cfg.BufferSize,
+	})
+	if err != nil {
+		return err
+	}
+
+	if cfg.Console {
+		consoleShipper = s
+	}
+
+	if cfg.Daemon {
+		level := zapcore.InfoLevel
+		if config.Get().Debug {
+			level = zapcore.DebugLevel
+		}
+
+		zap.ReplaceGlobals(zap.L().WithOptions(zap.WrapCore(func(c zapcore.Core) zapcore.Core {
+			return zapcore.NewTee(c, logship.NewCore(s, level))
+		})))
+	}
+
+	zap.S().Infow("shipping logs to remote endpoint", zap.String("driver", cfg.Driver), zap.String("address", cfg.Address))
+
+	return nil
+}
+
+// Ships a line of console output for a server, if console output is being shipped.
+func shipConsoleOutput(uuid string, line string) {
+	if consoleShipper == nil {
+		return
+	}
+
+	consoleShipper.Ship(map[string]string{"source": "console", "server": uuid}, line)
+}
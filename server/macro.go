@@ -0,0 +1,172 @@
+package server
+
+import (
+	"github.com/pkg/errors"
+	"github.com/pterodactyl/wings/store"
+	"go.uber.org/zap"
+	"regexp"
+	"sync"
+	"time"
+)
+
+// A single command sent to the server as part of a macro.
+type MacroStep struct {
+	// The command to send to the server.
+	Command string `json:"command"`
+
+	// The number of milliseconds to wait before the command is sent.
+	Delay int `json:"delay"`
+}
+
+// A named sequence of commands that can be sent to the server in a single request, such as
+// warning players and saving the world before a backup is taken.
+type CommandMacro struct {
+	Name  string      `json:"name"`
+	Steps []MacroStep `json:"steps"`
+}
+
+// The limits placed on macros, so that a single macro cannot keep sending commands to the
+// server for an unreasonable amount of time.
+const (
+	maxMacroSteps = 50
+	maxMacroDelay = 10 * 60 * 1000
+)
+
+var macroNameRegex = regexp.MustCompile(`^[a-zA-Z0-9_-]{1,64}$`)
+
+var commandMacros = store.NewRepository(store.CommandMacros)
+
+// Guards reading and writing the macros of every server, since all of the macros of a server
+// are stored together.
+var macrosMu sync.Mutex
+
+// Returns the macros defined for the server, keyed by their name.
+func (s *Server) Macros() (map[string]CommandMacro, error) {
+	macrosMu.Lock()
+	defer macrosMu.Unlock()
+
+	return s.loadMacros()
+}
+
+func (s *Server) loadMacros() (map[string]CommandMacro, error) {
+	m := make(map[string]CommandMacro)
+	if _, err := commandMacros.Get(s.Uuid, &m); err != nil {
+		return nil, err
+	}
+
+	return m, nil
+}
+
+// Validates a macro, returning an error describing the first problem found with it.
+func validateMacro(m CommandMacro) error {
+	if !macroNameRegex.MatchString(m.Name) {
+		return &macroValidationError{message: "macro names must be 1 to 64 letters, numbers, dashes, or underscores"}
+	}
+
+	if len(m.Steps) == 0 || len(m.Steps) > maxMacroSteps {
+		return &macroValidationError{message: "macros must have between 1 and 50 steps"}
+	}
+
+	for _, step := range m.Steps {
+		if step.Command == "" {
+			return &macroValidationError{message: "every step of a macro must have a command"}
+		}
+
+		if step.Delay < 0 || step.Delay > maxMacroDelay {
+			return &macroValidationError{message: "the delay before each step must be between 0 and 600000 milliseconds"}
+		}
+	}
+
+	return nil
+}
+
+// Creates or replaces a macro for the server.
+func (s *Server) SetMacro(m CommandMacro) error {
+	if err := validateMacro(m); err != nil {
+		return err
+	}
+
+	macrosMu.Lock()
+	defer macrosMu.Unlock()
+
+	macros, err := s.loadMacros()
+	if err != nil {
+		return err
+	}
+
+	macros[m.Name] = m
+
+	return commandMacros.Put(s.Uuid, macros)
+}
+
+// Removes a macro from the server.
+func (s *Server) DeleteMacro(name string) error {
+	macrosMu.Lock()
+	defer macrosMu.Unlock()
+
+	macros, err := s.loadMacros()
+	if err != nil {
+		return err
+	}
+
+	if _, ok := macros[name]; !ok {
+		return &macroNotFound{name: name}
+	}
+
+	delete(macros, name)
+	if len(macros) == 0 {
+		return commandMacros.Delete(s.Uuid)
+	}
+
+	return commandMacros.Put(s.Uuid, macros)
+}
+
+// Removes every macro defined for the server, this should be called when the server is
+// deleted from the node.
+func (s *Server) RemoveMacros() error {
+	macrosMu.Lock()
+	defer macrosMu.Unlock()
+
+	return commandMacros.Delete(s.Uuid)
+}
+
+// Sends the commands of a macro to the server in the background, waiting for the delay of
+// each step before sending it. Every command is checked against the denied commands for the
+// server before any are sent, and the macro is abandoned if the server stops while it runs.
+func (s *Server) RunMacro(name string) error {
+	macros, err := s.Macros()
+	if err != nil {
+		return err
+	}
+
+	m, ok := macros[name]
+	if !ok {
+		return &macroNotFound{name: name}
+	}
+
+	for _, step := range m.Steps {
+		if err := s.CheckCommand(step.Command, CommandSourceMacro); err != nil {
+			return err
+		}
+	}
+
+	go func() {
+		for _, step := range m.Steps {
+			if step.Delay > 0 {
+				time.Sleep(time.Duration(step.Delay) * time.Millisecond)
+			}
+
+			if s.GetState() == ProcessOfflineState {
+				zap.S().Debugw("abandoning command macro for stopped server", zap.String("server", s.Uuid), zap.String("macro", m.Name))
+				return
+			}
+
+			if err := s.Environment.SendCommand(step.Command); err != nil {
+				zap.S().Warnw("failed to send macro command to server", zap.String("server", s.Uuid), zap.String("macro", m.Name), zap.Error(errors.WithStack(err)))
+				return
+			}
+		}
+	}()
+
+	return nil
+}
@@ -0,0 +1,34 @@
+package server
+
+import (
+	"github.com/pterodactyl/wings/config"
+)
+
+type maintenanceModeError struct {
+	message string
+}
+
+func (e *maintenanceModeError) Error() string {
+	if e.message != "" {
+		return "this node is currently in maintenance mode: " + e.message
+	}
+
+	return "this node is currently in maintenance mode"
+}
+
+func IsMaintenanceModeError(err error) bool {
+	_, ok := err.(*maintenanceModeError)
+
+	return ok
+}
+
+// Returns an error if the node is in maintenance mode. This should be checked before any
+// action that starts, installs, or transfers a server.
+func CheckMaintenanceMode() error {
+	m := config.Get().System.Maintenance
+	if !m.Enabled {
+		return nil
+	}
+
+	return &maintenanceModeError{message: m.Message}
+}
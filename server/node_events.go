@@ -0,0 +1,75 @@
+package server
+
+import (
+	"encoding/json"
+	"go.uber.org/zap"
+)
+
+// Events that are only published to the node event bus, alongside the status, backup and
+// health events that are also published for each server.
+const (
+	InstallStartedEvent    = "install started"
+	InstallCompletedEvent  = "install completed"
+	CrashEvent             = "crash"
+	StartupTimeoutEvent    = "startup timeout"
+	IdleStopEvent          = "idle stop"
+	WakeEvent              = "wake"
+	TransferStartedEvent   = "transfer started"
+	TransferCompletedEvent = "transfer completed"
+	TransferFailedEvent    = "transfer failed"
+	AddressBannedEvent     = "address banned"
+	AddressUnbannedEvent   = "address unbanned"
+	CommandDeniedEvent     = "command denied"
+	ExecStartedEvent       = "exec started"
+	ExecEndedEvent         = "exec ended"
+)
+
+// All of the topics that are published to the node event bus.
+var NodeEventTopics = []string{
+	StatusEvent,
+	InstallStartedEvent,
+	InstallCompletedEvent,
+	CrashEvent,
+	StartupTimeoutEvent,
+	IdleStopEvent,
+	WakeEvent,
+	TransferStartedEvent,
+	TransferCompletedEvent,
+	TransferFailedEvent,
+	TransferProgressEvent,
+	BackupCompletedEvent,
+	HealthEvent,
+	AddressBannedEvent,
+	AddressUnbannedEvent,
+	CommandDeniedEvent,
+	ExecStartedEvent,
+	ExecEndedEvent,
+}
+
+// The data sent with every node event, identifying the server the event is for. Events
+// that are not for a specific server, such as bans, have an empty server.
+type NodeEvent struct {
+	Server string      `json:"server"`
+	Data   interface{} `json:"data,omitempty"`
+}
+
+var nodeEvents = &EventBus{
+	subscribers: map[string][]chan Event{},
+}
+
+// Returns the event bus for events across every server on the node. This allows tools
+// to follow what is happening on the node without subscribing to each server.
+func NodeEvents() *EventBus {
+	return nodeEvents
+}
+
+// Publishes an event for a server to the node event bus.
+func PublishNodeEvent(topic string, uuid string, data interface{}) {
+	b, err := json.Marshal(NodeEvent{Server: uuid, Data: data})
+	if err != nil {
+		zap.S().Warnw("failed to encode node event", zap.String("server", uuid), zap.String("event", topic), zap.Error(err))
+		return
+	}
+
+	nodeEvents.Publish(topic, string(b))
+}
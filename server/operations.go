@@ -0,0 +1,206 @@
+package server
+
+import (
+	"fmt"
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+	"runtime/debug"
+	"sync"
+	"time"
+)
+
+// The operations that are run one at a time for a server, in the order they were requested.
+const (
+	OperationPower     = "power"
+	OperationInstall   = "install"
+	OperationReinstall = "reinstall"
+	OperationBackup    = "backup"
+	OperationTransfer  = "transfer"
+)
+
+// The number of operations that can be waiting for a server at once.
+const maxPendingOperations = 10
+
+type operationConflict struct {
+	operation string
+}
+
+func (e *operationConflict) Error() string {
+	return fmt.Sprintf("a %s operation is already running or waiting to run for this server", e.operation)
+}
+
+func IsOperationConflictError(err error) bool {
+	_, ok := err.(*operationConflict)
+
+	return ok
+}
+
+type operationQueueFull struct {
+}
+
+func (e *operationQueueFull) Error() string {
+	return "there are too many operations waiting to run for this server"
+}
+
+func IsOperationQueueFullError(err error) bool {
+	_, ok := err.(*operationQueueFull)
+
+	return ok
+}
+
+// The operation currently running for a server, and those waiting to run after it.
+type OperationState struct {
+	Current string     `json:"current"`
+	Since   *time.Time `json:"since,omitempty"`
+	Pending []string   `json:"pending"`
+}
+
+type operation struct {
+	kind string
+	run  func() error
+}
+
+// Runs the operations for a server one at a time. Power actions can be queued any number
+// of times, since each one depends on the state left by the one before it, but any other
+// operation is rejected if the same kind of operation is already running or waiting to
+// run. Installs and reinstalls are treated as the same kind of operation.
+type operationQueue struct {
+	mu      sync.Mutex
+	running bool
+	current *operation
+	started time.Time
+	pending []*operation
+}
+
+// Returns the group that an operation kind conflicts within.
+func operationGroup(kind string) string {
+	if kind == OperationReinstall {
+		return OperationInstall
+	}
+
+	return kind
+}
+
+// Adds an operation to the queue for the server, returning immediately. Operations run in
+// the order they were queued, and any error returned by one is logged.
+func (s *Server) QueueOperation(kind string, fn func() error) error {
+	q := &s.operations
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if kind != OperationPower {
+		group := operationGroup(kind)
+
+		conflict := q.current != nil && operationGroup(q.current.kind) == group
+		for _, op := range q.pending {
+			conflict = conflict || operationGroup(op.kind) == group
+		}
+
+		if conflict {
+			return &operationConflict{operation: kind}
+		}
+	}
+
+	if len(q.pending) >= maxPendingOperations {
+		return &operationQueueFull{}
+	}
+
+	q.pending = append(q.pending, &operation{kind: kind, run: fn})
+
+	// Start working through the queue if nothing is running, otherwise the operation is
+	// picked up once the ones before it have completed.
+	if !q.running {
+		q.running = true
+		go s.processOperations()
+	}
+
+	return nil
+}
+
+// Adds an operation to the queue for the server and waits for it to complete, returning
+// the error from the operation rather than logging it.
+func (s *Server) RunOperation(kind string, fn func() error) error {
+	done := make(chan struct{})
+
+	var result error
+	err := s.QueueOperation(kind, func() error {
+		defer close(done)
+
+		// Only replaced once the operation returns, so a panic is still reported.
+		result = errors.New("the operation was interrupted")
+		result = fn()
+
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	<-done
+
+	return result
+}
+
+// Returns the operation currently running for the server and those waiting to run.
+func (s *Server) Operations() OperationState {
+	q := &s.operations
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	state := OperationState{Pending: make([]string, len(q.pending))}
+	if q.current != nil {
+		state.Current = q.current.kind
+		started := q.started
+		state.Since = &started
+	}
+
+	for i, op := range q.pending {
+		state.Pending[i] = op.kind
+	}
+
+	return state
+}
+
+func (s *Server) processOperations() {
+	q := &s.operations
+
+	for {
+		q.mu.Lock()
+		if len(q.pending) == 0 {
+			q.running = false
+			q.current = nil
+			q.mu.Unlock()
+			return
+		}
+
+		op := q.pending[0]
+		q.pending = q.pending[1:]
+		q.current = op
+		q.started = time.Now()
+		q.mu.Unlock()
+
+		s.runOperation(op)
+	}
+}
+
+// Runs a single operation, recovering from any panic so that the operations queued after
+// it still run.
+func (s *Server) runOperation(op *operation) {
+	defer func() {
+		if r := recover(); r != nil {
+			zap.S().Errorw(
+				"recovered from panic while running server operation",
+				zap.String("server", s.Uuid),
+				zap.String("operation", op.kind),
+				zap.Any("panic", r),
+				zap.ByteString("stack", debug.Stack()),
+			)
+		}
+	}()
+
+	if err := op.run(); err != nil {
+		zap.S().Errorw("failed to complete server operation", zap.String("server", s.Uuid), zap.String("operation", op.kind), zap.Error(err))
+	}
+}
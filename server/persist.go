@@ -0,0 +1,104 @@
+package server
+
+import (
+	"encoding/json"
+	"github.com/pkg/errors"
+	"github.com/pterodactyl/wings/api"
+	"github.com/pterodactyl/wings/config"
+	"go.uber.org/zap"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Returns the path of the file that the configuration for a server is persisted to.
+func configurationPath(uuid string) string {
+	return filepath.Join(config.Get().System.ServerConfigDirectory, uuid+".json")
+}
+
+// Writes the current configuration of the server to the disk, in the same format it is
+// returned by the Panel, so that the server can still be loaded when the daemon boots
+// while the Panel is unreachable. The file is written to a temporary location first and
+// then moved into place so that a crash cannot leave a partially written file behind.
+func (s *Server) persistConfiguration() error {
+	if s.Uuid == "" {
+		return nil
+	}
+
+	// The fields are read while holding the lock so that the configuration written is a
+	// consistent snapshot, rather than one changed part way through by another update.
+	s.RLock()
+	settings, err := json.Marshal(s)
+	process := s.processConfiguration
+	s.RUnlock()
+
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	b, err := json.Marshal(&api.ServerConfigurationResponse{
+		Settings:             settings,
+		ProcessConfiguration: process,
+	})
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	p := configurationPath(s.Uuid)
+	if err := os.MkdirAll(filepath.Dir(p), 0700); err != nil {
+		return errors.WithStack(err)
+	}
+
+	if err := ioutil.WriteFile(p+".tmp", b, 0600); err != nil {
+		return errors.WithStack(err)
+	}
+
+	return errors.WithStack(os.Rename(p+".tmp", p))
+}
+
+// Removes the persisted configuration for the server, this should be called when the
+// server is deleted from the node.
+func (s *Server) RemovePersistedConfiguration() error {
+	if err := os.Remove(configurationPath(s.Uuid)); err != nil && !os.IsNotExist(err) {
+		return errors.WithStack(err)
+	}
+
+	return nil
+}
+
+// Reads all of the server configurations that have been persisted to the disk, keyed by
+// the server UUID. Files that cannot be read are skipped.
+func loadPersistedConfigurations() (map[string]*api.ServerConfigurationResponse, error) {
+	dir := config.Get().System.ServerConfigDirectory
+
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	configs := make(map[string]*api.ServerConfigurationResponse, len(files))
+	for _, f := range files {
+		if f.IsDir() || !strings.HasSuffix(f.Name(), ".json") {
+			continue
+		}
+
+		uuid := strings.TrimSuffix(f.Name(), ".json")
+
+		b, err := ioutil.ReadFile(filepath.Join(dir, f.Name()))
+		if err != nil {
+			zap.S().Warnw("failed to read persisted server configuration", zap.String("server", uuid), zap.Error(err))
+			continue
+		}
+
+		c := &api.ServerConfigurationResponse{}
+		if err := json.Unmarshal(b, c); err != nil {
+			zap.S().Warnw("failed to parse persisted server configuration", zap.String("server", uuid), zap.Error(err))
+			continue
+		}
+
+		configs[uuid] = c
+	}
+
+	return configs, nil
+}
@@ -0,0 +1,95 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"github.com/docker/docker/client"
+	"github.com/pkg/errors"
+	"github.com/pterodactyl/wings/config"
+	"go.uber.org/zap"
+	"runtime"
+	"strings"
+	"sync"
+)
+
+type noMatchingManifest struct {
+	image    string
+	platform string
+}
+
+func (e *noMatchingManifest) Error() string {
+	return fmt.Sprintf("the image %s is not available for the %s platform", e.image, e.platform)
+}
+
+// Determines if the error is caused by an image not having a version for the platform it
+// was pulled for.
+func IsNoMatchingManifestError(err error) bool {
+	_, ok := errors.Cause(err).(*noMatchingManifest)
+
+	return ok
+}
+
+// The names Docker reports for architectures, mapped to the names used for platforms when
+// pulling images.
+var architectures = map[string]string{
+	"x86_64":  "amd64",
+	"i386":    "386",
+	"i686":    "386",
+	"aarch64": "arm64",
+	"armv7l":  "arm/v7",
+	"armv6l":  "arm/v6",
+}
+
+var (
+	detectPlatform sync.Once
+	nodePlatform   string
+)
+
+// Returns the platform that images are pulled for on this node, such as "linux/amd64".
+// This is the platform set in the configuration if there is one, otherwise the platform of
+// the Docker daemon, which is only looked up the first time this is called.
+func NodePlatform() string {
+	if p := config.Get().Docker.Platform; p != "" {
+		return p
+	}
+
+	detectPlatform.Do(func() {
+		nodePlatform = runtime.GOOS + "/" + runtime.GOARCH
+
+		cli, err := client.NewClientWithOpts(client.FromEnv)
+		if err != nil {
+			zap.S().Warnw("failed to create docker client to detect node platform", zap.Error(err))
+			return
+		}
+
+		info, err := cli.Info(context.Background())
+		if err != nil {
+			zap.S().Warnw("failed to detect node platform from docker, using the platform of the daemon", zap.String("platform", nodePlatform), zap.Error(err))
+			return
+		}
+
+		arch := info.Architecture
+		if a, ok := architectures[arch]; ok {
+			arch = a
+		}
+
+		nodePlatform = strings.ToLower(info.OSType + "/" + arch)
+	})
+
+	return nodePlatform
+}
+
+// Returns the platform that images for the server are pulled for. Servers can override the
+// platform of the node, which allows images built for another architecture to be run under
+// emulation, as long as the host has been set up to run binaries for that architecture.
+func (s *Server) ContainerPlatform() string {
+	s.RLock()
+	p := s.Container.Platform
+	s.RUnlock()
+
+	if p != "" {
+		return p
+	}
+
+	return NodePlatform()
+}
@@ -0,0 +1,221 @@
+package server
+
+import (
+	"context"
+	"github.com/pkg/errors"
+	"github.com/pterodactyl/wings/config"
+	"go.uber.org/zap"
+	"os"
+	"runtime/debug"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// The current state of the queue of power actions, and the totals for every action that
+// has been processed since the daemon was started.
+type PowerQueueStats struct {
+	Workers   int    `json:"workers"`
+	Queued    int    `json:"queued"`
+	Running   int64  `json:"running"`
+	Completed uint64 `json:"completed"`
+	Failed    uint64 `json:"failed"`
+	TimedOut  uint64 `json:"timed_out"`
+	Panicked  uint64 `json:"panicked"`
+}
+
+type powerJob struct {
+	server *Server
+	action PowerAction
+	queued time.Time
+	done   chan error
+}
+
+// Processes power actions using a fixed number of workers so that a large number of
+// actions requested at once are worked through a few at a time.
+type powerQueue struct {
+	jobs     chan powerJob
+	workers  int
+	timeouts config.PowerActionTimeouts
+
+	running   int64
+	completed uint64
+	failed    uint64
+	timedOut  uint64
+	panicked  uint64
+}
+
+var (
+	powerQueueOnce sync.Once
+	powerQueueInst *powerQueue
+)
+
+// Returns the power queue for the node, starting its workers the first time it is used.
+func getPowerQueue() *powerQueue {
+	powerQueueOnce.Do(func() {
+		c := config.Get().System.PowerQueue
+
+		workers := c.Workers
+		if workers < 1 {
+			workers = 1
+		}
+
+		size := c.Size
+		if size < 0 {
+			size = 0
+		}
+
+		powerQueueInst = &powerQueue{
+			jobs:     make(chan powerJob, size),
+			workers:  workers,
+			timeouts: c.Timeouts,
+		}
+
+		for i := 0; i < workers; i++ {
+			go powerQueueInst.work()
+		}
+	})
+
+	return powerQueueInst
+}
+
+// Queues a power action for the server, returning immediately. The action runs once the
+// operations queued for the server before it have completed, and a worker is free to
+// process it. Any error encountered while processing the action is logged.
+func (s *Server) QueuePowerAction(action PowerAction) error {
+	return s.QueueOperation(OperationPower, func() error {
+		return getPowerQueue().submit(s, action)
+	})
+}
+
+// Runs a power action for the server in the same way as QueuePowerAction, but waits for
+// the action to complete and returns any error encountered.
+func (s *Server) RunPowerAction(action PowerAction) error {
+	return s.RunOperation(OperationPower, func() error {
+		return getPowerQueue().submit(s, action)
+	})
+}
+
+// Passes a power action to the workers, waiting until there is room in the queue for it
+// and then until it has been processed.
+func (q *powerQueue) submit(s *Server, action PowerAction) error {
+	j := powerJob{server: s, action: action, queued: time.Now(), done: make(chan error, 1)}
+
+	q.jobs <- j
+
+	return <-j.done
+}
+
+// Returns the current state of the power queue.
+func GetPowerQueueStats() PowerQueueStats {
+	q := getPowerQueue()
+
+	return PowerQueueStats{
+		Workers:   q.workers,
+		Queued:    len(q.jobs),
+		Running:   atomic.LoadInt64(&q.running),
+		Completed: atomic.LoadUint64(&q.completed),
+		Failed:    atomic.LoadUint64(&q.failed),
+		TimedOut:  atomic.LoadUint64(&q.timedOut),
+		Panicked:  atomic.LoadUint64(&q.panicked),
+	}
+}
+
+func (q *powerQueue) work() {
+	for j := range q.jobs {
+		j.done <- q.run(j)
+	}
+}
+
+// Returns the amount of time the worker waits for an action to complete.
+func (q *powerQueue) timeout(action string) time.Duration {
+	var t int
+	switch action {
+	case "start":
+		t = q.timeouts.Start
+	case "stop":
+		t = q.timeouts.Stop
+	case "restart":
+		t = q.timeouts.Restart
+	case "kill":
+		t = q.timeouts.Kill
+	}
+
+	return time.Second * time.Duration(t)
+}
+
+// Runs a single power action, waiting until it completes. The action is run in its own
+// goroutine so that a panic while processing it cannot take the worker down with it. If the
+// action does not complete before its timeout it is cancelled by killing the server process,
+// and the worker still waits for it to return so that two actions for the same server are
+// never running at once.
+func (q *powerQueue) run(j powerJob) error {
+	atomic.AddInt64(&q.running, 1)
+	defer atomic.AddInt64(&q.running, -1)
+
+	ctx := context.Background()
+	if t := q.timeout(j.action.Action); t > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, t)
+		defer cancel()
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		defer func() {
+			if r := recover(); r != nil {
+				atomic.AddUint64(&q.panicked, 1)
+
+				zap.S().Errorw(
+					"recovered from panic while processing a server power action",
+					zap.String("server", j.server.Uuid),
+					zap.String("action", j.action.Action),
+					zap.Any("panic", r),
+					zap.ByteString("stack", debug.Stack()),
+				)
+
+				done <- errors.Errorf("panic while processing power action: %v", r)
+			}
+		}()
+
+		done <- j.server.HandlePowerAction(j.action)
+	}()
+
+	select {
+	case err := <-done:
+		if err != nil {
+			atomic.AddUint64(&q.failed, 1)
+
+			return err
+		}
+
+		atomic.AddUint64(&q.completed, 1)
+
+		zap.S().Debugw(
+			"processed server power action",
+			zap.String("server", j.server.Uuid),
+			zap.String("action", j.action.Action),
+			zap.Duration("elapsed", time.Since(j.queued)),
+		)
+
+		return nil
+	case <-ctx.Done():
+		atomic.AddUint64(&q.timedOut, 1)
+
+		zap.S().Warnw(
+			"server power action did not complete in time, killing the server process",
+			zap.String("server", j.server.Uuid),
+			zap.String("action", j.action.Action),
+		)
+
+		// Killing the process is the only way to interrupt an action that is waiting on it,
+		// such as a stop that the process is ignoring.
+		if err := j.server.Environment.Terminate(os.Kill); err != nil {
+			zap.S().Debugw("failed to kill server process after power action timed out", zap.String("server", j.server.Uuid), zap.Error(err))
+		}
+
+		<-done
+
+		return errors.New("the power action did not complete in time")
+	}
+}
@@ -0,0 +1,107 @@
+package server
+
+import (
+	"github.com/pterodactyl/wings/query"
+	"go.uber.org/zap"
+	"net"
+	"strconv"
+	"time"
+)
+
+// Defines how the game server process should be queried for status information such as
+// the number of players that are currently online.
+type QuerySettings struct {
+	// The query provider to use, one of "a2s", "minecraft", or "bedrock". If empty, the
+	// server is not queried.
+	Type string `json:"type" yaml:"type"`
+
+	// The port to send queries to. If not set the port of the default allocation is used.
+	Port int `json:"port" yaml:"port"`
+
+	// The number of seconds between each query of the server.
+	Interval int `default:"30" json:"interval" yaml:"interval"`
+}
+
+// Returns the address that queries should be sent to. Servers bound to every interface
+// are queried over the loopback address.
+func (s *Server) queryAddress() string {
+	ip := net.ParseIP(normalizeAllocationIp(s.Allocations.DefaultMapping.Ip))
+	if ip == nil || ip.IsUnspecified() {
+		if ip != nil && ip.To4() == nil {
+			ip = net.IPv6loopback
+		} else {
+			ip = net.IPv4(127, 0, 0, 1)
+		}
+	}
+
+	port := s.Query.Port
+	if port == 0 {
+		port = s.Allocations.DefaultMapping.Port
+	}
+
+	return net.JoinHostPort(ip.String(), strconv.Itoa(port))
+}
+
+// Begins periodically querying the server process for status information. The results
+// are stored on the server resource usage and emitted over the event bus whenever they
+// change.
+func (s *Server) enableQueryPolling() {
+	if s.Query.Type == "" {
+		return
+	}
+
+	stop := make(chan struct{})
+
+	s.Lock()
+	if s.queryPolling != nil {
+		close(s.queryPolling)
+	}
+	s.queryPolling = stop
+	s.Unlock()
+
+	interval := s.Query.Interval
+	if interval <= 0 {
+		interval = 30
+	}
+
+	go func() {
+		ticker := time.NewTicker(time.Duration(interval) * time.Second)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+				r, err := query.Query(s.Query.Type, s.queryAddress(), time.Second*5)
+				if err != nil {
+					zap.S().Debugw("failed to query server process", zap.String("server", s.Uuid), zap.String("type", s.Query.Type), zap.Error(err))
+					continue
+				}
+
+				var prev *query.Result
+				s.UpdateResources(func(ru *ResourceUsage) {
+					prev, ru.Query = ru.Query, r
+				})
+
+				if prev == nil || *prev != *r {
+					s.Events().PublishJson(QueryEvent, r)
+				}
+			}
+		}
+	}()
+}
+
+// Stops querying the server process and clears the last result.
+func (s *Server) disableQueryPolling() {
+	s.Lock()
+	if s.queryPolling != nil {
+		close(s.queryPolling)
+		s.queryPolling = nil
+	}
+	s.Unlock()
+
+	s.UpdateResources(func(ru *ResourceUsage) {
+		ru.Query = nil
+	})
+}
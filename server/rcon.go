@@ -0,0 +1,80 @@
+package server
+
+import (
+	"github.com/pkg/errors"
+	"github.com/pterodactyl/wings/rcon"
+	"net"
+	"strconv"
+	"time"
+)
+
+// Defines the RCON credentials for the server process. If these are not set the values
+// of the RCON_PORT and RCON_PASSWORD environment variables for the server are used,
+// since that is what most eggs use to configure RCON.
+type RconSettings struct {
+	Port     int    `json:"port" yaml:"port"`
+	Password string `json:"password" yaml:"password"`
+}
+
+type rconNotConfigured struct {
+}
+
+func (e *rconNotConfigured) Error() string {
+	return "rcon is not configured for this server"
+}
+
+func IsRconNotConfiguredError(err error) bool {
+	_, ok := err.(*rconNotConfigured)
+
+	return ok
+}
+
+// Returns the RCON port and password to use for the server.
+func (s *Server) rconCredentials() (int, string) {
+	port, password := s.Rcon.Port, s.Rcon.Password
+
+	if port == 0 {
+		port, _ = strconv.Atoi(s.EnvVars["RCON_PORT"])
+	}
+
+	if password == "" {
+		password = s.EnvVars["RCON_PASSWORD"]
+	}
+
+	return port, password
+}
+
+// Implemented by environments that run the server process with its own network address.
+type containerAddresser interface {
+	ContainerIp() (net.IP, error)
+}
+
+// Sends a command to the server process over RCON and returns the response. RCON is
+// accessed using the address of the container when the environment has one, so the port
+// does not need to be exposed as an allocation. Otherwise the address of the default
+// allocation is used, or the loopback address if the server listens on every address.
+func (s *Server) ExecuteRconCommand(command string) (string, error) {
+	port, password := s.rconCredentials()
+	if port == 0 || password == "" {
+		return "", &rconNotConfigured{}
+	}
+
+	if s.GetState() == ProcessOfflineState {
+		return "", errors.New("cannot send an rcon command to a server that is not running")
+	}
+
+	var ip net.IP
+	if e, ok := s.Environment.(containerAddresser); ok {
+		var err error
+		if ip, err = e.ContainerIp(); err != nil {
+			return "", errors.Wrap(err, "failed to determine the address of the server container")
+		}
+	} else {
+		ip = net.ParseIP(normalizeAllocationIp(s.Allocations.DefaultMapping.Ip))
+		if ip == nil || ip.IsUnspecified() {
+			ip = net.IPv4(127, 0, 0, 1)
+		}
+	}
+
+	return rcon.Execute(net.JoinHostPort(ip.String(), strconv.Itoa(port)), password, command, time.Second*10)
+}
@@ -0,0 +1,227 @@
+package server
+
+import (
+	"github.com/pkg/errors"
+	"github.com/pterodactyl/wings/config"
+	"go.uber.org/zap"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+// Options that control what happens to the existing files of a server when it is
+// reinstalled.
+type ReinstallOptions struct {
+	// Removes all of the existing server files before the install script is run, other
+	// than anything matched by the keep patterns.
+	Wipe bool `json:"wipe"`
+
+	// Patterns matching files and folders that should be kept as they are, such as worlds
+	// and configuration files. These use the same syntax as the ignore file used when
+	// archiving a server. Anything matched is moved out of the server directory while the
+	// install script runs and then put back, replacing anything the script created.
+	Keep []string `json:"keep"`
+}
+
+// Checks that all of the keep patterns are valid.
+func (o *ReinstallOptions) Validate() error {
+	for _, p := range o.Keep {
+		if _, err := filepath.Match(p, ""); err != nil {
+			return errors.New("invalid keep pattern: " + p)
+		}
+	}
+
+	return nil
+}
+
+// Reinstalls a server's software by utilizing the install script for the server egg. By
+// default this does not touch any existing files for the server, other than what the
+// script modifies, but the options can be used to start from an empty directory and to
+// keep specific files untouched.
+func (s *Server) Reinstall(opts ReinstallOptions) error {
+	if s.GetState() != ProcessOfflineState {
+		zap.S().Debugw("waiting for server instance to enter a stopped state", zap.String("server", s.Uuid))
+		if err := s.Environment.WaitForStop(10, true); err != nil {
+			return err
+		}
+	}
+
+	stash := filepath.Join(config.Get().System.ReinstallDirectory, s.Uuid)
+
+	// If a previous reinstall was interrupted before its files were put back, restore them
+	// now so that they are not lost by this reinstall.
+	if _, err := os.Stat(stash); err == nil {
+		zap.S().Warnw("restoring files kept from an interrupted reinstall", zap.String("server", s.Uuid))
+		if err := s.Filesystem.restoreStash(stash); err != nil {
+			return err
+		}
+	}
+
+	if len(opts.Keep) > 0 {
+		s.PublishInstallOutputFromDaemon("Moving files to keep out of the server directory...")
+
+		if err := s.Filesystem.stashMatching(stash, IgnoreRules(opts.Keep)); err != nil {
+			// Put back anything that was moved before the failure, the reinstall has not
+			// started yet so the server should be left as it was.
+			if rerr := s.Filesystem.restoreStash(stash); rerr != nil {
+				zap.S().Errorw("failed to restore kept files after failed reinstall", zap.String("server", s.Uuid), zap.String("path", stash), zap.Error(rerr))
+			}
+
+			return err
+		}
+	}
+
+	if opts.Wipe {
+		s.PublishInstallOutputFromDaemon("Removing existing server files...")
+
+		if err := s.Filesystem.wipe(); err != nil {
+			if rerr := s.Filesystem.restoreStash(stash); rerr != nil {
+				zap.S().Errorw("failed to restore kept files after failed reinstall", zap.String("server", s.Uuid), zap.String("path", stash), zap.Error(rerr))
+			}
+
+			return err
+		}
+	}
+
+	err := s.Install()
+
+	if _, serr := os.Stat(stash); serr == nil {
+		s.PublishInstallOutputFromDaemon("Restoring kept files...")
+
+		if rerr := s.Filesystem.restoreStash(stash); rerr != nil {
+			// The files are left where they are so that they can be recovered by hand, or
+			// put back automatically the next time the server is reinstalled.
+			zap.S().Errorw("failed to restore kept files after reinstall", zap.String("server", s.Uuid), zap.String("path", stash), zap.Error(rerr))
+
+			if err == nil {
+				err = rerr
+			}
+		}
+	}
+
+	return err
+}
+
+// Moves everything in the server directory matched by the rules into the stash directory,
+// keeping the same directory structure.
+func (fs *Filesystem) stashMatching(stash string, rules IgnoreRules) error {
+	root := fs.Path()
+
+	var matched []string
+	err := filepath.Walk(root, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if p == root {
+			return nil
+		}
+
+		rel, err := filepath.Rel(root, p)
+		if err != nil {
+			return err
+		}
+
+		if rules.Matches(rel, info.IsDir()) {
+			matched = append(matched, rel)
+
+			if info.IsDir() {
+				return filepath.SkipDir
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	for _, rel := range matched {
+		dst := filepath.Join(stash, rel)
+		if err := os.MkdirAll(filepath.Dir(dst), 0700); err != nil {
+			return errors.WithStack(err)
+		}
+
+		if err := os.Rename(filepath.Join(root, rel), dst); err != nil {
+			return errors.WithStack(err)
+		}
+	}
+
+	return nil
+}
+
+// Moves everything in the stash directory back into the server directory, replacing any
+// files that already exist, and then removes the stash. Directories are merged so that
+// anything the install script created alongside the kept files is left in place.
+func (fs *Filesystem) restoreStash(stash string) error {
+	root := fs.Path()
+
+	err := filepath.Walk(stash, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if p == stash {
+			return nil
+		}
+
+		rel, err := filepath.Rel(stash, p)
+		if err != nil {
+			return err
+		}
+
+		dst := filepath.Join(root, rel)
+		if info.IsDir() {
+			// Only move the directory as a whole if nothing exists at the destination,
+			// otherwise merge its contents into the existing directory.
+			if st, err := os.Lstat(dst); err == nil && st.IsDir() {
+				return nil
+			} else if err == nil {
+				if err := os.RemoveAll(dst); err != nil {
+					return err
+				}
+			}
+
+			if err := os.Rename(p, dst); err != nil {
+				return err
+			}
+
+			return filepath.SkipDir
+		}
+
+		if err := os.RemoveAll(dst); err != nil {
+			return err
+		}
+
+		if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+			return err
+		}
+
+		return os.Rename(p, dst)
+	})
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	if err := os.RemoveAll(stash); err != nil {
+		return errors.WithStack(err)
+	}
+
+	return fs.Chown("/")
+}
+
+// Removes all of the files and folders in the server directory.
+func (fs *Filesystem) wipe() error {
+	files, err := ioutil.ReadDir(fs.Path())
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	for _, f := range files {
+		if err := os.RemoveAll(filepath.Join(fs.Path(), f.Name())); err != nil {
+			return errors.WithStack(err)
+		}
+	}
+
+	return nil
+}
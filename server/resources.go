@@ -2,7 +2,13 @@ package server
 
 import (
 	"github.com/docker/docker/api/types"
+	"github.com/pterodactyl/wings/query"
+	"github.com/remeh/sizedwaitgroup"
+	"go.uber.org/zap"
 	"math"
+	"runtime"
+	"sync"
+	"time"
 )
 
 // Defines the current resource usage for a given server instance. If a server is offline you
@@ -26,6 +32,29 @@ type ResourceUsage struct {
 		RxBytes uint64 `json:"rx_bytes"`
 		TxBytes uint64 `json:"tx_bytes"`
 	} `json:"network"`
+	// The last status information returned by querying the server process, if querying
+	// is enabled for the server.
+	Query *query.Result `json:"query,omitempty"`
+}
+
+// Returns a copy of the current resource usage of the server. The usage is written by the
+// environment while the server is running, so it must only be read through here.
+func (s *Server) GetResources() ResourceUsage {
+	s.RLock()
+	defer s.RUnlock()
+
+	return s.Resources
+}
+
+// Changes the resource usage of the server while holding the lock, returning a copy of the
+// usage once it has been changed.
+func (s *Server) UpdateResources(fn func(ru *ResourceUsage)) ResourceUsage {
+	s.Lock()
+	defer s.Unlock()
+
+	fn(&s.Resources)
+
+	return s.Resources
 }
 
 // Calculates the absolute CPU usage used by the server process on the system, not constrained
@@ -39,11 +68,16 @@ func (ru *ResourceUsage) CalculateAbsoluteCpu(pStats *types.CPUStats, stats *typ
 	// Calculate the change for the entire system's CPU usage between current and previous reading.
 	systemDelta := float64(stats.SystemUsage) - float64(pStats.SystemUsage)
 
-	// Calculate the total number of CPU cores being used.
+	// Calculate the total number of CPU cores being used. The usage of each core is not
+	// reported on hosts using cgroup v2, so if Docker did not report the number of cores
+	// that are online the number of cores on the system is used.
 	cpus := float64(stats.OnlineCPUs)
 	if cpus == 0.0 {
 		cpus = float64(len(stats.CPUUsage.PercpuUsage))
 	}
+	if cpus == 0.0 {
+		cpus = float64(runtime.NumCPU())
+	}
 
 	percent := 0.0
 	if systemDelta > 0.0 && cpuDelta > 0.0 {
@@ -51,4 +85,79 @@ func (ru *ResourceUsage) CalculateAbsoluteCpu(pStats *types.CPUStats, stats *typ
 	}
 
 	return math.Round(percent*1000) / 1000
-}
\ No newline at end of file
+}
+
+// Calculates the memory used by the server process, not including the inactive page cache
+// that the kernel reclaims when memory runs low. This matches the usage reported by Docker
+// and is what the OOM killer acts on, unlike the raw usage which grows as files are read.
+//
+// @see https://github.com/docker/cli/blob/aa097cf1aa19099da70930460250797c8920b709/cli/command/container/stats_helpers.go#L227
+func (ru *ResourceUsage) CalculateMemoryUsage(stats *types.MemoryStats) uint64 {
+	// Hosts using cgroup v1 report the inactive cache of the container and all of its
+	// children as "total_inactive_file", while cgroup v2 only has "inactive_file".
+	for _, k := range []string{"total_inactive_file", "inactive_file"} {
+		if v, ok := stats.Stats[k]; ok {
+			if v < stats.Usage {
+				return stats.Usage - v
+			}
+
+			return stats.Usage
+		}
+	}
+
+	return stats.Usage
+}
+
+// Returns the disk space used by the server in bytes. Unless the usage is being tracked
+// using filesystem notifications the value is cached for a minute, since calculating it
+// requires walking the entire server directory.
+func (s *Server) DiskUsage() (int64, error) {
+	if size, ok := s.Filesystem.TrackedUsage(); ok {
+		return size, nil
+	}
+
+	if x, exists := s.Cache.Get("disk_used"); exists {
+		return x.(int64), nil
+	}
+
+	size, err := s.Filesystem.DirectorySize("/")
+	if err != nil {
+		return 0, err
+	}
+
+	s.Cache.Set("disk_used", size, time.Second*60)
+
+	return size, nil
+}
+
+// Collects the current resource usage for each of the given servers, keyed by the server
+// UUID. Disk usage may need to be calculated for servers that do not have it cached, so
+// the servers are processed concurrently with at most the given number running at once.
+func GatherResourceUsage(servers []*Server, concurrency int) map[string]ResourceUsage {
+	var mu sync.Mutex
+	out := make(map[string]ResourceUsage, len(servers))
+
+	wg := sizedwaitgroup.New(concurrency)
+	for _, s := range servers {
+		wg.Add()
+
+		go func(s *Server) {
+			defer wg.Done()
+
+			usage := s.GetResources()
+			if disk, err := s.DiskUsage(); err != nil {
+				zap.S().Warnw("failed to determine disk usage for server", zap.String("server", s.Uuid), zap.Error(err))
+			} else {
+				usage.Disk = disk
+			}
+
+			mu.Lock()
+			out[s.Uuid] = usage
+			mu.Unlock()
+		}(s)
+	}
+
+	wg.Wait()
+
+	return out
+}
@@ -0,0 +1,70 @@
+package server
+
+import (
+	"github.com/pterodactyl/wings/config"
+	"go.uber.org/zap"
+	"io/ioutil"
+	"strconv"
+	"strings"
+)
+
+// Returns the lowest port that unprivileged users can bind to on the host, which is the
+// lowest port a rootless Docker daemon can publish container ports on.
+func unprivilegedPortStart() int {
+	b, err := ioutil.ReadFile("/proc/sys/net/ipv4/ip_unprivileged_port_start")
+	if err != nil {
+		return 1024
+	}
+
+	if v, err := strconv.Atoi(strings.TrimSpace(string(b))); err == nil {
+		return v
+	}
+
+	return 1024
+}
+
+// Determines if the port cannot be bound to by the containers of the server because Docker
+// is running rootless and the port is reserved for privileged users.
+func isPrivilegedPort(port int) bool {
+	return config.Get().Docker.Rootless.Active && port < unprivilegedPortStart()
+}
+
+// Warns about anything configured on this node that does not work when Docker is running
+// rootless. Nothing is changed, since each of these needs to be fixed on the host or in the
+// configuration of the daemon.
+func CheckRootlessCompatibility() {
+	c := config.Get().Docker
+	if !c.Rootless.Active {
+		return
+	}
+
+	if c.Network.Driver != "bridge" {
+		zap.S().Warnw("the configured docker network driver is not supported by rootless docker, servers may not be reachable", zap.String("driver", c.Network.Driver))
+	}
+
+	if c.Rootless.ContainerUid != 0 {
+		zap.S().Warnw("server processes are configured to run as a user other than root, files they write will be owned by a subordinate user that the daemon cannot manage", zap.Int("uid", c.Rootless.ContainerUid))
+	}
+
+	start := unprivilegedPortStart()
+	for _, s := range GetServers().All() {
+		var ports []int
+		for _, p := range s.Allocations.Mappings {
+			for _, port := range p {
+				if port < start {
+					ports = append(ports, port)
+				}
+			}
+		}
+
+		if len(ports) == 0 {
+			continue
+		}
+
+		if c.Rootless.SkipPrivilegedPorts {
+			zap.S().Warnw("server has allocations that rootless docker cannot bind to, they will not be published", zap.String("server", s.Uuid), zap.Ints("ports", ports), zap.Int("unprivileged_port_start", start))
+		} else {
+			zap.S().Warnw("server has allocations that rootless docker cannot bind to, it will fail to start until net.ipv4.ip_unprivileged_port_start is lowered", zap.String("server", s.Uuid), zap.Ints("ports", ports), zap.Int("unprivileged_port_start", start))
+		}
+	}
+}
@@ -0,0 +1,222 @@
+package server
+
+import (
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+	"math/rand"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	ScheduleActionPower   = "power"
+	ScheduleActionCommand = "command"
+	ScheduleActionBackup  = "backup"
+)
+
+// Defines a task that is executed by the daemon for a server on a cron schedule. These
+// run independently of the Panel so that basic automation continues to work even if
+// the Panel is unavailable.
+type Schedule struct {
+	// A unique identifier for the schedule, used when tracking the status of its runs.
+	Id string `json:"id" yaml:"id"`
+
+	// A standard five field cron expression, or one of the "@hourly" style macros.
+	Cron string `json:"cron" yaml:"cron"`
+
+	// The action to perform, one of "power", "command", or "backup".
+	Action string `json:"action" yaml:"action"`
+
+	// The power action to send, or command to run, depending on the action type.
+	Payload string `json:"payload" yaml:"payload"`
+
+	// The maximum number of seconds to randomly delay the run by. This avoids many
+	// servers performing heavy tasks at exactly the same moment.
+	Jitter int `json:"jitter" yaml:"jitter"`
+}
+
+// The status of the last run of a schedule.
+type ScheduleStatus struct {
+	Running     bool       `json:"is_running"`
+	LastRunAt   *time.Time `json:"last_run_at"`
+	LastError   string     `json:"last_error"`
+	Successful  bool       `json:"successful"`
+	SkippedRuns int        `json:"skipped_runs"`
+}
+
+// Tracks the status of all of the schedules for a single server.
+type scheduleTracker struct {
+	sync.Mutex
+	statuses map[string]*ScheduleStatus
+}
+
+// Returns the key used to track the status of a schedule.
+func (sc *Schedule) key(index int) string {
+	if sc.Id != "" {
+		return sc.Id
+	}
+
+	return strconv.Itoa(index)
+}
+
+// Returns the status of the given schedule, creating it if it has not been run yet.
+// This must be called while holding the tracker lock.
+func (t *scheduleTracker) get(key string) *ScheduleStatus {
+	if t.statuses == nil {
+		t.statuses = make(map[string]*ScheduleStatus)
+	}
+
+	if _, ok := t.statuses[key]; !ok {
+		t.statuses[key] = &ScheduleStatus{}
+	}
+
+	return t.statuses[key]
+}
+
+// A schedule defined on a server along with the status of its last run.
+type ScheduleWithStatus struct {
+	Schedule Schedule       `json:"schedule"`
+	Status   ScheduleStatus `json:"status"`
+}
+
+// Returns a copy of the schedules defined on the server.
+func (s *Server) GetSchedules() []Schedule {
+	s.RLock()
+	defer s.RUnlock()
+
+	return append([]Schedule{}, s.Schedules...)
+}
+
+// Returns a copy of every schedule defined on the server along with its status. Both are
+// read while holding the locks, so the schedules cannot change part way through and leave
+// a status paired with the wrong schedule.
+func (s *Server) ScheduleStatuses() []ScheduleWithStatus {
+	s.RLock()
+	defer s.RUnlock()
+
+	s.schedules.Lock()
+	defer s.schedules.Unlock()
+
+	out := make([]ScheduleWithStatus, len(s.Schedules))
+	for i, sc := range s.Schedules {
+		out[i] = ScheduleWithStatus{Schedule: sc, Status: *s.schedules.get(sc.key(i))}
+	}
+
+	return out
+}
+
+// Starts the scheduler loop which checks the schedules for every server at the start of
+// each minute and executes any that are due.
+func StartScheduler() {
+	rand.Seed(time.Now().UnixNano())
+
+	go func() {
+		for {
+			now := time.Now()
+			time.Sleep(now.Truncate(time.Minute).Add(time.Minute).Sub(now))
+
+			tick := time.Now().Truncate(time.Minute)
+			for _, s := range GetServers().All() {
+				s.runDueSchedules(tick)
+			}
+		}
+	}()
+}
+
+// Executes any schedules for the server that match the given time.
+func (s *Server) runDueSchedules(t time.Time) {
+	for i, sc := range s.GetSchedules() {
+		expr, err := parseCronExpression(sc.Cron)
+		if err != nil {
+			zap.S().Warnw("skipping schedule with invalid cron expression", zap.String("server", s.Uuid), zap.String("schedule", sc.key(i)), zap.Error(err))
+			continue
+		}
+
+		if !expr.Matches(t) {
+			continue
+		}
+
+		go s.runSchedule(sc, sc.key(i))
+	}
+}
+
+// Runs a single schedule, skipping it if the previous run of the same schedule has not
+// yet completed.
+func (s *Server) runSchedule(sc Schedule, key string) {
+	s.schedules.Lock()
+	status := s.schedules.get(key)
+	if status.Running {
+		status.SkippedRuns++
+		s.schedules.Unlock()
+
+		zap.S().Infow("skipping schedule run, previous run has not completed", zap.String("server", s.Uuid), zap.String("schedule", key))
+		return
+	}
+	status.Running = true
+	s.schedules.Unlock()
+
+	if sc.Jitter > 0 {
+		time.Sleep(time.Duration(rand.Intn(sc.Jitter*1000)) * time.Millisecond)
+	}
+
+	zap.S().Debugw("running server schedule", zap.String("server", s.Uuid), zap.String("schedule", key), zap.String("action", sc.Action))
+
+	err := s.executeSchedule(sc)
+	if err != nil {
+		zap.S().Errorw("failed to run server schedule", zap.String("server", s.Uuid), zap.String("schedule", key), zap.Error(err))
+	}
+
+	now := time.Now()
+
+	s.schedules.Lock()
+	status.Running = false
+	status.LastRunAt = &now
+	status.Successful = err == nil
+	status.LastError = ""
+	if err != nil {
+		status.LastError = err.Error()
+	}
+	s.schedules.Unlock()
+}
+
+// Performs the action defined by a schedule.
+func (s *Server) executeSchedule(sc Schedule) error {
+	switch sc.Action {
+	case ScheduleActionPower:
+		action := PowerAction{Action: sc.Payload}
+		if !action.IsValid() {
+			return errors.New("schedule contains an invalid power action: " + sc.Payload)
+		}
+
+		return s.RunPowerAction(action)
+	case ScheduleActionCommand:
+		if s.GetState() != ProcessRunningState {
+			return errors.New("cannot send a command to a server that is not running")
+		}
+
+		return s.Environment.SendCommand(sc.Payload)
+	case ScheduleActionBackup:
+		// The Panel has no record of backups created by a schedule, so these are kept
+		// locally and the Panel is not notified about them. Older scheduled backups are
+		// removed according to the retention rules for the server.
+		id := uuid.New().String()
+		err := s.RunOperation(OperationBackup, func() error {
+			_, err := s.NewBackup(id, nil).Backup()
+
+			return err
+		})
+		if err != nil {
+			return err
+		}
+
+		if err := s.recordScheduledBackup(id); err != nil {
+			return err
+		}
+
+		return s.PruneScheduledBackups()
+	default:
+		return errors.New("schedule contains an invalid action: " + sc.Action)
+	}
+}
@@ -7,6 +7,7 @@ import (
 	"github.com/pkg/errors"
 	"github.com/pterodactyl/wings/api"
 	"github.com/pterodactyl/wings/config"
+	"github.com/pterodactyl/wings/wake"
 	"github.com/remeh/sizedwaitgroup"
 	"go.uber.org/zap"
 	"os"
@@ -28,6 +29,22 @@ type Server struct {
 	// docker containers as well as in log output.
 	Uuid string `json:"uuid"`
 
+	// Details about the server on the Panel that are only used to describe it, such as in
+	// the labels applied to its containers.
+	Meta struct {
+		// The name and description of the server shown in the Panel.
+		Name        string `json:"name,omitempty"`
+		Description string `json:"description,omitempty"`
+		// The UUID of the egg the server was created from.
+		Egg string `json:"egg,omitempty"`
+		// The UUID of the user that owns the server.
+		Owner string `json:"owner,omitempty"`
+	} `json:"meta" yaml:"meta"`
+
+	// Tags used to group servers, such as "minecraft" or "premium", so that they can be
+	// listed and acted on together.
+	Tags []string `json:"tags" yaml:"tags"`
+
 	// Whether or not the server is in a suspended state. Suspended servers cannot
 	// be started or modified except in certain scenarios by an admin user.
 	Suspended bool `json:"suspended"`
@@ -42,20 +59,79 @@ type Server struct {
 	// server process.
 	EnvVars map[string]string `json:"environment" yaml:"environment"`
 
+	// The validation rules defined by the egg for each of the environment variables above,
+	// in the same format used by the Panel, such as "required|numeric|max:100".
+	VariableRules map[string]string `json:"variable_rules,omitempty" yaml:"variable_rules"`
+
+	// Paths within the server data directory that cannot be modified or deleted through
+	// the file API or SFTP. These use the same pattern syntax as the .pteroignore file.
+	ProtectedFiles []string `json:"protected_files" yaml:"protected_files"`
+
 	Archiver       Archiver       `json:"-" yaml:"-"`
 	CrashDetection CrashDetection `json:"crash_detection" yaml:"crash_detection"`
+	Hooks          Hooks          `json:"hooks" yaml:"hooks"`
+	Schedules      []Schedule     `json:"schedules" yaml:"schedules"`
+	Query          QuerySettings  `json:"query" yaml:"query"`
+	Rcon           RconSettings   `json:"rcon" yaml:"rcon"`
 	Build          BuildSettings  `json:"build"`
 	Allocations    Allocations    `json:"allocations"`
 	Environment    Environment    `json:"-" yaml:"-"`
 	Filesystem     Filesystem     `json:"-" yaml:"-"`
 	Resources      ResourceUsage  `json:"resources" yaml:"-"`
 
+	// The number of seconds the server can spend starting before it is killed. If 0, the
+	// startup timeout configured for the node is used.
+	StartupTimeout int `json:"startup_timeout" yaml:"startup_timeout"`
+
+	// Determines which backups created by schedules are kept.
+	BackupRetention BackupRetention `json:"backup_retention" yaml:"backup_retention"`
+
+	// The actions to take when the server process exits with specific codes.
+	ExitCodes []ExitCodeAction `json:"exit_codes" yaml:"exit_codes"`
+
+	// Commands that cannot be sent to the server process by users.
+	DeniedCommands DeniedCommands `json:"denied_commands" yaml:"denied_commands"`
+
+	// The key used to encrypt backups of the server, encoded as base64 or hex. If empty, the
+	// key configured for the node is used if backup encryption is enabled. This is only ever
+	// read from the configuration sent by the Panel, it is never returned by the API or
+	// written to the persisted configuration of the server.
+	BackupEncryptionKey string `json:"-" yaml:"-"`
+
+	// Controls stopping the server automatically once it has been idle for some time.
+	Idle IdleSettings `json:"idle" yaml:"idle"`
+
+	// Controls starting the server automatically when a player connects while it is offline.
+	WakeOnConnect WakeOnConnectSettings `json:"wake_on_connect" yaml:"wake_on_connect"`
+
+	// A command run periodically inside the environment to check that the server process
+	// is still responding.
+	Healthcheck HealthcheckSettings `json:"healthcheck" yaml:"healthcheck"`
+
+	// Options passed through to the Docker container of the server, which are only applied
+	// if the node allows them.
+	DockerOverrides DockerOverrides `json:"docker_overrides" yaml:"docker_overrides"`
+
 	Container struct {
 		// Defines the Docker image that will be used for this server
 		Image string `json:"image,omitempty"`
+		// The images defined by the egg that the server can be switched to, in addition
+		// to the image above.
+		AllowedImages []string `json:"allowed_images,omitempty" yaml:"allowed_images"`
+		// The image chosen from the allowed images to use instead of the default image. This
+		// is never sent by the Panel, so syncing the server does not undo the selection.
+		SelectedImage string `json:"selected_image,omitempty" yaml:"selected_image"`
+		// The platform that the images for the server are pulled for, such as "linux/amd64".
+		// When this is not set the platform of the node is used.
+		Platform string `json:"platform,omitempty" yaml:"platform"`
 		// If set to true, OOM killer will be disabled on the server's Docker container.
-		// If not present (nil) we will default to disabling it.
+		// If not present (nil) we will default to disabling it. This has no effect on hosts
+		// using cgroup v2, where the OOM killer cannot be disabled.
 		OomDisabled bool `default:"true" json:"oom_disabled" yaml:"oom_disabled"`
+		// If set to true, the server process is given a terminal, which interactive programs
+		// need to draw their interface correctly. Output is passed to the console unchanged,
+		// including any ANSI escape sequences.
+		Tty bool `default:"true" json:"tty" yaml:"tty"`
 	} `json:"container,omitempty"`
 
 	// Server cache used to store frequently requested information in memory and make
@@ -65,11 +141,59 @@ type Server struct {
 	// Events emitted by the server instance.
 	emitter *EventBus
 
+	// Tracks the status of the last run for each schedule defined on the server.
+	schedules scheduleTracker
+
+	// Set while the installation process for the server is running.
+	installing bool
+
+	// Set once the firewall rules for the allocations of the server have been added since
+	// the daemon started.
+	firewallApplied bool
+
+	// Set when the configuration of the server has been changed while it was running, and
+	// the changes will not fully apply until the server is started again.
+	rebuildRequired bool
+
+	// Tracks the uploads currently in progress for the server.
+	uploads transferLimiter
+
+	// Tracks the downloads currently in progress for the server.
+	downloads transferLimiter
+
+	// Runs power actions, installs, backups and transfers for the server one at a time.
+	operations operationQueue
+
+	// Closing this channel stops the query polling loop for the server.
+	queryPolling chan struct{}
+
+	// The health of the server process as last reported by its healthcheck, and the
+	// channel that stops the loop following it when closed.
+	health        string
+	healthPolling chan struct{}
+
+	// Closing this channel stops checking if the server is idle.
+	idleMonitor chan struct{}
+
+	// Listens on the port of the server while it is offline, see WakeOnConnectSettings.
+	wakeListener *wake.Listener
+
+	// Kills the server process if it is still starting once the startup timeout passes, and
+	// is set when that has happened until the server is next started.
+	startupTimer  *time.Timer
+	startupFailed bool
+
+	// Commands sent to the server once it is next running, see ExitActionCommand.
+	bootCommands []string
+
 	// Defines the process configuration for the server instance. This is dynamically
 	// fetched from the Pterodactyl Server instance each time the server process is
 	// started, and then cached here.
 	processConfiguration *api.ProcessConfiguration
 
+	// The compiled patterns of the denied commands, updated whenever they change.
+	deniedCommands []deniedPattern
+
 	// Internal mutex used to block actions that need to occur sequentially, such as
 	// writing the configuration to the disk.
 	sync.RWMutex
@@ -99,6 +223,11 @@ type BuildSettings struct {
 
 	// Sets which CPU threads can be used by the docker instance.
 	Threads string `json:"threads" yaml:"threads"`
+
+	// The maximum rate in megabits per second that the server can send and receive data
+	// at over the network. A value of 0 means there is no limit.
+	BandwidthEgress  int64 `json:"bandwidth_egress" yaml:"bandwidth_egress"`
+	BandwidthIngress int64 `json:"bandwidth_ingress" yaml:"bandwidth_ingress"`
 }
 
 // Converts the CPU limit for a server build into a number that can be better understood
@@ -152,13 +281,22 @@ func LoadDirectory() error {
 	// the road to help big instances scale better.
 	wg := sizedwaitgroup.New(10)
 
-	configs, rerr, err := api.NewRequester().GetAllServerConfigurations()
+	r := api.NewRequester()
+	configs, rerr, err := r.GetAllServerConfigurations()
 	if err != nil || rerr != nil {
+		// If the Panel could not be reached, or is having issues of its own, fall back to
+		// the configurations persisted the last time each server was updated. Any other
+		// error means the Panel rejected the request and should be reported.
+		if err == nil && r.HttpResponseCode() < 500 {
+			return errors.New(rerr.String())
+		}
+
+		zap.S().Warnw("failed to fetch server configurations from panel, using persisted configurations", zap.Error(err))
+
+		configs, err = loadPersistedConfigurations()
 		if err != nil {
 			return errors.WithStack(err)
 		}
-
-		return errors.New(rerr.String())
 	}
 
 	states, err := getServerStates()
@@ -210,12 +348,15 @@ func FromConfiguration(data *api.ServerConfigurationResponse) (*Server, error) {
 		return nil, err
 	}
 
+	if err := s.loadSelectedImage(); err != nil {
+		zap.S().Warnw("failed to load selected image for server", zap.String("server", s.Uuid), zap.Error(err))
+	}
+
 	s.AddEventListeners()
 
-	// Right now we only support a Docker based environment, so I'm going to hard code
-	// this logic in. When we're ready to support other environment we'll need to make
-	// some modifications here obviously.
-	if err := NewDockerEnvironment(s); err != nil {
+	// Create the environment using whichever driver has been configured for this node,
+	// this will be Docker unless an administrator has explicitly changed it.
+	if err := NewEnvironment(s); err != nil {
 		return nil, err
 	}
 
@@ -227,6 +368,7 @@ func FromConfiguration(data *api.ServerConfigurationResponse) (*Server, error) {
 		Configuration: &config.Get().System,
 		Server:        s,
 	}
+	s.Filesystem.usage = newUsageTracker(&s.Filesystem)
 	s.Resources = ResourceUsage{}
 
 	// Forces the configuration to be synced with the panel.
@@ -241,15 +383,13 @@ func FromConfiguration(data *api.ServerConfigurationResponse) (*Server, error) {
 // Returns all of the environment variables that should be assigned to a running
 // server instance.
 func (s *Server) GetEnvironmentVariables() []string {
-	zone, _ := time.Now().In(time.Local).Zone()
-
-	var out = []string{
-		fmt.Sprintf("TZ=%s", zone),
+	var out = append(localeVariables(),
 		fmt.Sprintf("STARTUP=%s", s.Invocation),
 		fmt.Sprintf("SERVER_MEMORY=%d", s.Build.MemoryLimit),
 		fmt.Sprintf("SERVER_IP=%s", s.Allocations.DefaultMapping.Ip),
 		fmt.Sprintf("SERVER_PORT=%d", s.Allocations.DefaultMapping.Port),
-	}
+		fmt.Sprintf("SERVER_ADDRESS=%s", s.Allocations.DefaultAddress()),
+	)
 
 eloop:
 	for k, v := range s.EnvVars {
@@ -265,6 +405,24 @@ eloop:
 	return out
 }
 
+// Returns the startup command for the server with all of the {{VARIABLE}} placeholders
+// replaced using the environment variables assigned to it. Docker images handle this in
+// their entrypoint, but environments without one need to do it themselves.
+func (s *Server) RenderedInvocation() string {
+	invocation := s.Invocation
+
+	for _, e := range s.GetEnvironmentVariables() {
+		parts := strings.SplitN(e, "=", 2)
+		if len(parts) != 2 || parts[0] == "STARTUP" {
+			continue
+		}
+
+		invocation = strings.Replace(invocation, "{{"+parts[0]+"}}", parts[1], -1)
+	}
+
+	return invocation
+}
+
 // Syncs the state of the server on the Panel with Wings. This ensures that we're always
 // using the state of the server from the Panel and allows us to not require successful
 // API calls to Wings to do things.
@@ -289,12 +447,17 @@ func (s *Server) Sync() error {
 }
 
 func (s *Server) SyncWithConfiguration(cfg *api.ServerConfigurationResponse) error {
+	// The process configuration is set first so that it is included when the updated
+	// configuration is persisted to the disk.
+	s.Lock()
+	s.processConfiguration = cfg.ProcessConfiguration
+	s.Unlock()
+
 	// Update the data structure and persist it to the disk.
 	if err := s.UpdateDataStructure(cfg.Settings, false); err != nil {
 		return errors.WithStack(err)
 	}
 
-	s.processConfiguration = cfg.ProcessConfiguration
 	return nil
 }
 
@@ -325,6 +488,16 @@ func (s *Server) GetProcessConfiguration() (*api.ServerConfigurationResponse, *a
 // Helper function that can receieve a power action and then process the
 // actions that need to occur for it.
 func (s *Server) HandlePowerAction(action PowerAction) error {
+	if action.Action == "start" || action.Action == "restart" {
+		if err := CheckMaintenanceMode(); err != nil {
+			return err
+		}
+
+		if t := GetTransfer(s.Uuid); t != nil && t.HoldsServer() {
+			return errors.New("cannot start a server while it is being synced to another node")
+		}
+	}
+
 	switch action.Action {
 	case "start":
 		return s.Environment.Start()
@@ -0,0 +1,84 @@
+package server
+
+import (
+	"fmt"
+	"github.com/pterodactyl/wings/config"
+	"go.uber.org/zap"
+	"os"
+	"time"
+)
+
+// Returns the number of seconds the server can spend starting, or 0 if there is no limit.
+func (s *Server) startupTimeout() int {
+	if s.StartupTimeout > 0 {
+		return s.StartupTimeout
+	}
+
+	return config.Get().System.StartupTimeout
+}
+
+// Determines if the server was killed the last time it was started because it did not finish
+// starting within the startup timeout.
+func (s *Server) StartupFailed() bool {
+	s.RLock()
+	defer s.RUnlock()
+
+	return s.startupFailed
+}
+
+// Starts the timer that kills the server process if it does not finish starting in time.
+func (s *Server) startStartupTimer() {
+	timeout := s.startupTimeout()
+	if timeout <= 0 {
+		return
+	}
+
+	s.Lock()
+	defer s.Unlock()
+
+	s.startupFailed = false
+	if s.startupTimer != nil {
+		s.startupTimer.Stop()
+	}
+
+	s.startupTimer = time.AfterFunc(time.Duration(timeout)*time.Second, func() {
+		s.handleStartupTimeout(timeout)
+	})
+}
+
+// Stops the startup timer, this is called once the server leaves the starting state.
+func (s *Server) stopStartupTimer() {
+	s.Lock()
+	defer s.Unlock()
+
+	if s.startupTimer != nil {
+		s.startupTimer.Stop()
+		s.startupTimer = nil
+	}
+}
+
+// Kills a server process that has been starting for longer than the startup timeout. The
+// server is moved into the stopping state first so that the process exiting is not treated
+// as a crash, which would only start it again.
+func (s *Server) handleStartupTimeout(timeout int) {
+	if s.GetState() != ProcessStartingState {
+		return
+	}
+
+	zap.S().Warnw("server did not finish starting within the startup timeout; killing process", zap.String("server", s.Uuid), zap.Int("timeout", timeout))
+
+	s.PublishConsoleOutputFromDaemon(fmt.Sprintf("Server did not finish starting within %d seconds and is being killed.", timeout))
+	PublishNodeEvent(StartupTimeoutEvent, s.Uuid, map[string]interface{}{
+		"timeout": timeout,
+	})
+
+	s.Lock()
+	s.startupFailed = true
+	s.Unlock()
+
+	s.SetState(ProcessStoppingState)
+
+	if err := s.Environment.Terminate(os.Kill); err != nil {
+		zap.S().Errorw("failed to kill server process after startup timeout", zap.String("server", s.Uuid), zap.Error(err))
+	}
+}
@@ -82,9 +82,15 @@ func (s *Server) SetState(state string) error {
 	s.Lock()
 	s.State = state
 
+	// Starting the server rebuilds its environment, so any pending changes are applied.
+	if state == ProcessStartingState {
+		s.rebuildRequired = false
+	}
+
 	// Emit the event to any listeners that are currently registered.
 	zap.S().Debugw("saw server status change event", zap.String("server", s.Uuid), zap.String("status", s.State))
 	s.Events().Publish(StatusEvent, s.State)
+	PublishNodeEvent(StatusEvent, s.Uuid, s.State)
 
 	// Release the lock as it is no longer needed for the following actions.
 	s.Unlock()
@@ -117,7 +123,7 @@ func (s *Server) SetState(state string) error {
 		go func(server *Server) {
 			if err := server.handleServerCrash(); err != nil {
 				if IsTooFrequentCrashError(err) {
-					zap.S().Infow("did not restart server after crash; occurred too soon after last", zap.String("server", server.Uuid))
+					zap.S().Infow("did not restart server after crash; restart attempts exhausted", zap.String("server", server.Uuid))
 				} else {
 					zap.S().Errorw("failed to handle server crash state", zap.String("server", server.Uuid), zap.Error(err))
 				}
@@ -125,6 +131,50 @@ func (s *Server) SetState(state string) error {
 		}(s)
 	}
 
+	// Only query the server process for status information, and check if it is idle, while
+	// it is actually running.
+	if state == ProcessRunningState && prevState != ProcessRunningState {
+		s.enableQueryPolling()
+		s.enableIdleMonitor()
+
+		go s.sendBootCommands()
+	} else if state == ProcessOfflineState {
+		s.disableQueryPolling()
+		s.disableIdleMonitor()
+	}
+
+	// The port of the server must be free before the process is started, so the wake
+	// listener is closed as soon as the server begins starting.
+	if state == ProcessOfflineState {
+		s.enableWakeOnConnect()
+	} else {
+		s.DisableWakeOnConnect()
+	}
+
+	if state == ProcessStartingState && prevState == ProcessOfflineState {
+		s.startStartupTimer()
+	} else if state != ProcessStartingState {
+		s.stopStartupTimer()
+	}
+
+	// The healthcheck starts running as soon as the container does, and can be what marks
+	// the server as running, so it is followed from the moment the server starts.
+	if state == ProcessStartingState && prevState == ProcessOfflineState {
+		s.enableHealthPolling()
+	} else if state == ProcessOfflineState {
+		s.disableHealthPolling()
+	}
+
+	// A server that was stopped through the daemon moves from the stopping state to the
+	// offline state, run any post-stop hooks for it in the background.
+	if prevState == ProcessStoppingState && s.GetState() == ProcessOfflineState {
+		go func(server *Server) {
+			if err := server.RunHooks(PostStopHook); err != nil {
+				zap.S().Warnw("failed to run post-stop hooks for server", zap.String("server", server.Uuid), zap.Error(err))
+			}
+		}(s)
+	}
+
 	return nil
 }
 
@@ -141,4 +191,27 @@ func (s *Server) GetState() string {
 // not the response from Docker.
 func (s *Server) IsRunning() bool {
 	return s.GetState() == ProcessRunningState || s.GetState() == ProcessStartingState
-}
\ No newline at end of file
+}
+
+// Determines if the installation process for the server is currently running.
+func (s *Server) IsInstalling() bool {
+	s.RLock()
+	defer s.RUnlock()
+
+	return s.installing
+}
+
+func (s *Server) setInstalling(v bool) {
+	s.Lock()
+	s.installing = v
+	s.Unlock()
+}
+
+// Determines if the server configuration has changed since the server was last started,
+// meaning the server must be restarted for all of the changes to apply.
+func (s *Server) RequiresRebuild() bool {
+	s.RLock()
+	defer s.RUnlock()
+
+	return s.rebuildRequired
+}
@@ -0,0 +1,106 @@
+package server
+
+import (
+	"github.com/pterodactyl/wings/store"
+	"go.uber.org/zap"
+	"sync"
+	"time"
+)
+
+// How often the resource usage of each running server is saved to its history, and the
+// number of samples that are kept for each server, which covers the last day.
+const (
+	statsHistoryInterval = time.Minute * 5
+	statsHistorySize     = 288
+)
+
+var statsHistory = store.NewRepository(store.StatsHistory)
+
+// Guards reading and writing the history of every server, since all of the samples of a
+// server are stored together.
+var statsHistoryMu sync.Mutex
+
+// The resource usage of a server at a point in time.
+type StatsSample struct {
+	Time        time.Time `json:"time"`
+	Memory      uint64    `json:"memory_bytes"`
+	MemoryLimit uint64    `json:"memory_limit_bytes"`
+	CpuAbsolute float64   `json:"cpu_absolute"`
+	Disk        int64     `json:"disk_bytes"`
+	RxBytes     uint64    `json:"rx_bytes"`
+	TxBytes     uint64    `json:"tx_bytes"`
+}
+
+// Returns the saved resource usage of the server, oldest first. Samples are only taken
+// while the server is running, so there are gaps for the times that it was offline.
+func (s *Server) StatsHistory() ([]StatsSample, error) {
+	statsHistoryMu.Lock()
+	defer statsHistoryMu.Unlock()
+
+	return s.loadStatsHistory()
+}
+
+func (s *Server) loadStatsHistory() ([]StatsSample, error) {
+	samples := make([]StatsSample, 0)
+	if _, err := statsHistory.Get(s.Uuid, &samples); err != nil {
+		return nil, err
+	}
+
+	return samples, nil
+}
+
+// Adds the current resource usage of the server to its history, dropping the oldest
+// samples once the history is full.
+func (s *Server) recordStatsSample() error {
+	statsHistoryMu.Lock()
+	defer statsHistoryMu.Unlock()
+
+	samples, err := s.loadStatsHistory()
+	if err != nil {
+		return err
+	}
+
+	usage := s.GetResources()
+	samples = append(samples, StatsSample{
+		Time:        time.Now().UTC(),
+		Memory:      usage.Memory,
+		MemoryLimit: usage.MemoryLimit,
+		CpuAbsolute: usage.CpuAbsolute,
+		Disk:        usage.Disk,
+		RxBytes:     usage.Network.RxBytes,
+		TxBytes:     usage.Network.TxBytes,
+	})
+
+	if len(samples) > statsHistorySize {
+		samples = samples[len(samples)-statsHistorySize:]
+	}
+
+	return statsHistory.Put(s.Uuid, samples)
+}
+
+// Removes the saved resource usage of the server, this should be called when the server
+// is deleted from the node.
+func (s *Server) RemoveStatsHistory() error {
+	statsHistoryMu.Lock()
+	defer statsHistoryMu.Unlock()
+
+	return statsHistory.Delete(s.Uuid)
+}
+
+// Saves the resource usage of every server that is not offline to its history in the
+// background, so that it survives the daemon being restarted.
+func StartStatsHistory() {
+	go func() {
+		for range time.Tick(statsHistoryInterval) {
+			for _, s := range GetServers().All() {
+				if s.GetState() == ProcessOfflineState {
+					continue
+				}
+
+				if err := s.recordStatsSample(); err != nil {
+					zap.S().Warnw("failed to save resource usage of server", zap.String("server", s.Uuid), zap.Error(err))
+				}
+			}
+		}
+	}()
+}
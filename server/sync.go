@@ -0,0 +1,88 @@
+package server
+
+import (
+	"github.com/pkg/errors"
+	"github.com/pterodactyl/wings/api"
+	"github.com/pterodactyl/wings/config"
+	"go.uber.org/zap"
+	"time"
+)
+
+// Fetches the latest configuration for the server from the Panel and applies it. Limits
+// are applied to the running server where the environment supports it, anything else
+// that changed while the server is running marks it as requiring a rebuild.
+func (s *Server) Reconcile() error {
+	if err := s.Sync(); err != nil {
+		return err
+	}
+
+	return s.applyToEnvironment()
+}
+
+// Applies a configuration that has already been fetched from the Panel to the server.
+func (s *Server) reconcileWith(cfg *api.ServerConfigurationResponse) error {
+	if err := s.SyncWithConfiguration(cfg); err != nil {
+		return err
+	}
+
+	return s.applyToEnvironment()
+}
+
+// Updates the running environment using the current build settings for the server.
+func (s *Server) applyToEnvironment() error {
+	if s.GetState() == ProcessOfflineState {
+		return nil
+	}
+
+	return errors.WithStack(s.Environment.InSituUpdate())
+}
+
+// Periodically fetches the configuration of every server on the node from the Panel and
+// applies any changes, so that changes made in the Panel do not wait for the server to
+// be restarted. This does nothing unless a sync interval has been configured.
+func StartSyncLoop() {
+	seconds := config.Get().System.Sync.Interval
+	if seconds <= 0 {
+		return
+	}
+
+	interval := time.Second * time.Duration(seconds)
+
+	go func() {
+		for {
+			time.Sleep(jitter(interval))
+
+			if err := syncAllServers(); err != nil {
+				zap.S().Warnw("failed to sync server configurations with panel", zap.Error(err))
+			}
+		}
+	}()
+}
+
+// Fetches the configuration for all of the servers in a single request and applies them.
+// Servers that exist on the Panel but not on this node are ignored, they are created when
+// the Panel requests it.
+func syncAllServers() error {
+	configs, rerr, err := api.NewRequester().GetAllServerConfigurations()
+	if err != nil || rerr != nil {
+		if err != nil {
+			return errors.WithStack(err)
+		}
+
+		return errors.New(rerr.String())
+	}
+
+	for _, s := range GetServers().All() {
+		cfg, ok := configs[s.Uuid]
+		if !ok {
+			zap.S().Warnw("server exists on this node but was not returned by the panel", zap.String("server", s.Uuid))
+			continue
+		}
+
+		if err := s.reconcileWith(cfg); err != nil {
+			zap.S().Warnw("failed to apply configuration from panel to server", zap.String("server", s.Uuid), zap.Error(err))
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,93 @@
+package server
+
+import (
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Tags can only contain lowercase letters, numbers, dashes, underscores and periods, so
+// that they can be used in container labels and query strings without being escaped.
+var tagRegex = regexp.MustCompile(`^[a-z0-9][a-z0-9_.-]{0,62}$`)
+
+// Returns the tags provided in lowercase, sorted and without duplicates, along with any
+// that are not valid tags.
+func cleanTags(tags []string) ([]string, []string) {
+	seen := make(map[string]bool, len(tags))
+
+	var valid, invalid []string
+	for _, t := range tags {
+		t = strings.ToLower(strings.TrimSpace(t))
+		if seen[t] {
+			continue
+		}
+		seen[t] = true
+
+		if !tagRegex.MatchString(t) {
+			invalid = append(invalid, t)
+			continue
+		}
+
+		valid = append(valid, t)
+	}
+
+	sort.Strings(valid)
+
+	return valid, invalid
+}
+
+// Returned when tags being set for a server are not valid.
+type invalidTags struct {
+	tags []string
+}
+
+func (e *invalidTags) Error() string {
+	return "the following tags are not valid: " + strings.Join(e.tags, ", ")
+}
+
+func IsInvalidTagsError(err error) bool {
+	_, ok := errors.Cause(err).(*invalidTags)
+
+	return ok
+}
+
+// Replaces the tags of the server. Tags are used to group servers so that they can be
+// listed and acted on together, and are included in the labels of the server container.
+func (s *Server) SetTags(tags []string) error {
+	valid, invalid := cleanTags(tags)
+	if len(invalid) > 0 {
+		return errors.WithStack(&invalidTags{tags: invalid})
+	}
+
+	s.Lock()
+	s.Tags = valid
+	s.Unlock()
+
+	if err := s.persistConfiguration(); err != nil {
+		zap.S().Warnw("failed to persist server configuration to disk", zap.String("server", s.Uuid), zap.Error(err))
+	}
+
+	return nil
+}
+
+// Determines if the server has every one of the given tags.
+func (s *Server) HasTags(tags []string) bool {
+	s.RLock()
+	defer s.RUnlock()
+
+outer:
+	for _, t := range tags {
+		t = strings.ToLower(strings.TrimSpace(t))
+		for _, v := range s.Tags {
+			if v == t {
+				continue outer
+			}
+		}
+
+		return false
+	}
+
+	return true
+}
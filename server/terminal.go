@@ -0,0 +1,43 @@
+package server
+
+import (
+	"regexp"
+	"strings"
+)
+
+// The largest terminal size that can be requested, in either direction.
+const maxTerminalSize = 1000
+
+// Implemented by environments that give the server process a terminal that can be resized.
+type terminalResizer interface {
+	ResizeTerminal(width uint, height uint) error
+}
+
+// Changes the size of the terminal for the server process, in columns and rows, so that
+// interactive programs draw correctly in the console. This does nothing if the environment
+// does not give the server a terminal.
+func (s *Server) ResizeTerminal(width uint, height uint) error {
+	tr, ok := s.Environment.(terminalResizer)
+	if !ok {
+		return nil
+	}
+
+	if width == 0 || height == 0 || width > maxTerminalSize || height > maxTerminalSize {
+		return &terminalSizeInvalid{}
+	}
+
+	return tr.ResizeTerminal(width, height)
+}
+
+// Matches ANSI escape sequences, such as those used to change the color of text or to move
+// the cursor.
+var ansiRegex = regexp.MustCompile(`\x1b(\[[0-9;?]*[ -/]*[@-~]|\][^\x07\x1b]*(\x07|\x1b\\)|[@-Z\\-_])`)
+
+// Removes ANSI escape sequences and carriage returns from a line of output.
+func stripAnsi(s string) string {
+	if strings.IndexByte(s, '\x1b') >= 0 {
+		s = ansiRegex.ReplaceAllString(s, "")
+	}
+
+	return strings.TrimRight(s, "\r")
+}
@@ -0,0 +1,95 @@
+package server
+
+import (
+	"github.com/pterodactyl/wings/config"
+	"go.uber.org/zap"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// The directory on the host containing the timezone database.
+const zoneinfoDirectory = "/usr/share/zoneinfo"
+
+var (
+	detectTimezone sync.Once
+	hostTimezone   string
+)
+
+// Returns the timezone that server processes run in. This is the timezone configured for
+// the node if it is valid, otherwise it is the timezone of the host.
+func Timezone() string {
+	if tz := config.Get().System.Timezone; tz != "" {
+		_, err := time.LoadLocation(tz)
+		if err == nil {
+			return tz
+		}
+
+		zap.S().Warnw("the configured timezone is not valid, using the timezone of the host", zap.String("timezone", tz), zap.Error(err))
+	}
+
+	detectTimezone.Do(func() {
+		hostTimezone = lookupHostTimezone()
+	})
+
+	return hostTimezone
+}
+
+// Determines the name of the timezone the host is using. The TZ variable of the daemon is
+// checked first, then the file naming the timezone, and then the zone /etc/localtime links
+// to. The abbreviation of a zone, such as "CET", is not used since it is not understood by
+// most software as a timezone.
+func lookupHostTimezone() string {
+	if tz := strings.TrimPrefix(os.Getenv("TZ"), ":"); tz != "" && !filepath.IsAbs(tz) {
+		return tz
+	}
+
+	if b, err := ioutil.ReadFile(config.Get().Docker.TimezonePath); err == nil {
+		if tz := strings.TrimSpace(string(b)); tz != "" {
+			return tz
+		}
+	}
+
+	if p, err := filepath.EvalSymlinks("/etc/localtime"); err == nil {
+		if i := strings.Index(p, "zoneinfo/"); i >= 0 {
+			return p[i+len("zoneinfo/"):]
+		}
+	}
+
+	return "UTC"
+}
+
+// Returns the path on the host of the timezone data for the timezone servers run in, which
+// is mounted into containers. An empty string is returned if the data does not exist.
+func timezoneDataPath() string {
+	tz := Timezone()
+
+	paths := []string{filepath.Join(zoneinfoDirectory, filepath.Clean("/"+tz))}
+
+	// Hosts without a timezone database still have the data for their own timezone, which
+	// can be used when servers run in the timezone of the host.
+	if tz == hostTimezone {
+		paths = append(paths, "/etc/localtime")
+	}
+
+	for _, p := range paths {
+		if st, err := os.Stat(p); err == nil && st.Mode().IsRegular() {
+			return p
+		}
+	}
+
+	return ""
+}
+
+// Returns the environment variables that set the timezone and locale of a server process.
+func localeVariables() []string {
+	out := []string{"TZ=" + Timezone()}
+	if l := config.Get().System.Locale; l != "" {
+		out = append(out, "LANG="+l, "LC_ALL="+l)
+	}
+
+	return out
+}
@@ -0,0 +1,319 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"go.uber.org/zap"
+	"io"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// The phases that a server transfer moves through. The node sending the server archives
+// it and then sends it, while the node receiving the server downloads the archive, checks
+// it, and then extracts it. When the server is synced instead, the receiving node copies
+// the files that changed over a number of passes, and the server is stopped for the final
+// pass on both nodes.
+const (
+	TransferPhaseArchiving  = "archiving"
+	TransferPhaseArchived   = "archived"
+	TransferPhaseSending    = "sending"
+	TransferPhaseReceiving  = "receiving"
+	TransferPhaseVerifying  = "verifying"
+	TransferPhaseExtracting = "extracting"
+	TransferPhaseSyncing    = "syncing"
+	TransferPhaseFinalSync  = "final sync"
+	TransferPhaseCompleted  = "completed"
+	TransferPhaseFailed     = "failed"
+	TransferPhaseCancelled  = "cancelled"
+)
+
+// Progress events are sent at most this often while data is being moved, so that a fast
+// transfer does not flood the websocket.
+const transferProgressInterval = time.Second
+
+type transferInProgress struct {
+}
+
+func (e *transferInProgress) Error() string {
+	return "a transfer is already in progress for this server"
+}
+
+func IsTransferInProgressError(err error) bool {
+	_, ok := err.(*transferInProgress)
+
+	return ok
+}
+
+// The progress of a server transfer on this node.
+type TransferProgress struct {
+	Phase string `json:"phase"`
+
+	// The number of bytes written to the archive, sent to the other node, and received from
+	// the other node. Only the values for the side of the transfer this node is on are set.
+	Archived int64 `json:"archived"`
+	Sent     int64 `json:"sent"`
+	Received int64 `json:"received"`
+
+	// The size of the archive being sent or received, if known.
+	Total int64 `json:"total"`
+
+	StartedAt time.Time `json:"started_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+
+	// The reason the transfer failed, if it did.
+	Error string `json:"error,omitempty"`
+}
+
+// A server transfer that is being sent or received by this node. The transfer is kept
+// once it has finished so that its outcome can still be read, until another transfer for
+// the same server is started.
+type Transfer struct {
+	Server string
+
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	archived int64
+	sent     int64
+	received int64
+
+	mu        sync.Mutex
+	phase     string
+	total     int64
+	started   time.Time
+	updated   time.Time
+	published time.Time
+	err       string
+}
+
+var (
+	transfersMu sync.Mutex
+	transfers   = make(map[string]*Transfer)
+)
+
+// Starts tracking a transfer for a server, returning an error if one is already running.
+func NewTransfer(uuid string, phase string) (*Transfer, error) {
+	transfersMu.Lock()
+	defer transfersMu.Unlock()
+
+	if t, ok := transfers[uuid]; ok && !t.Finished() {
+		return nil, &transferInProgress{}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t := &Transfer{
+		Server:  uuid,
+		ctx:     ctx,
+		cancel:  cancel,
+		phase:   phase,
+		started: time.Now(),
+		updated: time.Now(),
+	}
+
+	transfers[uuid] = t
+	t.publish()
+
+	return t, nil
+}
+
+// Returns the transfer being sent or received for a server, or the last one if it has
+// finished. Nil is returned if there has not been a transfer since the daemon started.
+func GetTransfer(uuid string) *Transfer {
+	transfersMu.Lock()
+	defer transfersMu.Unlock()
+
+	return transfers[uuid]
+}
+
+// Forgets the transfer for a server, cancelling it if it is still running.
+func RemoveTransfer(uuid string) {
+	transfersMu.Lock()
+	t, ok := transfers[uuid]
+	delete(transfers, uuid)
+	transfersMu.Unlock()
+
+	if ok {
+		t.Cancel()
+	}
+}
+
+// Returns a context that is cancelled when the transfer is cancelled.
+func (t *Transfer) Context() context.Context {
+	return t.ctx
+}
+
+// Cancels the transfer. Whatever is being done for the transfer stops as soon as it next
+// checks the context, and is responsible for cleaning up after itself.
+func (t *Transfer) Cancel() {
+	t.cancel()
+}
+
+// Determines if the transfer has completed, failed or been cancelled.
+func (t *Transfer) Finished() bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	return t.finished()
+}
+
+func (t *Transfer) finished() bool {
+	return t.phase == TransferPhaseCompleted || t.phase == TransferPhaseFailed || t.phase == TransferPhaseCancelled
+}
+
+// Determines if the server must be kept stopped because its final sync to another node is
+// running, since any changes made to its files now would not be copied.
+func (t *Transfer) HoldsServer() bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	return t.phase == TransferPhaseFinalSync
+}
+
+// Moves the transfer on to the next phase.
+func (t *Transfer) SetPhase(phase string) {
+	t.mu.Lock()
+	if !t.finished() {
+		t.phase = phase
+		t.updated = time.Now()
+	}
+	t.mu.Unlock()
+
+	t.publish()
+}
+
+// Sets the size of the archive being sent or received.
+func (t *Transfer) SetTotal(total int64) {
+	t.mu.Lock()
+	t.total = total
+	t.mu.Unlock()
+}
+
+// Marks the transfer as having finished, which is reported as it being cancelled if its
+// context was cancelled, regardless of the error.
+func (t *Transfer) Finish(err error) {
+	t.mu.Lock()
+	if !t.finished() {
+		switch {
+		case t.ctx.Err() != nil:
+			t.phase = TransferPhaseCancelled
+		case err != nil:
+			t.phase = TransferPhaseFailed
+			t.err = err.Error()
+		default:
+			t.phase = TransferPhaseCompleted
+		}
+
+		t.updated = time.Now()
+	}
+	t.mu.Unlock()
+
+	t.publish()
+	t.cancel()
+}
+
+// Returns the current progress of the transfer.
+func (t *Transfer) Progress() TransferProgress {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	return TransferProgress{
+		Phase:     t.phase,
+		Archived:  atomic.LoadInt64(&t.archived),
+		Sent:      atomic.LoadInt64(&t.sent),
+		Received:  atomic.LoadInt64(&t.received),
+		Total:     t.total,
+		StartedAt: t.started,
+		UpdatedAt: t.updated,
+		Error:     t.err,
+	}
+}
+
+// Returns a writer that counts the bytes written to the archive of the server.
+func (t *Transfer) ArchiveWriter(w io.Writer) io.Writer {
+	return &transferWriter{t: t, w: w, n: &t.archived}
+}
+
+// Returns a writer that counts the bytes sent to the other node.
+func (t *Transfer) SendWriter(w io.Writer) io.Writer {
+	return &transferWriter{t: t, w: w, n: &t.sent}
+}
+
+// Returns a reader that counts the bytes received from the other node.
+func (t *Transfer) ReceiveReader(r io.Reader) io.Reader {
+	return &transferReader{t: t, r: r}
+}
+
+// Sends the progress of the transfer to the websocket of the server, if it exists on this
+// node, and to the node event bus.
+func (t *Transfer) publish() {
+	t.mu.Lock()
+	t.published = time.Now()
+	t.mu.Unlock()
+
+	p := t.Progress()
+	PublishNodeEvent(TransferProgressEvent, t.Server, p)
+
+	s := GetServers().Find(func(s *Server) bool {
+		return s.Uuid == t.Server
+	})
+	if s == nil {
+		return
+	}
+
+	b, err := json.Marshal(p)
+	if err != nil {
+		zap.S().Warnw("failed to encode server transfer progress", zap.String("server", t.Server), zap.Error(err))
+		return
+	}
+
+	s.Events().Publish(TransferProgressEvent, string(b))
+}
+
+// Publishes the progress of the transfer if it has not been published recently.
+func (t *Transfer) progressed() {
+	t.mu.Lock()
+	t.updated = time.Now()
+	due := t.updated.Sub(t.published) >= transferProgressInterval
+	t.mu.Unlock()
+
+	if due {
+		t.publish()
+	}
+}
+
+type transferWriter struct {
+	t *Transfer
+	w io.Writer
+	n *int64
+}
+
+func (tw *transferWriter) Write(p []byte) (int, error) {
+	if err := tw.t.ctx.Err(); err != nil {
+		return 0, err
+	}
+
+	n, err := tw.w.Write(p)
+	atomic.AddInt64(tw.n, int64(n))
+	tw.t.progressed()
+
+	return n, err
+}
+
+type transferReader struct {
+	t *Transfer
+	r io.Reader
+}
+
+func (tr *transferReader) Read(p []byte) (int, error) {
+	if err := tr.t.ctx.Err(); err != nil {
+		return 0, err
+	}
+
+	n, err := tr.r.Read(p)
+	atomic.AddInt64(&tr.t.received, int64(n))
+	tr.t.progressed()
+
+	return n, err
+}
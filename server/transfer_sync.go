@@ -0,0 +1,330 @@
+package server
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"github.com/pkg/errors"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// The types of entries in the manifest of a server being synced to another node.
+const (
+	SyncEntryFile      = "file"
+	SyncEntryDirectory = "directory"
+	SyncEntrySymlink   = "symlink"
+)
+
+// A file, directory or symlink within the data directory of a server being synced to
+// another node. Files are compared using their size and modification time, so only files
+// that have changed since the last pass are copied again. When the manifest includes the
+// SHA-256 checksum of every file they are compared using it instead, which catches changes
+// that do not affect the size or the modification time, such as those made within the same
+// second as the last pass.
+type SyncEntry struct {
+	Path     string      `json:"path"`
+	Type     string      `json:"type"`
+	Size     int64       `json:"size"`
+	Mode     os.FileMode `json:"mode"`
+	ModTime  int64       `json:"mod_time"`
+	Target   string      `json:"target,omitempty"`
+	Checksum string      `json:"checksum,omitempty"`
+}
+
+// The changes made to the data directory of a server by a single sync pass.
+type SyncResult struct {
+	Files   int   `json:"files"`
+	Bytes   int64 `json:"bytes"`
+	Removed int   `json:"removed"`
+}
+
+// Copies the contents of a file in the manifest of the server being synced into the
+// writer, returning an error if the file could not be copied in full.
+type SyncFetchFunc func(ctx context.Context, e SyncEntry, w io.Writer) error
+
+// Returns the manifest of every file, directory and symlink within the data directory of
+// the server, which the node the server is being synced to compares against its own copy.
+// If checksums is true the checksum of every file is included, which requires reading all
+// of them, so this is only done for the final pass once the server has been stopped.
+func (fs *Filesystem) SyncManifest(ctx context.Context, checksums bool) ([]SyncEntry, error) {
+	root := fs.Path()
+
+	var entries []SyncEntry
+	err := filepath.Walk(root, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			// Files removed while the walk is running are picked up by the next pass.
+			if os.IsNotExist(err) {
+				return nil
+			}
+
+			return err
+		}
+
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		if p == root {
+			return nil
+		}
+
+		rel, err := filepath.Rel(root, p)
+		if err != nil {
+			return err
+		}
+
+		e := SyncEntry{
+			Path:    filepath.ToSlash(rel),
+			Mode:    info.Mode().Perm(),
+			ModTime: info.ModTime().Unix(),
+		}
+
+		switch {
+		case info.IsDir():
+			e.Type = SyncEntryDirectory
+		case info.Mode()&os.ModeSymlink != 0:
+			target, err := os.Readlink(p)
+			if err != nil {
+				return err
+			}
+
+			e.Type = SyncEntrySymlink
+			e.Target = target
+		case info.Mode().IsRegular():
+			e.Type = SyncEntryFile
+			e.Size = info.Size()
+
+			if checksums {
+				sum, err := fileChecksum(p)
+				if err != nil {
+					if os.IsNotExist(errors.Cause(err)) {
+						return nil
+					}
+
+					return err
+				}
+
+				e.Checksum = sum
+			}
+		default:
+			// Sockets, devices and pipes cannot be copied to another node.
+			return nil
+		}
+
+		entries = append(entries, e)
+
+		return nil
+	})
+
+	return entries, errors.WithStack(err)
+}
+
+// Makes the data directory of the server match the manifest of the server on the node it
+// is being synced from. Files that are missing or have changed are copied using the fetch
+// function, and anything that is not in the manifest is removed.
+func (fs *Filesystem) ApplySync(ctx context.Context, entries []SyncEntry, fetch SyncFetchFunc) (*SyncResult, error) {
+	root := fs.Path()
+	if err := os.MkdirAll(root, 0700); err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	r := &SyncResult{}
+	wanted := make(map[string]bool, len(entries))
+
+	// The permissions of directories are only set once everything has been copied into
+	// them, otherwise a directory that is not writable could not be filled.
+	var dirs []SyncEntry
+
+	for _, e := range entries {
+		if err := ctx.Err(); err != nil {
+			return r, err
+		}
+
+		cleaned, err := fs.SafeLinkPath(e.Path)
+		if err != nil {
+			return r, err
+		}
+
+		wanted[cleaned] = true
+
+		switch e.Type {
+		case SyncEntryDirectory:
+			if st, err := os.Lstat(cleaned); err == nil && !st.IsDir() {
+				if err := os.Remove(cleaned); err != nil {
+					return r, errors.WithStack(err)
+				}
+			}
+
+			if err := os.MkdirAll(cleaned, 0755); err != nil {
+				return r, errors.WithStack(err)
+			}
+
+			dirs = append(dirs, e)
+		case SyncEntrySymlink:
+			if err := fs.syncSymlink(cleaned, e); err != nil {
+				return r, err
+			}
+		case SyncEntryFile:
+			if fs.syncFileUnchanged(cleaned, e) {
+				continue
+			}
+
+			if err := fs.syncFile(ctx, cleaned, e, fetch); err != nil {
+				return r, err
+			}
+
+			r.Files++
+			r.Bytes += e.Size
+		}
+	}
+
+	// Remove anything that no longer exists on the node the server is being synced from.
+	var extra []string
+	err := filepath.Walk(root, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if p == root || wanted[p] {
+			return nil
+		}
+
+		extra = append(extra, p)
+		if info.IsDir() {
+			return filepath.SkipDir
+		}
+
+		return nil
+	})
+	if err != nil {
+		return r, errors.WithStack(err)
+	}
+
+	for _, p := range extra {
+		if err := os.RemoveAll(p); err != nil {
+			return r, errors.WithStack(err)
+		}
+
+		r.Removed++
+	}
+
+	for i := len(dirs) - 1; i >= 0; i-- {
+		p := filepath.Join(root, filepath.FromSlash(dirs[i].Path))
+
+		os.Chmod(p, dirs[i].Mode)
+		os.Lchown(p, fs.Configuration.User.Uid, fs.Configuration.User.Gid)
+	}
+
+	return r, nil
+}
+
+// Determines if the local copy of a file already matches the entry in the manifest.
+func (fs *Filesystem) syncFileUnchanged(cleaned string, e SyncEntry) bool {
+	st, err := os.Lstat(cleaned)
+	if err != nil || !st.Mode().IsRegular() || st.Size() != e.Size {
+		return false
+	}
+
+	if e.Checksum == "" {
+		return st.ModTime().Unix() == e.ModTime
+	}
+
+	sum, err := fileChecksum(cleaned)
+
+	return err == nil && sum == e.Checksum
+}
+
+// Returns the hex encoded SHA-256 checksum of the contents of a file.
+func fileChecksum(p string) (string, error) {
+	f, err := os.Open(p)
+	if err != nil {
+		return "", errors.WithStack(err)
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", errors.WithStack(err)
+	}
+
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// Copies a single file, writing it to a temporary file next to it first so that a copy
+// that fails part of the way through does not leave a partially written file behind.
+func (fs *Filesystem) syncFile(ctx context.Context, cleaned string, e SyncEntry, fetch SyncFetchFunc) error {
+	tmp := filepath.Join(filepath.Dir(cleaned), ".wings-sync-"+filepath.Base(cleaned))
+
+	f, err := os.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	if err := fetch(ctx, e, f); err != nil {
+		f.Close()
+		os.Remove(tmp)
+
+		return err
+	}
+
+	if err := f.Close(); err != nil {
+		os.Remove(tmp)
+
+		return errors.WithStack(err)
+	}
+
+	// A directory that has been replaced by a file on the other node must be removed before
+	// the file can be moved into place.
+	if st, err := os.Lstat(cleaned); err == nil && st.IsDir() {
+		if err := os.RemoveAll(cleaned); err != nil {
+			os.Remove(tmp)
+
+			return errors.WithStack(err)
+		}
+	}
+
+	if err := os.Rename(tmp, cleaned); err != nil {
+		os.Remove(tmp)
+
+		return errors.WithStack(err)
+	}
+
+	mt := time.Unix(e.ModTime, 0)
+
+	os.Chmod(cleaned, e.Mode)
+	os.Lchown(cleaned, fs.Configuration.User.Uid, fs.Configuration.User.Gid)
+
+	return errors.WithStack(os.Chtimes(cleaned, mt, mt))
+}
+
+// Creates a symlink, replacing whatever is at the path if it is not already a link to the
+// same target. Links that would point outside of the server data directory are skipped.
+func (fs *Filesystem) syncSymlink(cleaned string, e SyncEntry) error {
+	target := e.Target
+	if !filepath.IsAbs(target) {
+		target = filepath.Join(filepath.Dir(cleaned), target)
+	}
+
+	if !fs.isInRoot(filepath.Clean(target)) {
+		return nil
+	}
+
+	if current, err := os.Readlink(cleaned); err == nil && current == e.Target {
+		return nil
+	}
+
+	if err := os.RemoveAll(cleaned); err != nil {
+		return errors.WithStack(err)
+	}
+
+	if err := os.Symlink(e.Target, cleaned); err != nil {
+		return errors.WithStack(err)
+	}
+
+	os.Lchown(cleaned, fs.Configuration.User.Uid, fs.Configuration.User.Gid)
+
+	return nil
+}
@@ -1,10 +1,12 @@
 package server
 
 import (
+	"bytes"
 	"encoding/json"
 	"github.com/buger/jsonparser"
 	"github.com/imdario/mergo"
 	"github.com/pkg/errors"
+	"github.com/pterodactyl/wings/config"
 	"go.uber.org/zap"
 )
 
@@ -28,9 +30,21 @@ func (s *Server) UpdateDataStructure(data []byte, background bool) error {
 		return errors.New("attempting to merge a data stack with an invalid UUID")
 	}
 
+	// Refuse to assign allocations that another server on this node is already using.
+	if len(src.Allocations.Mappings) > 0 {
+		if err := CheckAllocationConflicts(s.Uuid, src.Allocations.Mappings); err != nil {
+			return err
+		}
+	}
+
+	before := s.runtimeSnapshot()
+
 	// Merge the new data object that we have received with the existing server data object
 	// and then save it to the disk so it is persistent.
-	if err := mergo.Merge(s, src, mergo.WithOverride); err != nil {
+	s.Lock()
+	err := mergo.Merge(s, src, mergo.WithOverride)
+	s.Unlock()
+	if err != nil {
 		return errors.WithStack(err)
 	}
 
@@ -45,6 +59,14 @@ func (s *Server) UpdateDataStructure(data []byte, background bool) error {
 		s.Container.OomDisabled = v
 	}
 
+	if v, err := jsonparser.GetBoolean(data, "container", "tty"); err != nil {
+		if err != jsonparser.KeyPathNotFoundError {
+			return errors.WithStack(err)
+		}
+	} else {
+		s.Container.Tty = v
+	}
+
 	// Mergo also cannot handle this boolean value.
 	if v, err := jsonparser.GetBoolean(data, "suspended"); err != nil {
 		if err != jsonparser.KeyPathNotFoundError {
@@ -59,6 +81,30 @@ func (s *Server) UpdateDataStructure(data []byte, background bool) error {
 		}
 	}
 
+	// The denied command patterns are compiled once here rather than every time a command
+	// is sent to the server.
+	s.Lock()
+	s.deniedCommands = s.DeniedCommands.compile()
+	s.Unlock()
+
+	// The backup encryption key is never marshaled, so it has to be read from the data
+	// directly. It is replaced whenever it is sent, including with null, so that it can be
+	// removed.
+	if v, t, _, err := jsonparser.Get(data, "backup_encryption_key"); err == nil {
+		key := ""
+		if t == jsonparser.String {
+			if key, err = jsonparser.ParseString(v); err != nil {
+				return errors.WithStack(err)
+			}
+		}
+
+		s.Lock()
+		s.BackupEncryptionKey = key
+		s.Unlock()
+	} else if err != jsonparser.KeyPathNotFoundError {
+		return errors.WithStack(err)
+	}
+
 	// Environment and Mappings should be treated as a full update at all times, never a
 	// true patch, otherwise we can't know what we're passing along.
 	if src.EnvVars != nil && len(src.EnvVars) > 0 {
@@ -69,6 +115,44 @@ func (s *Server) UpdateDataStructure(data []byte, background bool) error {
 		s.Allocations.Mappings = src.Allocations.Mappings
 	}
 
+	// The same goes for tags. Tags from the Panel that are not valid are left out rather
+	// than failing the entire update.
+	if _, _, _, err := jsonparser.Get(data, "tags"); err == nil {
+		valid, invalid := cleanTags(src.Tags)
+		if len(invalid) > 0 {
+			zap.S().Warnw("ignoring invalid tags for server", zap.String("server", s.Uuid), zap.Strings("tags", invalid))
+		}
+
+		s.Tags = valid
+	}
+
+	// The Docker overrides are replaced as a whole as well, so that they can be removed.
+	if _, _, _, err := jsonparser.Get(data, "docker_overrides"); err == nil {
+		s.DockerOverrides = src.DockerOverrides
+	}
+
+	// The firewall is changed in the background since every command run can take a while,
+	// and servers being loaded should not have to wait on it.
+	if len(src.Allocations.Mappings) > 0 && config.Get().System.Firewall.Enabled {
+		go func(s *Server) {
+			if err := s.SyncFirewall(); err != nil {
+				zap.S().Warnw("failed to open server allocations in firewall", zap.String("server", s.Uuid), zap.Error(err))
+			}
+		}(s)
+	}
+
+	// A running server keeps using the environment it was started with, so it needs to be
+	// rebuilt before all of these changes take effect.
+	if s.GetState() != ProcessOfflineState && !bytes.Equal(before, s.runtimeSnapshot()) {
+		s.Lock()
+		s.rebuildRequired = true
+		s.Unlock()
+	}
+
+	if err := s.persistConfiguration(); err != nil {
+		zap.S().Warnw("failed to persist server configuration to disk", zap.String("server", s.Uuid), zap.Error(err))
+	}
+
 	if background {
 		s.runBackgroundActions()
 	}
@@ -111,3 +195,29 @@ func (s *Server) runBackgroundActions() {
 		}
 	}(s)
 }
+
+// Returns an encoded copy of the settings that the server environment is created from, so
+// that it can be determined if an update changed any of them.
+func (s *Server) runtimeSnapshot() []byte {
+	b, _ := json.Marshal(struct {
+		Invocation  string
+		EnvVars     map[string]string
+		Build       BuildSettings
+		Allocations Allocations
+		Image       string
+		OomDisabled bool
+		Tty         bool
+		Overrides   DockerOverrides
+	}{
+		Invocation:  s.Invocation,
+		EnvVars:     s.EnvVars,
+		Build:       s.Build,
+		Allocations: s.Allocations,
+		Image:       s.Container.Image,
+		OomDisabled: s.Container.OomDisabled,
+		Tty:         s.Container.Tty,
+		Overrides:   s.DockerOverrides,
+	})
+
+	return b
+}
@@ -0,0 +1,83 @@
+package server
+
+import (
+	"github.com/pterodactyl/wings/config"
+	"github.com/pterodactyl/wings/system"
+	"go.uber.org/zap"
+	"runtime"
+)
+
+// The capacity of the node for a single resource, how much of it has been allocated to
+// servers, and how much of it the servers are currently using. Servers without a limit
+// for the resource do not count towards the amount allocated.
+type ResourceUtilization struct {
+	Total     float64 `json:"total"`
+	Allocated float64 `json:"allocated"`
+	Used      float64 `json:"used"`
+}
+
+// The resources used by every server on the node combined. CPU is given as a percentage of
+// a single thread, so a node with four threads has a total of 400, while memory and disk
+// are given in bytes.
+type NodeUtilization struct {
+	Cpu    ResourceUtilization `json:"cpu"`
+	Memory ResourceUtilization `json:"memory"`
+	Disk   ResourceUtilization `json:"disk"`
+
+	// The number of servers on the node, and the number of them in each process state.
+	Servers    int            `json:"servers"`
+	States     map[string]int `json:"states"`
+	Suspended  int            `json:"suspended"`
+	Installing int            `json:"installing"`
+}
+
+// Collects the resources used by all of the given servers, along with the capacity of the
+// node. The disk usage of servers that do not have it cached is calculated with at most the
+// given number of servers being processed at once.
+func GatherNodeUtilization(servers []*Server, concurrency int) *NodeUtilization {
+	u := &NodeUtilization{
+		Servers: len(servers),
+		States: map[string]int{
+			ProcessOfflineState:  0,
+			ProcessStartingState: 0,
+			ProcessRunningState:  0,
+			ProcessStoppingState: 0,
+		},
+	}
+
+	u.Cpu.Total = float64(runtime.NumCPU() * 100)
+
+	if b, err := system.TotalMemory(); err != nil {
+		zap.S().Warnw("failed to determine memory capacity of node", zap.Error(err))
+	} else {
+		u.Memory.Total = float64(b)
+	}
+
+	if b, err := system.DiskCapacity(config.Get().System.Data); err != nil {
+		zap.S().Warnw("failed to determine disk capacity of node", zap.Error(err))
+	} else {
+		u.Disk.Total = float64(b)
+	}
+
+	usage := GatherResourceUsage(servers, concurrency)
+	for _, s := range servers {
+		u.States[s.GetState()]++
+		if s.Suspended {
+			u.Suspended++
+		}
+		if s.IsInstalling() {
+			u.Installing++
+		}
+
+		u.Cpu.Allocated += float64(s.Build.CpuLimit)
+		u.Memory.Allocated += float64(s.Build.MemoryLimit * 1000000)
+		u.Disk.Allocated += float64(s.Build.DiskSpace * 1000000)
+
+		r := usage[s.Uuid]
+		u.Cpu.Used += r.CpuAbsolute
+		u.Memory.Used += float64(r.Memory)
+		u.Disk.Used += float64(r.Disk)
+	}
+
+	return u
+}
@@ -0,0 +1,254 @@
+package server
+
+import (
+	"fmt"
+	"go.uber.org/zap"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Returned when one or more variables do not pass the validation rules defined for them,
+// contains the failures for each of the variables.
+type VariableValidationError struct {
+	Fields map[string][]string
+}
+
+func (e *VariableValidationError) Error() string {
+	var keys []string
+	for k := range e.Fields {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	return fmt.Sprintf("the following variables are not valid: %s", strings.Join(keys, ", "))
+}
+
+func IsVariableValidationError(err error) bool {
+	_, ok := err.(*VariableValidationError)
+
+	return ok
+}
+
+// Validates the given variables against the egg rules for each of them. The rules use
+// the same syntax as the Panel, a list of rules separated by pipes. The following rules
+// are supported, anything else is ignored:
+//
+//	required        the value must be provided and not empty
+//	nullable        an empty value is allowed and skips the remaining rules
+//	string          any value is allowed
+//	numeric         the value must be a number
+//	integer         the value must be a whole number
+//	boolean         the value must be one of 1, 0, true, or false
+//	in:a,b,c        the value must be one of the listed values
+//	regex:/^x+$/    the value must match the regular expression
+//	min:n, max:n    the value must be at least or at most n, this applies to the length
+//	                of the value unless numeric or integer is also present
+//	between:a,b     the same as min:a and max:b
+//
+// Empty values that are not required are not checked against any of the other rules.
+func ValidateVariables(rules map[string]string, vars map[string]string) error {
+	failures := make(map[string][]string)
+
+	for name, r := range rules {
+		value, ok := vars[name]
+
+		if msgs := validateVariable(name, parseVariableRules(r), value, ok); len(msgs) > 0 {
+			failures[name] = msgs
+		}
+	}
+
+	if len(failures) > 0 {
+		return &VariableValidationError{Fields: failures}
+	}
+
+	return nil
+}
+
+// Splits a rule string into the individual rules. Regular expressions can contain pipes,
+// so a regex rule continues until the closing delimiter of the expression is found.
+func parseVariableRules(r string) []string {
+	var out []string
+
+	parts := strings.Split(r, "|")
+	for i := 0; i < len(parts); i++ {
+		p := strings.TrimSpace(parts[i])
+		if p == "" {
+			continue
+		}
+
+		if strings.HasPrefix(p, "regex:") {
+			for !isCompleteRegex(strings.TrimPrefix(p, "regex:")) && i+1 < len(parts) {
+				i++
+				p += "|" + parts[i]
+			}
+		}
+
+		out = append(out, p)
+	}
+
+	return out
+}
+
+// Determines if a PHP style regular expression includes both of its delimiters.
+func isCompleteRegex(expr string) bool {
+	if len(expr) < 2 {
+		return false
+	}
+
+	end := strings.TrimRight(expr, "imsxuADU")
+
+	return len(end) >= 2 && end[len(end)-1] == expr[0]
+}
+
+// Converts a PHP style regular expression, such as /^[a-z]+$/i, into one that can be
+// compiled by Go.
+func compileVariableRegex(expr string) (*regexp.Regexp, error) {
+	if !isCompleteRegex(expr) {
+		return nil, fmt.Errorf("regular expression %s is missing a delimiter", expr)
+	}
+
+	end := strings.TrimRight(expr, "imsxuADU")
+	flags := expr[len(end):]
+	pattern := end[1 : len(end)-1]
+
+	var prefix string
+	for _, f := range flags {
+		if strings.ContainsRune("ims", f) {
+			prefix += string(f)
+		}
+	}
+
+	if prefix != "" {
+		pattern = "(?" + prefix + ")" + pattern
+	}
+
+	return regexp.Compile(pattern)
+}
+
+// Checks a single variable against its rules, returning a message for each of the rules
+// that failed.
+func validateVariable(name string, rules []string, value string, present bool) []string {
+	var msgs []string
+
+	isRule := func(r string) bool {
+		for _, v := range rules {
+			if v == r {
+				return true
+			}
+		}
+
+		return false
+	}
+
+	if isRule("required") && (!present || value == "") {
+		return []string{"The value is required."}
+	}
+
+	if value == "" {
+		return nil
+	}
+
+	numeric := isRule("numeric") || isRule("integer")
+
+	size := func() float64 {
+		if numeric {
+			n, _ := strconv.ParseFloat(value, 64)
+
+			return n
+		}
+
+		return float64(len([]rune(value)))
+	}
+
+	for _, rule := range rules {
+		parts := strings.SplitN(rule, ":", 2)
+		arg := ""
+		if len(parts) == 2 {
+			arg = parts[1]
+		}
+
+		switch parts[0] {
+		case "numeric":
+			if _, err := strconv.ParseFloat(value, 64); err != nil {
+				msgs = append(msgs, "The value must be a number.")
+			}
+		case "integer":
+			if _, err := strconv.ParseInt(value, 10, 64); err != nil {
+				msgs = append(msgs, "The value must be an integer.")
+			}
+		case "boolean":
+			switch value {
+			case "1", "0", "true", "false":
+			default:
+				msgs = append(msgs, "The value must be true or false.")
+			}
+		case "in":
+			found := false
+			for _, v := range strings.Split(arg, ",") {
+				if v == value {
+					found = true
+					break
+				}
+			}
+
+			if !found {
+				msgs = append(msgs, fmt.Sprintf("The value must be one of: %s.", arg))
+			}
+		case "regex":
+			re, err := compileVariableRegex(arg)
+			if err != nil {
+				zap.S().Warnw("ignoring invalid regular expression in variable rules", zap.String("variable", name), zap.Error(err))
+				continue
+			}
+
+			if !re.MatchString(value) {
+				msgs = append(msgs, "The value format is invalid.")
+			}
+		case "min", "max", "between":
+			bounds := strings.Split(arg, ",")
+			if parts[0] == "between" && len(bounds) != 2 {
+				continue
+			}
+
+			var limits []float64
+			for _, b := range bounds {
+				n, err := strconv.ParseFloat(strings.TrimSpace(b), 64)
+				if err != nil {
+					break
+				}
+				limits = append(limits, n)
+			}
+
+			if len(limits) != len(bounds) {
+				continue
+			}
+
+			min, max := -1.0, -1.0
+			switch parts[0] {
+			case "min":
+				min = limits[0]
+			case "max":
+				max = limits[0]
+			case "between":
+				min, max = limits[0], limits[1]
+			}
+
+			unit := " characters"
+			if numeric {
+				unit = ""
+			}
+
+			if min >= 0 && size() < min {
+				msgs = append(msgs, fmt.Sprintf("The value must be at least %s%s.", strconv.FormatFloat(min, 'f', -1, 64), unit))
+			}
+
+			if max >= 0 && size() > max {
+				msgs = append(msgs, fmt.Sprintf("The value may not be greater than %s%s.", strconv.FormatFloat(max, 'f', -1, 64), unit))
+			}
+		}
+	}
+
+	return msgs
+}
@@ -0,0 +1,78 @@
+package server
+
+import (
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+	"reflect"
+)
+
+// Replaces the environment variables assigned to the server and rewrites the configuration
+// files for the server using the new values. The variables are validated against the egg
+// rules first, and nothing is changed if any of them are invalid. Returns true if the
+// variables changed while the server was running, in which case the server must be
+// restarted before the startup command sees the new values.
+func (s *Server) UpdateEnvironmentVariables(vars map[string]string) (bool, error) {
+	if vars == nil {
+		vars = map[string]string{}
+	}
+
+	s.RLock()
+	rules := s.VariableRules
+	s.RUnlock()
+
+	if err := ValidateVariables(rules, vars); err != nil {
+		return false, err
+	}
+
+	s.Lock()
+	changed := !reflect.DeepEqual(s.EnvVars, vars)
+	s.EnvVars = vars
+	s.Unlock()
+
+	if !changed {
+		return s.RequiresRebuild(), nil
+	}
+
+	// The values used in the configuration files are rendered by the Panel, so the latest
+	// process configuration needs to be fetched for the new variables to be reflected in
+	// them. If the Panel cannot be reached the files are left as they are, they will be
+	// updated when the server is next started.
+	if err := s.refreshProcessConfiguration(); err != nil {
+		zap.S().Warnw("failed to fetch process configuration after updating variables", zap.String("server", s.Uuid), zap.Error(err))
+	} else if s.processConfiguration != nil {
+		// The configuration files are only read by the server process when it boots, so
+		// they can be safely rewritten now even if the server is running.
+		s.UpdateConfigurationFiles()
+	}
+
+	if s.GetState() != ProcessOfflineState {
+		s.Lock()
+		s.rebuildRequired = true
+		s.Unlock()
+	}
+
+	if err := s.persistConfiguration(); err != nil {
+		zap.S().Warnw("failed to persist server configuration to disk", zap.String("server", s.Uuid), zap.Error(err))
+	}
+
+	return s.RequiresRebuild(), nil
+}
+
+// Fetches the process configuration for the server from the Panel without changing any of
+// the other settings for the server.
+func (s *Server) refreshProcessConfiguration() error {
+	cfg, rerr, err := s.GetProcessConfiguration()
+	if err != nil || rerr != nil {
+		if err != nil {
+			return errors.WithStack(err)
+		}
+
+		return errors.New(rerr.String())
+	}
+
+	s.Lock()
+	s.processConfiguration = cfg.ProcessConfiguration
+	s.Unlock()
+
+	return nil
+}
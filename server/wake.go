@@ -0,0 +1,91 @@
+package server
+
+import (
+	"github.com/pterodactyl/wings/wake"
+	"go.uber.org/zap"
+	"net"
+	"strconv"
+)
+
+// Allows a stopped server to be started automatically when a player tries to connect to
+// it. While the server is offline the daemon listens on its default allocation, and starts
+// the server when a connection is made.
+type WakeOnConnectSettings struct {
+	// If set to true the daemon listens on the port of the server while it is offline.
+	Enabled bool `default:"false" json:"enabled" yaml:"enabled"`
+
+	// The protocol to listen for connections using, one of "tcp", "udp", or "minecraft".
+	// With "minecraft" status pings are answered using the message below, and only an
+	// attempt to join the server starts it.
+	Protocol string `default:"tcp" json:"protocol" yaml:"protocol"`
+
+	// The message shown to players while the server is starting, for protocols that are
+	// able to show one.
+	Message string `default:"Server is starting, please reconnect in a moment." json:"message" yaml:"message"`
+}
+
+// Begins listening for connections to the server while it is offline. Nothing happens if
+// a listener is already open for the server.
+func (s *Server) enableWakeOnConnect() {
+	if !s.WakeOnConnect.Enabled || s.Suspended {
+		return
+	}
+
+	s.Lock()
+	defer s.Unlock()
+
+	if s.wakeListener != nil {
+		return
+	}
+
+	address := net.JoinHostPort(normalizeAllocationIp(s.Allocations.DefaultMapping.Ip), strconv.Itoa(s.Allocations.DefaultMapping.Port))
+
+	l, err := wake.Listen(s.WakeOnConnect.Protocol, address, s.WakeOnConnect.Message, s.wakeFromConnection)
+	if err != nil {
+		zap.S().Warnw("failed to open wake listener for server", zap.String("server", s.Uuid), zap.String("address", address), zap.Error(err))
+		return
+	}
+
+	zap.S().Debugw("listening for connections to wake server", zap.String("server", s.Uuid), zap.String("address", address))
+
+	s.wakeListener = l
+}
+
+// Stops listening for connections to the server, freeing its port. This must happen before
+// the server process is started, and when the server is deleted.
+func (s *Server) DisableWakeOnConnect() {
+	s.Lock()
+	l := s.wakeListener
+	s.wakeListener = nil
+	s.Unlock()
+
+	if l != nil {
+		if err := l.Close(); err != nil {
+			zap.S().Debugw("failed to close wake listener for server", zap.String("server", s.Uuid), zap.Error(err))
+		}
+	}
+}
+
+// Starts the server after a player has tried to connect to it.
+func (s *Server) wakeFromConnection() {
+	if s.GetState() != ProcessOfflineState {
+		return
+	}
+
+	zap.S().Infow("starting server after a connection was made to it", zap.String("server", s.Uuid))
+
+	PublishNodeEvent(WakeEvent, s.Uuid, nil)
+
+	if err := s.RunPowerAction(PowerAction{Action: "start"}); err != nil {
+		zap.S().Errorw("failed to start server after a connection was made to it", zap.String("server", s.Uuid), zap.Error(err))
+
+		// The listener has already been used, so a new one is needed for the next attempt.
+		s.DisableWakeOnConnect()
+		if s.GetState() == ProcessOfflineState {
+			s.enableWakeOnConnect()
+		}
+		return
+	}
+
+	s.PublishConsoleOutputFromDaemon("Server was started after a player tried to connect to it.")
+}
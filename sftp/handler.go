@@ -0,0 +1,360 @@
+package sftp
+
+import (
+	"github.com/pkg/sftp"
+	"github.com/pterodactyl/sftp-server"
+	"github.com/pterodactyl/wings/config"
+	"github.com/pterodactyl/wings/server"
+	"go.uber.org/zap"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// Handles the SFTP requests for a single server. All paths are resolved through the server
+// filesystem so that the same protections applied to the file API also apply here.
+type fileSystem struct {
+	*server.FileAccess
+
+	lock sync.Mutex
+}
+
+// Creates the filesystem for a server using the permissions assigned to the user that
+// logged in.
+func newFileSystem(s *server.Server, permissions []string) *fileSystem {
+	return &fileSystem{
+		FileAccess: server.NewFileAccess(s, permissions, config.Get().System.Sftp.ReadOnly, zap.S().Named("sftp")),
+	}
+}
+
+// Creates the SFTP request handlers for a filesystem.
+func newHandlers(fs *fileSystem) sftp.Handlers {
+	return sftp.Handlers{
+		FileGet:  fs,
+		FilePut:  fs,
+		FileCmd:  fs,
+		FileList: fs,
+	}
+}
+
+// Fileread creates a reader for a file on the system and returns the reader back.
+func (fs *fileSystem) Fileread(request *sftp.Request) (io.ReaderAt, error) {
+	// This permission is named really poorly, but it is checking if they can read. There
+	// is an additional permission, "save-files" which determines if they can write.
+	if !fs.Can("edit-files") {
+		return nil, sftp.ErrSshFxPermissionDenied
+	}
+
+	p, err := fs.Server.Filesystem.SafePath(request.Filepath)
+	if err != nil {
+		return nil, sftp.ErrSshFxNoSuchFile
+	}
+
+	fs.lock.Lock()
+	defer fs.lock.Unlock()
+
+	if _, err := os.Stat(p); os.IsNotExist(err) {
+		return nil, sftp.ErrSshFxNoSuchFile
+	}
+
+	file, err := fs.Server.Filesystem.OpenFile(p, os.O_RDONLY, 0)
+	if err != nil {
+		fs.Logger.Errorw("could not open file for reading", zap.String("source", p), zap.Error(err))
+		return nil, sftp.ErrSshFxFailure
+	}
+
+	return file, nil
+}
+
+// Filewrite handles the write actions for a file on the system.
+func (fs *fileSystem) Filewrite(request *sftp.Request) (io.WriterAt, error) {
+	if config.Get().System.Sftp.ReadOnly {
+		return nil, sftp.ErrSshFxOpUnsupported
+	}
+
+	p, err := fs.Server.Filesystem.SafePath(request.Filepath)
+	if err != nil {
+		return nil, sftp.ErrSshFxNoSuchFile
+	}
+
+	if fs.IsProtected(p) {
+		return nil, sftp.ErrSshFxPermissionDenied
+	}
+
+	// If the user doesn't have enough space left on the server it should respond with an
+	// error since we won't be letting them write this file to the disk.
+	if !config.Get().System.Sftp.DisableDiskChecking && !fs.HasSpaceAvailable() {
+		return nil, sftp.ErrSshFxFailure
+	}
+
+	fs.lock.Lock()
+	defer fs.lock.Unlock()
+
+	stat, statErr := os.Stat(p)
+	// If the file doesn't exist we need to create it, as well as the directory pathway
+	// leading up to where that file will be created.
+	if os.IsNotExist(statErr) {
+		// If the file doesn't exist already we need to determine if this user has permission
+		// to create files.
+		if !fs.Can("create-files") {
+			return nil, sftp.ErrSshFxPermissionDenied
+		}
+
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			fs.Logger.Errorw("error making path for file", zap.String("source", p), zap.String("path", filepath.Dir(p)), zap.Error(err))
+			return nil, sftp.ErrSshFxFailure
+		}
+
+		upload, err := fs.beginUpload()
+		if err != nil {
+			return nil, err
+		}
+
+		file, err := fs.Server.Filesystem.OpenFile(p, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0666)
+		if err != nil {
+			upload.Done()
+			fs.Logger.Errorw("error creating file", zap.String("source", p), zap.Error(err))
+			return nil, sftp.ErrSshFxFailure
+		}
+
+		fs.Chown(p)
+
+		return &uploadedFile{File: file, fs: fs, path: p, upload: upload}, nil
+	}
+
+	// If the stat error isn't about the file not existing, there is some other issue
+	// at play and we need to go ahead and bail out of the process.
+	if statErr != nil {
+		fs.Logger.Errorw("error performing file stat", zap.String("source", p), zap.Error(statErr))
+		return nil, sftp.ErrSshFxFailure
+	}
+
+	// The file already exists, so check that the user has permission to save modified files.
+	if !fs.Can("save-files") {
+		return nil, sftp.ErrSshFxPermissionDenied
+	}
+
+	if stat.IsDir() {
+		fs.Logger.Warnw("attempted to open a directory for writing to", zap.String("source", p))
+		return nil, sftp.ErrSshFxOpUnsupported
+	}
+
+	upload, err := fs.beginUpload()
+	if err != nil {
+		return nil, err
+	}
+
+	file, err := fs.Server.Filesystem.OpenFile(p, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0666)
+	if err != nil {
+		upload.Done()
+		fs.Logger.Errorw("error opening existing file", zap.Uint32("flags", request.Flags), zap.String("source", p), zap.Error(err))
+		return nil, sftp.ErrSshFxFailure
+	}
+
+	fs.Chown(p)
+
+	return &uploadedFile{File: file, fs: fs, path: p, upload: upload}, nil
+}
+
+// Registers a new upload for the server, returning an SFTP error if there are already too
+// many uploads in progress.
+func (fs *fileSystem) beginUpload() (*server.Upload, error) {
+	upload, err := fs.BeginUpload()
+	if err != nil {
+		return nil, sftp.ErrSshFxFailure
+	}
+
+	return upload, nil
+}
+
+// A file being uploaded over SFTP. Writes are throttled to the configured upload bandwidth
+// limits, and once the upload is complete and the file is closed it is scanned for malware
+// in the background.
+type uploadedFile struct {
+	*os.File
+
+	fs     *fileSystem
+	path   string
+	upload *server.Upload
+}
+
+func (f *uploadedFile) WriteAt(b []byte, off int64) (int, error) {
+	f.upload.Wait(len(b))
+
+	return f.File.WriteAt(b, off)
+}
+
+func (f *uploadedFile) Close() error {
+	err := f.File.Close()
+	f.fs.FinishUpload(f.path, f.upload)
+
+	return err
+}
+
+// Filecmd handles basic SFTP system calls related to files, but not anything to do with
+// reading or writing to those files.
+func (fs *fileSystem) Filecmd(request *sftp.Request) error {
+	if config.Get().System.Sftp.ReadOnly {
+		return sftp.ErrSshFxOpUnsupported
+	}
+
+	// Commands that act on a path itself, rather than what it contains, must not resolve a
+	// symlink in the final part of the path, otherwise removing or renaming a link would
+	// affect whatever it points to instead.
+	resolve := fs.Server.Filesystem.SafePath
+	switch request.Method {
+	case "Rename", "Rmdir", "Remove":
+		resolve = fs.Server.Filesystem.SafeLinkPath
+	}
+
+	p, err := resolve(request.Filepath)
+	if err != nil {
+		return sftp.ErrSshFxNoSuchFile
+	}
+
+	var target string
+	// If a target is provided in this request validate that it is going to the correct
+	// location for the server. If it is not, return an operation unsupported error.
+	if request.Target != "" {
+		target, err = fs.Server.Filesystem.SafeLinkPath(request.Target)
+		if err != nil {
+			return sftp.ErrSshFxOpUnsupported
+		}
+
+		if fs.IsProtected(target) {
+			return sftp.ErrSshFxPermissionDenied
+		}
+	}
+
+	// The source of a symlink is only read from, every other command modifies the path.
+	if request.Method != "Symlink" && fs.IsProtected(p) {
+		return sftp.ErrSshFxPermissionDenied
+	}
+
+	switch request.Method {
+	case "Setstat":
+		var mode os.FileMode = 0644
+
+		// If the client passed a valid file permission use that, otherwise use the
+		// default of 0644 set above.
+		if request.Attributes().FileMode().Perm() != 0000 {
+			mode = request.Attributes().FileMode().Perm()
+		}
+
+		// Force directories to be 0755
+		if request.Attributes().FileMode().IsDir() {
+			mode = 0755
+		}
+
+		if err := os.Chmod(p, mode); err != nil {
+			fs.Logger.Errorw("failed to perform setstat", zap.Error(err))
+			return sftp.ErrSshFxFailure
+		}
+
+		return nil
+	case "Rename":
+		if !fs.Can("move-files") {
+			return sftp.ErrSshFxPermissionDenied
+		}
+
+		if err := os.Rename(p, target); err != nil {
+			fs.Logger.Errorw("failed to rename file", zap.String("source", p), zap.String("target", target), zap.Error(err))
+			return sftp.ErrSshFxFailure
+		}
+	case "Rmdir":
+		if !fs.Can("delete-files") {
+			return sftp.ErrSshFxPermissionDenied
+		}
+
+		if err := os.RemoveAll(p); err != nil {
+			fs.Logger.Errorw("failed to remove directory", zap.String("source", p), zap.Error(err))
+			return sftp.ErrSshFxFailure
+		}
+
+		return sftp.ErrSshFxOk
+	case "Mkdir":
+		if !fs.Can("create-files") {
+			return sftp.ErrSshFxPermissionDenied
+		}
+
+		if err := os.MkdirAll(p, 0755); err != nil {
+			fs.Logger.Errorw("failed to create directory", zap.String("source", p), zap.Error(err))
+			return sftp.ErrSshFxFailure
+		}
+	case "Symlink":
+		if !fs.Can("create-files") {
+			return sftp.ErrSshFxPermissionDenied
+		}
+
+		if err := os.Symlink(p, target); err != nil {
+			fs.Logger.Errorw("failed to create symlink", zap.String("source", p), zap.String("target", target), zap.Error(err))
+			return sftp.ErrSshFxFailure
+		}
+	case "Remove":
+		if !fs.Can("delete-files") {
+			return sftp.ErrSshFxPermissionDenied
+		}
+
+		if err := os.Remove(p); err != nil {
+			if !os.IsNotExist(err) {
+				fs.Logger.Errorw("failed to remove a file", zap.String("source", p), zap.Error(err))
+			}
+			return sftp.ErrSshFxFailure
+		}
+
+		return sftp.ErrSshFxOk
+	default:
+		return sftp.ErrSshFxOpUnsupported
+	}
+
+	// There is no need to check if the file was removed here because both of those cases
+	// (Rmdir, Remove) have an explicit return above.
+	if target != "" {
+		fs.Chown(target)
+	} else {
+		fs.Chown(p)
+	}
+
+	return sftp.ErrSshFxOk
+}
+
+// Filelist handles listing the contents of a directory as well as file and folder stat calls.
+func (fs *fileSystem) Filelist(request *sftp.Request) (sftp.ListerAt, error) {
+	p, err := fs.Server.Filesystem.SafePath(request.Filepath)
+	if err != nil {
+		return nil, sftp.ErrSshFxNoSuchFile
+	}
+
+	switch request.Method {
+	case "List":
+		if !fs.Can("list-files") {
+			return nil, sftp.ErrSshFxPermissionDenied
+		}
+
+		files, err := ioutil.ReadDir(p)
+		if err != nil {
+			fs.Logger.Errorw("error listing directory", zap.Error(err))
+			return nil, sftp.ErrSshFxFailure
+		}
+
+		return sftp_server.ListerAt(files), nil
+	case "Stat":
+		if !fs.Can("list-files") {
+			return nil, sftp.ErrSshFxPermissionDenied
+		}
+
+		s, err := os.Stat(p)
+		if os.IsNotExist(err) {
+			return nil, sftp.ErrSshFxNoSuchFile
+		} else if err != nil {
+			fs.Logger.Errorw("error running STAT on file", zap.Error(err))
+			return nil, sftp.ErrSshFxFailure
+		}
+
+		return sftp_server.ListerAt([]os.FileInfo{s}), nil
+	default:
+		return nil, sftp.ErrSshFxOpUnsupported
+	}
+}
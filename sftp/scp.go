@@ -0,0 +1,656 @@
+package sftp
+
+import (
+	"bufio"
+	"fmt"
+	"github.com/pkg/errors"
+	"github.com/pterodactyl/wings/config"
+	"go.uber.org/zap"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// An scp command sent by a client over an exec request. The remote side of a copy is run
+// with either -t (sink mode, receiving files from the client) or -f (source mode, sending
+// files to the client), and the files are then sent over the channel using the legacy scp
+// protocol. Newer clients use SFTP for scp instead unless they are told otherwise.
+type scpCommand struct {
+	sink      bool
+	recursive bool
+	preserve  bool
+	directory bool
+	path      string
+
+	fs  *fileSystem
+	rw  io.ReadWriter
+	r   *bufio.Reader
+	err error
+}
+
+// Parses the command sent in an exec request, returning false if it is not an scp command
+// this server knows how to handle.
+func parseScpCommand(command string) (*scpCommand, bool) {
+	args, ok := splitCommand(command)
+	if !ok || len(args) < 2 || path.Base(args[0]) != "scp" {
+		return nil, false
+	}
+
+	c := &scpCommand{}
+
+	var source, sink bool
+	var i int
+	for i = 1; i < len(args); i++ {
+		if args[i] == "--" {
+			i++
+			break
+		}
+
+		if !strings.HasPrefix(args[i], "-") || args[i] == "-" {
+			break
+		}
+
+		for _, f := range args[i][1:] {
+			switch f {
+			case 't':
+				sink = true
+			case 'f':
+				source = true
+			case 'r':
+				c.recursive = true
+			case 'p':
+				c.preserve = true
+			case 'd':
+				c.directory = true
+			case 'v', 'q':
+			default:
+				return nil, false
+			}
+		}
+	}
+
+	// Exactly one path must be given, along with exactly one of the modes.
+	if i != len(args)-1 || source == sink {
+		return nil, false
+	}
+
+	c.sink = sink
+	c.path = args[i]
+
+	return c, true
+}
+
+// Splits a command into its arguments, in the same way a shell would for quoted arguments.
+// Clients quote paths that contain spaces or other special characters.
+func splitCommand(command string) ([]string, bool) {
+	var args []string
+	var b strings.Builder
+	var quote rune
+	var escaped, inArg bool
+
+	for _, r := range command {
+		switch {
+		case escaped:
+			b.WriteRune(r)
+			escaped = false
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			} else if r == '\\' && quote == '"' {
+				escaped = true
+			} else {
+				b.WriteRune(r)
+			}
+		case r == '\\':
+			escaped, inArg = true, true
+		case r == '\'' || r == '"':
+			quote, inArg = r, true
+		case r == ' ' || r == '\t':
+			if inArg {
+				args = append(args, b.String())
+				b.Reset()
+				inArg = false
+			}
+		default:
+			b.WriteRune(r)
+			inArg = true
+		}
+	}
+
+	if quote != 0 || escaped {
+		return nil, false
+	}
+
+	if inArg {
+		args = append(args, b.String())
+	}
+
+	return args, true
+}
+
+// Runs the command against the files of the server. An error is returned if the copy did
+// not fully succeed, even if some files were copied.
+func (c *scpCommand) run(rw io.ReadWriter, fs *fileSystem) error {
+	c.fs = fs
+	c.rw = rw
+	c.r = bufio.NewReader(rw)
+
+	var err error
+	if c.sink {
+		err = c.receive()
+	} else {
+		err = c.send()
+	}
+
+	if err != nil {
+		return err
+	}
+
+	return c.err
+}
+
+// Reports an error for a single file to the client. The error is not fatal, the client
+// skips the file and continues with the rest of the copy.
+func (c *scpCommand) warn(name string, err error) error {
+	msg := "failure"
+	switch {
+	case os.IsNotExist(errors.Cause(err)):
+		msg = "No such file or directory"
+	case os.IsPermission(errors.Cause(err)):
+		msg = "Permission denied"
+	case errors.Cause(err) == errNotRegularFile:
+		msg = "not a regular file"
+	case errors.Cause(err) == errNotDirectory:
+		msg = "Not a directory"
+	}
+
+	c.err = errors.Wrap(err, name)
+
+	_, werr := fmt.Fprintf(c.rw, "\x01scp: %s: %s\n", name, msg)
+
+	return werr
+}
+
+func (c *scpCommand) ack() error {
+	_, err := c.rw.Write([]byte{0})
+
+	return err
+}
+
+// Waits for the client to confirm the last message sent to it. If the client responds with
+// an error, the message is returned along with false.
+func (c *scpCommand) response() (string, bool, error) {
+	b, err := c.r.ReadByte()
+	if err != nil {
+		return "", false, err
+	}
+
+	switch b {
+	case 0:
+		return "", true, nil
+	case 1, 2:
+		msg, err := c.r.ReadString('\n')
+		if err != nil {
+			return "", false, err
+		}
+
+		if b == 2 {
+			return "", false, errors.New("scp: client aborted: " + strings.TrimSpace(msg))
+		}
+
+		return strings.TrimSpace(msg), false, nil
+	default:
+		return "", false, errors.New("scp: unexpected response from client")
+	}
+}
+
+var (
+	errNotRegularFile = errors.New("not a regular file")
+	errNotDirectory   = errors.New("not a directory")
+)
+
+// Receives files sent by the client, writing them to the path the command was run with.
+// If the path is an existing directory the files are written into it, otherwise the first
+// file or directory sent is written to the path itself.
+func (c *scpCommand) receive() error {
+	target := path.Clean("/" + c.path)
+
+	isDir := false
+	if p, err := c.fs.Server.Filesystem.SafePath(target); err == nil {
+		if st, err := os.Stat(p); err == nil && st.IsDir() {
+			isDir = true
+		}
+	}
+
+	if c.directory && !isDir {
+		return c.warn(c.path, errNotDirectory)
+	}
+
+	if err := c.ack(); err != nil {
+		return err
+	}
+
+	// The directories currently being received, along with the times to set on each of
+	// them once all of their contents have been received.
+	type dir struct {
+		path  string
+		times []time.Time
+	}
+	var dirs []dir
+	var times []time.Time
+
+	for {
+		line, err := c.r.ReadString('\n')
+		if err == io.EOF && line == "" {
+			return nil
+		} else if err != nil {
+			return errors.WithStack(err)
+		}
+
+		line = strings.TrimSuffix(line, "\n")
+		if line == "" {
+			return errors.New("scp: protocol error: empty message")
+		}
+
+		switch line[0] {
+		case 'T':
+			if times, err = parseScpTimes(line[1:]); err != nil {
+				return err
+			}
+
+			if err := c.ack(); err != nil {
+				return err
+			}
+		case 'C', 'D':
+			mode, size, name, err := parseScpHeader(line[1:])
+			if err != nil {
+				return err
+			}
+
+			p := target
+			if len(dirs) > 0 {
+				p = path.Join(dirs[len(dirs)-1].path, name)
+			} else if isDir {
+				p = path.Join(target, name)
+			}
+
+			if line[0] == 'D' {
+				if err := c.fs.scpMkdir(p, mode, c.preserve); err != nil {
+					if err := c.warn(name, err); err != nil {
+						return err
+					}
+				} else {
+					dirs = append(dirs, dir{path: p, times: times})
+					if err := c.ack(); err != nil {
+						return err
+					}
+				}
+
+				times = nil
+				continue
+			}
+
+			if err := c.receiveFile(p, name, mode, size, times); err != nil {
+				return err
+			}
+
+			times = nil
+		case 'E':
+			if len(dirs) == 0 {
+				return errors.New("scp: protocol error: unexpected end of directory")
+			}
+
+			d := dirs[len(dirs)-1]
+			dirs = dirs[:len(dirs)-1]
+
+			if d.times != nil {
+				c.fs.scpChtimes(d.path, d.times)
+			}
+
+			if err := c.ack(); err != nil {
+				return err
+			}
+		case 1, 2:
+			// The client could not read one of its own files and is letting us know, which
+			// is only fatal if it says so.
+			if line[0] == 2 {
+				return errors.New("scp: client aborted: " + line[1:])
+			}
+		default:
+			return errors.New("scp: protocol error: unexpected message")
+		}
+	}
+}
+
+// Receives the contents of a single file. If the file cannot be written its contents are
+// still read from the channel so that the rest of the copy can continue.
+func (c *scpCommand) receiveFile(p string, name string, mode os.FileMode, size int64, times []time.Time) error {
+	f, err := c.fs.scpCreate(p)
+	if err != nil {
+		return c.warn(name, err)
+	}
+
+	if err := c.ack(); err != nil {
+		f.Close()
+		return err
+	}
+
+	n, werr := io.CopyN(f, f.upload.Reader(c.r), size)
+	if werr != nil && n < size {
+		// Whatever is left of the file still needs to be read before the next message.
+		if _, err := io.CopyN(ioutil.Discard, c.r, size-n); err != nil {
+			f.Close()
+			return errors.WithStack(err)
+		}
+	} else if c.preserve {
+		werr = f.Chmod(mode)
+	}
+	f.Close()
+
+	if times != nil {
+		c.fs.scpChtimes(p, times)
+	}
+
+	// The client follows the contents of every file with a single null byte.
+	if _, ok, err := c.response(); err != nil {
+		return err
+	} else if !ok {
+		return nil
+	}
+
+	if werr != nil {
+		return c.warn(name, werr)
+	}
+
+	return c.ack()
+}
+
+// Sends the path the command was run with to the client.
+func (c *scpCommand) send() error {
+	if _, ok, err := c.response(); err != nil || !ok {
+		return err
+	}
+
+	p := path.Clean("/" + c.path)
+	name := path.Base(p)
+	if name == "/" {
+		name = "."
+	}
+
+	return c.sendPath(p, name)
+}
+
+func (c *scpCommand) sendPath(p string, name string) error {
+	st, err := c.fs.scpStat(p)
+	if err != nil {
+		return c.warn(name, err)
+	}
+
+	if c.preserve {
+		if _, err := fmt.Fprintf(c.rw, "T%d 0 %d 0\n", st.ModTime().Unix(), st.ModTime().Unix()); err != nil {
+			return err
+		}
+
+		if msg, ok, err := c.response(); err != nil {
+			return err
+		} else if !ok {
+			c.err = errors.New(msg)
+			return nil
+		}
+	}
+
+	if st.IsDir() {
+		return c.sendDir(p, name, st)
+	}
+
+	f, err := c.fs.scpOpen(p)
+	if err != nil {
+		return c.warn(name, err)
+	}
+	defer f.Close()
+
+	if _, err := fmt.Fprintf(c.rw, "C%04o %d %s\n", st.Mode().Perm(), st.Size(), name); err != nil {
+		return err
+	}
+
+	if msg, ok, err := c.response(); err != nil {
+		return err
+	} else if !ok {
+		c.err = errors.New(msg)
+		return nil
+	}
+
+	if _, err := io.CopyN(c.rw, f, st.Size()); err != nil {
+		return errors.WithStack(err)
+	}
+
+	if err := c.ack(); err != nil {
+		return err
+	}
+
+	if msg, ok, err := c.response(); err != nil {
+		return err
+	} else if !ok {
+		c.err = errors.New(msg)
+	}
+
+	return nil
+}
+
+func (c *scpCommand) sendDir(p string, name string, st os.FileInfo) error {
+	if !c.recursive {
+		return c.warn(name, errNotRegularFile)
+	}
+
+	files, err := c.fs.scpList(p)
+	if err != nil {
+		return c.warn(name, err)
+	}
+
+	if _, err := fmt.Fprintf(c.rw, "D%04o 0 %s\n", st.Mode().Perm(), name); err != nil {
+		return err
+	}
+
+	if msg, ok, err := c.response(); err != nil {
+		return err
+	} else if !ok {
+		c.err = errors.New(msg)
+		return nil
+	}
+
+	for _, f := range files {
+		if err := c.sendPath(path.Join(p, f.Name()), f.Name()); err != nil {
+			return err
+		}
+	}
+
+	if _, err := fmt.Fprint(c.rw, "E\n"); err != nil {
+		return err
+	}
+
+	if msg, ok, err := c.response(); err != nil {
+		return err
+	} else if !ok {
+		c.err = errors.New(msg)
+	}
+
+	return nil
+}
+
+// Parses the mode, size and name of a file or directory sent by the client. The name must
+// be a single path component, otherwise the client could write anywhere.
+func parseScpHeader(s string) (os.FileMode, int64, string, error) {
+	parts := strings.SplitN(s, " ", 3)
+	if len(parts) != 3 {
+		return 0, 0, "", errors.New("scp: protocol error: invalid file header")
+	}
+
+	mode, err := strconv.ParseUint(parts[0], 8, 32)
+	if err != nil {
+		return 0, 0, "", errors.New("scp: protocol error: invalid file mode")
+	}
+
+	size, err := strconv.ParseInt(parts[1], 10, 64)
+	if err != nil || size < 0 {
+		return 0, 0, "", errors.New("scp: protocol error: invalid file size")
+	}
+
+	name := parts[2]
+	if name == "" || name == "." || name == ".." || strings.ContainsAny(name, "/\x00") {
+		return 0, 0, "", errors.New("scp: protocol error: invalid file name")
+	}
+
+	return os.FileMode(mode).Perm(), size, name, nil
+}
+
+// Parses the modification and access times sent by the client ahead of a file.
+func parseScpTimes(s string) ([]time.Time, error) {
+	parts := strings.Split(s, " ")
+	if len(parts) != 4 {
+		return nil, errors.New("scp: protocol error: invalid times")
+	}
+
+	mtime, err := strconv.ParseInt(parts[0], 10, 64)
+	if err != nil {
+		return nil, errors.New("scp: protocol error: invalid modification time")
+	}
+
+	atime, err := strconv.ParseInt(parts[2], 10, 64)
+	if err != nil {
+		return nil, errors.New("scp: protocol error: invalid access time")
+	}
+
+	return []time.Time{time.Unix(atime, 0), time.Unix(mtime, 0)}, nil
+}
+
+// Returns information about a file being sent to the client.
+func (fs *fileSystem) scpStat(p string) (os.FileInfo, error) {
+	if !fs.Can("list-files") {
+		return nil, os.ErrPermission
+	}
+
+	resolved, err := fs.Server.Filesystem.SafePath(p)
+	if err != nil {
+		return nil, os.ErrNotExist
+	}
+
+	return os.Stat(resolved)
+}
+
+func (fs *fileSystem) scpList(p string) ([]os.FileInfo, error) {
+	resolved, err := fs.Server.Filesystem.SafePath(p)
+	if err != nil {
+		return nil, os.ErrNotExist
+	}
+
+	return ioutil.ReadDir(resolved)
+}
+
+// Opens a file being sent to the client.
+func (fs *fileSystem) scpOpen(p string) (*os.File, error) {
+	if !fs.Can("edit-files") {
+		return nil, os.ErrPermission
+	}
+
+	resolved, err := fs.Server.Filesystem.SafePath(p)
+	if err != nil {
+		return nil, os.ErrNotExist
+	}
+
+	return fs.Server.Filesystem.OpenFile(resolved, os.O_RDONLY, 0)
+}
+
+// Creates a directory being received from the client, which is not an error if the
+// directory already exists.
+func (fs *fileSystem) scpMkdir(p string, mode os.FileMode, preserve bool) error {
+	resolved, err := fs.Server.Filesystem.SafePath(p)
+	if err != nil {
+		return os.ErrNotExist
+	}
+
+	if st, err := os.Stat(resolved); err == nil {
+		if !st.IsDir() {
+			return errNotDirectory
+		}
+
+		return nil
+	}
+
+	if !fs.Can("create-files") || !fs.CanModify(resolved) {
+		return os.ErrPermission
+	}
+
+	if !preserve {
+		mode = 0755
+	}
+
+	if err := os.Mkdir(resolved, mode|0700); err != nil {
+		return err
+	}
+
+	fs.Chown(resolved)
+
+	return nil
+}
+
+// Creates or truncates a file being received from the client, checking the same permissions
+// as an SFTP upload.
+func (fs *fileSystem) scpCreate(p string) (*uploadedFile, error) {
+	resolved, err := fs.Server.Filesystem.SafePath(p)
+	if err != nil {
+		return nil, os.ErrNotExist
+	}
+
+	if !fs.CanModify(resolved) {
+		return nil, os.ErrPermission
+	}
+
+	if st, err := os.Stat(resolved); os.IsNotExist(err) {
+		if !fs.Can("create-files") {
+			return nil, os.ErrPermission
+		}
+	} else if err != nil {
+		return nil, err
+	} else if st.IsDir() {
+		return nil, errNotRegularFile
+	} else if !fs.Can("save-files") {
+		return nil, os.ErrPermission
+	}
+
+	if !config.Get().System.Sftp.DisableDiskChecking && !fs.HasSpaceAvailable() {
+		return nil, os.ErrPermission
+	}
+
+	upload, err := fs.BeginUpload()
+	if err != nil {
+		return nil, err
+	}
+
+	file, err := fs.Server.Filesystem.OpenFile(resolved, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		upload.Done()
+		return nil, err
+	}
+
+	fs.Chown(resolved)
+
+	return &uploadedFile{File: file, fs: fs, path: resolved, upload: upload}, nil
+}
+
+// Sets the access and modification times of a file received from the client. Failing to do
+// so is not treated as an error since the file itself was still received.
+func (fs *fileSystem) scpChtimes(p string, times []time.Time) {
+	resolved, err := fs.Server.Filesystem.SafePath(p)
+	if err != nil {
+		return
+	}
+
+	if err := os.Chtimes(resolved, times[0], times[1]); err != nil {
+		fs.Logger.Debugw("failed to set file times", zap.String("file", filepath.Base(resolved)), zap.Error(err))
+	}
+}
@@ -1,75 +1,271 @@
 package sftp
 
 import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
 	"github.com/pkg/errors"
+	"github.com/pkg/sftp"
 	"github.com/pterodactyl/sftp-server"
 	"github.com/pterodactyl/wings/api"
 	"github.com/pterodactyl/wings/config"
+	"github.com/pterodactyl/wings/proxyproto"
+	"github.com/pterodactyl/wings/router"
 	"github.com/pterodactyl/wings/server"
 	"go.uber.org/zap"
-	"path"
+	"golang.org/x/crypto/ssh"
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
 )
 
 func Initialize(config *config.Configuration) error {
-	c := &sftp_server.Server{
-		User: sftp_server.SftpUser{
-			Uid: config.System.User.Uid,
-			Gid: config.System.User.Gid,
-		},
-		Settings: sftp_server.Settings{
-			BasePath:         config.System.Data,
-			ReadOnly:         config.System.Sftp.ReadOnly,
-			BindAddress:      config.System.Sftp.Address,
-			BindPort:         config.System.Sftp.Port,
-			ServerDataFolder: path.Join(config.System.Data, "/servers"),
-			DisableDiskCheck: config.System.Sftp.DisableDiskChecking,
+	// Initialize the SFTP server in a background thread since this is
+	// a long running operation.
+	go func() {
+		if err := listen(config); err != nil {
+			zap.S().Named("sftp").Errorw("failed to initialize SFTP subsystem", zap.Error(errors.WithStack(err)))
+		}
+	}()
+
+	return nil
+}
+
+// Returns the host of a remote address without the port.
+func remoteHost(addr net.Addr) string {
+	host, _, err := net.SplitHostPort(addr.String())
+	if err != nil {
+		return addr.String()
+	}
+
+	return host
+}
+
+// Starts listening for inbound SFTP connections. File operations are handled by this
+// package, while the SFTP library is only used for its credential and listing types.
+func listen(cfg *config.Configuration) error {
+	logger := zap.S().Named("sftp")
+
+	serverConfig := &ssh.ServerConfig{
+		NoClientAuth: false,
+		MaxAuthTries: 6,
+		PasswordCallback: func(conn ssh.ConnMetadata, pass []byte) (*ssh.Permissions, error) {
+			address := remoteHost(conn.RemoteAddr())
+
+			// Banned addresses are turned away before the Panel is asked about the credentials,
+			// so that they cannot keep guessing them.
+			if _, ok := router.ActiveSftpBan(address); ok {
+				return nil, errors.New("this address has been temporarily banned")
+			}
+
+			resp, err := validateCredentials(sftp_server.AuthenticationRequest{
+				User: conn.User(),
+				Pass: string(pass),
+			})
+
+			if err != nil {
+				if sftp_server.IsInvalidCredentialsError(err) {
+					router.RecordSftpAuthFailure(address)
+				} else {
+					logger.Errorw("encountered error validating user credentials", zap.String("ip", conn.RemoteAddr().String()), zap.Error(err))
+				}
+
+				return nil, err
+			}
+
+			return &ssh.Permissions{
+				Extensions: map[string]string{
+					"uuid":        resp.Server,
+					"user":        conn.User(),
+					"permissions": strings.Join(resp.Permissions, ","),
+				},
+			}, nil
 		},
-		CredentialValidator: validateCredentials,
-		PathValidator: validatePath,
-		DiskSpaceValidator: validateDiskSpace,
 	}
 
-	if err := sftp_server.New(c); err != nil {
-		return err
+	key, err := loadPrivateKey(filepath.Join(cfg.System.Data, ".sftp", "id_rsa"))
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	serverConfig.AddHostKey(key)
+
+	var l net.Listener
+	l, err = net.Listen("tcp", fmt.Sprintf("%s:%d", cfg.System.Sftp.Address, cfg.System.Sftp.Port))
+	if err != nil {
+		return errors.WithStack(err)
 	}
 
-	c.ConfigureLogger(func() *zap.SugaredLogger {
-		return zap.S().Named("sftp")
-	})
+	if cfg.System.Sftp.ProxyProtocol {
+		if len(cfg.TrustedProxies) == 0 {
+			logger.Warnw("proxy protocol is enabled for the sftp server but no trusted proxies are configured, headers will be ignored")
+		}
 
-	// Initialize the SFTP server in a background thread since this is
-	// a long running operation.
-	go func(instance *sftp_server.Server) {
-		if err := c.Initalize(); err != nil {
-			zap.S().Named("sftp").Errorw("failed to initialize SFTP subsystem", zap.Error(errors.WithStack(err)))
+		if l, err = proxyproto.NewListener(l, cfg.TrustedProxies); err != nil {
+			return err
 		}
-	}(c)
+	}
 
-	return nil
+	logger.Infow("sftp subsystem listening for connections", zap.String("host", cfg.System.Sftp.Address), zap.Int("port", cfg.System.Sftp.Port), zap.Bool("proxy_protocol", cfg.System.Sftp.ProxyProtocol))
+
+	// Temporary failures, such as running out of file descriptors, are retried with an
+	// increasing delay rather than immediately so that they do not spin the CPU. Any other
+	// error means the listener is closed or unusable.
+	var delay time.Duration
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			if ne, ok := err.(net.Error); ok && ne.Temporary() {
+				if delay == 0 {
+					delay = 5 * time.Millisecond
+				} else if delay *= 2; delay > time.Second {
+					delay = time.Second
+				}
+
+				logger.Warnw("failed to accept sftp connection, retrying", zap.Duration("delay", delay), zap.Error(err))
+				time.Sleep(delay)
+				continue
+			}
+
+			if oe, ok := err.(*net.OpError); ok && oe.Err == net.ErrClosed {
+				return nil
+			}
+
+			return errors.WithStack(err)
+		}
+
+		delay = 0
+		go acceptInboundConnection(conn, serverConfig)
+	}
 }
 
-func validatePath(fs sftp_server.FileSystem, p string) (string, error) {
-	s := server.GetServers().Find(func(server *server.Server) bool {
-		return server.Uuid == fs.UUID
-	})
+// Handles an inbound connection to the instance and determines if we should serve the
+// request or not.
+func acceptInboundConnection(conn net.Conn, serverConfig *ssh.ServerConfig) {
+	defer conn.Close()
 
-	if s == nil {
-		return "", errors.New("no server found with that UUID")
+	// Before beginning a handshake must be performed on the incoming net.Conn
+	sconn, chans, reqs, err := ssh.NewServerConn(conn, serverConfig)
+	if err != nil {
+		return
 	}
+	defer sconn.Close()
 
-	return s.Filesystem.SafePath(p)
-}
+	go ssh.DiscardRequests(reqs)
 
-func validateDiskSpace(fs sftp_server.FileSystem) bool {
-	s := server.GetServers().Find(func(server *server.Server) bool {
-		return server.Uuid == fs.UUID
-	})
+	for newChannel := range chans {
+		// If its not a session channel we just move on because its not something we
+		// know how to handle at this point.
+		if newChannel.ChannelType() != "session" {
+			newChannel.Reject(ssh.UnknownChannelType, "unknown channel type")
+			continue
+		}
 
-	if s == nil {
-		return false
+		channel, requests, err := newChannel.Accept()
+		if err != nil {
+			continue
+		}
+
+		uuid := sconn.Permissions.Extensions["uuid"]
+		s := server.GetServers().Find(func(s *server.Server) bool {
+			return s.Uuid == uuid
+		})
+
+		if s == nil {
+			channel.Close()
+			continue
+		}
+
+		handleChannel(channel, requests, newFileSystem(s, strings.Split(sconn.Permissions.Extensions["permissions"], ",")), sconn)
 	}
+}
+
+// Waits for the client to ask for something to be run on a session channel and then serves
+// it. Channels have a type that is dependent on the protocol. For SFTP this is "subsystem"
+// with a payload that (should) be "sftp", and for scp it is "exec" with the scp command as
+// the payload. If shells are allowed, "shell" and any other "exec" start a process in the
+// server container instead. Anything else we receive is refused.
+func handleChannel(channel ssh.Channel, requests <-chan *ssh.Request, fs *fileSystem, conn ssh.ConnMetadata) {
+	defer channel.Close()
+
+	var pty *ptyRequest
+	for req := range requests {
+		var payload struct{ Value string }
+		ssh.Unmarshal(req.Payload, &payload)
+
+		switch req.Type {
+		case "subsystem":
+			if payload.Value != "sftp" {
+				req.Reply(false, nil)
+				continue
+			}
+
+			req.Reply(true, nil)
+			go ssh.DiscardRequests(requests)
+
+			rs := sftp.NewRequestServer(channel, newHandlers(fs))
+			if err := rs.Serve(); err == io.EOF {
+				rs.Close()
+			}
+
+			return
+		case "exec":
+			if cmd, ok := parseScpCommand(payload.Value); ok {
+				req.Reply(true, nil)
+				go ssh.DiscardRequests(requests)
+
+				var status uint32
+				if err := cmd.run(channel, fs); err != nil {
+					fs.Logger.Debugw("scp command did not complete", zap.String("server", fs.Server.Uuid), zap.Error(err))
+					status = 1
+				}
+
+				sendExitStatus(channel, status)
+
+				return
+			}
 
-	return s.Filesystem.HasSpaceAvailable()
+			if !fs.canOpenShell() {
+				req.Reply(false, nil)
+				continue
+			}
+
+			req.Reply(true, nil)
+			sendExitStatus(channel, runProcess(channel, requests, fs, conn, pty, payload.Value))
+
+			return
+		case "pty-req":
+			if !fs.canOpenShell() {
+				req.Reply(false, nil)
+				continue
+			}
+
+			pty = &ptyRequest{}
+			if err := ssh.Unmarshal(req.Payload, pty); err != nil {
+				pty = nil
+			}
+
+			req.Reply(pty != nil, nil)
+		case "shell":
+			if !fs.canOpenShell() {
+				req.Reply(false, nil)
+				continue
+			}
+
+			req.Reply(true, nil)
+			sendExitStatus(channel, runProcess(channel, requests, fs, conn, pty, ""))
+
+			return
+		default:
+			req.Reply(false, nil)
+		}
+	}
 }
 
 // Validates a set of credentials for a SFTP login aganist Pterodactyl Panel and returns
@@ -90,3 +286,35 @@ func validateCredentials(c sftp_server.AuthenticationRequest) (*sftp_server.Auth
 
 	return resp, err
 }
+
+// Loads the host key for the SFTP server, generating a new one if none exists yet.
+func loadPrivateKey(p string) (ssh.Signer, error) {
+	if _, err := os.Stat(p); os.IsNotExist(err) {
+		key, err := rsa.GenerateKey(rand.Reader, 2048)
+		if err != nil {
+			return nil, err
+		}
+
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			return nil, err
+		}
+
+		b := pem.EncodeToMemory(&pem.Block{
+			Type:  "RSA PRIVATE KEY",
+			Bytes: x509.MarshalPKCS1PrivateKey(key),
+		})
+
+		if err := ioutil.WriteFile(p, b, 0600); err != nil {
+			return nil, err
+		}
+	} else if err != nil {
+		return nil, err
+	}
+
+	b, err := ioutil.ReadFile(p)
+	if err != nil {
+		return nil, err
+	}
+
+	return ssh.ParsePrivateKey(b)
+}
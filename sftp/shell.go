@@ -0,0 +1,113 @@
+package sftp
+
+import (
+	"fmt"
+	"github.com/pterodactyl/wings/config"
+	"github.com/pterodactyl/wings/server"
+	"go.uber.org/zap"
+	"golang.org/x/crypto/ssh"
+)
+
+// The permission a user must have to open a shell inside of the server container. Server
+// owners and admins always have it, since their permissions are returned as '[*]'.
+const shellPermission = "open-shell"
+
+// The payload of a "pty-req" request, sent by clients that want a terminal.
+type ptyRequest struct {
+	Term    string
+	Columns uint32
+	Rows    uint32
+	Width   uint32
+	Height  uint32
+	Modes   string
+}
+
+// The payload of a "window-change" request, sent when the terminal of the client is resized.
+type windowChangeRequest struct {
+	Columns uint32
+	Rows    uint32
+	Width   uint32
+	Height  uint32
+}
+
+// Determines if the user can open a shell or run commands inside of the server container.
+func (fs *fileSystem) canOpenShell() bool {
+	return config.Get().System.Sftp.AllowShell && fs.Can(shellPermission)
+}
+
+// Runs a command inside of the server container, or the configured shell if the command is
+// empty, streaming it over the channel until it exits. The exit code of the process is
+// returned so that it can be sent to the client.
+func runProcess(channel ssh.Channel, requests <-chan *ssh.Request, fs *fileSystem, conn ssh.ConnMetadata, pty *ptyRequest, command string) uint32 {
+	shell := config.Get().System.Sftp.Shell
+
+	opts := server.ExecOptions{
+		Command: []string{shell},
+		User:    conn.User(),
+		Ip:      conn.RemoteAddr().String(),
+		Source:  "ssh",
+	}
+
+	if command != "" {
+		opts.Command = []string{shell, "-c", command}
+	}
+
+	if pty != nil {
+		opts.Tty = true
+		opts.Width, opts.Height = uint(pty.Columns), uint(pty.Rows)
+		if pty.Term != "" {
+			opts.Env = []string{"TERM=" + pty.Term}
+		}
+	}
+
+	p, err := fs.Server.Exec(opts)
+	if err != nil {
+		go ssh.DiscardRequests(requests)
+
+		if !server.IsExecUnavailableError(err) {
+			fs.Logger.Errorw("failed to start process in server", zap.String("server", fs.Server.Uuid), zap.Error(err))
+			err = fmt.Errorf("failed to start process in server")
+		}
+
+		fmt.Fprintf(channel.Stderr(), "%s\r\n", err.Error())
+
+		return 1
+	}
+
+	go func() {
+		for req := range requests {
+			if req.Type != "window-change" {
+				req.Reply(false, nil)
+				continue
+			}
+
+			var wc windowChangeRequest
+			if err := ssh.Unmarshal(req.Payload, &wc); err != nil {
+				req.Reply(false, nil)
+				continue
+			}
+
+			if err := p.Resize(uint(wc.Columns), uint(wc.Rows)); err != nil {
+				fs.Logger.Debugw("failed to resize terminal of process in server", zap.String("server", fs.Server.Uuid), zap.Error(err))
+			}
+
+			req.Reply(true, nil)
+		}
+	}()
+
+	if err := p.Stream(channel, channel, channel.Stderr()); err != nil {
+		fs.Logger.Debugw("error streaming process in server", zap.String("server", fs.Server.Uuid), zap.Error(err))
+	}
+
+	code, err := p.ExitCode()
+	if err != nil {
+		return 1
+	}
+
+	return uint32(code)
+}
+
+// Tells the client the exit code of the command it ran.
+func sendExitStatus(channel ssh.Channel, status uint32) {
+	channel.SendRequest("exit-status", false, ssh.Marshal(struct{ Status uint32 }{status}))
+}
@@ -0,0 +1,306 @@
+package store
+
+import (
+	"encoding/json"
+	"github.com/pkg/errors"
+	bolt "go.etcd.io/bbolt"
+	"go.uber.org/zap"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// The buckets used by the different subsystems of the daemon to store their state.
+const (
+	// Unique IDs of one time JWTs that have already been used.
+	TokenDenylist = "token_denylist"
+
+	// The outcome of the last installation process that was run for each server.
+	InstallStates = "install_states"
+
+	// Server transfers that are being received by this daemon.
+	Transfers = "transfers"
+
+	// Addresses that have been banned from connecting to the SFTP server.
+	SftpBans = "sftp_bans"
+
+	// Addresses that have been banned from the API after repeatedly failing to
+	// authenticate.
+	ApiBans = "api_bans"
+
+	// Historical resource usage for each server.
+	StatsHistory = "stats_history"
+
+	// The Docker image that has been selected for each server, when it differs from the
+	// default image for the server.
+	ServerImages = "server_images"
+
+	// The backups that were created by a schedule for each server, which are subject to
+	// the backup retention rules for the server.
+	ScheduledBackups = "scheduled_backups"
+
+	// The command macros defined for each server.
+	CommandMacros = "command_macros"
+
+	// The firewall rules that have been added for the allocations of each server.
+	FirewallRules = "firewall_rules"
+
+	// Reports that are waiting to be sent to the Panel once it can be reached.
+	PanelReports = "panel_reports"
+)
+
+var buckets = []string{TokenDenylist, InstallStates, Transfers, SftpBans, ApiBans, StatsHistory, ServerImages, ScheduledBackups, CommandMacros, FirewallRules, PanelReports}
+
+// How often entries that have expired are removed from the store.
+const pruneInterval = time.Minute * 5
+
+var (
+	mu sync.RWMutex
+	db *bolt.DB
+)
+
+// Opens the state database at the given path, creating it if it does not exist. Any
+// entries that have expired are removed periodically until the database is closed.
+func Open(path string) error {
+	mu.Lock()
+	defer mu.Unlock()
+
+	if db != nil {
+		return errors.New("the state store has already been opened")
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return errors.WithStack(err)
+	}
+
+	// Use a timeout so that a second daemon process fails to start rather than waiting
+	// forever for the lock on the database file.
+	d, err := bolt.Open(path, 0600, &bolt.Options{Timeout: time.Second * 5})
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	err = d.Update(func(tx *bolt.Tx) error {
+		for _, b := range buckets {
+			if _, err := tx.CreateBucketIfNotExists([]byte(b)); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		d.Close()
+
+		return errors.WithStack(err)
+	}
+
+	db = d
+	go prune(d)
+
+	return nil
+}
+
+// Closes the state database. Any changes made after this point are not persisted.
+func Close() error {
+	mu.Lock()
+	defer mu.Unlock()
+
+	if db == nil {
+		return nil
+	}
+
+	err := db.Close()
+	db = nil
+
+	return errors.WithStack(err)
+}
+
+// Removes expired entries from all of the buckets until the database is closed.
+func prune(d *bolt.DB) {
+	for range time.Tick(pruneInterval) {
+		mu.RLock()
+		closed := db != d
+		mu.RUnlock()
+
+		if closed {
+			return
+		}
+
+		for _, b := range buckets {
+			if err := NewRepository(b).Prune(); err != nil {
+				zap.S().Warnw("failed to remove expired entries from state store", zap.String("bucket", b), zap.Error(err))
+			}
+		}
+	}
+}
+
+// A single value in the store along with the time that it expires at, if any.
+type entry struct {
+	Data    json.RawMessage `json:"data"`
+	Expires int64           `json:"expires,omitempty"`
+}
+
+func (e *entry) expired() bool {
+	return e.Expires > 0 && time.Now().Unix() >= e.Expires
+}
+
+// Provides access to the values stored in a single bucket. Values are encoded as JSON so
+// that each subsystem can store whatever structure it needs.
+//
+// If the store has not been opened, for example when running one of the CLI commands,
+// all of the operations do nothing and values are never found.
+type Repository struct {
+	bucket string
+}
+
+// Returns a repository for the given bucket.
+func NewRepository(bucket string) *Repository {
+	return &Repository{bucket: bucket}
+}
+
+// Runs the function in a read-write transaction for the bucket.
+func (r *Repository) update(fn func(b *bolt.Bucket) error) error {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	if db == nil {
+		return nil
+	}
+
+	return errors.WithStack(db.Update(func(tx *bolt.Tx) error {
+		return fn(tx.Bucket([]byte(r.bucket)))
+	}))
+}
+
+// Runs the function in a read-only transaction for the bucket.
+func (r *Repository) view(fn func(b *bolt.Bucket) error) error {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	if db == nil {
+		return nil
+	}
+
+	return errors.WithStack(db.View(func(tx *bolt.Tx) error {
+		return fn(tx.Bucket([]byte(r.bucket)))
+	}))
+}
+
+// Stores a value that never expires.
+func (r *Repository) Put(key string, v interface{}) error {
+	return r.PutWithExpiry(key, v, time.Time{})
+}
+
+// Stores a value that is removed from the store once the given time has passed. A zero
+// time means that the value never expires.
+func (r *Repository) PutWithExpiry(key string, v interface{}, expires time.Time) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	e := entry{Data: data}
+	if !expires.IsZero() {
+		e.Expires = expires.Unix()
+	}
+
+	b, err := json.Marshal(e)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	return r.update(func(bk *bolt.Bucket) error {
+		return bk.Put([]byte(key), b)
+	})
+}
+
+// Reads the value stored for a key into v, returning false if there is no value stored
+// or the value has expired.
+func (r *Repository) Get(key string, v interface{}) (bool, error) {
+	var found bool
+
+	err := r.view(func(bk *bolt.Bucket) error {
+		b := bk.Get([]byte(key))
+		if b == nil {
+			return nil
+		}
+
+		var e entry
+		if err := json.Unmarshal(b, &e); err != nil {
+			return err
+		}
+
+		if e.expired() {
+			return nil
+		}
+
+		found = true
+		if v == nil {
+			return nil
+		}
+
+		return json.Unmarshal(e.Data, v)
+	})
+
+	return found, err
+}
+
+// Determines if there is a value stored for the key that has not expired.
+func (r *Repository) Has(key string) (bool, error) {
+	return r.Get(key, nil)
+}
+
+// Removes the value stored for a key.
+func (r *Repository) Delete(key string) error {
+	return r.update(func(bk *bolt.Bucket) error {
+		return bk.Delete([]byte(key))
+	})
+}
+
+// Calls the function for every value in the bucket that has not expired, passing the key
+// and the JSON encoded value. Values should not be modified from within the function.
+func (r *Repository) Each(fn func(key string, data []byte) error) error {
+	return r.view(func(bk *bolt.Bucket) error {
+		return bk.ForEach(func(k, b []byte) error {
+			var e entry
+			if err := json.Unmarshal(b, &e); err != nil {
+				return err
+			}
+
+			if e.expired() {
+				return nil
+			}
+
+			return fn(string(k), e.Data)
+		})
+	})
+}
+
+// Removes all of the values in the bucket that have expired.
+func (r *Repository) Prune() error {
+	return r.update(func(bk *bolt.Bucket) error {
+		var keys [][]byte
+
+		err := bk.ForEach(func(k, b []byte) error {
+			var e entry
+			if err := json.Unmarshal(b, &e); err != nil || e.expired() {
+				keys = append(keys, k)
+			}
+
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+
+		for _, k := range keys {
+			if err := bk.Delete(k); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
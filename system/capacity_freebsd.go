@@ -0,0 +1,21 @@
+package system
+
+import (
+	"golang.org/x/sys/unix"
+	"syscall"
+)
+
+// Returns the total amount of physical memory on the host in bytes.
+func TotalMemory() (uint64, error) {
+	return unix.SysctlUint64("hw.physmem")
+}
+
+// Returns the total size in bytes of the filesystem that the given path is on.
+func DiskCapacity(path string) (uint64, error) {
+	var st syscall.Statfs_t
+	if err := syscall.Statfs(path, &st); err != nil {
+		return 0, err
+	}
+
+	return st.Blocks * uint64(st.Bsize), nil
+}
@@ -0,0 +1,25 @@
+package system
+
+import (
+	"syscall"
+)
+
+// Returns the total amount of physical memory on the host in bytes.
+func TotalMemory() (uint64, error) {
+	var info syscall.Sysinfo_t
+	if err := syscall.Sysinfo(&info); err != nil {
+		return 0, err
+	}
+
+	return uint64(info.Totalram) * uint64(info.Unit), nil
+}
+
+// Returns the total size in bytes of the filesystem that the given path is on.
+func DiskCapacity(path string) (uint64, error) {
+	var st syscall.Statfs_t
+	if err := syscall.Statfs(path, &st); err != nil {
+		return 0, err
+	}
+
+	return st.Blocks * uint64(st.Bsize), nil
+}
@@ -0,0 +1,48 @@
+package system
+
+import (
+	"golang.org/x/sys/windows"
+	"unsafe"
+)
+
+var procGlobalMemoryStatusEx = windows.NewLazySystemDLL("kernel32.dll").NewProc("GlobalMemoryStatusEx")
+
+// Mirrors the MEMORYSTATUSEX structure used by GlobalMemoryStatusEx.
+type memoryStatusEx struct {
+	Length               uint32
+	MemoryLoad           uint32
+	TotalPhys            uint64
+	AvailPhys            uint64
+	TotalPageFile        uint64
+	AvailPageFile        uint64
+	TotalVirtual         uint64
+	AvailVirtual         uint64
+	AvailExtendedVirtual uint64
+}
+
+// Returns the total amount of physical memory on the host in bytes.
+func TotalMemory() (uint64, error) {
+	m := memoryStatusEx{}
+	m.Length = uint32(unsafe.Sizeof(m))
+
+	if r, _, err := procGlobalMemoryStatusEx.Call(uintptr(unsafe.Pointer(&m))); r == 0 {
+		return 0, err
+	}
+
+	return m.TotalPhys, nil
+}
+
+// Returns the total size in bytes of the filesystem that the given path is on.
+func DiskCapacity(path string) (uint64, error) {
+	p, err := windows.UTF16PtrFromString(path)
+	if err != nil {
+		return 0, err
+	}
+
+	var free, total, totalFree uint64
+	if err := windows.GetDiskFreeSpaceEx(p, &free, &total, &totalFree); err != nil {
+		return 0, err
+	}
+
+	return total, nil
+}
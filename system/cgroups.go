@@ -0,0 +1,32 @@
+package system
+
+import (
+	"os"
+	"sync"
+)
+
+// The versions of control groups that resource limits can be applied using.
+const (
+	CgroupsV1 = 1
+	CgroupsV2 = 2
+)
+
+var (
+	detectCgroups sync.Once
+	cgroupVersion int
+)
+
+// Returns the version of control groups in use on the host, which is only looked up the
+// first time this is called. Hosts using only the unified hierarchy have a list of the
+// available controllers at the root of the mount, while hosts using the legacy or hybrid
+// hierarchy do not.
+func CgroupVersion() int {
+	detectCgroups.Do(func() {
+		cgroupVersion = CgroupsV1
+		if _, err := os.Stat("/sys/fs/cgroup/cgroup.controllers"); err == nil {
+			cgroupVersion = CgroupsV2
+		}
+	})
+
+	return cgroupVersion
+}
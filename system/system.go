@@ -11,6 +11,7 @@ type Information struct {
 	Architecture  string `json:"architecture"`
 	OS            string `json:"os"`
 	CpuCount      int    `json:"cpu_count"`
+	CgroupVersion int    `json:"cgroup_version"`
 }
 
 func GetSystemInformation() (*Information, error) {
@@ -25,6 +26,7 @@ func GetSystemInformation() (*Information, error) {
 		Architecture:  runtime.GOARCH,
 		OS:            runtime.GOOS,
 		CpuCount:      runtime.NumCPU(),
+		CgroupVersion: CgroupVersion(),
 	}
 
 	return s, nil
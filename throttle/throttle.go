@@ -0,0 +1,142 @@
+package throttle
+
+import (
+	"io"
+	"sync"
+	"time"
+)
+
+// The largest amount of data that is read or written at once when throttled. Keeping
+// chunks small prevents a single call from consuming a large burst of the bandwidth.
+const maxChunkSize = 32 * 1024
+
+// A token bucket used to limit throughput to a number of bytes per second. The bucket
+// can be shared between multiple readers, in which case the limit applies to all of
+// them combined.
+type Bucket struct {
+	mu sync.Mutex
+
+	rate   int64
+	tokens float64
+	last   time.Time
+}
+
+// Returns a new bucket that allows the given number of bytes per second. A rate of zero
+// or less does not limit throughput at all.
+func NewBucket(rate int64) *Bucket {
+	return &Bucket{rate: rate, tokens: float64(rate), last: time.Now()}
+}
+
+// Updates the number of bytes per second allowed by the bucket.
+func (b *Bucket) SetRate(rate int64) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.rate != rate {
+		b.rate = rate
+		b.tokens = float64(rate)
+		b.last = time.Now()
+	}
+}
+
+// Takes n tokens from the bucket, blocking until enough time has passed for the bucket
+// to have contained them. Callers are allowed to go into debt, which is then paid off
+// by sleeping, so that a large request is never starved by smaller ones.
+func (b *Bucket) Wait(n int) {
+	b.mu.Lock()
+	if b.rate <= 0 {
+		b.mu.Unlock()
+		return
+	}
+
+	now := time.Now()
+	b.tokens += now.Sub(b.last).Seconds() * float64(b.rate)
+	if b.tokens > float64(b.rate) {
+		b.tokens = float64(b.rate)
+	}
+	b.last = now
+	b.tokens -= float64(n)
+
+	var d time.Duration
+	if b.tokens < 0 {
+		d = time.Duration(-b.tokens / float64(b.rate) * float64(time.Second))
+	}
+	b.mu.Unlock()
+
+	if d > 0 {
+		time.Sleep(d)
+	}
+}
+
+type reader struct {
+	r       io.Reader
+	buckets []*Bucket
+}
+
+// Returns a reader that limits the rate data is read from the underlying reader using
+// all of the provided buckets. Any nil buckets are ignored.
+func Reader(r io.Reader, buckets ...*Bucket) io.Reader {
+	rd := &reader{r: r}
+	for _, b := range buckets {
+		if b != nil {
+			rd.buckets = append(rd.buckets, b)
+		}
+	}
+
+	return rd
+}
+
+func (r *reader) Read(p []byte) (int, error) {
+	if len(p) > maxChunkSize {
+		p = p[:maxChunkSize]
+	}
+
+	n, err := r.r.Read(p)
+	for _, b := range r.buckets {
+		b.Wait(n)
+	}
+
+	return n, err
+}
+
+type writer struct {
+	w       io.Writer
+	buckets []*Bucket
+}
+
+// Returns a writer that limits the rate data is written to the underlying writer using
+// all of the provided buckets. Any nil buckets are ignored.
+func Writer(w io.Writer, buckets ...*Bucket) io.Writer {
+	wr := &writer{w: w}
+	for _, b := range buckets {
+		if b != nil {
+			wr.buckets = append(wr.buckets, b)
+		}
+	}
+
+	return wr
+}
+
+func (w *writer) Write(p []byte) (int, error) {
+	var written int
+	for len(p) > 0 {
+		chunk := p
+		if len(chunk) > maxChunkSize {
+			chunk = chunk[:maxChunkSize]
+		}
+
+		for _, b := range w.buckets {
+			b.Wait(len(chunk))
+		}
+
+		n, err := w.w.Write(chunk)
+		written += n
+		if err != nil {
+			return written, err
+		}
+
+		p = p[n:]
+	}
+
+	return written, nil
+}
@@ -0,0 +1,195 @@
+package wake
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"github.com/pkg/errors"
+	"io"
+	"net"
+)
+
+// The maximum length of a packet accepted from a client, which is far larger than any of
+// the packets sent before the client has logged in.
+const maxMinecraftPacket = 1 << 16
+
+// Handles a connection from a Minecraft Java edition client. Status requests are answered
+// using the message as the description of the server, and clients trying to join are
+// disconnected with the message. Returns true if the client was trying to join.
+//
+// @see https://wiki.vg/Server_List_Ping
+func handleMinecraft(conn net.Conn, message string) (bool, error) {
+	r := bufio.NewReader(conn)
+
+	// Clients from before 1.7 send a legacy ping starting with 0xFE, those are not worth
+	// answering, only closing the connection.
+	if b, err := r.Peek(1); err != nil {
+		return false, errors.WithStack(err)
+	} else if b[0] == 0xFE {
+		return false, nil
+	}
+
+	handshake, err := readPacket(r)
+	if err != nil {
+		return false, err
+	}
+
+	if id, _ := readVarInt(handshake); id != 0x00 {
+		return false, errors.New("minecraft: expected handshake packet")
+	}
+
+	protocol, err := readVarInt(handshake)
+	if err != nil {
+		return false, err
+	}
+
+	// Skip over the address and port the client connected to.
+	l, err := readVarInt(handshake)
+	if err != nil {
+		return false, err
+	}
+	if _, err := handshake.Discard(int(l) + 2); err != nil {
+		return false, errors.WithStack(err)
+	}
+
+	next, err := readVarInt(handshake)
+	if err != nil {
+		return false, err
+	}
+
+	text, _ := json.Marshal(map[string]string{"text": message})
+
+	switch next {
+	case 1:
+		return false, answerStatus(conn, r, protocol, text)
+	case 2:
+		// The login start packet is not read since the client is going to be disconnected
+		// regardless of who they are.
+		p := new(bytes.Buffer)
+		writeVarInt(p, 0x00)
+		writeString(p, string(text))
+
+		return true, writePacket(conn, p.Bytes())
+	}
+
+	return false, errors.New("minecraft: unknown handshake state")
+}
+
+// Answers a status request, and the ping that follows it.
+func answerStatus(conn net.Conn, r *bufio.Reader, protocol int32, description json.RawMessage) error {
+	if _, err := readPacket(r); err != nil {
+		return err
+	}
+
+	// The protocol of the client is used as the protocol of the server so that the client
+	// does not show the server as running an incompatible version.
+	status, err := json.Marshal(map[string]interface{}{
+		"version": map[string]interface{}{
+			"name":     "Starting",
+			"protocol": protocol,
+		},
+		"players": map[string]int{
+			"max":    0,
+			"online": 0,
+		},
+		"description": description,
+	})
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	p := new(bytes.Buffer)
+	writeVarInt(p, 0x00)
+	writeString(p, string(status))
+	if err := writePacket(conn, p.Bytes()); err != nil {
+		return err
+	}
+
+	// The ping packet contains a number that must be sent back unchanged.
+	ping, err := readPacket(r)
+	if err != nil {
+		// Not every client sends a ping after the status request.
+		if errors.Cause(err) == io.EOF {
+			return nil
+		}
+
+		return err
+	}
+
+	if id, _ := readVarInt(ping); id != 0x01 {
+		return nil
+	}
+
+	p.Reset()
+	writeVarInt(p, 0x01)
+	if _, err := io.CopyN(p, ping, 8); err != nil {
+		return errors.WithStack(err)
+	}
+
+	return writePacket(conn, p.Bytes())
+}
+
+// Reads a single length prefixed packet.
+func readPacket(r *bufio.Reader) (*bufio.Reader, error) {
+	l, err := readVarInt(r)
+	if err != nil {
+		return nil, err
+	}
+
+	if l <= 0 || l > maxMinecraftPacket {
+		return nil, errors.New("minecraft: invalid packet length")
+	}
+
+	b := make([]byte, l)
+	if _, err := io.ReadFull(r, b); err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	return bufio.NewReader(bytes.NewReader(b)), nil
+}
+
+// Writes a packet, prefixing it with its length.
+func writePacket(w io.Writer, b []byte) error {
+	p := new(bytes.Buffer)
+	writeVarInt(p, int32(len(b)))
+	p.Write(b)
+
+	_, err := w.Write(p.Bytes())
+
+	return errors.WithStack(err)
+}
+
+func writeString(w *bytes.Buffer, s string) {
+	writeVarInt(w, int32(len(s)))
+	w.WriteString(s)
+}
+
+func writeVarInt(w *bytes.Buffer, v int32) {
+	u := uint32(v)
+	for {
+		if u&^0x7F == 0 {
+			w.WriteByte(byte(u))
+			return
+		}
+
+		w.WriteByte(byte(u&0x7F | 0x80))
+		u >>= 7
+	}
+}
+
+func readVarInt(r io.ByteReader) (int32, error) {
+	var out uint32
+	for i := uint(0); i < 5; i++ {
+		b, err := r.ReadByte()
+		if err != nil {
+			return 0, errors.WithStack(err)
+		}
+
+		out |= uint32(b&0x7F) << (7 * i)
+		if b&0x80 == 0 {
+			return int32(out), nil
+		}
+	}
+
+	return 0, errors.New("minecraft: varint is too long")
+}
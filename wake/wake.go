@@ -0,0 +1,151 @@
+package wake
+
+import (
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// The protocols that a wake listener can be used with.
+const (
+	// Any connection made to the port wakes the server.
+	ProtocolTcp = "tcp"
+	// Any datagram sent to the port wakes the server.
+	ProtocolUdp = "udp"
+	// Status pings from the Minecraft Java edition server list are answered with the wake
+	// message, and only an attempt to join the server wakes it.
+	ProtocolMinecraft = "minecraft"
+)
+
+// Listens on the port of a stopped server and calls a function the first time a player
+// tries to connect, so that the server can be started on demand. The listener must be
+// closed before the server is started so that the port is free for the server to use.
+type Listener struct {
+	protocol string
+	message  string
+	onWake   func()
+
+	woken int32
+
+	tcp  net.Listener
+	udp  net.PacketConn
+	wg   sync.WaitGroup
+	once sync.Once
+}
+
+// Opens a wake listener on the given address. The message is sent to players connecting
+// using protocols that are able to display one, and the onWake function is called in its
+// own goroutine at most once.
+func Listen(protocol string, address string, message string, onWake func()) (*Listener, error) {
+	l := &Listener{protocol: protocol, message: message, onWake: onWake}
+
+	switch protocol {
+	case ProtocolTcp, ProtocolMinecraft:
+		tl, err := net.Listen("tcp", address)
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+		l.tcp = tl
+
+		l.wg.Add(1)
+		go l.acceptLoop()
+	case ProtocolUdp:
+		pc, err := net.ListenPacket("udp", address)
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+		l.udp = pc
+
+		l.wg.Add(1)
+		go l.readLoop()
+	default:
+		return nil, errors.Errorf("wake: unknown protocol \"%s\"", protocol)
+	}
+
+	return l, nil
+}
+
+// Closes the listener, freeing the port that it was listening on. This waits for the
+// listener to stop accepting connections, but does not wait for connections that are
+// still being handled.
+func (l *Listener) Close() error {
+	var err error
+	l.once.Do(func() {
+		if l.tcp != nil {
+			err = l.tcp.Close()
+		}
+		if l.udp != nil {
+			err = l.udp.Close()
+		}
+
+		l.wg.Wait()
+	})
+
+	return err
+}
+
+// Calls the wake function if it has not already been called.
+func (l *Listener) wake() {
+	if atomic.CompareAndSwapInt32(&l.woken, 0, 1) {
+		go l.onWake()
+	}
+}
+
+func (l *Listener) acceptLoop() {
+	defer l.wg.Done()
+
+	for {
+		conn, err := l.tcp.Accept()
+		if err != nil {
+			if ne, ok := err.(net.Error); ok && ne.Temporary() {
+				time.Sleep(time.Millisecond * 50)
+				continue
+			}
+
+			return
+		}
+
+		go l.handle(conn)
+	}
+}
+
+func (l *Listener) handle(conn net.Conn) {
+	defer conn.Close()
+
+	if l.protocol != ProtocolMinecraft {
+		l.wake()
+		return
+	}
+
+	conn.SetDeadline(time.Now().Add(time.Second * 10))
+
+	join, err := handleMinecraft(conn, l.message)
+	if err != nil {
+		zap.S().Debugw("failed to handle connection to wake listener", zap.String("remote", conn.RemoteAddr().String()), zap.Error(err))
+		return
+	}
+
+	if join {
+		l.wake()
+	}
+}
+
+func (l *Listener) readLoop() {
+	defer l.wg.Done()
+
+	b := make([]byte, 1500)
+	for {
+		if _, _, err := l.udp.ReadFrom(b); err != nil {
+			if ne, ok := err.(net.Error); ok && ne.Temporary() {
+				continue
+			}
+
+			return
+		}
+
+		l.wake()
+	}
+}
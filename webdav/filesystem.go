@@ -0,0 +1,187 @@
+package webdav
+
+import (
+	"context"
+	"github.com/pterodactyl/wings/config"
+	"github.com/pterodactyl/wings/server"
+	"go.uber.org/zap"
+	"golang.org/x/net/webdav"
+	"os"
+)
+
+// Serves the files of a single server over WebDAV. All paths are resolved through the server
+// filesystem so that the same protections applied to the file API also apply here, and the
+// permissions checked are the same ones used by the SFTP server.
+type fileSystem struct {
+	*server.FileAccess
+}
+
+func newFileSystem(s *server.Server, permissions []string) *fileSystem {
+	return &fileSystem{
+		FileAccess: server.NewFileAccess(s, permissions, config.Get().System.Webdav.ReadOnly, zap.S().Named("webdav")),
+	}
+}
+
+func (fs *fileSystem) Mkdir(ctx context.Context, name string, perm os.FileMode) error {
+	p, err := fs.Server.Filesystem.SafePath(name)
+	if err != nil {
+		return os.ErrNotExist
+	}
+
+	if !fs.Can("create-files") || !fs.CanModify(p) {
+		return os.ErrPermission
+	}
+
+	if err := os.Mkdir(p, 0755); err != nil {
+		return err
+	}
+
+	fs.Chown(p)
+
+	return nil
+}
+
+func (fs *fileSystem) OpenFile(ctx context.Context, name string, flag int, perm os.FileMode) (webdav.File, error) {
+	p, err := fs.Server.Filesystem.SafePath(name)
+	if err != nil {
+		return nil, os.ErrNotExist
+	}
+
+	// Reading a directory lists it, while reading a file returns its contents, which the
+	// Panel calls editing.
+	if flag&(os.O_WRONLY|os.O_RDWR|os.O_CREATE|os.O_TRUNC|os.O_APPEND) == 0 {
+		st, err := os.Stat(p)
+		if err != nil {
+			return nil, err
+		}
+
+		if (st.IsDir() && !fs.Can("list-files")) || (!st.IsDir() && !fs.Can("edit-files")) {
+			return nil, os.ErrPermission
+		}
+
+		return fs.Server.Filesystem.OpenFile(p, os.O_RDONLY, 0)
+	}
+
+	if !fs.CanModify(p) {
+		return nil, os.ErrPermission
+	}
+
+	if _, err := os.Stat(p); os.IsNotExist(err) {
+		if !fs.Can("create-files") {
+			return nil, os.ErrPermission
+		}
+	} else if err != nil {
+		return nil, err
+	} else if !fs.Can("save-files") {
+		return nil, os.ErrPermission
+	}
+
+	if !fs.HasSpaceAvailable() {
+		return nil, os.ErrPermission
+	}
+
+	upload, err := fs.BeginUpload()
+	if err != nil {
+		return nil, err
+	}
+
+	f, err := fs.Server.Filesystem.OpenFile(p, flag, 0644)
+	if err != nil {
+		upload.Done()
+		return nil, err
+	}
+
+	fs.Chown(p)
+
+	return &uploadedFile{file: f, fs: fs, path: p, upload: upload}, nil
+}
+
+func (fs *fileSystem) RemoveAll(ctx context.Context, name string) error {
+	p, err := fs.Server.Filesystem.SafeLinkPath(name)
+	if err != nil {
+		return os.ErrNotExist
+	}
+
+	// The root of the server cannot be removed, only what is in it.
+	if !fs.Can("delete-files") || !fs.CanModify(p) || p == fs.Server.Filesystem.Path() {
+		return os.ErrPermission
+	}
+
+	return os.RemoveAll(p)
+}
+
+func (fs *fileSystem) Rename(ctx context.Context, oldName string, newName string) error {
+	from, err := fs.Server.Filesystem.SafeLinkPath(oldName)
+	if err != nil {
+		return os.ErrNotExist
+	}
+
+	to, err := fs.Server.Filesystem.SafeLinkPath(newName)
+	if err != nil {
+		return os.ErrPermission
+	}
+
+	if !fs.Can("move-files") || !fs.CanModify(from) || !fs.CanModify(to) || from == fs.Server.Filesystem.Path() {
+		return os.ErrPermission
+	}
+
+	if err := os.Rename(from, to); err != nil {
+		return err
+	}
+
+	fs.Chown(to)
+
+	return nil
+}
+
+func (fs *fileSystem) Stat(ctx context.Context, name string) (os.FileInfo, error) {
+	if !fs.Can("list-files") {
+		return nil, os.ErrPermission
+	}
+
+	p, err := fs.Server.Filesystem.SafePath(name)
+	if err != nil {
+		return nil, os.ErrNotExist
+	}
+
+	return os.Stat(p)
+}
+
+// A file opened for writing over WebDAV. Writes are throttled to the configured upload
+// bandwidth limits, and once the file is closed it is scanned for malware in the background.
+// The file is not embedded so that copying into it cannot bypass the throttled writes.
+type uploadedFile struct {
+	file   *os.File
+	fs     *fileSystem
+	path   string
+	upload *server.Upload
+}
+
+func (f *uploadedFile) Read(b []byte) (int, error) {
+	return f.file.Read(b)
+}
+
+func (f *uploadedFile) Seek(offset int64, whence int) (int64, error) {
+	return f.file.Seek(offset, whence)
+}
+
+func (f *uploadedFile) Readdir(count int) ([]os.FileInfo, error) {
+	return f.file.Readdir(count)
+}
+
+func (f *uploadedFile) Stat() (os.FileInfo, error) {
+	return f.file.Stat()
+}
+
+func (f *uploadedFile) Write(b []byte) (int, error) {
+	f.upload.Wait(len(b))
+
+	return f.file.Write(b)
+}
+
+func (f *uploadedFile) Close() error {
+	err := f.file.Close()
+	f.fs.FinishUpload(f.path, f.upload)
+
+	return err
+}
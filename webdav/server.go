@@ -0,0 +1,162 @@
+package webdav
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"github.com/patrickmn/go-cache"
+	"github.com/pkg/errors"
+	"github.com/pterodactyl/sftp-server"
+	"github.com/pterodactyl/wings/api"
+	"github.com/pterodactyl/wings/config"
+	"github.com/pterodactyl/wings/server"
+	"go.uber.org/zap"
+	"golang.org/x/net/webdav"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+)
+
+func Initialize(config *config.Configuration) error {
+	// Initialize the WebDAV server in a background thread since this is a long running
+	// operation.
+	go func() {
+		if err := listen(config); err != nil {
+			zap.S().Named("webdav").Errorw("failed to initialize WebDAV subsystem", zap.Error(errors.WithStack(err)))
+		}
+	}()
+
+	return nil
+}
+
+// A set of credentials that has been validated by the Panel, along with the server they
+// are for and the permissions of the user on that server.
+type login struct {
+	server      *server.Server
+	permissions []string
+}
+
+// Authenticates every request using the SFTP credentials of the user, and serves the files
+// of the server those credentials are for.
+type handler struct {
+	logins *cache.Cache
+	logger *zap.SugaredLogger
+
+	// Locks taken out by clients are tracked for each server separately, since the paths
+	// of every server begin at the root of its own directory.
+	mu    sync.Mutex
+	locks map[string]webdav.LockSystem
+}
+
+// Starts listening for inbound WebDAV requests.
+func listen(cfg *config.Configuration) error {
+	logger := zap.S().Named("webdav")
+
+	h := &handler{
+		logins: cache.New(time.Second*time.Duration(cfg.System.Webdav.CredentialCache), time.Minute),
+		logger: logger,
+		locks:  make(map[string]webdav.LockSystem),
+	}
+
+	l, err := net.Listen("tcp", fmt.Sprintf("%s:%d", cfg.System.Webdav.Address, cfg.System.Webdav.Port))
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	srv := &http.Server{Handler: h}
+
+	logger.Infow("webdav subsystem listening for connections", zap.String("host", cfg.System.Webdav.Address), zap.Int("port", cfg.System.Webdav.Port), zap.Bool("ssl", cfg.Api.Ssl.Enabled))
+
+	if cfg.Api.Ssl.Enabled {
+		return srv.ServeTLS(l, cfg.Api.Ssl.CertificateFile, cfg.Api.Ssl.KeyFile)
+	}
+
+	logger.Warnw("ssl is not enabled for the api, webdav credentials will be sent unencrypted")
+
+	return srv.Serve(l)
+}
+
+func (h *handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	user, pass, ok := r.BasicAuth()
+	if !ok {
+		h.unauthorized(w)
+		return
+	}
+
+	l, err := h.authenticate(user, pass)
+	if err != nil {
+		if sftp_server.IsInvalidCredentialsError(err) {
+			h.unauthorized(w)
+			return
+		}
+
+		h.logger.Errorw("encountered error validating user credentials", zap.String("ip", r.RemoteAddr), zap.Error(err))
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	dav := &webdav.Handler{
+		FileSystem: newFileSystem(l.server, l.permissions),
+		LockSystem: h.lockSystem(l.server.Uuid),
+		Logger: func(r *http.Request, err error) {
+			if err != nil {
+				h.logger.Debugw("error handling webdav request", zap.String("server", l.server.Uuid), zap.String("method", r.Method), zap.String("path", r.URL.Path), zap.Error(err))
+			}
+		},
+	}
+
+	dav.ServeHTTP(w, r)
+}
+
+func (h *handler) unauthorized(w http.ResponseWriter) {
+	w.Header().Set("WWW-Authenticate", `Basic realm="Pterodactyl"`)
+	http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+}
+
+// Validates a set of credentials against the Panel, returning the server they are for.
+// Credentials that are valid are remembered for a short time, since clients send them
+// along with every request they make.
+func (h *handler) authenticate(user string, pass string) (*login, error) {
+	sum := sha256.Sum256([]byte(user + "\x00" + pass))
+	key := hex.EncodeToString(sum[:])
+
+	if v, ok := h.logins.Get(key); ok {
+		return v.(*login), nil
+	}
+
+	resp, err := api.NewRequester().ValidateSftpCredentials(sftp_server.AuthenticationRequest{
+		User: user,
+		Pass: pass,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	s := server.GetServers().Find(func(s *server.Server) bool {
+		return s.Uuid == resp.Server
+	})
+
+	if s == nil {
+		return nil, errors.New("no server found with that UUID")
+	}
+
+	l := &login{server: s, permissions: resp.Permissions}
+	h.logins.SetDefault(key, l)
+
+	return l, nil
+}
+
+// Returns the lock system used for the files of a server.
+func (h *handler) lockSystem(uuid string) webdav.LockSystem {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	ls, ok := h.locks[uuid]
+	if !ok {
+		ls = webdav.NewMemLS()
+		h.locks[uuid] = ls
+	}
+
+	return ls
+}